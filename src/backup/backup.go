@@ -43,6 +43,8 @@ type BackupOptions struct {
 	IncludeData bool
 	CreatedBy   string
 	AppVersion  string
+	// Backups kept in the backup directory; the last 4 when not set
+	Retention RetentionPolicy
 }
 
 // BackupService handles backup operations per AI.md PART 25
@@ -142,7 +144,13 @@ func (s *BackupService) Create(opts BackupOptions) (string, error) {
 
 	// Cleanup old backups per AI.md PART 25 lines 22496-22542
 	// "Only delete old backups if new backup passes ALL verification checks"
-	if err := s.cleanupOldBackups(backupDir, 4); err != nil {
+	var cleanupErr error
+	if opts.Retention.IsZero() {
+		cleanupErr = s.cleanupOldBackups(backupDir, 4)
+	} else {
+		cleanupErr = s.pruneBackups(backupDir, opts.Retention)
+	}
+	if err := cleanupErr; err != nil {
 		// Log but don't fail - backup itself succeeded
 		fmt.Fprintf(os.Stderr, "Warning: failed to cleanup old backups: %v\n", err)
 	}
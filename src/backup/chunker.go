@@ -0,0 +1,118 @@
+// Package backup - content-defined chunking for the snapshot repository
+package backup
+
+import (
+	"io"
+	"math/bits"
+)
+
+// chunkParams bound the chunk sizes; cut points fall on content, so an
+// insertion only changes the chunks around it
+type chunkParams struct {
+	Min int `json:"min"`
+	Avg int `json:"avg"`
+	Max int `json:"max"`
+}
+
+var defaultChunkParams = chunkParams{Min: 16 << 10, Avg: 64 << 10, Max: 256 << 10}
+
+// gear holds the random values of the gear rolling hash (FastCDC)
+var gear [256]uint64
+
+func init() {
+	// splitmix64 with a fixed seed: every build must cut the same chunks
+	x := uint64(0x5745415448455221)
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// chunker splits a stream into content-defined chunks
+type chunker struct {
+	r      io.Reader
+	p      chunkParams
+	buf    []byte
+	start  int
+	end    int
+	eof    bool
+	strict uint64
+	loose  uint64
+}
+
+func newChunker(r io.Reader, p chunkParams) *chunker {
+	// Normalized chunking: a stricter mask below the average size and a
+	// looser one above it keep sizes close to the average
+	avgBits := bits.Len(uint(p.Avg)) - 1
+	return &chunker{
+		r:      r,
+		p:      p,
+		buf:    make([]byte, p.Max),
+		strict: topBits(avgBits + 1),
+		loose:  topBits(avgBits - 1),
+	}
+}
+
+// topBits returns a mask of the n most significant bits, which depend on
+// the last 64 bytes hashed
+func topBits(n int) uint64 {
+	return ^uint64(0) << (64 - n)
+}
+
+// Next returns the next chunk, valid until the following call, or io.EOF
+func (c *chunker) Next() ([]byte, error) {
+	if c.end-c.start < c.p.Max && !c.eof {
+		copy(c.buf, c.buf[c.start:c.end])
+		c.end -= c.start
+		c.start = 0
+		for c.end < len(c.buf) && !c.eof {
+			n, err := c.r.Read(c.buf[c.end:])
+			c.end += n
+			if err == io.EOF {
+				c.eof = true
+			} else if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := c.cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// cut returns the length of the chunk at the start of data
+func (c *chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.p.Min {
+		return n
+	}
+	if n > c.p.Max {
+		n = c.p.Max
+	}
+	normal := c.p.Avg
+	if normal > n {
+		normal = n
+	}
+	var h uint64
+	i := c.p.Min
+	for ; i < normal; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&c.strict == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		h = h<<1 + gear[data[i]]
+		if h&c.loose == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,126 @@
+// Package backup - restore drill: prove the latest backup can be restored
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/backup/objectstore"
+)
+
+// DrillOptions selects the backup a restore drill checks
+type DrillOptions struct {
+	// Target to fetch the latest backup from; the local backup directory
+	// when nil
+	Store    objectstore.Store
+	Password string
+}
+
+// DrillResult describes a successful restore drill
+type DrillResult struct {
+	Backup    string
+	Source    string
+	Size      int64
+	CreatedAt time.Time
+	Files     []string
+	Databases []string
+	Duration  time.Duration
+}
+
+// Drill restores the latest backup into a temporary directory: it
+// downloads it when it is remote, runs Verify, extracts the archive and
+// runs the SQLite integrity check on each database in it. Nothing outside
+// the temporary directory is touched
+func (s *BackupService) Drill(ctx context.Context, opts DrillOptions) (*DrillResult, error) {
+	start := time.Now()
+	tmp, err := os.MkdirTemp("", "weather-restore-drill-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	result := &DrillResult{}
+	var backupPath string
+	if opts.Store == nil {
+		result.Source = filepath.Join(s.dataDir, "backup")
+		backupPath, err = latestLocalBackup(result.Source)
+		if err != nil {
+			return nil, err
+		}
+		result.CreatedAt, _ = BackupTime(backupPath)
+	} else {
+		result.Source = opts.Store.String()
+		backups, err := ListRemoteBackups(ctx, opts.Store)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", opts.Store, err)
+		}
+		if len(backups) == 0 {
+			return nil, fmt.Errorf("no backups on %s", opts.Store)
+		}
+		latest := backups[len(backups)-1]
+		backupPath = filepath.Join(tmp, latest.Filename)
+		if err := DownloadBackup(ctx, opts.Store, latest, backupPath); err != nil {
+			return nil, err
+		}
+		result.CreatedAt = latest.CreatedAt
+	}
+	result.Backup = filepath.Base(backupPath)
+
+	if err := s.Verify(backupPath, opts.Password); err != nil {
+		return nil, fmt.Errorf("%s: %w", result.Backup, err)
+	}
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	result.Size = int64(len(data))
+	if filepath.Ext(backupPath) == ".enc" {
+		if data, err = s.decrypt(data, opts.Password); err != nil {
+			return nil, fmt.Errorf("%s: %w", result.Backup, err)
+		}
+	}
+	manifest, err := s.extractManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", result.Backup, err)
+	}
+	result.Files = manifest.Contents
+
+	configDir, dataDir := filepath.Join(tmp, "config"), filepath.Join(tmp, "data")
+	if err := s.extractArchive(data, configDir, dataDir); err != nil {
+		return nil, fmt.Errorf("failed to extract %s: %w", result.Backup, err)
+	}
+	for _, file := range manifest.Contents {
+		if !strings.HasPrefix(file, "db/") || !strings.HasSuffix(file, ".db") {
+			continue
+		}
+		path := filepath.Join(dataDir, filepath.FromSlash(file))
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("%s lists %s but does not contain it", result.Backup, file)
+		}
+		if err := checkIntegrity(path); err != nil {
+			return nil, fmt.Errorf("%s in %s: %w", file, result.Backup, err)
+		}
+		result.Databases = append(result.Databases, file)
+	}
+	result.Duration = time.Since(start)
+	return result, nil
+}
+
+// latestLocalBackup returns the newest backup archive in dir
+func latestLocalBackup(dir string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, backupFilePrefix+"*.tar.gz*"))
+	if err != nil {
+		return "", err
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no backups in %s", dir)
+	}
+	// The timestamp in the name sorts chronologically
+	sort.Strings(files)
+	return files[len(files)-1], nil
+}
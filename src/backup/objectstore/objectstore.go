@@ -0,0 +1,99 @@
+// Package objectstore stores backup objects in a local directory, an
+// S3-compatible bucket (AWS S3, MinIO, Ceph, Backblaze B2, ...), an SFTP
+// server or a WebDAV share
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotExist is returned by Get for a key that is not stored
+var ErrNotExist = errors.New("object does not exist")
+
+// Object describes a stored object
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Store is a flat key/value store of objects. Keys use "/" as separator
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the objects whose key starts with prefix, sorted by key
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// String describes the target for logs and status pages, without secrets
+	String() string
+}
+
+// Config selects and configures a store
+type Config struct {
+	// A directory path, s3://bucket/prefix, sftp://user@host:port/path or
+	// http(s)://host/path for WebDAV
+	Target string
+	S3     S3Config
+	SFTP   SFTPConfig
+	WebDAV WebDAVConfig
+}
+
+// S3Config holds the connection settings of an S3-compatible target
+type S3Config struct {
+	// e.g. https://s3.us-east-1.amazonaws.com or http://minio:9000
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// Address the bucket as endpoint/bucket instead of bucket.endpoint
+	// (required by MinIO and most self-hosted servers)
+	PathStyle bool
+}
+
+// SFTPConfig holds the credentials of an SFTP target
+type SFTPConfig struct {
+	// Defaults to the user in the target URL
+	Username string
+	Password string
+	// Path of an unencrypted OpenSSH private key file
+	PrivateKey string
+	// Fingerprint the server's host key must have, as printed by
+	// ssh-keygen -lf (SHA256:...)
+	HostKey string
+}
+
+// WebDAVConfig holds the credentials of a WebDAV target
+type WebDAVConfig struct {
+	Username string
+	Password string
+}
+
+// Open returns the store for cfg.Target
+func Open(cfg Config) (Store, error) {
+	target := strings.TrimSpace(cfg.Target)
+	switch {
+	case target == "":
+		return nil, errors.New("no target configured")
+	case strings.HasPrefix(target, "s3://"):
+		bucket, prefix, _ := strings.Cut(strings.TrimPrefix(target, "s3://"), "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("invalid S3 target %q: missing bucket", target)
+		}
+		return NewS3(bucket, prefix, cfg.S3)
+	case strings.HasPrefix(target, "sftp://"):
+		return NewSFTP(target, cfg.SFTP)
+	case strings.HasPrefix(target, "https://"), strings.HasPrefix(target, "http://"):
+		return NewWebDAV(target, cfg.WebDAV)
+	case strings.HasPrefix(target, "file://"):
+		return NewFile(strings.TrimPrefix(target, "file://"))
+	case strings.Contains(target, "://"):
+		return nil, fmt.Errorf("unsupported target %q: use a directory, s3://, sftp:// or http(s):// (WebDAV)", target)
+	default:
+		return NewFile(target)
+	}
+}
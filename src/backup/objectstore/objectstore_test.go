@@ -0,0 +1,161 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apimgr/weather/src/backup/objectstore/s3test"
+	"github.com/apimgr/weather/src/backup/objectstore/sftptest"
+
+	"golang.org/x/net/webdav"
+)
+
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+	keys := []string{"a/one.gz", "a/two words+.gz", "b/three.gz"}
+	for _, key := range keys {
+		if err := store.Put(ctx, key, []byte("data "+key)); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+	data, err := store.Get(ctx, "a/two words+.gz")
+	if err != nil || string(data) != "data a/two words+.gz" {
+		t.Errorf("Get = %q, %v", data, err)
+	}
+	if _, err := store.Get(ctx, "a/missing"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Get missing = %v, want ErrNotExist", err)
+	}
+
+	objects, err := store.List(ctx, "a/")
+	if err != nil || len(objects) != 2 || objects[0].Key != "a/one.gz" || objects[1].Key != "a/two words+.gz" {
+		t.Fatalf("List = %+v, %v", objects, err)
+	}
+	if objects[0].Size != int64(len("data a/one.gz")) {
+		t.Errorf("size = %d", objects[0].Size)
+	}
+
+	if err := store.Delete(ctx, "a/one.gz"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "a/one.gz"); err != nil {
+		t.Errorf("Delete missing = %v", err)
+	}
+	if objects, _ := store.List(ctx, ""); len(objects) != 2 {
+		t.Errorf("List after delete = %+v", objects)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := Open(Config{Target: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+	if err := store.Put(context.Background(), "../escape", nil); err != nil {
+		t.Fatal(err)
+	}
+	if objects, _ := store.List(context.Background(), "escape"); len(objects) != 1 {
+		t.Error("A key with .. was not kept inside the directory")
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	server := s3test.NewServer("backups")
+	defer server.Close()
+	server.PageSize = 1
+
+	cfg := S3Config{Endpoint: server.URL, AccessKey: s3test.AccessKey, SecretKey: s3test.SecretKey, PathStyle: true}
+	store, err := Open(Config{Target: "s3://backups/weather/replica", S3: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+	if keys := server.Keys("backups"); len(keys) != 2 || !strings.HasPrefix(keys[0], "weather/replica/") {
+		t.Errorf("bucket keys = %v", keys)
+	}
+
+	cfg.SecretKey = "wrong"
+	bad, _ := NewS3("backups", "", cfg)
+	if err := bad.Put(context.Background(), "x", nil); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put with a wrong secret = %v", err)
+	}
+}
+
+func TestSFTPStore(t *testing.T) {
+	dir := t.TempDir()
+	server, err := sftptest.NewServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	cfg := SFTPConfig{Password: sftptest.Password, HostKey: server.HostKeyFingerprint()}
+	store, err := Open(Config{Target: "sftp://" + sftptest.Username + "@" + server.Addr + "/~/weather/backups", SFTP: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.(*SFTP).Close()
+	testStore(t, store)
+	if _, err := os.Stat(filepath.Join(dir, "weather", "backups", "b", "three.gz")); err != nil {
+		t.Errorf("object not stored below the target path: %v", err)
+	}
+
+	// The store reconnects after the connection drops
+	server.DropConnections()
+	ctx := context.Background()
+	store.Get(ctx, "b/three.gz")
+	if data, err := store.Get(ctx, "b/three.gz"); err != nil || string(data) != "data b/three.gz" {
+		t.Errorf("Get after reconnect = %q, %v", data, err)
+	}
+
+	cfg.HostKey = "SHA256:not-the-key"
+	bad, _ := NewSFTP("sftp://"+sftptest.Username+"@"+server.Addr+"/~/x", cfg)
+	if err := bad.Put(ctx, "x", nil); err == nil || !strings.Contains(err.Error(), "host key") {
+		t.Errorf("Put with a wrong host key = %v", err)
+	}
+}
+
+func TestWebDAVStore(t *testing.T) {
+	handler := &webdav.Handler{FileSystem: webdav.NewMemFS(), LockSystem: webdav.NewMemLS()}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "backup" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="backups"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	store, err := Open(Config{Target: server.URL + "/dav/weather", WebDAV: WebDAVConfig{Username: "backup", Password: "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+
+	bad, _ := NewWebDAV(server.URL+"/dav", WebDAVConfig{Username: "backup"})
+	if err := bad.Put(context.Background(), "x", nil); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Put without the password = %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for _, target := range []string{"", "s3://", "ftp://host/dir"} {
+		if _, err := Open(Config{Target: target, S3: S3Config{AccessKey: "a", SecretKey: "b"}}); err == nil {
+			t.Errorf("Open(%q) should fail", target)
+		}
+	}
+	if _, err := Open(Config{Target: "s3://bucket"}); err == nil {
+		t.Error("Open without S3 credentials should fail")
+	}
+	if _, err := Open(Config{Target: "sftp://user@host/dir", SFTP: SFTPConfig{Password: "p"}}); err == nil {
+		t.Error("Open without an SFTP host key should fail")
+	}
+}
@@ -0,0 +1,127 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores objects in a bucket of an S3-compatible server through the
+// MinIO client, which signs requests with AWS Signature Version 4
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3 returns a store for bucket; keys are stored below prefix
+func NewS3(bucket, prefix string, cfg S3Config) (*S3, error) {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3.amazonaws.com"
+		if cfg.Region != "" && cfg.Region != "us-east-1" {
+			endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+		}
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if strings.Trim(u.Path, "/") != "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: the endpoint cannot have a path", cfg.Endpoint)
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("S3 access_key and secret_key are required")
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	lookup := minio.BucketLookupDNS
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       u.Scheme == "https",
+		Region:       region,
+		BucketLookup: lookup,
+		// Callers retry failed uploads on their own schedule
+		MaxRetries: 1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %w", cfg.Endpoint, err)
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+// Put uploads the object
+func (s *S3) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+	return s.error("PUT", key, err)
+}
+
+// Get downloads the object
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s.error("GET", key, err)
+	}
+	defer object.Close()
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, s.error("GET", key, err)
+	}
+	return data, nil
+}
+
+// List pages through ListObjectsV2
+func (s *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix + prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, s.error("LIST", prefix, info.Err)
+		}
+		objects = append(objects, Object{Key: strings.TrimPrefix(info.Key, s.prefix), Size: info.Size, ModTime: info.LastModified})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Delete removes the object
+func (s *S3) Delete(ctx context.Context, key string) error {
+	return s.error("DELETE", key, s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{}))
+}
+
+// String returns the s3:// URL of the target
+func (s *S3) String() string {
+	return "s3://" + s.bucket + "/" + s.prefix
+}
+
+// error adds the operation to err. A missing object is ErrNotExist
+func (s *S3) error(op, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	resp := minio.ToErrorResponse(err)
+	switch {
+	case resp.Code == "NoSuchKey" || (resp.StatusCode == http.StatusNotFound && resp.Code == ""):
+		return fmt.Errorf("%s: %w", key, ErrNotExist)
+	case resp.Code != "":
+		return fmt.Errorf("S3 %s %s: %s (%s)", op, key, resp.Message, resp.Code)
+	}
+	return fmt.Errorf("S3 %s %s: %w", op, key, err)
+}
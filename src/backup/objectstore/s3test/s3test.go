@@ -0,0 +1,297 @@
+// Package s3test provides an in-memory S3-compatible server for tests,
+// standing in for MinIO. It checks SigV4 signatures, including the
+// chunk signatures of streaming uploads, and supports the object calls
+// objectstore.S3 makes
+package s3test
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials the server accepts
+const (
+	AccessKey = "test-access-key"
+	SecretKey = "test-secret-key"
+	Region    = "us-east-1"
+)
+
+// Server is a path-style S3 server holding objects in memory
+type Server struct {
+	*httptest.Server
+	// Objects per page of a listing; small values exercise pagination
+	PageSize int
+
+	mu      sync.Mutex
+	buckets map[string]map[string]object
+	// Fail every request while set, to simulate an outage
+	down bool
+}
+
+// object is a stored object
+type object struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewServer starts a server with the given buckets
+func NewServer(buckets ...string) *Server {
+	s := &Server{PageSize: 1000, buckets: make(map[string]map[string]object)}
+	for _, b := range buckets {
+		s.buckets[b] = make(map[string]object)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// SetDown makes every request fail with 503 until called with false
+func (s *Server) SetDown(down bool) {
+	s.mu.Lock()
+	s.down = down
+	s.mu.Unlock()
+}
+
+// Keys returns the keys stored in bucket, sorted
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.buckets[bucket] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		writeError(w, http.StatusServiceUnavailable, "SlowDown", "Service unavailable")
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	body, code, msg := verify(r, body)
+	if code != "" {
+		writeError(w, http.StatusForbidden, code, msg)
+		return
+	}
+
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	bucket, ok := s.buckets[bucketName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		s.list(w, r, bucket)
+	case r.Method == http.MethodPut:
+		bucket[key] = object{data: body, modTime: time.Now().UTC()}
+		w.Header().Set("ETag", etag(body))
+	case r.Method == http.MethodGet:
+		obj, ok := bucket[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+			return
+		}
+		w.Header().Set("ETag", etag(obj.data))
+		w.Header().Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Write(obj.data)
+	case r.Method == http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+type listContent struct {
+	Key          string
+	Size         int64
+	LastModified string
+}
+
+type listResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Contents              []listContent
+	IsTruncated           bool
+	NextContinuationToken string `xml:",omitempty"`
+}
+
+// list answers ListObjectsV2; the continuation token is the next offset
+func (s *Server) list(w http.ResponseWriter, r *http.Request, bucket map[string]object) {
+	prefix := r.URL.Query().Get("prefix")
+	var keys []string
+	for k := range bucket {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	start, _ := strconv.Atoi(r.URL.Query().Get("continuation-token"))
+	var result listResult
+	for i := start; i < len(keys); i++ {
+		if len(result.Contents) == s.PageSize {
+			result.IsTruncated = true
+			result.NextContinuationToken = strconv.Itoa(i)
+			break
+		}
+		result.Contents = append(result.Contents, listContent{
+			Key:          keys[i],
+			Size:         int64(len(bucket[keys[i]].data)),
+			LastModified: bucket[keys[i]].modTime.Format(time.RFC3339),
+		})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
+
+// streamingPayload is the X-Amz-Content-Sha256 of an aws-chunked upload
+// whose chunks are signed one by one
+const streamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+
+// verify recomputes the SigV4 signature of r from scratch and returns the
+// payload, decoding an aws-chunked body
+func verify(r *http.Request, body []byte) ([]byte, string, string) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return nil, "AccessDenied", "missing signature"
+	}
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		fields[k] = v
+	}
+	cred := strings.Split(fields["Credential"], "/")
+	if len(cred) != 5 || cred[0] != AccessKey {
+		return nil, "InvalidAccessKeyId", "unknown access key"
+	}
+	contentHash := r.Header.Get("X-Amz-Content-Sha256")
+	if contentHash != streamingPayload && contentHash != sha256Hex(body) {
+		return nil, "XAmzContentSHA256Mismatch", "payload hash mismatch"
+	}
+
+	var headers strings.Builder
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		if name == "content-length" {
+			value = strconv.FormatInt(r.ContentLength, 10)
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	var query []string
+	for k, vs := range r.URL.Query() {
+		for _, v := range vs {
+			query = append(query, encode(k)+"="+encode(v))
+		}
+	}
+	sort.Strings(query)
+	segments := strings.Split(r.URL.Path, "/")
+	for i, seg := range segments {
+		segments[i] = encode(seg)
+	}
+	canonical := strings.Join([]string{
+		r.Method,
+		strings.Join(segments, "/"),
+		strings.Join(query, "&"),
+		headers.String(),
+		fields["SignedHeaders"],
+		contentHash,
+	}, "\n")
+	date := r.Header.Get("X-Amz-Date")
+	scope := strings.Join(cred[1:], "/")
+	toSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := []byte("AWS4" + SecretKey)
+	for _, part := range cred[1:] {
+		key = mac(key, part)
+	}
+	signature := hex.EncodeToString(mac(key, toSign))
+	if signature != fields["Signature"] {
+		return nil, "SignatureDoesNotMatch", "signature mismatch"
+	}
+	if contentHash != streamingPayload {
+		return body, "", ""
+	}
+
+	// Each chunk is "<hex size>;chunk-signature=<sig>\r\n<data>\r\n", signed
+	// over the previous signature, ending with an empty chunk
+	var payload []byte
+	previous := signature
+	for {
+		line, rest, ok := strings.Cut(string(body), "\r\n")
+		sizeHex, chunkSig, _ := strings.Cut(line, ";chunk-signature=")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if !ok || err != nil || int64(len(rest)) < size+2 {
+			return nil, "IncompleteBody", "malformed aws-chunked body"
+		}
+		chunk := rest[:size]
+		toSign := "AWS4-HMAC-SHA256-PAYLOAD\n" + date + "\n" + scope + "\n" + previous + "\n" + sha256Hex(nil) + "\n" + sha256Hex([]byte(chunk))
+		if hex.EncodeToString(mac(key, toSign)) != chunkSig {
+			return nil, "SignatureDoesNotMatch", "chunk signature mismatch"
+		}
+		if size == 0 {
+			break
+		}
+		payload = append(payload, chunk...)
+		previous = chunkSig
+		body = []byte(rest[size+2:])
+	}
+	if decoded := r.Header.Get("X-Amz-Decoded-Content-Length"); decoded != strconv.Itoa(len(payload)) {
+		return nil, "IncompleteBody", "decoded length mismatch"
+	}
+	return payload, "", ""
+}
+
+// etag is the quoted MD5 of data, as S3 reports for single-part uploads
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func mac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func encode(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,284 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTP stores objects as files below a directory of an SFTP server. It
+// keeps one SSH connection, opened on first use and again after a failure
+type SFTP struct {
+	addr   string
+	user   string
+	root   string
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+// NewSFTP returns a store for target, sftp://user@host:port/path. A path
+// starting with /~/ is relative to the login directory
+func NewSFTP(target string, cfg SFTPConfig) (*SFTP, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SFTP target %q", target)
+	}
+	user := cfg.Username
+	if user == "" && u.User != nil {
+		user = u.User.Username()
+	}
+	if user == "" {
+		return nil, errors.New("SFTP target needs a username")
+	}
+	if cfg.HostKey == "" {
+		return nil, errors.New("SFTP target needs host_key, the server's key fingerprint (ssh-keygen -lf)")
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKey != "" {
+		pem, err := os.ReadFile(cfg.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SFTP private key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SFTP private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("SFTP target needs a password or private_key")
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	root := strings.TrimSuffix(u.Path, "/")
+	if strings.HasPrefix(root, "/~") {
+		root = strings.TrimPrefix(strings.TrimPrefix(root, "/~"), "/")
+	}
+	if root == "" {
+		root = "."
+	}
+	want := cfg.HostKey
+	return &SFTP{
+		addr: addr,
+		user: user,
+		root: root,
+		config: &ssh.ClientConfig{
+			User: user,
+			Auth: auth,
+			HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+				if got := ssh.FingerprintSHA256(key); got != want {
+					return fmt.Errorf("host key %s does not match host_key %s", got, want)
+				}
+				return nil
+			},
+			Timeout: 30 * time.Second,
+		},
+	}, nil
+}
+
+// Put writes the object to a temporary file and renames it into place
+func (s *SFTP) Put(ctx context.Context, key string, data []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return s.with(ctx, func(c *sftp.Client) error {
+		if err := c.MkdirAll(path.Dir(p)); err != nil {
+			return err
+		}
+		tmp := p + ".part"
+		f, err := c.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if _, ok := c.HasExtension("posix-rename@openssh.com"); ok {
+			return c.PosixRename(tmp, p)
+		}
+		// Plain SFTP v3 rename fails when the target exists
+		if err := c.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return c.Rename(tmp, p)
+	})
+}
+
+// Get reads the object
+func (s *SFTP) Get(ctx context.Context, key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	err = s.with(ctx, func(c *sftp.Client) error {
+		f, err := c.Open(p)
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%s: %w", key, ErrNotExist)
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		data, err = io.ReadAll(f)
+		return err
+	})
+	return data, err
+}
+
+// List walks the directories below the prefix
+func (s *SFTP) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	// Start from the deepest directory the prefix names
+	start := s.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		start = path.Join(s.root, prefix[:i])
+	}
+	err := s.with(ctx, func(c *sftp.Client) error {
+		objects = nil
+		walker := c.Walk(start)
+		for walker.Step() {
+			if err := walker.Err(); err != nil {
+				if walker.Path() == start && errors.Is(err, os.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			key := s.key(walker.Path())
+			switch {
+			case walker.Stat().IsDir():
+				if walker.Path() != start && !strings.HasPrefix(key+"/", prefix) && !strings.HasPrefix(prefix, key+"/") {
+					walker.SkipDir()
+				}
+			case strings.HasPrefix(key, prefix) && !strings.HasSuffix(key, ".part"):
+				objects = append(objects, Object{Key: key, Size: walker.Stat().Size(), ModTime: walker.Stat().ModTime()})
+			}
+		}
+		return nil
+	})
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, err
+}
+
+// Delete removes the object and the directories it leaves empty
+func (s *SFTP) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return s.with(ctx, func(c *sftp.Client) error {
+		if err := c.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		for dir := path.Dir(p); dir != s.root && strings.HasPrefix(dir, s.root); dir = path.Dir(dir) {
+			if c.RemoveDirectory(dir) != nil {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// String returns the target URL without credentials
+func (s *SFTP) String() string {
+	root := s.root
+	if !strings.HasPrefix(root, "/") {
+		root = "/~/" + strings.TrimPrefix(root, ".")
+	}
+	return "sftp://" + s.user + "@" + s.addr + root
+}
+
+// path maps a key below the root, refusing keys that escape it
+func (s *SFTP) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || strings.HasSuffix(key, "/") || clean == "/" {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return path.Join(s.root, clean), nil
+}
+
+// key maps a path below the root back to its key
+func (s *SFTP) key(p string) string {
+	if s.root == "." {
+		return p
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(p, s.root), "/")
+}
+
+// with runs fn on the connection, connecting first if needed. A failed
+// connection is dropped so the next call reconnects; errors the server
+// reports leave it open
+func (s *SFTP) with(ctx context.Context, fn func(*sftp.Client) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		conn, err := ssh.Dial("tcp", s.addr, s.config)
+		if err != nil {
+			return fmt.Errorf("SFTP %s: %w", s.addr, err)
+		}
+		client, err := sftp.NewClient(conn)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("SFTP %s: %w", s.addr, err)
+		}
+		s.conn, s.client = conn, client
+	}
+	conn := s.conn
+	// Abort a call stuck on a dead connection when ctx ends
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	err := fn(s.client)
+	var status *sftp.StatusError
+	if err != nil && !errors.As(err, &status) && !errors.Is(err, os.ErrNotExist) &&
+		!errors.Is(err, os.ErrPermission) && !errors.Is(err, ErrNotExist) {
+		s.close()
+		return fmt.Errorf("SFTP %s: %w", s.addr, err)
+	}
+	return err
+}
+
+// Close closes the connection
+func (s *SFTP) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.close()
+	return nil
+}
+
+func (s *SFTP) close() {
+	if s.client != nil {
+		s.client.Close()
+		s.conn.Close()
+		s.client, s.conn = nil, nil
+	}
+}
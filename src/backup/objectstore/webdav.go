@@ -0,0 +1,166 @@
+package objectstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/studio-b12/gowebdav"
+)
+
+// WebDAV stores objects as files below a collection of a WebDAV server
+// (Nextcloud, ownCloud, Apache mod_dav, nginx dav_ext, ...)
+type WebDAV struct {
+	base *url.URL
+	// Shared by the per-call clients so a negotiated Basic or Digest
+	// authenticator is reused
+	auth gowebdav.Authorizer
+}
+
+// NewWebDAV returns a store for target, http(s)://host/path
+func NewWebDAV(target string, cfg WebDAVConfig) (*WebDAV, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid WebDAV target %q", target)
+	}
+	username, password := cfg.Username, cfg.Password
+	if u.User != nil {
+		if username == "" {
+			username = u.User.Username()
+		}
+		if p, ok := u.User.Password(); ok && password == "" {
+			password = p
+		}
+		u.User = nil
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/"
+	u.RawPath = ""
+	u.RawQuery = ""
+	return &WebDAV{base: u, auth: gowebdav.NewAutoAuth(username, password)}, nil
+}
+
+// Put uploads the object, creating the collections above it
+func (w *WebDAV) Put(ctx context.Context, key string, data []byte) error {
+	if err := w.checkKey(key); err != nil {
+		return err
+	}
+	err := w.client(ctx, w.base.Path).Write(key, data, 0o644)
+	if gowebdav.IsErrNotFound(err) || gowebdav.IsErrCode(err, http.StatusConflict) {
+		// gowebdav only creates the parents below the target collection,
+		// which may not exist yet itself
+		dir := path.Join(w.base.Path, path.Dir(key))
+		if err := w.client(ctx, "/").MkdirAll(dir, 0o755); err != nil {
+			return w.error(key, err)
+		}
+		err = w.client(ctx, w.base.Path).Write(key, data, 0o644)
+	}
+	return w.error(key, err)
+}
+
+// Get downloads the object
+func (w *WebDAV) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := w.checkKey(key); err != nil {
+		return nil, err
+	}
+	data, err := w.client(ctx, w.base.Path).Read(key)
+	if err != nil {
+		return nil, w.error(key, err)
+	}
+	return data, nil
+}
+
+// List walks the collections below the prefix with PROPFIND Depth: 1, as
+// many servers refuse Depth: infinity
+func (w *WebDAV) List(ctx context.Context, prefix string) ([]Object, error) {
+	client := w.client(ctx, w.base.Path)
+	var objects []Object
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := client.ReadDir(dir)
+		if gowebdav.IsErrNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return w.error(dir, err)
+		}
+		for _, e := range entries {
+			key := path.Join(dir, e.Name())
+			switch {
+			case e.IsDir():
+				if strings.HasPrefix(key+"/", prefix) || strings.HasPrefix(prefix, key+"/") {
+					if err := walk(key); err != nil {
+						return err
+					}
+				}
+			case strings.HasPrefix(key, prefix):
+				objects = append(objects, Object{Key: key, Size: e.Size(), ModTime: e.ModTime()})
+			}
+		}
+		return nil
+	}
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i]
+	}
+	if err := walk(dir); err != nil {
+		return nil, err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Delete removes the object
+func (w *WebDAV) Delete(ctx context.Context, key string) error {
+	if err := w.checkKey(key); err != nil {
+		return err
+	}
+	return w.error(key, w.client(ctx, w.base.Path).Remove(key))
+}
+
+// String returns the collection URL without credentials
+func (w *WebDAV) String() string {
+	return w.base.String()
+}
+
+// checkKey refuses keys that would leave the collection
+func (w *WebDAV) checkKey(key string) error {
+	if key == "" || strings.HasSuffix(key, "/") || path.Clean("/"+key) != "/"+key {
+		return fmt.Errorf("invalid object key %q", key)
+	}
+	return nil
+}
+
+// client returns a client rooted at the URL path root whose requests end
+// with ctx; gowebdav itself takes no context
+func (w *WebDAV) client(ctx context.Context, root string) *gowebdav.Client {
+	client := gowebdav.NewAuthClient(w.base.Scheme+"://"+w.base.Host+root, w.auth)
+	client.SetTimeout(5 * time.Minute)
+	client.SetInterceptor(func(_ string, req *http.Request) {
+		*req = *req.WithContext(ctx)
+	})
+	return client
+}
+
+// error adds the target to err. A 404 is ErrNotExist
+func (w *WebDAV) error(key string, err error) error {
+	var pathErr *os.PathError
+	var statusErr gowebdav.StatusError
+	switch {
+	case err == nil:
+		return nil
+	case gowebdav.IsErrNotFound(err):
+		return fmt.Errorf("%s: %w", key, ErrNotExist)
+	case errors.As(err, &statusErr):
+		return fmt.Errorf("WebDAV %s: %d %s", key, statusErr.Status, http.StatusText(statusErr.Status))
+	case errors.As(err, &pathErr):
+		return fmt.Errorf("WebDAV %s %s: %w", pathErr.Op, key, pathErr.Err)
+	}
+	return fmt.Errorf("WebDAV %s: %w", key, err)
+}
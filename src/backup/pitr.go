@@ -0,0 +1,240 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/backup/objectstore"
+)
+
+// Generation is one replicated snapshot with the WAL segments after it
+type Generation struct {
+	ID    string    `json:"id"`
+	Start time.Time `json:"start"`
+	// Time of the last shipped segment; restores can reach any time from
+	// Start to End
+	End      time.Time `json:"end"`
+	Segments int       `json:"segments"`
+	Size     int64     `json:"size"`
+
+	snapshot       string
+	snapshotOffset int64
+	segments       []walSegment
+	keys           []string
+}
+
+// walSegment is one shipped range of a WAL
+type walSegment struct {
+	key    string
+	index  int64
+	offset int64
+	at     time.Time
+}
+
+// ListGenerations returns the generations of database name, oldest first.
+// Generations whose snapshot upload did not finish are left out
+func ListGenerations(ctx context.Context, store objectstore.Store, name string) ([]Generation, error) {
+	prefix := name + "/generations/"
+	objects, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*Generation)
+	var ids []string
+	for _, obj := range objects {
+		id, rest, ok := strings.Cut(strings.TrimPrefix(obj.Key, prefix), "/")
+		if !ok {
+			continue
+		}
+		gen := byID[id]
+		if gen == nil {
+			nanos, err := strconv.ParseInt(id, 16, 64)
+			if err != nil {
+				continue
+			}
+			gen = &Generation{ID: id, Start: time.Unix(0, nanos).UTC()}
+			gen.End = gen.Start
+			byID[id] = gen
+			ids = append(ids, id)
+		}
+		gen.keys = append(gen.keys, obj.Key)
+		gen.Size += obj.Size
+
+		switch {
+		case strings.HasPrefix(rest, snapshotPrefix) && strings.HasSuffix(rest, snapshotSuffix):
+			offset, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(rest, snapshotPrefix), snapshotSuffix), 16, 64)
+			if err == nil {
+				gen.snapshot = obj.Key
+				gen.snapshotOffset = offset
+			}
+		case strings.HasPrefix(rest, "wal/") && strings.HasSuffix(rest, walSegmentSuffix):
+			parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(rest, "wal/"), walSegmentSuffix), "-")
+			if len(parts) != 3 {
+				continue
+			}
+			index, err1 := strconv.ParseInt(parts[0], 16, 64)
+			offset, err2 := strconv.ParseInt(parts[1], 16, 64)
+			nanos, err3 := strconv.ParseInt(parts[2], 16, 64)
+			if err1 != nil || err2 != nil || err3 != nil {
+				continue
+			}
+			seg := walSegment{key: obj.Key, index: index, offset: offset, at: time.Unix(0, nanos).UTC()}
+			gen.segments = append(gen.segments, seg)
+			if seg.at.After(gen.End) {
+				gen.End = seg.at
+			}
+		}
+	}
+
+	sort.Strings(ids)
+	generations := make([]Generation, 0, len(ids))
+	for _, id := range ids {
+		gen := byID[id]
+		if gen.snapshot == "" {
+			continue
+		}
+		sort.Slice(gen.segments, func(i, j int) bool {
+			a, b := gen.segments[i], gen.segments[j]
+			if a.index != b.index {
+				return a.index < b.index
+			}
+			return a.offset < b.offset
+		})
+		gen.Segments = len(gen.segments)
+		generations = append(generations, *gen)
+	}
+	return generations, nil
+}
+
+// RestoreResult describes a point-in-time restore
+type RestoreResult struct {
+	Generation string    `json:"generation"`
+	SnapshotAt time.Time `json:"snapshot_at"`
+	// Everything committed before this time is in the restored database
+	RestoredTo time.Time `json:"restored_to"`
+	Segments   int       `json:"segments"`
+}
+
+// RestoreToTime rebuilds database name as it was at time at (the latest
+// replicated state when at is zero) into outPath, which must not exist. The
+// result is precise to the sync interval of the replicator
+func RestoreToTime(ctx context.Context, store objectstore.Store, name string, at time.Time, outPath string) (*RestoreResult, error) {
+	if _, err := os.Stat(outPath); err == nil {
+		return nil, fmt.Errorf("%s already exists", outPath)
+	}
+	generations, err := ListGenerations(ctx, store, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generations: %w", err)
+	}
+	if len(generations) == 0 {
+		return nil, fmt.Errorf("no replicated generations of the %s database in %s", name, store)
+	}
+	var gen *Generation
+	for i := range generations {
+		if at.IsZero() || !generations[i].Start.After(at) {
+			gen = &generations[i]
+		}
+	}
+	if gen == nil {
+		return nil, fmt.Errorf("%s is before the earliest restore point %s", at.Format(time.RFC3339), generations[0].Start.Format(time.RFC3339))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return nil, err
+	}
+	tmpPath := outPath + ".restoring"
+	defer os.Remove(tmpPath)
+	result, err := restoreGeneration(ctx, store, gen, at, tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkIntegrity(tmpPath); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, outPath); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// restoreGeneration writes the snapshot of gen to path and applies its WAL
+// segments up to at, checking that none is missing
+func restoreGeneration(ctx context.Context, store objectstore.Store, gen *Generation, at time.Time, path string) (*RestoreResult, error) {
+	data, err := store.Get(ctx, gen.snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download snapshot: %w", err)
+	}
+	if data, err = gunzipBytes(data); err != nil {
+		return nil, fmt.Errorf("failed to decompress snapshot: %w", err)
+	}
+	db, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	if _, err := db.Write(data); err != nil {
+		return nil, err
+	}
+	pageSize, err := databasePageSize(db)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RestoreResult{Generation: gen.ID, SnapshotAt: gen.Start, RestoredTo: gen.Start}
+	index, offset := int64(0), gen.snapshotOffset
+	for _, seg := range gen.segments {
+		if !at.IsZero() && seg.at.After(at) {
+			break
+		}
+		switch {
+		case seg.index == index && seg.offset == offset:
+		case seg.index == index+1 && seg.offset == walHeaderSize:
+			index, offset = seg.index, walHeaderSize
+		default:
+			return nil, fmt.Errorf("generation %s is missing WAL data before %s", gen.ID, seg.key)
+		}
+		data, err := store.Get(ctx, seg.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download WAL segment: %w", err)
+		}
+		frames, err := gunzipBytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", seg.key, err)
+		}
+		if err := applyFrames(db, pageSize, frames); err != nil {
+			return nil, fmt.Errorf("failed to apply %s: %w", seg.key, err)
+		}
+		offset += int64(len(frames))
+		result.RestoredTo = seg.at
+		result.Segments++
+	}
+	if err := db.Sync(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkIntegrity runs SQLite's integrity check on a restored database
+func checkIntegrity(path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("restored database failed the integrity check: %w", err)
+	}
+	if result != "ok" {
+		return errors.New("restored database failed the integrity check: " + result)
+	}
+	return nil
+}
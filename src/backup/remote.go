@@ -0,0 +1,356 @@
+// Package backup - chunked, resumable upload of backup archives to remote targets
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/backup/objectstore"
+)
+
+// Remote layout: backups/<filename>/chunk-<index>-<sha256 prefix> holds the
+// archive in pieces and backups/<filename>/manifest.json, written last,
+// marks the upload complete. A failed upload is resumed by skipping the
+// chunks already stored
+const (
+	remotePrefix     = "backups/"
+	remoteManifest   = "manifest.json"
+	DefaultChunkSize = 8 << 20
+	// Incomplete uploads older than this are removed by PruneRemote
+	staleUploadAge = 24 * time.Hour
+)
+
+// Attempts per chunk and the pause before the first retry, doubled after
+// each failure; overridable in tests
+var (
+	chunkAttempts   = 3
+	chunkRetryDelay = 2 * time.Second
+)
+
+// RemoteChunk is one piece of an uploaded archive
+type RemoteChunk struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// RemoteBackup is the manifest of a completely uploaded archive
+type RemoteBackup struct {
+	Filename  string        `json:"filename"`
+	Size      int64         `json:"size"`
+	SHA256    string        `json:"sha256"`
+	CreatedAt time.Time     `json:"created_at"`
+	ChunkSize int64         `json:"chunk_size"`
+	Chunks    []RemoteChunk `json:"chunks"`
+}
+
+// UploadBackup uploads the archive at localPath in chunks of chunkSize
+// bytes. Chunks a previous attempt stored are not sent again
+func UploadBackup(ctx context.Context, store objectstore.Store, localPath string, chunkSize int) (*RemoteBackup, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(localPath)
+	prefix := remotePrefix + name + "/"
+	existing, err := store.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", store, err)
+	}
+	stored := make(map[string]int64, len(existing))
+	for _, o := range existing {
+		stored[strings.TrimPrefix(o.Key, prefix)] = o.Size
+	}
+
+	created, ok := BackupTime(name)
+	if !ok {
+		created = info.ModTime()
+	}
+	manifest := RemoteBackup{Filename: name, Size: info.Size(), CreatedAt: created, ChunkSize: int64(chunkSize)}
+	whole := sha256.New()
+	buf := make([]byte, chunkSize)
+	for index := 1; ; index++ {
+		n, err := io.ReadFull(f, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		data := buf[:n]
+		whole.Write(data)
+		sum := sha256.Sum256(data)
+		chunk := RemoteChunk{
+			Name:   fmt.Sprintf("chunk-%06d-%s", index, hex.EncodeToString(sum[:8])),
+			Size:   int64(n),
+			SHA256: hex.EncodeToString(sum[:]),
+		}
+		manifest.Chunks = append(manifest.Chunks, chunk)
+		if size, ok := stored[chunk.Name]; ok && size == chunk.Size {
+			continue
+		}
+		if err := putWithRetry(ctx, store, prefix+chunk.Name, data); err != nil {
+			return nil, fmt.Errorf("failed to upload %s to %s: %w", chunk.Name, store, err)
+		}
+	}
+	manifest.SHA256 = hex.EncodeToString(whole.Sum(nil))
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := putWithRetry(ctx, store, prefix+remoteManifest, data); err != nil {
+		return nil, fmt.Errorf("failed to upload manifest to %s: %w", store, err)
+	}
+	return &manifest, nil
+}
+
+func putWithRetry(ctx context.Context, store objectstore.Store, key string, data []byte) error {
+	delay := chunkRetryDelay
+	var err error
+	for attempt := 1; attempt <= chunkAttempts; attempt++ {
+		if err = store.Put(ctx, key, data); err == nil {
+			return nil
+		}
+		if attempt == chunkAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// ListRemoteBackups returns the completely uploaded backups, oldest first
+func ListRemoteBackups(ctx context.Context, store objectstore.Store) ([]RemoteBackup, error) {
+	objects, err := store.List(ctx, remotePrefix)
+	if err != nil {
+		return nil, err
+	}
+	var backups []RemoteBackup
+	for _, o := range objects {
+		if path.Base(o.Key) != remoteManifest {
+			continue
+		}
+		data, err := store.Get(ctx, o.Key)
+		if err != nil {
+			return nil, err
+		}
+		var b RemoteBackup
+		if err := json.Unmarshal(data, &b); err != nil {
+			return nil, fmt.Errorf("invalid manifest %s: %w", o.Key, err)
+		}
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.Before(backups[j].CreatedAt) })
+	return backups, nil
+}
+
+// DownloadBackup reassembles an uploaded archive at destPath, checking
+// every chunk and the whole file against the manifest
+func DownloadBackup(ctx context.Context, store objectstore.Store, b RemoteBackup, destPath string) error {
+	tmp := destPath + ".download"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	whole := sha256.New()
+	for _, chunk := range b.Chunks {
+		data, err := store.Get(ctx, remotePrefix+b.Filename+"/"+chunk.Name)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("failed to download %s: %w", chunk.Name, err)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != chunk.SHA256 {
+			f.Close()
+			return fmt.Errorf("chunk %s of %s is corrupt", chunk.Name, b.Filename)
+		}
+		whole.Write(data)
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if hex.EncodeToString(whole.Sum(nil)) != b.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s", b.Filename)
+	}
+	return os.Rename(tmp, destPath)
+}
+
+// SyncResult lists what SyncRemote changed on a target
+type SyncResult struct {
+	Uploaded []string
+	Pruned   []string
+}
+
+// SyncRemote uploads the backups in localDir that the policy keeps and the
+// target lacks, then prunes the target with the policy. A zero policy
+// keeps the newest 4 backups
+func SyncRemote(ctx context.Context, store objectstore.Store, localDir string, policy RetentionPolicy, chunkSize int) (*SyncResult, error) {
+	local, err := filepath.Glob(filepath.Join(localDir, backupFilePrefix+"*.tar.gz*"))
+	if err != nil {
+		return nil, err
+	}
+	remote, err := ListRemoteBackups(ctx, store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", store, err)
+	}
+	onRemote := make(map[string]bool, len(remote))
+	for _, b := range remote {
+		onRemote[b.Filename] = true
+	}
+
+	// Decide over local and remote backups together, so an old local
+	// backup is not uploaded only to be pruned
+	type candidate struct {
+		name  string
+		local string
+		at    time.Time
+	}
+	var all []candidate
+	for _, b := range remote {
+		all = append(all, candidate{name: b.Filename, at: b.CreatedAt})
+	}
+	for _, file := range local {
+		name := filepath.Base(file)
+		if onRemote[name] || strings.HasSuffix(name, ".download") {
+			continue
+		}
+		at, ok := BackupTime(name)
+		if !ok {
+			continue
+		}
+		all = append(all, candidate{name: name, local: file, at: at})
+	}
+	keep := keepSet(policy, len(all), func(i int) time.Time { return all[i].at })
+
+	result := &SyncResult{}
+	for i, c := range all {
+		if c.local == "" || !keep[i] {
+			continue
+		}
+		if _, err := UploadBackup(ctx, store, c.local, chunkSize); err != nil {
+			return result, err
+		}
+		result.Uploaded = append(result.Uploaded, c.name)
+	}
+	pruned, err := PruneRemote(ctx, store, policy)
+	result.Pruned = pruned
+	return result, err
+}
+
+// keepSet applies policy, or the default of the newest 4, to n backups
+func keepSet(policy RetentionPolicy, n int, at func(int) time.Time) []bool {
+	if policy.IsZero() {
+		order := make([]int, n)
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool { return at(order[a]).After(at(order[b])) })
+		keep := make([]bool, n)
+		for rank, i := range order {
+			keep[i] = rank < 4
+		}
+		return keep
+	}
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = at(i)
+	}
+	return policy.Keep(times)
+}
+
+// PruneRemote deletes the uploaded backups the policy does not keep and
+// incomplete uploads that were abandoned, returning the deleted file names
+func PruneRemote(ctx context.Context, store objectstore.Store, policy RetentionPolicy) ([]string, error) {
+	objects, err := store.List(ctx, remotePrefix)
+	if err != nil {
+		return nil, err
+	}
+	byBackup := make(map[string][]objectstore.Object)
+	for _, o := range objects {
+		name, _, ok := strings.Cut(strings.TrimPrefix(o.Key, remotePrefix), "/")
+		if ok {
+			byBackup[name] = append(byBackup[name], o)
+		}
+	}
+	complete, err := ListRemoteBackups(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+
+	var doomed []string
+	isComplete := make(map[string]bool, len(complete))
+	for i, keep := range keepSet(policy, len(complete), func(i int) time.Time { return complete[i].CreatedAt }) {
+		isComplete[complete[i].Filename] = true
+		if !keep {
+			doomed = append(doomed, complete[i].Filename)
+		}
+	}
+	for name, objs := range byBackup {
+		if isComplete[name] {
+			continue
+		}
+		newest := time.Time{}
+		for _, o := range objs {
+			if o.ModTime.After(newest) {
+				newest = o.ModTime
+			}
+		}
+		if time.Since(newest) > staleUploadAge {
+			doomed = append(doomed, name)
+		}
+	}
+	sort.Strings(doomed)
+
+	var errs []error
+	var deleted []string
+	for _, name := range doomed {
+		objs := byBackup[name]
+		// The manifest goes first so a half-deleted backup counts as incomplete
+		sort.SliceStable(objs, func(i, j int) bool {
+			return path.Base(objs[i].Key) == remoteManifest && path.Base(objs[j].Key) != remoteManifest
+		})
+		var failed bool
+		for _, o := range objs {
+			if err := store.Delete(ctx, o.Key); err != nil {
+				errs = append(errs, err)
+				failed = true
+				break
+			}
+		}
+		if !failed {
+			deleted = append(deleted, name)
+		}
+	}
+	return deleted, errors.Join(errs...)
+}
@@ -0,0 +1,217 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/apimgr/weather/src/backup/objectstore"
+	"github.com/apimgr/weather/src/backup/objectstore/s3test"
+)
+
+// flakyStore fails every Put after the first failAfter while failing is set
+type flakyStore struct {
+	objectstore.Store
+	mu        sync.Mutex
+	failAfter int
+	failing   bool
+	puts      []string
+}
+
+func (f *flakyStore) Put(ctx context.Context, key string, data []byte) error {
+	f.mu.Lock()
+	if f.failing && len(f.puts) >= f.failAfter {
+		f.mu.Unlock()
+		return errors.New("connection reset")
+	}
+	f.puts = append(f.puts, key)
+	f.mu.Unlock()
+	return f.Store.Put(ctx, key, data)
+}
+
+func noRetryDelay(t *testing.T) {
+	attempts, delay := chunkAttempts, chunkRetryDelay
+	chunkAttempts, chunkRetryDelay = 2, 0
+	t.Cleanup(func() { chunkAttempts, chunkRetryDelay = attempts, delay })
+}
+
+func writeBackupFile(t *testing.T, dir, name string, size int) string {
+	t.Helper()
+	data := make([]byte, size)
+	rand.Read(data)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUploadBackupResume(t *testing.T) {
+	noRetryDelay(t)
+	ctx := context.Background()
+	file, err := objectstore.NewFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &flakyStore{Store: file, failAfter: 4, failing: true}
+	local := writeBackupFile(t, t.TempDir(), "weather_backup_2026-03-01_020000.tar.gz", 10*1024+17)
+
+	if _, err := UploadBackup(ctx, store, local, 1024); err == nil {
+		t.Fatal("upload through a failing store succeeded")
+	}
+	if backups, _ := ListRemoteBackups(ctx, store); len(backups) != 0 {
+		t.Fatalf("incomplete upload listed: %+v", backups)
+	}
+
+	store.failing = false
+	store.puts = nil
+	b, err := UploadBackup(ctx, store, local, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 11 chunks, 4 stored by the first attempt, plus the manifest
+	if len(b.Chunks) != 11 || len(store.puts) != 11-4+1 {
+		t.Errorf("chunks = %d, puts on resume = %d", len(b.Chunks), len(store.puts))
+	}
+
+	backups, err := ListRemoteBackups(ctx, store)
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("ListRemoteBackups = %+v, %v", backups, err)
+	}
+	out := filepath.Join(t.TempDir(), backups[0].Filename)
+	if err := DownloadBackup(ctx, store, backups[0], out); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := os.ReadFile(local)
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, want) {
+		t.Error("downloaded backup differs from the original")
+	}
+
+	// A corrupted chunk is detected
+	if err := file.Put(ctx, remotePrefix+b.Filename+"/"+b.Chunks[3].Name, []byte("garbage")); err != nil {
+		t.Fatal(err)
+	}
+	if err := DownloadBackup(ctx, store, backups[0], out+".2"); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("download of a corrupted backup = %v", err)
+	}
+}
+
+func TestSyncRemote(t *testing.T) {
+	noRetryDelay(t)
+	ctx := context.Background()
+	server := s3test.NewServer("backups")
+	defer server.Close()
+	store, err := objectstore.NewS3("backups", "weather", objectstore.S3Config{
+		Endpoint: server.URL, AccessKey: s3test.AccessKey, SecretKey: s3test.SecretKey, PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{
+		"weather_backup_2026-03-01_020000.tar.gz",
+		"weather_backup_2026-03-02_020000.tar.gz",
+		"weather_backup_2026-03-03_020000.tar.gz",
+	} {
+		writeBackupFile(t, dir, name, 3000)
+	}
+	policy := RetentionPolicy{Daily: 2}
+
+	// The target is down for the first run
+	server.SetDown(true)
+	if _, err := SyncRemote(ctx, store, dir, policy, 1024); err == nil {
+		t.Fatal("sync to an unreachable target succeeded")
+	}
+	server.SetDown(false)
+
+	result, err := SyncRemote(ctx, store, dir, policy, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The oldest backup falls outside the policy and is not uploaded
+	if len(result.Uploaded) != 2 || len(result.Pruned) != 0 {
+		t.Errorf("first sync = %+v", result)
+	}
+
+	writeBackupFile(t, dir, "weather_backup_2026-03-04_020000.tar.gz", 3000)
+	result, err = SyncRemote(ctx, store, dir, policy, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Uploaded) != 1 || len(result.Pruned) != 1 || result.Pruned[0] != "weather_backup_2026-03-02_020000.tar.gz" {
+		t.Errorf("second sync = %+v", result)
+	}
+	backups, _ := ListRemoteBackups(ctx, store)
+	if len(backups) != 2 || backups[1].Filename != "weather_backup_2026-03-04_020000.tar.gz" {
+		t.Errorf("remote backups = %+v", backups)
+	}
+	for _, key := range server.Keys("backups") {
+		if strings.Contains(key, "2026-03-02") {
+			t.Errorf("pruned backup left %s", key)
+		}
+	}
+}
+
+// newDrillBackup creates a backup of a data directory holding server.db
+func newDrillBackup(t *testing.T, dbContent func(path string)) *BackupService {
+	t.Helper()
+	configDir, dataDir := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(configDir, "server.yml"), []byte("server:\n  port: 80\n"), 0600)
+	os.MkdirAll(filepath.Join(dataDir, "db"), 0700)
+	dbContent(filepath.Join(dataDir, "db", "server.db"))
+	svc := New(configDir, dataDir)
+	if _, err := svc.Create(BackupOptions{CreatedBy: "test", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestDrill(t *testing.T) {
+	ctx := context.Background()
+	svc := newDrillBackup(t, func(path string) {
+		db, err := sql.Open("sqlite", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if _, err := db.Exec("CREATE TABLE settings (key TEXT PRIMARY KEY, value TEXT); INSERT INTO settings VALUES ('a', 'b')"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	result, err := svc.Drill(ctx, DrillOptions{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Databases) != 1 || result.Databases[0] != "db/server.db" {
+		t.Errorf("local drill = %+v", result)
+	}
+
+	store, _ := objectstore.NewFile(t.TempDir())
+	if _, err := SyncRemote(ctx, store, filepath.Join(svc.dataDir, "backup"), RetentionPolicy{}, 4096); err != nil {
+		t.Fatal(err)
+	}
+	result, err = svc.Drill(ctx, DrillOptions{Store: store, Password: "secret"})
+	if err != nil || len(result.Databases) != 1 || result.Source != store.String() {
+		t.Errorf("remote drill = %+v, %v", result, err)
+	}
+	if _, err := svc.Drill(ctx, DrillOptions{Store: store, Password: "wrong"}); err == nil {
+		t.Error("drill with the wrong password succeeded")
+	}
+
+	// A backup holding a damaged database fails the drill
+	broken := newDrillBackup(t, func(path string) {
+		os.WriteFile(path, bytes.Repeat([]byte("not a database "), 1000), 0600)
+	})
+	if _, err := broken.Drill(ctx, DrillOptions{Password: "secret"}); err == nil || !strings.Contains(err.Error(), "db/server.db") {
+		t.Errorf("drill of a damaged database = %v", err)
+	}
+}
@@ -0,0 +1,627 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/apimgr/weather/src/backup/objectstore"
+
+	_ "modernc.org/sqlite"
+)
+
+// Continuous replication of a SQLite database (in WAL mode) to an object
+// store, so it can be restored to any point in time within retention.
+//
+// A generation starts with a snapshot of the database, followed by the WAL
+// frames of every committed transaction, shipped as gzip segments:
+//
+//	<name>/generations/<gen>/snapshot-<offset>.db.gz
+//	<name>/generations/<gen>/wal/<index>-<offset>-<time>.wal.gz
+//
+// gen and time are unix nanoseconds, index counts WAL restarts within the
+// generation and offset is the position of the segment in that WAL, all in
+// fixed-width hex so keys sort in order. The replicator keeps a read
+// transaction open so SQLite cannot restart the WAL behind its back, and
+// checkpoints the WAL itself once everything in it is shipped. If the WAL
+// still restarts unseen, frames may be missing and it starts a new
+// generation instead
+
+const (
+	replicationSeqTable = "_replication_seq"
+	walSegmentSuffix    = ".wal.gz"
+	snapshotPrefix      = "snapshot-"
+	snapshotSuffix      = ".db.gz"
+)
+
+// ReplicationOptions configures a Replicator
+type ReplicationOptions struct {
+	Store objectstore.Store
+	// Prefix of the database's objects in the store (server, users)
+	Name string
+	// Database file
+	Path string
+	// How often committed transactions are shipped (default 1s)
+	SyncInterval time.Duration
+	// How often a new generation starts from a fresh snapshot (default 24h)
+	SnapshotInterval time.Duration
+	// How far back restores can go (default 72h)
+	Retention time.Duration
+	// WAL size at which the replicator checkpoints (default 4 MB)
+	CheckpointBytes int64
+}
+
+// ReplicationStatus is the state of one replicated database
+type ReplicationStatus struct {
+	Database        string     `json:"database"`
+	Target          string     `json:"target"`
+	Generation      string     `json:"generation"`
+	GenerationStart *time.Time `json:"generation_start,omitempty"`
+	// Everything committed before this time is in the store
+	ReplicatedAt *time.Time `json:"replicated_at,omitempty"`
+	LagSeconds   float64    `json:"lag_seconds"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Replicator ships the WAL of one SQLite database to an object store
+type Replicator struct {
+	opts ReplicationOptions
+	db   *sql.DB
+	// Holds the read transaction that pins the WAL, or the write lock while
+	// snapshotting and checkpointing
+	conn *sql.Conn
+	inTx bool
+
+	// Serializes Sync
+	mu             sync.Mutex
+	generation     string
+	genStart       time.Time
+	index          int
+	pos            walPosition
+	lastCheckpoint time.Time
+
+	// Copied from the above after each sync, so Status never waits for one
+	statusMu     sync.Mutex
+	shownGen     string
+	shownStart   time.Time
+	startedAt    time.Time
+	replicatedAt time.Time
+	lastError    string
+	lastErrorAt  time.Time
+
+	started   bool
+	stopChan  chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewReplicator opens its own connection to the database. Call Start to
+// begin replicating
+func NewReplicator(opts ReplicationOptions) (*Replicator, error) {
+	if opts.Store == nil || opts.Name == "" || opts.Path == "" {
+		return nil, errors.New("replication needs a store, name and database path")
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+	if opts.SnapshotInterval <= 0 {
+		opts.SnapshotInterval = 24 * time.Hour
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = 72 * time.Hour
+	}
+	if opts.CheckpointBytes <= 0 {
+		opts.CheckpointBytes = 4 << 20
+	}
+
+	db, err := sql.Open("sqlite", opts.Path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", opts.Name, err)
+	}
+	// One connection pins the WAL, the other checkpoints
+	db.SetMaxOpenConns(2)
+	ctx := context.Background()
+	var mode string
+	if err := db.QueryRowContext(ctx, "PRAGMA journal_mode = WAL").Scan(&mode); err != nil || mode != "wal" {
+		db.Close()
+		return nil, fmt.Errorf("%s database is not in WAL mode (%s): %v", opts.Name, mode, err)
+	}
+	// Every pinning read must see a frame of ours in the WAL, see pin. The
+	// migrations create the table and its row
+	var seq int64
+	if err := db.QueryRowContext(ctx, "SELECT seq FROM "+replicationSeqTable+" WHERE id = 1").Scan(&seq); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s database has no replication table: %w", opts.Name, err)
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Replicator{
+		opts:      opts,
+		db:        db,
+		conn:      conn,
+		startedAt: time.Now(),
+		stopChan:  make(chan struct{}),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Start replicates in the background until Close. Each start begins a new
+// generation
+func (r *Replicator) Start() {
+	r.started = true
+	go r.run()
+}
+
+func (r *Replicator) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.opts.SyncInterval)
+	defer ticker.Stop()
+	lastRetention := time.Time{}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		if err := r.Sync(ctx); err != nil {
+			log.Printf("Replication: %s: %v", r.opts.Name, err)
+		}
+		if time.Since(lastRetention) >= time.Hour {
+			if err := r.EnforceRetention(ctx); err != nil {
+				log.Printf("Replication: %s: retention: %v", r.opts.Name, err)
+			}
+			lastRetention = time.Now()
+		}
+		cancel()
+
+		select {
+		case <-r.stopChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close ships what is left, stops replicating and closes the connection
+func (r *Replicator) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.stopChan)
+		if r.started {
+			<-r.done
+		}
+		err = r.close()
+	})
+	return err
+}
+
+func (r *Replicator) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generation != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := r.ship(ctx); err != nil {
+			log.Printf("Replication: %s: final sync: %v", r.opts.Name, err)
+		}
+		cancel()
+	}
+	r.endTx()
+	r.conn.Close()
+	return r.db.Close()
+}
+
+// Status returns the replication state and lag
+func (r *Replicator) Status() ReplicationStatus {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	status := ReplicationStatus{
+		Database:   r.opts.Name,
+		Target:     r.opts.Store.String(),
+		Generation: r.shownGen,
+	}
+	if r.shownGen != "" {
+		start := r.shownStart
+		status.GenerationStart = &start
+	}
+	since := r.startedAt
+	if !r.replicatedAt.IsZero() {
+		at := r.replicatedAt
+		status.ReplicatedAt = &at
+		since = at
+	}
+	status.LagSeconds = time.Since(since).Seconds()
+	if r.lastError != "" {
+		at := r.lastErrorAt
+		status.LastError = r.lastError
+		status.LastErrorAt = &at
+	}
+	return status
+}
+
+// Sync ships the transactions committed since the last sync, starting a
+// new generation when none is running, when the snapshot is due or when the
+// WAL restarted unseen
+func (r *Replicator) Sync(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	started := time.Now()
+	err := r.sync(ctx)
+
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	r.shownGen, r.shownStart = r.generation, r.genStart
+	if err != nil {
+		r.lastError = err.Error()
+		r.lastErrorAt = time.Now()
+		return err
+	}
+	r.replicatedAt = started
+	r.lastError = ""
+	return nil
+}
+
+func (r *Replicator) sync(ctx context.Context) error {
+	if r.generation == "" || time.Since(r.genStart) >= r.opts.SnapshotInterval {
+		return r.newGeneration(ctx)
+	}
+	if err := r.ship(ctx); err != nil {
+		if errors.Is(err, errWALRestarted) {
+			log.Printf("Replication: %s: %v, starting a new generation", r.opts.Name, err)
+			return r.newGeneration(ctx)
+		}
+		return err
+	}
+	if r.pos.offset >= r.opts.CheckpointBytes && time.Since(r.lastCheckpoint) >= time.Minute {
+		return r.checkpoint(ctx)
+	}
+	return nil
+}
+
+// errWALRestarted means the WAL restarted without the replicator seeing it,
+// so frames may be missing from the generation
+var errWALRestarted = errors.New("WAL restarted unexpectedly")
+
+// walPath returns the WAL file of the database
+func (r *Replicator) walPath() string {
+	return r.opts.Path + "-wal"
+}
+
+// ship uploads the committed frames after the shipped position
+func (r *Replicator) ship(ctx context.Context) error {
+	wal, err := os.Open(r.walPath())
+	if err != nil {
+		return err
+	}
+	defer wal.Close()
+	h, ok, err := readWALHeader(wal)
+	if err != nil {
+		return err
+	}
+	if !ok || h.salt1 != r.pos.salt1 || h.salt2 != r.pos.salt2 {
+		return errWALRestarted
+	}
+	frames, next, err := readCommitted(wal, r.pos)
+	if err != nil || len(frames) == 0 {
+		return err
+	}
+	key := fmt.Sprintf("%s/%016x-%016x-%016x%s", r.walPrefix(), r.index, r.pos.offset, time.Now().UnixNano(), walSegmentSuffix)
+	if err := r.opts.Store.Put(ctx, key, gzipBytes(frames)); err != nil {
+		return fmt.Errorf("failed to upload WAL segment: %w", err)
+	}
+	r.pos = next
+	return nil
+}
+
+// generationPrefix returns the key prefix of the current generation
+func (r *Replicator) generationPrefix() string {
+	return r.opts.Name + "/generations/" + r.generation
+}
+
+func (r *Replicator) walPrefix() string {
+	return r.generationPrefix() + "/wal"
+}
+
+// newGeneration snapshots the database under the write lock and starts
+// shipping the WAL from the snapshot's position
+func (r *Replicator) newGeneration(ctx context.Context) error {
+	r.generation = ""
+	if err := r.lock(ctx); err != nil {
+		return err
+	}
+	now := time.Now()
+	snapshot, pos, err := r.snapshot()
+	if err != nil {
+		r.endTx()
+		return err
+	}
+	r.generation = fmt.Sprintf("%016x", now.UnixNano())
+	r.genStart = now
+	r.index = 0
+	r.pos = pos
+	if err := r.commitAndPin(ctx); err != nil {
+		r.generation = ""
+		return err
+	}
+	snapshotOffset := r.pos.offset
+	if r.index > 0 {
+		// The WAL restarted at our own commit: the snapshot covers the whole
+		// previous WAL
+		snapshotOffset = pos.offset
+	}
+
+	key := fmt.Sprintf("%s/%s%016x%s", r.generationPrefix(), snapshotPrefix, snapshotOffset, snapshotSuffix)
+	if err := r.opts.Store.Put(ctx, key, snapshot); err != nil {
+		r.generation = ""
+		return fmt.Errorf("failed to upload snapshot: %w", err)
+	}
+	log.Printf("Replication: %s: generation %s started (%d byte snapshot)", r.opts.Name, r.generation, len(snapshot))
+	return r.ship(ctx)
+}
+
+// snapshot copies the database with the committed frames of the WAL
+// applied, while the write lock keeps both files still. It returns the
+// gzipped copy and the WAL position it covers
+func (r *Replicator) snapshot() ([]byte, walPosition, error) {
+	src, err := os.Open(r.opts.Path)
+	if err != nil {
+		return nil, walPosition{}, err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(r.opts.Path), ".snapshot-*")
+	if err != nil {
+		return nil, walPosition{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, src); err != nil {
+		return nil, walPosition{}, fmt.Errorf("failed to copy database: %w", err)
+	}
+
+	var pos walPosition
+	if wal, err := os.Open(r.walPath()); err == nil {
+		defer wal.Close()
+		h, ok, err := readWALHeader(wal)
+		if err != nil {
+			return nil, walPosition{}, err
+		}
+		if ok {
+			frames, next, err := readCommitted(wal, h.start())
+			if err != nil {
+				return nil, walPosition{}, err
+			}
+			if err := applyFrames(tmp, h.pageSize, frames); err != nil {
+				return nil, walPosition{}, err
+			}
+			pos = next
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, walPosition{}, err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, walPosition{}, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.Copy(zw, tmp); err != nil {
+		return nil, walPosition{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, walPosition{}, err
+	}
+	return buf.Bytes(), pos, nil
+}
+
+// checkpoint ships the whole WAL under the write lock, then checkpoints it
+// so the next write restarts it from the beginning
+func (r *Replicator) checkpoint(ctx context.Context) error {
+	r.lastCheckpoint = time.Now()
+	if err := r.lock(ctx); err != nil {
+		return err
+	}
+	if err := r.ship(ctx); err != nil {
+		r.endTx()
+		if errors.Is(err, errWALRestarted) {
+			return r.newGeneration(ctx)
+		}
+		r.pinAfterError(ctx)
+		return err
+	}
+	var busy, logFrames, checkpointed int
+	if err := r.db.QueryRowContext(ctx, "PRAGMA wal_checkpoint(PASSIVE)").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		r.pinAfterError(ctx)
+		return fmt.Errorf("checkpoint failed: %w", err)
+	}
+	// Our write only restarts the WAL from a transaction that began after
+	// the checkpoint, so take the lock again and ship what came in between
+	r.endTx()
+	if err := r.lock(ctx); err != nil {
+		return err
+	}
+	if err := r.ship(ctx); err != nil {
+		r.endTx()
+		if errors.Is(err, errWALRestarted) {
+			return r.newGeneration(ctx)
+		}
+		r.pinAfterError(ctx)
+		return err
+	}
+	return r.commitAndPin(ctx)
+}
+
+// lock ends the pinning read and takes the write lock
+func (r *Replicator) lock(ctx context.Context) error {
+	r.endTx()
+	if _, err := r.conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return fmt.Errorf("failed to lock database: %w", err)
+	}
+	r.inTx = true
+	return nil
+}
+
+// endTx ends the transaction held on the replication connection
+func (r *Replicator) endTx() {
+	if r.inTx {
+		r.conn.ExecContext(context.Background(), "ROLLBACK")
+		r.inTx = false
+	}
+}
+
+// pinAfterError releases the write lock and pins the WAL again without
+// writing, after a failed checkpoint
+func (r *Replicator) pinAfterError(ctx context.Context) {
+	r.endTx()
+	if _, err := r.conn.ExecContext(ctx, "BEGIN"); err == nil {
+		r.inTx = true
+		var n int
+		r.conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+replicationSeqTable).Scan(&n)
+	}
+}
+
+// commitAndPin writes to the replication table, releases the write lock
+// and opens the read transaction that pins the WAL. The write guarantees
+// the WAL holds a frame past the last checkpoint, which keeps SQLite from
+// restarting the WAL while the read is open. If our own write restarted the
+// WAL, the next WAL index starts from its beginning
+func (r *Replicator) commitAndPin(ctx context.Context) error {
+	if _, err := r.conn.ExecContext(ctx, "UPDATE "+replicationSeqTable+" SET seq = seq + 1 WHERE id = 1"); err != nil {
+		r.endTx()
+		return fmt.Errorf("failed to write replication table: %w", err)
+	}
+	if _, err := r.conn.ExecContext(ctx, "COMMIT"); err != nil {
+		r.endTx()
+		return fmt.Errorf("failed to write replication table: %w", err)
+	}
+	r.inTx = false
+	if _, err := r.conn.ExecContext(ctx, "BEGIN"); err != nil {
+		return err
+	}
+	r.inTx = true
+	var root uint32
+	if err := r.conn.QueryRowContext(ctx, "SELECT rootpage FROM sqlite_master WHERE name = ?", replicationSeqTable).Scan(&root); err != nil {
+		r.endTx()
+		return err
+	}
+
+	wal, err := os.Open(r.walPath())
+	if err != nil {
+		r.endTx()
+		return err
+	}
+	defer wal.Close()
+	h, ok, err := readWALHeader(wal)
+	if err != nil || !ok {
+		r.endTx()
+		return fmt.Errorf("failed to read WAL header: %v", err)
+	}
+	switch {
+	case r.pos.offset == 0:
+		// The WAL was empty at the snapshot
+		r.pos = h.start()
+	case h.salt1 == r.pos.salt1 && h.salt2 == r.pos.salt2:
+	case h.salt1 == r.pos.salt1+1 && r.startsWithOwnWrite(wal, h, root):
+		r.index++
+		r.pos = h.start()
+	default:
+		r.endTx()
+		return errWALRestarted
+	}
+	return nil
+}
+
+// startsWithOwnWrite reports whether the first transaction in the WAL only
+// touched the replication table, i.e. the WAL restarted at our own commit
+// and nothing was written to the previous WAL after it was shipped
+func (r *Replicator) startsWithOwnWrite(wal io.ReaderAt, h walHeader, root uint32) bool {
+	frames, _, err := readCommitted(wal, h.start())
+	if err != nil || len(frames) == 0 {
+		return false
+	}
+	own := false
+	for i := int64(0); i < int64(len(frames)); i += h.frameSize() {
+		pgno := binary.BigEndian.Uint32(frames[i:])
+		if pgno != root && pgno != 1 {
+			return false
+		}
+		own = own || pgno == root
+		if binary.BigEndian.Uint32(frames[i+4:]) != 0 {
+			break
+		}
+	}
+	return own
+}
+
+// EnforceRetention deletes generations that are no longer needed to
+// restore to any time within retention: those followed by a generation
+// that started before the retention window
+func (r *Replicator) EnforceRetention(ctx context.Context) error {
+	generations, err := ListGenerations(ctx, r.opts.Store, r.opts.Name)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().Add(-r.opts.Retention)
+	for i := 0; i+1 < len(generations); i++ {
+		if generations[i+1].Start.After(cutoff) {
+			break
+		}
+		for _, key := range generations[i].keys {
+			if err := r.opts.Store.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+		log.Printf("Replication: %s: generation %s expired", r.opts.Name, generations[i].ID)
+	}
+	return nil
+}
+
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// ReplicatedDatabases are the SQLite databases in {data_dir}/db that
+// replication covers, by name
+var ReplicatedDatabases = []string{"server", "users"}
+
+// StartReplication starts a replicator for each of ReplicatedDatabases in
+// dbDir; opts supplies everything but the name and path
+func StartReplication(dbDir string, opts ReplicationOptions) ([]*Replicator, error) {
+	var replicators []*Replicator
+	for _, name := range ReplicatedDatabases {
+		dbOpts := opts
+		dbOpts.Name = name
+		dbOpts.Path = filepath.Join(dbDir, name+".db")
+		r, err := NewReplicator(dbOpts)
+		if err != nil {
+			for _, started := range replicators {
+				started.Close()
+			}
+			return nil, err
+		}
+		r.Start()
+		replicators = append(replicators, r)
+	}
+	return replicators, nil
+}
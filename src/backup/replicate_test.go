@@ -0,0 +1,281 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/backup/objectstore"
+	"github.com/apimgr/weather/src/backup/objectstore/s3test"
+	"github.com/apimgr/weather/src/database"
+)
+
+// openWALDB opens a database the way the server does
+func openWALDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS readings (id INTEGER PRIMARY KEY, batch TEXT, payload TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	// The migrations create the replication table
+	if err := database.MigrateDatabase(db, database.DialectSQLite, database.MigrationsServer, nil); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func insertBatch(t *testing.T, db *sql.DB, batch string, rows int) {
+	t.Helper()
+	for i := 0; i < rows; i++ {
+		// Large payloads spread rows over many pages
+		if _, err := db.Exec("INSERT INTO readings (batch, payload) VALUES (?, ?)", batch, strings.Repeat(batch, 500)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// batches returns the row count per batch in a restored database
+func batches(t *testing.T, path string) map[string]int {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT batch, COUNT(*) FROM readings GROUP BY batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var batch string
+		var n int
+		rows.Scan(&batch, &n)
+		counts[batch] = n
+	}
+	return counts
+}
+
+func newTestReplicator(t *testing.T, store objectstore.Store, path string) *Replicator {
+	t.Helper()
+	r, err := NewReplicator(ReplicationOptions{Store: store, Name: "server", Path: path, Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func restoreAt(t *testing.T, store objectstore.Store, at time.Time) (map[string]int, *RestoreResult) {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "restored.db")
+	result, err := RestoreToTime(context.Background(), store, "server", at, out)
+	if err != nil {
+		t.Fatalf("restore to %v: %v", at, err)
+	}
+	return batches(t, out), result
+}
+
+func TestReplicationPointInTimeRestore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.db")
+	db := openWALDB(t, path)
+	insertBatch(t, db, "a", 20)
+	store, err := objectstore.NewFile(filepath.Join(dir, "replica"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestReplicator(t, store, path)
+	if err := r.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	insertBatch(t, db, "b", 20)
+	if err := r.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	afterB := time.Now()
+	time.Sleep(5 * time.Millisecond)
+
+	// Checkpoint so the next writes go to a restarted WAL
+	r.opts.CheckpointBytes = 1
+	if err := r.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r.index != 1 {
+		t.Fatalf("WAL index after checkpoint = %d, want 1", r.index)
+	}
+	insertBatch(t, db, "c", 20)
+	if err := r.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := r.Status(); status.LastError != "" || status.ReplicatedAt == nil || status.LagSeconds > 5 {
+		t.Errorf("status = %+v", status)
+	}
+
+	got, _ := restoreAt(t, store, afterB)
+	if got["a"] != 20 || got["b"] != 20 || got["c"] != 0 {
+		t.Errorf("restore before c = %v", got)
+	}
+	got, result := restoreAt(t, store, time.Time{})
+	if got["a"] != 20 || got["b"] != 20 || got["c"] != 20 {
+		t.Errorf("restore latest = %v", got)
+	}
+	if result.Generation != r.generation || result.Segments == 0 {
+		t.Errorf("result = %+v", result)
+	}
+	if _, err := RestoreToTime(ctx, store, "server", result.SnapshotAt.Add(-time.Hour), filepath.Join(dir, "early.db")); err == nil {
+		t.Error("Expected a restore before the first snapshot to fail")
+	}
+
+	// A checkpoint the replicator did not see restarts the WAL: frames may
+	// be lost, so a new generation starts
+	r.endTx()
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		t.Fatal(err)
+	}
+	insertBatch(t, db, "d", 5)
+	first := r.generation
+	if err := r.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r.generation == first {
+		t.Fatal("No new generation after an unseen WAL restart")
+	}
+	insertBatch(t, db, "e", 5)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = restoreAt(t, store, time.Time{})
+	if got["d"] != 5 || got["e"] != 5 {
+		t.Errorf("restore after close = %v", got)
+	}
+
+	generations, err := ListGenerations(ctx, store, "server")
+	if err != nil || len(generations) != 2 {
+		t.Fatalf("generations = %+v, %v", generations, err)
+	}
+	r.opts.Retention = time.Nanosecond
+	if err := r.EnforceRetention(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if generations, _ := ListGenerations(ctx, store, "server"); len(generations) != 1 || generations[0].ID == first {
+		t.Errorf("generations after retention = %+v", generations)
+	}
+}
+
+func TestReplicationMissingSegment(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.db")
+	db := openWALDB(t, path)
+	store, _ := objectstore.NewFile(filepath.Join(dir, "replica"))
+	r := newTestReplicator(t, store, path)
+	for _, batch := range []string{"a", "b", "c"} {
+		insertBatch(t, db, batch, 3)
+		if err := r.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	objects, _ := store.List(ctx, "server/generations/"+r.generation+"/wal/")
+	if len(objects) < 3 {
+		t.Fatalf("segments = %+v", objects)
+	}
+	store.Delete(ctx, objects[1].Key)
+	_, err := RestoreToTime(ctx, store, "server", time.Time{}, filepath.Join(dir, "restored.db"))
+	if err == nil || !strings.Contains(err.Error(), "missing WAL data") {
+		t.Errorf("restore with a missing segment = %v", err)
+	}
+}
+
+func TestReplicationToS3(t *testing.T) {
+	server := s3test.NewServer("backups")
+	defer server.Close()
+	store, err := objectstore.Open(objectstore.Config{
+		Target: "s3://backups/weather",
+		S3:     objectstore.S3Config{Endpoint: server.URL, AccessKey: s3test.AccessKey, SecretKey: s3test.SecretKey, PathStyle: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "server.db")
+	db := openWALDB(t, path)
+	r := newTestReplicator(t, store, path)
+	insertBatch(t, db, "a", 10)
+	if err := r.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is lost while the target is down: segments ship once it is back
+	server.SetDown(true)
+	insertBatch(t, db, "b", 10)
+	if err := r.Sync(ctx); err == nil {
+		t.Fatal("Expected sync to fail while S3 is down")
+	}
+	if status := r.Status(); status.LastError == "" {
+		t.Errorf("status = %+v", status)
+	}
+	server.SetDown(false)
+	if err := r.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := restoreAt(t, store, time.Time{})
+	if fmt.Sprint(got) != "map[a:10 b:10]" {
+		t.Errorf("restored = %v", got)
+	}
+}
+
+func TestReplicationConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.db")
+	db := openWALDB(t, path)
+	store, _ := objectstore.NewFile(filepath.Join(dir, "replica"))
+	r := newTestReplicator(t, store, path)
+	r.opts.CheckpointBytes = 1
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 300; i++ {
+			if _, err := db.Exec("INSERT INTO readings (batch, payload) VALUES ('w', ?)", strings.Repeat("x", i*20)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		r.lastCheckpoint = time.Time{}
+		if err := r.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := restoreAt(t, store, time.Time{})
+	if got["w"] != 300 {
+		t.Errorf("restored %d of 300 rows", got["w"])
+	}
+}
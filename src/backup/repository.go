@@ -0,0 +1,656 @@
+// Package backup - deduplicating snapshot repository for incremental backups
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/backup/objectstore"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Repository layout below the prefix:
+//
+//	config.json                 chunking parameters and key check
+//	chunks/<id[:2]>/<id>        compressed (and encrypted) chunk contents
+//	snapshots/<snapshot id>     the files of a snapshot and their chunks
+//	locks/<snapshot id>         a snapshot being written, blocks Forget
+//
+// A chunk's id is the SHA-256 of its contents (HMAC-SHA256 with the
+// repository key when encrypted), so identical data is stored once
+const (
+	repoConfigKey   = "config.json"
+	repoChunks      = "chunks/"
+	repoSnapshots   = "snapshots/"
+	repoLocks       = "locks/"
+	repoKeyCheck    = "weather-backup-repository"
+	staleLockAge    = 6 * time.Hour
+	snapshotIDStamp = "20060102T150405Z"
+)
+
+// RepositoryPrefix holds the repository on a backup target, next to the
+// uploaded archives
+const RepositoryPrefix = "repository/"
+
+// LocalRepositoryDir is the repository used when no target is configured
+func LocalRepositoryDir(dataDir string) string {
+	return filepath.Join(dataDir, "backup", "repository")
+}
+
+// ErrWrongPassword is returned when opening an encrypted repository with
+// the wrong password or none
+var ErrWrongPassword = errors.New("wrong repository password")
+
+// BackupSet is a named part of the installation a snapshot can include
+type BackupSet struct {
+	Name        string
+	Description string
+	// Paths below config/ or data/, files or directories
+	Paths []string
+}
+
+// BackupSets are the selectable parts of a snapshot
+var BackupSets = []BackupSet{
+	{"config", "server.yml", []string{"config/server.yml"}},
+	{"templates", "custom email templates and themes", []string{"config/template", "config/themes"}},
+	{"ssl", "SSL certificates", []string{"config/ssl"}},
+	{"datasets", "GeoIP, airport, zipcode and city datasets and blocklists", []string{"config/databases", "config/security"}},
+	{"server-db", "server database", []string{"data/db/server.db"}},
+	{"users-db", "users database", []string{"data/db/users.db"}},
+	{"data", "data files", []string{"data/data"}},
+}
+
+// DefaultBackupSets are snapshotted when no set is selected
+var DefaultBackupSets = []string{"config", "templates", "datasets", "server-db", "users-db"}
+
+func lookupBackupSet(name string) (BackupSet, bool) {
+	for _, set := range BackupSets {
+		if set.Name == name {
+			return set, true
+		}
+	}
+	return BackupSet{}, false
+}
+
+// repoConfig is stored unencrypted; Check proves the password
+type repoConfig struct {
+	Version   int         `json:"version"`
+	CreatedAt time.Time   `json:"created_at"`
+	Chunking  chunkParams `json:"chunking"`
+	Encrypted bool        `json:"encrypted"`
+	Salt      string      `json:"salt,omitempty"`
+	Check     string      `json:"check,omitempty"`
+}
+
+// Repository stores snapshots of the installation as deduplicated chunks
+// in an object store
+type Repository struct {
+	store  objectstore.Store
+	prefix string
+	config repoConfig
+	// AES-256-GCM key and chunk id key, nil when not encrypted
+	encKey []byte
+	idKey  []byte
+}
+
+// OpenRepository opens the repository below prefix in store, creating it
+// when it does not exist. A repository created with a password is
+// encrypted and can only be opened with that password
+func OpenRepository(ctx context.Context, store objectstore.Store, prefix, password string) (*Repository, error) {
+	return openRepository(ctx, store, prefix, password, defaultChunkParams)
+}
+
+func openRepository(ctx context.Context, store objectstore.Store, prefix, password string, params chunkParams) (*Repository, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	r := &Repository{store: store, prefix: prefix}
+	data, err := store.Get(ctx, prefix+repoConfigKey)
+	switch {
+	case errors.Is(err, objectstore.ErrNotExist):
+		r.config = repoConfig{Version: 1, CreatedAt: time.Now().UTC(), Chunking: params, Encrypted: password != ""}
+		if password != "" {
+			salt := make([]byte, 32)
+			if _, err := rand.Read(salt); err != nil {
+				return nil, err
+			}
+			r.config.Salt = hex.EncodeToString(salt)
+			r.deriveKeys(password, salt)
+			r.config.Check = hex.EncodeToString(r.mac([]byte(repoKeyCheck)))
+		}
+		data, err := json.MarshalIndent(r.config, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := store.Put(ctx, prefix+repoConfigKey, data); err != nil {
+			return nil, fmt.Errorf("failed to create repository on %s: %w", store, err)
+		}
+		return r, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to open repository on %s: %w", store, err)
+	}
+
+	if err := json.Unmarshal(data, &r.config); err != nil {
+		return nil, fmt.Errorf("invalid repository config: %w", err)
+	}
+	if r.config.Chunking.Min <= 0 || r.config.Chunking.Avg <= r.config.Chunking.Min || r.config.Chunking.Max < r.config.Chunking.Avg {
+		return nil, fmt.Errorf("invalid repository chunking parameters %+v", r.config.Chunking)
+	}
+	if !r.config.Encrypted {
+		return r, nil
+	}
+	salt, err := hex.DecodeString(r.config.Salt)
+	if err != nil || password == "" {
+		return nil, ErrWrongPassword
+	}
+	r.deriveKeys(password, salt)
+	if !hmac.Equal([]byte(hex.EncodeToString(r.mac([]byte(repoKeyCheck)))), []byte(r.config.Check)) {
+		return nil, ErrWrongPassword
+	}
+	return r, nil
+}
+
+// Encrypted reports whether the repository is encrypted
+func (r *Repository) Encrypted() bool {
+	return r.config.Encrypted
+}
+
+// String describes the repository location
+func (r *Repository) String() string {
+	if r.prefix == "" {
+		return r.store.String()
+	}
+	return strings.TrimSuffix(r.store.String(), "/") + "/" + r.prefix
+}
+
+func (r *Repository) deriveKeys(password string, salt []byte) {
+	// Same Argon2id parameters as archive encryption
+	key := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 64)
+	r.encKey, r.idKey = key[:32], key[32:]
+}
+
+func (r *Repository) mac(data []byte) []byte {
+	m := hmac.New(sha256.New, r.idKey)
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// chunkID returns the content address of data
+func (r *Repository) chunkID(data []byte) string {
+	if r.idKey != nil {
+		return hex.EncodeToString(r.mac(data))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *Repository) chunkKey(id string) string {
+	return r.prefix + repoChunks + id[:2] + "/" + id
+}
+
+// Stored objects start with a format byte: raw or gzip
+const (
+	formatRaw  = 'r'
+	formatGzip = 'z'
+)
+
+// seal compresses data when that helps and encrypts it
+func (r *Repository) seal(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(formatGzip)
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	plain := buf.Bytes()
+	if len(plain) >= len(data)+1 {
+		plain = append([]byte{formatRaw}, data...)
+	}
+	if r.encKey == nil {
+		return plain, nil
+	}
+	gcm, err := r.gcm()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+// unseal reverses seal
+func (r *Repository) unseal(data []byte) ([]byte, error) {
+	if r.encKey != nil {
+		gcm, err := r.gcm()
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < gcm.NonceSize() {
+			return nil, errors.New("sealed object too short")
+		}
+		if data, err = gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil); err != nil {
+			return nil, fmt.Errorf("failed to decrypt object: %w", err)
+		}
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty object")
+	}
+	switch data[0] {
+	case formatRaw:
+		return data[1:], nil
+	case formatGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return nil, fmt.Errorf("unknown object format %q", data[0])
+}
+
+func (r *Repository) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(r.encKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Snapshot lists the files of one incremental backup
+type Snapshot struct {
+	ID         string         `json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	CreatedBy  string         `json:"created_by"`
+	AppVersion string         `json:"app_version"`
+	Sets       []string       `json:"sets"`
+	Files      []SnapshotFile `json:"files"`
+	// Total size of the files
+	Size int64 `json:"size"`
+}
+
+// SnapshotFile is a file in a snapshot; Path starts with config/ or data/
+type SnapshotFile struct {
+	Path    string      `json:"path"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mod_time"`
+	Size    int64       `json:"size"`
+	Chunks  []string    `json:"chunks"`
+}
+
+// SnapshotOptions configures CreateSnapshot
+type SnapshotOptions struct {
+	ConfigDir string
+	DataDir   string
+	// Names from BackupSets; DefaultBackupSets when empty
+	Sets       []string
+	CreatedBy  string
+	AppVersion string
+}
+
+// SnapshotResult describes a new snapshot and what it added to the
+// repository
+type SnapshotResult struct {
+	Snapshot *Snapshot
+	// Chunks uploaded and their stored (compressed) size
+	NewChunks int
+	NewBytes  int64
+	// Chunks that were already stored
+	ReusedChunks int
+	// Files taken over from the previous snapshot without reading them
+	UnchangedFiles int
+}
+
+// CreateSnapshot stores the selected backup sets. Files whose size and
+// modification time match the latest snapshot are not read again, and
+// only chunks the repository lacks are uploaded. Databases are copied
+// with VACUUM INTO, so the snapshot is consistent while the server runs
+func (r *Repository) CreateSnapshot(ctx context.Context, opts SnapshotOptions) (*SnapshotResult, error) {
+	sets := opts.Sets
+	if len(sets) == 0 {
+		sets = DefaultBackupSets
+	}
+	var roots []string
+	for _, name := range sets {
+		set, ok := lookupBackupSet(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown backup set %q", name)
+		}
+		roots = append(roots, set.Paths...)
+	}
+
+	now := time.Now().UTC()
+	snap := &Snapshot{
+		ID:         now.Format(snapshotIDStamp) + "-" + randomHex(3),
+		CreatedAt:  now,
+		CreatedBy:  opts.CreatedBy,
+		AppVersion: opts.AppVersion,
+		Sets:       sets,
+	}
+	lockKey := r.prefix + repoLocks + snap.ID
+	if err := r.store.Put(ctx, lockKey, []byte(now.Format(time.RFC3339))); err != nil {
+		return nil, fmt.Errorf("failed to lock repository: %w", err)
+	}
+	defer r.store.Delete(context.Background(), lockKey)
+
+	known, err := r.chunkSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+	previous := make(map[string]SnapshotFile)
+	if snapshots, err := r.ListSnapshots(ctx); err != nil {
+		return nil, err
+	} else if len(snapshots) > 0 {
+		for _, f := range snapshots[len(snapshots)-1].Files {
+			previous[f.Path] = f
+		}
+	}
+
+	result := &SnapshotResult{Snapshot: snap}
+	for _, root := range roots {
+		source := snapshotSource(root, opts.ConfigDir, opts.DataDir)
+		err := filepath.WalkDir(source, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(source, p)
+			if err != nil {
+				return err
+			}
+			file := SnapshotFile{
+				Path:    path.Join(root, filepath.ToSlash(rel)),
+				Mode:    info.Mode().Perm(),
+				ModTime: info.ModTime().UTC(),
+				Size:    info.Size(),
+			}
+			isDB := strings.HasPrefix(file.Path, "data/db/") && strings.HasSuffix(file.Path, ".db")
+			if prev, ok := previous[file.Path]; ok && !isDB && prev.Size == file.Size && prev.ModTime.Equal(file.ModTime) && chunksKnown(prev.Chunks, known) {
+				file.Chunks = prev.Chunks
+				result.UnchangedFiles++
+				result.ReusedChunks += len(prev.Chunks)
+			} else {
+				size, err := r.storeFile(ctx, p, isDB, &file, known, result)
+				if err != nil {
+					return fmt.Errorf("%s: %w", file.Path, err)
+				}
+				file.Size = size
+			}
+			snap.Files = append(snap.Files, file)
+			snap.Size += file.Size
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(snap.Files, func(i, j int) bool { return snap.Files[i].Path < snap.Files[j].Path })
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := r.seal(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.store.Put(ctx, r.prefix+repoSnapshots+snap.ID, sealed); err != nil {
+		return nil, fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	return result, nil
+}
+
+// snapshotSource maps a snapshot path to the file system
+func snapshotSource(p, configDir, dataDir string) string {
+	if rest, ok := strings.CutPrefix(p, "config/"); ok {
+		return filepath.Join(configDir, filepath.FromSlash(rest))
+	}
+	return filepath.Join(dataDir, filepath.FromSlash(strings.TrimPrefix(p, "data/")))
+}
+
+func chunksKnown(ids []string, known map[string]bool) bool {
+	for _, id := range ids {
+		if !known[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// storeFile chunks the file at p into the repository, recording the chunk
+// ids in file, and returns the number of bytes stored
+func (r *Repository) storeFile(ctx context.Context, p string, isDB bool, file *SnapshotFile, known map[string]bool, result *SnapshotResult) (int64, error) {
+	if isDB {
+		copyPath, err := vacuumCopy(p)
+		if err != nil {
+			return 0, err
+		}
+		defer os.Remove(copyPath)
+		p = copyPath
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var size int64
+	c := newChunker(f, r.config.Chunking)
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		size += int64(len(chunk))
+		id := r.chunkID(chunk)
+		file.Chunks = append(file.Chunks, id)
+		if known[id] {
+			result.ReusedChunks++
+			continue
+		}
+		sealed, err := r.seal(chunk)
+		if err != nil {
+			return 0, err
+		}
+		if err := putWithRetry(ctx, r.store, r.chunkKey(id), sealed); err != nil {
+			return 0, err
+		}
+		known[id] = true
+		result.NewChunks++
+		result.NewBytes += int64(len(sealed))
+	}
+	return size, nil
+}
+
+// vacuumCopy writes a consistent copy of a live SQLite database to a
+// temporary file
+func vacuumCopy(p string) (string, error) {
+	tmp, err := os.CreateTemp("", "weather-snapshot-*.db")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+
+	db, err := sql.Open("sqlite", p+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	if _, err := db.Exec("VACUUM INTO ?", tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to copy database: %w", err)
+	}
+	return tmp.Name(), nil
+}
+
+// chunkSet lists the stored chunk ids
+func (r *Repository) chunkSet(ctx context.Context) (map[string]bool, error) {
+	objects, err := r.store.List(ctx, r.prefix+repoChunks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks: %w", err)
+	}
+	known := make(map[string]bool, len(objects))
+	for _, o := range objects {
+		known[path.Base(o.Key)] = true
+	}
+	return known, nil
+}
+
+// ListSnapshots returns the snapshots, oldest first
+func (r *Repository) ListSnapshots(ctx context.Context) ([]*Snapshot, error) {
+	objects, err := r.store.List(ctx, r.prefix+repoSnapshots)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	var snapshots []*Snapshot
+	for _, o := range objects {
+		snap, err := r.loadSnapshot(ctx, o.Key)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt) })
+	return snapshots, nil
+}
+
+// GetSnapshot returns the snapshot with the given id, or the latest one
+// for "latest"
+func (r *Repository) GetSnapshot(ctx context.Context, id string) (*Snapshot, error) {
+	if id == "latest" {
+		snapshots, err := r.ListSnapshots(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(snapshots) == 0 {
+			return nil, errors.New("repository has no snapshots")
+		}
+		return snapshots[len(snapshots)-1], nil
+	}
+	if strings.ContainsAny(id, "/\\") || id == "" {
+		return nil, fmt.Errorf("invalid snapshot id %q", id)
+	}
+	snap, err := r.loadSnapshot(ctx, r.prefix+repoSnapshots+id)
+	if errors.Is(err, objectstore.ErrNotExist) {
+		return nil, fmt.Errorf("snapshot %s not found", id)
+	}
+	return snap, err
+}
+
+func (r *Repository) loadSnapshot(ctx context.Context, key string) (*Snapshot, error) {
+	sealed, err := r.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.unseal(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", path.Base(key), err)
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("invalid snapshot %s: %w", path.Base(key), err)
+	}
+	return &snap, nil
+}
+
+// ForgetResult lists what Forget removed
+type ForgetResult struct {
+	Snapshots []string
+	Chunks    int
+	Bytes     int64
+}
+
+// Forget deletes the snapshots the policy does not keep (the newest 4
+// for a zero policy) and the chunks no remaining snapshot uses. It
+// refuses to run while a snapshot is being written
+func (r *Repository) Forget(ctx context.Context, policy RetentionPolicy) (*ForgetResult, error) {
+	locks, err := r.store.List(ctx, r.prefix+repoLocks)
+	if err != nil {
+		return nil, err
+	}
+	for _, lock := range locks {
+		if time.Since(lock.ModTime) < staleLockAge {
+			return nil, fmt.Errorf("snapshot %s is being written; try again later", path.Base(lock.Key))
+		}
+	}
+
+	snapshots, err := r.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &ForgetResult{}
+	used := make(map[string]bool)
+	keep := keepSet(policy, len(snapshots), func(i int) time.Time { return snapshots[i].CreatedAt })
+	for i, snap := range snapshots {
+		if keep[i] {
+			for _, f := range snap.Files {
+				for _, id := range f.Chunks {
+					used[id] = true
+				}
+			}
+			continue
+		}
+		if err := r.store.Delete(ctx, r.prefix+repoSnapshots+snap.ID); err != nil {
+			return result, err
+		}
+		result.Snapshots = append(result.Snapshots, snap.ID)
+	}
+
+	objects, err := r.store.List(ctx, r.prefix+repoChunks)
+	if err != nil {
+		return result, err
+	}
+	for _, o := range objects {
+		if used[path.Base(o.Key)] {
+			continue
+		}
+		if err := r.store.Delete(ctx, o.Key); err != nil {
+			return result, err
+		}
+		result.Chunks++
+		result.Bytes += o.Size
+	}
+	return result, nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
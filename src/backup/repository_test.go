@@ -0,0 +1,319 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apimgr/weather/src/backup/objectstore"
+)
+
+var testChunkParams = chunkParams{Min: 256, Avg: 1024, Max: 4096}
+
+func chunkAll(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	c := newChunker(bytes.NewReader(data), testChunkParams)
+	var chunks [][]byte
+	for {
+		chunk, err := c.Next()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, bytes.Clone(chunk))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	data := make([]byte, 200<<10)
+	rand.Read(data)
+	chunks := chunkAll(t, data)
+	if !bytes.Equal(bytes.Join(chunks, nil), data) {
+		t.Fatal("chunks do not add up to the input")
+	}
+	for i, chunk := range chunks {
+		if len(chunk) > testChunkParams.Max || len(chunk) < testChunkParams.Min && i != len(chunks)-1 {
+			t.Errorf("chunk %d has %d bytes", i, len(chunk))
+		}
+	}
+
+	// Inserting bytes only changes the chunks around the insertion
+	edited := append(append(bytes.Clone(data[:100<<10]), []byte("inserted")...), data[100<<10:]...)
+	seen := make(map[string]bool)
+	for _, chunk := range chunks {
+		seen[string(chunk)] = true
+	}
+	changed := 0
+	for _, chunk := range chunkAll(t, edited) {
+		if !seen[string(chunk)] {
+			changed++
+		}
+	}
+	if changed > 3 {
+		t.Errorf("%d of %d chunks changed by a small insertion", changed, len(chunks))
+	}
+}
+
+// newTestInstall creates config and data directories with a dataset, a
+// template and a users database
+func newTestInstall(t *testing.T) (configDir, dataDir string) {
+	t.Helper()
+	configDir, dataDir = t.TempDir(), t.TempDir()
+	dataset := make([]byte, 64<<10)
+	rand.Read(dataset)
+	files := map[string][]byte{
+		filepath.Join(configDir, "server.yml"):                       []byte("server:\n  port: 80\n"),
+		filepath.Join(configDir, "databases", "airports.json"):       dataset,
+		filepath.Join(configDir, "template", "email", "welcome.txt"): []byte("Welcome to {app_name}"),
+		filepath.Join(configDir, "ssl", "cert.pem"):                  []byte("certificate"),
+	}
+	for path, data := range files {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.MkdirAll(filepath.Join(dataDir, "db"), 0700)
+	db := openUsersDB(t, filepath.Join(dataDir, "db", "users.db"))
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE user_saved_locations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, name TEXT NOT NULL,
+		latitude REAL NOT NULL, longitude REAL NOT NULL, timezone TEXT, alerts_enabled BOOLEAN DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO user_saved_locations (user_id, name, latitude, longitude, timezone) VALUES
+			(1, 'Home', 40.7, -74.0, 'America/New_York'),
+			(1, 'Cabin', 44.2, -72.5, 'America/New_York'),
+			(2, 'Office', 51.5, -0.1, 'Europe/London')`); err != nil {
+		t.Fatal(err)
+	}
+	return configDir, dataDir
+}
+
+func openUsersDB(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestRepository(t *testing.T, store objectstore.Store, password string) *Repository {
+	t.Helper()
+	repo, err := openRepository(context.Background(), store, "repository", password, testChunkParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func TestSnapshotIncremental(t *testing.T) {
+	ctx := context.Background()
+	configDir, dataDir := newTestInstall(t)
+	store, _ := objectstore.NewFile(t.TempDir())
+	repo := newTestRepository(t, store, "secret")
+	opts := SnapshotOptions{ConfigDir: configDir, DataDir: dataDir, CreatedBy: "test"}
+
+	first, err := repo.CreateSnapshot(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.NewChunks == 0 || len(first.Snapshot.Files) != 4 {
+		t.Fatalf("first snapshot = %+v, files %+v", first, first.Snapshot.Files)
+	}
+	for _, f := range first.Snapshot.Files {
+		if strings.HasPrefix(f.Path, "config/ssl/") {
+			t.Errorf("ssl is not a default set but %s was stored", f.Path)
+		}
+	}
+
+	// Nothing changed: the unchanged files are not read and only the
+	// database copy is chunked again, without new chunks
+	second, err := repo.CreateSnapshot(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.NewChunks != 0 || second.UnchangedFiles != 3 {
+		t.Errorf("unchanged snapshot = %+v", second)
+	}
+
+	// Touching the large dataset stores only the chunks around the edit
+	path := filepath.Join(configDir, "databases", "airports.json")
+	data, _ := os.ReadFile(path)
+	copy(data[30<<10:], "changed")
+	os.WriteFile(path, data, 0644)
+	third, err := repo.CreateSnapshot(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.NewChunks == 0 || third.NewChunks > 3 {
+		t.Errorf("edited dataset stored %d new chunks", third.NewChunks)
+	}
+
+	// Selected sets only
+	usersOnly, err := repo.CreateSnapshot(ctx, SnapshotOptions{ConfigDir: configDir, DataDir: dataDir, Sets: []string{"users-db"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := usersOnly.Snapshot.Files; len(files) != 1 || files[0].Path != usersDBPath {
+		t.Errorf("users-db snapshot files = %+v", files)
+	}
+	if _, err := repo.CreateSnapshot(ctx, SnapshotOptions{ConfigDir: configDir, DataDir: dataDir, Sets: []string{"nope"}}); err == nil {
+		t.Error("unknown backup set accepted")
+	}
+
+	snapshots, err := repo.ListSnapshots(ctx)
+	if err != nil || len(snapshots) != 4 {
+		t.Fatalf("ListSnapshots = %d, %v", len(snapshots), err)
+	}
+
+	// The password is required and checked
+	if _, err := openRepository(ctx, store, "repository", "wrong", testChunkParams); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("open with the wrong password = %v", err)
+	}
+	if _, err := openRepository(ctx, store, "repository", "", testChunkParams); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("open without a password = %v", err)
+	}
+	chunks, _ := store.List(ctx, "repository/chunks/")
+	sealed, _ := store.Get(ctx, chunks[0].Key)
+	if bytes.Contains(sealed, []byte("{app_name}")) {
+		t.Error("chunk stored in the clear")
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	ctx := context.Background()
+	configDir, dataDir := newTestInstall(t)
+	store, _ := objectstore.NewFile(t.TempDir())
+	repo := newTestRepository(t, store, "")
+	result, err := repo.CreateSnapshot(ctx, SnapshotOptions{ConfigDir: configDir, DataDir: dataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := result.Snapshot.ID
+
+	// A single notification template
+	template := filepath.Join(configDir, "template", "email", "welcome.txt")
+	os.WriteFile(template, []byte("broken"), 0644)
+	restored, err := repo.RestoreSnapshot(ctx, id, SnapshotRestoreOptions{
+		ConfigDir: configDir, DataDir: dataDir, Paths: []string{"config/template/email/welcome.txt"},
+	})
+	if err != nil || len(restored) != 1 {
+		t.Fatalf("restore template = %v, %v", restored, err)
+	}
+	if data, _ := os.ReadFile(template); string(data) != "Welcome to {app_name}" {
+		t.Errorf("restored template = %q", data)
+	}
+	if data, err := repo.ReadFile(ctx, "latest", "config/server.yml"); err != nil || !strings.Contains(string(data), "port: 80") {
+		t.Errorf("ReadFile = %q, %v", data, err)
+	}
+
+	// A whole set into a fresh installation
+	newConfig, newData := t.TempDir(), t.TempDir()
+	restored, err = repo.RestoreSnapshot(ctx, id, SnapshotRestoreOptions{ConfigDir: newConfig, DataDir: newData, Sets: []string{"datasets", "users-db"}})
+	if err != nil || len(restored) != 2 {
+		t.Fatalf("restore sets = %v, %v", restored, err)
+	}
+	want, _ := os.ReadFile(filepath.Join(configDir, "databases", "airports.json"))
+	if got, _ := os.ReadFile(filepath.Join(newConfig, "databases", "airports.json")); !bytes.Equal(got, want) {
+		t.Error("restored dataset differs")
+	}
+	if err := checkIntegrity(filepath.Join(newData, "db", "users.db")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(newConfig, "server.yml")); !os.IsNotExist(err) {
+		t.Error("unselected set restored")
+	}
+}
+
+func TestRestoreUserLocations(t *testing.T) {
+	ctx := context.Background()
+	configDir, dataDir := newTestInstall(t)
+	store, _ := objectstore.NewFile(t.TempDir())
+	repo := newTestRepository(t, store, "")
+	result, err := repo.CreateSnapshot(ctx, SnapshotOptions{ConfigDir: configDir, DataDir: dataDir, Sets: []string{"users-db"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := openUsersDB(t, filepath.Join(dataDir, "db", "users.db"))
+	defer db.Close()
+	if _, err := db.Exec("DELETE FROM user_saved_locations WHERE user_id = 1 AND name = 'Cabin'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM user_saved_locations WHERE user_id = 2"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := repo.RestoreUserLocations(ctx, result.Snapshot.ID, 1, db)
+	if err != nil || n != 1 {
+		t.Fatalf("RestoreUserLocations = %d, %v", n, err)
+	}
+	var names []string
+	rows, _ := db.Query("SELECT name FROM user_saved_locations ORDER BY id")
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	rows.Close()
+	// Other users' data is left alone
+	if strings.Join(names, ",") != "Home,Cabin" {
+		t.Errorf("locations after restore = %v", names)
+	}
+	if n, err := repo.RestoreUserLocations(ctx, result.Snapshot.ID, 1, db); err != nil || n != 0 {
+		t.Errorf("second restore = %d, %v", n, err)
+	}
+}
+
+func TestForgetSnapshots(t *testing.T) {
+	ctx := context.Background()
+	configDir, dataDir := newTestInstall(t)
+	store, _ := objectstore.NewFile(t.TempDir())
+	repo := newTestRepository(t, store, "")
+	opts := SnapshotOptions{ConfigDir: configDir, DataDir: dataDir, Sets: []string{"datasets"}}
+	path := filepath.Join(configDir, "databases", "airports.json")
+
+	var results []*SnapshotResult
+	for i := 0; i < 3; i++ {
+		data := make([]byte, 8<<10)
+		rand.Read(data)
+		os.WriteFile(path, data, 0644)
+		result, err := repo.CreateSnapshot(ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, result)
+	}
+
+	// A snapshot being written blocks garbage collection
+	store.Put(ctx, "repository/locks/writer", []byte("now"))
+	if _, err := repo.Forget(ctx, RetentionPolicy{Hourly: 1}); err == nil {
+		t.Error("Forget ran while a snapshot was being written")
+	}
+	store.Delete(ctx, "repository/locks/writer")
+
+	forgotten, err := repo.Forget(ctx, RetentionPolicy{Hourly: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forgotten.Snapshots) != 2 || forgotten.Chunks != results[0].NewChunks+results[1].NewChunks {
+		t.Errorf("Forget = %+v", forgotten)
+	}
+	latest := results[2].Snapshot.ID
+	if _, err := repo.RestoreSnapshot(ctx, latest, SnapshotRestoreOptions{ConfigDir: t.TempDir(), DataDir: t.TempDir()}); err != nil {
+		t.Errorf("restore after Forget: %v", err)
+	}
+	if _, err := repo.GetSnapshot(ctx, results[0].Snapshot.ID); err == nil {
+		t.Error("forgotten snapshot still readable")
+	}
+}
@@ -164,6 +164,12 @@ destPath = filepath.Join(configDir, header.Name)
 destPath = filepath.Join(dataDir, header.Name)
 }
 
+// Refuse entries that would land outside the destination directories
+if !strings.HasPrefix(destPath, filepath.Clean(configDir)+string(filepath.Separator)) &&
+!strings.HasPrefix(destPath, filepath.Clean(dataDir)+string(filepath.Separator)) {
+return fmt.Errorf("archive entry %q escapes the destination", header.Name)
+}
+
 // Create directory if needed
 if header.Typeflag == tar.TypeDir {
 if err := os.MkdirAll(destPath, os.FileMode(header.Mode)); err != nil {
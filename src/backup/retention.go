@@ -0,0 +1,108 @@
+// Package backup - grandfather-father-son retention of backup archives
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy keeps the newest backup of each of the last Hourly
+// hours, Daily days, Weekly ISO weeks and Monthly months, in the time
+// zone of each time. A backup kept by any rule is kept, and the newest
+// backup is always kept
+type RetentionPolicy struct {
+	Hourly  int
+	Daily   int
+	Weekly  int
+	Monthly int
+}
+
+// IsZero reports whether no rule is set
+func (p RetentionPolicy) IsZero() bool {
+	return p.Hourly <= 0 && p.Daily <= 0 && p.Weekly <= 0 && p.Monthly <= 0
+}
+
+// Keep reports for each time whether the policy keeps that backup
+func (p RetentionPolicy) Keep(times []time.Time) []bool {
+	keep := make([]bool, len(times))
+	if len(times) == 0 {
+		return keep
+	}
+	// Newest first
+	order := make([]int, len(times))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return times[order[a]].After(times[order[b]]) })
+	keep[order[0]] = true
+
+	rules := []struct {
+		count  int
+		period func(time.Time) string
+	}{
+		{p.Hourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, rule := range rules {
+		seen := make(map[string]bool)
+		for _, i := range order {
+			if len(seen) >= rule.count {
+				break
+			}
+			period := rule.period(times[i])
+			if !seen[period] {
+				seen[period] = true
+				keep[i] = true
+			}
+		}
+	}
+	return keep
+}
+
+// backupFilePrefix starts the name of every backup archive
+const backupFilePrefix = "weather_backup_"
+
+// BackupTime returns when a backup was taken, from its file name
+// (weather_backup_YYYY-MM-DD_HHMMSS.tar.gz[.enc])
+func BackupTime(filename string) (time.Time, bool) {
+	name := strings.TrimPrefix(filepath.Base(filename), backupFilePrefix)
+	if len(name) < len("2006-01-02_150405") || !strings.HasPrefix(filepath.Base(filename), backupFilePrefix) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("2006-01-02_150405", name[:len("2006-01-02_150405")], time.Local)
+	return t, err == nil
+}
+
+// pruneBackups deletes the backups in backupDir the policy does not keep
+func (s *BackupService) pruneBackups(backupDir string, policy RetentionPolicy) error {
+	files, err := filepath.Glob(filepath.Join(backupDir, backupFilePrefix+"*.tar.gz*"))
+	if err != nil {
+		return err
+	}
+	times := make([]time.Time, len(files))
+	for i, file := range files {
+		if t, ok := BackupTime(file); ok {
+			times[i] = t
+		} else if info, err := os.Stat(file); err == nil {
+			times[i] = info.ModTime()
+		}
+	}
+	for i, keep := range policy.Keep(times) {
+		if keep {
+			continue
+		}
+		if err := os.Remove(files[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to delete old backup %s: %v\n", files[i], err)
+		}
+	}
+	return nil
+}
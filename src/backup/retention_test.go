@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyKeep(t *testing.T) {
+	// Hourly backups over 60 days, newest first at index 0
+	now := time.Date(2026, 3, 31, 23, 30, 0, 0, time.UTC)
+	var times []time.Time
+	for h := 0; h < 60*24; h++ {
+		times = append(times, now.Add(-time.Duration(h)*time.Hour))
+	}
+
+	keep := RetentionPolicy{Hourly: 6, Daily: 7, Weekly: 4, Monthly: 3}.Keep(times)
+	var kept []time.Time
+	for i, k := range keep {
+		if k {
+			kept = append(kept, times[i])
+		}
+	}
+	// The newest 6 hours, then one backup per day, week and month
+	for i := 0; i < 6; i++ {
+		if !keep[i] {
+			t.Errorf("hour %d not kept", i)
+		}
+	}
+	if keep[6] {
+		t.Error("seventh hour kept")
+	}
+	for d := 1; d < 7; d++ {
+		// The newest backup of an earlier day is at 23:30
+		if i := 24 * d; !keep[i] {
+			t.Errorf("day %d (%s) not kept", d, times[i])
+		}
+	}
+	// The range reaches back to Feb 1, so the monthly rule keeps the
+	// newest backup of February
+	feb := time.Date(2026, 2, 28, 23, 30, 0, 0, time.UTC)
+	for i, tm := range times {
+		if tm.Equal(feb) && !keep[i] {
+			t.Error("newest February backup not kept")
+		}
+	}
+	if keep[len(times)-1] {
+		t.Error("oldest backup kept")
+	}
+	if len(kept) > 6+7+4+3 {
+		t.Errorf("kept %d backups", len(kept))
+	}
+
+	if keep := (RetentionPolicy{}).Keep(times[:3]); !keep[0] || keep[1] || keep[2] {
+		t.Errorf("zero policy keep = %v, want only the newest", keep)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"weather_backup_2026-03-01_020000.tar.gz",
+		"weather_backup_2026-03-02_020000.tar.gz",
+		"weather_backup_2026-03-02_140000.tar.gz",
+		"weather_backup_2026-03-03_020000.tar.gz.enc",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	svc := New(t.TempDir(), t.TempDir())
+	if err := svc.pruneBackups(dir, RetentionPolicy{Daily: 2}); err != nil {
+		t.Fatal(err)
+	}
+	left, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(left) != 2 || filepath.Base(left[0]) != names[2] || filepath.Base(left[1]) != names[3] {
+		t.Errorf("left = %v", left)
+	}
+}
@@ -0,0 +1,259 @@
+// Package backup - restoring snapshots, single files and single users' data
+package backup
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SnapshotRestoreOptions selects what RestoreSnapshot writes
+type SnapshotRestoreOptions struct {
+	ConfigDir string
+	DataDir   string
+	// Restore only these backup sets; every set in the snapshot when empty
+	Sets []string
+	// Restore only these paths (files or directories, e.g.
+	// config/template/email/welcome.txt); combined with Sets
+	Paths []string
+}
+
+// RestoreSnapshot writes the selected files of a snapshot back into the
+// config and data directories and returns the restored paths. Each file
+// is replaced atomically; the server should be stopped when restoring
+// databases
+func (r *Repository) RestoreSnapshot(ctx context.Context, id string, opts SnapshotRestoreOptions) ([]string, error) {
+	snap, err := r.GetSnapshot(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	files, err := selectFiles(snap, opts.Sets, opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("nothing in snapshot %s matches the selection", snap.ID)
+	}
+
+	var restored []string
+	for _, f := range files {
+		target := snapshotSource(f.Path, opts.ConfigDir, opts.DataDir)
+		if err := r.restoreFile(ctx, f, target); err != nil {
+			return restored, fmt.Errorf("%s: %w", f.Path, err)
+		}
+		if strings.HasSuffix(f.Path, ".db") {
+			// The WAL of the replaced database no longer applies
+			os.Remove(target + "-wal")
+			os.Remove(target + "-shm")
+		}
+		restored = append(restored, f.Path)
+	}
+	return restored, nil
+}
+
+// selectFiles returns the files of snap in the given sets and below the
+// given paths
+func selectFiles(snap *Snapshot, sets, paths []string) ([]SnapshotFile, error) {
+	var roots []string
+	for _, name := range sets {
+		set, ok := lookupBackupSet(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown backup set %q", name)
+		}
+		roots = append(roots, set.Paths...)
+	}
+	var selected []SnapshotFile
+	for _, f := range snap.Files {
+		if (len(roots) == 0 || underAny(f.Path, roots)) && (len(paths) == 0 || underAny(f.Path, paths)) {
+			selected = append(selected, f)
+		}
+	}
+	return selected, nil
+}
+
+// underAny reports whether p is one of roots or inside one of them
+func underAny(p string, roots []string) bool {
+	for _, root := range roots {
+		root = strings.TrimSuffix(path.Clean(root), "/")
+		if p == root || strings.HasPrefix(p, root+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreFile writes the contents of f to target through a temporary file
+func (r *Repository) restoreFile(ctx context.Context, f SnapshotFile, target string) error {
+	if !strings.HasPrefix(f.Path, "config/") && !strings.HasPrefix(f.Path, "data/") || strings.Contains(f.Path, "..") {
+		return errors.New("invalid path in snapshot")
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".restore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := r.writeFile(ctx, f, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	mode := f.Mode
+	if mode == 0 {
+		mode = 0644
+	}
+	os.Chmod(tmp.Name(), mode)
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	os.Chtimes(target, time.Now(), f.ModTime)
+	return nil
+}
+
+// writeFile writes the chunks of f to w and checks the size
+func (r *Repository) writeFile(ctx context.Context, f SnapshotFile, w io.Writer) error {
+	var size int64
+	for _, id := range f.Chunks {
+		sealed, err := r.store.Get(ctx, r.chunkKey(id))
+		if err != nil {
+			return fmt.Errorf("chunk %s: %w", id, err)
+		}
+		data, err := r.unseal(sealed)
+		if err != nil {
+			return fmt.Errorf("chunk %s: %w", id, err)
+		}
+		if r.chunkID(data) != id {
+			return fmt.Errorf("chunk %s is corrupt", id)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		size += int64(len(data))
+	}
+	if size != f.Size {
+		return fmt.Errorf("restored %d bytes, expected %d", size, f.Size)
+	}
+	return nil
+}
+
+// ReadFile returns the contents of one file in a snapshot
+func (r *Repository) ReadFile(ctx context.Context, id, name string) ([]byte, error) {
+	snap, err := r.GetSnapshot(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range snap.Files {
+		if f.Path == name {
+			var buf bytes.Buffer
+			if err := r.writeFile(ctx, f, &buf); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not in snapshot %s", name, snap.ID)
+}
+
+// usersDBPath is the users database inside a snapshot
+const usersDBPath = "data/db/users.db"
+
+// RestoreUserLocations copies the saved locations of one user from the
+// users database in a snapshot into db, skipping locations the user has
+// under the same name, and returns how many were restored
+func (r *Repository) RestoreUserLocations(ctx context.Context, id string, userID int64, db *sql.DB) (int, error) {
+	snap, err := r.GetSnapshot(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	files, _ := selectFiles(snap, nil, []string{usersDBPath})
+	if len(files) == 0 {
+		return 0, fmt.Errorf("snapshot %s does not include the users database", snap.ID)
+	}
+	tmpDir, err := os.MkdirTemp("", "weather-snapshot-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmpDir)
+	copyPath := filepath.Join(tmpDir, "users.db")
+	if err := r.restoreFile(ctx, files[0], copyPath); err != nil {
+		return 0, err
+	}
+
+	snapDB, err := sql.Open("sqlite", copyPath)
+	if err != nil {
+		return 0, err
+	}
+	defer snapDB.Close()
+	rows, err := snapDB.QueryContext(ctx, `SELECT id, name, latitude, longitude, timezone, alerts_enabled, created_at, updated_at
+		FROM user_saved_locations WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read saved locations from snapshot: %w", err)
+	}
+	type location struct {
+		id                   int64
+		name                 string
+		latitude, longitude  float64
+		timezone             sql.NullString
+		alertsEnabled        sql.NullBool
+		createdAt, updatedAt sql.NullTime
+	}
+	var locations []location
+	for rows.Next() {
+		var l location
+		if err := rows.Scan(&l.id, &l.name, &l.latitude, &l.longitude, &l.timezone, &l.alertsEnabled, &l.createdAt, &l.updatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		locations = append(locations, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	restored := 0
+	for _, l := range locations {
+		var exists int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_saved_locations WHERE user_id = ? AND name = ?", userID, l.name).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if exists > 0 {
+			continue
+		}
+		// Keep the original id unless another row took it
+		var taken int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_saved_locations WHERE id = ?", l.id).Scan(&taken); err != nil {
+			return 0, err
+		}
+		args := []any{userID, l.name, l.latitude, l.longitude, l.timezone, l.alertsEnabled, l.createdAt, l.updatedAt}
+		query := `INSERT INTO user_saved_locations (user_id, name, latitude, longitude, timezone, alerts_enabled, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), COALESCE(?, CURRENT_TIMESTAMP))`
+		if taken == 0 {
+			args = append([]any{l.id}, args...)
+			query = `INSERT INTO user_saved_locations (id, user_id, name, latitude, longitude, timezone, alerts_enabled, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, COALESCE(?, CURRENT_TIMESTAMP), COALESCE(?, CURRENT_TIMESTAMP))`
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return 0, fmt.Errorf("failed to restore location %q: %w", l.name, err)
+		}
+		restored++
+	}
+	return restored, tx.Commit()
+}
@@ -0,0 +1,182 @@
+package backup
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SQLite write-ahead log format: https://www.sqlite.org/fileformat2.html#walformat
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+	walMagicLE         = 0x377f0682
+	walMagicBE         = 0x377f0683
+)
+
+// walHeader is the header of a WAL file. The salts change every time the
+// WAL restarts from the beginning
+type walHeader struct {
+	bigEndianChecksum bool
+	pageSize          int
+	salt1, salt2      uint32
+	checksum1         uint32
+	checksum2         uint32
+}
+
+// readWALHeader reads and validates the header at the start of the WAL. A
+// missing or empty WAL has no header
+func readWALHeader(f io.ReaderAt) (walHeader, bool, error) {
+	buf := make([]byte, walHeaderSize)
+	if n, err := f.ReadAt(buf, 0); n < walHeaderSize {
+		if err == io.EOF || err == nil {
+			return walHeader{}, false, nil
+		}
+		return walHeader{}, false, err
+	}
+	magic := binary.BigEndian.Uint32(buf[0:])
+	if magic != walMagicLE && magic != walMagicBE {
+		return walHeader{}, false, nil
+	}
+	h := walHeader{
+		bigEndianChecksum: magic == walMagicBE,
+		pageSize:          int(binary.BigEndian.Uint32(buf[8:])),
+		salt1:             binary.BigEndian.Uint32(buf[16:]),
+		salt2:             binary.BigEndian.Uint32(buf[20:]),
+		checksum1:         binary.BigEndian.Uint32(buf[24:]),
+		checksum2:         binary.BigEndian.Uint32(buf[28:]),
+	}
+	if s1, s2 := walChecksum(h.bigEndianChecksum, 0, 0, buf[:24]); s1 != h.checksum1 || s2 != h.checksum2 {
+		return walHeader{}, false, nil
+	}
+	if h.pageSize == 1 {
+		h.pageSize = 65536
+	}
+	if h.pageSize < 512 || h.pageSize&(h.pageSize-1) != 0 {
+		return walHeader{}, false, fmt.Errorf("invalid WAL page size %d", h.pageSize)
+	}
+	return h, true, nil
+}
+
+// frameSize is the size of one frame: header plus page
+func (h walHeader) frameSize() int64 {
+	return int64(walFrameHeaderSize + h.pageSize)
+}
+
+// walChecksum extends the cumulative checksum (s1, s2) over b, whose length
+// is a multiple of 8
+func walChecksum(bigEndian bool, s1, s2 uint32, b []byte) (uint32, uint32) {
+	order := binary.ByteOrder(binary.LittleEndian)
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	for i := 0; i+8 <= len(b); i += 8 {
+		s1 += order.Uint32(b[i:]) + s2
+		s2 += order.Uint32(b[i+4:]) + s1
+	}
+	return s1, s2
+}
+
+// walPosition is a point in the WAL up to which frames were read, with the
+// running checksum needed to validate the frames after it
+type walPosition struct {
+	offset            int64
+	checksum1         uint32
+	checksum2         uint32
+	salt1, salt2      uint32
+	pageSize          int
+	bigEndianChecksum bool
+}
+
+// start returns the position just after the header
+func (h walHeader) start() walPosition {
+	return walPosition{
+		offset:            walHeaderSize,
+		checksum1:         h.checksum1,
+		checksum2:         h.checksum2,
+		salt1:             h.salt1,
+		salt2:             h.salt2,
+		pageSize:          h.pageSize,
+		bigEndianChecksum: h.bigEndianChecksum,
+	}
+}
+
+// readCommitted returns the frames after pos that belong to committed
+// transactions, and the position after the last commit frame. Reading stops
+// at the first frame with other salts or a bad checksum: the end of the
+// valid log
+func readCommitted(f io.ReaderAt, pos walPosition) ([]byte, walPosition, error) {
+	frameSize := int64(walFrameHeaderSize + pos.pageSize)
+	var frames []byte
+	committed := pos
+	cur := pos
+	buf := make([]byte, frameSize)
+	for {
+		n, err := f.ReadAt(buf, cur.offset)
+		if int64(n) < frameSize {
+			if err == nil || err == io.EOF {
+				break
+			}
+			return nil, pos, err
+		}
+		if binary.BigEndian.Uint32(buf[8:]) != cur.salt1 || binary.BigEndian.Uint32(buf[12:]) != cur.salt2 {
+			break
+		}
+		s1, s2 := walChecksum(cur.bigEndianChecksum, cur.checksum1, cur.checksum2, buf[:8])
+		s1, s2 = walChecksum(cur.bigEndianChecksum, s1, s2, buf[walFrameHeaderSize:])
+		if s1 != binary.BigEndian.Uint32(buf[16:]) || s2 != binary.BigEndian.Uint32(buf[20:]) {
+			break
+		}
+		frames = append(frames, buf...)
+		cur.offset += frameSize
+		cur.checksum1, cur.checksum2 = s1, s2
+		if binary.BigEndian.Uint32(buf[4:]) != 0 {
+			committed = cur
+		}
+	}
+	return frames[:committed.offset-pos.offset], committed, nil
+}
+
+// applyFrames writes the pages of whole WAL frames into a database file.
+// Each commit frame sets the database size in pages
+func applyFrames(db *os.File, pageSize int, frames []byte) error {
+	frameSize := walFrameHeaderSize + pageSize
+	if len(frames)%frameSize != 0 {
+		return errors.New("WAL segment is not a whole number of frames")
+	}
+	for i := 0; i < len(frames); i += frameSize {
+		pgno := binary.BigEndian.Uint32(frames[i:])
+		commit := binary.BigEndian.Uint32(frames[i+4:])
+		if pgno == 0 {
+			return errors.New("WAL frame for page 0")
+		}
+		page := frames[i+walFrameHeaderSize : i+frameSize]
+		if _, err := db.WriteAt(page, int64(pgno-1)*int64(pageSize)); err != nil {
+			return err
+		}
+		if commit != 0 {
+			if err := db.Truncate(int64(commit) * int64(pageSize)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// databasePageSize reads the page size from a database file header
+func databasePageSize(f io.ReaderAt) (int, error) {
+	buf := make([]byte, 100)
+	if _, err := f.ReadAt(buf, 0); err != nil {
+		return 0, fmt.Errorf("failed to read database header: %w", err)
+	}
+	if string(buf[:16]) != "SQLite format 3\x00" {
+		return 0, errors.New("not a SQLite database")
+	}
+	size := int(binary.BigEndian.Uint16(buf[16:]))
+	if size == 1 {
+		size = 65536
+	}
+	return size, nil
+}
@@ -79,7 +79,7 @@ func (c *CLI) Parse(args []string) error {
 		baseURL        = c.flags.String("baseurl", "", "URL path prefix (default: /)")
 		daemon         = c.flags.Bool("daemon", false, "Daemonize (detach from terminal, Unix only)")
 		serviceCmd     = c.flags.String("service", "", "Service management: start, stop, restart, reload, --install, --uninstall")
-		maintenanceCmd = c.flags.String("maintenance", "", "Maintenance: backup, restore, update, mode, setup")
+		maintenanceCmd = c.flags.String("maintenance", "", "Maintenance: backup, restore, verify, audit, migrate, update, mode, setup")
 		updateCmd      = c.flags.String("update", "", "Update: check, yes, branch {stable|beta|daily}")
 		shellCmd       = c.flags.String("shell", "", "Shell integration: completions, init, --help")
 	)
@@ -114,10 +114,19 @@ func (c *CLI) Parse(args []string) error {
 		return fmt.Errorf("service command not registered")
 	}
 
-	// Handle maintenance command
+	// Handle maintenance command: the flag value is the subcommand and the
+	// remaining arguments are its options
 	if *maintenanceCmd != "" {
 		if cmd, ok := c.commands["maintenance"]; ok {
-			return cmd.Handler(c.flags.Args())
+			for env, dir := range map[string]string{"CONFIG_DIR": *configDir, "DATA_DIR": *dataDir, "LOG_DIR": *logDir, "BACKUP_DIR": *backupDir} {
+				if dir != "" {
+					os.Setenv(env, dir)
+				}
+			}
+			if err := cmd.Handler(append([]string{*maintenanceCmd}, c.flags.Args()...)); err != nil {
+				return err
+			}
+			os.Exit(0)
 		}
 		return fmt.Errorf("maintenance command not registered")
 	}
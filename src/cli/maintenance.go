@@ -38,7 +38,7 @@ type BackupManifest struct {
 // MaintenanceCommand handles maintenance operations per AI.md PART 25
 func MaintenanceCommand(args []string) error {
 	if len(args) == 0 {
-		return fmt.Errorf("no maintenance command specified. Use: backup, restore, verify, admin-recovery")
+		return fmt.Errorf("no maintenance command specified. Use: backup, restore, snapshot, pitr, verify, audit, pwned, migrate, admin-recovery")
 	}
 
 	cmd := args[0]
@@ -53,10 +53,30 @@ func MaintenanceCommand(args []string) error {
 		// Per AI.md PART 25 lines 22588-22649
 		return MaintenanceRestoreCommand(remainingArgs)
 
+	case "snapshot":
+		// Incremental, deduplicated backups of selected backup sets
+		return MaintenanceSnapshotCommand(remainingArgs)
+
+	case "pitr":
+		// Point-in-time restore from continuous WAL replication
+		return MaintenancePITRCommand(remainingArgs)
+
 	case "verify":
 		// AI.md PART 25: Verify system integrity
 		return verifySystem()
 
+	case "audit":
+		// Hash chain verification and export
+		return MaintenanceAuditCommand(remainingArgs)
+
+	case "pwned":
+		// Breached password dataset import
+		return MaintenancePwnedCommand(remainingArgs)
+
+	case "migrate":
+		// Versioned schema migrations for the server and users databases
+		return MaintenanceMigrateCommand(remainingArgs)
+
 	case "admin-recovery", "setup":
 		// AI.md PART 25 lines 22643-22750
 		return adminRecoverySetup()
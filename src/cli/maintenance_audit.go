@@ -0,0 +1,124 @@
+// Package cli - maintenance audit command: hash chain verification and export
+package cli
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/apimgr/weather/src/paths"
+	"github.com/apimgr/weather/src/server/service"
+)
+
+// MaintenanceAuditCommand handles audit log verification and export
+//
+//	--maintenance audit verify
+//	--maintenance audit export [--format jsonl|cef|syslog] [--output FILE]
+func MaintenanceAuditCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no audit command specified. Use: verify, export")
+	}
+
+	p := paths.GetDefaultPaths("weather")
+	if p == nil {
+		return fmt.Errorf("failed to get default paths")
+	}
+	if configDir := os.Getenv("CONFIG_DIR"); configDir != "" {
+		p.ConfigDir = configDir
+	}
+	if logDir := os.Getenv("LOG_DIR"); logDir != "" {
+		p.LogDir = logDir
+	}
+
+	switch args[0] {
+	case "verify":
+		return verifyAuditLog(p.LogDir, p.ConfigDir)
+	case "export":
+		return exportAuditLog(p.LogDir, args[1:])
+	default:
+		return fmt.Errorf("unknown audit command: %s", args[0])
+	}
+}
+
+func verifyAuditLog(logDir, configDir string) error {
+	fmt.Println("🔍 Audit Log Verification")
+	fmt.Printf("   Directory: %s\n\n", logDir)
+
+	var key ed25519.PublicKey
+	keyPath := filepath.Join(configDir, service.AuditSigningKeyFile)
+	if pub, err := service.ReadAuditPublicKey(keyPath); err != nil {
+		fmt.Printf("⚠️  Signing key not readable (%v); checkpoint signatures will not be checked\n\n", err)
+	} else {
+		key = pub
+		fmt.Printf("   Signing key: %s\n\n", service.AuditKeyID(pub))
+	}
+
+	report, err := service.VerifyAuditLog(logDir, key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Files:        %d\n", len(report.Files))
+	fmt.Printf("Records:      %d (seq %d to %d)\n", report.Records, report.FirstSeq, report.LastSeq)
+	if report.Legacy > 0 {
+		fmt.Printf("Unchained:    %d records written before hash chaining\n", report.Legacy)
+	}
+	if report.FirstSeq > 1 {
+		fmt.Printf("Note:         records before seq %d were removed by log retention\n", report.FirstSeq)
+	}
+	fmt.Printf("Checkpoints:  %d (%d verified)\n", report.Checkpoints, report.VerifiedCheckpoints)
+	if report.UnsignedTail > 0 {
+		fmt.Printf("Unsigned:     %d records after the last verified checkpoint\n", report.UnsignedTail)
+	}
+	fmt.Println()
+
+	if report.OK {
+		fmt.Println("✓ Audit log is intact")
+		return nil
+	}
+
+	for _, issue := range report.Issues {
+		fmt.Printf("❌ %s:%d [%s] %s\n", issue.File, issue.Line, issue.Kind, issue.Message)
+	}
+	if report.TotalIssues > len(report.Issues) {
+		fmt.Printf("   ... and %d more\n", report.TotalIssues-len(report.Issues))
+	}
+	return fmt.Errorf("audit log verification failed: %d issues", report.TotalIssues)
+}
+
+func exportAuditLog(logDir string, args []string) error {
+	formatName := "jsonl"
+	output := ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--format":
+			if i+1 < len(args) {
+				formatName = args[i+1]
+				i++
+			}
+		case "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		}
+	}
+
+	format, err := service.ParseAuditExportFormat(formatName)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", output, err)
+		}
+		defer file.Close()
+		w = file
+	}
+	return service.ExportAuditLog(w, logDir, format)
+}
@@ -0,0 +1,242 @@
+// Package cli - maintenance migrate command: versioned schema migrations
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/apimgr/weather/src/backup"
+	"github.com/apimgr/weather/src/config"
+	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/paths"
+)
+
+// MaintenanceMigrateCommand applies, reverts and reports schema migrations
+//
+//	--maintenance migrate status [--database server|users]
+//	--maintenance migrate up [--database server|users] [--to N] [--dry-run] [--no-backup]
+//	--maintenance migrate down --database server|users [--steps N | --to N] [--dry-run] [--no-backup]
+//	--maintenance migrate unlock [--database server|users]
+func MaintenanceMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no migrate command specified. Use: status, up, down, unlock")
+	}
+
+	action := args[0]
+	var only string
+	to, steps := -1, 1
+	var dryRun, noBackup bool
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--database":
+			if i+1 < len(args) {
+				only = args[i+1]
+				i++
+			}
+		case "--to", "--steps":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a number", args[i])
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid %s value: %s", args[i], args[i+1])
+			}
+			if args[i] == "--to" {
+				to = n
+			} else {
+				steps = n
+			}
+			i++
+		case "--dry-run":
+			dryRun = true
+		case "--no-backup":
+			noBackup = true
+		default:
+			return fmt.Errorf("unknown migrate option: %s", args[i])
+		}
+	}
+
+	databases := []string{database.MigrationsServer, database.MigrationsUsers}
+	if only != "" {
+		databases = []string{only}
+	} else if action == "down" {
+		return fmt.Errorf("down requires --database server or --database users")
+	}
+
+	p := paths.GetDefaultPaths("weather")
+	if p == nil {
+		return fmt.Errorf("failed to get default paths")
+	}
+	if configDir := os.Getenv("CONFIG_DIR"); configDir != "" {
+		p.ConfigDir = configDir
+	}
+	if dataDir := os.Getenv("DATA_DIR"); dataDir != "" {
+		p.DataDir = dataDir
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("⚠️  Could not load server.yml: %v (using defaults)\n", err)
+	}
+	var connection *database.DatabaseConfig
+	if cfg != nil {
+		connection = cfg.Server.Database.Connection()
+	}
+	ddb, err := database.OpenDualDB(p.DataDir, connection)
+	if err != nil {
+		return err
+	}
+	defer ddb.Close()
+
+	hook := MigrationBackupHook(p.ConfigDir, p.DataDir, ddb.Dialect)
+	if noBackup {
+		hook = nil
+	}
+
+	for _, name := range databases {
+		migrator, err := ddb.Migrator(name)
+		if err != nil {
+			return err
+		}
+		migrator.DryRun = dryRun
+		migrator.BeforeApply = hook
+
+		switch action {
+		case "status":
+			err = printMigrationStatus(migrator)
+		case "up":
+			err = runMigrations(migrator, "up", func() ([]database.Migration, error) {
+				return migrator.Up(to)
+			})
+		case "down":
+			err = runMigrations(migrator, "down", func() ([]database.Migration, error) {
+				target := to
+				if target < 0 {
+					current, err := migrator.Version()
+					if err != nil {
+						return nil, err
+					}
+					target = current - steps
+					if target < 0 {
+						target = 0
+					}
+				}
+				return migrator.Down(target)
+			})
+		case "unlock":
+			var owner string
+			if owner, err = migrator.Unlock(); err == nil {
+				if owner == "" {
+					fmt.Printf("%s database: not locked\n", name)
+				} else {
+					fmt.Printf("✓ %s database: removed lock held by %s\n", name, owner)
+				}
+			}
+		default:
+			return fmt.Errorf("unknown migrate command: %s", action)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func printMigrationStatus(migrator *database.Migrator) error {
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+	current, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("📋 %s database (%s): version %d of %d\n", strings.ToUpper(migrator.Database[:1])+migrator.Database[1:], migrator.Dialect, current, migrator.Latest())
+	pending := 0
+	for _, status := range statuses {
+		switch {
+		case status.Unknown:
+			fmt.Printf("   ? %-32s applied by a newer version\n", status.Migration)
+		case status.Modified:
+			fmt.Printf("   ! %-32s edited after it was applied %s\n", status.Migration, status.AppliedAt.Local().Format("2006-01-02 15:04:05"))
+		case status.Applied:
+			fmt.Printf("   ✓ %-32s applied %s\n", status.Migration, status.AppliedAt.Local().Format("2006-01-02 15:04:05"))
+		default:
+			pending++
+			fmt.Printf("   · %-32s pending\n", status.Migration)
+		}
+	}
+	if pending > 0 {
+		fmt.Printf("   %d pending; apply with: weather --maintenance migrate up\n", pending)
+	}
+	fmt.Println()
+	return nil
+}
+
+func runMigrations(migrator *database.Migrator, direction string, run func() ([]database.Migration, error)) error {
+	plan, err := run()
+	if err != nil {
+		return fmt.Errorf("%s database: %w", migrator.Database, err)
+	}
+	if len(plan) == 0 {
+		fmt.Printf("%s database: nothing to migrate\n", migrator.Database)
+		return nil
+	}
+
+	if !migrator.DryRun {
+		for _, mg := range plan {
+			fmt.Printf("✓ %s database: %s %s\n", migrator.Database, direction, mg)
+		}
+		return nil
+	}
+
+	fmt.Printf("🔍 %s database: would migrate %s (dry run)\n", migrator.Database, direction)
+	for _, mg := range plan {
+		script := mg.Up
+		if direction == "down" {
+			script = mg.Down
+		}
+		translated, err := migrator.Dialect.Translate(script)
+		if err != nil {
+			return fmt.Errorf("migration %s: %w", mg, err)
+		}
+		fmt.Printf("\n-- %s (%s)\n%s\n", mg, direction, strings.TrimSpace(translated))
+	}
+	fmt.Println()
+	return nil
+}
+
+// MigrationBackupHook returns a migrator hook that takes one backup with
+// backup.BackupService before the first migration changes an existing
+// database. PostgreSQL and MySQL databases are not part of the backup
+// archive and must be backed up with the database server's tools
+func MigrationBackupHook(configDir, dataDir string, dialect database.Dialect) func(string, string, []database.Migration) error {
+	done := false
+	return func(name, direction string, plan []database.Migration) error {
+		if done {
+			return nil
+		}
+		done = true
+		if dialect != database.DialectSQLite {
+			log.Printf("Skipping pre-migration backup: back up the %s databases before upgrading", dialect)
+			return nil
+		}
+
+		log.Printf("Backing up before migrating %s database %s to %s", name, direction, plan[len(plan)-1])
+		path, err := backup.New(configDir, dataDir).Create(backup.BackupOptions{
+			ConfigDir:  configDir,
+			DataDir:    dataDir,
+			CreatedBy:  "migration",
+			AppVersion: Version,
+		})
+		if err != nil {
+			return fmt.Errorf("pre-migration backup failed: %w", err)
+		}
+		log.Printf("Pre-migration backup: %s", path)
+		return nil
+	}
+}
@@ -0,0 +1,171 @@
+// Package cli - maintenance pitr command: point-in-time restore from WAL replication
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/backup"
+	"github.com/apimgr/weather/src/backup/objectstore"
+	"github.com/apimgr/weather/src/config"
+	"github.com/apimgr/weather/src/paths"
+)
+
+// MaintenancePITRCommand lists restore points and restores the SQLite
+// databases from the replication target
+//
+//	--maintenance pitr list [--database server|users]
+//	--maintenance pitr restore [--time RFC3339|latest] [--database server|users] [--output DIR] [--yes]
+//
+// Without --output the databases in {data_dir}/db are replaced (the server
+// must be stopped); the current files are kept as *.db.pre-pitr-TIMESTAMP
+func MaintenancePITRCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no pitr command specified. Use: list, restore")
+	}
+
+	action := args[0]
+	var only, output string
+	var at time.Time
+	var yes bool
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--database", "--output", "--time":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", args[i])
+			}
+			value := args[i+1]
+			i++
+			switch args[i-1] {
+			case "--database":
+				only = value
+			case "--output":
+				output = value
+			case "--time":
+				if value == "latest" {
+					continue
+				}
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					return fmt.Errorf("invalid --time %q: use RFC 3339, e.g. 2026-01-02T15:04:05Z", value)
+				}
+				at = t
+			}
+		case "--yes":
+			yes = true
+		default:
+			return fmt.Errorf("unknown pitr option: %s", args[i])
+		}
+	}
+
+	databases := backup.ReplicatedDatabases
+	if only != "" {
+		if only != "server" && only != "users" {
+			return fmt.Errorf("unknown database %q: use server or users", only)
+		}
+		databases = []string{only}
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load server.yml: %w", err)
+	}
+	replication := cfg.Server.Maintenance.Backup.Replication
+	store, err := objectstore.Open(replication.ObjectStore())
+	if err != nil {
+		return fmt.Errorf("replication target: %w", err)
+	}
+
+	p := paths.GetDefaultPaths("weather")
+	if p == nil {
+		return fmt.Errorf("failed to get default paths")
+	}
+	if dataDir := os.Getenv("DATA_DIR"); dataDir != "" {
+		p.DataDir = dataDir
+	}
+
+	ctx := context.Background()
+	switch action {
+	case "list":
+		for _, name := range databases {
+			if err := printGenerations(ctx, store, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "restore":
+		return restorePITR(ctx, store, databases, at, p.DataDir, output, yes)
+	default:
+		return fmt.Errorf("unknown pitr command: %s", action)
+	}
+}
+
+func printGenerations(ctx context.Context, store objectstore.Store, name string) error {
+	generations, err := backup.ListGenerations(ctx, store, name)
+	if err != nil {
+		return fmt.Errorf("failed to list %s generations: %w", name, err)
+	}
+	fmt.Printf("%s database (%s):\n", name, store)
+	if len(generations) == 0 {
+		fmt.Println("  no restore points")
+		return nil
+	}
+	for _, gen := range generations {
+		fmt.Printf("  %s  %s → %s  %d segments, %d bytes\n", gen.ID,
+			gen.Start.Local().Format(time.RFC3339), gen.End.Local().Format(time.RFC3339), gen.Segments, gen.Size)
+	}
+	return nil
+}
+
+func restorePITR(ctx context.Context, store objectstore.Store, databases []string, at time.Time, dataDir, output string, yes bool) error {
+	inPlace := output == ""
+	if inPlace {
+		output = filepath.Join(dataDir, "db")
+		if !yes {
+			fmt.Println("⚠️  WARNING: This replaces the current databases. Stop the server first!")
+			fmt.Print("Are you sure you want to restore? (yes/no): ")
+			response, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("failed to read confirmation: %w", err)
+			}
+			if strings.TrimSpace(strings.ToLower(response)) != "yes" {
+				fmt.Println("Restore cancelled.")
+				return nil
+			}
+		}
+	}
+
+	stamp := time.Now().Format("20060102-150405")
+	for _, name := range databases {
+		target := filepath.Join(output, name+".db")
+		restored := target
+		if inPlace {
+			restored = target + ".pitr-" + stamp
+		}
+		result, err := backup.RestoreToTime(ctx, store, name, at, restored)
+		if err != nil {
+			return fmt.Errorf("%s database: %w", name, err)
+		}
+		if inPlace {
+			if _, err := os.Stat(target); err == nil {
+				if err := os.Rename(target, target+".pre-pitr-"+stamp); err != nil {
+					return err
+				}
+			}
+			// The old WAL belongs to the replaced database
+			os.Remove(target + "-wal")
+			os.Remove(target + "-shm")
+			if err := os.Rename(restored, target); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("✓ %s database restored to %s (generation %s, %d WAL segments) → %s\n",
+			name, result.RestoredTo.Local().Format(time.RFC3339), result.Generation, result.Segments, target)
+	}
+	return nil
+}
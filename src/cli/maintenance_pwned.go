@@ -0,0 +1,76 @@
+// Package cli - maintenance pwned command: breached password dataset import
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/apimgr/weather/src/paths"
+	"github.com/apimgr/weather/src/server/service"
+)
+
+// MaintenancePwnedCommand manages the local breached password dataset
+//
+//	--maintenance pwned import PATH
+//	--maintenance pwned status
+func MaintenancePwnedCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no pwned command specified. Use: import, status")
+	}
+
+	p := paths.GetDefaultPaths("weather")
+	if p == nil {
+		return fmt.Errorf("failed to get default paths")
+	}
+	if dataDir := os.Getenv("DATA_DIR"); dataDir != "" {
+		p.DataDir = dataDir
+	}
+	pwned := service.NewPwnedPasswordService(filepath.Join(p.DataDir, "pwned-passwords"))
+
+	switch args[0] {
+	case "import":
+		if len(args) < 2 {
+			return fmt.Errorf("import requires a path: a directory of range files or a SHA1:COUNT file")
+		}
+		return importPwnedPasswords(pwned, args[1])
+	case "status":
+		return pwnedPasswordStatus(pwned)
+	default:
+		return fmt.Errorf("unknown pwned command: %s", args[0])
+	}
+}
+
+func importPwnedPasswords(pwned *service.PwnedPasswordService, source string) error {
+	fmt.Println("🔐 Breached Password Import")
+	fmt.Printf("   Source: %s\n", source)
+	fmt.Printf("   Target: %s\n\n", pwned.Dir())
+
+	start := time.Now()
+	manifest, err := pwned.Import(source)
+	if err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+
+	fmt.Printf("✓ Imported %d hashes in %d ranges (%s)\n", manifest.Hashes, manifest.Ranges,
+		time.Since(start).Round(time.Second))
+	fmt.Println("  Restart the server to use the new dataset")
+	return nil
+}
+
+func pwnedPasswordStatus(pwned *service.PwnedPasswordService) error {
+	manifest := pwned.Manifest()
+	if manifest == nil {
+		fmt.Printf("No breached password dataset in %s\n", pwned.Dir())
+		fmt.Println("Import one with: weather --maintenance pwned import PATH")
+		return nil
+	}
+
+	fmt.Printf("Directory:  %s\n", pwned.Dir())
+	fmt.Printf("Source:     %s\n", manifest.Source)
+	fmt.Printf("Imported:   %s\n", manifest.ImportedAt.Format(time.RFC3339))
+	fmt.Printf("Hashes:     %d\n", manifest.Hashes)
+	fmt.Printf("Ranges:     %d\n", manifest.Ranges)
+	return nil
+}
@@ -0,0 +1,283 @@
+// Package cli - maintenance snapshot command: incremental, deduplicated backups
+package cli
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/apimgr/weather/src/backup"
+	"github.com/apimgr/weather/src/backup/objectstore"
+	"github.com/apimgr/weather/src/config"
+	"github.com/apimgr/weather/src/paths"
+	"golang.org/x/term"
+)
+
+// MaintenanceSnapshotCommand creates, lists, restores and prunes snapshots
+// in the deduplicating backup repository
+//
+//	--maintenance snapshot create [--set NAME]... [--target NAME] [--password P]
+//	--maintenance snapshot list [--target NAME]
+//	--maintenance snapshot ls ID|latest [--target NAME]
+//	--maintenance snapshot restore ID|latest [--set NAME]... [--path PATH]... [--yes]
+//	--maintenance snapshot restore-locations ID|latest --user USER_ID
+//	--maintenance snapshot forget [--target NAME]
+//
+// The repository lives on the target set by backup.incremental.target, or
+// in {data_dir}/backup/repository. It is encrypted with the backup
+// encryption password when one is configured
+func MaintenanceSnapshotCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no snapshot command specified. Use: create, list, ls, restore, restore-locations, forget")
+	}
+
+	action := args[0]
+	var id, targetName, password string
+	var sets, restorePaths []string
+	var userID int64
+	var yes, targetSet bool
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--set", "--path", "--target", "--password", "--user":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", args[i])
+			}
+			value := args[i+1]
+			i++
+			switch args[i-1] {
+			case "--set":
+				sets = append(sets, value)
+			case "--path":
+				restorePaths = append(restorePaths, value)
+			case "--target":
+				targetName, targetSet = value, true
+			case "--password":
+				password = value
+			case "--user":
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || n <= 0 {
+					return fmt.Errorf("invalid user id: %s", value)
+				}
+				userID = n
+			}
+		case "--yes":
+			yes = true
+		default:
+			if id == "" && !strings.HasPrefix(args[i], "--") {
+				id = args[i]
+				continue
+			}
+			return fmt.Errorf("unknown snapshot option: %s", args[i])
+		}
+	}
+
+	p := paths.GetDefaultPaths("weather")
+	if p == nil {
+		return fmt.Errorf("failed to get default paths")
+	}
+	if configDir := os.Getenv("CONFIG_DIR"); configDir != "" {
+		p.ConfigDir = configDir
+	}
+	if dataDir := os.Getenv("DATA_DIR"); dataDir != "" {
+		p.DataDir = dataDir
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load server.yml: %w", err)
+	}
+	backupCfg := cfg.Server.Maintenance.Backup
+	if !targetSet {
+		targetName = backupCfg.Incremental.Target
+	}
+
+	ctx := context.Background()
+	repo, err := openSnapshotRepository(ctx, backupCfg, targetName, p.DataDir, password)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "create":
+		if len(sets) == 0 {
+			sets = backupCfg.Incremental.Sets
+		}
+		fmt.Printf("🔄 Creating snapshot in %s...\n", repo)
+		result, err := repo.CreateSnapshot(ctx, backup.SnapshotOptions{
+			ConfigDir:  p.ConfigDir,
+			DataDir:    p.DataDir,
+			Sets:       sets,
+			CreatedBy:  "cli",
+			AppVersion: Version,
+		})
+		if err != nil {
+			return fmt.Errorf("snapshot failed: %w", err)
+		}
+		snap := result.Snapshot
+		fmt.Printf("✅ Snapshot %s: %d files, %.2f MB (%s)\n", snap.ID, len(snap.Files), float64(snap.Size)/1024/1024, strings.Join(snap.Sets, ", "))
+		fmt.Printf("📦 Stored %d new chunks (%.2f MB), reused %d; %d files unchanged\n",
+			result.NewChunks, float64(result.NewBytes)/1024/1024, result.ReusedChunks, result.UnchangedFiles)
+		return nil
+
+	case "list":
+		snapshots, err := repo.ListSnapshots(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Snapshots in %s:\n", repo)
+		if len(snapshots) == 0 {
+			fmt.Println("  none")
+		}
+		for _, snap := range snapshots {
+			fmt.Printf("  %s  %s  %4d files  %10.2f MB  %s\n", snap.ID, snap.CreatedAt.Local().Format(time.RFC3339),
+				len(snap.Files), float64(snap.Size)/1024/1024, strings.Join(snap.Sets, ","))
+		}
+		return nil
+
+	case "ls":
+		snap, err := repo.GetSnapshot(ctx, snapshotID(id))
+		if err != nil {
+			return err
+		}
+		for _, f := range snap.Files {
+			fmt.Printf("%s  %10d  %s  %s\n", f.Mode, f.Size, f.ModTime.Local().Format(time.RFC3339), f.Path)
+		}
+		return nil
+
+	case "restore":
+		if !yes {
+			fmt.Println("⚠️  WARNING: This overwrites the selected files. Stop the server first when restoring databases!")
+			fmt.Print("Are you sure you want to restore? (yes/no): ")
+			response, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("failed to read confirmation: %w", err)
+			}
+			if strings.TrimSpace(strings.ToLower(response)) != "yes" {
+				fmt.Println("Restore cancelled.")
+				return nil
+			}
+		}
+		restored, err := repo.RestoreSnapshot(ctx, snapshotID(id), backup.SnapshotRestoreOptions{
+			ConfigDir: p.ConfigDir,
+			DataDir:   p.DataDir,
+			Sets:      sets,
+			Paths:     restorePaths,
+		})
+		for _, path := range restored {
+			fmt.Printf("✓ %s\n", path)
+		}
+		if err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+		fmt.Printf("✅ Restored %d files\n", len(restored))
+		return nil
+
+	case "restore-locations":
+		if userID == 0 {
+			return fmt.Errorf("restore-locations requires --user USER_ID")
+		}
+		db, err := sql.Open("sqlite", filepath.Join(p.DataDir, "db", "users.db")+"?_pragma=busy_timeout(5000)")
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		n, err := repo.RestoreUserLocations(ctx, snapshotID(id), userID, db)
+		if err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+		fmt.Printf("✅ Restored %d saved locations of user %d\n", n, userID)
+		return nil
+
+	case "forget":
+		policy := backup.RetentionPolicy{
+			Hourly:  backupCfg.Retention.Hourly,
+			Daily:   backupCfg.Retention.Daily,
+			Weekly:  backupCfg.Retention.Weekly,
+			Monthly: backupCfg.Retention.Monthly,
+		}
+		result, err := repo.Forget(ctx, policy)
+		if err != nil {
+			return err
+		}
+		for _, id := range result.Snapshots {
+			fmt.Printf("🗑  %s\n", id)
+		}
+		fmt.Printf("✅ Forgot %d snapshots, freed %d chunks (%.2f MB)\n", len(result.Snapshots), result.Chunks, float64(result.Bytes)/1024/1024)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown snapshot command: %s", action)
+	}
+}
+
+func snapshotID(id string) string {
+	if id == "" {
+		return "latest"
+	}
+	return id
+}
+
+// openSnapshotRepository opens the repository on the target called
+// targetName, or the local one. Without a password the configured backup
+// encryption password is used, and the user is asked when that fails
+func openSnapshotRepository(ctx context.Context, backupCfg config.BackupConfig, targetName, dataDir, password string) (*backup.Repository, error) {
+	var store objectstore.Store
+	prefix := backup.RepositoryPrefix
+	if targetName != "" {
+		target, ok := backupCfg.FindTarget(targetName)
+		if !ok {
+			return nil, fmt.Errorf("no backup target named %q in server.yml", targetName)
+		}
+		s, err := objectstore.Open(target.ObjectStore())
+		if err != nil {
+			return nil, fmt.Errorf("backup target %s: %w", targetName, err)
+		}
+		store = s
+	} else {
+		dir := backup.LocalRepositoryDir(dataDir)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		s, err := objectstore.NewFile(dir)
+		if err != nil {
+			return nil, err
+		}
+		store, prefix = s, ""
+	}
+
+	prompt := password == ""
+	if prompt {
+		password = configuredBackupPassword(dataDir)
+	}
+	repo, err := backup.OpenRepository(ctx, store, prefix, password)
+	if errors.Is(err, backup.ErrWrongPassword) && prompt {
+		fmt.Print("Repository password: ")
+		passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
+		fmt.Println()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password: %w", err)
+		}
+		return backup.OpenRepository(ctx, store, prefix, string(passwordBytes))
+	}
+	return repo, err
+}
+
+// configuredBackupPassword reads the backup encryption password the
+// scheduler uses from the server database
+func configuredBackupPassword(dataDir string) string {
+	db, err := sql.Open("sqlite", filepath.Join(dataDir, "db", "server.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return ""
+	}
+	defer db.Close()
+	var password string
+	_ = db.QueryRow("SELECT value FROM server_config WHERE key = 'backup.encryption_password'").Scan(&password)
+	return password
+}
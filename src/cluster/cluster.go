@@ -38,6 +38,7 @@ type ClusterManager struct {
 	heartbeatTick *time.Ticker
 	stopChan      chan struct{}
 	enabled       bool
+	configSync    *ConfigSync
 }
 
 // NewClusterManager creates a new cluster manager
@@ -54,6 +55,16 @@ func NewClusterManager(db *sql.DB, nodeID, nodeAddress string, enabled bool) *Cl
 	}
 }
 
+// SetConfigSync attaches config replication (call before Start)
+func (cm *ClusterManager) SetConfigSync(configSync *ConfigSync) {
+	cm.configSync = configSync
+}
+
+// NodeID returns this node's ID
+func (cm *ClusterManager) NodeID() string {
+	return cm.nodeID
+}
+
 // Start initializes and starts the cluster manager
 // TEMPLATE.md PART 23: Starts heartbeat, election, and config sync processes
 func (cm *ClusterManager) Start() error {
@@ -65,16 +76,18 @@ func (cm *ClusterManager) Start() error {
 
 	log.Println("[INFO] Starting cluster manager...")
 
-	// Initialize cluster tables
-	if err := cm.initializeClusterTables(); err != nil {
-		return fmt.Errorf("failed to initialize cluster tables: %w", err)
-	}
-
-	// Register this node
+	// Register this node; cluster_nodes is created by the server migrations
 	if err := cm.registerNode(); err != nil {
 		return fmt.Errorf("failed to register node: %w", err)
 	}
 
+	// Reconcile configuration with the cluster on first join
+	if cm.configSync != nil {
+		if err := cm.configSync.Join(cm.configSync.JoinURL()); err != nil {
+			log.Printf("[WARN] Config reconcile on join failed: %v", err)
+		}
+	}
+
 	// Start heartbeat (30 second interval per TEMPLATE.md)
 	cm.heartbeatTick = time.NewTicker(30 * time.Second)
 	go cm.heartbeatLoop()
@@ -134,6 +147,10 @@ func (cm *ClusterManager) heartbeatLoop() {
 				log.Printf("[WARN] Cluster health check failed: %v", err)
 			}
 
+			if err := cm.SyncConfig(); err != nil {
+				log.Printf("[WARN] Config sync failed: %v", err)
+			}
+
 		case <-cm.stopChan:
 			return
 		}
@@ -267,16 +284,22 @@ func (cm *ClusterManager) SyncConfig() error {
 	return cm.pushConfigToSecondaries()
 }
 
-// pullConfigFromPrimary pulls configuration from the primary node
+// pullConfigFromPrimary pulls configuration changes from the primary node
+// and sends local edits back, so changes made on a secondary reach the
+// primary and through it every other node
 func (cm *ClusterManager) pullConfigFromPrimary() error {
+	if cm.configSync == nil {
+		return nil
+	}
+
 	// Get primary node address
 	var primaryAddress string
 	err := cm.db.QueryRow(`
 		SELECT address
 		FROM cluster_nodes
-		WHERE state = 'primary' AND is_healthy = 1
+		WHERE state = 'primary' AND is_healthy = 1 AND node_id != ?
 		LIMIT 1
-	`).Scan(&primaryAddress)
+	`, cm.nodeID).Scan(&primaryAddress)
 
 	if err == sql.ErrNoRows {
 		return fmt.Errorf("no healthy primary node found")
@@ -285,48 +308,36 @@ func (cm *ClusterManager) pullConfigFromPrimary() error {
 		return fmt.Errorf("failed to get primary address: %w", err)
 	}
 
-	// Get all server_config settings from local database
-	rows, err := cm.db.Query(`
-		SELECT key, value, type, description
-		FROM server_config
-		ORDER BY updated_at DESC
-	`)
+	applied, err := cm.configSync.PullFrom(primaryAddress)
 	if err != nil {
-		return fmt.Errorf("failed to query config: %w", err)
+		return fmt.Errorf("failed to pull config from primary %s: %w", primaryAddress, err)
 	}
-	defer rows.Close()
-
-	syncCount := 0
-	for rows.Next() {
-		var key, value, typ, description string
-		if err := rows.Scan(&key, &value, &typ, &description); err != nil {
-			continue
-		}
-
-		// In a real implementation, this would fetch from primary via HTTP
-		// For now, we sync from shared database which works for database-backed clusters
-		syncCount++
+	if applied > 0 {
+		log.Printf("[INFO] Config sync: Applied %d change(s) from primary %s", applied, primaryAddress)
 	}
 
-	if syncCount > 0 {
-		log.Printf("[INFO] Config sync: Synced %d settings from primary %s", syncCount, primaryAddress)
+	if err := cm.configSync.PushTo(primaryAddress); err != nil {
+		return fmt.Errorf("failed to push config to primary %s: %w", primaryAddress, err)
 	}
 
 	return nil
 }
 
-// pushConfigToSecondaries pushes configuration to secondary nodes
+// pushConfigToSecondaries pushes configuration changes to secondary nodes
 func (cm *ClusterManager) pushConfigToSecondaries() error {
+	if cm.configSync == nil {
+		return nil
+	}
+
 	// Get all healthy secondary nodes
 	rows, err := cm.db.Query(`
 		SELECT node_id, address
 		FROM cluster_nodes
-		WHERE state = 'secondary' AND is_healthy = 1
-	`)
+		WHERE state = 'secondary' AND is_healthy = 1 AND node_id != ? AND address != ''
+	`, cm.nodeID)
 	if err != nil {
 		return fmt.Errorf("failed to query secondary nodes: %w", err)
 	}
-	defer rows.Close()
 
 	var secondaries []struct {
 		NodeID  string
@@ -343,54 +354,23 @@ func (cm *ClusterManager) pushConfigToSecondaries() error {
 		}
 		secondaries = append(secondaries, s)
 	}
+	rows.Close()
 
-	if len(secondaries) == 0 {
-		// No secondaries to sync to
-		return nil
-	}
-
-	// Get all config settings to push
-	configRows, err := cm.db.Query(`
-		SELECT key, value, type, description, updated_at
-		FROM server_config
-		ORDER BY key
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to query config: %w", err)
-	}
-	defer configRows.Close()
-
-	configCount := 0
-	for configRows.Next() {
-		configCount++
+	// Secondaries send their own edits when they pull, so only push here
+	failed := 0
+	for _, secondary := range secondaries {
+		if err := cm.configSync.PushTo(secondary.Address); err != nil {
+			log.Printf("[WARN] Config sync: push to %s failed: %v", secondary.NodeID, err)
+			failed++
+		}
 	}
 
-	if configCount > 0 {
-		log.Printf("[INFO] Config sync: Broadcasting %d settings to %d secondary node(s)", configCount, len(secondaries))
+	if failed > 0 {
+		return fmt.Errorf("config push failed for %d of %d secondary node(s)", failed, len(secondaries))
 	}
-
-	// In a real HTTP-based cluster, we would POST to each secondary's /cluster/config endpoint
-	// For database-backed clusters, the shared database already provides consistency
-
 	return nil
 }
 
-// initializeClusterTables creates cluster-related database tables
-func (cm *ClusterManager) initializeClusterTables() error {
-	_, err := cm.db.Exec(`
-		CREATE TABLE IF NOT EXISTS cluster_nodes (
-			node_id TEXT PRIMARY KEY,
-			address TEXT NOT NULL,
-			state TEXT NOT NULL DEFAULT 'secondary',
-			last_heartbeat TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			is_healthy INTEGER NOT NULL DEFAULT 1,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	return err
-}
-
 // registerNode registers this node in the cluster
 func (cm *ClusterManager) registerNode() error {
 	_, err := cm.db.Exec(`
@@ -0,0 +1,826 @@
+package cluster
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Kinds of replicated configuration items
+const (
+	KindSetting     = "setting"
+	KindTemplate    = "template"
+	KindChannel     = "channel"
+	KindCertificate = "certificate"
+)
+
+// Settings that describe this node rather than the cluster; never replicated
+var nodeLocalSettings = map[string]bool{
+	"cluster.secret":        true,
+	"cluster.advertise_url": true,
+	"cluster.join_url":      true,
+	"cluster.tls.ca_file":   true,
+	"cluster.tls.cert_file": true,
+	"cluster.tls.key_file":  true,
+}
+
+// Maximum changes returned in one change set
+const changeSetLimit = 500
+
+// Change is one versioned update (or deletion) of a configuration item
+type Change struct {
+	ID        string          `json:"id"`
+	Seq       int64           `json:"seq"`
+	Origin    string          `json:"origin"`
+	Kind      string          `json:"kind"`
+	Key       string          `json:"key"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Deleted   bool            `json:"deleted"`
+	Version   VectorClock     `json:"version"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// ChangeSet is a batch of changes exchanged between nodes, together with the
+// sender's view of cluster membership
+type ChangeSet struct {
+	From    string   `json:"from"`
+	Changes []Change `json:"changes"`
+	// Highest sequence number included; the receiver's next cursor
+	Next  int64      `json:"next"`
+	More  bool       `json:"more"`
+	Nodes []NodeInfo `json:"nodes,omitempty"`
+}
+
+// NodeInfo is a cluster member as known by the sending node
+type NodeInfo struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+}
+
+// DigestEntry summarises the current version of one item
+type DigestEntry struct {
+	Kind    string      `json:"kind"`
+	Key     string      `json:"key"`
+	Digest  string      `json:"digest"`
+	Deleted bool        `json:"deleted"`
+	Version VectorClock `json:"version"`
+}
+
+// Item payloads. Fields are fixed so encoding is canonical and digests match
+// on every node.
+type settingPayload struct {
+	Value       string `json:"value"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+type templatePayload struct {
+	ChannelType  string `json:"channel_type"`
+	TemplateName string `json:"template_name"`
+	TemplateType string `json:"template_type"`
+	Subject      string `json:"subject"`
+	Body         string `json:"body"`
+	Variables    string `json:"variables"`
+}
+
+type channelPayload struct {
+	ChannelType string `json:"channel_type"`
+	ChannelName string `json:"channel_name"`
+	Enabled     bool   `json:"enabled"`
+	Config      string `json:"config"`
+}
+
+type certificatePayload struct {
+	Domain    string `json:"domain"`
+	CertPEM   string `json:"cert_pem"`
+	KeyPEM    string `json:"key_pem"`
+	AutoRenew bool   `json:"auto_renew"`
+}
+
+// syncItem is the current local state of a replicated item
+type syncItem struct {
+	Kind    string
+	Key     string
+	Payload json.RawMessage
+}
+
+// itemVersion is a row of server_config_versions
+type itemVersion struct {
+	Version   VectorClock
+	Digest    string
+	Deleted   bool
+	Origin    string
+	UpdatedAt time.Time
+}
+
+// ConfigSyncOptions configures node-to-node config replication
+type ConfigSyncOptions struct {
+	NodeID string
+	// Base URL other nodes use to reach this node (e.g. https://node1:8443)
+	AdvertiseURL string
+	// Existing node to reconcile with when this node first joins
+	JoinURL string
+	// Shared cluster secret for HMAC request signing
+	Secret string
+	// Optional mutual TLS between nodes
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	// Where replicated certificates are written when no path is recorded
+	SSLDir string
+	// API prefix of the sync endpoints (default /api/v1)
+	APIPath string
+}
+
+// ConfigSync replicates server settings, notification templates, channel
+// configurations and SSL certificates between cluster nodes. Local edits are
+// detected by comparing table contents with the recorded versions; each edit
+// becomes a change with a vector clock. Concurrent edits are resolved by
+// updated_at, then by origin node ID.
+type ConfigSync struct {
+	db     *sql.DB
+	opts   ConfigSyncOptions
+	auth   *syncAuth
+	client *http.Client
+	mu     sync.Mutex
+}
+
+// NewConfigSync creates the replicator for the server database
+func NewConfigSync(db *sql.DB, opts ConfigSyncOptions) (*ConfigSync, error) {
+	if opts.APIPath == "" {
+		opts.APIPath = "/api/v1"
+	}
+	auth, err := newSyncAuth(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ConfigSync{
+		db:     db,
+		opts:   opts,
+		auth:   auth,
+		client: auth.httpClient(),
+	}, nil
+}
+
+// NodeID returns this node's ID
+func (s *ConfigSync) NodeID() string {
+	return s.opts.NodeID
+}
+
+// Scan records a change for every item edited locally since the last scan
+// and returns the number of changes recorded
+func (s *ConfigSync) Scan() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scan()
+}
+
+func (s *ConfigSync) scan() (int, error) {
+	items, skipped, err := s.snapshot()
+	if err != nil {
+		return 0, err
+	}
+	versions, err := s.loadVersions()
+	if err != nil {
+		return 0, err
+	}
+
+	recorded := 0
+	now := time.Now().UTC()
+	for id, item := range items {
+		digest := payloadDigest(item.Payload)
+		current, ok := versions[id]
+		if ok && !current.Deleted && current.Digest == digest {
+			continue
+		}
+		change := &Change{
+			ID:        ulid.Make().String(),
+			Origin:    s.opts.NodeID,
+			Kind:      item.Kind,
+			Key:       item.Key,
+			Payload:   item.Payload,
+			Version:   current.Version.Increment(s.opts.NodeID),
+			UpdatedAt: now,
+		}
+		if err := s.record(change, change.Version); err != nil {
+			return recorded, err
+		}
+		recorded++
+	}
+
+	for id, current := range versions {
+		if _, ok := items[id]; ok || current.Deleted || skipped[id] {
+			continue
+		}
+		kind, key := splitItemID(id)
+		change := &Change{
+			ID:        ulid.Make().String(),
+			Origin:    s.opts.NodeID,
+			Kind:      kind,
+			Key:       key,
+			Deleted:   true,
+			Version:   current.Version.Increment(s.opts.NodeID),
+			UpdatedAt: now,
+		}
+		if err := s.record(change, change.Version); err != nil {
+			return recorded, err
+		}
+		recorded++
+	}
+
+	return recorded, nil
+}
+
+// ChangesSince returns changes recorded after seq
+func (s *ConfigSync) ChangesSince(seq int64) (*ChangeSet, error) {
+	if _, err := s.Scan(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT seq, change_id, origin_node, kind, item_key, payload, deleted, version, updated_at
+		FROM server_config_changes
+		WHERE seq > ?
+		ORDER BY seq
+		LIMIT ?
+	`, seq, changeSetLimit+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	set := &ChangeSet{From: s.opts.NodeID, Next: seq}
+	for rows.Next() {
+		var change Change
+		var payload sql.NullString
+		var version string
+		if err := rows.Scan(&change.Seq, &change.ID, &change.Origin, &change.Kind, &change.Key,
+			&payload, &change.Deleted, &version, &change.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if len(set.Changes) == changeSetLimit {
+			set.More = true
+			break
+		}
+		if payload.Valid {
+			change.Payload = json.RawMessage(payload.String)
+		}
+		change.Version = parseVectorClock(version)
+		set.Changes = append(set.Changes, change)
+		set.Next = change.Seq
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	set.Nodes = s.knownNodes()
+	return set, nil
+}
+
+// ApplyChangeSet applies changes received from another node and returns the
+// number that changed local state. With adopt set (first join) the remote
+// side wins every conflict.
+func (s *ConfigSync) ApplyChangeSet(set *ChangeSet, adopt bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Version local edits first so they take part in conflict resolution
+	if !adopt {
+		if _, err := s.scan(); err != nil {
+			return 0, err
+		}
+	}
+
+	applied := 0
+	for i := range set.Changes {
+		ok, err := s.apply(&set.Changes[i], adopt)
+		if err != nil {
+			return applied, fmt.Errorf("change %s (%s %s): %w", set.Changes[i].ID, set.Changes[i].Kind, set.Changes[i].Key, err)
+		}
+		if ok {
+			applied++
+		}
+	}
+	s.learnNodes(set.Nodes)
+	return applied, nil
+}
+
+// apply resolves one incoming change against the local version
+func (s *ConfigSync) apply(change *Change, adopt bool) (bool, error) {
+	if change.Origin == s.opts.NodeID {
+		return false, nil
+	}
+	if change.Kind == KindSetting && nodeLocalSettings[change.Key] {
+		return false, nil
+	}
+
+	current, exists, err := s.loadVersion(change.Kind, change.Key)
+	if err != nil {
+		return false, err
+	}
+
+	merged := change.Version
+	if exists {
+		merged = change.Version.Merge(current.Version)
+		switch change.Version.Compare(current.Version) {
+		case ClockEqual, ClockBefore:
+			return false, nil
+		case ClockConcurrent:
+			if !adopt && !changeWins(change, current) {
+				// Keep the local value but remember the remote history, so
+				// the next local edit supersedes both
+				_, err := s.db.Exec(`
+					UPDATE server_config_versions SET version = ?
+					WHERE kind = ? AND item_key = ?
+				`, merged.String(), change.Kind, change.Key)
+				return false, err
+			}
+		}
+	}
+
+	payload, err := s.writeItem(change)
+	if err != nil {
+		return false, err
+	}
+	change.Payload = payload
+	return true, s.record(change, merged)
+}
+
+// changeWins decides a conflict between concurrent versions: the later edit
+// wins, ties go to the higher node ID so every node picks the same winner
+func changeWins(change *Change, current itemVersion) bool {
+	if !change.UpdatedAt.Equal(current.UpdatedAt) {
+		return change.UpdatedAt.After(current.UpdatedAt)
+	}
+	return change.Origin > current.Origin
+}
+
+// record stores the change in the log (replacing older changes to the same
+// item) and the item's new version
+func (s *ConfigSync) record(change *Change, version VectorClock) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var payload interface{}
+	digest := ""
+	if !change.Deleted {
+		payload = string(change.Payload)
+		digest = payloadDigest(change.Payload)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM server_config_changes WHERE kind = ? AND item_key = ?`, change.Kind, change.Key); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO server_config_changes (change_id, origin_node, kind, item_key, payload, deleted, version, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, change.ID, change.Origin, change.Kind, change.Key, payload, change.Deleted, change.Version.String(), change.UpdatedAt.UTC()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO server_config_versions (kind, item_key, version, digest, deleted, origin_node, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(kind, item_key) DO UPDATE SET
+			version = excluded.version,
+			digest = excluded.digest,
+			deleted = excluded.deleted,
+			origin_node = excluded.origin_node,
+			updated_at = excluded.updated_at
+	`, change.Kind, change.Key, version.String(), digest, change.Deleted, change.Origin, change.UpdatedAt.UTC()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Digest returns the current version of every replicated item
+func (s *ConfigSync) Digest() ([]DigestEntry, error) {
+	if _, err := s.Scan(); err != nil {
+		return nil, err
+	}
+	versions, err := s.loadVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]DigestEntry, 0, len(versions))
+	for id, v := range versions {
+		kind, key := splitItemID(id)
+		entries = append(entries, DigestEntry{Kind: kind, Key: key, Digest: v.Digest, Deleted: v.Deleted, Version: v.Version})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries, nil
+}
+
+func (s *ConfigSync) loadVersions() (map[string]itemVersion, error) {
+	rows, err := s.db.Query(`SELECT kind, item_key, version, digest, deleted, COALESCE(origin_node, ''), updated_at FROM server_config_versions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[string]itemVersion)
+	for rows.Next() {
+		var kind, key, version string
+		var v itemVersion
+		if err := rows.Scan(&kind, &key, &version, &v.Digest, &v.Deleted, &v.Origin, &v.UpdatedAt); err != nil {
+			return nil, err
+		}
+		v.Version = parseVectorClock(version)
+		versions[itemID(kind, key)] = v
+	}
+	return versions, rows.Err()
+}
+
+func (s *ConfigSync) loadVersion(kind, key string) (itemVersion, bool, error) {
+	var v itemVersion
+	var version string
+	err := s.db.QueryRow(`
+		SELECT version, digest, deleted, COALESCE(origin_node, ''), updated_at
+		FROM server_config_versions
+		WHERE kind = ? AND item_key = ?
+	`, kind, key).Scan(&version, &v.Digest, &v.Deleted, &v.Origin, &v.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return v, false, nil
+	}
+	if err != nil {
+		return v, false, err
+	}
+	v.Version = parseVectorClock(version)
+	return v, true, nil
+}
+
+// snapshot reads every replicated item from its table. Certificates whose
+// files cannot be read are reported as skipped, not deleted.
+func (s *ConfigSync) snapshot() (map[string]syncItem, map[string]bool, error) {
+	items := make(map[string]syncItem)
+	skipped := make(map[string]bool)
+	add := func(kind, key string, payload interface{}) error {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		items[itemID(kind, key)] = syncItem{Kind: kind, Key: key, Payload: data}
+		return nil
+	}
+
+	// Settings
+	rows, err := s.db.Query(`SELECT key, COALESCE(value, ''), COALESCE(type, 'string'), COALESCE(description, '') FROM server_config`)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var key string
+		var p settingPayload
+		if err := rows.Scan(&key, &p.Value, &p.Type, &p.Description); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		if nodeLocalSettings[key] {
+			continue
+		}
+		if err := add(KindSetting, key, p); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+	}
+	rows.Close()
+
+	// Notification templates
+	rows, err = s.db.Query(`
+		SELECT channel_type, template_name, template_type, COALESCE(subject, ''), body, COALESCE(variables, '')
+		FROM server_notification_templates
+	`)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var p templatePayload
+		if err := rows.Scan(&p.ChannelType, &p.TemplateName, &p.TemplateType, &p.Subject, &p.Body, &p.Variables); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		if err := add(KindTemplate, templateKey(p.ChannelType, p.TemplateName, p.TemplateType), p); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+	}
+	rows.Close()
+
+	// Notification channels (configuration only, not test/delivery state)
+	rows, err = s.db.Query(`SELECT channel_type, channel_name, COALESCE(enabled, 0), COALESCE(config, '') FROM server_notification_channels`)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var p channelPayload
+		if err := rows.Scan(&p.ChannelType, &p.ChannelName, &p.Enabled, &p.Config); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		if err := add(KindChannel, p.ChannelType, p); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+	}
+	rows.Close()
+
+	// SSL certificates, including the PEM files they point to
+	rows, err = s.db.Query(`SELECT domain, cert_path, key_path, COALESCE(auto_renew, 1) FROM server_ssl_certificates`)
+	if err != nil {
+		return nil, nil, err
+	}
+	type certRow struct {
+		domain, certPath, keyPath string
+		autoRenew                 bool
+	}
+	var certs []certRow
+	for rows.Next() {
+		var r certRow
+		if err := rows.Scan(&r.domain, &r.certPath, &r.keyPath, &r.autoRenew); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		certs = append(certs, r)
+	}
+	rows.Close()
+
+	for _, r := range certs {
+		certPEM, certErr := os.ReadFile(r.certPath)
+		keyPEM, keyErr := os.ReadFile(r.keyPath)
+		if certErr != nil || keyErr != nil {
+			skipped[itemID(KindCertificate, r.domain)] = true
+			continue
+		}
+		if err := add(KindCertificate, r.domain, certificatePayload{
+			Domain:    r.domain,
+			CertPEM:   string(certPEM),
+			KeyPEM:    string(keyPEM),
+			AutoRenew: r.autoRenew,
+		}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return items, skipped, nil
+}
+
+// writeItem applies a change to its table and returns the canonical payload
+func (s *ConfigSync) writeItem(change *Change) (json.RawMessage, error) {
+	updatedBy := "cluster:" + change.Origin
+
+	switch change.Kind {
+	case KindSetting:
+		if nodeLocalSettings[change.Key] {
+			return nil, fmt.Errorf("setting %s is node-local", change.Key)
+		}
+		if change.Deleted {
+			_, err := s.db.Exec(`DELETE FROM server_config WHERE key = ?`, change.Key)
+			return nil, err
+		}
+		var p settingPayload
+		if err := json.Unmarshal(change.Payload, &p); err != nil {
+			return nil, err
+		}
+		_, err := s.db.Exec(`
+			INSERT INTO server_config (key, value, type, description, updated_at, updated_by)
+			VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
+			ON CONFLICT(key) DO UPDATE SET
+				value = excluded.value,
+				type = excluded.type,
+				description = excluded.description,
+				updated_at = CURRENT_TIMESTAMP,
+				updated_by = excluded.updated_by
+		`, change.Key, p.Value, p.Type, p.Description, updatedBy)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(p)
+
+	case KindTemplate:
+		if change.Deleted {
+			parts := strings.SplitN(change.Key, "/", 3)
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("invalid template key %q", change.Key)
+			}
+			_, err := s.db.Exec(`
+				DELETE FROM server_notification_templates
+				WHERE channel_type = ? AND template_name = ? AND template_type = ?
+			`, parts[0], parts[1], parts[2])
+			return nil, err
+		}
+		var p templatePayload
+		if err := json.Unmarshal(change.Payload, &p); err != nil {
+			return nil, err
+		}
+		_, err := s.db.Exec(`
+			INSERT INTO server_notification_templates (channel_type, template_name, template_type, subject, body, variables, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(channel_type, template_name, template_type) DO UPDATE SET
+				subject = excluded.subject,
+				body = excluded.body,
+				variables = excluded.variables,
+				updated_at = CURRENT_TIMESTAMP
+		`, p.ChannelType, p.TemplateName, p.TemplateType, p.Subject, p.Body, p.Variables)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(p)
+
+	case KindChannel:
+		if change.Deleted {
+			_, err := s.db.Exec(`DELETE FROM server_notification_channels WHERE channel_type = ?`, change.Key)
+			return nil, err
+		}
+		var p channelPayload
+		if err := json.Unmarshal(change.Payload, &p); err != nil {
+			return nil, err
+		}
+		state := "disabled"
+		if p.Enabled {
+			state = "enabled"
+		}
+		_, err := s.db.Exec(`
+			INSERT INTO server_notification_channels (channel_type, channel_name, enabled, state, config, updated_at)
+			VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(channel_type) DO UPDATE SET
+				channel_name = excluded.channel_name,
+				enabled = excluded.enabled,
+				state = CASE WHEN server_notification_channels.state IN ('failed', 'testing') AND excluded.enabled
+					THEN server_notification_channels.state ELSE excluded.state END,
+				config = excluded.config,
+				updated_at = CURRENT_TIMESTAMP
+		`, p.ChannelType, p.ChannelName, p.Enabled, state, p.Config)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(p)
+
+	case KindCertificate:
+		if change.Deleted {
+			// Files are left in place so a running listener keeps working
+			_, err := s.db.Exec(`DELETE FROM server_ssl_certificates WHERE domain = ?`, change.Key)
+			return nil, err
+		}
+		var p certificatePayload
+		if err := json.Unmarshal(change.Payload, &p); err != nil {
+			return nil, err
+		}
+		if err := s.writeCertificate(p); err != nil {
+			return nil, err
+		}
+		return json.Marshal(p)
+	}
+
+	return nil, fmt.Errorf("unknown item kind %q", change.Kind)
+}
+
+// writeCertificate stores the PEM files (at the recorded paths, or under the
+// SSL directory) and updates the certificate row from the certificate itself
+func (s *ConfigSync) writeCertificate(p certificatePayload) error {
+	block, _ := pem.Decode([]byte(p.CertPEM))
+	if block == nil {
+		return fmt.Errorf("invalid certificate PEM for %s", p.Domain)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid certificate for %s: %w", p.Domain, err)
+	}
+
+	var certPath, keyPath string
+	err = s.db.QueryRow(`SELECT cert_path, key_path FROM server_ssl_certificates WHERE domain = ?`, p.Domain).Scan(&certPath, &keyPath)
+	if err == sql.ErrNoRows {
+		if s.opts.SSLDir == "" {
+			return fmt.Errorf("no SSL directory configured for %s", p.Domain)
+		}
+		dir := filepath.Join(s.opts.SSLDir, filepath.Base(p.Domain))
+		certPath = filepath.Join(dir, "cert.pem")
+		keyPath = filepath.Join(dir, "key.pem")
+	} else if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certPath, []byte(p.CertPEM), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, []byte(p.KeyPEM), 0600); err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO server_ssl_certificates (domain, cert_path, key_path, issuer, subject, serial_number, not_before, not_after, auto_renew, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(domain) DO UPDATE SET
+			cert_path = excluded.cert_path,
+			key_path = excluded.key_path,
+			issuer = excluded.issuer,
+			subject = excluded.subject,
+			serial_number = excluded.serial_number,
+			not_before = excluded.not_before,
+			not_after = excluded.not_after,
+			auto_renew = excluded.auto_renew,
+			updated_at = CURRENT_TIMESTAMP
+	`, p.Domain, certPath, keyPath, cert.Issuer.String(), cert.Subject.String(), cert.SerialNumber.String(),
+		cert.NotBefore, cert.NotAfter, p.AutoRenew)
+	return err
+}
+
+// knownNodes returns this node and the peers it knows about
+func (s *ConfigSync) knownNodes() []NodeInfo {
+	nodes := []NodeInfo{{ID: s.opts.NodeID, Address: s.opts.AdvertiseURL}}
+	rows, err := s.db.Query(`SELECT node_id, address FROM cluster_nodes WHERE node_id != ? AND address != ''`, s.opts.NodeID)
+	if err != nil {
+		return nodes
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n NodeInfo
+		if rows.Scan(&n.ID, &n.Address) == nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// learnNodes adds peers reported by another node to cluster_nodes. Their
+// health is only set by direct contact (TouchNode).
+func (s *ConfigSync) learnNodes(nodes []NodeInfo) {
+	for _, n := range nodes {
+		if n.ID == "" || n.ID == s.opts.NodeID || n.Address == "" {
+			continue
+		}
+		_, err := s.db.Exec(`
+			INSERT INTO cluster_nodes (node_id, address, state, last_heartbeat, is_healthy)
+			VALUES (?, ?, 'secondary', ?, 0)
+			ON CONFLICT(node_id) DO UPDATE SET address = excluded.address
+		`, n.ID, n.Address, time.Time{})
+		if err != nil {
+			log.Printf("[WARN] Config sync: failed to record node %s: %v", n.ID, err)
+		}
+	}
+}
+
+// TouchNode records a successful exchange with a node
+func (s *ConfigSync) TouchNode(nodeID, address string) {
+	if nodeID == "" || nodeID == s.opts.NodeID {
+		return
+	}
+	_, err := s.db.Exec(`
+		INSERT INTO cluster_nodes (node_id, address, state, last_heartbeat, is_healthy)
+		VALUES (?, ?, 'secondary', ?, 1)
+		ON CONFLICT(node_id) DO UPDATE SET
+			address = CASE WHEN excluded.address != '' THEN excluded.address ELSE cluster_nodes.address END,
+			last_heartbeat = excluded.last_heartbeat,
+			is_healthy = 1,
+			updated_at = CURRENT_TIMESTAMP
+	`, nodeID, address, time.Now())
+	if err != nil {
+		log.Printf("[WARN] Config sync: failed to update node %s: %v", nodeID, err)
+	}
+}
+
+func itemID(kind, key string) string {
+	return kind + "\x00" + key
+}
+
+func splitItemID(id string) (string, string) {
+	kind, key, _ := strings.Cut(id, "\x00")
+	return kind, key
+}
+
+func templateKey(channelType, name, templateType string) string {
+	return channelType + "/" + name + "/" + templateType
+}
+
+func payloadDigest(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,293 @@
+package cluster
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+	_ "modernc.org/sqlite"
+)
+
+var syncDBCounter int64
+
+// newTestSync creates a ConfigSync on its own in-memory server database
+func newTestSync(t *testing.T, nodeID, secret string) *ConfigSync {
+	t.Helper()
+
+	name := fmt.Sprintf("file:configsync_%d?mode=memory&cache=shared", atomic.AddInt64(&syncDBCounter, 1))
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := database.MigrateDatabase(db, database.DialectSQLite, database.MigrationsServer, nil); err != nil {
+		t.Fatalf("Failed to migrate server database: %v", err)
+	}
+
+	s, err := NewConfigSync(db, ConfigSyncOptions{NodeID: nodeID, Secret: secret, SSLDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewConfigSync failed: %v", err)
+	}
+	return s
+}
+
+func setSetting(t *testing.T, s *ConfigSync, key, value string) {
+	t.Helper()
+	_, err := s.db.Exec(`
+		INSERT INTO server_config (key, value, type) VALUES (?, ?, 'string')
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, key, value)
+	if err != nil {
+		t.Fatalf("Failed to set %s: %v", key, err)
+	}
+}
+
+func getSetting(t *testing.T, s *ConfigSync, key string) (string, bool) {
+	t.Helper()
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM server_config WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false
+	}
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", key, err)
+	}
+	return value, true
+}
+
+// exchange sends every change from one node to another
+func exchange(t *testing.T, from, to *ConfigSync, adopt bool) int {
+	t.Helper()
+	set, err := from.ChangesSince(0)
+	if err != nil {
+		t.Fatalf("ChangesSince failed: %v", err)
+	}
+	applied, err := to.ApplyChangeSet(set, adopt)
+	if err != nil {
+		t.Fatalf("ApplyChangeSet failed: %v", err)
+	}
+	return applied
+}
+
+func TestConfigSync_ReplicatesSettings(t *testing.T) {
+	a := newTestSync(t, "node-a", "secret")
+	b := newTestSync(t, "node-b", "secret")
+
+	setSetting(t, a, "weather.units", "metric")
+	if exchange(t, a, b, false) == 0 {
+		t.Fatal("Expected changes to be applied")
+	}
+	if value, _ := getSetting(t, b, "weather.units"); value != "metric" {
+		t.Errorf("Expected replicated value metric, got %q", value)
+	}
+
+	// Replaying the same changes is a no-op
+	if n := exchange(t, a, b, false); n != 0 {
+		t.Errorf("Expected replay to apply nothing, applied %d", n)
+	}
+
+	// The replicated value does not bounce back as a new edit
+	if n := exchange(t, b, a, false); n != 0 {
+		t.Errorf("Expected nothing to flow back, applied %d", n)
+	}
+}
+
+func TestConfigSync_ReplicatesDeletion(t *testing.T) {
+	a := newTestSync(t, "node-a", "secret")
+	b := newTestSync(t, "node-b", "secret")
+
+	setSetting(t, a, "custom.flag", "on")
+	exchange(t, a, b, false)
+
+	if _, err := a.db.Exec(`DELETE FROM server_config WHERE key = 'custom.flag'`); err != nil {
+		t.Fatal(err)
+	}
+	exchange(t, a, b, false)
+	if _, ok := getSetting(t, b, "custom.flag"); ok {
+		t.Error("Expected deleted setting to be removed on the peer")
+	}
+}
+
+func TestConfigSync_ConcurrentEditsConverge(t *testing.T) {
+	a := newTestSync(t, "node-a", "secret")
+	b := newTestSync(t, "node-b", "secret")
+
+	setSetting(t, a, "server.title", "base")
+	exchange(t, a, b, false)
+
+	setSetting(t, a, "server.title", "from a")
+	if _, err := a.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	setSetting(t, b, "server.title", "from b")
+	if _, err := b.Scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	exchange(t, a, b, false)
+	exchange(t, b, a, false)
+
+	valueA, _ := getSetting(t, a, "server.title")
+	valueB, _ := getSetting(t, b, "server.title")
+	if valueA != valueB {
+		t.Fatalf("Nodes diverged: %q vs %q", valueA, valueB)
+	}
+	if valueA != "from b" {
+		t.Errorf("Expected the later edit to win, got %q", valueA)
+	}
+
+	localA, _ := a.Digest()
+	localB, _ := b.Digest()
+	if drift := CompareDigests(localA, localB); !drift.InSync {
+		t.Errorf("Expected nodes in sync, got %+v", drift)
+	}
+}
+
+func TestConfigSync_NodeLocalSettingsNotReplicated(t *testing.T) {
+	a := newTestSync(t, "node-a", "secret")
+	b := newTestSync(t, "node-b", "secret")
+
+	setSetting(t, a, "cluster.advertise_url", "https://a.example.com")
+	setSetting(t, b, "cluster.advertise_url", "https://b.example.com")
+	exchange(t, a, b, false)
+
+	if value, _ := getSetting(t, b, "cluster.advertise_url"); value != "https://b.example.com" {
+		t.Errorf("Node-local setting was overwritten: %q", value)
+	}
+}
+
+func TestConfigSync_JoinAdoptsCluster(t *testing.T) {
+	existing := newTestSync(t, "node-a", "secret")
+	joining := newTestSync(t, "node-b", "secret")
+
+	setSetting(t, existing, "weather.units", "imperial")
+	if _, err := existing.Scan(); err != nil {
+		t.Fatal(err)
+	}
+	// The joining node's fresh default was written later but must not win
+	time.Sleep(5 * time.Millisecond)
+	setSetting(t, joining, "weather.units", "metric")
+	if _, err := joining.Scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	exchange(t, existing, joining, true)
+	if value, _ := getSetting(t, joining, "weather.units"); value != "imperial" {
+		t.Errorf("Expected joining node to adopt imperial, got %q", value)
+	}
+}
+
+func TestConfigSync_UpdatedAtRoundTrip(t *testing.T) {
+	s := newTestSync(t, "node-a", "secret")
+	setSetting(t, s, "weather.units", "metric")
+	if _, err := s.Scan(); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := s.ChangesSince(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Changes) == 0 {
+		t.Fatal("Expected recorded changes")
+	}
+	if time.Since(set.Changes[0].UpdatedAt) > time.Minute {
+		t.Errorf("Unexpected updated_at %v", set.Changes[0].UpdatedAt)
+	}
+	if set.Changes[0].Version["node-a"] != 1 {
+		t.Errorf("Expected version {node-a:1}, got %v", set.Changes[0].Version)
+	}
+}
+
+func TestVectorClock_Compare(t *testing.T) {
+	tests := []struct {
+		a, b VectorClock
+		want ClockOrder
+	}{
+		{VectorClock{"a": 1}, VectorClock{"a": 1}, ClockEqual},
+		{VectorClock{"a": 1}, VectorClock{"a": 2}, ClockBefore},
+		{VectorClock{"a": 2, "b": 1}, VectorClock{"a": 1}, ClockAfter},
+		{VectorClock{"a": 2}, VectorClock{"a": 1, "b": 1}, ClockConcurrent},
+		{VectorClock{}, VectorClock{"b": 1}, ClockBefore},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Compare(tt.b); got != tt.want {
+			t.Errorf("%v.Compare(%v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	merged := VectorClock{"a": 2}.Merge(VectorClock{"a": 1, "b": 3})
+	if merged["a"] != 2 || merged["b"] != 3 {
+		t.Errorf("Unexpected merge result %v", merged)
+	}
+}
+
+func TestCompareDigests(t *testing.T) {
+	local := []DigestEntry{
+		{Kind: KindSetting, Key: "same", Digest: "x", Version: VectorClock{"a": 1}},
+		{Kind: KindSetting, Key: "newer", Digest: "y2", Version: VectorClock{"a": 2}},
+		{Kind: KindSetting, Key: "conflict", Digest: "z1", Version: VectorClock{"a": 1}},
+		{Kind: KindSetting, Key: "only-local", Digest: "l", Version: VectorClock{"a": 1}},
+	}
+	remote := []DigestEntry{
+		{Kind: KindSetting, Key: "same", Digest: "x", Version: VectorClock{"a": 1}},
+		{Kind: KindSetting, Key: "newer", Digest: "y1", Version: VectorClock{"a": 1}},
+		{Kind: KindSetting, Key: "conflict", Digest: "z2", Version: VectorClock{"b": 1}},
+		{Kind: KindTemplate, Key: "only-remote", Digest: "r", Version: VectorClock{"b": 1}},
+	}
+
+	drift := CompareDigests(local, remote)
+	if drift.InSync {
+		t.Fatal("Expected drift")
+	}
+	if drift.Ahead != 1 || drift.Conflicts != 1 || drift.MissingRemote != 1 || drift.MissingLocal != 1 || drift.Behind != 0 {
+		t.Errorf("Unexpected drift counts %+v", drift)
+	}
+	if len(drift.Items) != 4 {
+		t.Errorf("Expected 4 drift items, got %d", len(drift.Items))
+	}
+}
+
+func TestConfigSync_SignedRequests(t *testing.T) {
+	server := newTestSync(t, "node-a", "secret")
+	setSetting(t, server, "weather.units", "metric")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if _, err := server.Authenticate(r, body); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		entries, _ := server.Digest()
+		json.NewEncoder(w).Encode(entries)
+	}))
+	defer ts.Close()
+
+	peer := newTestSync(t, "node-b", "secret")
+	entries, err := peer.PeerDigest(ts.URL)
+	if err != nil {
+		t.Fatalf("Signed request rejected: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Error("Expected digest entries")
+	}
+
+	intruder := newTestSync(t, "node-c", "wrong")
+	if _, err := intruder.PeerDigest(ts.URL); err == nil {
+		t.Error("Expected request with the wrong secret to be rejected")
+	}
+
+	if _, err := NewConfigSync(peer.db, ConfigSyncOptions{NodeID: "node-d"}); err == nil {
+		t.Error("Expected an error without a secret or CA")
+	}
+}
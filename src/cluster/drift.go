@@ -0,0 +1,118 @@
+package cluster
+
+import "sort"
+
+// Drift item statuses, from this node's point of view
+const (
+	DriftAhead         = "ahead"
+	DriftBehind        = "behind"
+	DriftConflict      = "conflict"
+	DriftMissingLocal  = "missing_local"
+	DriftMissingRemote = "missing_remote"
+)
+
+// Items listed per node; counts cover everything
+const maxDriftItems = 50
+
+// DriftItem is a configuration item that differs between two nodes
+type DriftItem struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	Status string `json:"status"`
+}
+
+// NodeDrift summarises how a node's configuration differs from this node's
+type NodeDrift struct {
+	InSync        bool        `json:"in_sync"`
+	Ahead         int         `json:"ahead"`
+	Behind        int         `json:"behind"`
+	Conflicts     int         `json:"conflicts"`
+	MissingLocal  int         `json:"missing_local"`
+	MissingRemote int         `json:"missing_remote"`
+	Items         []DriftItem `json:"items,omitempty"`
+}
+
+// Drift compares this node's configuration with a peer's
+func (s *ConfigSync) Drift(address string) (*NodeDrift, error) {
+	remote, err := s.PeerDigest(address)
+	if err != nil {
+		return nil, err
+	}
+	local, err := s.Digest()
+	if err != nil {
+		return nil, err
+	}
+	return CompareDigests(local, remote), nil
+}
+
+// CompareDigests classifies every item whose content differs
+func CompareDigests(local, remote []DigestEntry) *NodeDrift {
+	index := func(entries []DigestEntry) map[string]DigestEntry {
+		m := make(map[string]DigestEntry, len(entries))
+		for _, e := range entries {
+			m[itemID(e.Kind, e.Key)] = e
+		}
+		return m
+	}
+	localByID, remoteByID := index(local), index(remote)
+
+	ids := make([]string, 0, len(localByID)+len(remoteByID))
+	for id := range localByID {
+		ids = append(ids, id)
+	}
+	for id := range remoteByID {
+		if _, ok := localByID[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	drift := &NodeDrift{}
+	for _, id := range ids {
+		l, hasLocal := localByID[id]
+		r, hasRemote := remoteByID[id]
+		hasLocal = hasLocal && !l.Deleted
+		hasRemote = hasRemote && !r.Deleted
+
+		var status string
+		switch {
+		case !hasLocal && !hasRemote:
+			continue
+		case hasLocal && hasRemote && l.Digest == r.Digest:
+			continue
+		case hasLocal && hasRemote:
+			switch l.Version.Compare(r.Version) {
+			case ClockAfter:
+				status = DriftAhead
+			case ClockBefore:
+				status = DriftBehind
+			default:
+				status = DriftConflict
+			}
+		case hasLocal:
+			status = DriftMissingRemote
+		default:
+			status = DriftMissingLocal
+		}
+
+		switch status {
+		case DriftAhead:
+			drift.Ahead++
+		case DriftBehind:
+			drift.Behind++
+		case DriftConflict:
+			drift.Conflicts++
+		case DriftMissingRemote:
+			drift.MissingRemote++
+		case DriftMissingLocal:
+			drift.MissingLocal++
+		}
+		if len(drift.Items) < maxDriftItems {
+			kind, key := splitItemID(id)
+			drift.Items = append(drift.Items, DriftItem{Kind: kind, Key: key, Status: status})
+		}
+	}
+
+	drift.InSync = drift.Ahead+drift.Behind+drift.Conflicts+drift.MissingLocal+drift.MissingRemote == 0
+	return drift
+}
@@ -0,0 +1,302 @@
+package cluster
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers used to authenticate node-to-node requests
+const (
+	HeaderClusterNode      = "X-Cluster-Node"
+	HeaderClusterAddress   = "X-Cluster-Address"
+	HeaderClusterTimestamp = "X-Cluster-Timestamp"
+	HeaderClusterSignature = "X-Cluster-Signature"
+)
+
+// Signed requests older or newer than this are rejected
+const syncMaxClockSkew = 5 * time.Minute
+
+// Paths of the sync API below the API prefix
+const (
+	SyncChangesPath = "/cluster/sync/changes"
+	SyncDigestPath  = "/cluster/sync/digest"
+)
+
+// syncAuth signs outgoing requests and verifies incoming ones, with a shared
+// secret (HMAC-SHA256) and/or mutual TLS
+type syncAuth struct {
+	secret    []byte
+	caPool    *x509.CertPool
+	clientTLS *tls.Config
+}
+
+func newSyncAuth(opts ConfigSyncOptions) (*syncAuth, error) {
+	auth := &syncAuth{secret: []byte(opts.Secret)}
+
+	if opts.CAFile != "" {
+		caPEM, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cluster CA: %w", err)
+		}
+		auth.caPool = x509.NewCertPool()
+		if !auth.caPool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in cluster CA %s", opts.CAFile)
+		}
+		auth.clientTLS = &tls.Config{RootCAs: auth.caPool, MinVersion: tls.VersionTLS12}
+	}
+	if opts.CertFile != "" && opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load cluster client certificate: %w", err)
+		}
+		if auth.clientTLS == nil {
+			auth.clientTLS = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		auth.clientTLS.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(auth.secret) == 0 && auth.caPool == nil {
+		return nil, fmt.Errorf("cluster sync requires a shared secret (cluster.secret or CLUSTER_SECRET) or a cluster CA")
+	}
+	return auth, nil
+}
+
+func (a *syncAuth) httpClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if a.clientTLS != nil {
+		transport.TLSClientConfig = a.clientTLS
+	}
+	return &http.Client{Transport: transport, Timeout: 30 * time.Second}
+}
+
+// signature computes the HMAC over the request line, timestamp and body hash
+func (a *syncAuth) signature(nodeID, method, path, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(nodeID + "\n" + method + "\n" + path + "\n" + timestamp + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *syncAuth) sign(req *http.Request, nodeID string, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderClusterNode, nodeID)
+	req.Header.Set(HeaderClusterTimestamp, timestamp)
+	if len(a.secret) > 0 {
+		req.Header.Set(HeaderClusterSignature, a.signature(nodeID, req.Method, req.URL.RequestURI(), timestamp, body))
+	}
+}
+
+// verify authenticates a request from another node and returns its node ID.
+// A client certificate issued by the cluster CA is accepted when this node
+// terminates TLS itself; otherwise the HMAC signature is required.
+func (a *syncAuth) verify(r *http.Request, body []byte) (string, error) {
+	nodeID := r.Header.Get(HeaderClusterNode)
+	if nodeID == "" {
+		return "", fmt.Errorf("missing %s header", HeaderClusterNode)
+	}
+
+	if a.caPool != nil && r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		intermediates := x509.NewCertPool()
+		for _, cert := range r.TLS.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		_, err := r.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+			Roots:         a.caPool,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		if err == nil {
+			return nodeID, nil
+		}
+		if len(a.secret) == 0 {
+			return "", fmt.Errorf("client certificate not trusted: %w", err)
+		}
+	}
+
+	if len(a.secret) == 0 {
+		return "", fmt.Errorf("client certificate required")
+	}
+
+	timestamp := r.Header.Get(HeaderClusterTimestamp)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s header", HeaderClusterTimestamp)
+	}
+	if skew := time.Since(time.Unix(ts, 0)); skew > syncMaxClockSkew || skew < -syncMaxClockSkew {
+		return "", fmt.Errorf("request timestamp outside allowed clock skew")
+	}
+
+	expected := a.signature(nodeID, r.Method, r.URL.RequestURI(), timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(HeaderClusterSignature))) {
+		return "", fmt.Errorf("invalid cluster signature")
+	}
+	return nodeID, nil
+}
+
+// Authenticate verifies a request from another node and returns its node ID
+func (s *ConfigSync) Authenticate(r *http.Request, body []byte) (string, error) {
+	return s.auth.verify(r, body)
+}
+
+// do sends a signed request to a peer and decodes the JSON response into out
+func (s *ConfigSync) do(method, address, path string, query url.Values, in, out interface{}) error {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	target := strings.TrimRight(address, "/") + s.opts.APIPath + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.opts.AdvertiseURL != "" {
+		req.Header.Set(HeaderClusterAddress, s.opts.AdvertiseURL)
+	}
+	s.auth.sign(req, s.opts.NodeID, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: HTTP %d: %s", method, target, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// PullFrom fetches and applies the changes a peer recorded since the last
+// pull, returning the number applied
+func (s *ConfigSync) PullFrom(address string) (int, error) {
+	return s.pull(address, false)
+}
+
+func (s *ConfigSync) pull(address string, adopt bool) (int, error) {
+	cursorKey := "sync.pulled." + address
+	applied := 0
+	for {
+		cursor := s.cursor(cursorKey)
+		var set ChangeSet
+		err := s.do(http.MethodGet, address, SyncChangesPath, url.Values{"since": {strconv.FormatInt(cursor, 10)}}, nil, &set)
+		if err != nil {
+			return applied, err
+		}
+		n, err := s.ApplyChangeSet(&set, adopt)
+		applied += n
+		if err != nil {
+			return applied, err
+		}
+		s.setCursor(cursorKey, set.Next)
+		s.TouchNode(set.From, address)
+		if !set.More {
+			return applied, nil
+		}
+	}
+}
+
+// PushTo sends the changes recorded since the last push to a peer
+func (s *ConfigSync) PushTo(address string) error {
+	cursorKey := "sync.pushed." + address
+	for {
+		set, err := s.ChangesSince(s.cursor(cursorKey))
+		if err != nil {
+			return err
+		}
+		if len(set.Changes) > 0 {
+			var resp struct {
+				Node string `json:"node"`
+			}
+			if err := s.do(http.MethodPost, address, SyncChangesPath, nil, set, &resp); err != nil {
+				return err
+			}
+			s.TouchNode(resp.Node, address)
+		}
+		s.setCursor(cursorKey, set.Next)
+		if !set.More {
+			return nil
+		}
+	}
+}
+
+// Join reconciles a node joining the cluster: the peer's configuration is
+// adopted (the peer wins conflicts), then local-only items are versioned so
+// they replicate to the rest of the cluster. Runs once per node.
+func (s *ConfigSync) Join(address string) error {
+	if s.cursor("sync.joined") > 0 {
+		return nil
+	}
+	if address != "" {
+		if _, err := s.pull(address, true); err != nil {
+			return fmt.Errorf("failed to reconcile with %s: %w", address, err)
+		}
+	}
+	if _, err := s.Scan(); err != nil {
+		return err
+	}
+	if address != "" {
+		if err := s.PushTo(address); err != nil {
+			return fmt.Errorf("failed to push local configuration to %s: %w", address, err)
+		}
+	}
+	s.setCursor("sync.joined", time.Now().Unix())
+	return nil
+}
+
+// JoinURL returns the configured join address
+func (s *ConfigSync) JoinURL() string {
+	return s.opts.JoinURL
+}
+
+// PeerDigest fetches a peer's item versions
+func (s *ConfigSync) PeerDigest(address string) ([]DigestEntry, error) {
+	var entries []DigestEntry
+	err := s.do(http.MethodGet, address, SyncDigestPath, nil, nil, &entries)
+	return entries, err
+}
+
+// cursor reads a sync position from server_cluster_state
+func (s *ConfigSync) cursor(key string) int64 {
+	var value string
+	if err := s.db.QueryRow(`SELECT value FROM server_cluster_state WHERE key = ?`, key).Scan(&value); err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
+
+func (s *ConfigSync) setCursor(key string, value int64) {
+	_, _ = s.db.Exec(`
+		INSERT INTO server_cluster_state (key, value, node_id, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+	`, key, strconv.FormatInt(value, 10), s.opts.NodeID)
+}
@@ -0,0 +1,81 @@
+package cluster
+
+import "encoding/json"
+
+// VectorClock counts the changes each node has made to an item
+type VectorClock map[string]uint64
+
+// Ordering of two vector clocks
+type ClockOrder int
+
+const (
+	ClockEqual ClockOrder = iota
+	ClockBefore
+	ClockAfter
+	ClockConcurrent
+)
+
+// Compare returns how v relates to other
+func (v VectorClock) Compare(other VectorClock) ClockOrder {
+	less, greater := false, false
+	for node, n := range v {
+		switch m := other[node]; {
+		case n < m:
+			less = true
+		case n > m:
+			greater = true
+		}
+	}
+	for node, m := range other {
+		if _, ok := v[node]; !ok && m > 0 {
+			less = true
+		}
+	}
+
+	switch {
+	case less && greater:
+		return ClockConcurrent
+	case less:
+		return ClockBefore
+	case greater:
+		return ClockAfter
+	default:
+		return ClockEqual
+	}
+}
+
+// Merge returns the element-wise maximum of v and other
+func (v VectorClock) Merge(other VectorClock) VectorClock {
+	merged := make(VectorClock, len(v)+len(other))
+	for node, n := range v {
+		merged[node] = n
+	}
+	for node, m := range other {
+		if m > merged[node] {
+			merged[node] = m
+		}
+	}
+	return merged
+}
+
+// Increment returns a copy of v with node's counter incremented
+func (v VectorClock) Increment(node string) VectorClock {
+	next := v.Merge(nil)
+	next[node]++
+	return next
+}
+
+// String encodes the clock as JSON
+func (v VectorClock) String() string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// parseVectorClock decodes a clock stored as JSON; invalid input is empty
+func parseVectorClock(s string) VectorClock {
+	v := VectorClock{}
+	if s != "" {
+		_ = json.Unmarshal([]byte(s), &v)
+	}
+	return v
+}
@@ -10,6 +10,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/apimgr/weather/src/backup/objectstore"
+	"github.com/apimgr/weather/src/database"
 	"gopkg.in/yaml.v3"
 )
 
@@ -21,6 +23,21 @@ type WeatherConfig struct {
 	UpdateInterval int `yaml:"update_interval"`
 	// Enable location-based weather queries
 	LocationSearchEnabled bool `yaml:"location_search_enabled"`
+	// Hourly observation archive of saved and popular locations
+	Observations ObservationConfig `yaml:"observations"`
+}
+
+// ObservationConfig controls the observation archive
+type ObservationConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Most requested unsaved locations recorded as well; 0 records saved locations only
+	PopularLocations int `yaml:"popular_locations"`
+	// Days hourly observations are kept; daily aggregates are kept longer
+	HourlyDays int `yaml:"hourly_days"`
+	// Days daily observations are kept; -1 keeps them forever
+	DailyDays int `yaml:"daily_days"`
+	// Days recorded forecasts are kept for forecast-vs-actual comparison
+	ForecastHistoryDays int `yaml:"forecast_history_days"`
 }
 
 // UsersConfig represents user/multi-user settings per AI.md PART 33
@@ -84,6 +101,49 @@ type ServerConfig struct {
 	Notifications NotificationConfig `yaml:"notifications"`
 	Tor      TorConfig          `yaml:"tor"`
 	Features FeatureConfig      `yaml:"features"`
+	// External identity providers (OIDC)
+	Auth     AuthConfig         `yaml:"auth"`
+	// Reverse proxies (addresses or CIDR ranges) whose X-Forwarded-For and
+	// X-Real-IP headers are trusted; default: loopback and private ranges
+	TrustedProxies []string     `yaml:"trusted_proxies,omitempty"`
+	// Client IP header set by a CDN every request passes through: cloudflare,
+	// google or a header name. Trusted from any peer, so only set it when the
+	// server cannot be reached directly.
+	TrustedPlatform string      `yaml:"trusted_platform,omitempty"`
+	// Audit log checkpoints and real-time forwarding
+	Audit    AuditConfig        `yaml:"audit,omitempty"`
+	// Data retention per data class, data exports and account deletion
+	Privacy  PrivacyConfig      `yaml:"privacy,omitempty"`
+}
+
+// PrivacyConfig configures how long personal data is kept and the
+// download my data / delete my account workflows
+type PrivacyConfig struct {
+	// Days to keep each data class (audit_log, activity, devices,
+	// notifications, notification_delivery, token_usage,
+	// contact_submissions, audit_archives, data_exports); 0 or missing
+	// uses the default, negative keeps forever
+	Retention map[string]int `yaml:"retention,omitempty"`
+	// Hours an account deletion confirmation link is valid (default 24)
+	DeletionLinkHours int `yaml:"deletion_link_hours,omitempty"`
+}
+
+// AuditConfig configures the hash-chained audit log
+type AuditConfig struct {
+	// Write a signed checkpoint after this many records (default 1000)
+	CheckpointEvery int `yaml:"checkpoint_every,omitempty"`
+	// ...or at least this often, in seconds (default 3600)
+	CheckpointInterval int `yaml:"checkpoint_interval,omitempty"`
+	// Send every record to a SIEM or file as it is written
+	Forward []AuditForwardConfig `yaml:"forward,omitempty"`
+}
+
+// AuditForwardConfig is one real-time audit forwarding target
+type AuditForwardConfig struct {
+	// jsonl, cef or syslog
+	Format string `yaml:"format"`
+	// udp://host:514, tcp://host:514 or a file path
+	Target string `yaml:"target"`
 }
 
 // AdminConfig represents admin panel configuration per AI.md PART 4
@@ -154,6 +214,45 @@ type DatabaseConfig struct {
 	Password string `yaml:"password"`
 	// For PostgreSQL
 	SSLMode  string `yaml:"sslmode"`
+	// Server and users database names (default: {name}_server, {name}_users)
+	ServerName string `yaml:"server_name"`
+	UsersName  string `yaml:"users_name"`
+	// Extra driver parameters (PostgreSQL runtime params, MySQL DSN params)
+	Options map[string]string `yaml:"options"`
+	// Read replicas of both databases (PostgreSQL/MySQL)
+	Replicas []DatabaseReplicaConfig `yaml:"replicas,omitempty"`
+	// Seconds a replica may trail the primary and still serve reads (default 10)
+	MaxReplicaLag int `yaml:"max_replica_lag,omitempty"`
+}
+
+// DatabaseReplicaConfig is a read replica; unset fields use the primary's
+type DatabaseReplicaConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port,omitempty"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// Connection returns the connection settings for the database package
+func (d DatabaseConfig) Connection() *database.DatabaseConfig {
+	replicas := make([]database.ReplicaConfig, 0, len(d.Replicas))
+	for _, r := range d.Replicas {
+		replicas = append(replicas, database.ReplicaConfig{Host: r.Host, Port: r.Port, Username: r.Username, Password: r.Password})
+	}
+	return &database.DatabaseConfig{
+		Type:           d.Driver,
+		Host:           d.Host,
+		Port:           d.Port,
+		Database:       d.Name,
+		Username:       d.Username,
+		Password:       d.Password,
+		SSLMode:        d.SSLMode,
+		Options:        d.Options,
+		ServerDatabase: d.ServerName,
+		UsersDatabase:  d.UsersName,
+		Replicas:       replicas,
+		MaxReplicaLag:  time.Duration(d.MaxReplicaLag) * time.Second,
+	}
 }
 
 // MaintenanceConfig represents maintenance mode configuration per AI.md PART 4
@@ -196,6 +295,176 @@ type BackupConfig struct {
 	Encryption BackupEncryptionConfig `yaml:"encryption"`
 	// AI.md PART 19 line 24812: Enable hourly incremental backup (disabled by default)
 	HourlyEnabled bool `yaml:"hourly_enabled"`
+	// Continuous WAL shipping of the SQLite databases for point-in-time restore
+	Replication BackupReplicationConfig `yaml:"replication"`
+	// Remote destinations scheduled backups are uploaded to
+	Targets []BackupTargetConfig `yaml:"targets"`
+	// Backups kept locally and on each target; the last 4 when not set
+	Retention BackupRetentionConfig `yaml:"retention"`
+	// Scheduled test restore of the latest backup
+	Drill BackupDrillConfig `yaml:"drill"`
+	// Deduplicated snapshots of selected backup sets
+	Incremental BackupIncrementalConfig `yaml:"incremental"`
+}
+
+// BackupTargetConfig represents a remote backup destination
+type BackupTargetConfig struct {
+	// Shown in logs and notifications; defaults to the target
+	Name string `yaml:"name"`
+	// s3://bucket/prefix, sftp://user@host:port/path, http(s)://host/path
+	// (WebDAV) or a directory
+	Target string             `yaml:"target"`
+	S3     BackupS3Config     `yaml:"s3"`
+	SFTP   BackupSFTPConfig   `yaml:"sftp"`
+	WebDAV BackupWebDAVConfig `yaml:"webdav"`
+	// Backups uploaded here: daily, hourly (default: daily)
+	Schedules []string `yaml:"schedules"`
+	// Upload chunk size in MB (default 8); a failed upload resumes at the
+	// first missing chunk
+	ChunkSize int `yaml:"chunk_size"`
+}
+
+// BackupSFTPConfig represents the credentials of an SFTP backup target
+type BackupSFTPConfig struct {
+	// Defaults to the user in the target URL
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Path of an unencrypted OpenSSH private key
+	PrivateKey string `yaml:"private_key"`
+	// Server key fingerprint as printed by ssh-keygen -lf (SHA256:...)
+	HostKey string `yaml:"host_key"`
+}
+
+// BackupWebDAVConfig represents the credentials of a WebDAV backup target
+type BackupWebDAVConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// BackupRetentionConfig represents grandfather-father-son retention: the
+// newest backup of each of the last N hours, days, weeks and months is kept
+type BackupRetentionConfig struct {
+	Hourly  int `yaml:"hourly"`
+	Daily   int `yaml:"daily"`
+	Weekly  int `yaml:"weekly"`
+	Monthly int `yaml:"monthly"`
+}
+
+// BackupDrillConfig represents the scheduled restore drill
+type BackupDrillConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Cron schedule (default: Sundays at 04:00)
+	Schedule string `yaml:"schedule"`
+	// Name of the target to restore from; the local backup directory when empty
+	Target string `yaml:"target"`
+}
+
+// BackupIncrementalConfig represents scheduled snapshots into the
+// deduplicating backup repository
+type BackupIncrementalConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Cron schedule (default: @hourly)
+	Schedule string `yaml:"schedule"`
+	// config, templates, ssl, datasets, server-db, users-db, data; all but
+	// ssl and data when empty
+	Sets []string `yaml:"sets"`
+	// Name of the target holding the repository; {data_dir}/backup/repository
+	// when empty
+	Target string `yaml:"target"`
+}
+
+// FindTarget returns the backup target called name
+func (c BackupConfig) FindTarget(name string) (BackupTargetConfig, bool) {
+	for _, t := range c.Targets {
+		if t.DisplayName() == name {
+			return t, true
+		}
+	}
+	return BackupTargetConfig{}, false
+}
+
+// DisplayName returns the name of the target for logs and notifications
+func (t BackupTargetConfig) DisplayName() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Target
+}
+
+// HasSchedule reports whether backups of schedule (daily, hourly) are
+// uploaded to the target
+func (t BackupTargetConfig) HasSchedule(schedule string) bool {
+	if len(t.Schedules) == 0 {
+		return schedule == "daily"
+	}
+	for _, s := range t.Schedules {
+		if strings.EqualFold(s, schedule) {
+			return true
+		}
+	}
+	return false
+}
+
+// ObjectStore returns the settings of the target
+func (t BackupTargetConfig) ObjectStore() objectstore.Config {
+	return objectstore.Config{
+		Target: t.Target,
+		S3:     t.S3.objectStore(),
+		SFTP: objectstore.SFTPConfig{
+			Username:   t.SFTP.Username,
+			Password:   t.SFTP.Password,
+			PrivateKey: t.SFTP.PrivateKey,
+			HostKey:    t.SFTP.HostKey,
+		},
+		WebDAV: objectstore.WebDAVConfig{
+			Username: t.WebDAV.Username,
+			Password: t.WebDAV.Password,
+		},
+	}
+}
+
+// BackupReplicationConfig represents continuous replication of the SQLite
+// server and users databases
+type BackupReplicationConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// A directory, or s3://bucket/prefix
+	Target string         `yaml:"target"`
+	S3     BackupS3Config `yaml:"s3"`
+	// Seconds between WAL shipments (lag is at most about this long)
+	SyncInterval int `yaml:"sync_interval"`
+	// Hours between full snapshots
+	SnapshotInterval int `yaml:"snapshot_interval"`
+	// Hours restores can go back
+	Retention int `yaml:"retention"`
+}
+
+// BackupS3Config represents an S3-compatible backup target (AWS S3, MinIO, ...)
+type BackupS3Config struct {
+	// e.g. https://s3.us-east-1.amazonaws.com or http://minio:9000
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	// Address buckets as endpoint/bucket (MinIO and most self-hosted servers)
+	PathStyle bool `yaml:"path_style"`
+}
+
+// ObjectStore returns the settings of the replication target
+func (r BackupReplicationConfig) ObjectStore() objectstore.Config {
+	return objectstore.Config{
+		Target: r.Target,
+		S3:     r.S3.objectStore(),
+	}
+}
+
+func (c BackupS3Config) objectStore() objectstore.S3Config {
+	return objectstore.S3Config{
+		Endpoint:  c.Endpoint,
+		Region:    c.Region,
+		AccessKey: c.AccessKey,
+		SecretKey: c.SecretKey,
+		PathStyle: c.PathStyle,
+	}
 }
 
 // BackupEncryptionConfig represents backup encryption settings per AI.md PART 24
@@ -214,6 +483,22 @@ type RateLimitConfig struct {
 	Requests int  `yaml:"requests"`
 	// Window in seconds
 	Window   int  `yaml:"window"`
+	// Counter store shared by nodes: auto, memory, redis or database
+	// (read at startup)
+	Store    string `yaml:"store,omitempty"`
+	// API limits by caller: anonymous, user, token or a user role
+	Tiers    map[string]RateLimitRule `yaml:"tiers,omitempty"`
+	// Limits for login, password_reset, registration, upload and admin
+	Endpoints map[string]RateLimitRule `yaml:"endpoints,omitempty"`
+	// Cost of one request per API route, relative to the API path
+	// (e.g. "/history": 5); routes not listed cost 1
+	Costs    map[string]int `yaml:"costs,omitempty"`
+}
+
+// RateLimitRule allows Requests per sliding Window (seconds)
+type RateLimitRule struct {
+	Requests int `yaml:"requests" json:"requests"`
+	Window   int `yaml:"window" json:"window"`
 }
 
 // BrandingConfig represents branding configuration per AI.md PART 4
@@ -252,6 +537,24 @@ type NotificationConfig struct {
 	Enabled        bool `yaml:"enabled"`
 	EmailEnabled   bool `yaml:"email_enabled"`
 	WebhookEnabled bool `yaml:"webhook_enabled"`
+	// Per-event switches set on the admin notifications page
+	Email NotificationEmailConfig `yaml:"email"`
+}
+
+// NotificationEmailConfig represents which events are emailed to the admin
+type NotificationEmailConfig struct {
+	// Event name (backup_complete, backup_failed, ...) to enabled; events
+	// not listed are sent
+	Events map[string]bool `yaml:"events"`
+}
+
+// EmailEvent reports whether the admin is emailed about event
+func (n NotificationConfig) EmailEvent(event string) bool {
+	if !n.Enabled || !n.EmailEnabled {
+		return false
+	}
+	enabled, ok := n.Email.Events[event]
+	return !ok || enabled
 }
 
 // WebConfig represents web-specific configuration per AI.md PART 4
@@ -289,6 +592,110 @@ type FeatureConfig struct {
 	AuditLog      bool `yaml:"audit_log"`
 }
 
+// AuthConfig represents external authentication configuration
+type AuthConfig struct {
+	OIDC OIDCConfig `yaml:"oidc"`
+	LDAP LDAPConfig `yaml:"ldap"`
+}
+
+// LDAPConfig represents LDAP/Active Directory login settings
+type LDAPConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Server  string `yaml:"server"`
+	// Default: 389, or 636 with ldaps
+	Port int `yaml:"port"`
+	// none, starttls or ldaps
+	Security string `yaml:"security"`
+	// CA bundle for the directory's certificate (default: system roots)
+	CAFile             string `yaml:"ca_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	// Service account used to search; empty for anonymous search
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+	BaseDN       string `yaml:"base_dn"`
+	// {username} is replaced with the escaped login name
+	// Default: (uid={username}); Active Directory: (sAMAccountName={username})
+	UserFilter string `yaml:"user_filter"`
+	// Where to search for groups (default: base_dn); {dn} is the user's DN
+	GroupBaseDN string `yaml:"group_base_dn"`
+	// Default: (|(member={dn})(uniqueMember={dn}))
+	GroupFilter string `yaml:"group_filter"`
+	// Attribute names (defaults: uid, mail, cn)
+	UsernameAttribute    string `yaml:"username_attribute"`
+	EmailAttribute       string `yaml:"email_attribute"`
+	DisplayNameAttribute string `yaml:"display_name_attribute"`
+	// Only members of these groups may sign in (empty: anyone matching user_filter)
+	AllowedGroups []string `yaml:"allowed_groups"`
+	// Members of these groups get admin panel access
+	AdminGroups []string `yaml:"admin_groups"`
+	// Group (DN or CN) -> user role
+	RoleMapping map[string]string `yaml:"role_mapping"`
+	DefaultRole string            `yaml:"default_role"`
+}
+
+// OIDCConfig represents OpenID Connect login settings
+type OIDCConfig struct {
+	Enabled   bool                 `yaml:"enabled"`
+	Providers []OIDCProviderConfig `yaml:"providers"`
+}
+
+// OIDCProviderConfig represents one OpenID Connect identity provider
+type OIDCProviderConfig struct {
+	// URL-safe identifier used in /auth/oidc/{name}
+	Name         string `yaml:"name"`
+	// Label shown on the login button (default: name)
+	DisplayName  string `yaml:"display_name"`
+	IssuerURL    string `yaml:"issuer_url"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// Optional; default {scheme}://{host}/auth/oidc/{name}/callback
+	RedirectURL  string `yaml:"redirect_url"`
+	// Default: openid email profile
+	Scopes       []string `yaml:"scopes"`
+	// Claim used as the username (default: preferred_username)
+	UsernameClaim string `yaml:"username_claim"`
+	// Claim holding roles or groups, e.g. "groups" or "realm_access.roles"
+	RoleClaim    string `yaml:"role_claim"`
+	// Claim value -> role (user or admin)
+	RoleMapping  map[string]string `yaml:"role_mapping"`
+	// Role when no mapping matches (default: user)
+	DefaultRole  string `yaml:"default_role"`
+	// Allow this provider for admin panel login (existing admins only)
+	AdminLogin   bool   `yaml:"admin_login"`
+}
+
+// GetOIDCProvider returns the enabled OIDC provider with the given name
+func (c *AppConfig) GetOIDCProvider(name string) (*OIDCProviderConfig, bool) {
+	if c == nil || !c.Server.Auth.OIDC.Enabled {
+		return nil, false
+	}
+	for i := range c.Server.Auth.OIDC.Providers {
+		if c.Server.Auth.OIDC.Providers[i].Name == name {
+			return &c.Server.Auth.OIDC.Providers[i], true
+		}
+	}
+	return nil, false
+}
+
+// OIDCLoginProviders returns the providers to offer on a login page; for
+// the admin login only providers with admin_login enabled
+func (c *AppConfig) OIDCLoginProviders(admin bool) []OIDCProviderConfig {
+	if c == nil || !c.Server.Auth.OIDC.Enabled {
+		return nil
+	}
+	var providers []OIDCProviderConfig
+	for _, p := range c.Server.Auth.OIDC.Providers {
+		if admin && !p.AdminLogin {
+			continue
+		}
+		if p.DisplayName == "" {
+			p.DisplayName = p.Name
+		}
+		providers = append(providers, p)
+	}
+	return providers
+}
+
 // randomPort returns a random port in the 64000-64999 range per AI.md PART 4
 func randomPort() int {
 	rand.Seed(time.Now().UnixNano())
@@ -350,12 +757,52 @@ func (c *AppConfig) GetAPIPath() string {
 	return "/api/" + c.GetAPIVersion()
 }
 
+// DefaultTrustedProxies are trusted when server.trusted_proxies is empty
+var DefaultTrustedProxies = []string{"127.0.0.1", "::1", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+
+// GetTrustedProxies returns the reverse proxies whose forwarding headers are
+// trusted
+func (c *AppConfig) GetTrustedProxies() []string {
+	if len(c.Server.TrustedProxies) > 0 {
+		return c.Server.TrustedProxies
+	}
+	return DefaultTrustedProxies
+}
+
 // GetAdminAPIPath returns the full admin API path prefix (e.g., "/api/v1/admin")
 // AI.md: Admin API routes use /api/{api_version}/{admin_path}/ format
 func (c *AppConfig) GetAdminAPIPath() string {
 	return c.GetAPIPath() + "/" + c.GetAdminPath()
 }
 
+// GetPostgresDSN returns the PostgreSQL connection string when the database
+// driver is postgres, otherwise an empty string
+func (c *AppConfig) GetPostgresDSN() string {
+	if c == nil {
+		return ""
+	}
+	db := c.Server.Database
+	switch strings.ToLower(db.Driver) {
+	case "postgres", "postgresql", "pgsql":
+	default:
+		return ""
+	}
+	host := db.Host
+	if host == "" {
+		host = "localhost"
+	}
+	port := db.Port
+	if port == 0 {
+		port = 5432
+	}
+	sslMode := db.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		host, port, db.Username, db.Password, db.Name, sslMode)
+}
+
 // LoadConfig loads configuration from server.yml per AI.md PART 4
 func LoadConfig() (*AppConfig, error) {
 	// Get hostname for defaults
@@ -382,6 +829,13 @@ func LoadConfig() (*AppConfig, error) {
 			UpdateInterval: 3600,
 			// Location search enabled by default
 			LocationSearchEnabled: true,
+			Observations: ObservationConfig{
+				Enabled:             true,
+				PopularLocations:    25,
+				HourlyDays:          30,
+				DailyDays:           -1,
+				ForecastHistoryDays: 90,
+			},
 		},
 		Server: ServerConfig{
 			// Random 64xxx on first run
@@ -484,6 +938,11 @@ func LoadConfig() (*AppConfig, error) {
 				Enabled:  true,
 				Requests: 120,
 				Window:   60,
+				Store:    "auto",
+				Costs: map[string]int{
+					"/history":         5,
+					"/weather/history": 5,
+				},
 			},
 			Database: DatabaseConfig{
 				Driver: "file",
@@ -512,6 +971,20 @@ func LoadConfig() (*AppConfig, error) {
 						// Optional password hint
 						Hint:    "",
 					},
+					Replication: BackupReplicationConfig{
+						Enabled:          false,
+						SyncInterval:     1,
+						SnapshotInterval: 24,
+						Retention:        72,
+					},
+					Drill: BackupDrillConfig{
+						Enabled:  false,
+						Schedule: "0 4 * * 0",
+					},
+					Incremental: BackupIncrementalConfig{
+						Enabled:  false,
+						Schedule: "@hourly",
+					},
 				},
 			},
 			Notifications: NotificationConfig{
@@ -0,0 +1,1175 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Dialect identifies the SQL flavour spoken by a database connection. The
+// schema and queries are written for SQLite; other dialects are reached by
+// translating statements as they are executed (see dialect_driver.go)
+type Dialect string
+
+const (
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+	DialectMySQL    Dialect = "mysql"
+)
+
+// ParseDialect maps a configured database driver name to a dialect
+func ParseDialect(driver string) (Dialect, error) {
+	switch strings.ToLower(strings.TrimSpace(driver)) {
+	case "", "file", "sqlite", "sqlite3":
+		return DialectSQLite, nil
+	case "postgres", "postgresql", "pgsql", "pgx":
+		return DialectPostgres, nil
+	case "mysql", "mariadb":
+		return DialectMySQL, nil
+	case "mssql", "sqlserver":
+		return "", fmt.Errorf("MSSQL is not supported for the server and users databases. Supported: sqlite, postgres, mysql, mariadb")
+	default:
+		return "", fmt.Errorf("unsupported database driver: %s. Supported: sqlite, postgres, mysql, mariadb", driver)
+	}
+}
+
+// DriverName returns the database/sql driver registered for the dialect
+func (d Dialect) DriverName() string {
+	switch d {
+	case DialectPostgres:
+		return postgresDriverName
+	case DialectMySQL:
+		return mysqlDriverName
+	default:
+		return "sqlite"
+	}
+}
+
+// Translate rewrites SQLite flavoured SQL (DDL and queries) for the dialect
+// and rebinds ? placeholders. Multiple statements separated by semicolons
+// are translated individually. SQLite queries are returned unchanged
+func (d Dialect) Translate(query string) (string, error) {
+	if d == DialectSQLite || d == "" {
+		return query, nil
+	}
+	var out []string
+	for _, statement := range splitStatements(query) {
+		t, err := d.translate(statement)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, t.query)
+	}
+	return strings.Join(out, ";\n"), nil
+}
+
+// Rebind converts ? placeholders to the dialect's bind variable syntax
+func (d Dialect) Rebind(query string) string {
+	if d != DialectPostgres {
+		return query
+	}
+	return render(rebindTokens(lex(query)))
+}
+
+// translation is a single translated statement plus the facts the driver
+// needs to emulate SQLite behaviour around it
+type translation struct {
+	query string
+	// table and serial column of an INSERT, used to report LastInsertId on
+	// PostgreSQL and to emulate RETURNING on MySQL
+	table  string
+	serial string
+	// returning holds the RETURNING column list stripped from a MySQL INSERT
+	returning string
+	// ignoreExists is set for MySQL DDL that SQLite guards with IF NOT
+	// EXISTS but MySQL cannot, so duplicate errors are ignored
+	ignoreExists bool
+}
+
+// insertReturningID returns the PostgreSQL query that reports the id of
+// inserted rows, or "" when the statement does not need one
+func (t *translation) insertReturningID() string {
+	if t.serial == "" || t.returning != "" || hasTopLevelWord(lex(t.query), "RETURNING") {
+		return ""
+	}
+	return t.query + " RETURNING " + t.serial
+}
+
+func (d Dialect) translate(statement string) (*translation, error) {
+	tokens := trimTokens(lex(statement))
+	t := &translation{}
+	if len(tokens) == 0 {
+		return t, nil
+	}
+
+	var err error
+	switch first := firstWord(tokens); first {
+	case "PRAGMA":
+		tokens = lex(d.pragma(tokens))
+	case "VACUUM", "ANALYZE", "REINDEX":
+		if d == DialectMySQL {
+			tokens = lex("SELECT 'ok'")
+		}
+	case "CREATE":
+		tokens, t.ignoreExists, err = d.createStatement(tokens)
+	case "ALTER":
+		tokens, err = d.alterStatement(tokens)
+	case "INSERT", "REPLACE":
+		tokens, err = d.insertStatement(tokens, t)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens = trimTokens(d.rewriteExpressions(tokens))
+	if d == DialectMySQL {
+		tokens = quoteMySQLIdentifiers(tokens)
+	} else {
+		tokens = rebindTokens(tokens)
+	}
+	t.query = render(tokens)
+	return t, nil
+}
+
+// --- lexer ---
+
+type tokenKind int
+
+const (
+	tokSpace tokenKind = iota
+	// identifiers, keywords and numbers
+	tokWord
+	// 'single quoted' string literals
+	tokString
+	// "double quoted" or `backtick` identifiers
+	tokQuoted
+	// ? bind parameters
+	tokParam
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func (t token) is(word string) bool {
+	return t.kind == tokWord && strings.EqualFold(t.text, word)
+}
+
+func (t token) isPunct(p string) bool {
+	return t.kind == tokPunct && t.text == p
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// lex splits SQL into tokens, dropping comments
+func lex(query string) []token {
+	var tokens []token
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 4
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			j := i
+			for j < len(query) && (query[j] == ' ' || query[j] == '\t' || query[j] == '\n' || query[j] == '\r') {
+				j++
+			}
+			tokens = append(tokens, token{tokSpace, query[i:j]})
+			i = j
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < len(query) {
+				if query[j] == c {
+					// Doubled quotes are escapes
+					if j+1 < len(query) && query[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j < len(query) {
+				j++
+			}
+			kind := tokQuoted
+			if c == '\'' {
+				kind = tokString
+			}
+			tokens = append(tokens, token{kind, query[i:j]})
+			i = j
+		case c == '?':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			tokens = append(tokens, token{tokParam, query[i:j]})
+			i = j
+		case isWordByte(c):
+			j := i
+			for j < len(query) && isWordByte(query[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokWord, query[i:j]})
+			i = j
+		default:
+			n := 1
+			if i+1 < len(query) {
+				switch query[i : i+2] {
+				case "||", "<=", ">=", "<>", "!=", "==":
+					n = 2
+				}
+			}
+			tokens = append(tokens, token{tokPunct, query[i : i+n]})
+			i += n
+		}
+	}
+	return tokens
+}
+
+func render(tokens []token) string {
+	var b strings.Builder
+	for _, t := range tokens {
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+// splitStatements splits a script on top-level semicolons, skipping empty
+// statements
+func splitStatements(script string) []string {
+	var statements []string
+	var current []token
+	flush := func() {
+		if s := strings.TrimSpace(render(current)); s != "" {
+			statements = append(statements, s)
+		}
+		current = nil
+	}
+	depth := 0
+	for _, t := range lex(script) {
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		case t.isPunct(";") && depth == 0:
+			flush()
+			continue
+		}
+		current = append(current, t)
+	}
+	flush()
+	return statements
+}
+
+func trimTokens(tokens []token) []token {
+	for len(tokens) > 0 && (tokens[0].kind == tokSpace) {
+		tokens = tokens[1:]
+	}
+	for len(tokens) > 0 && (tokens[len(tokens)-1].kind == tokSpace || tokens[len(tokens)-1].isPunct(";")) {
+		tokens = tokens[:len(tokens)-1]
+	}
+	return tokens
+}
+
+func firstWord(tokens []token) string {
+	for _, t := range tokens {
+		if t.kind == tokWord {
+			return strings.ToUpper(t.text)
+		}
+		if t.kind != tokSpace {
+			break
+		}
+	}
+	return ""
+}
+
+// nextToken returns the index of the next non-space token at or after i
+func nextToken(tokens []token, i int) int {
+	for i < len(tokens) && tokens[i].kind == tokSpace {
+		i++
+	}
+	return i
+}
+
+// prevToken returns the index of the previous non-space token before i
+func prevToken(tokens []token, i int) int {
+	i--
+	for i >= 0 && tokens[i].kind == tokSpace {
+		i--
+	}
+	return i
+}
+
+// closingParen returns the index of the parenthesis closing the one at open
+func closingParen(tokens []token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch {
+		case tokens[i].isPunct("("):
+			depth++
+		case tokens[i].isPunct(")"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits tokens on commas outside parentheses
+func splitTopLevel(tokens []token) [][]token {
+	var parts [][]token
+	depth, start := 0, 0
+	for i, t := range tokens {
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		case t.isPunct(",") && depth == 0:
+			parts = append(parts, tokens[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, tokens[start:])
+}
+
+// findTopLevelWord returns the index of the first word outside parentheses
+// matching word, or -1
+func findTopLevelWord(tokens []token, word string) int {
+	depth := 0
+	for i, t := range tokens {
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		case depth == 0 && t.is(word):
+			return i
+		}
+	}
+	return -1
+}
+
+func hasTopLevelWord(tokens []token, word string) bool {
+	return findTopLevelWord(tokens, word) >= 0
+}
+
+func splice(tokens []token, from, to int, replacement string) []token {
+	out := make([]token, 0, len(tokens))
+	out = append(out, tokens[:from]...)
+	out = append(out, lex(replacement)...)
+	return append(out, tokens[to:]...)
+}
+
+func unquoteIdent(text string) string {
+	if len(text) >= 2 && (text[0] == '"' || text[0] == '`') {
+		return text[1 : len(text)-1]
+	}
+	return text
+}
+
+func rebindTokens(tokens []token) []token {
+	n := 0
+	for i, t := range tokens {
+		if t.kind == tokParam {
+			n++
+			tokens[i].text = fmt.Sprintf("$%d", n)
+		}
+	}
+	return tokens
+}
+
+// --- schema registry ---
+
+// tableInfo records what the translator needs to know about a table
+// created from SQLite DDL
+type tableInfo struct {
+	// serial is the auto-assigned integer key column, if any
+	serial     string
+	primaryKey []string
+	// keyed columns appear in a key or index; MySQL cannot index TEXT
+	keyed map[string]bool
+	// text columns were translated to an unbounded MySQL type
+	text map[string]bool
+}
+
+var (
+	tables   = make(map[string]*tableInfo)
+	tablesMu sync.RWMutex
+)
+
+func init() {
+	for _, schema := range []string{Schema, migrationTables} {
+		registerSchema(schema)
+	}
+	for _, database := range []string{MigrationsServer, MigrationsUsers} {
+		migrations, err := LoadMigrations(database)
+		if err != nil {
+			panic(err)
+		}
+		for _, mg := range migrations {
+			registerSchema(mg.Up)
+		}
+	}
+}
+
+func lookupTable(name string) *tableInfo {
+	tablesMu.RLock()
+	defer tablesMu.RUnlock()
+	return tables[strings.ToLower(name)]
+}
+
+func tableEntry(name string) *tableInfo {
+	name = strings.ToLower(name)
+	info := tables[name]
+	if info == nil {
+		info = &tableInfo{keyed: make(map[string]bool), text: make(map[string]bool)}
+		tables[name] = info
+	}
+	return info
+}
+
+// registerSchema records tables and indexes from a SQLite script so that
+// keyed columns are known before their CREATE TABLE is translated
+func registerSchema(schema string) {
+	for _, statement := range splitStatements(schema) {
+		tokens := trimTokens(lex(statement))
+		if firstWord(tokens) != "CREATE" {
+			continue
+		}
+		if table, columns := parseCreateIndex(tokens); table != "" {
+			tablesMu.Lock()
+			info := tableEntry(table)
+			for _, column := range columns {
+				info.keyed[column] = true
+			}
+			tablesMu.Unlock()
+			continue
+		}
+		if table, body := parseCreateTable(tokens); table != "" {
+			registerTable(table, body)
+		}
+	}
+}
+
+// registerTable records the keys of a CREATE TABLE body
+func registerTable(table string, body []token) {
+	tablesMu.Lock()
+	defer tablesMu.Unlock()
+	info := tableEntry(table)
+	for _, def := range splitTopLevel(body) {
+		def = trimTokens(def)
+		if len(def) == 0 {
+			continue
+		}
+		switch firstWord(def) {
+		case "PRIMARY", "UNIQUE":
+			columns := parenColumns(def)
+			for _, column := range columns {
+				info.keyed[column] = true
+			}
+			if firstWord(def) == "PRIMARY" {
+				info.primaryKey = columns
+			}
+			continue
+		case "FOREIGN", "CHECK", "CONSTRAINT":
+			continue
+		}
+		column := strings.ToLower(unquoteIdent(def[0].text))
+		rendered := strings.ToUpper(render(def))
+		if strings.Contains(rendered, "PRIMARY KEY") {
+			info.keyed[column] = true
+			info.primaryKey = []string{column}
+			integer := len(def) > 2 && (def[2].is("INTEGER") || def[2].is("INT"))
+			if integer && (strings.Contains(rendered, "AUTOINCREMENT") || column == "id") {
+				info.serial = column
+			}
+		}
+		if strings.Contains(rendered, "UNIQUE") || strings.Contains(rendered, "REFERENCES") {
+			info.keyed[column] = true
+		}
+	}
+}
+
+// parenColumns returns the column names in the first parenthesised list
+func parenColumns(tokens []token) []string {
+	for i, t := range tokens {
+		if !t.isPunct("(") {
+			continue
+		}
+		end := closingParen(tokens, i)
+		if end < 0 {
+			return nil
+		}
+		var columns []string
+		for _, part := range splitTopLevel(tokens[i+1 : end]) {
+			part = trimTokens(part)
+			if len(part) > 0 {
+				columns = append(columns, strings.ToLower(unquoteIdent(part[0].text)))
+			}
+		}
+		return columns
+	}
+	return nil
+}
+
+// parseCreateTable returns the table name and the tokens between the outer
+// parentheses of a CREATE TABLE statement
+func parseCreateTable(tokens []token) (string, []token) {
+	i := findTopLevelWord(tokens, "TABLE")
+	if i < 0 {
+		return "", nil
+	}
+	i = nextToken(tokens, i+1)
+	if i < len(tokens) && tokens[i].is("IF") {
+		// IF NOT EXISTS
+		i = nextToken(tokens, nextToken(tokens, nextToken(tokens, i+1)+1)+1)
+	}
+	if i >= len(tokens) {
+		return "", nil
+	}
+	name := unquoteIdent(tokens[i].text)
+	open := nextToken(tokens, i+1)
+	if open >= len(tokens) || !tokens[open].isPunct("(") {
+		return "", nil
+	}
+	end := closingParen(tokens, open)
+	if end < 0 {
+		return "", nil
+	}
+	return name, tokens[open+1 : end]
+}
+
+// parseCreateIndex returns the table and columns of a CREATE INDEX statement
+func parseCreateIndex(tokens []token) (string, []string) {
+	if findTopLevelWord(tokens, "INDEX") < 0 {
+		return "", nil
+	}
+	on := findTopLevelWord(tokens, "ON")
+	if on < 0 {
+		return "", nil
+	}
+	i := nextToken(tokens, on+1)
+	if i >= len(tokens) {
+		return "", nil
+	}
+	return unquoteIdent(tokens[i].text), parenColumns(tokens[i:])
+}
+
+// --- DDL ---
+
+func (d Dialect) createStatement(tokens []token) ([]token, bool, error) {
+	if table, body := parseCreateTable(tokens); table != "" {
+		registerTable(table, body)
+		return d.createTable(tokens, table, body)
+	}
+	if table, _ := parseCreateIndex(tokens); table != "" {
+		return d.createIndex(tokens, table)
+	}
+	return tokens, false, nil
+}
+
+func (d Dialect) createTable(tokens []token, table string, body []token) ([]token, bool, error) {
+	info := lookupTable(table)
+	var defs []string
+	for _, def := range splitTopLevel(body) {
+		def = trimTokens(def)
+		if len(def) == 0 {
+			continue
+		}
+		switch firstWord(def) {
+		case "PRIMARY", "UNIQUE", "FOREIGN", "CHECK", "CONSTRAINT":
+			defs = append(defs, render(def))
+			continue
+		}
+		defs = append(defs, d.columnDefinition(table, info, def))
+	}
+
+	open := 0
+	for !tokens[open].isPunct("(") {
+		open++
+	}
+	// Table options after the definitions (WITHOUT ROWID, STRICT) are
+	// SQLite only and dropped
+	return lex(render(tokens[:open]) + "(\n\t" + strings.Join(defs, ",\n\t") + "\n)"), false, nil
+}
+
+var sqliteColumnConstraints = map[string]bool{
+	"PRIMARY": true, "NOT": true, "NULL": true, "DEFAULT": true, "UNIQUE": true, "CHECK": true,
+	"REFERENCES": true, "COLLATE": true, "CONSTRAINT": true, "AUTOINCREMENT": true, "GENERATED": true,
+}
+
+// columnDefinition translates one SQLite column definition
+func (d Dialect) columnDefinition(table string, info *tableInfo, def []token) string {
+	name := def[0].text
+	column := strings.ToLower(unquoteIdent(name))
+
+	// Type words run until the first constraint keyword
+	i := 1
+	var typeTokens []token
+	for i < len(def) {
+		t := def[i]
+		if t.kind == tokWord && sqliteColumnConstraints[strings.ToUpper(t.text)] {
+			break
+		}
+		typeTokens = append(typeTokens, t)
+		i++
+	}
+	constraints := def[i:]
+	sqliteType := strings.ToUpper(strings.TrimSpace(render(typeTokens)))
+
+	serial := info != nil && info.serial == column
+	keyed := info != nil && info.keyed[column]
+	columnType := d.columnType(sqliteType, keyed)
+	if serial {
+		columnType = "BIGINT"
+		if d == DialectPostgres {
+			columnType = "BIGSERIAL"
+		}
+	}
+
+	var rest []string
+	for j := 0; j < len(constraints); j++ {
+		t := constraints[j]
+		switch {
+		case t.is("AUTOINCREMENT"):
+			if d == DialectMySQL {
+				rest = append(rest, "AUTO_INCREMENT")
+			}
+			continue
+		case t.is("COLLATE"):
+			// SQLite collations (NOCASE, RTRIM) have no portable equivalent
+			j = nextToken(constraints, j+1)
+			continue
+		case t.is("TRUE") || t.is("FALSE"):
+			if strings.HasPrefix(columnType, "SMALLINT") || d == DialectMySQL {
+				rest = append(rest, map[bool]string{true: "1", false: "0"}[t.is("TRUE")])
+				continue
+			}
+		case t.is("DEFAULT") && d == DialectMySQL && isMySQLBlobType(columnType):
+			// MySQL only accepts expression defaults on TEXT and BLOB columns
+			k := nextToken(constraints, j+1)
+			if k < len(constraints) && constraints[k].kind == tokString {
+				rest = append(rest, "DEFAULT", " ", "("+constraints[k].text+")")
+				j = k
+				continue
+			}
+		}
+		rest = append(rest, t.text)
+	}
+
+	if serial && d == DialectMySQL && !strings.Contains(strings.ToUpper(strings.Join(rest, "")), "AUTO_INCREMENT") {
+		rest = append(rest, " AUTO_INCREMENT")
+	}
+
+	if info != nil && d == DialectMySQL {
+		tablesMu.Lock()
+		info.text[column] = isMySQLBlobType(columnType)
+		tablesMu.Unlock()
+	}
+	return strings.TrimRight(name+" "+columnType+" "+strings.TrimSpace(strings.Join(rest, "")), " ")
+}
+
+func isMySQLBlobType(columnType string) bool {
+	return strings.HasSuffix(columnType, "TEXT") || strings.HasSuffix(columnType, "BLOB")
+}
+
+// columnType maps a SQLite declared type. keyed columns are indexed, which
+// MySQL only allows on bounded VARCHAR columns
+func (d Dialect) columnType(sqliteType string, keyed bool) string {
+	base := sqliteType
+	if i := strings.IndexByte(base, '('); i >= 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+	switch base {
+	case "INTEGER", "INT", "BIGINT":
+		return "BIGINT"
+	case "SMALLINT", "TINYINT":
+		return "SMALLINT"
+	case "BOOLEAN", "BOOL":
+		if d == DialectMySQL {
+			return "BOOLEAN"
+		}
+		// SQLite booleans are integers and queries compare them to 0 and 1
+		return "SMALLINT"
+	case "REAL", "DOUBLE", "FLOAT", "DOUBLE PRECISION":
+		if d == DialectMySQL {
+			return "DOUBLE"
+		}
+		return "DOUBLE PRECISION"
+	case "NUMERIC", "DECIMAL":
+		return sqliteType
+	case "DATETIME", "TIMESTAMP", "DATE":
+		if d == DialectMySQL {
+			return "DATETIME"
+		}
+		return "TIMESTAMPTZ"
+	case "BLOB":
+		if d == DialectMySQL {
+			return "LONGBLOB"
+		}
+		return "BYTEA"
+	case "VARCHAR", "CHAR":
+		if d == DialectMySQL && sqliteType == base {
+			return "VARCHAR(255)"
+		}
+		return sqliteType
+	default:
+		// TEXT, JSON and untyped columns
+		if d == DialectMySQL {
+			if keyed {
+				return "VARCHAR(255)"
+			}
+			return "LONGTEXT"
+		}
+		return "TEXT"
+	}
+}
+
+func (d Dialect) createIndex(tokens []token, table string) ([]token, bool, error) {
+	if d != DialectMySQL {
+		return tokens, false, nil
+	}
+	// MySQL has no CREATE INDEX IF NOT EXISTS; duplicate index errors are
+	// ignored by the driver instead
+	ignore := false
+	if i := findTopLevelWord(tokens, "IF"); i >= 0 {
+		exists := findTopLevelWord(tokens, "EXISTS")
+		tokens = append(tokens[:i:i], tokens[nextToken(tokens, exists+1):]...)
+		ignore = true
+	}
+	// Partial indexes are not supported
+	if i := findTopLevelWord(tokens, "WHERE"); i >= 0 {
+		tokens = trimTokens(tokens[:i])
+	}
+	// Columns that stayed TEXT need a prefix length
+	info := lookupTable(table)
+	on := findTopLevelWord(tokens, "ON")
+	for open := on; open < len(tokens); open++ {
+		if !tokens[open].isPunct("(") {
+			continue
+		}
+		end := closingParen(tokens, open)
+		var parts []string
+		for _, part := range splitTopLevel(tokens[open+1 : end]) {
+			part = trimTokens(part)
+			column := strings.ToLower(unquoteIdent(part[0].text))
+			text := render(part)
+			if info != nil && info.text[column] && len(part) == 1 {
+				text += "(191)"
+			}
+			parts = append(parts, text)
+		}
+		tokens = splice(tokens, open, end+1, "("+strings.Join(parts, ", ")+")")
+		break
+	}
+	return tokens, ignore, nil
+}
+
+// alterStatement translates ALTER TABLE ... ADD COLUMN definitions
+func (d Dialect) alterStatement(tokens []token) ([]token, error) {
+	table := findTopLevelWord(tokens, "TABLE")
+	add := findTopLevelWord(tokens, "ADD")
+	if table < 0 || add < 0 {
+		return tokens, nil
+	}
+	name := unquoteIdent(tokens[nextToken(tokens, table+1)].text)
+	start := nextToken(tokens, add+1)
+	if start < len(tokens) && tokens[start].is("COLUMN") {
+		start = nextToken(tokens, start+1)
+	}
+	tablesMu.Lock()
+	info := tableEntry(name)
+	tablesMu.Unlock()
+	def := d.columnDefinition(name, info, trimTokens(tokens[start:]))
+	return splice(tokens, start, len(tokens), def), nil
+}
+
+// --- INSERT ---
+
+func (d Dialect) insertStatement(tokens []token, t *translation) ([]token, error) {
+	into := findTopLevelWord(tokens, "INTO")
+	if into < 0 {
+		return tokens, nil
+	}
+	nameAt := nextToken(tokens, into+1)
+	if nameAt >= len(tokens) {
+		return tokens, nil
+	}
+	t.table = unquoteIdent(tokens[nameAt].text)
+	if info := lookupTable(t.table); info != nil {
+		t.serial = info.serial
+	}
+	var columns []string
+	if open := nextToken(tokens, nameAt+1); open < len(tokens) && tokens[open].isPunct("(") {
+		columns = parenColumns(tokens[open:])
+	}
+
+	// INSERT OR IGNORE / INSERT OR REPLACE / REPLACE INTO
+	conflict := ""
+	if first := nextToken(tokens, 0); tokens[first].is("REPLACE") {
+		conflict = "REPLACE"
+		tokens = splice(tokens, first, first+1, "INSERT")
+	} else if or := nextToken(tokens, first+1); or < len(tokens) && tokens[or].is("OR") {
+		action := nextToken(tokens, or+1)
+		conflict = strings.ToUpper(tokens[action].text)
+		tokens = append(tokens[:or:or], tokens[nextToken(tokens, action+1):]...)
+	}
+
+	onConflict := findTopLevelWord(tokens, "CONFLICT")
+	if onConflict >= 0 {
+		onConflict = prevToken(tokens, onConflict)
+	}
+	returning := findTopLevelWord(tokens, "RETURNING")
+	end := len(tokens)
+	if returning >= 0 {
+		end = returning
+	}
+
+	switch d {
+	case DialectPostgres:
+		clause := ""
+		switch conflict {
+		case "IGNORE":
+			clause = "ON CONFLICT DO NOTHING"
+		case "REPLACE":
+			info := lookupTable(t.table)
+			if info == nil || len(info.primaryKey) == 0 || len(columns) == 0 {
+				return nil, fmt.Errorf("cannot translate INSERT OR REPLACE into %s: unknown primary key or column list", t.table)
+			}
+			clause = "ON CONFLICT (" + strings.Join(info.primaryKey, ", ") + ") DO " + excludedUpdate(columns, info.primaryKey)
+		}
+		if clause != "" && onConflict < 0 {
+			tokens = splice(tokens, end, end, " "+clause+" ")
+		}
+
+	case DialectMySQL:
+		first := nextToken(tokens, 0)
+		switch conflict {
+		case "IGNORE":
+			tokens = splice(tokens, first, first+1, "INSERT IGNORE")
+		case "REPLACE":
+			tokens = splice(tokens, first, first+1, "REPLACE")
+		}
+		if onConflict = findTopLevelWord(tokens, "CONFLICT"); onConflict >= 0 {
+			onConflict = prevToken(tokens, onConflict)
+			returning = findTopLevelWord(tokens, "RETURNING")
+			end = len(tokens)
+			if returning >= 0 {
+				end = returning
+			}
+			tokens = mysqlOnConflict(tokens, onConflict, end)
+		}
+		// RETURNING is emulated by the driver with a follow-up SELECT
+		if returning = findTopLevelWord(tokens, "RETURNING"); returning >= 0 {
+			t.returning = strings.TrimSpace(render(tokens[returning+1:]))
+			tokens = trimTokens(tokens[:returning])
+			if t.serial != "" && hasTopLevelWord(tokens, "DUPLICATE") {
+				// Report the id of the updated row as LAST_INSERT_ID()
+				tokens = append(tokens, lex(fmt.Sprintf(", %s = LAST_INSERT_ID(%s)", t.serial, t.serial))...)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// excludedUpdate builds the DO UPDATE clause replacing every non-key column
+func excludedUpdate(columns, key []string) string {
+	var sets []string
+	for _, column := range columns {
+		isKey := false
+		for _, k := range key {
+			isKey = isKey || k == column
+		}
+		if !isKey {
+			sets = append(sets, column+" = EXCLUDED."+column)
+		}
+	}
+	if len(sets) == 0 {
+		return "NOTHING"
+	}
+	return "UPDATE SET " + strings.Join(sets, ", ")
+}
+
+// mysqlOnConflict rewrites an ON CONFLICT clause between on and end as
+// ON DUPLICATE KEY UPDATE, or as INSERT IGNORE for DO NOTHING
+func mysqlOnConflict(tokens []token, on, end int) []token {
+	do := -1
+	for i := on; i < end; i++ {
+		if tokens[i].is("DO") {
+			do = i
+			break
+		}
+	}
+	if do < 0 {
+		return tokens
+	}
+	action := nextToken(tokens, do+1)
+	if tokens[action].is("NOTHING") {
+		tokens = splice(tokens, on, action+1, "")
+		first := nextToken(tokens, 0)
+		if next := nextToken(tokens, first+1); !tokens[next].is("IGNORE") {
+			tokens = splice(tokens, first, first+1, "INSERT IGNORE")
+		}
+		return tokens
+	}
+	// DO UPDATE SET
+	set := nextToken(tokens, action+1)
+	tokens = splice(tokens, on, set+1, "ON DUPLICATE KEY UPDATE")
+	for i := 0; i < len(tokens); i++ {
+		if !tokens[i].is("excluded") || i+2 >= len(tokens) || !tokens[i+1].isPunct(".") {
+			continue
+		}
+		tokens = splice(tokens, i, i+3, "VALUES("+tokens[i+2].text+")")
+	}
+	return tokens
+}
+
+// --- PRAGMA ---
+
+var pragmaPattern = regexp.MustCompile(`(?i)^PRAGMA\s+(\w+)\s*(?:\(\s*['"]?(\w+)['"]?\s*\)|=\s*(\S+))?$`)
+
+// pragma maps SQLite PRAGMA statements to equivalent queries. Settings
+// PRAGMAs have no equivalent and report "ok"
+func (d Dialect) pragma(tokens []token) string {
+	match := pragmaPattern.FindStringSubmatch(strings.TrimSpace(render(tokens)))
+	if match == nil {
+		return "SELECT 'ok'"
+	}
+	current := "current_schema()"
+	if d == DialectMySQL {
+		current = "DATABASE()"
+	}
+	switch strings.ToLower(match[1]) {
+	case "table_info":
+		return fmt.Sprintf(`SELECT ordinal_position - 1 AS cid, column_name AS name, data_type AS type, `+
+			`CASE WHEN is_nullable = 'NO' THEN 1 ELSE 0 END AS "notnull", column_default AS dflt_value, 0 AS pk `+
+			`FROM information_schema.columns WHERE table_schema = %s AND table_name = '%s' ORDER BY ordinal_position`,
+			current, strings.ReplaceAll(match[2], "'", "''"))
+	case "page_count":
+		// Reported in bytes with a page size of one
+		if d == DialectMySQL {
+			return "SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables WHERE table_schema = DATABASE()"
+		}
+		return "SELECT pg_database_size(current_database())"
+	case "page_size":
+		return "SELECT 1"
+	case "freelist_count":
+		return "SELECT 0"
+	default:
+		return "SELECT 'ok'"
+	}
+}
+
+// --- expressions ---
+
+// rewriteExpressions translates SQLite functions and keywords
+func (d Dialect) rewriteExpressions(tokens []token) []token {
+	out := make([]token, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind != tokWord {
+			out = append(out, t)
+			continue
+		}
+		word := strings.ToUpper(t.text)
+
+		if open := nextToken(tokens, i+1); open < len(tokens) && tokens[open].isPunct("(") {
+			if end := closingParen(tokens, open); end > 0 {
+				inner := d.rewriteExpressions(tokens[open+1 : end])
+				var args []string
+				for _, arg := range splitTopLevel(inner) {
+					args = append(args, strings.TrimSpace(render(arg)))
+				}
+				if replacement, ok := d.function(word, args); ok {
+					out = append(out, lex(replacement)...)
+					i = end
+					continue
+				}
+			}
+		}
+
+		switch word {
+		case "TRUE", "FALSE":
+			if d == DialectPostgres {
+				t.text = map[bool]string{true: "1", false: "0"}[word == "TRUE"]
+			}
+		case "LIKE":
+			// SQLite LIKE is case-insensitive
+			if d == DialectPostgres {
+				t.text = "ILIKE"
+			}
+		case "SQLITE_MASTER", "SQLITE_SCHEMA":
+			if p := prevToken(tokens, i); p >= 0 && (tokens[p].is("FROM") || tokens[p].is("JOIN")) {
+				t = token{tokWord, d.sqliteMaster()}
+			}
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// sqliteMaster returns a derived table shaped like sqlite_master
+func (d Dialect) sqliteMaster() string {
+	if d == DialectMySQL {
+		return "(SELECT table_name AS name, 'table' AS type, table_name AS tbl_name FROM information_schema.tables WHERE table_schema = DATABASE() " +
+			"UNION ALL SELECT DISTINCT index_name, 'index', table_name FROM information_schema.statistics WHERE table_schema = DATABASE()) AS sqlite_master"
+	}
+	return "(SELECT table_name AS name, 'table' AS type, table_name AS tbl_name FROM information_schema.tables WHERE table_schema = current_schema() " +
+		"UNION ALL SELECT indexname, 'index', tablename FROM pg_indexes WHERE schemaname = current_schema()) AS sqlite_master"
+}
+
+var (
+	modifierPattern = regexp.MustCompile(`^'([+-]?\d+(?:\.\d+)?)\s*(second|minute|hour|day|month|year)s?'$`)
+	concatPattern   = regexp.MustCompile(`^'([+-])'\s*\|\|\s*(.+?)\s*\|\|\s*'\s*(second|minute|hour|day|month|year)s?'$`)
+)
+
+// function translates a SQLite function call, reporting false to keep it
+func (d Dialect) function(name string, args []string) (string, bool) {
+	switch name {
+	case "DATETIME":
+		return d.datetime(args)
+	case "JULIANDAY":
+		if len(args) != 1 {
+			return "", false
+		}
+		if d == DialectMySQL {
+			return "(UNIX_TIMESTAMP(" + d.timeValue(args[0]) + ") / 86400.0 + 2440587.5)", true
+		}
+		return "(EXTRACT(EPOCH FROM " + d.timeValue(args[0]) + ") / 86400.0 + 2440587.5)", true
+	case "STRFTIME":
+		if len(args) != 2 || args[0] != "'%s'" {
+			return "", false
+		}
+		if d == DialectMySQL {
+			return "UNIX_TIMESTAMP(" + d.timeValue(args[1]) + ")", true
+		}
+		return "CAST(EXTRACT(EPOCH FROM " + d.timeValue(args[1]) + ") AS BIGINT)", true
+	case "IFNULL":
+		return "COALESCE(" + strings.Join(args, ", ") + ")", d == DialectPostgres
+	case "RANDOM":
+		return "RAND()", d == DialectMySQL && len(args) == 1 && args[0] == ""
+	case "CAST":
+		return d.cast(args)
+	}
+	return "", false
+}
+
+// timeValue converts a SQLite time value ('now' or an expression)
+func (d Dialect) timeValue(arg string) string {
+	if strings.EqualFold(arg, "'now'") {
+		return "CURRENT_TIMESTAMP"
+	}
+	if d == DialectMySQL {
+		return "CAST(" + arg + " AS DATETIME)"
+	}
+	return "CAST(" + arg + " AS TIMESTAMPTZ)"
+}
+
+func (d Dialect) datetime(args []string) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+	if len(args) == 2 && strings.EqualFold(args[1], "'unixepoch'") {
+		if d == DialectMySQL {
+			return "FROM_UNIXTIME(" + args[0] + ")", true
+		}
+		return "to_timestamp(" + args[0] + ")", true
+	}
+	expr := d.timeValue(args[0])
+	for _, modifier := range args[1:] {
+		if m := modifierPattern.FindStringSubmatch(strings.ToLower(modifier)); m != nil {
+			if d == DialectMySQL {
+				expr = fmt.Sprintf("(%s + INTERVAL %s %s)", expr, m[1], strings.ToUpper(m[2]))
+			} else {
+				expr = fmt.Sprintf("(%s + INTERVAL '%s %ss')", expr, m[1], m[2])
+			}
+			continue
+		}
+		if m := concatPattern.FindStringSubmatch(modifier); m != nil {
+			unit := strings.ToLower(m[3])
+			if d == DialectMySQL {
+				expr = fmt.Sprintf("(%s %s INTERVAL %s %s)", expr, m[1], m[2], strings.ToUpper(unit))
+			} else {
+				field := map[string]string{"second": "secs", "minute": "mins", "hour": "hours", "day": "days", "month": "months", "year": "years"}[unit]
+				expr = fmt.Sprintf("(%s %s make_interval(%s => CAST(%s AS INTEGER)))", expr, m[1], field, m[2])
+			}
+			continue
+		}
+		if d == DialectPostgres && !strings.HasPrefix(modifier, "'") {
+			// A bound modifier such as '-30 days' is a valid interval
+			expr = fmt.Sprintf("(%s + CAST(%s AS INTERVAL))", expr, modifier)
+			continue
+		}
+		return "", false
+	}
+	return expr, true
+}
+
+var castTypes = map[Dialect]map[string]string{
+	DialectPostgres: {"REAL": "DOUBLE PRECISION", "INTEGER": "BIGINT", "INT": "BIGINT", "DATETIME": "TIMESTAMPTZ", "BLOB": "BYTEA"},
+	DialectMySQL:    {"REAL": "DOUBLE", "INTEGER": "SIGNED", "INT": "SIGNED", "BIGINT": "SIGNED", "TEXT": "CHAR", "BLOB": "BINARY"},
+}
+
+func (d Dialect) cast(args []string) (string, bool) {
+	if len(args) != 1 {
+		return "", false
+	}
+	tokens := lex(args[0])
+	as := -1
+	for i, t := range tokens {
+		if t.is("AS") {
+			as = i
+		}
+	}
+	if as < 0 {
+		return "", false
+	}
+	target := strings.ToUpper(strings.TrimSpace(render(tokens[as+1:])))
+	mapped, ok := castTypes[d][target]
+	if !ok {
+		return "", false
+	}
+	return "CAST(" + strings.TrimSpace(render(tokens[:as])) + " AS " + mapped + ")", true
+}
+
+// mysqlReserved are column names used by the schema that MySQL reserves
+var mysqlReserved = map[string]bool{"KEY": true, "GROUPS": true, "READ": true}
+
+// quoteMySQLIdentifiers backtick-quotes reserved words used as identifiers
+func quoteMySQLIdentifiers(tokens []token) []token {
+	for i, t := range tokens {
+		if t.kind != tokWord || !mysqlReserved[strings.ToUpper(t.text)] {
+			continue
+		}
+		if p := prevToken(tokens, i); p >= 0 {
+			switch strings.ToUpper(tokens[p].text) {
+			case "PRIMARY", "FOREIGN", "UNIQUE", "DUPLICATE":
+				continue
+			}
+		}
+		tokens[i].text = "`" + t.text + "`"
+	}
+	return tokens
+}
@@ -0,0 +1,352 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// Drivers that translate SQLite flavoured SQL before handing it to the
+// PostgreSQL and MySQL drivers, so models keep a single set of queries
+const (
+	postgresDriverName = "weather-postgres"
+	mysqlDriverName    = "weather-mysql"
+)
+
+func init() {
+	sql.Register(postgresDriverName, NewDialectDriver(DialectPostgres, stdlib.GetDefaultDriver()))
+	sql.Register(mysqlDriverName, NewDialectDriver(DialectMySQL, &mysql.MySQLDriver{}))
+}
+
+// NewDialectDriver wraps parent so it runs SQLite flavoured SQL translated
+// to dialect
+func NewDialectDriver(dialect Dialect, parent driver.Driver) driver.Driver {
+	return &dialectDriver{dialect: dialect, parent: parent}
+}
+
+type dialectDriver struct {
+	dialect Dialect
+	parent  driver.Driver
+}
+
+func (d *dialectDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.parent.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &dialectConn{dialect: d.dialect, parent: conn}, nil
+}
+
+type dialectConn struct {
+	dialect Dialect
+	parent  driver.Conn
+}
+
+func (c *dialectConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *dialectConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	t, err := c.dialect.translate(query)
+	if err != nil {
+		return nil, err
+	}
+	prepared := t.query
+	if returning := t.insertReturningID(); returning != "" && c.dialect == DialectPostgres {
+		prepared = returning
+	}
+	var stmt driver.Stmt
+	if preparer, ok := c.parent.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, prepared)
+	} else {
+		stmt, err = c.parent.Prepare(prepared)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dialectStmt{conn: c, parent: stmt, t: t}, nil
+}
+
+func (c *dialectConn) Close() error {
+	return c.parent.Close()
+}
+
+func (c *dialectConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *dialectConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.parent.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.parent.Begin()
+}
+
+func (c *dialectConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.parent.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	statements := splitStatements(query)
+	if len(statements) > 1 && len(args) == 0 {
+		// Scripts run one statement at a time; neither driver is
+		// configured for multi-statement execution
+		var affected int64
+		for _, statement := range statements {
+			result, err := c.ExecContext(ctx, statement, nil)
+			if err != nil {
+				return nil, err
+			}
+			n, _ := result.RowsAffected()
+			affected += n
+		}
+		return driver.RowsAffected(affected), nil
+	}
+
+	t, err := c.dialect.translate(query)
+	if err != nil {
+		return nil, err
+	}
+	if t.query == "" {
+		return driver.RowsAffected(0), nil
+	}
+	if returning := t.insertReturningID(); returning != "" && c.dialect == DialectPostgres {
+		queryer, ok := c.parent.(driver.QueryerContext)
+		if !ok {
+			return nil, driver.ErrSkip
+		}
+		rows, err := queryer.QueryContext(ctx, returning, args)
+		if err != nil {
+			return nil, err
+		}
+		return insertedIDs(rows)
+	}
+	if t.returning != "" {
+		rows, err := c.queryReturning(ctx, t, func() (driver.Result, error) {
+			return execer.ExecContext(ctx, t.query, args)
+		})
+		if err != nil {
+			return nil, err
+		}
+		rows.Close()
+		return driver.RowsAffected(1), nil
+	}
+	result, err := execer.ExecContext(ctx, t.query, args)
+	if err != nil && t.ignoreExists && isDuplicateObject(err) {
+		return driver.RowsAffected(0), nil
+	}
+	return result, err
+}
+
+func (c *dialectConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.parent.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	t, err := c.dialect.translate(query)
+	if err != nil {
+		return nil, err
+	}
+	if t.returning != "" {
+		execer, ok := c.parent.(driver.ExecerContext)
+		if !ok {
+			return nil, driver.ErrSkip
+		}
+		return c.queryReturning(ctx, t, func() (driver.Result, error) {
+			return execer.ExecContext(ctx, t.query, args)
+		})
+	}
+	return queryer.QueryContext(ctx, t.query, args)
+}
+
+// queryReturning emulates INSERT ... RETURNING on MySQL by running the
+// insert and selecting the inserted row by its id on the same connection
+func (c *dialectConn) queryReturning(ctx context.Context, t *translation, insert func() (driver.Result, error)) (driver.Rows, error) {
+	if t.serial == "" {
+		return nil, fmt.Errorf("RETURNING is not supported on %s for table %s without an integer id", c.dialect, t.table)
+	}
+	queryer, ok := c.parent.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	result, err := insert()
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	// The id is inlined: the MySQL driver only binds arguments through
+	// prepared statements
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %d", t.returning, t.table, t.serial, id)
+	return queryer.QueryContext(ctx, query, nil)
+}
+
+func (c *dialectConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.parent.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *dialectConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.parent.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *dialectConn) IsValid() bool {
+	if validator, ok := c.parent.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// CheckNamedValue stores booleans as 0 and 1, matching SQLite and the
+// integer columns booleans are translated to
+func (c *dialectConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if b, ok := nv.Value.(bool); ok {
+		nv.Value = int64(0)
+		if b {
+			nv.Value = int64(1)
+		}
+		return nil
+	}
+	if checker, ok := c.parent.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type dialectStmt struct {
+	conn   *dialectConn
+	parent driver.Stmt
+	t      *translation
+}
+
+func (s *dialectStmt) Close() error {
+	return s.parent.Close()
+}
+
+func (s *dialectStmt) NumInput() int {
+	return s.parent.NumInput()
+}
+
+func (s *dialectStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *dialectStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *dialectStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if s.conn.dialect == DialectPostgres && s.t.insertReturningID() != "" {
+		rows, err := s.query(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		return insertedIDs(rows)
+	}
+	if s.t.returning != "" {
+		rows, err := s.conn.queryReturning(ctx, s.t, func() (driver.Result, error) { return s.exec(ctx, args) })
+		if err != nil {
+			return nil, err
+		}
+		rows.Close()
+		return driver.RowsAffected(1), nil
+	}
+	return s.exec(ctx, args)
+}
+
+func (s *dialectStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if s.t.returning != "" {
+		return s.conn.queryReturning(ctx, s.t, func() (driver.Result, error) { return s.exec(ctx, args) })
+	}
+	return s.query(ctx, args)
+}
+
+func (s *dialectStmt) exec(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := s.parent.(driver.StmtExecContext); ok {
+		return execer.ExecContext(ctx, args)
+	}
+	return s.parent.Exec(values(args))
+}
+
+func (s *dialectStmt) query(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if queryer, ok := s.parent.(driver.StmtQueryContext); ok {
+		return queryer.QueryContext(ctx, args)
+	}
+	return s.parent.Query(values(args))
+}
+
+func (s *dialectStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	return s.conn.CheckNamedValue(nv)
+}
+
+// insertResult reports the ids returned by a translated INSERT
+type insertResult struct {
+	id       int64
+	affected int64
+}
+
+func (r insertResult) LastInsertId() (int64, error) { return r.id, nil }
+func (r insertResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+// insertedIDs drains INSERT ... RETURNING id rows into a result
+func insertedIDs(rows driver.Rows) (driver.Result, error) {
+	defer rows.Close()
+	var result insertResult
+	dest := make([]driver.Value, len(rows.Columns()))
+	for {
+		err := rows.Next(dest)
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.affected++
+		switch id := dest[0].(type) {
+		case int64:
+			result.id = id
+		case int32:
+			result.id = int64(id)
+		}
+	}
+}
+
+// isDuplicateObject reports MySQL errors for indexes or columns that
+// already exist
+func isDuplicateObject(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// ER_DUP_KEYNAME, ER_DUP_FIELDNAME
+		return mysqlErr.Number == 1061 || mysqlErr.Number == 1060
+	}
+	return false
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	plain := make([]driver.Value, len(args))
+	for i, nv := range args {
+		plain[i] = nv.Value
+	}
+	return plain
+}
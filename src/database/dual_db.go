@@ -19,11 +19,46 @@ type DualDB struct {
 
 	// Users database (users.db) - user accounts, tokens, sessions, etc.
 	Users *sql.DB
+
+	// Dialect of both connections
+	Dialect Dialect
 }
 
 // InitDualDB initializes both server and users databases
 // AI.md: Database paths must be {data_dir}/db/server.db and {data_dir}/db/users.db
 func InitDualDB(dataDir string) (*DualDB, error) {
+	return InitDualDBWithConfig(dataDir, nil)
+}
+
+// InitDualDBWithConfig initializes the server and users databases from the
+// database config and applies pending migrations to both
+func InitDualDBWithConfig(dataDir string, config *DatabaseConfig) (*DualDB, error) {
+	ddb, err := OpenDualDB(dataDir, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := ddb.Migrate(nil); err != nil {
+		ddb.Close()
+		return nil, err
+	}
+	return ddb, nil
+}
+
+// OpenDualDB connects to the server and users databases without changing
+// their schema. A nil config or the file/sqlite driver uses SQLite files in
+// {data_dir}/db; PostgreSQL and MySQL use two databases on one server
+func OpenDualDB(dataDir string, config *DatabaseConfig) (*DualDB, error) {
+	dialect := DialectSQLite
+	if config != nil {
+		var err error
+		if dialect, err = ParseDialect(config.Type); err != nil {
+			return nil, err
+		}
+	}
+	if dialect != DialectSQLite {
+		return openRemoteDualDB(config, dialect)
+	}
+
 	if dataDir == "" {
 		dataDir = "./data"
 	}
@@ -41,84 +76,124 @@ func InitDualDB(dataDir string) (*DualDB, error) {
 	log.Printf("  Server DB: %s", serverDBPath)
 	log.Printf("  Users DB:  %s", usersDBPath)
 
-	// Initialize server database
-	serverDB, err := initServerDB(serverDBPath)
+	serverDB, err := openSQLiteDB(serverDBPath, "server")
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize server database: %w", err)
 	}
 
-	// Initialize users database
-	usersDB, err := initUsersDB(usersDBPath)
+	usersDB, err := openSQLiteDB(usersDBPath, "users")
 	if err != nil {
 		serverDB.Close()
 		return nil, fmt.Errorf("failed to initialize users database: %w", err)
 	}
 
 	return &DualDB{
-		Server: serverDB,
-		Users:  usersDB,
+		Server:  serverDB,
+		Users:   usersDB,
+		Dialect: DialectSQLite,
 	}, nil
 }
 
-// initServerDB initializes the server database with server schema
-func initServerDB(path string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open server database: %w", err)
+// Migrate applies pending migrations to the server and then the users
+// database. beforeApply, if set, runs before a database holding data is
+// changed
+func (ddb *DualDB) Migrate(beforeApply func(database, direction string, plan []Migration) error) error {
+	if err := MigrateDatabase(ddb.Server, ddb.Dialect, MigrationsServer, beforeApply); err != nil {
+		return fmt.Errorf("failed to migrate server database: %w", err)
 	}
+	if err := MigrateDatabase(ddb.Users, ddb.Dialect, MigrationsUsers, beforeApply); err != nil {
+		return fmt.Errorf("failed to migrate users database: %w", err)
+	}
+	return nil
+}
 
-	// Set connection parameters
-	db.SetConnMaxLifetime(time.Minute * 3)
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(5)
-
-	// Test connection
-	if err := db.Ping(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to connect to server database: %w", err)
+// Migrator returns the migrator of the server or users database
+func (ddb *DualDB) Migrator(database string) (*Migrator, error) {
+	switch database {
+	case MigrationsServer:
+		return NewMigrator(ddb.Server, ddb.Dialect, database)
+	case MigrationsUsers:
+		return NewMigrator(ddb.Users, ddb.Dialect, database)
+	default:
+		return nil, fmt.Errorf("unknown database %q: use server or users", database)
 	}
+}
 
-	// Enable SQLite optimizations
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
+// DualDatabaseNames returns the server and users database names for a
+// PostgreSQL or MySQL deployment
+func (config *DatabaseConfig) DualDatabaseNames() (string, string) {
+	base := config.Database
+	if base == "" {
+		base = "weather"
 	}
-	if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
+	server, users := config.ServerDatabase, config.UsersDatabase
+	if server == "" {
+		server = base + "_server"
 	}
+	if users == "" {
+		users = base + "_users"
+	}
+	return server, users
+}
 
-	// Create server schema
-	if _, err := db.Exec(ServerSchema); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to create server schema: %w", err)
+// openRemoteDualDB connects to the server and users databases on a
+// PostgreSQL or MySQL server. The databases must already exist
+func openRemoteDualDB(config *DatabaseConfig, dialect Dialect) (*DualDB, error) {
+	serverName, usersName := config.DualDatabaseNames()
+
+	log.Printf("Initializing dual databases (%s on %s):", dialect, config.Host)
+	log.Printf("  Server DB: %s", serverName)
+	log.Printf("  Users DB:  %s", usersName)
+
+	serverDB, err := openRemoteDB(config, serverName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize server database: %w", err)
 	}
 
-	// Check and initialize schema version
-	var currentVersion int
-	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&currentVersion)
+	usersDB, err := openRemoteDB(config, usersName)
 	if err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to check schema version: %w", err)
+		serverDB.Close()
+		return nil, fmt.Errorf("failed to initialize users database: %w", err)
 	}
 
-	if currentVersion == 0 {
-		// New database - insert schema version
-		if _, err := db.Exec("INSERT INTO schema_version (version) VALUES (?)", ServerSchemaVersion); err != nil {
-			db.Close()
-			return nil, fmt.Errorf("failed to insert schema version: %w", err)
-		}
-		log.Printf("Server database initialized with schema version %d", ServerSchemaVersion)
+	return &DualDB{
+		Server:  serverDB,
+		Users:   usersDB,
+		Dialect: dialect,
+	}, nil
+}
+
+// openRemoteDB opens a pooled connection to one database
+func openRemoteDB(config *DatabaseConfig, name string) (*sql.DB, error) {
+	driver, dsn, err := config.driverAndDSN(name)
+	if err != nil {
+		return nil, err
 	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", name, err)
+	}
+
+	poolCfg := config.Pool
+	if poolCfg.MaxOpen == 0 {
+		poolCfg = DefaultPoolConfig()
+	}
+	ApplyPoolConfig(db, poolCfg)
 
+	if err := PingWithTimeout(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database %s: %w", name, err)
+	}
 	return db, nil
 }
 
-// initUsersDB initializes the users database with users schema
-func initUsersDB(path string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", path)
+// openSQLiteDB opens a SQLite database file with foreign keys and WAL
+func openSQLiteDB(path, label string) (*sql.DB, error) {
+	// Writers wait for the lock instead of failing at once, e.g. while
+	// WAL replication checkpoints the database
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)")
 	if err != nil {
-		return nil, fmt.Errorf("failed to open users database: %w", err)
+		return nil, fmt.Errorf("failed to open %s database: %w", label, err)
 	}
 
 	// Set connection parameters
@@ -129,7 +204,7 @@ func initUsersDB(path string) (*sql.DB, error) {
 	// Test connection
 	if err := db.Ping(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to connect to users database: %w", err)
+		return nil, fmt.Errorf("failed to connect to %s database: %w", label, err)
 	}
 
 	// Enable SQLite optimizations
@@ -142,29 +217,6 @@ func initUsersDB(path string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
 	}
 
-	// Create users schema
-	if _, err := db.Exec(UsersSchema); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to create users schema: %w", err)
-	}
-
-	// Check and initialize schema version
-	var currentVersion int
-	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&currentVersion)
-	if err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to check schema version: %w", err)
-	}
-
-	if currentVersion == 0 {
-		// New database - insert schema version
-		if _, err := db.Exec("INSERT INTO schema_version (version) VALUES (?)", UsersSchemaVersion); err != nil {
-			db.Close()
-			return nil, fmt.Errorf("failed to insert schema version: %w", err)
-		}
-		log.Printf("Users database initialized with schema version %d", UsersSchemaVersion)
-	}
-
 	return db, nil
 }
 
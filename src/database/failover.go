@@ -3,47 +3,192 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/oklog/ulid/v2"
 )
 
-// FailoverManager handles database failover and read-only mode
+// ErrWriteQueued is returned by writes queued while the primary is down
+var ErrWriteQueued = errors.New("database unavailable - write queued for retry")
+
+// ErrTxUnavailable is returned by transactions started while writes are queued
+var ErrTxUnavailable = errors.New("database unavailable - transactions cannot be queued")
+
+// FailoverManager handles database failover and read-only mode. Writes made
+// while the primary is down are queued and replayed in order, one
+// transaction each, once it recovers. The primary needs the failover_*
+// tables from the server and users migrations
 type FailoverManager struct {
-	primaryDB   *sql.DB
+	primaryDB *sql.DB
+	// Handle that runs every statement through the manager
+	db *sql.DB
 	// SQLite fallback
-	cacheDB     *sql.DB
+	cacheDB  *sql.DB
+	replicas []*replica
+	// Round-robin position over the replicas
+	nextReplica int
+	maxLag      time.Duration
+	interval    time.Duration
+	queue       *writeQueue
 	readOnly    bool
-	writeQueue  []QueuedWrite
+	maxAttempts int
+	// Queued write replay stopped at; each check retries it until it
+	// becomes a dead letter or ResolveConflict is called
+	conflict    *ReplayConflict
+	lastReplay  *ReplayReport
+	onConflict  func(*ReplayReport)
 	mu          sync.RWMutex
+	replayMu    sync.Mutex
 	lastError   error
 	lastErrorAt time.Time
-	retryTicker *time.Ticker
 	stopChan    chan struct{}
+	closeOnce   sync.Once
+}
+
+// FailoverOptions configures the write queue and read replicas
+type FailoverOptions struct {
+	// Append-only file the write queue is kept in so queued writes survive a
+	// restart; empty keeps them in memory
+	QueuePath string
+	// Read replicas by name; Query and QueryRow are spread over the ones
+	// that keep up with the primary
+	Replicas map[string]*sql.DB
+	// Replicas further behind the primary serve no reads (default: 10s)
+	MaxReplicaLag time.Duration
+	// How often the primary and replicas are checked (default: 30s)
+	CheckInterval time.Duration
+	// Replays of a write the primary rejects before it is set aside as a
+	// dead letter and the writes behind it are replayed (default: 5)
+	MaxReplayAttempts int
+	// Called when replay first stops on a write that conflicts with the
+	// primary, and when writes are set aside as dead letters
+	OnReplayConflict func(*ReplayReport)
+}
+
+// replica is a read replica and the result of its last check
+type replica struct {
+	name      string
+	db        *sql.DB
+	lag       time.Duration
+	checkedAt time.Time
+	err       error
 }
 
-// QueuedWrite represents a write operation that needs to be executed when database recovers
-type QueuedWrite struct {
-	Query     string
-	Args      []interface{}
-	Timestamp time.Time
+// ReplicaStatus is a read replica's health for the admin panel
+type ReplicaStatus struct {
+	Name      string    `json:"name"`
+	Healthy   bool      `json:"healthy"`
+	LagMS     int64     `json:"lag_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ReplayReport describes one replay of queued writes
+type ReplayReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Applied    int       `json:"applied"`
+	// Writes whose idempotency key the primary already had, or skipped by an admin
+	Skipped   int `json:"skipped"`
+	Remaining int `json:"remaining"`
+	// Write the replay stopped at because the primary rejected it
+	Conflict *ReplayConflict `json:"conflict,omitempty"`
+	// Writes set aside during this replay after their last attempt
+	DeadLetters []ReplayConflict `json:"dead_letters,omitempty"`
+	// Set when the primary went away again during replay
+	Error string `json:"error,omitempty"`
+}
+
+// ReplayConflict is a queued write the primary rejected during replay
+type ReplayConflict struct {
+	Seq        int64     `json:"seq"`
+	Key        string    `json:"key"`
+	QueuedAt   time.Time `json:"queued_at"`
+	Statements []string  `json:"statements"`
+	Error      string    `json:"error"`
+	Attempts   int       `json:"attempts"`
+	// Set once the write is a dead letter
+	DeadAt *time.Time `json:"dead_at,omitempty"`
+}
+
+// FailoverStatus is the failover state shown in the admin panel
+type FailoverStatus struct {
+	ReadOnly     bool            `json:"read_only"`
+	LastError    string          `json:"last_error,omitempty"`
+	LastErrorAt  *time.Time      `json:"last_error_at,omitempty"`
+	QueuedWrites int             `json:"queued_writes"`
+	Conflict     *ReplayConflict `json:"conflict,omitempty"`
+	// Writes the primary rejected on every attempt, waiting for an admin to
+	// requeue or discard them
+	DeadLetters []ReplayConflict `json:"dead_letters"`
+	LastReplay  *ReplayReport    `json:"last_replay,omitempty"`
+	Replicas    []ReplicaStatus  `json:"replicas"`
 }
 
 // NewFailoverManager creates a new failover manager
 func NewFailoverManager(primaryDB *sql.DB, cacheDB *sql.DB) *FailoverManager {
+	// Without a queue file nothing can fail to open
+	fm, _ := NewFailoverManagerWithOptions(primaryDB, cacheDB, FailoverOptions{})
+	return fm
+}
+
+// NewFailoverManagerWithOptions creates a failover manager with a durable
+// write queue and read replicas. cacheDB may be nil; reads during an outage
+// then go to any reachable replica
+func NewFailoverManagerWithOptions(primaryDB *sql.DB, cacheDB *sql.DB, opts FailoverOptions) (*FailoverManager, error) {
+	queue, err := openWriteQueue(opts.QueuePath)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxReplicaLag <= 0 {
+		opts.MaxReplicaLag = 10 * time.Second
+	}
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = 30 * time.Second
+	}
+	if opts.MaxReplayAttempts <= 0 {
+		opts.MaxReplayAttempts = 5
+	}
+
 	fm := &FailoverManager{
-		primaryDB:  primaryDB,
-		cacheDB:    cacheDB,
-		readOnly:   false,
-		writeQueue: make([]QueuedWrite, 0),
-		stopChan:   make(chan struct{}),
+		primaryDB:   primaryDB,
+		cacheDB:     cacheDB,
+		maxLag:      opts.MaxReplicaLag,
+		interval:    opts.CheckInterval,
+		queue:       queue,
+		maxAttempts: opts.MaxReplayAttempts,
+		onConflict:  opts.OnReplayConflict,
+		stopChan:    make(chan struct{}),
+	}
+	fm.db = sql.OpenDB(&failoverConnector{fm: fm})
+	names := make([]string, 0, len(opts.Replicas))
+	for name := range opts.Replicas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		// Unchecked replicas serve no reads until the first check
+		fm.replicas = append(fm.replicas, &replica{name: name, db: opts.Replicas[name], err: errors.New("not checked yet")})
+	}
+	if n := queue.len(); n > 0 {
+		log.Printf("📝 %d queued writes from before the last shutdown will be replayed", n)
+	}
+	if n := len(queue.deadLetters()); n > 0 {
+		log.Printf("⚠️  %d queued writes the database rejected wait for an admin (Admin → Database)", n)
 	}
 
 	// Start monitoring goroutine
 	go fm.monitorPrimaryDB()
 
-	return fm
+	return fm, nil
 }
 
 // IsReadOnly returns whether the system is in read-only mode
@@ -60,78 +205,177 @@ func (fm *FailoverManager) GetLastError() (error, time.Time) {
 	return fm.lastError, fm.lastErrorAt
 }
 
-// Query executes a SELECT query (reads from cache if in read-only mode)
+// Query executes a SELECT query on a replica that keeps up with the primary,
+// falling back to the primary (or the cache in read-only mode)
 func (fm *FailoverManager) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	fm.mu.RLock()
-	readOnly := fm.readOnly
-	fm.mu.RUnlock()
+	return fm.QueryContext(context.Background(), query, args...)
+}
 
-	if readOnly {
-		// Use cache DB for reads
-		return fm.cacheDB.Query(query, args...)
+// QueryContext is Query with a context. Statements that write, such as an
+// INSERT with RETURNING, always go to the primary
+func (fm *FailoverManager) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if !isReadQuery(query) {
+		rows, err := fm.primaryDB.QueryContext(ctx, query, args...)
+		if err != nil && !fm.primaryReachable() {
+			fm.handlePrimaryFailure(err)
+		}
+		return rows, err
+	}
+
+	if fm.IsReadOnly() {
+		return fm.fallbackDB().QueryContext(ctx, query, args...)
+	}
+
+	if r := fm.pickReplica(false); r != nil {
+		rows, err := r.db.QueryContext(ctx, query, args...)
+		if err == nil {
+			return rows, nil
+		}
+		fm.markReplicaDown(r, err)
 	}
 
 	// Try primary DB
-	rows, err := fm.primaryDB.Query(query, args...)
-	if err != nil {
+	rows, err := fm.primaryDB.QueryContext(ctx, query, args...)
+	if err != nil && !fm.primaryReachable() {
 		// Primary DB failed, switch to read-only mode
 		fm.handlePrimaryFailure(err)
-		// Fallback to cache
-		return fm.cacheDB.Query(query, args...)
+		return fm.fallbackDB().QueryContext(ctx, query, args...)
 	}
 
-	return rows, nil
+	return rows, err
 }
 
-// QueryRow executes a single-row query (reads from cache if in read-only mode)
+// QueryRow executes a single-row query on a replica that keeps up with the
+// primary, falling back to the primary (or the cache in read-only mode)
 func (fm *FailoverManager) QueryRow(query string, args ...interface{}) *sql.Row {
-	fm.mu.RLock()
-	readOnly := fm.readOnly
-	fm.mu.RUnlock()
+	if fm.IsReadOnly() {
+		return fm.fallbackDB().QueryRow(query, args...)
+	}
 
-	if readOnly {
-		// Use cache DB for reads
-		return fm.cacheDB.QueryRow(query, args...)
+	if r := fm.pickReplica(false); r != nil {
+		row := r.db.QueryRow(query, args...)
+		if err := row.Err(); err == nil {
+			return row
+		}
+		fm.markReplicaDown(r, row.Err())
 	}
 
 	// Use primary DB
 	return fm.primaryDB.QueryRow(query, args...)
 }
 
-// Exec executes a write query (queues if in read-only mode)
+// Exec executes a write query. While the primary is down, or earlier writes
+// are still queued, the write is queued and ErrWriteQueued returned
 func (fm *FailoverManager) Exec(query string, args ...interface{}) (sql.Result, error) {
-	fm.mu.RLock()
-	readOnly := fm.readOnly
-	fm.mu.RUnlock()
+	return fm.ExecContext(context.Background(), query, args...)
+}
 
-	if readOnly {
-		// Queue write for later
-		fm.queueWrite(query, args...)
-		return nil, fmt.Errorf("database unavailable - write queued for retry")
+// ExecContext is Exec with a context
+func (fm *FailoverManager) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	write := QueuedWrite{Statements: []Statement{{Query: query, Args: args}}}
+	if fm.mustQueue() {
+		return nil, fm.queueWrite(write, nil)
 	}
 
 	// Try primary DB
-	result, err := fm.primaryDB.Exec(query, args...)
-	if err != nil {
+	result, err := fm.primaryDB.ExecContext(ctx, query, args...)
+	if err != nil && !fm.primaryReachable() {
 		// Primary DB failed, queue write and switch to read-only
 		fm.handlePrimaryFailure(err)
-		fm.queueWrite(query, args...)
-		return nil, fmt.Errorf("database unavailable - write queued for retry: %w", err)
+		return nil, fm.queueWrite(write, err)
 	}
 
-	return result, nil
+	return result, err
 }
 
-// queueWrite adds a write operation to the queue
-func (fm *FailoverManager) queueWrite(query string, args ...interface{}) {
-	fm.mu.Lock()
-	defer fm.mu.Unlock()
+// ExecTx executes statements in one transaction, queued as a unit while
+// the primary is down. A non-empty key makes the write idempotent: a key
+// the primary has already applied is skipped
+func (fm *FailoverManager) ExecTx(key string, statements ...Statement) error {
+	write := QueuedWrite{Key: key, Statements: statements, Timestamp: time.Now()}
+	if fm.mustQueue() {
+		return fm.queueWrite(write, nil)
+	}
+
+	_, err := fm.applyWrite(context.Background(), write)
+	if err != nil && !fm.primaryReachable() {
+		fm.handlePrimaryFailure(err)
+		return fm.queueWrite(write, err)
+	}
+	return err
+}
+
+// BeginTx starts a transaction on the primary. Transactions are not queued:
+// while the primary is down, or queued writes wait for replay, BeginTx
+// fails with ErrTxUnavailable
+func (fm *FailoverManager) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if fm.mustQueue() {
+		return nil, ErrTxUnavailable
+	}
+	tx, err := fm.primaryDB.BeginTx(ctx, opts)
+	if err != nil && !fm.primaryReachable() {
+		fm.handlePrimaryFailure(err)
+		return nil, fmt.Errorf("%w: %v", ErrTxUnavailable, err)
+	}
+	return tx, err
+}
+
+// mustQueue reports whether writes go to the queue: the primary is down,
+// or queued writes have not been replayed yet and a new write would
+// overtake them. A write the primary keeps rejecting holds the queue for
+// at most MaxReplayAttempts checks before it becomes a dead letter
+func (fm *FailoverManager) mustQueue() bool {
+	return fm.IsReadOnly() || fm.queue.len() > 0
+}
+
+// queueWrite adds a write operation to the queue and returns ErrWriteQueued,
+// or the reason it could not be queued
+func (fm *FailoverManager) queueWrite(write QueuedWrite, cause error) error {
+	if write.Key == "" {
+		write.Key = ulid.Make().String()
+	}
+	if write.Timestamp.IsZero() {
+		write.Timestamp = time.Now()
+	}
+	if _, err := fm.queue.append(write); err != nil {
+		log.Printf("❌ Failed to queue write: %v", err)
+		return fmt.Errorf("database unavailable and write could not be queued: %w", err)
+	}
+	if cause != nil {
+		return fmt.Errorf("%w: %v", ErrWriteQueued, cause)
+	}
+	return ErrWriteQueued
+}
 
-	fm.writeQueue = append(fm.writeQueue, QueuedWrite{
-		Query:     query,
-		Args:      args,
-		Timestamp: time.Now(),
+// applyWrite runs a write's statements and records its idempotency key in
+// one transaction on the primary. It returns false if the key was already
+// applied
+func (fm *FailoverManager) applyWrite(ctx context.Context, write QueuedWrite) (bool, error) {
+	applied := false
+	err := WithTransaction(ctx, fm.primaryDB, func(tx *sql.Tx) error {
+		if write.Key != "" {
+			var seen int
+			if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM failover_applied_writes WHERE idempotency_key = ?", write.Key).Scan(&seen); err != nil {
+				return fmt.Errorf("failed to check idempotency key: %w", err)
+			}
+			if seen > 0 {
+				return nil
+			}
+		}
+		for i, statement := range write.Statements {
+			if _, err := tx.ExecContext(ctx, statement.Query, statement.Args...); err != nil {
+				return fmt.Errorf("statement %d: %w", i+1, err)
+			}
+		}
+		if write.Key != "" {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO failover_applied_writes (idempotency_key, queued_at) VALUES (?, ?)", write.Key, write.Timestamp.UTC()); err != nil {
+				return fmt.Errorf("failed to record idempotency key: %w", err)
+			}
+		}
+		applied = true
+		return nil
 	})
+	return applied, err
 }
 
 // handlePrimaryFailure handles a primary database failure
@@ -147,129 +391,490 @@ func (fm *FailoverManager) handlePrimaryFailure(err error) {
 
 		log.Printf("⚠️  DATABASE FAILURE: Switching to read-only mode: %v", err)
 		log.Printf("📝 All writes will be queued and retried when database recovers")
-
-		// Start retry ticker if not already running
-		if fm.retryTicker == nil {
-			fm.retryTicker = time.NewTicker(30 * time.Second)
-		}
 	}
 }
 
-// monitorPrimaryDB monitors the primary database and attempts recovery
+// primaryReachable tells a failed statement apart from a failed primary
+func (fm *FailoverManager) primaryReachable() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutPing)
+	defer cancel()
+	return fm.primaryDB.PingContext(ctx) == nil
+}
+
+// monitorPrimaryDB checks the primary and replicas until Close
 func (fm *FailoverManager) monitorPrimaryDB() {
+	ticker := time.NewTicker(fm.interval)
+	defer ticker.Stop()
+
+	fm.check()
 	for {
 		select {
 		case <-fm.stopChan:
-			if fm.retryTicker != nil {
-				fm.retryTicker.Stop()
-			}
 			return
-
-		case <-func() <-chan time.Time {
-			fm.mu.RLock()
-			defer fm.mu.RUnlock()
-			if fm.retryTicker != nil {
-				return fm.retryTicker.C
-			}
-			// Return a channel that never receives if ticker is nil
-			return make(<-chan time.Time)
-		}():
-			fm.attemptRecovery()
+		case <-ticker.C:
+			fm.check()
 		}
 	}
 }
 
-// attemptRecovery attempts to recover the primary database connection
-func (fm *FailoverManager) attemptRecovery() {
-	fm.mu.RLock()
-	if !fm.readOnly {
-		fm.mu.RUnlock()
-		return
-	}
-	fm.mu.RUnlock()
-
-	// Test connection with a simple query
+// check runs one round of health checks: the primary (recovering and
+// replaying queued writes once it answers) and then the replicas' lag
+func (fm *FailoverManager) check() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := fm.primaryDB.PingContext(ctx)
-	if err != nil {
-		log.Printf("⚠️  Database recovery failed: %v (will retry in 30 seconds)", err)
-		return
+	if err := fm.pingPrimary(ctx); err != nil {
+		if fm.IsReadOnly() {
+			log.Printf("⚠️  Database recovery failed: %v (will retry in %s)", err, fm.interval)
+		} else {
+			fm.handlePrimaryFailure(err)
+		}
+	} else {
+		fm.attemptRecovery()
 	}
 
+	fm.checkReplicas(ctx)
+}
+
+// pingPrimary tests the primary with a query and, when there are replicas
+// to measure, stamps the heartbeat row
+func (fm *FailoverManager) pingPrimary(ctx context.Context) error {
+	if err := fm.primaryDB.PingContext(ctx); err != nil {
+		return err
+	}
 	// Verify with a test query
 	var testResult int
-	err = fm.primaryDB.QueryRowContext(ctx, "SELECT 1").Scan(&testResult)
-	if err != nil {
-		log.Printf("⚠️  Database recovery failed: %v (will retry in 30 seconds)", err)
-		return
+	if err := fm.primaryDB.QueryRowContext(ctx, "SELECT 1").Scan(&testResult); err != nil {
+		return err
 	}
+	if len(fm.replicas) > 0 {
+		if _, err := fm.primaryDB.ExecContext(ctx, "UPDATE failover_heartbeat SET beat_at = ? WHERE id = 1", time.Now().UnixMilli()); err != nil {
+			log.Printf("⚠️  Failed to write replication heartbeat: %v", err)
+		}
+	}
+	return nil
+}
 
-	// Database is back online!
-	log.Printf("✅ Database connection recovered!")
-
-	// Replay queued writes
-	fm.replayWrites()
-
-	// Exit read-only mode
+// attemptRecovery leaves read-only mode once the primary answers again and
+// replays queued writes
+func (fm *FailoverManager) attemptRecovery() {
 	fm.mu.Lock()
+	recovered := fm.readOnly
 	fm.readOnly = false
-	fm.lastError = nil
-	if fm.retryTicker != nil {
-		fm.retryTicker.Stop()
-		fm.retryTicker = nil
+	if recovered {
+		fm.lastError = nil
+	}
+	fm.mu.Unlock()
+
+	if recovered {
+		// Database is back online!
+		log.Printf("✅ Database connection recovered!")
+	}
+	if fm.queue.len() > 0 {
+		fm.replayWrites(0)
 	}
+	if recovered && !fm.IsReadOnly() {
+		log.Printf("✅ System returned to normal operation")
+	}
+}
+
+// replayWrites replays queued writes in order, each in its own transaction.
+// It stops at the first write that fails: if the primary has gone away the
+// manager returns to read-only mode, otherwise the write conflicts with the
+// primary's data and is retried by the next replay. A write rejected
+// MaxReplayAttempts times becomes a dead letter and replay moves past it.
+// skipped counts writes an admin dropped before this replay
+func (fm *FailoverManager) replayWrites(skipped int) *ReplayReport {
+	fm.replayMu.Lock()
+	defer fm.replayMu.Unlock()
+
+	report := &ReplayReport{StartedAt: time.Now(), Skipped: skipped}
+	if n := fm.queue.len(); n > 0 {
+		log.Printf("📝 Replaying %d queued writes...", n)
+	}
+
+	for {
+		write, ok := fm.queue.head()
+		if !ok {
+			break
+		}
+		applied, err := fm.applyWrite(context.Background(), write)
+		if err != nil {
+			if !fm.primaryReachable() {
+				fm.handlePrimaryFailure(err)
+				report.Error = err.Error()
+				log.Printf("⚠️  Database failed again during replay: %v", err)
+				break
+			}
+			conflict := newReplayConflict(write, err)
+			fm.mu.RLock()
+			if fm.conflict != nil && fm.conflict.Seq == write.Seq {
+				conflict.Attempts += fm.conflict.Attempts
+			}
+			fm.mu.RUnlock()
+			if conflict.Attempts < fm.maxAttempts {
+				report.Conflict = conflict
+				log.Printf("❌ Replay stopped at write %d from %s (attempt %d of %d): %v", write.Seq, write.Timestamp.Format(time.RFC3339), conflict.Attempts, fm.maxAttempts, err)
+				break
+			}
+			if err := fm.queue.bury(write.Seq, conflict.Error, conflict.Attempts); err != nil {
+				report.Conflict = conflict
+				report.Error = err.Error()
+				log.Printf("⚠️  Failed to set aside write %d: %v", write.Seq, err)
+				break
+			}
+			now := time.Now()
+			conflict.DeadAt = &now
+			report.DeadLetters = append(report.DeadLetters, *conflict)
+			log.Printf("❌ Write %d from %s set aside after %d attempts: %v (requeue or discard it in the admin panel)", write.Seq, write.Timestamp.Format(time.RFC3339), conflict.Attempts, err)
+			continue
+		}
+		if err := fm.queue.done(write.Seq); err != nil {
+			// The write is applied and its key recorded, so a retry skips it
+			report.Error = err.Error()
+			log.Printf("⚠️  Failed to mark write %d as replayed: %v", write.Seq, err)
+			break
+		}
+		if applied {
+			report.Applied++
+		} else {
+			report.Skipped++
+		}
+	}
+
+	report.Remaining = fm.queue.len()
+	report.FinishedAt = time.Now()
+	fm.mu.Lock()
+	fm.conflict = report.Conflict
+	fm.lastReplay = report
 	fm.mu.Unlock()
 
-	log.Printf("✅ System returned to normal operation")
+	newConflict := report.Conflict != nil && report.Conflict.Attempts == 1
+	if newConflict || len(report.DeadLetters) > 0 {
+		if fm.onConflict != nil {
+			fm.onConflict(report)
+		}
+	}
+	if report.Conflict == nil && report.Remaining == 0 && report.Error == "" && report.Applied+report.Skipped > 0 {
+		log.Printf("✅ Successfully replayed all %d queued writes (%d skipped)", report.Applied+report.Skipped, report.Skipped)
+	}
+	return report
+}
+
+// newReplayConflict describes the write replay stopped at
+func newReplayConflict(write QueuedWrite, err error) *ReplayConflict {
+	conflict := &ReplayConflict{Seq: write.Seq, Key: write.Key, QueuedAt: write.Timestamp, Error: err.Error(), Attempts: 1}
+	for _, statement := range write.Statements {
+		conflict.Statements = append(conflict.Statements, statement.Query)
+	}
+	return conflict
 }
 
-// replayWrites replays all queued writes
-func (fm *FailoverManager) replayWrites() {
+// ResolveConflict resumes a replay that stopped on a conflicting write,
+// first dropping that write when skip is set. Without skip the write is
+// retried, e.g. after the conflicting row was fixed by hand
+func (fm *FailoverManager) ResolveConflict(skip bool) (*ReplayReport, error) {
+	fm.mu.RLock()
+	conflict := fm.conflict
+	fm.mu.RUnlock()
+	if conflict == nil {
+		return nil, errors.New("replay is not stopped on a conflict")
+	}
+
+	if skip {
+		if err := fm.queue.done(conflict.Seq); err != nil {
+			return nil, err
+		}
+		log.Printf("📝 Skipped queued write %d (%s) after replay conflict", conflict.Seq, conflict.Key)
+	}
 	fm.mu.Lock()
-	queue := make([]QueuedWrite, len(fm.writeQueue))
-	copy(queue, fm.writeQueue)
-	// Clear queue
-	fm.writeQueue = fm.writeQueue[:0]
+	fm.conflict = nil
 	fm.mu.Unlock()
 
-	if len(queue) == 0 {
-		return
+	if fm.IsReadOnly() {
+		return nil, errors.New("database is unavailable; replay resumes when it recovers")
+	}
+	skipped := 0
+	if skip {
+		skipped = 1
 	}
+	return fm.replayWrites(skipped), nil
+}
 
-	log.Printf("📝 Replaying %d queued writes...", len(queue))
+// RequeueDeadLetter moves a dead letter back to the end of the queue, e.g.
+// after the data it conflicted with was fixed by hand, and replays the
+// queue. While the primary is down the report only carries the error and
+// replay waits for recovery
+func (fm *FailoverManager) RequeueDeadLetter(seq int64) (*ReplayReport, error) {
+	write, err := fm.queue.requeue(seq)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("📝 Requeued dead letter %d (%s) as write %d", seq, write.Key, write.Seq)
+	if fm.IsReadOnly() {
+		return &ReplayReport{Remaining: fm.queue.len(), Error: "database is unavailable; replay resumes when it recovers"}, nil
+	}
+	return fm.replayWrites(0), nil
+}
+
+// DiscardDeadLetter drops a dead letter for good
+func (fm *FailoverManager) DiscardDeadLetter(seq int64) error {
+	if err := fm.queue.discard(seq); err != nil {
+		return err
+	}
+	log.Printf("📝 Discarded dead letter %d", seq)
+	return nil
+}
 
-	successCount := 0
-	failCount := 0
+// checkReplicas measures each replica's lag from the heartbeat row
+func (fm *FailoverManager) checkReplicas(ctx context.Context) {
+	for _, r := range fm.replicas {
+		var beatAt int64
+		err := r.db.QueryRowContext(ctx, "SELECT beat_at FROM failover_heartbeat WHERE id = 1").Scan(&beatAt)
+		now := time.Now()
+
+		fm.mu.Lock()
+		wasHealthy := r.err == nil && r.lag <= fm.maxLag
+		r.checkedAt = now
+		r.err = err
+		if err == nil {
+			r.lag = now.Sub(time.UnixMilli(beatAt))
+			if r.lag < 0 {
+				r.lag = 0
+			}
+		}
+		healthy := r.err == nil && r.lag <= fm.maxLag
+		lag := r.lag
+		fm.mu.Unlock()
+
+		switch {
+		case err != nil && wasHealthy:
+			log.Printf("⚠️  Read replica %s unavailable: %v", r.name, err)
+		case !healthy && wasHealthy:
+			log.Printf("⚠️  Read replica %s is %s behind the primary; reading from the primary", r.name, lag.Round(time.Millisecond))
+		case healthy && !wasHealthy:
+			log.Printf("✅ Read replica %s is serving reads (lag %s)", r.name, lag.Round(time.Millisecond))
+		}
+	}
+}
 
-	for _, write := range queue {
-		_, err := fm.primaryDB.Exec(write.Query, write.Args...)
-		if err != nil {
-			log.Printf("⚠️  Failed to replay write from %s: %v", write.Timestamp.Format(time.RFC3339), err)
-			failCount++
-			// Re-queue failed writes
-			fm.queueWrite(write.Query, write.Args...)
-		} else {
-			successCount++
+// pickReplica returns the next replica in turn that can serve reads; stale
+// accepts any reachable replica regardless of lag
+func (fm *FailoverManager) pickReplica(stale bool) *replica {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	for i := range fm.replicas {
+		r := fm.replicas[(fm.nextReplica+i)%len(fm.replicas)]
+		if r.err == nil && (stale || r.lag <= fm.maxLag) {
+			fm.nextReplica = (fm.nextReplica + i + 1) % len(fm.replicas)
+			return r
 		}
 	}
+	return nil
+}
 
-	if failCount > 0 {
-		log.Printf("⚠️  Replayed %d/%d writes (%d failed, re-queued)", successCount, len(queue), failCount)
-	} else {
-		log.Printf("✅ Successfully replayed all %d queued writes", successCount)
+// markReplicaDown takes a replica out of rotation until its next check
+func (fm *FailoverManager) markReplicaDown(r *replica, err error) {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	if r.err == nil {
+		log.Printf("⚠️  Read replica %s failed, reading from the primary: %v", r.name, err)
 	}
+	r.err = err
+}
+
+// fallbackDB is where reads go in read-only mode: the cache, else any
+// reachable replica, else the primary
+func (fm *FailoverManager) fallbackDB() *sql.DB {
+	if fm.cacheDB != nil {
+		return fm.cacheDB
+	}
+	if r := fm.pickReplica(true); r != nil {
+		return r.db
+	}
+	return fm.primaryDB
 }
 
 // GetQueuedWriteCount returns the number of queued writes
 func (fm *FailoverManager) GetQueuedWriteCount() int {
+	return fm.queue.len()
+}
+
+// QueuedWrites returns the writes waiting for replay, oldest first
+func (fm *FailoverManager) QueuedWrites() []QueuedWrite {
+	return fm.queue.list()
+}
+
+// Status returns the failover state for the admin panel
+func (fm *FailoverManager) Status() FailoverStatus {
 	fm.mu.RLock()
 	defer fm.mu.RUnlock()
-	return len(fm.writeQueue)
+
+	status := FailoverStatus{
+		ReadOnly:     fm.readOnly,
+		QueuedWrites: fm.queue.len(),
+		Conflict:     fm.conflict,
+		DeadLetters:  []ReplayConflict{},
+		LastReplay:   fm.lastReplay,
+		Replicas:     make([]ReplicaStatus, 0, len(fm.replicas)),
+	}
+	for _, letter := range fm.queue.deadLetters() {
+		conflict := newReplayConflict(letter.write, errors.New(letter.Error))
+		conflict.Attempts = letter.Attempts
+		conflict.DeadAt = &letter.At
+		status.DeadLetters = append(status.DeadLetters, *conflict)
+	}
+	if fm.lastError != nil {
+		at := fm.lastErrorAt
+		status.LastError = fm.lastError.Error()
+		status.LastErrorAt = &at
+	}
+	for _, r := range fm.replicas {
+		rs := ReplicaStatus{
+			Name:      r.name,
+			Healthy:   r.err == nil && r.lag <= fm.maxLag,
+			LagMS:     r.lag.Milliseconds(),
+			CheckedAt: r.checkedAt,
+		}
+		if r.err != nil {
+			rs.Error = r.err.Error()
+		}
+		status.Replicas = append(status.Replicas, rs)
+	}
+	return status
+}
+
+// DB returns a handle for models and handlers: reads and writes made through
+// it take the same paths as Query and Exec, and transactions run on the
+// primary as with BeginTx
+func (fm *FailoverManager) DB() *sql.DB {
+	return fm.db
 }
 
-// Close stops the failover manager
+// Close stops the failover manager and closes the queue file
 func (fm *FailoverManager) Close() {
-	close(fm.stopChan)
+	fm.closeOnce.Do(func() {
+		close(fm.stopChan)
+		fm.db.Close()
+		fm.replayMu.Lock()
+		defer fm.replayMu.Unlock()
+		fm.queue.close()
+	})
+}
+
+// StartDualFailover starts failover managers for the server and users
+// databases of a PostgreSQL or MySQL deployment, keyed like the migration
+// sets. Write queues are kept in queueDir and reads are spread over the
+// configured replicas. onConflict may be nil
+func StartDualFailover(ddb *DualDB, config *DatabaseConfig, queueDir string, onConflict func(database string, report *ReplayReport)) (map[string]*FailoverManager, error) {
+	serverName, usersName := config.DualDatabaseNames()
+	targets := []struct {
+		database string
+		name     string
+		db       *sql.DB
+	}{
+		{MigrationsServer, serverName, ddb.Server},
+		{MigrationsUsers, usersName, ddb.Users},
+	}
+
+	managers := make(map[string]*FailoverManager)
+	for _, target := range targets {
+		database := target.database
+		replicas, err := openReplicaDBs(config, target.name)
+		if err != nil {
+			closeFailoverManagers(managers)
+			return nil, err
+		}
+		fm, err := NewFailoverManagerWithOptions(target.db, nil, FailoverOptions{
+			QueuePath:     filepath.Join(queueDir, database+"-writes.wal"),
+			Replicas:      replicas,
+			MaxReplicaLag: config.MaxReplicaLag,
+			OnReplayConflict: func(report *ReplayReport) {
+				if onConflict != nil {
+					onConflict(database, report)
+				}
+			},
+		})
+		if err != nil {
+			for _, db := range replicas {
+				db.Close()
+			}
+			closeFailoverManagers(managers)
+			return nil, fmt.Errorf("failed to start %s database failover: %w", database, err)
+		}
+		managers[database] = fm
+	}
+	return managers, nil
+}
+
+// WithFailover returns ddb with the server and users handles replaced by
+// those of their failover managers, so everything holding them writes
+// through the queue and reads from replicas. A database without a manager
+// keeps its handle. The returned DualDB is closed by closing the managers
+func (ddb *DualDB) WithFailover(managers map[string]*FailoverManager) *DualDB {
+	routed := *ddb
+	if fm := managers[MigrationsServer]; fm != nil {
+		routed.Server = fm.DB()
+	}
+	if fm := managers[MigrationsUsers]; fm != nil {
+		routed.Users = fm.DB()
+	}
+	return &routed
+}
+
+// closeFailoverManagers stops managers started so far
+func closeFailoverManagers(managers map[string]*FailoverManager) {
+	for _, fm := range managers {
+		fm.Close()
+	}
+}
+
+// openReplicaDBs opens the named database on every configured replica,
+// keyed by host:port. Connections are made lazily; the failover checks
+// decide which replicas serve reads
+func openReplicaDBs(config *DatabaseConfig, name string) (map[string]*sql.DB, error) {
+	replicas := make(map[string]*sql.DB, len(config.Replicas))
+	for _, rc := range config.Replicas {
+		label, db, err := openReplicaDB(config, rc, name)
+		if err != nil {
+			for _, db := range replicas {
+				db.Close()
+			}
+			return nil, fmt.Errorf("failed to open read replica %s: %w", rc.Host, err)
+		}
+		replicas[label] = db
+	}
+	return replicas, nil
+}
+
+// openReplicaDB opens one replica with the primary's settings for any
+// field the replica leaves unset
+func openReplicaDB(config *DatabaseConfig, rc ReplicaConfig, name string) (string, *sql.DB, error) {
+	replica := *config
+	replica.Host = rc.Host
+	if rc.Port != 0 {
+		replica.Port = rc.Port
+	}
+	if rc.Username != "" {
+		replica.Username, replica.Password = rc.Username, rc.Password
+	}
+	driver, dsn, err := replica.driverAndDSN(name)
+	if err != nil {
+		return "", nil, err
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return "", nil, err
+	}
+	poolCfg := replica.Pool
+	if poolCfg.MaxOpen == 0 {
+		poolCfg = DefaultPoolConfig()
+	}
+	ApplyPoolConfig(db, poolCfg)
+
+	label := replica.Host
+	if replica.Port != 0 {
+		label = net.JoinHostPort(replica.Host, strconv.Itoa(replica.Port))
+	}
+	return label, db, nil
 }
@@ -0,0 +1,212 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+)
+
+// failoverConnector hands database/sql connections that run every
+// statement through a FailoverManager, so models and handlers holding the
+// manager's DB get queued writes and replica reads without knowing about
+// either
+type failoverConnector struct {
+	fm *FailoverManager
+}
+
+func (c *failoverConnector) Connect(context.Context) (driver.Conn, error) {
+	return &failoverConn{fm: c.fm}, nil
+}
+
+func (c *failoverConnector) Driver() driver.Driver {
+	return failoverDriver{}
+}
+
+type failoverDriver struct{}
+
+func (failoverDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("failover connections are opened through FailoverManager.DB")
+}
+
+// failoverConn holds no connection of its own; the manager picks one per
+// statement. Inside a transaction statements go to the primary's
+// transaction instead
+type failoverConn struct {
+	fm *FailoverManager
+	tx *sql.Tx
+}
+
+func (c *failoverConn) Prepare(query string) (driver.Stmt, error) {
+	return &failoverStmt{conn: c, query: query}, nil
+}
+
+func (c *failoverConn) Close() error {
+	return nil
+}
+
+func (c *failoverConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *failoverConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.fm.BeginTx(ctx, &sql.TxOptions{Isolation: sql.IsolationLevel(opts.Isolation), ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	c.tx = tx
+	return &failoverTx{conn: c}, nil
+}
+
+// CheckNamedValue passes arguments through unconverted; the primary's
+// driver converts them
+func (c *failoverConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c *failoverConn) Ping(ctx context.Context) error {
+	return c.fm.primaryDB.PingContext(ctx)
+}
+
+func (c *failoverConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c.tx != nil {
+		return c.tx.ExecContext(ctx, query, namedValueArgs(args)...)
+	}
+	return c.fm.ExecContext(ctx, query, namedValueArgs(args)...)
+}
+
+func (c *failoverConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	var rows *sql.Rows
+	var err error
+	if c.tx != nil {
+		rows, err = c.tx.QueryContext(ctx, query, namedValueArgs(args)...)
+	} else {
+		rows, err = c.fm.QueryContext(ctx, query, namedValueArgs(args)...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return &failoverRows{rows: rows, columns: columns}, nil
+}
+
+type failoverTx struct {
+	conn *failoverConn
+}
+
+func (t *failoverTx) Commit() error {
+	tx := t.conn.tx
+	t.conn.tx = nil
+	return tx.Commit()
+}
+
+func (t *failoverTx) Rollback() error {
+	tx := t.conn.tx
+	t.conn.tx = nil
+	return tx.Rollback()
+}
+
+// failoverStmt is a prepared statement that is only prepared where it runs
+type failoverStmt struct {
+	conn  *failoverConn
+	query string
+}
+
+func (s *failoverStmt) Close() error {
+	return nil
+}
+
+func (s *failoverStmt) NumInput() int {
+	return -1
+}
+
+func (s *failoverStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), valueArgs(args))
+}
+
+func (s *failoverStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), valueArgs(args))
+}
+
+func (s *failoverStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *failoverStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+// failoverRows hands on the rows of whichever database answered
+type failoverRows struct {
+	rows    *sql.Rows
+	columns []string
+}
+
+func (r *failoverRows) Columns() []string {
+	return r.columns
+}
+
+func (r *failoverRows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *failoverRows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	values := make([]interface{}, len(dest))
+	targets := make([]interface{}, len(dest))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	if err := r.rows.Scan(targets...); err != nil {
+		return err
+	}
+	for i, value := range values {
+		dest[i] = value
+	}
+	return nil
+}
+
+func namedValueArgs(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			values[i] = sql.Named(arg.Name, arg.Value)
+		} else {
+			values[i] = arg.Value
+		}
+	}
+	return values
+}
+
+func valueArgs(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// isReadQuery reports whether a statement only reads and may go to a
+// replica or the cache
+func isReadQuery(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n(")
+	if end := strings.IndexAny(query, " \t\r\n("); end >= 0 {
+		query = query[:end]
+	}
+	switch strings.ToUpper(query) {
+	case "SELECT", "WITH":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,402 @@
+package database
+
+import (
+	"bufio"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Statement is one SQL statement of a queued write
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// QueuedWrite represents a write operation that needs to be executed when database recovers.
+// Its statements are replayed in one transaction
+type QueuedWrite struct {
+	// Position in the queue; replay follows it
+	Seq int64 `json:"seq"`
+	// Replay records the key on the primary and skips keys it already has
+	Key        string      `json:"key"`
+	Statements []Statement `json:"statements"`
+	Timestamp  time.Time   `json:"timestamp"`
+}
+
+// deadLetter is a queued write set aside after the primary rejected it on
+// every replay attempt, so the writes behind it can be replayed
+type deadLetter struct {
+	Seq      int64     `json:"seq"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	At       time.Time `json:"at"`
+	write    QueuedWrite
+}
+
+// Queue file records: a write, a write set aside as a dead letter, or the
+// end of a write after it was applied, skipped or discarded
+type queueRecord struct {
+	Op    string       `json:"op"`
+	Write *QueuedWrite `json:"write,omitempty"`
+	Dead  *deadLetter  `json:"dead,omitempty"`
+	Seq   int64        `json:"seq,omitempty"`
+}
+
+const (
+	queueOpWrite = "write"
+	queueOpDead  = "dead"
+	queueOpDone  = "done"
+)
+
+// writeQueue holds queued writes in order. With a path it is backed by an
+// append-only file of JSON lines, synced on every append, so writes queued
+// during an outage survive a crash
+type writeQueue struct {
+	mu      sync.Mutex
+	file    *os.File
+	pending []QueuedWrite
+	dead    []deadLetter
+	nextSeq int64
+}
+
+// openWriteQueue loads the writes still pending in path. An empty path keeps
+// the queue in memory
+func openWriteQueue(path string) (*writeQueue, error) {
+	q := &writeQueue{nextSeq: 1}
+	if path == "" {
+		return q, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create write queue directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write queue: %w", err)
+	}
+	if err := q.load(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read write queue %s: %w", path, err)
+	}
+	q.file = file
+	return q, nil
+}
+
+// load replays the file's records. A torn last line from a crash mid-append
+// is cut off so later appends start on a clean line
+func (q *writeQueue) load(file *os.File) error {
+	var good int64
+	done := make(map[int64]bool)
+	dead := make(map[int64]deadLetter)
+	var writes []QueuedWrite
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		var record queueRecord
+		if json.Unmarshal(line, &record) != nil {
+			break
+		}
+		good += int64(len(line))
+		switch record.Op {
+		case queueOpWrite:
+			if record.Write != nil {
+				writes = append(writes, *record.Write)
+				if record.Write.Seq >= q.nextSeq {
+					q.nextSeq = record.Write.Seq + 1
+				}
+			}
+		case queueOpDead:
+			if record.Dead != nil {
+				dead[record.Dead.Seq] = *record.Dead
+			}
+		case queueOpDone:
+			done[record.Seq] = true
+		}
+	}
+	for _, write := range writes {
+		switch letter, ok := dead[write.Seq]; {
+		case done[write.Seq]:
+		case ok:
+			letter.write = write
+			q.dead = append(q.dead, letter)
+		default:
+			q.pending = append(q.pending, write)
+		}
+	}
+	if err := file.Truncate(good); err != nil {
+		return err
+	}
+	_, err := file.Seek(good, io.SeekStart)
+	return err
+}
+
+// append assigns the write its sequence number and persists it
+func (q *writeQueue) append(write QueuedWrite) (QueuedWrite, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	write.Seq = q.nextSeq
+	if err := q.persist(queueRecord{Op: queueOpWrite, Write: &write}); err != nil {
+		return write, err
+	}
+	q.nextSeq++
+	q.pending = append(q.pending, write)
+	return write, nil
+}
+
+// head returns the oldest pending write
+func (q *writeQueue) head() (QueuedWrite, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return QueuedWrite{}, false
+	}
+	return q.pending[0], true
+}
+
+// done removes the oldest pending write, which must be seq. The file is
+// emptied once nothing is pending or dead
+func (q *writeQueue) done(seq int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 || q.pending[0].Seq != seq {
+		return fmt.Errorf("write %d is not at the head of the queue", seq)
+	}
+	if err := q.persist(queueRecord{Op: queueOpDone, Seq: seq}); err != nil {
+		return err
+	}
+	q.pending = q.pending[1:]
+	return q.truncateIfEmpty()
+}
+
+// bury moves the oldest pending write, which must be seq, to the dead
+// letters
+func (q *writeQueue) bury(seq int64, cause string, attempts int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 || q.pending[0].Seq != seq {
+		return fmt.Errorf("write %d is not at the head of the queue", seq)
+	}
+	letter := deadLetter{Seq: seq, Error: cause, Attempts: attempts, At: time.Now()}
+	if err := q.persist(queueRecord{Op: queueOpDead, Dead: &letter}); err != nil {
+		return err
+	}
+	letter.write = q.pending[0]
+	q.dead = append(q.dead, letter)
+	q.pending = q.pending[1:]
+	return nil
+}
+
+// discard drops the dead letter seq for good
+func (q *writeQueue) discard(seq int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := q.findDead(seq)
+	if i < 0 {
+		return fmt.Errorf("write %d is not a dead letter", seq)
+	}
+	if err := q.persist(queueRecord{Op: queueOpDone, Seq: seq}); err != nil {
+		return err
+	}
+	q.dead = append(q.dead[:i], q.dead[i+1:]...)
+	return q.truncateIfEmpty()
+}
+
+// requeue moves the dead letter seq back to the end of the queue under a
+// new sequence number. It keeps its idempotency key, so a write that was
+// applied after all is skipped
+func (q *writeQueue) requeue(seq int64) (QueuedWrite, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := q.findDead(seq)
+	if i < 0 {
+		return QueuedWrite{}, fmt.Errorf("write %d is not a dead letter", seq)
+	}
+	write := q.dead[i].write
+	write.Seq = q.nextSeq
+	if err := q.persist(queueRecord{Op: queueOpWrite, Write: &write}); err != nil {
+		return write, err
+	}
+	q.nextSeq++
+	q.pending = append(q.pending, write)
+	q.dead = append(q.dead[:i], q.dead[i+1:]...)
+	// Without this record the old write loads as a dead letter again; its
+	// idempotency key keeps it from being applied twice
+	if err := q.persist(queueRecord{Op: queueOpDone, Seq: seq}); err != nil {
+		return write, err
+	}
+	return write, nil
+}
+
+// findDead returns the index of the dead letter seq, or -1
+func (q *writeQueue) findDead(seq int64) int {
+	for i, letter := range q.dead {
+		if letter.Seq == seq {
+			return i
+		}
+	}
+	return -1
+}
+
+// truncateIfEmpty empties the file once it holds nothing pending or dead
+func (q *writeQueue) truncateIfEmpty() error {
+	if len(q.pending) > 0 || len(q.dead) > 0 || q.file == nil {
+		return nil
+	}
+	if err := q.file.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := q.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return q.file.Sync()
+}
+
+// persist appends one record and syncs it to disk
+func (q *writeQueue) persist(record queueRecord) error {
+	if q.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode queued write: %w", err)
+	}
+	offset, err := q.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to append to write queue: %w", err)
+	}
+	if _, err := q.file.Write(append(line, '\n')); err != nil {
+		// Drop the partial record so the next append starts a clean line
+		q.file.Truncate(offset)
+		q.file.Seek(offset, io.SeekStart)
+		return fmt.Errorf("failed to append to write queue: %w", err)
+	}
+	if err := q.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync write queue: %w", err)
+	}
+	return nil
+}
+
+// len returns the number of pending writes
+func (q *writeQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// list returns a copy of the pending writes
+func (q *writeQueue) list() []QueuedWrite {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]QueuedWrite(nil), q.pending...)
+}
+
+// deadLetters returns a copy of the dead letters, oldest first
+func (q *writeQueue) deadLetters() []deadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]deadLetter(nil), q.dead...)
+}
+
+// close closes the queue file
+func (q *writeQueue) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
+
+// queuedArg is a statement argument with its type, so replay binds the same
+// value the caller passed (JSON alone turns int64 into float64 and []byte
+// into a string)
+type queuedArg struct {
+	Type  string `json:"t"`
+	Value string `json:"v,omitempty"`
+}
+
+// MarshalJSON encodes the query and its typed arguments
+func (s Statement) MarshalJSON() ([]byte, error) {
+	args := make([]queuedArg, len(s.Args))
+	for i, arg := range s.Args {
+		value, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		switch v := value.(type) {
+		case nil:
+			args[i] = queuedArg{Type: "null"}
+		case int64:
+			args[i] = queuedArg{Type: "int", Value: strconv.FormatInt(v, 10)}
+		case float64:
+			args[i] = queuedArg{Type: "float", Value: strconv.FormatFloat(v, 'g', -1, 64)}
+		case bool:
+			args[i] = queuedArg{Type: "bool", Value: strconv.FormatBool(v)}
+		case string:
+			args[i] = queuedArg{Type: "string", Value: v}
+		case []byte:
+			args[i] = queuedArg{Type: "bytes", Value: base64.StdEncoding.EncodeToString(v)}
+		case time.Time:
+			args[i] = queuedArg{Type: "time", Value: v.Format(time.RFC3339Nano)}
+		default:
+			return nil, fmt.Errorf("argument %d: unsupported type %T", i+1, value)
+		}
+	}
+	return json.Marshal(struct {
+		Query string      `json:"query"`
+		Args  []queuedArg `json:"args"`
+	}{s.Query, args})
+}
+
+// UnmarshalJSON decodes a statement written by MarshalJSON
+func (s *Statement) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Query string      `json:"query"`
+		Args  []queuedArg `json:"args"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	s.Query = raw.Query
+	s.Args = make([]interface{}, len(raw.Args))
+	for i, arg := range raw.Args {
+		var err error
+		switch arg.Type {
+		case "null":
+			s.Args[i] = nil
+		case "int":
+			s.Args[i], err = strconv.ParseInt(arg.Value, 10, 64)
+		case "float":
+			s.Args[i], err = strconv.ParseFloat(arg.Value, 64)
+		case "bool":
+			s.Args[i] = arg.Value == "true"
+		case "string":
+			s.Args[i] = arg.Value
+		case "bytes":
+			s.Args[i], err = base64.StdEncoding.DecodeString(arg.Value)
+		case "time":
+			s.Args[i], err = time.Parse(time.RFC3339Nano, arg.Value)
+		default:
+			err = fmt.Errorf("unknown type %q", arg.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("argument %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,468 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+func openFailoverTestDB(t *testing.T, name string) *sql.DB {
+	t.Helper()
+	db, _, cleanup, err := OpenScratchDB("sqlite:", t.Name()+"_"+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
+	if err := MigrateDatabase(db, DialectSQLite, MigrationsServer, nil); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// downDB is a primary that fails every call
+func downDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	return db
+}
+
+func newTestFailoverManager(t *testing.T, primary *sql.DB, opts FailoverOptions) *FailoverManager {
+	t.Helper()
+	opts.CheckInterval = time.Hour
+	fm, err := NewFailoverManagerWithOptions(primary, nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(fm.Close)
+	return fm
+}
+
+const insertConfig = "INSERT INTO server_config (key, value, type, description) VALUES (?, ?, 'string', '')"
+
+func configValue(t *testing.T, db *sql.DB, key string) string {
+	t.Helper()
+	var value string
+	if err := db.QueryRow("SELECT value FROM server_config WHERE key = ?", key).Scan(&value); err != nil && err != sql.ErrNoRows {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestWriteQueuePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.wal")
+	q, err := openWriteQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	args := []interface{}{int(42), 2.5, true, "text", []byte{0, 1, 2}, at, nil}
+	for _, key := range []string{"a", "b"} {
+		if _, err := q.append(QueuedWrite{Key: key, Statements: []Statement{{Query: "UPDATE t SET x = ?", Args: args}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.done(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.done(1); err == nil {
+		t.Error("Expected done for a write no longer queued to fail")
+	}
+	q.close()
+
+	// A crash mid-append leaves a torn last line
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	file.WriteString(`{"op":"write","write":{"seq":3,`)
+	file.Close()
+
+	q, err = openWriteQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+	pending := q.list()
+	if len(pending) != 1 || pending[0].Seq != 2 || pending[0].Key != "b" {
+		t.Fatalf("pending = %+v", pending)
+	}
+	got := pending[0].Statements[0].Args
+	if got[0] != int64(42) || got[1] != 2.5 || got[2] != true || got[3] != "text" ||
+		!bytes.Equal(got[4].([]byte), []byte{0, 1, 2}) || !got[5].(time.Time).Equal(at) || got[6] != nil {
+		t.Errorf("args = %#v", got)
+	}
+	write, err := q.append(QueuedWrite{Key: "c"})
+	if err != nil || write.Seq != 3 {
+		t.Errorf("append after reopen = %d, %v", write.Seq, err)
+	}
+
+	// The file is emptied once every write is done
+	q.done(2)
+	q.done(3)
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Errorf("queue file is %d bytes after draining", info.Size())
+	}
+}
+
+func TestFailoverQueuesAndReplaysAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.wal")
+	primary := openFailoverTestDB(t, "primary")
+	// The key of a write the primary already applied before a crash
+	if _, err := primary.Exec("INSERT INTO failover_applied_writes (idempotency_key, queued_at) VALUES ('dup', ?)", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	down := newTestFailoverManager(t, downDB(t), FailoverOptions{QueuePath: path})
+	if _, err := down.Exec(insertConfig, "a", "1"); !errors.Is(err, ErrWriteQueued) {
+		t.Fatalf("Exec on a failed primary = %v, want ErrWriteQueued", err)
+	}
+	if !down.IsReadOnly() {
+		t.Error("Expected read-only mode after the primary failed")
+	}
+	err := down.ExecTx("tx", Statement{Query: insertConfig, Args: []interface{}{"b", "2"}}, Statement{Query: insertConfig, Args: []interface{}{"c", "3"}})
+	if !errors.Is(err, ErrWriteQueued) {
+		t.Fatalf("ExecTx = %v, want ErrWriteQueued", err)
+	}
+	down.ExecTx("dup", Statement{Query: insertConfig, Args: []interface{}{"d", "4"}})
+	down.Close()
+
+	// The next process replays the queue file into the recovered primary
+	fm := newTestFailoverManager(t, primary, FailoverOptions{QueuePath: path})
+	fm.check()
+	if n := fm.GetQueuedWriteCount(); n != 0 {
+		t.Fatalf("%d writes still queued", n)
+	}
+	for key, want := range map[string]string{"a": "1", "b": "2", "c": "3", "d": ""} {
+		if got := configValue(t, primary, key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	// Replaying the same keys again is a no-op
+	if err := fm.ExecTx("tx", Statement{Query: insertConfig, Args: []interface{}{"b", "2"}}); err != nil {
+		t.Errorf("ExecTx with an applied key = %v", err)
+	}
+	if _, err := fm.Exec(insertConfig, "e", "5"); err != nil {
+		t.Errorf("Exec on a healthy primary = %v", err)
+	}
+	if _, err := fm.Exec(insertConfig, "e", "5"); err == nil || errors.Is(err, ErrWriteQueued) || fm.IsReadOnly() {
+		t.Errorf("A rejected statement should fail without queueing: %v", err)
+	}
+}
+
+func TestFailoverReplayStopsOnConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.wal")
+	primary := openFailoverTestDB(t, "primary")
+	if _, err := primary.Exec(insertConfig, "taken", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	down := newTestFailoverManager(t, downDB(t), FailoverOptions{QueuePath: path})
+	down.Exec(insertConfig, "taken", "new")
+	down.Exec(insertConfig, "after", "1")
+	down.Close()
+
+	var reported *ReplayReport
+	fm := newTestFailoverManager(t, primary, FailoverOptions{QueuePath: path, OnReplayConflict: func(r *ReplayReport) { reported = r }})
+	fm.check()
+
+	status := fm.Status()
+	if status.Conflict == nil || status.Conflict.Seq != 1 || status.QueuedWrites != 2 {
+		t.Fatalf("status = %+v", status)
+	}
+	if reported == nil || reported.Conflict == nil {
+		t.Error("OnReplayConflict was not called")
+	}
+	if got := configValue(t, primary, "after"); got != "" {
+		t.Error("Replay continued past the conflicting write")
+	}
+	// New writes queue behind the conflict instead of overtaking it
+	if _, err := fm.Exec(insertConfig, "later", "1"); !errors.Is(err, ErrWriteQueued) {
+		t.Errorf("Exec behind a conflict = %v, want ErrWriteQueued", err)
+	}
+
+	report, err := fm.ResolveConflict(false)
+	if err != nil || report.Conflict == nil {
+		t.Fatalf("retry = %+v, %v", report, err)
+	}
+	report, err = fm.ResolveConflict(true)
+	if err != nil || report.Conflict != nil || report.Applied != 2 || report.Skipped != 1 || report.Remaining != 0 {
+		t.Fatalf("skip = %+v, %v", report, err)
+	}
+	if configValue(t, primary, "taken") != "old" || configValue(t, primary, "after") != "1" || configValue(t, primary, "later") != "1" {
+		t.Error("Writes after the skipped one were not replayed")
+	}
+	if _, err := fm.ResolveConflict(true); err == nil {
+		t.Error("Expected ResolveConflict without a conflict to fail")
+	}
+}
+
+func TestFailoverDeadLettersRejectedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.wal")
+	primary := openFailoverTestDB(t, "primary")
+	if _, err := primary.Exec(insertConfig, "taken", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	down := newTestFailoverManager(t, downDB(t), FailoverOptions{QueuePath: path})
+	down.Exec(insertConfig, "taken", "new")
+	down.Exec(insertConfig, "after", "1")
+	down.Close()
+
+	var reports []*ReplayReport
+	opts := FailoverOptions{QueuePath: path, MaxReplayAttempts: 2, OnReplayConflict: func(r *ReplayReport) { reports = append(reports, r) }}
+	fm := newTestFailoverManager(t, primary, opts)
+	fm.check()
+	if status := fm.Status(); status.Conflict == nil || status.Conflict.Attempts != 1 || status.QueuedWrites != 2 {
+		t.Fatalf("status after the first attempt = %+v", status)
+	}
+
+	// The second attempt sets the write aside and replays the rest
+	fm.check()
+	status := fm.Status()
+	if status.Conflict != nil || status.QueuedWrites != 0 || len(status.DeadLetters) != 1 {
+		t.Fatalf("status after the last attempt = %+v", status)
+	}
+	if letter := status.DeadLetters[0]; letter.Seq != 1 || letter.Attempts != 2 || letter.DeadAt == nil {
+		t.Errorf("dead letter = %+v", letter)
+	}
+	if configValue(t, primary, "after") != "1" {
+		t.Error("The write behind the dead letter was not replayed")
+	}
+	if len(reports) != 2 || len(reports[1].DeadLetters) != 1 {
+		t.Errorf("OnReplayConflict calls = %d, want the first conflict and the dead letter", len(reports))
+	}
+	// With the queue drained, writes go to the primary again
+	if _, err := fm.Exec(insertConfig, "later", "1"); err != nil {
+		t.Fatalf("Exec after the dead letter = %v", err)
+	}
+	fm.Close()
+
+	// Dead letters survive a restart
+	fm = newTestFailoverManager(t, primary, opts)
+	if letters := fm.Status().DeadLetters; len(letters) != 1 || letters[0].Error == "" {
+		t.Fatalf("dead letters after restart = %+v", letters)
+	}
+	if _, err := fm.RequeueDeadLetter(2); err == nil {
+		t.Error("Expected requeueing a write that is not a dead letter to fail")
+	}
+
+	primary.Exec("DELETE FROM server_config WHERE key = 'taken'")
+	report, err := fm.RequeueDeadLetter(1)
+	if err != nil || report.Applied != 1 || report.Remaining != 0 {
+		t.Fatalf("requeue = %+v, %v", report, err)
+	}
+	if configValue(t, primary, "taken") != "new" || len(fm.Status().DeadLetters) != 0 {
+		t.Error("The requeued write was not replayed")
+	}
+	if err := fm.DiscardDeadLetter(1); err == nil {
+		t.Error("Expected discarding a requeued write to fail")
+	}
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Errorf("queue file is %d bytes after draining", info.Size())
+	}
+}
+
+func TestWriteQueueDiscardDeadLetter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.wal")
+	q, err := openWriteQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.append(QueuedWrite{Key: "a"})
+	if err := q.bury(2, "rejected", 3); err == nil {
+		t.Error("Expected burying a write behind the head to fail")
+	}
+	if err := q.bury(1, "rejected", 3); err != nil {
+		t.Fatal(err)
+	}
+	q.close()
+
+	q, err = openWriteQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.close()
+	dead := q.deadLetters()
+	if q.len() != 0 || len(dead) != 1 || dead[0].write.Key != "a" || dead[0].Attempts != 3 {
+		t.Fatalf("after reopen: %d pending, dead letters %+v", q.len(), dead)
+	}
+	if err := q.discard(1); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Errorf("queue file is %d bytes after discarding the last dead letter", info.Size())
+	}
+}
+
+func TestFailoverReadReplicas(t *testing.T) {
+	primary := openFailoverTestDB(t, "primary")
+	replicaDB := openFailoverTestDB(t, "replica")
+	primary.Exec(insertConfig, "node", "primary")
+	replicaDB.Exec(insertConfig, "node", "replica")
+
+	fm := newTestFailoverManager(t, primary, FailoverOptions{Replicas: map[string]*sql.DB{"r1": replicaDB}, MaxReplicaLag: time.Minute})
+	read := func() string {
+		var node string
+		if err := fm.QueryRow("SELECT value FROM server_config WHERE key = 'node'").Scan(&node); err != nil {
+			t.Fatal(err)
+		}
+		return node
+	}
+
+	// The replica's heartbeat is from 1970: far behind
+	fm.check()
+	if got := read(); got != "primary" {
+		t.Errorf("read from a lagging replica: %s", got)
+	}
+	if status := fm.Status(); len(status.Replicas) != 1 || status.Replicas[0].Healthy {
+		t.Errorf("replicas = %+v", status.Replicas)
+	}
+
+	replicaDB.Exec("UPDATE failover_heartbeat SET beat_at = ? WHERE id = 1", time.Now().UnixMilli())
+	fm.check()
+	if got := read(); got != "replica" {
+		t.Errorf("read with a current replica went to %s", got)
+	}
+	rows, err := fm.Query("SELECT value FROM server_config WHERE key = 'node'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+
+	// A failing replica drops out of rotation at once
+	replicaDB.Close()
+	if got := read(); got != "primary" {
+		t.Errorf("read after the replica failed went to %s", got)
+	}
+	if status := fm.Status(); status.Replicas[0].Healthy || status.Replicas[0].Error == "" {
+		t.Errorf("replicas = %+v", status.Replicas)
+	}
+}
+
+// switchDriver is SQLite that fails like an unreachable server while down
+// is set
+type switchDriver struct {
+	parent driver.Driver
+	down   atomic.Bool
+}
+
+func (d *switchDriver) Open(name string) (driver.Conn, error) {
+	if d.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	conn, err := d.parent.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &switchConn{Conn: conn, down: &d.down}, nil
+}
+
+type switchConn struct {
+	driver.Conn
+	down *atomic.Bool
+}
+
+func (c *switchConn) Prepare(query string) (driver.Stmt, error) {
+	if c.down.Load() {
+		return nil, driver.ErrBadConn
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *switchConn) Begin() (driver.Tx, error) {
+	if c.down.Load() {
+		return nil, driver.ErrBadConn
+	}
+	return c.Conn.Begin()
+}
+
+func (c *switchConn) Ping(context.Context) error {
+	if c.down.Load() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+var (
+	switchSQLite     = &switchDriver{parent: &sqlite.Driver{}}
+	switchSQLiteOnce sync.Once
+)
+
+func TestDualFailoverRoutesGlobalHandles(t *testing.T) {
+	switchSQLiteOnce.Do(func() { sql.Register("failover-switch-sqlite", switchSQLite) })
+	dir := t.TempDir()
+	open := func(name, migrations string) *sql.DB {
+		db, err := sql.Open("failover-switch-sqlite", filepath.Join(dir, name+".db")+"?_pragma=busy_timeout(5000)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := MigrateDatabase(db, DialectSQLite, migrations, nil); err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+	ddb := &DualDB{Server: open("server", MigrationsServer), Users: open("users", MigrationsUsers), Dialect: DialectSQLite}
+
+	managers, err := StartDualFailover(ddb, &DatabaseConfig{}, filepath.Join(dir, "queue"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFailoverManagers(managers)
+	previous := GetGlobalDualDB()
+	SetGlobalDualDB(ddb.WithFailover(managers))
+	defer SetGlobalDualDB(previous)
+	fm := managers[MigrationsServer]
+
+	if _, err := GetServerDB().Exec(insertConfig, "before", "1"); err != nil {
+		t.Fatalf("write with the primary up = %v", err)
+	}
+
+	// Handlers keep using the global handles while the primary is down
+	switchSQLite.down.Store(true)
+	if _, err := GetServerDB().Exec(insertConfig, "during", "2"); !errors.Is(err, ErrWriteQueued) {
+		t.Fatalf("write with the primary down = %v, want ErrWriteQueued", err)
+	}
+	if _, err := GetServerDB().Begin(); !errors.Is(err, ErrTxUnavailable) {
+		t.Errorf("Begin with the primary down = %v, want ErrTxUnavailable", err)
+	}
+	if n := fm.GetQueuedWriteCount(); n != 1 || !fm.IsReadOnly() {
+		t.Fatalf("%d writes queued, read-only %v", n, fm.IsReadOnly())
+	}
+	if info, err := os.Stat(filepath.Join(dir, "queue", MigrationsServer+"-writes.wal")); err != nil || info.Size() == 0 {
+		t.Errorf("queue file = %v, %v", info, err)
+	}
+
+	switchSQLite.down.Store(false)
+	fm.check()
+	if n := fm.GetQueuedWriteCount(); n != 0 || fm.IsReadOnly() {
+		t.Fatalf("%d writes still queued after recovery, read-only %v", n, fm.IsReadOnly())
+	}
+	if got := configValue(t, ddb.Server, "during"); got != "2" {
+		t.Errorf("replayed write = %q", got)
+	}
+	if got := configValue(t, GetServerDB(), "before"); got != "1" {
+		t.Errorf("read through the global handle = %q", got)
+	}
+	tx, err := GetServerDB().Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM server_config WHERE key IN ('before', 'during')").Scan(&n); err != nil || n != 2 {
+		t.Errorf("read in a transaction = %d, %v", n, err)
+	}
+}
@@ -53,3 +53,14 @@ func IsDualMode() bool {
 	defer globalMutex.RUnlock()
 	return globalDualDB != nil
 }
+
+// GetDialect returns the dialect of the server and users databases,
+// SQLite when not initialized
+func GetDialect() Dialect {
+	globalMutex.RLock()
+	defer globalMutex.RUnlock()
+	if globalDualDB != nil && globalDualDB.Dialect != "" {
+		return globalDualDB.Dialect
+	}
+	return DialectSQLite
+}
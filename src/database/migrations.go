@@ -0,0 +1,559 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations live in migrations/{database}/NNNN_name.up.sql with an
+// optional NNNN_name.down.sql that reverts it. Versions start at 1 and are
+// contiguous; 0001_baseline is the schema that existed before versioned
+// migrations. An applied migration must never be edited: its checksum is
+// recorded and later runs refuse to continue when it changes
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Databases with their own migration sets
+const (
+	MigrationsServer = "server"
+	MigrationsUsers  = "users"
+)
+
+const (
+	migrationLockName = "migrate"
+	// A lock left behind by a crashed node expires after this long
+	migrationLockTTL = 15 * time.Minute
+)
+
+// migrationTables are kept by the migrator in every database
+const migrationTables = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	applied_at DATETIME NOT NULL,
+	duration_ms INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS schema_migration_lock (
+	name TEXT PRIMARY KEY,
+	owner TEXT NOT NULL,
+	acquired_at DATETIME NOT NULL,
+	expires_at DATETIME NOT NULL
+);
+`
+
+// legacyColumns were added with ALTER TABLE on first use before versioned
+// migrations existed. Databases created in that era may lack them, so they
+// are added before the baseline is recorded
+var legacyColumns = map[string][]struct{ table, column, definition string }{
+	MigrationsServer: {
+		{"server_blocklists", "action", "TEXT NOT NULL DEFAULT 'deny'"},
+		{"server_admin_tokens", "allowed_ips", "TEXT"},
+		{"server_admin_tokens", "location_id", "INTEGER"},
+		{"server_admin_tokens", "rate_limit", "INTEGER NOT NULL DEFAULT 0"},
+		{"server_admin_tokens", "daily_quota", "INTEGER NOT NULL DEFAULT 0"},
+	},
+	MigrationsUsers: {
+		{"user_invites", "username", "TEXT"},
+		{"user_invites", "role", "TEXT NOT NULL DEFAULT 'user'"},
+		{"user_passkeys", "transport", "TEXT NOT NULL DEFAULT '[]'"},
+		{"user_passkeys", "attestation_type", "TEXT NOT NULL DEFAULT ''"},
+		{"user_passkeys", "backup_eligible", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"user_passkeys", "backup_state", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"user_tokens", "allowed_ips", "TEXT"},
+		{"user_tokens", "location_id", "INTEGER"},
+		{"user_tokens", "rate_limit", "INTEGER NOT NULL DEFAULT 0"},
+		{"user_tokens", "daily_quota", "INTEGER NOT NULL DEFAULT 0"},
+	},
+}
+
+// Migration is one numbered schema change and its reverse
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	// Down is empty for migrations that cannot be reverted
+	Down string
+	// Checksum of the up script, recorded when the migration is applied
+	Checksum string
+}
+
+// String returns the migration's file name stem, e.g. 0002_runtime_tables
+func (mg Migration) String() string {
+	return fmt.Sprintf("%04d_%s", mg.Version, mg.Name)
+}
+
+// MigrationStatus is a migration and whether it has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the embedded up script no longer matches the
+	// checksum recorded when it was applied
+	Modified bool
+	// Unknown is set for versions recorded in the database that this
+	// binary does not have, i.e. the database was migrated by a newer one
+	Unknown bool
+}
+
+// LoadMigrations returns the embedded migrations of the server or users
+// database in version order
+func LoadMigrations(database string) ([]Migration, error) {
+	dir := path.Join("migrations", database)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s database: %w", database, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		stem, up := strings.CutSuffix(file, ".up.sql")
+		if !up {
+			var down bool
+			if stem, down = strings.CutSuffix(file, ".down.sql"); !down {
+				continue
+			}
+		}
+		number, name, ok := strings.Cut(stem, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version <= 0 || name == "" {
+			return nil, fmt.Errorf("invalid migration file %s/%s: want NNNN_name.up.sql or NNNN_name.down.sql", dir, file)
+		}
+		data, err := migrationFiles.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		mg := byVersion[version]
+		if mg == nil {
+			mg = &Migration{Version: version, Name: name}
+			byVersion[version] = mg
+		} else if mg.Name != name {
+			return nil, fmt.Errorf("migration %d has files named %s and %s", version, mg.Name, name)
+		}
+		if up {
+			mg.Up = string(data)
+		} else {
+			mg.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		if strings.TrimSpace(mg.Up) == "" {
+			return nil, fmt.Errorf("migration %s has no up script", mg)
+		}
+		sum := sha256.Sum256([]byte(mg.Up))
+		mg.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *mg)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, mg := range migrations {
+		if mg.Version != i+1 {
+			return nil, fmt.Errorf("%s migrations skip version %d", database, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Migrator applies and reverts the migrations of one database. Nodes that
+// share a PostgreSQL or MySQL database take a lock row before changing the
+// schema, so only one of them migrates at a time
+type Migrator struct {
+	DB         *sql.DB
+	Dialect    Dialect
+	Database   string
+	Migrations []Migration
+	// DryRun returns the plan without taking the lock or changing anything
+	DryRun bool
+	// BeforeApply runs once before a database that already holds data is
+	// changed, e.g. to take a backup. An error aborts the migration
+	BeforeApply func(database string, direction string, plan []Migration) error
+	// How long to wait for another node's lock
+	LockTimeout time.Duration
+	// Recorded in the lock row; defaults to hostname:pid
+	LockOwner string
+}
+
+// NewMigrator returns a migrator for the server or users database
+func NewMigrator(db *sql.DB, dialect Dialect, database string) (*Migrator, error) {
+	migrations, err := LoadMigrations(database)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	return &Migrator{
+		DB:          db,
+		Dialect:     dialect,
+		Database:    database,
+		Migrations:  migrations,
+		LockTimeout: 2 * time.Minute,
+		LockOwner:   fmt.Sprintf("%s:%d", host, os.Getpid()),
+	}, nil
+}
+
+// Latest returns the highest known migration version
+func (m *Migrator) Latest() int {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+// Status reports every known migration and any unknown applied versions
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.Migrations))
+	for _, mg := range m.Migrations {
+		status := MigrationStatus{Migration: mg}
+		if record, ok := applied[mg.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+			status.Modified = record.Checksum != mg.Checksum
+			delete(applied, mg.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range applied {
+		record.Unknown = true
+		statuses = append(statuses, record)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Version returns the highest applied migration version
+func (m *Migrator) Version() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Up applies pending migrations up to and including target; 0 means all
+func (m *Migrator) Up(target int) ([]Migration, error) {
+	if target <= 0 || target > m.Latest() {
+		target = m.Latest()
+	}
+	return m.run("up", func(statuses []MigrationStatus) ([]Migration, error) {
+		var plan []Migration
+		for _, status := range statuses {
+			if !status.Applied && status.Version <= target {
+				plan = append(plan, status.Migration)
+			}
+		}
+		return plan, nil
+	})
+}
+
+// Down reverts applied migrations above target, newest first
+func (m *Migrator) Down(target int) ([]Migration, error) {
+	if target < 0 {
+		return nil, fmt.Errorf("invalid target version %d", target)
+	}
+	return m.run("down", func(statuses []MigrationStatus) ([]Migration, error) {
+		var plan []Migration
+		for i := len(statuses) - 1; i >= 0; i-- {
+			status := statuses[i]
+			if !status.Applied || status.Version <= target {
+				continue
+			}
+			if strings.TrimSpace(status.Down) == "" {
+				return nil, fmt.Errorf("migration %s cannot be reverted: it has no down script", status.Migration)
+			}
+			plan = append(plan, status.Migration)
+		}
+		return plan, nil
+	})
+}
+
+// run plans and applies migrations in one direction under the lock
+func (m *Migrator) run(direction string, planner func([]MigrationStatus) ([]Migration, error)) ([]Migration, error) {
+	if !m.DryRun {
+		if err := ApplySchema(m.DB, m.Dialect, migrationTables); err != nil {
+			return nil, fmt.Errorf("failed to create migration tables: %w", err)
+		}
+		unlock, err := m.lock()
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+	applied := 0
+	for _, status := range statuses {
+		if status.Unknown {
+			return nil, fmt.Errorf("%s database has migration %d applied, which this version does not know; upgrade the server", m.Database, status.Version)
+		}
+		if status.Modified {
+			return nil, fmt.Errorf("migration %s was edited after it was applied to the %s database (checksum mismatch)", status.Migration, m.Database)
+		}
+		if status.Applied {
+			applied++
+		}
+	}
+
+	plan, err := planner(statuses)
+	if err != nil || len(plan) == 0 || m.DryRun {
+		return plan, err
+	}
+
+	// Databases created before versioned migrations have data but no
+	// records; their baseline is applied over the existing tables
+	legacy := applied == 0 && m.hasRows("schema_version")
+	if m.BeforeApply != nil && (applied > 0 || legacy) {
+		if m.Dialect == DialectSQLite {
+			// Fold the WAL into the database file so a file copy is complete
+			m.DB.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+		}
+		if err := m.BeforeApply(m.Database, direction, plan); err != nil {
+			return nil, fmt.Errorf("pre-migration hook failed: %w", err)
+		}
+	}
+
+	for i, mg := range plan {
+		if err := m.apply(mg, direction == "up", legacy && mg.Version == 1); err != nil {
+			return plan[:i], err
+		}
+	}
+	return plan, nil
+}
+
+// apply runs one migration and records it in the same transaction. MySQL
+// commits DDL implicitly, so a failed MySQL migration may be half applied
+func (m *Migrator) apply(mg Migration, up, adopt bool) error {
+	start := time.Now()
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := mg.Down
+	if up {
+		script = mg.Up
+		if adopt {
+			if err := addLegacyColumns(tx, m.Database); err != nil {
+				return fmt.Errorf("migration %s failed: %w", mg, err)
+			}
+		}
+	}
+	if err := execScript(tx, m.Dialect, script); err != nil {
+		return fmt.Errorf("migration %s failed: %w", mg, err)
+	}
+
+	duration := time.Since(start)
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name, checksum, applied_at, duration_ms) VALUES (?, ?, ?, ?, ?)`,
+			mg.Version, mg.Name, mg.Checksum, time.Now().UTC(), duration.Milliseconds())
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, mg.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", mg, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", mg, err)
+	}
+
+	action := "reverted"
+	if up {
+		action = "applied"
+	}
+	log.Printf("%s database: %s migration %s (%s)", m.Database, action, mg, duration.Round(time.Millisecond))
+	return nil
+}
+
+// applied returns the recorded migrations by version
+func (m *Migrator) applied() (map[int]MigrationStatus, error) {
+	applied := make(map[int]MigrationStatus)
+	if !m.hasTable("schema_migrations") {
+		return applied, nil
+	}
+	rows, err := m.DB.Query(`SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status MigrationStatus
+		if err := rows.Scan(&status.Version, &status.Name, &status.Checksum, &status.AppliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		status.Applied = true
+		applied[status.Version] = status
+	}
+	return applied, rows.Err()
+}
+
+// lock takes the migration lock row, waiting up to LockTimeout for another
+// owner to finish. Expired locks are taken over
+func (m *Migrator) lock() (func(), error) {
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		now := time.Now().UTC()
+		m.DB.Exec(`DELETE FROM schema_migration_lock WHERE name = ? AND expires_at < ?`, migrationLockName, now)
+		_, err := m.DB.Exec(`INSERT INTO schema_migration_lock (name, owner, acquired_at, expires_at) VALUES (?, ?, ?, ?)`,
+			migrationLockName, m.LockOwner, now, now.Add(migrationLockTTL))
+		if err == nil {
+			return func() {
+				m.DB.Exec(`DELETE FROM schema_migration_lock WHERE name = ? AND owner = ?`, migrationLockName, m.LockOwner)
+			}, nil
+		}
+
+		var owner string
+		if scanErr := m.DB.QueryRow(`SELECT owner FROM schema_migration_lock WHERE name = ?`, migrationLockName).Scan(&owner); scanErr != nil {
+			// Not a lock conflict
+			return nil, fmt.Errorf("failed to take %s migration lock: %w", m.Database, err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s database migrations are locked by %s", m.Database, owner)
+		}
+		log.Printf("%s database: waiting for migration lock held by %s", m.Database, owner)
+		time.Sleep(time.Second)
+	}
+}
+
+// Unlock removes the migration lock regardless of its owner, for locks
+// left by a node that died mid-migration
+func (m *Migrator) Unlock() (string, error) {
+	if !m.hasTable("schema_migration_lock") {
+		return "", nil
+	}
+	var owner string
+	err := m.DB.QueryRow(`SELECT owner FROM schema_migration_lock WHERE name = ?`, migrationLockName).Scan(&owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	_, err = m.DB.Exec(`DELETE FROM schema_migration_lock WHERE name = ?`, migrationLockName)
+	return owner, err
+}
+
+func (m *Migrator) hasTable(table string) bool {
+	columns, err := tableColumns(m.DB, table)
+	return err == nil && len(columns) > 0
+}
+
+func (m *Migrator) hasRows(table string) bool {
+	if !m.hasTable(table) {
+		return false
+	}
+	var count int
+	return m.DB.QueryRow(`SELECT COUNT(*) FROM `+table).Scan(&count) == nil && count > 0
+}
+
+// MigrateDatabase applies all pending migrations to one database
+func MigrateDatabase(db *sql.DB, dialect Dialect, database string, beforeApply func(string, string, []Migration) error) error {
+	migrator, err := NewMigrator(db, dialect, database)
+	if err != nil {
+		return err
+	}
+	migrator.BeforeApply = beforeApply
+	applied, err := migrator.Up(0)
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 {
+		log.Printf("%s database migrated to version %d", database, applied[len(applied)-1].Version)
+	}
+	return nil
+}
+
+// sqlExecer is satisfied by *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// execScript runs a SQLite flavoured script. SQLite takes it whole; other
+// dialects run it one statement at a time through the translating driver
+func execScript(db sqlExecer, dialect Dialect, script string) error {
+	if dialect == DialectSQLite {
+		_, err := db.Exec(script)
+		return err
+	}
+	for _, statement := range splitStatements(script) {
+		if _, err := db.Exec(statement); err != nil {
+			return fmt.Errorf("%w: %s", err, firstLine(statement))
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the column names of a table, empty if it does not
+// exist
+func tableColumns(db sqlExecer, table string) (map[string]bool, error) {
+	rows, err := db.Query(`PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// addLegacyColumns adds columns missing from tables created before
+// versioned migrations. Tables that do not exist yet are left to the
+// baseline
+func addLegacyColumns(db sqlExecer, database string) error {
+	existing := make(map[string]map[string]bool)
+	for _, c := range legacyColumns[database] {
+		columns, ok := existing[c.table]
+		if !ok {
+			var err error
+			if columns, err = tableColumns(db, c.table); err != nil {
+				return fmt.Errorf("failed to inspect %s schema: %w", c.table, err)
+			}
+			existing[c.table] = columns
+		}
+		if len(columns) == 0 || columns[c.column] {
+			continue
+		}
+		if _, err := db.Exec(`ALTER TABLE ` + c.table + ` ADD COLUMN ` + c.column + ` ` + c.definition); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
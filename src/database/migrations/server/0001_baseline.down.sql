@@ -0,0 +1,38 @@
+-- Drops the baseline server schema in reverse creation order
+
+DROP TABLE IF EXISTS notification_history;
+DROP TABLE IF EXISTS notification_queue;
+DROP TABLE IF EXISTS custom_domains;
+DROP TABLE IF EXISTS server_event_bus;
+DROP TABLE IF EXISTS server_graphql_persisted_queries;
+DROP TABLE IF EXISTS server_metrics;
+DROP TABLE IF EXISTS server_setup_state;
+DROP TABLE IF EXISTS server_ip_blocklist;
+DROP TABLE IF EXISTS server_blocklists;
+DROP TABLE IF EXISTS server_geoip_cache;
+DROP TABLE IF EXISTS server_ssl_certificates;
+DROP TABLE IF EXISTS server_backup_history;
+DROP TABLE IF EXISTS server_admin_preferences;
+DROP TABLE IF EXISTS server_admin_notification_preferences;
+DROP TABLE IF EXISTS server_admin_notifications;
+DROP TABLE IF EXISTS server_notification_templates;
+DROP TABLE IF EXISTS server_notification_channels;
+DROP TABLE IF EXISTS server_rate_limits;
+DROP TABLE IF EXISTS server_audit_log;
+DROP TABLE IF EXISTS server_admin_invites;
+DROP TABLE IF EXISTS server_join_tokens;
+DROP TABLE IF EXISTS server_nodes;
+DROP TABLE IF EXISTS server_scheduler_state;
+DROP TABLE IF EXISTS server_config_versions;
+DROP TABLE IF EXISTS server_config_changes;
+DROP TABLE IF EXISTS server_cluster_state;
+DROP TABLE IF EXISTS server_config;
+DROP TABLE IF EXISTS server_admin_token_usage;
+DROP TABLE IF EXISTS server_admin_tokens;
+DROP TABLE IF EXISTS server_admin_ldap_mappings;
+DROP TABLE IF EXISTS server_admin_oidc_mappings;
+DROP TABLE IF EXISTS server_admin_roles;
+DROP TABLE IF EXISTS server_roles;
+DROP TABLE IF EXISTS server_admin_passkeys;
+DROP TABLE IF EXISTS server_admin_sessions;
+DROP TABLE IF EXISTS server_admin_credentials;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS contact_submissions;
+DROP TABLE IF EXISTS server_cve_alerts;
+DROP TABLE IF EXISTS server_ip_blocklist;
+DROP TABLE IF EXISTS server_scheduler_history;
@@ -0,0 +1,52 @@
+-- Tables that used to be created on first use by the scheduler and the
+-- contact form
+
+CREATE TABLE IF NOT EXISTS server_scheduler_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_name TEXT NOT NULL,
+	start_time DATETIME NOT NULL,
+	end_time DATETIME NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	error TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_server_scheduler_history_name ON server_scheduler_history(task_name);
+CREATE INDEX IF NOT EXISTS idx_server_scheduler_history_start ON server_scheduler_history(start_time DESC);
+
+CREATE TABLE IF NOT EXISTS server_ip_blocklist (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	source TEXT NOT NULL,
+	ip_range TEXT NOT NULL,
+	description TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(source, ip_range)
+);
+
+CREATE TABLE IF NOT EXISTS server_cve_alerts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	cve_id TEXT NOT NULL UNIQUE,
+	description TEXT,
+	severity TEXT,
+	cvss_score REAL,
+	published_at DATETIME,
+	affected_packages TEXT,
+	"references" TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	acknowledged INTEGER DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS contact_submissions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	message TEXT NOT NULL,
+	ip_address TEXT,
+	user_agent TEXT,
+	status TEXT NOT NULL DEFAULT 'pending',
+	created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
+);
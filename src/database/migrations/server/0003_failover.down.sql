@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS failover_heartbeat;
+DROP TABLE IF EXISTS failover_applied_writes;
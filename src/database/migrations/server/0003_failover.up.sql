@@ -0,0 +1,18 @@
+-- Write queue replay and read replica lag tracking (database.FailoverManager)
+
+-- Idempotency keys of queued writes already applied, so a write replayed
+-- again after a crash is skipped
+CREATE TABLE IF NOT EXISTS failover_applied_writes (
+	idempotency_key TEXT PRIMARY KEY,
+	queued_at DATETIME NOT NULL,
+	applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Single row the primary stamps on every health check; a replica's lag is
+-- how old its copy of the stamp is
+CREATE TABLE IF NOT EXISTS failover_heartbeat (
+	id INTEGER PRIMARY KEY,
+	beat_at INTEGER NOT NULL
+);
+
+INSERT INTO failover_heartbeat (id, beat_at) VALUES (1, 0);
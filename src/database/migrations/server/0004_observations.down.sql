@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS weather_forecast_snapshots;
+DROP TABLE IF EXISTS weather_observations;
+DROP TABLE IF EXISTS weather_observation_sites;
@@ -0,0 +1,56 @@
+-- Observation archive of saved and popular locations
+-- (service.ObservationService)
+
+-- Coordinates rounded to 0.01° (about 1 km). Sites are not linked to the
+-- users who saved them; saved is refreshed on every recording run.
+CREATE TABLE IF NOT EXISTS weather_observation_sites (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	latitude REAL NOT NULL,
+	longitude REAL NOT NULL,
+	timezone TEXT NOT NULL DEFAULT 'UTC',
+	saved INTEGER NOT NULL DEFAULT 0,
+	last_requested_at INTEGER,
+	last_observed_at INTEGER,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE(latitude, longitude)
+);
+
+-- Hourly rows hold the values at the start of the hour (precipitation is
+-- the sum of the hour before). Daily rows aggregate the hourly rows of a
+-- local day; time is the unix time of local midnight. Values are metric.
+CREATE TABLE IF NOT EXISTS weather_observations (
+	site_id INTEGER NOT NULL,
+	resolution TEXT NOT NULL CHECK (resolution IN ('hour', 'day')),
+	time INTEGER NOT NULL,
+	temperature REAL,
+	temperature_min REAL,
+	temperature_max REAL,
+	feels_like REAL,
+	humidity REAL,
+	pressure REAL,
+	precipitation REAL,
+	wind_speed REAL,
+	wind_gusts REAL,
+	wind_direction INTEGER,
+	cloud_cover REAL,
+	weather_code INTEGER,
+	samples INTEGER NOT NULL DEFAULT 1,
+	PRIMARY KEY (site_id, resolution, time),
+	FOREIGN KEY (site_id) REFERENCES weather_observation_sites(id) ON DELETE CASCADE
+);
+
+-- Daily forecasts as first issued on each local day, lead_days ahead, to
+-- compare with the daily observations
+CREATE TABLE IF NOT EXISTS weather_forecast_snapshots (
+	site_id INTEGER NOT NULL,
+	day INTEGER NOT NULL,
+	lead_days INTEGER NOT NULL,
+	temperature_max REAL,
+	temperature_min REAL,
+	precipitation REAL,
+	precipitation_probability INTEGER,
+	weather_code INTEGER,
+	issued_at INTEGER NOT NULL,
+	PRIMARY KEY (site_id, day, lead_days),
+	FOREIGN KEY (site_id) REFERENCES weather_observation_sites(id) ON DELETE CASCADE
+);
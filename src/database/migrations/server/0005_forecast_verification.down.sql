@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS weather_forecast_snapshots (
+	site_id INTEGER NOT NULL,
+	day INTEGER NOT NULL,
+	lead_days INTEGER NOT NULL,
+	temperature_max REAL,
+	temperature_min REAL,
+	precipitation REAL,
+	precipitation_probability INTEGER,
+	weather_code INTEGER,
+	issued_at INTEGER NOT NULL,
+	PRIMARY KEY (site_id, day, lead_days),
+	FOREIGN KEY (site_id) REFERENCES weather_observation_sites(id) ON DELETE CASCADE
+);
+
+INSERT INTO weather_forecast_snapshots (site_id, day, lead_days, temperature_max, temperature_min,
+	precipitation, precipitation_probability, weather_code, issued_at)
+SELECT site_id, day, lead_days, temperature_max, temperature_min,
+	precipitation, precipitation_probability, weather_code, issued_at
+FROM weather_forecast_issues
+WHERE provider = 'open-meteo';
+
+DROP TABLE IF EXISTS weather_forecast_issues;
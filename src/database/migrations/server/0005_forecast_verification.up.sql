@@ -0,0 +1,30 @@
+-- Forecast verification per provider (service.ObservationService).
+-- Replaces weather_forecast_snapshots, whose forecasts all came from
+-- Open-Meteo.
+
+-- Daily forecasts as first issued on each local day by a provider,
+-- lead_days ahead, from recording runs and served forecasts alike. Values
+-- are metric.
+CREATE TABLE IF NOT EXISTS weather_forecast_issues (
+	site_id INTEGER NOT NULL,
+	provider TEXT NOT NULL,
+	day INTEGER NOT NULL,
+	lead_days INTEGER NOT NULL,
+	temperature_max REAL,
+	temperature_min REAL,
+	precipitation REAL,
+	precipitation_probability INTEGER,
+	wind_gusts_max REAL,
+	weather_code INTEGER,
+	issued_at INTEGER NOT NULL,
+	PRIMARY KEY (site_id, provider, day, lead_days),
+	FOREIGN KEY (site_id) REFERENCES weather_observation_sites(id) ON DELETE CASCADE
+);
+
+INSERT INTO weather_forecast_issues (site_id, provider, day, lead_days, temperature_max, temperature_min,
+	precipitation, precipitation_probability, weather_code, issued_at)
+SELECT site_id, 'open-meteo', day, lead_days, temperature_max, temperature_min,
+	precipitation, precipitation_probability, weather_code, issued_at
+FROM weather_forecast_snapshots;
+
+DROP TABLE IF EXISTS weather_forecast_snapshots;
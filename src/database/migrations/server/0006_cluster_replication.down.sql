@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS _replication_seq;
+DROP TABLE IF EXISTS cluster_nodes;
@@ -0,0 +1,23 @@
+-- Tables that used to be created at startup by the cluster manager and
+-- the backup replicator
+
+-- Nodes of the cluster and their last heartbeat (cluster.ClusterManager)
+CREATE TABLE IF NOT EXISTS cluster_nodes (
+	node_id TEXT PRIMARY KEY,
+	address TEXT NOT NULL,
+	state TEXT NOT NULL DEFAULT 'secondary',
+	last_heartbeat TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	is_healthy INTEGER NOT NULL DEFAULT 1,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Single row backup.Replicator bumps so every read that pins the WAL sees
+-- a frame of its own
+CREATE TABLE IF NOT EXISTS _replication_seq (
+	id INTEGER PRIMARY KEY,
+	seq INTEGER NOT NULL
+);
+
+-- Databases that replicated before this migration already have the row
+INSERT OR IGNORE INTO _replication_seq (id, seq) VALUES (1, 0);
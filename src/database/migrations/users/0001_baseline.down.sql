@@ -0,0 +1,31 @@
+-- Drops the baseline users schema in reverse creation order
+
+DROP TABLE IF EXISTS org_token_usage;
+DROP TABLE IF EXISTS org_tokens;
+DROP TABLE IF EXISTS org_weather_alert_history;
+DROP TABLE IF EXISTS org_notification_channels;
+DROP TABLE IF EXISTS org_alert_subscriptions;
+DROP TABLE IF EXISTS org_saved_locations;
+DROP TABLE IF EXISTS org_invites;
+DROP TABLE IF EXISTS org_members;
+DROP TABLE IF EXISTS org_accounts;
+DROP TABLE IF EXISTS user_devices;
+DROP TABLE IF EXISTS user_login_state;
+DROP TABLE IF EXISTS user_activity_log;
+DROP TABLE IF EXISTS user_password_resets;
+DROP TABLE IF EXISTS user_email_verifications;
+DROP TABLE IF EXISTS user_ldap_mappings;
+DROP TABLE IF EXISTS user_oidc_mappings;
+DROP TABLE IF EXISTS user_passkey_handles;
+DROP TABLE IF EXISTS user_passkeys;
+DROP TABLE IF EXISTS user_preferences;
+DROP TABLE IF EXISTS recovery_keys;
+DROP TABLE IF EXISTS user_notification_preferences;
+DROP TABLE IF EXISTS user_notifications;
+DROP TABLE IF EXISTS user_weather_alerts;
+DROP TABLE IF EXISTS user_saved_locations;
+DROP TABLE IF EXISTS user_invites;
+DROP TABLE IF EXISTS user_sessions;
+DROP TABLE IF EXISTS user_token_usage;
+DROP TABLE IF EXISTS user_tokens;
+DROP TABLE IF EXISTS user_accounts;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_account_deletions;
+DROP TABLE IF EXISTS user_data_exports;
@@ -0,0 +1,26 @@
+-- Personal data exports and account deletion requests (service.PrivacyService)
+
+-- "Download my data" jobs; the ZIP is written to {data_dir}/exports/<id>.zip
+-- and removed with the row when the data_exports retention period ends
+CREATE TABLE IF NOT EXISTS user_data_exports (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'running', 'ready', 'failed')),
+	file_size INTEGER NOT NULL DEFAULT 0,
+	error TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	completed_at DATETIME,
+	FOREIGN KEY (user_id) REFERENCES user_accounts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user ON user_data_exports(user_id, created_at);
+
+-- Pending "delete my account" requests, confirmed by the emailed link
+CREATE TABLE IF NOT EXISTS user_account_deletions (
+	user_id INTEGER PRIMARY KEY,
+	token_hash TEXT UNIQUE NOT NULL,
+	requested_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	expires_at DATETIME NOT NULL,
+	ip_address TEXT,
+	FOREIGN KEY (user_id) REFERENCES user_accounts(id) ON DELETE CASCADE
+);
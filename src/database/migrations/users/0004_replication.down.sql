@@ -0,0 +1 @@
+DROP TABLE IF EXISTS _replication_seq;
@@ -0,0 +1,9 @@
+-- Single row backup.Replicator bumps so every read that pins the WAL sees
+-- a frame of its own. It used to be created when replication started
+CREATE TABLE IF NOT EXISTS _replication_seq (
+	id INTEGER PRIMARY KEY,
+	seq INTEGER NOT NULL
+);
+
+-- Databases that replicated before this migration already have the row
+INSERT OR IGNORE INTO _replication_seq (id, seq) VALUES (1, 0);
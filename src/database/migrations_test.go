@@ -0,0 +1,230 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openMigrationTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, _, cleanup, err := OpenScratchDB("sqlite:", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanup)
+	return db
+}
+
+func TestLoadMigrations(t *testing.T) {
+	for _, database := range []string{MigrationsServer, MigrationsUsers} {
+		migrations, err := LoadMigrations(database)
+		if err != nil {
+			t.Fatalf("%s: %v", database, err)
+		}
+		if len(migrations) == 0 || migrations[0].Name != "baseline" {
+			t.Fatalf("%s migrations = %v", database, migrations)
+		}
+		for i, mg := range migrations {
+			if mg.Version != i+1 || len(mg.Checksum) != 64 || mg.Down == "" {
+				t.Errorf("%s migration %s: version %d, checksum %q, down %d bytes", database, mg, mg.Version, mg.Checksum, len(mg.Down))
+			}
+		}
+	}
+	if ServerSchema != mustMigration(t, MigrationsServer, 1).Up {
+		t.Error("ServerSchema is not the server baseline")
+	}
+	if _, err := LoadMigrations("reports"); err == nil {
+		t.Error("Expected unknown database to fail")
+	}
+}
+
+func mustMigration(t *testing.T, database string, version int) Migration {
+	t.Helper()
+	migrations, err := LoadMigrations(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations[version-1]
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	db := openMigrationTestDB(t)
+	m, err := NewMigrator(db, DialectSQLite, MigrationsServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.DryRun = true
+	plan, err := m.Up(0)
+	if err != nil || len(plan) != m.Latest() {
+		t.Fatalf("dry run plan = %v, %v", plan, err)
+	}
+	if m.hasTable("schema_migrations") {
+		t.Fatal("dry run created the migration tables")
+	}
+	m.DryRun = false
+
+	applied, err := m.Up(0)
+	if err != nil || len(applied) != m.Latest() {
+		t.Fatalf("Up = %v, %v", applied, err)
+	}
+	if version, _ := m.Version(); version != m.Latest() {
+		t.Errorf("version = %d, want %d", version, m.Latest())
+	}
+	if !m.hasTable("server_cve_alerts") {
+		t.Error("server_cve_alerts missing after up")
+	}
+	if again, err := m.Up(0); err != nil || len(again) != 0 {
+		t.Errorf("second Up = %v, %v", again, err)
+	}
+
+	reverted, err := m.Down(1)
+	if err != nil || len(reverted) != m.Latest()-1 || reverted[0].Version != m.Latest() {
+		t.Fatalf("Down = %v, %v", reverted, err)
+	}
+	if m.hasTable("server_cve_alerts") || !m.hasTable("server_config") {
+		t.Error("Down(1) should drop migration 2 tables and keep the baseline")
+	}
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !statuses[0].Applied || statuses[0].AppliedAt.IsZero() || statuses[1].Applied {
+		t.Errorf("statuses = %+v", statuses[:2])
+	}
+
+	if _, err := m.Down(0); err != nil {
+		t.Fatalf("Down(0) = %v", err)
+	}
+	if m.hasTable("server_config") {
+		t.Error("baseline tables remain after Down(0)")
+	}
+}
+
+func TestMigratorChecksumAndUnknownVersions(t *testing.T) {
+	db := openMigrationTestDB(t)
+	m, err := NewMigrator(db, DialectSQLite, MigrationsUsers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(`UPDATE schema_migrations SET checksum = 'edited' WHERE version = 1`); err != nil {
+		t.Fatal(err)
+	}
+	statuses, _ := m.Status()
+	if !statuses[0].Modified {
+		t.Error("edited migration not reported as modified")
+	}
+	if _, err := m.Down(0); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Down with edited migration = %v", err)
+	}
+	db.Exec(`UPDATE schema_migrations SET checksum = ? WHERE version = 1`, m.Migrations[0].Checksum)
+
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (99, 'future', 'x', ?)`, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(0); err == nil || !strings.Contains(err.Error(), "does not know") {
+		t.Errorf("Up with unknown version = %v", err)
+	}
+}
+
+func TestMigratorLock(t *testing.T) {
+	db := openMigrationTestDB(t)
+	m, err := NewMigrator(db, DialectSQLite, MigrationsServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.LockTimeout = 0
+	if err := ApplySchema(db, DialectSQLite, migrationTables); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	db.Exec(`INSERT INTO schema_migration_lock (name, owner, acquired_at, expires_at) VALUES (?, 'node-b:42', ?, ?)`,
+		migrationLockName, now, now.Add(time.Minute))
+	if _, err := m.Up(0); err == nil || !strings.Contains(err.Error(), "node-b:42") {
+		t.Fatalf("Up while locked = %v", err)
+	}
+
+	// An expired lock is taken over
+	db.Exec(`UPDATE schema_migration_lock SET expires_at = ?`, now.Add(-time.Minute))
+	if _, err := m.Up(0); err != nil {
+		t.Fatalf("Up with expired lock = %v", err)
+	}
+	if owner, err := m.Unlock(); err != nil || owner != "" {
+		t.Errorf("lock not released after Up: owner %q, %v", owner, err)
+	}
+}
+
+func TestMigratorBeforeApply(t *testing.T) {
+	db := openMigrationTestDB(t)
+	m, err := NewMigrator(db, DialectSQLite, MigrationsServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls [][]Migration
+	m.BeforeApply = func(database, direction string, plan []Migration) error {
+		calls = append(calls, plan)
+		return nil
+	}
+
+	// Nothing to back up in a new database
+	if _, err := m.Up(1); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("BeforeApply called for a new database: %v", calls)
+	}
+	if _, err := m.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0][0].Version != 2 {
+		t.Errorf("BeforeApply calls = %v", calls)
+	}
+}
+
+func TestMigratorAdoptsLegacyDatabase(t *testing.T) {
+	db := openMigrationTestDB(t)
+	// A server database from before versioned migrations: schema_version
+	// rows and a table without a column later added on first use
+	if err := ApplySchema(db, DialectSQLite, `
+		CREATE TABLE schema_version (version INTEGER PRIMARY KEY, applied_at DATETIME DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO schema_version (version) VALUES (6);
+		CREATE TABLE server_blocklists (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			type TEXT NOT NULL,
+			value TEXT NOT NULL,
+			reason TEXT,
+			source TEXT NOT NULL DEFAULT 'manual',
+			added_by TEXT,
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME,
+			UNIQUE(type, value)
+		);
+		INSERT INTO server_blocklists (type, value) VALUES ('ip', '192.0.2.1');
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	backups := 0
+	err := MigrateDatabase(db, DialectSQLite, MigrationsServer, func(string, string, []Migration) error {
+		backups++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backups != 1 {
+		t.Errorf("legacy database migrated with %d backups, want 1", backups)
+	}
+	var action string
+	if err := db.QueryRow(`SELECT action FROM server_blocklists WHERE value = '192.0.2.1'`).Scan(&action); err != nil || action != "deny" {
+		t.Errorf("action = %q, %v", action, err)
+	}
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// OpenScratchDB opens an empty, isolated database for tests. connString
+// names the server (sqlite:, postgres:// or mysql:// URL); PostgreSQL gets
+// a new schema and MySQL a new database called name. SQLite uses a shared
+// in-memory database. The cleanup function drops what was created
+func OpenScratchDB(connString, name string) (*sql.DB, Dialect, func(), error) {
+	config, err := ParseConnectionString(connString)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	dialect, err := ParseDialect(config.Type)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	name = scratchName(name)
+
+	if dialect == DialectSQLite {
+		db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=memory&cache=shared", name))
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return db, dialect, func() { db.Close() }, nil
+	}
+
+	admin, err := openRemoteDB(config, config.Database)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var db *sql.DB
+	var drop string
+	switch dialect {
+	case DialectPostgres:
+		drop = "DROP SCHEMA IF EXISTS " + name + " CASCADE"
+		if _, err = admin.Exec(drop); err == nil {
+			_, err = admin.Exec("CREATE SCHEMA " + name)
+		}
+		if err == nil {
+			scoped := *config
+			scoped.Options = map[string]string{"search_path": name}
+			for key, value := range config.Options {
+				if key != "search_path" {
+					scoped.Options[key] = value
+				}
+			}
+			db, err = openRemoteDB(&scoped, config.Database)
+		}
+	case DialectMySQL:
+		drop = "DROP DATABASE IF EXISTS " + name
+		if _, err = admin.Exec(drop); err == nil {
+			_, err = admin.Exec("CREATE DATABASE " + name + " CHARACTER SET utf8mb4")
+		}
+		if err == nil {
+			db, err = openRemoteDB(config, name)
+		}
+	}
+	if err != nil {
+		admin.Exec(drop)
+		admin.Close()
+		return nil, "", nil, fmt.Errorf("failed to create scratch database %s: %w", name, err)
+	}
+
+	cleanup := func() {
+		db.Close()
+		admin.Exec(drop)
+		admin.Close()
+	}
+	return db, dialect, cleanup, nil
+}
+
+// scratchName reduces a test name to a valid unquoted identifier
+func scratchName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	out := b.String()
+	if len(out) > 60 {
+		out = out[len(out)-60:]
+	}
+	if out == "" || out[0] >= '0' && out[0] <= '9' {
+		out = "t_" + out
+	}
+	return out
+}
@@ -59,22 +59,41 @@ func ApplyPoolConfig(db *sql.DB, cfg PoolConfig) {
 	db.SetConnMaxIdleTime(cfg.MaxIdleTime)
 }
 
-// QueryRowContext executes a query with timeout and returns a single row
-func QueryRowContext(ctx context.Context, db *sql.DB, timeout time.Duration, query string, args ...interface{}) *sql.Row {
+// Querier is the query interface shared by *sql.DB and *sql.Tx
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// QueryRowContext executes a query with timeout and scans its single row.
+// The row is scanned inside the call because it cannot be read once the
+// timeout context is canceled
+func QueryRowContext(ctx context.Context, db Querier, timeout time.Duration, scan func(*sql.Row) error, query string, args ...interface{}) error {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	return db.QueryRowContext(ctx, query, args...)
+	return scan(db.QueryRowContext(ctx, query, args...))
 }
 
-// QueryContext executes a query with timeout and returns rows
-func QueryContext(ctx context.Context, db *sql.DB, timeout time.Duration, query string, args ...interface{}) (*sql.Rows, error) {
+// QueryContext executes a query with timeout and calls scan for each row
+func QueryContext(ctx context.Context, db Querier, timeout time.Duration, scan func(*sql.Rows) error, query string, args ...interface{}) error {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	return db.QueryContext(ctx, query, args...)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
 
 // ExecContext executes a statement with timeout
-func ExecContext(ctx context.Context, db *sql.DB, timeout time.Duration, query string, args ...interface{}) (sql.Result, error) {
+func ExecContext(ctx context.Context, db Querier, timeout time.Duration, query string, args ...interface{}) (sql.Result, error) {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	return db.ExecContext(ctx, query, args...)
@@ -0,0 +1,182 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/apimgr/weather/src/server/service"
+)
+
+// Batching window: resolvers for sibling list items run concurrently, so a
+// short wait collects them into one upstream call (avoids N+1 weather fetches)
+const (
+	dataLoaderWait     = 2 * time.Millisecond
+	dataLoaderMaxBatch = 50
+	// Forecast days fetched for SavedLocation.weather
+	savedLocationForecastDays = 7
+)
+
+// batchLoader collects keys requested during a short window and resolves them
+// with a single fetch call. Results are memoised for the life of the loader,
+// which is one GraphQL operation.
+type batchLoader[K comparable, V any] struct {
+	fetch    func(ctx context.Context, keys []K) ([]V, []error)
+	wait     time.Duration
+	maxBatch int
+
+	mu      sync.Mutex
+	results map[K]*loaderResult[V]
+	batch   *loaderBatch[K, V]
+}
+
+type loaderResult[V any] struct {
+	value V
+	err   error
+	done  chan struct{}
+}
+
+type loaderBatch[K comparable, V any] struct {
+	keys    []K
+	results []*loaderResult[V]
+	closed  bool
+}
+
+func newBatchLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) ([]V, []error)) *batchLoader[K, V] {
+	return &batchLoader[K, V]{
+		fetch:    fetch,
+		wait:     dataLoaderWait,
+		maxBatch: dataLoaderMaxBatch,
+		results:  make(map[K]*loaderResult[V]),
+	}
+}
+
+// Load returns the value for key, batching with concurrent Load calls
+func (l *batchLoader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	result, ok := l.results[key]
+	if !ok {
+		result = &loaderResult[V]{done: make(chan struct{})}
+		l.results[key] = result
+
+		if l.batch == nil {
+			l.batch = &loaderBatch[K, V]{}
+			go l.dispatchAfter(ctx, l.batch)
+		}
+		batch := l.batch
+		batch.keys = append(batch.keys, key)
+		batch.results = append(batch.results, result)
+		if len(batch.keys) >= l.maxBatch {
+			l.batch = nil
+			batch.closed = true
+			go l.run(ctx, batch)
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-result.done:
+		return result.value, result.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (l *batchLoader[K, V]) dispatchAfter(ctx context.Context, batch *loaderBatch[K, V]) {
+	time.Sleep(l.wait)
+
+	l.mu.Lock()
+	if batch.closed {
+		l.mu.Unlock()
+		return
+	}
+	batch.closed = true
+	if l.batch == batch {
+		l.batch = nil
+	}
+	l.mu.Unlock()
+
+	l.run(ctx, batch)
+}
+
+func (l *batchLoader[K, V]) run(ctx context.Context, batch *loaderBatch[K, V]) {
+	values, errs := l.fetch(ctx, batch.keys)
+	for i, result := range batch.results {
+		if i < len(values) {
+			result.value = values[i]
+		}
+		if len(errs) == 1 {
+			result.err = errs[0]
+		} else if i < len(errs) {
+			result.err = errs[i]
+		}
+		close(result.done)
+	}
+}
+
+// forecastKey identifies a forecast request
+type forecastKey struct {
+	Point service.WeatherPoint
+	Days  int
+}
+
+// Loaders are the per-operation DataLoaders
+type Loaders struct {
+	CurrentWeather *batchLoader[service.WeatherPoint, *service.CurrentWeather]
+	Forecast       *batchLoader[forecastKey, *service.Forecast]
+}
+
+type loadersContextKey struct{}
+
+// NewLoaders creates DataLoaders backed by the weather service
+func NewLoaders(weatherService *service.WeatherService) *Loaders {
+	return &Loaders{
+		CurrentWeather: newBatchLoader(func(ctx context.Context, points []service.WeatherPoint) ([]*service.CurrentWeather, []error) {
+			weather, err := weatherService.GetCurrentWeatherBatch(points, "imperial")
+			if err != nil {
+				return nil, []error{err}
+			}
+			return weather, nil
+		}),
+		// Open-Meteo has no multi-location forecast with hourly grouping we can
+		// reuse, so forecasts are deduplicated and fetched in parallel instead
+		Forecast: newBatchLoader(func(ctx context.Context, keys []forecastKey) ([]*service.Forecast, []error) {
+			forecasts := make([]*service.Forecast, len(keys))
+			errs := make([]error, len(keys))
+			var wg sync.WaitGroup
+			for i, key := range keys {
+				wg.Add(1)
+				go func(i int, key forecastKey) {
+					defer wg.Done()
+					forecasts[i], errs[i] = weatherService.GetForecast(key.Point.Latitude, key.Point.Longitude, key.Days, "imperial")
+				}(i, key)
+			}
+			wg.Wait()
+			return forecasts, errs
+		}),
+	}
+}
+
+// WithLoaders attaches fresh DataLoaders to the operation context
+func WithLoaders(ctx context.Context, weatherService *service.WeatherService) context.Context {
+	return context.WithValue(ctx, loadersContextKey{}, NewLoaders(weatherService))
+}
+
+// loadersFromContext returns the operation's DataLoaders, creating
+// unshared ones when the context was not prepared by the server
+func loadersFromContext(ctx context.Context, weatherService *service.WeatherService) *Loaders {
+	if loaders, ok := ctx.Value(loadersContextKey{}).(*Loaders); ok {
+		return loaders
+	}
+	return NewLoaders(weatherService)
+}
+
+// loadersOperationMiddleware gives every operation its own DataLoaders so
+// memoised results never leak between requests
+func loadersOperationMiddleware(weatherService *service.WeatherService) graphql.OperationMiddleware {
+	return func(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+		return next(WithLoaders(ctx, weatherService))
+	}
+}
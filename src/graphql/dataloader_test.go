@@ -0,0 +1,75 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestBatchLoader_BatchesConcurrentLoads(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]int
+
+	loader := newBatchLoader(func(ctx context.Context, keys []int) ([]int, []error) {
+		mu.Lock()
+		batches = append(batches, append([]int(nil), keys...))
+		mu.Unlock()
+
+		values := make([]int, len(keys))
+		for i, key := range keys {
+			values[i] = key * 10
+		}
+		return values, nil
+	})
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	// Key 3 is requested twice and must only be fetched once
+	keys := []int{1, 2, 3, 3}
+	results := make([]int, len(keys))
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i, key int) {
+			defer wg.Done()
+			value, err := loader.Load(ctx, key)
+			if err != nil {
+				t.Errorf("Load(%d) error: %v", key, err)
+			}
+			results[i] = value
+		}(i, key)
+	}
+	wg.Wait()
+
+	for i, key := range keys {
+		if results[i] != key*10 {
+			t.Errorf("Load(%d) = %d, want %d", key, results[i], key*10)
+		}
+	}
+
+	fetched := 0
+	for _, batch := range batches {
+		fetched += len(batch)
+	}
+	if fetched != 3 {
+		t.Errorf("fetched %d keys across %d batches, want 3 unique keys", fetched, len(batches))
+	}
+
+	// Memoised: a later load does not hit fetch again
+	before := len(batches)
+	if value, _ := loader.Load(ctx, 2); value != 20 {
+		t.Errorf("memoised Load(2) = %d, want 20", value)
+	}
+	if len(batches) != before {
+		t.Error("memoised key triggered another fetch")
+	}
+}
+
+func TestBatchLoader_SharedErrorAppliesToAllKeys(t *testing.T) {
+	loader := newBatchLoader(func(ctx context.Context, keys []string) ([]string, []error) {
+		return nil, []error{context.DeadlineExceeded}
+	})
+
+	if _, err := loader.Load(context.Background(), "a"); err != context.DeadlineExceeded {
+		t.Errorf("Load error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
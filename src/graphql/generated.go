@@ -8,6 +8,7 @@ import (
 	"embed"
 	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -49,6 +50,7 @@ type ResolverRoot interface {
 	Query() QueryResolver
 	SavedLocation() SavedLocationResolver
 	Setting() SettingResolver
+	Subscription() SubscriptionResolver
 	User() UserResolver
 	__InputValue() __InputValueResolver
 	__Type() __TypeResolver
@@ -612,6 +614,7 @@ type ComplexityRoot struct {
 		Region    func(childComplexity int) int
 		UpdatedAt func(childComplexity int) int
 		UserID    func(childComplexity int) int
+		Weather   func(childComplexity int) int
 	}
 
 	ScheduledTask struct {
@@ -656,6 +659,13 @@ type ComplexityRoot struct {
 		Type        func(childComplexity int) int
 	}
 
+	Subscription struct {
+		Earthquakes         func(childComplexity int, minMagnitude *float64, region *string) int
+		Notifications       func(childComplexity int) int
+		SevereWeatherAlerts func(childComplexity int, lat float64, lon float64, radius *float64) int
+		WeatherUpdates      func(childComplexity int, locationID string) int
+	}
+
 	SystemStats struct {
 		Database      func(childComplexity int) int
 		Locations     func(childComplexity int) int
@@ -906,11 +916,19 @@ type SavedLocationResolver interface {
 	Country(ctx context.Context, obj *models.SavedLocation) (*string, error)
 	Region(ctx context.Context, obj *models.SavedLocation) (*string, error)
 	Alerts(ctx context.Context, obj *models.SavedLocation) (bool, error)
+
+	Weather(ctx context.Context, obj *models.SavedLocation) (*Weather, error)
 }
 type SettingResolver interface {
 	UpdatedAt(ctx context.Context, obj *models.Setting) (*time.Time, error)
 	UpdatedBy(ctx context.Context, obj *models.Setting) (*string, error)
 }
+type SubscriptionResolver interface {
+	SevereWeatherAlerts(ctx context.Context, lat float64, lon float64, radius *float64) (<-chan *WeatherAlert, error)
+	Notifications(ctx context.Context) (<-chan *models.Notification, error)
+	Earthquakes(ctx context.Context, minMagnitude *float64, region *string) (<-chan *Earthquake, error)
+	WeatherUpdates(ctx context.Context, locationID string) (<-chan *Weather, error)
+}
 type UserResolver interface {
 	LastLoginAt(ctx context.Context, obj *models.User) (*time.Time, error)
 }
@@ -3556,6 +3574,13 @@ func (e *executableSchema) Complexity(typeName, field string, childComplexity in
 
 		return e.complexity.SavedLocation.UserID(childComplexity), true
 
+	case "SavedLocation.weather":
+		if e.complexity.SavedLocation.Weather == nil {
+			break
+		}
+
+		return e.complexity.SavedLocation.Weather(childComplexity), true
+
 	case "ScheduledTask.avgDuration":
 		if e.complexity.ScheduledTask.AvgDuration == nil {
 			break
@@ -3745,6 +3770,49 @@ func (e *executableSchema) Complexity(typeName, field string, childComplexity in
 
 		return e.complexity.SevereWeather.Type(childComplexity), true
 
+	case "Subscription.earthquakes":
+		if e.complexity.Subscription.Earthquakes == nil {
+			break
+		}
+
+		args, err := ec.field_Subscription_earthquakes_args(context.TODO(), rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Subscription.Earthquakes(childComplexity, args["minMagnitude"].(*float64), args["region"].(*string)), true
+
+	case "Subscription.notifications":
+		if e.complexity.Subscription.Notifications == nil {
+			break
+		}
+
+		return e.complexity.Subscription.Notifications(childComplexity), true
+
+	case "Subscription.severeWeatherAlerts":
+		if e.complexity.Subscription.SevereWeatherAlerts == nil {
+			break
+		}
+
+		args, err := ec.field_Subscription_severeWeatherAlerts_args(context.TODO(), rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Subscription.SevereWeatherAlerts(childComplexity, args["lat"].(float64), args["lon"].(float64), args["radius"].(*float64)), true
+
+	case "Subscription.weatherUpdates":
+		if e.complexity.Subscription.WeatherUpdates == nil {
+			break
+		}
+
+		args, err := ec.field_Subscription_weatherUpdates_args(context.TODO(), rawArgs)
+		if err != nil {
+			return 0, false
+		}
+
+		return e.complexity.Subscription.WeatherUpdates(childComplexity, args["locationId"].(string)), true
+
 	case "SystemStats.database":
 		if e.complexity.SystemStats.Database == nil {
 			break
@@ -4666,6 +4734,23 @@ func (e *executableSchema) Exec(ctx context.Context) graphql.ResponseHandler {
 			var buf bytes.Buffer
 			data.MarshalGQL(&buf)
 
+			return &graphql.Response{
+				Data: buf.Bytes(),
+			}
+		}
+	case ast.Subscription:
+		next := ec._Subscription(ctx, opCtx.Operation.SelectionSet)
+
+		var buf bytes.Buffer
+		return func(ctx context.Context) *graphql.Response {
+			buf.Reset()
+			data := next(ctx)
+
+			if data == nil {
+				return nil
+			}
+			data.MarshalGQL(&buf)
+
 			return &graphql.Response{
 				Data: buf.Bytes(),
 			}
@@ -8078,6 +8163,183 @@ func (ec *executionContext) field_Query_weather_argsLon(
 	return zeroVal, nil
 }
 
+func (ec *executionContext) field_Subscription_earthquakes_args(ctx context.Context, rawArgs map[string]interface{}) (map[string]interface{}, error) {
+	var err error
+	args := map[string]interface{}{}
+	arg0, err := ec.field_Subscription_earthquakes_argsMinMagnitude(ctx, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	args["minMagnitude"] = arg0
+	arg1, err := ec.field_Subscription_earthquakes_argsRegion(ctx, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	args["region"] = arg1
+	return args, nil
+}
+func (ec *executionContext) field_Subscription_earthquakes_argsMinMagnitude(
+	ctx context.Context,
+	rawArgs map[string]interface{},
+) (*float64, error) {
+	// We won't call the directive if the argument is null.
+	// Set call_argument_directives_with_null to true to call directives
+	// even if the argument is null.
+	_, ok := rawArgs["minMagnitude"]
+	if !ok {
+		var zeroVal *float64
+		return zeroVal, nil
+	}
+
+	ctx = graphql.WithPathContext(ctx, graphql.NewPathWithField("minMagnitude"))
+	if tmp, ok := rawArgs["minMagnitude"]; ok {
+		return ec.unmarshalOFloat2ᚖfloat64(ctx, tmp)
+	}
+
+	var zeroVal *float64
+	return zeroVal, nil
+}
+
+func (ec *executionContext) field_Subscription_earthquakes_argsRegion(
+	ctx context.Context,
+	rawArgs map[string]interface{},
+) (*string, error) {
+	// We won't call the directive if the argument is null.
+	// Set call_argument_directives_with_null to true to call directives
+	// even if the argument is null.
+	_, ok := rawArgs["region"]
+	if !ok {
+		var zeroVal *string
+		return zeroVal, nil
+	}
+
+	ctx = graphql.WithPathContext(ctx, graphql.NewPathWithField("region"))
+	if tmp, ok := rawArgs["region"]; ok {
+		return ec.unmarshalOString2ᚖstring(ctx, tmp)
+	}
+
+	var zeroVal *string
+	return zeroVal, nil
+}
+
+func (ec *executionContext) field_Subscription_severeWeatherAlerts_args(ctx context.Context, rawArgs map[string]interface{}) (map[string]interface{}, error) {
+	var err error
+	args := map[string]interface{}{}
+	arg0, err := ec.field_Subscription_severeWeatherAlerts_argsLat(ctx, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	args["lat"] = arg0
+	arg1, err := ec.field_Subscription_severeWeatherAlerts_argsLon(ctx, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	args["lon"] = arg1
+	arg2, err := ec.field_Subscription_severeWeatherAlerts_argsRadius(ctx, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	args["radius"] = arg2
+	return args, nil
+}
+func (ec *executionContext) field_Subscription_severeWeatherAlerts_argsLat(
+	ctx context.Context,
+	rawArgs map[string]interface{},
+) (float64, error) {
+	// We won't call the directive if the argument is null.
+	// Set call_argument_directives_with_null to true to call directives
+	// even if the argument is null.
+	_, ok := rawArgs["lat"]
+	if !ok {
+		var zeroVal float64
+		return zeroVal, nil
+	}
+
+	ctx = graphql.WithPathContext(ctx, graphql.NewPathWithField("lat"))
+	if tmp, ok := rawArgs["lat"]; ok {
+		return ec.unmarshalNFloat2float64(ctx, tmp)
+	}
+
+	var zeroVal float64
+	return zeroVal, nil
+}
+
+func (ec *executionContext) field_Subscription_severeWeatherAlerts_argsLon(
+	ctx context.Context,
+	rawArgs map[string]interface{},
+) (float64, error) {
+	// We won't call the directive if the argument is null.
+	// Set call_argument_directives_with_null to true to call directives
+	// even if the argument is null.
+	_, ok := rawArgs["lon"]
+	if !ok {
+		var zeroVal float64
+		return zeroVal, nil
+	}
+
+	ctx = graphql.WithPathContext(ctx, graphql.NewPathWithField("lon"))
+	if tmp, ok := rawArgs["lon"]; ok {
+		return ec.unmarshalNFloat2float64(ctx, tmp)
+	}
+
+	var zeroVal float64
+	return zeroVal, nil
+}
+
+func (ec *executionContext) field_Subscription_severeWeatherAlerts_argsRadius(
+	ctx context.Context,
+	rawArgs map[string]interface{},
+) (*float64, error) {
+	// We won't call the directive if the argument is null.
+	// Set call_argument_directives_with_null to true to call directives
+	// even if the argument is null.
+	_, ok := rawArgs["radius"]
+	if !ok {
+		var zeroVal *float64
+		return zeroVal, nil
+	}
+
+	ctx = graphql.WithPathContext(ctx, graphql.NewPathWithField("radius"))
+	if tmp, ok := rawArgs["radius"]; ok {
+		return ec.unmarshalOFloat2ᚖfloat64(ctx, tmp)
+	}
+
+	var zeroVal *float64
+	return zeroVal, nil
+}
+
+func (ec *executionContext) field_Subscription_weatherUpdates_args(ctx context.Context, rawArgs map[string]interface{}) (map[string]interface{}, error) {
+	var err error
+	args := map[string]interface{}{}
+	arg0, err := ec.field_Subscription_weatherUpdates_argsLocationID(ctx, rawArgs)
+	if err != nil {
+		return nil, err
+	}
+	args["locationId"] = arg0
+	return args, nil
+}
+func (ec *executionContext) field_Subscription_weatherUpdates_argsLocationID(
+	ctx context.Context,
+	rawArgs map[string]interface{},
+) (string, error) {
+	// We won't call the directive if the argument is null.
+	// Set call_argument_directives_with_null to true to call directives
+	// even if the argument is null.
+	_, ok := rawArgs["locationId"]
+	if !ok {
+		var zeroVal string
+		return zeroVal, nil
+	}
+
+	ctx = graphql.WithPathContext(ctx, graphql.NewPathWithField("locationId"))
+	if tmp, ok := rawArgs["locationId"]; ok {
+		return ec.unmarshalNID2string(ctx, tmp)
+	}
+
+	var zeroVal string
+	return zeroVal, nil
+}
+
 func (ec *executionContext) field___Directive_args_args(ctx context.Context, rawArgs map[string]interface{}) (map[string]interface{}, error) {
 	var err error
 	args := map[string]interface{}{}
@@ -17119,6 +17381,8 @@ func (ec *executionContext) fieldContext_Mutation_createSavedLocation(ctx contex
 				return ec.fieldContext_SavedLocation_createdAt(ctx, field)
 			case "updatedAt":
 				return ec.fieldContext_SavedLocation_updatedAt(ctx, field)
+			case "weather":
+				return ec.fieldContext_SavedLocation_weather(ctx, field)
 			}
 			return nil, fmt.Errorf("no field named %q was found under type SavedLocation", field.Name)
 		},
@@ -17196,6 +17460,8 @@ func (ec *executionContext) fieldContext_Mutation_updateSavedLocation(ctx contex
 				return ec.fieldContext_SavedLocation_createdAt(ctx, field)
 			case "updatedAt":
 				return ec.fieldContext_SavedLocation_updatedAt(ctx, field)
+			case "weather":
+				return ec.fieldContext_SavedLocation_weather(ctx, field)
 			}
 			return nil, fmt.Errorf("no field named %q was found under type SavedLocation", field.Name)
 		},
@@ -17334,6 +17600,8 @@ func (ec *executionContext) fieldContext_Mutation_toggleLocationAlerts(ctx conte
 				return ec.fieldContext_SavedLocation_createdAt(ctx, field)
 			case "updatedAt":
 				return ec.fieldContext_SavedLocation_updatedAt(ctx, field)
+			case "weather":
+				return ec.fieldContext_SavedLocation_weather(ctx, field)
 			}
 			return nil, fmt.Errorf("no field named %q was found under type SavedLocation", field.Name)
 		},
@@ -21248,6 +21516,8 @@ func (ec *executionContext) fieldContext_Query_savedLocations(_ context.Context,
 				return ec.fieldContext_SavedLocation_createdAt(ctx, field)
 			case "updatedAt":
 				return ec.fieldContext_SavedLocation_updatedAt(ctx, field)
+			case "weather":
+				return ec.fieldContext_SavedLocation_weather(ctx, field)
 			}
 			return nil, fmt.Errorf("no field named %q was found under type SavedLocation", field.Name)
 		},
@@ -21311,6 +21581,8 @@ func (ec *executionContext) fieldContext_Query_savedLocation(ctx context.Context
 				return ec.fieldContext_SavedLocation_createdAt(ctx, field)
 			case "updatedAt":
 				return ec.fieldContext_SavedLocation_updatedAt(ctx, field)
+			case "weather":
+				return ec.fieldContext_SavedLocation_weather(ctx, field)
 			}
 			return nil, fmt.Errorf("no field named %q was found under type SavedLocation", field.Name)
 		},
@@ -23759,6 +24031,61 @@ func (ec *executionContext) fieldContext_SavedLocation_updatedAt(_ context.Conte
 	return fc, nil
 }
 
+func (ec *executionContext) _SavedLocation_weather(ctx context.Context, field graphql.CollectedField, obj *models.SavedLocation) (ret graphql.Marshaler) {
+	fc, err := ec.fieldContext_SavedLocation_weather(ctx, field)
+	if err != nil {
+		return graphql.Null
+	}
+	ctx = graphql.WithFieldContext(ctx, fc)
+	defer func() {
+		if r := recover(); r != nil {
+			ec.Error(ctx, ec.Recover(ctx, r))
+			ret = graphql.Null
+		}
+	}()
+	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (interface{}, error) {
+		ctx = rctx // use context from middleware stack in children
+		return ec.resolvers.SavedLocation().Weather(rctx, obj)
+	})
+	if err != nil {
+		ec.Error(ctx, err)
+		return graphql.Null
+	}
+	if resTmp == nil {
+		return graphql.Null
+	}
+	res := resTmp.(*Weather)
+	fc.Result = res
+	return ec.marshalOWeather2ᚖgithubᚗcomᚋapimgrᚋweatherᚋgraphᚐWeather(ctx, field.Selections, res)
+}
+
+func (ec *executionContext) fieldContext_SavedLocation_weather(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "SavedLocation",
+		Field:      field,
+		IsMethod:   true,
+		IsResolver: true,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			switch field.Name {
+			case "location":
+				return ec.fieldContext_Weather_location(ctx, field)
+			case "current":
+				return ec.fieldContext_Weather_current(ctx, field)
+			case "forecast":
+				return ec.fieldContext_Weather_forecast(ctx, field)
+			case "alerts":
+				return ec.fieldContext_Weather_alerts(ctx, field)
+			case "astronomy":
+				return ec.fieldContext_Weather_astronomy(ctx, field)
+			case "timestamp":
+				return ec.fieldContext_Weather_timestamp(ctx, field)
+			}
+			return nil, fmt.Errorf("no field named %q was found under type Weather", field.Name)
+		},
+	}
+	return fc, nil
+}
+
 func (ec *executionContext) _ScheduledTask_name(ctx context.Context, field graphql.CollectedField, obj *ScheduledTask) (ret graphql.Marshaler) {
 	fc, err := ec.fieldContext_ScheduledTask_name(ctx, field)
 	if err != nil {
@@ -24930,6 +25257,345 @@ func (ec *executionContext) fieldContext_SevereWeather_instruction(_ context.Con
 	return fc, nil
 }
 
+func (ec *executionContext) _Subscription_severeWeatherAlerts(ctx context.Context, field graphql.CollectedField) (ret func(ctx context.Context) graphql.Marshaler) {
+	fc, err := ec.fieldContext_Subscription_severeWeatherAlerts(ctx, field)
+	if err != nil {
+		return nil
+	}
+	ctx = graphql.WithFieldContext(ctx, fc)
+	defer func() {
+		if r := recover(); r != nil {
+			ec.Error(ctx, ec.Recover(ctx, r))
+			ret = nil
+		}
+	}()
+	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (interface{}, error) {
+		ctx = rctx // use context from middleware stack in children
+		return ec.resolvers.Subscription().SevereWeatherAlerts(rctx, fc.Args["lat"].(float64), fc.Args["lon"].(float64), fc.Args["radius"].(*float64))
+	})
+	if err != nil {
+		ec.Error(ctx, err)
+		return nil
+	}
+	if resTmp == nil {
+		if !graphql.HasFieldError(ctx, fc) {
+			ec.Errorf(ctx, "must not be null")
+		}
+		return nil
+	}
+	return func(ctx context.Context) graphql.Marshaler {
+		select {
+		case res, ok := <-resTmp.(<-chan *WeatherAlert):
+			if !ok {
+				return nil
+			}
+			return graphql.WriterFunc(func(w io.Writer) {
+				w.Write([]byte{'{'})
+				graphql.MarshalString(field.Alias).MarshalGQL(w)
+				w.Write([]byte{':'})
+				ec.marshalNWeatherAlert2ᚖgithubᚗcomᚋapimgrᚋweatherᚋgraphᚐWeatherAlert(ctx, field.Selections, res).MarshalGQL(w)
+				w.Write([]byte{'}'})
+			})
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (ec *executionContext) fieldContext_Subscription_severeWeatherAlerts(ctx context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Subscription",
+		Field:      field,
+		IsMethod:   true,
+		IsResolver: true,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			switch field.Name {
+			case "headline":
+				return ec.fieldContext_WeatherAlert_headline(ctx, field)
+			case "severity":
+				return ec.fieldContext_WeatherAlert_severity(ctx, field)
+			case "urgency":
+				return ec.fieldContext_WeatherAlert_urgency(ctx, field)
+			case "areas":
+				return ec.fieldContext_WeatherAlert_areas(ctx, field)
+			case "category":
+				return ec.fieldContext_WeatherAlert_category(ctx, field)
+			case "event":
+				return ec.fieldContext_WeatherAlert_event(ctx, field)
+			case "effective":
+				return ec.fieldContext_WeatherAlert_effective(ctx, field)
+			case "expires":
+				return ec.fieldContext_WeatherAlert_expires(ctx, field)
+			case "description":
+				return ec.fieldContext_WeatherAlert_description(ctx, field)
+			case "instruction":
+				return ec.fieldContext_WeatherAlert_instruction(ctx, field)
+			}
+			return nil, fmt.Errorf("no field named %q was found under type WeatherAlert", field.Name)
+		},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = ec.Recover(ctx, r)
+			ec.Error(ctx, err)
+		}
+	}()
+	ctx = graphql.WithFieldContext(ctx, fc)
+	if fc.Args, err = ec.field_Subscription_severeWeatherAlerts_args(ctx, field.ArgumentMap(ec.Variables)); err != nil {
+		ec.Error(ctx, err)
+		return fc, err
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _Subscription_notifications(ctx context.Context, field graphql.CollectedField) (ret func(ctx context.Context) graphql.Marshaler) {
+	fc, err := ec.fieldContext_Subscription_notifications(ctx, field)
+	if err != nil {
+		return nil
+	}
+	ctx = graphql.WithFieldContext(ctx, fc)
+	defer func() {
+		if r := recover(); r != nil {
+			ec.Error(ctx, ec.Recover(ctx, r))
+			ret = nil
+		}
+	}()
+	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (interface{}, error) {
+		ctx = rctx // use context from middleware stack in children
+		return ec.resolvers.Subscription().Notifications(rctx)
+	})
+	if err != nil {
+		ec.Error(ctx, err)
+		return nil
+	}
+	if resTmp == nil {
+		if !graphql.HasFieldError(ctx, fc) {
+			ec.Errorf(ctx, "must not be null")
+		}
+		return nil
+	}
+	return func(ctx context.Context) graphql.Marshaler {
+		select {
+		case res, ok := <-resTmp.(<-chan *models.Notification):
+			if !ok {
+				return nil
+			}
+			return graphql.WriterFunc(func(w io.Writer) {
+				w.Write([]byte{'{'})
+				graphql.MarshalString(field.Alias).MarshalGQL(w)
+				w.Write([]byte{':'})
+				ec.marshalNNotification2ᚖgithubᚗcomᚋapimgrᚋweatherᚋsrcᚋmodelsᚐNotification(ctx, field.Selections, res).MarshalGQL(w)
+				w.Write([]byte{'}'})
+			})
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (ec *executionContext) fieldContext_Subscription_notifications(_ context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Subscription",
+		Field:      field,
+		IsMethod:   true,
+		IsResolver: true,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			switch field.Name {
+			case "id":
+				return ec.fieldContext_Notification_id(ctx, field)
+			case "userId":
+				return ec.fieldContext_Notification_userId(ctx, field)
+			case "type":
+				return ec.fieldContext_Notification_type(ctx, field)
+			case "title":
+				return ec.fieldContext_Notification_title(ctx, field)
+			case "message":
+				return ec.fieldContext_Notification_message(ctx, field)
+			case "read":
+				return ec.fieldContext_Notification_read(ctx, field)
+			case "createdAt":
+				return ec.fieldContext_Notification_createdAt(ctx, field)
+			case "readAt":
+				return ec.fieldContext_Notification_readAt(ctx, field)
+			}
+			return nil, fmt.Errorf("no field named %q was found under type Notification", field.Name)
+		},
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _Subscription_earthquakes(ctx context.Context, field graphql.CollectedField) (ret func(ctx context.Context) graphql.Marshaler) {
+	fc, err := ec.fieldContext_Subscription_earthquakes(ctx, field)
+	if err != nil {
+		return nil
+	}
+	ctx = graphql.WithFieldContext(ctx, fc)
+	defer func() {
+		if r := recover(); r != nil {
+			ec.Error(ctx, ec.Recover(ctx, r))
+			ret = nil
+		}
+	}()
+	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (interface{}, error) {
+		ctx = rctx // use context from middleware stack in children
+		return ec.resolvers.Subscription().Earthquakes(rctx, fc.Args["minMagnitude"].(*float64), fc.Args["region"].(*string))
+	})
+	if err != nil {
+		ec.Error(ctx, err)
+		return nil
+	}
+	if resTmp == nil {
+		if !graphql.HasFieldError(ctx, fc) {
+			ec.Errorf(ctx, "must not be null")
+		}
+		return nil
+	}
+	return func(ctx context.Context) graphql.Marshaler {
+		select {
+		case res, ok := <-resTmp.(<-chan *Earthquake):
+			if !ok {
+				return nil
+			}
+			return graphql.WriterFunc(func(w io.Writer) {
+				w.Write([]byte{'{'})
+				graphql.MarshalString(field.Alias).MarshalGQL(w)
+				w.Write([]byte{':'})
+				ec.marshalNEarthquake2ᚖgithubᚗcomᚋapimgrᚋweatherᚋgraphᚐEarthquake(ctx, field.Selections, res).MarshalGQL(w)
+				w.Write([]byte{'}'})
+			})
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (ec *executionContext) fieldContext_Subscription_earthquakes(ctx context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Subscription",
+		Field:      field,
+		IsMethod:   true,
+		IsResolver: true,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			switch field.Name {
+			case "id":
+				return ec.fieldContext_Earthquake_id(ctx, field)
+			case "magnitude":
+				return ec.fieldContext_Earthquake_magnitude(ctx, field)
+			case "location":
+				return ec.fieldContext_Earthquake_location(ctx, field)
+			case "depth":
+				return ec.fieldContext_Earthquake_depth(ctx, field)
+			case "time":
+				return ec.fieldContext_Earthquake_time(ctx, field)
+			case "lat":
+				return ec.fieldContext_Earthquake_lat(ctx, field)
+			case "lon":
+				return ec.fieldContext_Earthquake_lon(ctx, field)
+			case "tsunami":
+				return ec.fieldContext_Earthquake_tsunami(ctx, field)
+			case "url":
+				return ec.fieldContext_Earthquake_url(ctx, field)
+			}
+			return nil, fmt.Errorf("no field named %q was found under type Earthquake", field.Name)
+		},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = ec.Recover(ctx, r)
+			ec.Error(ctx, err)
+		}
+	}()
+	ctx = graphql.WithFieldContext(ctx, fc)
+	if fc.Args, err = ec.field_Subscription_earthquakes_args(ctx, field.ArgumentMap(ec.Variables)); err != nil {
+		ec.Error(ctx, err)
+		return fc, err
+	}
+	return fc, nil
+}
+
+func (ec *executionContext) _Subscription_weatherUpdates(ctx context.Context, field graphql.CollectedField) (ret func(ctx context.Context) graphql.Marshaler) {
+	fc, err := ec.fieldContext_Subscription_weatherUpdates(ctx, field)
+	if err != nil {
+		return nil
+	}
+	ctx = graphql.WithFieldContext(ctx, fc)
+	defer func() {
+		if r := recover(); r != nil {
+			ec.Error(ctx, ec.Recover(ctx, r))
+			ret = nil
+		}
+	}()
+	resTmp, err := ec.ResolverMiddleware(ctx, func(rctx context.Context) (interface{}, error) {
+		ctx = rctx // use context from middleware stack in children
+		return ec.resolvers.Subscription().WeatherUpdates(rctx, fc.Args["locationId"].(string))
+	})
+	if err != nil {
+		ec.Error(ctx, err)
+		return nil
+	}
+	if resTmp == nil {
+		if !graphql.HasFieldError(ctx, fc) {
+			ec.Errorf(ctx, "must not be null")
+		}
+		return nil
+	}
+	return func(ctx context.Context) graphql.Marshaler {
+		select {
+		case res, ok := <-resTmp.(<-chan *Weather):
+			if !ok {
+				return nil
+			}
+			return graphql.WriterFunc(func(w io.Writer) {
+				w.Write([]byte{'{'})
+				graphql.MarshalString(field.Alias).MarshalGQL(w)
+				w.Write([]byte{':'})
+				ec.marshalNWeather2ᚖgithubᚗcomᚋapimgrᚋweatherᚋgraphᚐWeather(ctx, field.Selections, res).MarshalGQL(w)
+				w.Write([]byte{'}'})
+			})
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (ec *executionContext) fieldContext_Subscription_weatherUpdates(ctx context.Context, field graphql.CollectedField) (fc *graphql.FieldContext, err error) {
+	fc = &graphql.FieldContext{
+		Object:     "Subscription",
+		Field:      field,
+		IsMethod:   true,
+		IsResolver: true,
+		Child: func(ctx context.Context, field graphql.CollectedField) (*graphql.FieldContext, error) {
+			switch field.Name {
+			case "location":
+				return ec.fieldContext_Weather_location(ctx, field)
+			case "current":
+				return ec.fieldContext_Weather_current(ctx, field)
+			case "forecast":
+				return ec.fieldContext_Weather_forecast(ctx, field)
+			case "alerts":
+				return ec.fieldContext_Weather_alerts(ctx, field)
+			case "astronomy":
+				return ec.fieldContext_Weather_astronomy(ctx, field)
+			case "timestamp":
+				return ec.fieldContext_Weather_timestamp(ctx, field)
+			}
+			return nil, fmt.Errorf("no field named %q was found under type Weather", field.Name)
+		},
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = ec.Recover(ctx, r)
+			ec.Error(ctx, err)
+		}
+	}()
+	ctx = graphql.WithFieldContext(ctx, fc)
+	if fc.Args, err = ec.field_Subscription_weatherUpdates_args(ctx, field.ArgumentMap(ec.Variables)); err != nil {
+		ec.Error(ctx, err)
+		return fc, err
+	}
+	return fc, nil
+}
+
 func (ec *executionContext) _SystemStats_uptime(ctx context.Context, field graphql.CollectedField, obj *SystemStats) (ret graphql.Marshaler) {
 	fc, err := ec.fieldContext_SystemStats_uptime(ctx, field)
 	if err != nil {
@@ -33857,6 +34523,39 @@ func (ec *executionContext) _SavedLocation(ctx context.Context, sel ast.Selectio
 			if out.Values[i] == graphql.Null {
 				atomic.AddUint32(&out.Invalids, 1)
 			}
+		case "weather":
+			field := field
+
+			innerFunc := func(ctx context.Context, _ *graphql.FieldSet) (res graphql.Marshaler) {
+				defer func() {
+					if r := recover(); r != nil {
+						ec.Error(ctx, ec.Recover(ctx, r))
+					}
+				}()
+				res = ec._SavedLocation_weather(ctx, field, obj)
+				return res
+			}
+
+			if field.Deferrable != nil {
+				dfs, ok := deferred[field.Deferrable.Label]
+				di := 0
+				if ok {
+					dfs.AddField(field)
+					di = len(dfs.Values) - 1
+				} else {
+					dfs = graphql.NewFieldSet([]graphql.CollectedField{field})
+					deferred[field.Deferrable.Label] = dfs
+				}
+				dfs.Concurrently(di, func(ctx context.Context) graphql.Marshaler {
+					return innerFunc(ctx, dfs)
+				})
+
+				// don't run the out.Concurrently() call below
+				out.Values[i] = graphql.Null
+				continue
+			}
+
+			out.Concurrently(i, func(ctx context.Context) graphql.Marshaler { return innerFunc(ctx, out) })
 		default:
 			panic("unknown field " + strconv.Quote(field.Name))
 		}
@@ -34214,6 +34913,32 @@ func (ec *executionContext) _SevereWeather(ctx context.Context, sel ast.Selectio
 	return out
 }
 
+var subscriptionImplementors = []string{"Subscription"}
+
+func (ec *executionContext) _Subscription(ctx context.Context, sel ast.SelectionSet) func(ctx context.Context) graphql.Marshaler {
+	fields := graphql.CollectFields(ec.OperationContext, sel, subscriptionImplementors)
+	ctx = graphql.WithFieldContext(ctx, &graphql.FieldContext{
+		Object: "Subscription",
+	})
+	if len(fields) != 1 {
+		ec.Errorf(ctx, "must subscribe to exactly one stream")
+		return nil
+	}
+
+	switch fields[0].Name {
+	case "severeWeatherAlerts":
+		return ec._Subscription_severeWeatherAlerts(ctx, fields[0])
+	case "notifications":
+		return ec._Subscription_notifications(ctx, fields[0])
+	case "earthquakes":
+		return ec._Subscription_earthquakes(ctx, fields[0])
+	case "weatherUpdates":
+		return ec._Subscription_weatherUpdates(ctx, fields[0])
+	default:
+		panic("unknown field " + strconv.Quote(fields[0].Name))
+	}
+}
+
 var systemStatsImplementors = []string{"SystemStats"}
 
 func (ec *executionContext) _SystemStats(ctx context.Context, sel ast.SelectionSet, obj *SystemStats) graphql.Marshaler {
@@ -38245,6 +38970,13 @@ func (ec *executionContext) marshalOTime2ᚖtimeᚐTime(ctx context.Context, sel
 	return res
 }
 
+func (ec *executionContext) marshalOWeather2ᚖgithubᚗcomᚋapimgrᚋweatherᚋgraphᚐWeather(ctx context.Context, sel ast.SelectionSet, v *Weather) graphql.Marshaler {
+	if v == nil {
+		return graphql.Null
+	}
+	return ec._Weather(ctx, sel, v)
+}
+
 func (ec *executionContext) marshalOWeatherAlert2ᚕᚖgithubᚗcomᚋapimgrᚋweatherᚋgraphᚐWeatherAlertᚄ(ctx context.Context, sel ast.SelectionSet, v []*WeatherAlert) graphql.Marshaler {
 	if v == nil {
 		return graphql.Null
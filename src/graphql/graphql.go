@@ -11,9 +11,11 @@ import (
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/handler"
 	"github.com/apimgr/weather/src/server/middleware"
 	models "github.com/apimgr/weather/src/server/model"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"strings"
 	"time"
 
@@ -22,8 +24,19 @@ import (
 
 // NewServer creates a gqlgen GraphQL server for the provided resolver tree.
 func NewServer(resolver *Resolver) *gqlhandler.Server {
-	srv := gqlhandler.New(NewExecutableSchema(Config{Resolvers: resolver}))
-	srv.AddTransport(transport.Websocket{KeepAlivePingInterval: 10 * time.Second})
+	config := Config{Resolvers: resolver}
+	configureComplexity(&config.Complexity)
+	srv := gqlhandler.New(NewExecutableSchema(config))
+	// Subscriptions over graphql-ws and graphql-transport-ws
+	srv.AddTransport(transport.Websocket{
+		KeepAlivePingInterval: 10 * time.Second,
+		Upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     handler.CheckWebSocketOrigin,
+		},
+		InitFunc: graphQLWebsocketInit,
+	})
 	srv.AddTransport(transport.Options{})
 	srv.AddTransport(transport.GET{})
 	srv.AddTransport(transport.POST{})
@@ -33,7 +46,12 @@ func NewServer(resolver *Resolver) *gqlhandler.Server {
 	})
 	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
 	srv.Use(extension.Introspection{})
-	srv.Use(extension.AutomaticPersistedQuery{Cache: lru.New[string](100)})
+	srv.Use(NewPersistedQueries())
+	srv.Use(&QueryLimits{})
+	srv.AroundFields(tokenFieldPermissions())
+	srv.AroundFields(adminFieldPermissions(resolver.ServerDB))
+	// Fresh DataLoaders per operation batch SavedLocation.weather lookups
+	srv.AroundOperations(loadersOperationMiddleware(resolver.WeatherService))
 	return srv
 }
 
@@ -45,8 +63,8 @@ func RegisterRoutes(router *gin.Engine, resolver *Resolver) {
 	// GraphQL endpoint for POST requests (actual queries)
 	router.POST("/graphql", GraphQLHandler(srv))
 
-	// GraphiQL playground for GET requests (interactive UI)
-	router.GET("/graphql", PlaygroundHandler("/graphql"))
+	// GraphiQL playground for GET requests (interactive UI), WebSocket upgrades for subscriptions
+	router.GET("/graphql", GraphQLGetHandler(srv, "/graphql"))
 }
 
 // GraphQLHandler wraps the gqlgen handler for Gin.
@@ -65,6 +83,20 @@ func GraphQLHandler(h *gqlhandler.Server) gin.HandlerFunc {
 	}
 }
 
+// GraphQLGetHandler serves subscriptions for WebSocket upgrade requests and
+// the GraphiQL playground otherwise.
+func GraphQLGetHandler(h *gqlhandler.Server, endpoint string) gin.HandlerFunc {
+	graphQLHandler := GraphQLHandler(h)
+	playgroundHandler := PlaygroundHandler(endpoint)
+	return func(c *gin.Context) {
+		if websocket.IsWebSocketUpgrade(c.Request) {
+			graphQLHandler(c)
+			return
+		}
+		playgroundHandler(c)
+	}
+}
+
 // PlaygroundHandler serves the GraphiQL playground with theme support.
 func PlaygroundHandler(endpoint string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -142,6 +174,27 @@ func buildGraphQLAuthContext(c *gin.Context) (context.Context, error) {
 	return ctx, nil
 }
 
+// graphQLWebsocketInit authenticates subscriptions from the connection_init
+// payload. Cookie sessions from the upgrade request are already in ctx.
+func graphQLWebsocketInit(ctx context.Context, initPayload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+	authorization := strings.TrimSpace(initPayload.Authorization())
+	if authorization == "" {
+		authorization = strings.TrimSpace(initPayload.GetString("token"))
+	}
+	if authorization == "" {
+		return ctx, nil, nil
+	}
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		authorization = "Bearer " + authorization
+	}
+
+	authCtx, err := buildGraphQLTokenContext(ctx, authorization)
+	if err != nil {
+		return nil, nil, err
+	}
+	return authCtx, nil, nil
+}
+
 func buildGraphQLTokenContext(ctx context.Context, authHeader string) (context.Context, error) {
 	parts := strings.SplitN(authHeader, " ", 2)
 	if len(parts) != 2 || parts[0] != "Bearer" {
@@ -167,13 +220,18 @@ func buildGraphQLTokenContext(ctx context.Context, authHeader string) (context.C
 		if err != nil {
 			return nil, fmt.Errorf("invalid user token")
 		}
+		// IP and location bindings cannot be checked here
+		if len(validatedToken.AllowedIPs) > 0 || validatedToken.LocationID != nil {
+			return nil, fmt.Errorf("restricted tokens cannot be used with GraphQL")
+		}
 
 		userModel := &models.UserModel{DB: database.GetUsersDB()}
 		user, err := userModel.GetByID(validatedToken.OwnerID)
 		if err != nil {
 			return nil, fmt.Errorf("user not found")
 		}
-		return withGraphQLUserContext(ctx, user), nil
+		ctx = withGraphQLUserContext(ctx, user)
+		return context.WithValue(ctx, "token_scope", validatedToken.Scope), nil
 	default:
 		return nil, fmt.Errorf("unsupported authorization token")
 	}
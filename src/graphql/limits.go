@@ -0,0 +1,254 @@
+package graphql
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/apimgr/weather/src/database"
+	models "github.com/apimgr/weather/src/server/model"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Principal classes used to pick query limits (settings graphql.max_*.<class>)
+const (
+	principalAnonymous      = "anonymous"
+	principalUser           = "user"
+	principalAdmin          = "admin"
+	principalTokenRead      = "token_read"
+	principalTokenReadWrite = "token_read_write"
+	principalTokenGlobal    = "token_global"
+)
+
+const (
+	errDepthLimit        = "QUERY_DEPTH_LIMIT_EXCEEDED"
+	errComplexityLimit   = "COMPLEXITY_LIMIT_EXCEEDED"
+	queryLimitsExtension = "QueryLimits"
+	// How long limits read from settings are reused before re-reading
+	queryLimitsRefresh = 30 * time.Second
+)
+
+// Default limits when the settings table is unavailable
+var defaultQueryLimits = map[string]queryLimit{
+	principalAnonymous:      {Depth: 8, Complexity: 200},
+	principalUser:           {Depth: 12, Complexity: 500},
+	principalAdmin:          {Depth: 20, Complexity: 2000},
+	principalTokenRead:      {Depth: 10, Complexity: 300},
+	principalTokenReadWrite: {Depth: 12, Complexity: 500},
+	principalTokenGlobal:    {Depth: 15, Complexity: 1000},
+}
+
+type queryLimit struct {
+	Depth      int
+	Complexity int
+}
+
+// QueryLimitStats is exposed in the operation stats for logging and tests
+type QueryLimitStats struct {
+	Principal       string
+	Depth           int
+	DepthLimit      int
+	Complexity      int
+	ComplexityLimit int
+}
+
+// QueryLimits rejects operations whose depth or complexity exceeds the limit
+// configured for the caller's role or API token scope
+type QueryLimits struct {
+	// Limits overrides settings lookups (used by tests)
+	Limits func(principal string) (depth, complexity int)
+
+	es graphql.ExecutableSchema
+
+	mu       sync.Mutex
+	cached   map[string]queryLimit
+	cachedAt time.Time
+}
+
+var _ interface {
+	graphql.OperationContextMutator
+	graphql.HandlerExtension
+} = &QueryLimits{}
+
+// ExtensionName implements graphql.HandlerExtension
+func (q *QueryLimits) ExtensionName() string {
+	return queryLimitsExtension
+}
+
+// Validate implements graphql.HandlerExtension
+func (q *QueryLimits) Validate(schema graphql.ExecutableSchema) error {
+	q.es = schema
+	return nil
+}
+
+// MutateOperationContext implements graphql.OperationContextMutator
+func (q *QueryLimits) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	op := opCtx.Doc.Operations.ForName(opCtx.OperationName)
+	if op == nil {
+		return nil
+	}
+
+	principal := graphQLPrincipal(ctx)
+	depthLimit, complexityLimit := q.limitsFor(principal)
+
+	depth := selectionSetDepth(op.SelectionSet, opCtx.Doc.Fragments, 0)
+	cost := complexity.Calculate(q.es, op, opCtx.Variables)
+
+	opCtx.Stats.SetExtension(queryLimitsExtension, &QueryLimitStats{
+		Principal:       principal,
+		Depth:           depth,
+		DepthLimit:      depthLimit,
+		Complexity:      cost,
+		ComplexityLimit: complexityLimit,
+	})
+
+	if depthLimit > 0 && depth > depthLimit {
+		err := gqlerror.Errorf("operation has depth %d, which exceeds the limit of %d", depth, depthLimit)
+		errcode.Set(err, errDepthLimit)
+		return err
+	}
+	if complexityLimit > 0 && cost > complexityLimit {
+		err := gqlerror.Errorf("operation has complexity %d, which exceeds the limit of %d", cost, complexityLimit)
+		errcode.Set(err, errComplexityLimit)
+		return err
+	}
+
+	return nil
+}
+
+func (q *QueryLimits) limitsFor(principal string) (int, int) {
+	if q.Limits != nil {
+		return q.Limits(principal)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.cached == nil || time.Since(q.cachedAt) > queryLimitsRefresh {
+		q.cached = loadQueryLimits()
+		q.cachedAt = time.Now()
+	}
+	limit := q.cached[principal]
+	return limit.Depth, limit.Complexity
+}
+
+func loadQueryLimits() map[string]queryLimit {
+	limits := make(map[string]queryLimit, len(defaultQueryLimits))
+	serverDB := database.GetServerDB()
+	for principal, fallback := range defaultQueryLimits {
+		if serverDB == nil {
+			limits[principal] = fallback
+			continue
+		}
+		settings := &models.SettingsModel{DB: serverDB}
+		limits[principal] = queryLimit{
+			Depth:      settings.GetInt("graphql.max_depth."+principal, fallback.Depth),
+			Complexity: settings.GetInt("graphql.max_complexity."+principal, fallback.Complexity),
+		}
+	}
+	return limits
+}
+
+// graphQLPrincipal classifies the caller. API tokens are limited by scope,
+// sessions by role.
+func graphQLPrincipal(ctx context.Context) string {
+	if isAdmin(ctx) {
+		return principalAdmin
+	}
+	if scope, ok := ctx.Value("token_scope").(string); ok && scope != "" {
+		switch scope {
+		case models.ScopeGlobal:
+			return principalTokenGlobal
+		case models.ScopeReadWrite:
+			return principalTokenReadWrite
+		default:
+			return principalTokenRead
+		}
+	}
+	if getUserIDFromContext(ctx) > 0 {
+		return principalUser
+	}
+	return principalAnonymous
+}
+
+// selectionSetDepth returns the deepest field nesting below depth.
+// Introspection fields are not counted so GraphiQL keeps working for
+// anonymous callers.
+func selectionSetDepth(selectionSet ast.SelectionSet, fragments ast.FragmentDefinitionList, depth int) int {
+	maxDepth := depth
+	for _, selection := range selectionSet {
+		var childDepth int
+		switch sel := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(sel.Name, "__") {
+				continue
+			}
+			childDepth = selectionSetDepth(sel.SelectionSet, fragments, depth+1)
+		case *ast.InlineFragment:
+			childDepth = selectionSetDepth(sel.SelectionSet, fragments, depth)
+		case *ast.FragmentSpread:
+			fragment := fragments.ForName(sel.Name)
+			if fragment == nil {
+				continue
+			}
+			childDepth = selectionSetDepth(fragment.SelectionSet, fragments, depth)
+		}
+		if childDepth > maxDepth {
+			maxDepth = childDepth
+		}
+	}
+	return maxDepth
+}
+
+// listComplexity estimates the cost of a list field from its limit argument
+func listComplexity(childComplexity int, limit *int, defaultSize int) int {
+	size := defaultSize
+	if limit != nil && *limit > 0 {
+		size = *limit
+	}
+	return 1 + childComplexity*size
+}
+
+// configureComplexity weights list fields and fields that call upstream APIs
+// so expensive queries cost more than their field count
+func configureComplexity(c *ComplexityRoot) {
+	c.Query.SavedLocations = func(childComplexity int) int {
+		return listComplexity(childComplexity, nil, 10)
+	}
+	c.Query.Notifications = func(childComplexity int) int {
+		return listComplexity(childComplexity, nil, 20)
+	}
+	c.Query.UnreadNotifications = func(childComplexity int) int {
+		return listComplexity(childComplexity, nil, 20)
+	}
+	c.Query.AdminUsers = func(childComplexity int) int {
+		return listComplexity(childComplexity, nil, 50)
+	}
+	c.Query.SearchLocations = func(childComplexity int, query string) int {
+		return listComplexity(childComplexity, nil, 10)
+	}
+	c.Query.Earthquakes = func(childComplexity int, minMagnitude *float64, limit *int) int {
+		return listComplexity(childComplexity, limit, 20)
+	}
+	c.Query.AdminAuditLogs = func(childComplexity int, limit *int, offset *int) int {
+		return listComplexity(childComplexity, limit, 50)
+	}
+	c.Query.AdminTaskHistory = func(childComplexity int, name string, limit *int) int {
+		return listComplexity(childComplexity, limit, 50)
+	}
+	c.Query.Forecast = func(childComplexity int, location *string, lat *float64, lon *float64, days *int) int {
+		numDays := 7
+		if days != nil && *days > 0 && *days <= 16 {
+			numDays = *days
+		}
+		return 5 + childComplexity + numDays
+	}
+	// Batched through the DataLoader but still an upstream call per location
+	c.SavedLocation.Weather = func(childComplexity int) int {
+		return 5 + childComplexity
+	}
+}
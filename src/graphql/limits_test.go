@@ -0,0 +1,58 @@
+package graphql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+func TestSelectionSetDepth(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"flat", `{ health { status } }`, 2},
+		{"nested", `{ savedLocations { weather { current { condition { text } } } } }`, 5},
+		{"fragment", `query { savedLocations { ...loc } } fragment loc on SavedLocation { weather { location { name } } }`, 4},
+		{"introspection ignored", `{ __schema { types { fields { type { ofType { name } } } } } health { status } }`, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parser.ParseQuery(&ast.Source{Input: tt.query})
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			got := selectionSetDepth(doc.Operations[0].SelectionSet, doc.Fragments, 0)
+			if got != tt.want {
+				t.Errorf("depth = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLPrincipal(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"anonymous", context.Background(), principalAnonymous},
+		{"user session", context.WithValue(context.Background(), "user_id", 5), principalUser},
+		{"admin", context.WithValue(context.Background(), "user_role", "admin"), principalAdmin},
+		{"read token", context.WithValue(context.WithValue(context.Background(), "user_id", 5), "token_scope", "read"), principalTokenRead},
+		{"read-write token", context.WithValue(context.WithValue(context.Background(), "user_id", 5), "token_scope", "read-write"), principalTokenReadWrite},
+		{"global token", context.WithValue(context.WithValue(context.Background(), "user_id", 5), "token_scope", "global"), principalTokenGlobal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := graphQLPrincipal(tt.ctx); got != tt.want {
+				t.Errorf("graphQLPrincipal() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
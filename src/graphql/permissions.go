@@ -0,0 +1,138 @@
+package graphql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	models "github.com/apimgr/weather/src/server/model"
+)
+
+// adminFieldPermissions enforces role permissions on the admin* Query and
+// Mutation fields, the GraphQL counterpart of middleware.AdminRBAC. Admins
+// are checked against their assigned roles, users against the role named
+// by their account.
+func adminFieldPermissions(serverDB *sql.DB) graphql.FieldMiddleware {
+	return func(ctx context.Context, next graphql.Resolver) (any, error) {
+		fc := graphql.GetFieldContext(ctx)
+		if fc == nil || (fc.Object != "Query" && fc.Object != "Mutation") || !strings.HasPrefix(fc.Field.Name, "admin") {
+			return next(ctx)
+		}
+
+		permissions, err := graphQLPermissions(ctx, serverDB)
+		if err != nil {
+			return nil, err
+		}
+		if required := models.AdminGraphQLPermission(fc.Field.Name); !permissions.Has(required) {
+			return nil, fmt.Errorf("forbidden: missing permission %s", required)
+		}
+		return next(ctx)
+	}
+}
+
+func graphQLPermissions(ctx context.Context, serverDB *sql.DB) (models.PermissionSet, error) {
+	roles := &models.RoleModel{DB: serverDB}
+
+	if adminID, ok := ctx.Value("admin_id").(int); ok && adminID > 0 {
+		admin, err := (&models.AdminModel{DB: serverDB}).GetByID(int64(adminID))
+		if err != nil {
+			return nil, fmt.Errorf("unauthorized: admin access required")
+		}
+		permissions, err := roles.AdminPermissions(admin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load permissions: %w", err)
+		}
+		return permissions, nil
+	}
+
+	if role, ok := ctx.Value("user_role").(string); ok && getUserIDFromContext(ctx) > 0 {
+		permissions, err := roles.UserPermissions(&models.User{Role: role})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load permissions: %w", err)
+		}
+		return permissions, nil
+	}
+
+	return nil, fmt.Errorf("unauthorized: admin access required")
+}
+
+// Scopes required of API tokens per root field, mirroring the REST routes.
+// Fields not listed need a global token; publicFields need none.
+var tokenFieldScopes = map[string]map[string]string{
+	"Query": {
+		"weather":             models.ScopeWeatherRead,
+		"forecast":            models.ScopeWeatherRead,
+		"searchLocations":     models.ScopeWeatherRead,
+		"ipGeolocation":       models.ScopeWeatherRead,
+		"currentLocation":     models.ScopeWeatherRead,
+		"historicalWeather":   models.ScopeWeatherRead,
+		"lookupZipCode":       models.ScopeWeatherRead,
+		"lookupCoordinates":   models.ScopeWeatherRead,
+		"moonPhase":           models.ScopeWeatherRead,
+		"earthquakes":         models.ScopeAlertsRead,
+		"hurricanes":          models.ScopeAlertsRead,
+		"severeWeather":       models.ScopeAlertsRead,
+		"savedLocations":      models.ScopeLocationsRead,
+		"savedLocation":       models.ScopeLocationsRead,
+		"notifications":       models.ScopeNotificationsRead,
+		"unreadNotifications": models.ScopeNotificationsRead,
+	},
+	"Mutation": {
+		"createSavedLocation": models.ScopeLocationsWrite,
+		"updateSavedLocation": models.ScopeLocationsWrite,
+		"deleteSavedLocation": models.ScopeLocationsWrite,
+		// No token holds notifications:write itself; read-write, global and
+		// notifications:* grant it
+		"markNotificationRead":     "notifications:write",
+		"markAllNotificationsRead": "notifications:write",
+		"deleteNotification":       "notifications:write",
+	},
+	"Subscription": {
+		"weatherUpdates":      models.ScopeWeatherRead,
+		"severeWeatherAlerts": models.ScopeAlertsRead,
+		"earthquakes":         models.ScopeAlertsRead,
+		"notifications":       models.ScopeNotificationsRead,
+	},
+}
+
+// publicFields answer anonymous requests, so tokens need no scope for them
+var publicFields = map[string]bool{
+	"health":               true,
+	"publicUserProfile":    true,
+	"validateUserInvite":   true,
+	"validateServerInvite": true,
+}
+
+// tokenScopeForField returns the scope a token needs for a root field, or
+// "" when the field is public
+func tokenScopeForField(object, field string) string {
+	if object == "Query" && publicFields[field] {
+		return ""
+	}
+	if scope, ok := tokenFieldScopes[object][field]; ok {
+		return scope
+	}
+	return models.ScopeGlobal
+}
+
+// tokenFieldPermissions enforces API token scopes on root fields, the
+// GraphQL counterpart of middleware.RequireTokenScope. Session requests
+// carry no token scope and are not affected.
+func tokenFieldPermissions() graphql.FieldMiddleware {
+	return func(ctx context.Context, next graphql.Resolver) (any, error) {
+		fc := graphql.GetFieldContext(ctx)
+		if fc == nil || (fc.Object != "Query" && fc.Object != "Mutation" && fc.Object != "Subscription") {
+			return next(ctx)
+		}
+		stored, ok := ctx.Value("token_scope").(string)
+		if !ok {
+			return next(ctx)
+		}
+		if required := tokenScopeForField(fc.Object, fc.Field.Name); required != "" && !models.ScopesAllow(stored, required) {
+			return nil, fmt.Errorf("forbidden: token does not have the required scope %s", required)
+		}
+		return next(ctx)
+	}
+}
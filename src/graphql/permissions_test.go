@@ -0,0 +1,133 @@
+package graphql
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	models "github.com/apimgr/weather/src/server/model"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func fieldContext(ctx context.Context, object, field string) context.Context {
+	return graphql.WithFieldContext(ctx, &graphql.FieldContext{
+		Object: object,
+		Field:  graphql.CollectedField{Field: &ast.Field{Name: field}},
+	})
+}
+
+func TestAdminFieldPermissions(t *testing.T) {
+	middleware := adminFieldPermissions(nil)
+	resolved := func(ctx context.Context) (any, error) { return "ok", nil }
+
+	viewer := context.WithValue(context.WithValue(context.Background(), "user_id", 4), "user_role", models.RoleViewer)
+	member := context.WithValue(context.WithValue(context.Background(), "user_id", 5), "user_role", models.RoleUser)
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		object  string
+		field   string
+		wantErr bool
+	}{
+		{"viewer reads users", viewer, "Query", "adminUsers", false},
+		{"viewer cannot delete users", viewer, "Mutation", "adminDeleteUser", true},
+		{"user role has no admin access", member, "Query", "adminStats", true},
+		{"anonymous is rejected", context.Background(), "Query", "adminSettings", true},
+		{"non-admin fields pass", member, "Query", "savedLocations", false},
+		{"nested admin-named fields pass", member, "InvitedServerAdmin", "admin", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := middleware(fieldContext(tt.ctx, tt.object, tt.field), resolved)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Every admin field in the schema should map to a permission explicitly
+// rather than fall back to system.manage
+func TestAdminGraphQLFieldsMapped(t *testing.T) {
+	schema, err := os.ReadFile("schema.graphqls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapped := models.AdminGraphQLFields()
+	for _, match := range regexp.MustCompile(`(?m)^\s+(admin[A-Z]\w*)\s*[(:]`).FindAllSubmatch(schema, -1) {
+		if field := string(match[1]); !slices.Contains(mapped, field) {
+			t.Errorf("admin field %s has no permission", field)
+		}
+	}
+}
+
+func TestTokenFieldPermissions(t *testing.T) {
+	middleware := tokenFieldPermissions()
+	resolved := func(ctx context.Context) (any, error) { return "ok", nil }
+
+	withToken := func(scope string) context.Context {
+		ctx := context.WithValue(context.Background(), "user_id", 7)
+		ctx = context.WithValue(ctx, "user_role", models.RoleUser)
+		return context.WithValue(ctx, "token_scope", scope)
+	}
+	session := context.WithValue(context.Background(), "user_id", 7)
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		object  string
+		field   string
+		wantErr bool
+	}{
+		{"read token reads weather", withToken(models.ScopeWeatherRead), "Query", "weather", false},
+		{"read token cannot mint tokens", withToken(models.ScopeWeatherRead), "Mutation", "createUserToken", true},
+		{"read-write token cannot mint tokens", withToken(models.ScopeReadWrite), "Mutation", "createUserToken", true},
+		{"read-write token cannot change the password", withToken(models.ScopeReadWrite), "Mutation", "changeUserPassword", true},
+		{"global token mints tokens", withToken(models.ScopeGlobal), "Mutation", "createUserToken", false},
+		{"legacy token without scopes mints tokens", withToken(""), "Mutation", "createUserToken", false},
+		{"read token cannot write locations", withToken(models.ScopeRead), "Mutation", "createSavedLocation", true},
+		{"locations:write token writes locations", withToken(models.ScopeLocationsWrite), "Mutation", "deleteSavedLocation", false},
+		{"notifications:read token cannot delete notifications", withToken(models.ScopeNotificationsRead), "Mutation", "deleteNotification", true},
+		{"read-write token marks notifications read", withToken(models.ScopeReadWrite), "Mutation", "markAllNotificationsRead", false},
+		{"weather token cannot read locations", withToken(models.ScopeWeatherRead), "Query", "savedLocations", true},
+		{"read token cannot read the account", withToken(models.ScopeRead), "Query", "userTokens", true},
+		{"read token cannot call admin fields", withToken(models.ScopeRead), "Query", "adminUsers", true},
+		{"public fields need no scope", withToken(models.ScopeAlertsRead), "Query", "health", false},
+		{"alerts subscription", withToken(models.ScopeAlertsRead), "Subscription", "severeWeatherAlerts", false},
+		{"sessions are not scoped", session, "Mutation", "createUserToken", false},
+		{"nested fields pass", withToken(models.ScopeWeatherRead), "User", "email", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := middleware(fieldContext(tt.ctx, tt.object, tt.field), resolved)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Every field a scope is configured for must exist in the schema
+func TestTokenFieldScopesMatchSchema(t *testing.T) {
+	schema, err := os.ReadFile("schema.graphqls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for object, fields := range tokenFieldScopes {
+		block := regexp.MustCompile(`(?s)type ` + object + ` \{(.*?)\n\}`).FindSubmatch(schema)
+		if block == nil {
+			t.Fatalf("type %s not found", object)
+		}
+		for field := range fields {
+			if !regexp.MustCompile(`(?m)^\s+` + field + `\s*[(:]`).Match(block[1]) {
+				t.Errorf("%s.%s is not in the schema", object, field)
+			}
+		}
+	}
+}
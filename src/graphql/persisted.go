@@ -0,0 +1,286 @@
+package graphql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/apimgr/weather/src/database"
+	models "github.com/apimgr/weather/src/server/model"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const (
+	errPersistedQueryNotFound     = "PersistedQueryNotFound"
+	errPersistedQueryNotFoundCode = "PERSISTED_QUERY_NOT_FOUND"
+	errPersistedQueryNotAllowed   = "PERSISTED_QUERY_NOT_ALLOWED"
+	// How long the allowlist settings are reused before re-reading
+	persistedQueriesRefresh = 30 * time.Second
+	// How long hit counts are collected before they are written in one batch
+	persistedQueriesFlush = 30 * time.Second
+)
+
+// PersistedQueries implements Automatic Persisted Queries backed by the
+// server database, so hashes survive restarts and are shared across cluster
+// nodes. With graphql.persisted_queries.allowlist enabled only queries
+// registered by an administrator may run; clients can no longer register new
+// ones by sending the full query.
+//
+// Client-registered entries are capped by
+// graphql.persisted_queries.apq_max_entries; once full, new hashes are only
+// kept in this node's memory until the prune task frees room.
+type PersistedQueries struct {
+	// Store returns the persisted query model; nil falls back to memory
+	Store func() *models.PersistedQueryModel
+	// Allowlist overrides the settings lookup (used by tests)
+	Allowlist func(ctx context.Context) bool
+	// MaxAPQEntries overrides the apq_max_entries setting (used by tests)
+	MaxAPQEntries int
+
+	memory graphql.Cache[string]
+
+	mu             sync.Mutex
+	allowlist      bool
+	adminBypass    bool
+	maxAPQEntries  int
+	settingsLoaded time.Time
+
+	usesMu         sync.Mutex
+	uses           map[string]int
+	flushScheduled bool
+}
+
+var _ interface {
+	graphql.OperationParameterMutator
+	graphql.HandlerExtension
+} = &PersistedQueries{}
+
+// NewPersistedQueries creates the extension using the global server database
+func NewPersistedQueries() *PersistedQueries {
+	return &PersistedQueries{
+		Store: func() *models.PersistedQueryModel {
+			if serverDB := database.GetServerDB(); serverDB != nil {
+				return &models.PersistedQueryModel{DB: serverDB}
+			}
+			return nil
+		},
+	}
+}
+
+// ExtensionName implements graphql.HandlerExtension
+func (p *PersistedQueries) ExtensionName() string {
+	return "PersistedQueries"
+}
+
+// Validate implements graphql.HandlerExtension
+func (p *PersistedQueries) Validate(schema graphql.ExecutableSchema) error {
+	if p.memory == nil {
+		p.memory = lru.New[string](100)
+	}
+	return nil
+}
+
+// MutateOperationParameters implements graphql.OperationParameterMutator
+func (p *PersistedQueries) MutateOperationParameters(ctx context.Context, rawParams *graphql.RawParams) *gqlerror.Error {
+	enforce := p.allowlistEnforced(ctx)
+
+	if rawParams.Extensions["persistedQuery"] == nil {
+		if enforce && !p.isAllowlisted(models.HashQuery(rawParams.Query)) {
+			return persistedQueryNotAllowed()
+		}
+		return nil
+	}
+
+	var extension struct {
+		Sha256  string `json:"sha256Hash"`
+		Version int64  `json:"version"`
+	}
+	data, err := json.Marshal(rawParams.Extensions["persistedQuery"])
+	if err != nil || json.Unmarshal(data, &extension) != nil {
+		return gqlerror.Errorf("invalid APQ extension data")
+	}
+	if extension.Version != 1 {
+		return gqlerror.Errorf("unsupported APQ version")
+	}
+
+	if rawParams.Query == "" {
+		// Client sent only the hash; resolve it from the store
+		query, ok := p.lookup(extension.Sha256, enforce)
+		if !ok {
+			if enforce {
+				return persistedQueryNotAllowed()
+			}
+			err := gqlerror.Errorf(errPersistedQueryNotFound)
+			errcode.Set(err, errPersistedQueryNotFoundCode)
+			return err
+		}
+		rawParams.Query = query
+		return nil
+	}
+
+	// Client sent the full query with its hash: verify, then register
+	if models.HashQuery(rawParams.Query) != extension.Sha256 {
+		return gqlerror.Errorf("provided APQ hash does not match query")
+	}
+	if enforce {
+		if !p.isAllowlisted(extension.Sha256) {
+			return persistedQueryNotAllowed()
+		}
+		return nil
+	}
+	p.register(ctx, extension.Sha256, rawParams.Query)
+	return nil
+}
+
+func persistedQueryNotAllowed() *gqlerror.Error {
+	err := gqlerror.Errorf("query is not on the persisted query allowlist")
+	errcode.Set(err, errPersistedQueryNotAllowed)
+	return err
+}
+
+// lookup returns the query for a hash. In allowlist mode only
+// admin-registered queries are returned.
+func (p *PersistedQueries) lookup(hash string, allowlistOnly bool) (string, bool) {
+	store := p.store()
+	if store == nil {
+		if allowlistOnly {
+			return "", false
+		}
+		return p.memory.Get(context.Background(), hash)
+	}
+
+	persisted, err := store.Get(hash)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("GraphQL persisted query lookup failed: %v", err)
+		}
+		if allowlistOnly {
+			return "", false
+		}
+		// Registered while the store was full or failing
+		return p.memory.Get(context.Background(), hash)
+	}
+	if allowlistOnly && persisted.Source != models.PersistedQuerySourceAdmin {
+		return "", false
+	}
+	p.recordUse(hash)
+	return persisted.Query, true
+}
+
+// recordUse counts a hit in memory; the counts are written by flushUses
+// once per persistedQueriesFlush instead of once per request
+func (p *PersistedQueries) recordUse(hash string) {
+	p.usesMu.Lock()
+	defer p.usesMu.Unlock()
+	if p.uses == nil {
+		p.uses = make(map[string]int)
+	}
+	p.uses[hash]++
+	if !p.flushScheduled {
+		p.flushScheduled = true
+		time.AfterFunc(persistedQueriesFlush, p.flushUses)
+	}
+}
+
+// flushUses writes the collected hit counts to the store
+func (p *PersistedQueries) flushUses() {
+	p.usesMu.Lock()
+	counts := p.uses
+	p.uses = nil
+	p.flushScheduled = false
+	p.usesMu.Unlock()
+
+	store := p.store()
+	if store == nil || len(counts) == 0 {
+		return
+	}
+	if err := store.RecordUses(counts, time.Now()); err != nil {
+		log.Printf("GraphQL persisted query usage update failed: %v", err)
+	}
+}
+
+func (p *PersistedQueries) isAllowlisted(hash string) bool {
+	_, ok := p.lookup(hash, true)
+	return ok
+}
+
+func (p *PersistedQueries) register(ctx context.Context, hash, query string) {
+	store := p.store()
+	if store == nil {
+		p.memory.Add(ctx, hash, query)
+		return
+	}
+	if limit := p.apqLimit(); limit > 0 {
+		count, err := store.CountBySource(models.PersistedQuerySourceAPQ)
+		if err == nil && count >= limit {
+			if _, err := store.Get(hash); err != nil {
+				p.memory.Add(ctx, hash, query)
+				return
+			}
+		}
+	}
+	if _, err := store.Save(query, "", models.PersistedQuerySourceAPQ); err != nil {
+		log.Printf("GraphQL persisted query save failed: %v", err)
+		p.memory.Add(ctx, hash, query)
+	}
+}
+
+func (p *PersistedQueries) store() *models.PersistedQueryModel {
+	if p.Store == nil {
+		return nil
+	}
+	return p.Store()
+}
+
+// apqLimit returns the maximum number of client-registered entries kept in
+// the store; 0 means unlimited
+func (p *PersistedQueries) apqLimit() int {
+	if p.MaxAPQEntries != 0 {
+		return p.MaxAPQEntries
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loadSettings()
+	return p.maxAPQEntries
+}
+
+// loadSettings re-reads the persisted query settings once they are older
+// than persistedQueriesRefresh. p.mu must be held.
+func (p *PersistedQueries) loadSettings() {
+	if time.Since(p.settingsLoaded) <= persistedQueriesRefresh {
+		return
+	}
+	p.allowlist = false
+	p.adminBypass = true
+	p.maxAPQEntries = models.DefaultAPQMaxEntries
+	if serverDB := database.GetServerDB(); serverDB != nil {
+		settings := &models.SettingsModel{DB: serverDB}
+		p.allowlist = settings.GetBool("graphql.persisted_queries.allowlist", false)
+		p.adminBypass = settings.GetBool("graphql.persisted_queries.admin_bypass", true)
+		p.maxAPQEntries = settings.GetInt("graphql.persisted_queries.apq_max_entries", models.DefaultAPQMaxEntries)
+	}
+	p.settingsLoaded = time.Now()
+}
+
+// allowlistEnforced reports whether the allowlist applies to this caller
+func (p *PersistedQueries) allowlistEnforced(ctx context.Context) bool {
+	if p.Allowlist != nil {
+		return p.Allowlist(ctx)
+	}
+
+	p.mu.Lock()
+	p.loadSettings()
+	allowlist, adminBypass := p.allowlist, p.adminBypass
+	p.mu.Unlock()
+
+	if !allowlist {
+		return false
+	}
+	return !(adminBypass && isAdmin(ctx))
+}
@@ -0,0 +1,102 @@
+package graphql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/apimgr/weather/src/database"
+	models "github.com/apimgr/weather/src/server/model"
+)
+
+func newTestPersistedQueries(t *testing.T, maxEntries int) (*PersistedQueries, *models.PersistedQueryModel) {
+	t.Helper()
+	db, dialect, cleanup, err := database.OpenScratchDB("sqlite:", t.Name())
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(cleanup)
+	if err := database.ApplySchema(db, dialect, database.ServerSchema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	store := &models.PersistedQueryModel{DB: db}
+	p := &PersistedQueries{
+		Store:         func() *models.PersistedQueryModel { return store },
+		Allowlist:     func(context.Context) bool { return false },
+		MaxAPQEntries: maxEntries,
+	}
+	if err := p.Validate(nil); err != nil {
+		t.Fatal(err)
+	}
+	return p, store
+}
+
+func apqParams(query, hash string) *graphql.RawParams {
+	return &graphql.RawParams{
+		Query: query,
+		Extensions: map[string]any{
+			"persistedQuery": map[string]any{"version": 1, "sha256Hash": hash},
+		},
+	}
+}
+
+func TestPersistedQueriesCapAPQEntries(t *testing.T) {
+	p, store := newTestPersistedQueries(t, 2)
+	ctx := context.Background()
+
+	queries := []string{"{ a }", "{ b }", "{ c }"}
+	for _, query := range queries {
+		if err := p.MutateOperationParameters(ctx, apqParams(query, models.HashQuery(query))); err != nil {
+			t.Fatalf("register %q: %v", query, err)
+		}
+	}
+
+	count, err := store.CountBySource(models.PersistedQuerySourceAPQ)
+	if err != nil || count != 2 {
+		t.Fatalf("stored APQ entries = %d, %v; want 2", count, err)
+	}
+
+	// The entry over the cap still resolves on this node from memory
+	params := apqParams("", models.HashQuery("{ c }"))
+	if err := p.MutateOperationParameters(ctx, params); err != nil {
+		t.Fatalf("lookup over the cap: %v", err)
+	}
+	if params.Query != "{ c }" {
+		t.Errorf("Query = %q, want %q", params.Query, "{ c }")
+	}
+}
+
+func TestPersistedQueriesBatchUses(t *testing.T) {
+	p, store := newTestPersistedQueries(t, 0)
+	ctx := context.Background()
+
+	query := "{ health { status } }"
+	hash := models.HashQuery(query)
+	if err := p.MutateOperationParameters(ctx, apqParams(query, hash)); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := p.MutateOperationParameters(ctx, apqParams("", hash)); err != nil {
+			t.Fatalf("lookup: %v", err)
+		}
+	}
+
+	// Nothing is written until the batch is flushed
+	persisted, err := store.Get(hash)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if persisted.HitCount != 0 {
+		t.Errorf("HitCount before flush = %d, want 0", persisted.HitCount)
+	}
+
+	p.flushUses()
+	persisted, err = store.Get(hash)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if persisted.HitCount != 5 {
+		t.Errorf("HitCount after flush = %d, want 5", persisted.HitCount)
+	}
+}
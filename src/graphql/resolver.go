@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"github.com/apimgr/weather/src/server/handler"
 	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/server/store"
 )
 
 // This file will NOT be regenerated automatically by gqlgen.
@@ -14,9 +15,15 @@ type Resolver struct {
 	ServerDB *sql.DB
 	UsersDB  *sql.DB
 
+	// Data access layer for users, sessions, tokens, notifications and settings
+	Store store.Store
+
 	// Services
 	WeatherService *service.WeatherService
 
+	// WebSocket hub feeding GraphQL subscriptions
+	WSHub *service.WebSocketHub
+
 	// Handlers (we'll use their logic in resolvers)
 	APIHandler          *handler.APIHandler
 	AuthHandler         *handler.AuthHandler
@@ -35,6 +42,7 @@ type Resolver struct {
 // NewResolver creates a new root resolver with all dependencies
 func NewResolver(
 	serverDB, usersDB *sql.DB,
+	dataStore store.Store,
 	weatherService *service.WeatherService,
 	apiHandler *handler.APIHandler,
 	authHandler *handler.AuthHandler,
@@ -48,10 +56,12 @@ func NewResolver(
 	hurricaneHandler *handler.HurricaneHandler,
 	severeWeatherHandler *handler.SevereWeatherHandler,
 	moonHandler *handler.MoonHandler,
+	wsHub *service.WebSocketHub,
 ) *Resolver {
 	return &Resolver{
 		ServerDB:             serverDB,
 		UsersDB:              usersDB,
+		Store:                dataStore,
 		WeatherService:       weatherService,
 		APIHandler:           apiHandler,
 		AuthHandler:          authHandler,
@@ -65,5 +75,6 @@ func NewResolver(
 		HurricaneHandler:     hurricaneHandler,
 		SevereWeatherHandler: severeWeatherHandler,
 		MoonHandler:          moonHandler,
+		WSHub:                wsHub,
 	}
 }
@@ -21,6 +21,7 @@ import (
 	"github.com/apimgr/weather/src/server/handler"
 	"github.com/apimgr/weather/src/server/model"
 	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/server/store"
 	"github.com/apimgr/weather/src/utils"
 )
 
@@ -58,7 +59,7 @@ func (r *aPITokenResolver) LastUsedIP(ctx context.Context, obj *models.APIToken)
 
 // RegisterUser is the resolver for the registerUser field.
 func (r *mutationResolver) RegisterUser(ctx context.Context, username string, email string, password string) (*AuthResult, error) {
-	response, err := handler.RegisterAPIUser(r.UsersDB, &handler.APIRegisterRequest{
+	response, err := handler.RegisterAPIUser(ctx, r.UsersDB, r.Store, &handler.APIRegisterRequest{
 		Username: username,
 		Email:    email,
 		Password: password,
@@ -83,7 +84,7 @@ func (r *mutationResolver) LoginUser(ctx context.Context, identifier string, pas
 		req.RecoveryKey = *recoveryKey
 	}
 
-	response, err := handler.LoginAPIUser(r.UsersDB, req, getIPFromContext(ctx))
+	response, err := handler.LoginAPIUser(ctx, r.UsersDB, r.Store, req, getLoginContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -93,10 +94,10 @@ func (r *mutationResolver) LoginUser(ctx context.Context, identifier string, pas
 
 // CompleteUserTwoFactor is the resolver for the completeUserTwoFactor field.
 func (r *mutationResolver) CompleteUserTwoFactor(ctx context.Context, sessionToken string, twoFactorCode string) (*AuthResult, error) {
-	response, err := handler.CompleteAPIUserTwoFactor(r.UsersDB, &handler.API2FARequest{
+	response, err := handler.CompleteAPIUserTwoFactor(ctx, r.UsersDB, r.Store, &handler.API2FARequest{
 		SessionToken:  sessionToken,
 		TwoFactorCode: twoFactorCode,
-	}, getIPFromContext(ctx))
+	}, getLoginContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -106,10 +107,10 @@ func (r *mutationResolver) CompleteUserTwoFactor(ctx context.Context, sessionTok
 
 // UseUserRecoveryKey is the resolver for the useUserRecoveryKey field.
 func (r *mutationResolver) UseUserRecoveryKey(ctx context.Context, sessionToken string, recoveryKey string) (*AuthResult, error) {
-	response, err := handler.UseAPIUserRecoveryKey(r.UsersDB, &handler.APIRecoveryUseRequest{
+	response, err := handler.UseAPIUserRecoveryKey(ctx, r.UsersDB, r.Store, &handler.APIRecoveryUseRequest{
 		SessionToken: sessionToken,
 		RecoveryKey:  recoveryKey,
-	}, getIPFromContext(ctx))
+	}, getLoginContext(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -124,7 +125,7 @@ func (r *mutationResolver) LogoutUser(ctx context.Context) (*GenericResponse, er
 		return nil, err
 	}
 
-	if err := handler.LogoutCurrentUserSession(r.UsersDB, session); err != nil {
+	if err := handler.LogoutCurrentUserSession(ctx, r.Store, session); err != nil {
 		return nil, err
 	}
 
@@ -143,7 +144,7 @@ func (r *mutationResolver) RefreshUserSession(ctx context.Context) (*AuthResult,
 		return nil, err
 	}
 
-	response, err := handler.RefreshCurrentUserSession(r.UsersDB, session, user)
+	response, err := handler.RefreshCurrentUserSession(ctx, r.Store, session, user)
 	if err != nil {
 		return nil, err
 	}
@@ -153,7 +154,7 @@ func (r *mutationResolver) RefreshUserSession(ctx context.Context) (*AuthResult,
 
 // RequestPasswordReset is the resolver for the requestPasswordReset field.
 func (r *mutationResolver) RequestPasswordReset(ctx context.Context, email string) (*GenericResponse, error) {
-	if err := handler.RequestAPIUserPasswordReset(r.UsersDB, &handler.APIPasswordForgotRequest{
+	if err := handler.RequestAPIUserPasswordReset(r.UsersDB, r.Store, &handler.APIPasswordForgotRequest{
 		Email: email,
 	}, &handler.APIPasswordResetContext{
 		ClientIP: getIPFromContext(ctx),
@@ -170,7 +171,7 @@ func (r *mutationResolver) RequestPasswordReset(ctx context.Context, email strin
 
 // ResetUserPassword is the resolver for the resetUserPassword field.
 func (r *mutationResolver) ResetUserPassword(ctx context.Context, token string, password string) (*GenericResponse, error) {
-	if err := handler.ResetAPIUserPassword(r.UsersDB, &handler.APIPasswordResetRequest{
+	if err := handler.ResetAPIUserPassword(ctx, r.UsersDB, r.Store, &handler.APIPasswordResetRequest{
 		Token:    token,
 		Password: password,
 	}); err != nil {
@@ -185,7 +186,7 @@ func (r *mutationResolver) ResetUserPassword(ctx context.Context, token string,
 
 // VerifyUserEmail is the resolver for the verifyUserEmail field.
 func (r *mutationResolver) VerifyUserEmail(ctx context.Context, token string) (*GenericResponse, error) {
-	if err := handler.VerifyAPIUserEmail(r.UsersDB, &handler.APIVerifyEmailRequest{Token: token}); err != nil {
+	if err := handler.VerifyAPIUserEmail(ctx, r.Store, &handler.APIVerifyEmailRequest{Token: token}); err != nil {
 		return nil, err
 	}
 
@@ -194,7 +195,7 @@ func (r *mutationResolver) VerifyUserEmail(ctx context.Context, token string) (*
 
 // CompleteUserInvite is the resolver for the completeUserInvite field.
 func (r *mutationResolver) CompleteUserInvite(ctx context.Context, token string, username string, password string) (*UserInviteCompletion, error) {
-	response, err := handler.CompleteAPIUserInvite(r.UsersDB, token, username, password)
+	response, err := handler.CompleteAPIUserInvite(ctx, r.UsersDB, r.Store, token, username, password)
 	if err != nil {
 		return nil, err
 	}
@@ -416,7 +417,7 @@ func (r *mutationResolver) UpdateUserSettings(ctx context.Context, account *Acco
 		}
 	}
 
-	if err := handler.ApplyUserSettingsUpdate(r.UsersDB, int64(userID), req); err != nil {
+	if err := handler.ApplyUserSettingsUpdate(ctx, r.Store, int64(userID), req); err != nil {
 		return nil, err
 	}
 
@@ -430,58 +431,51 @@ func (r *mutationResolver) CreateUserToken(ctx context.Context, name string, sco
 		return nil, fmt.Errorf("unauthorized")
 	}
 
-	var count int
-	if err := r.UsersDB.QueryRow("SELECT COUNT(*) FROM user_tokens WHERE user_id = ?", userID).Scan(&count); err != nil {
+	existing, err := r.Store.ListTokens(ctx, models.OwnerTypeUser, int64(userID))
+	if err != nil {
 		return nil, fmt.Errorf("failed to count user tokens: %w", err)
 	}
-	if count >= 5 {
+	if len(existing) >= 5 {
 		return nil, fmt.Errorf("maximum 5 tokens per user")
 	}
 
-	token, err := models.GenerateTokenWithPrefix(models.PrefixUser)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
-	}
-
-	tokenHash := models.HashToken(token)
-	tokenPrefix := models.GetTokenPrefix(token) + "..."
-	createdAt := time.Now()
-
-	var expiresAt sql.NullTime
+	var expiration time.Duration
 	if expiresIn != nil && *expiresIn > 0 {
-		expiresAt = sql.NullTime{
-			Time:  createdAt.AddDate(0, 0, *expiresIn),
-			Valid: true,
-		}
+		expiration = time.Duration(*expiresIn) * 24 * time.Hour
 	}
 
-	var scopesValue string
-	if scopes != nil {
+	scopesValue := models.ScopeGlobal
+	if scopes != nil && strings.TrimSpace(*scopes) != "" {
 		scopesValue = strings.TrimSpace(*scopes)
 	}
+	parsed, err := models.ParseScopes(scopesValue)
+	if err == nil {
+		err = models.ValidateScopesForOwner(parsed, models.OwnerTypeUser)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	result, err := r.UsersDB.Exec(`
-		INSERT INTO user_tokens (user_id, token_hash, token_prefix, name, scopes, created_at, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, userID, tokenHash, tokenPrefix, strings.TrimSpace(name), scopesValue, createdAt, expiresAt)
+	tokenModel := &models.TokenModelV2{DB: r.UsersDB}
+	token, err := tokenModel.CreateToken(models.OwnerTypeUser, int64(userID), strings.TrimSpace(name), scopesValue, expiration)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create token: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load created token id: %w", err)
+	var expiresAt sql.NullTime
+	if token.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: *token.ExpiresAt, Valid: true}
 	}
 
 	return buildGraphQLUserToken(
-		id,
-		strings.TrimSpace(name),
-		tokenPrefix,
-		scopesValue,
-		createdAt,
+		token.ID,
+		token.Name,
+		token.TokenPrefix,
+		token.Scope,
+		token.CreatedAt,
 		expiresAt,
 		sql.NullTime{},
-		&token,
+		&token.Token,
 	), nil
 }
 
@@ -497,17 +491,12 @@ func (r *mutationResolver) RevokeUserToken(ctx context.Context, id string) (*Gen
 		return nil, fmt.Errorf("invalid token id")
 	}
 
-	result, err := r.UsersDB.Exec("DELETE FROM user_tokens WHERE id = ? AND user_id = ?", tokenID, userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to revoke token: %w", err)
+	err = r.Store.DeleteToken(ctx, models.OwnerTypeUser, int64(userID), tokenID)
+	if errors.Is(err, store.ErrNotFound) {
+		return &GenericResponse{Success: false, Message: "Token not found"}, nil
 	}
-
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify revoked token: %w", err)
-	}
-	if rowsAffected == 0 {
-		return &GenericResponse{Success: false, Message: "Token not found"}, nil
+		return nil, fmt.Errorf("failed to revoke token: %w", err)
 	}
 
 	return &GenericResponse{Success: true, Message: "Token revoked"}, nil
@@ -644,39 +633,19 @@ func (r *mutationResolver) MarkNotificationRead(ctx context.Context, id string)
 		return nil, fmt.Errorf("unauthorized")
 	}
 
-	_, err := r.UsersDB.Exec(`
-		UPDATE user_notifications 
-		SET read = 1
-		WHERE id = ? AND user_id = ?
-	`, id, userID)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to mark notification as read: %w", err)
+	notification, err := r.Store.GetNotification(ctx, id)
+	if err == nil && (notification.UserID == nil || *notification.UserID != userID) {
+		err = store.ErrNotFound
 	}
-
-	notification := &models.Notification{}
-	var notificationUserID int
-	err = r.UsersDB.QueryRow(`
-		SELECT id, user_id, type, display, title, message, read, dismissed, created_at, expires_at
-		FROM user_notifications WHERE id = ? AND user_id = ?
-	`, id, userID).Scan(
-		&notification.ID,
-		&notificationUserID,
-		&notification.Type,
-		&notification.Display,
-		&notification.Title,
-		&notification.Message,
-		&notification.Read,
-		&notification.Dismissed,
-		&notification.CreatedAt,
-		&notification.ExpiresAt,
-	)
-
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch notification: %w", err)
 	}
-	notification.UserID = &notificationUserID
-	notification.IsRead = notification.Read
+
+	if err := r.Store.MarkNotificationRead(ctx, id); err != nil {
+		return nil, fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+	notification.Read = true
+	notification.IsRead = true
 
 	return notification, nil
 }
@@ -688,13 +657,7 @@ func (r *mutationResolver) MarkAllNotificationsRead(ctx context.Context) (*Gener
 		return nil, fmt.Errorf("unauthorized")
 	}
 
-	_, err := r.UsersDB.Exec(`
-		UPDATE user_notifications 
-		SET read = 1
-		WHERE user_id = ? AND read = 0
-	`, userID)
-
-	if err != nil {
+	if _, err := r.Store.MarkAllNotificationsRead(ctx, int64(userID)); err != nil {
 		return &GenericResponse{Success: false, Message: fmt.Sprintf("Failed to mark notifications as read: %v", err)}, nil
 	}
 
@@ -708,26 +671,22 @@ func (r *mutationResolver) DeleteNotification(ctx context.Context, id string) (*
 		return nil, fmt.Errorf("unauthorized")
 	}
 
-	result, err := r.UsersDB.Exec("DELETE FROM user_notifications WHERE id = ? AND user_id = ?", id, userID)
+	notification, err := r.Store.GetNotification(ctx, id)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && (notification.UserID == nil || *notification.UserID != userID)) {
+		return &GenericResponse{Success: false, Message: "Notification not found"}, nil
+	}
+	if err == nil {
+		err = r.Store.DeleteNotification(ctx, id)
+	}
 	if err != nil {
 		return &GenericResponse{Success: false, Message: fmt.Sprintf("Failed to delete notification: %v", err)}, nil
 	}
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return &GenericResponse{Success: false, Message: "Notification not found"}, nil
-	}
-
 	return &GenericResponse{Success: true, Message: "Notification deleted successfully"}, nil
 }
 
 // AdminUpdateUser is the resolver for the adminUpdateUser field.
 func (r *mutationResolver) AdminUpdateUser(ctx context.Context, id string, username *string, email *string, role *string) (*models.User, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	userID, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid user id")
@@ -775,11 +734,6 @@ func (r *mutationResolver) AdminUpdateUser(ctx context.Context, id string, usern
 
 // AdminDeleteUser is the resolver for the adminDeleteUser field.
 func (r *mutationResolver) AdminDeleteUser(ctx context.Context, id string) (*GenericResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	userID, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid user id")
@@ -798,11 +752,6 @@ func (r *mutationResolver) AdminDeleteUser(ctx context.Context, id string) (*Gen
 
 // AdminCreateUserInvite is the resolver for the adminCreateUserInvite field.
 func (r *mutationResolver) AdminCreateUserInvite(ctx context.Context, username string, email string, role *string, expiresInDays *int) (*UserInvite, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	normalizedUsername := utils.NormalizeUsername(username)
 	if err := utils.ValidateUsername(normalizedUsername); err != nil {
 		return nil, err
@@ -842,11 +791,6 @@ func (r *mutationResolver) AdminCreateUserInvite(ctx context.Context, username s
 
 // AdminDeleteUserInvite is the resolver for the adminDeleteUserInvite field.
 func (r *mutationResolver) AdminDeleteUserInvite(ctx context.Context, id string) (*GenericResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	inviteID, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid invite id")
@@ -862,11 +806,6 @@ func (r *mutationResolver) AdminDeleteUserInvite(ctx context.Context, id string)
 
 // AdminInviteServerAdmin is the resolver for the adminInviteServerAdmin field.
 func (r *mutationResolver) AdminInviteServerAdmin(ctx context.Context, email string, expiresIn *string) (*ServerAdminInvite, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	currentAdmin, err := loadGraphQLCurrentAdmin(ctx, r.ServerDB)
 	if err != nil {
 		return nil, err
@@ -888,11 +827,6 @@ func (r *mutationResolver) AdminInviteServerAdmin(ctx context.Context, email str
 
 // AdminDeleteServerAdmin is the resolver for the adminDeleteServerAdmin field.
 func (r *mutationResolver) AdminDeleteServerAdmin(ctx context.Context, id string) (*GenericResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	currentAdmin, err := loadGraphQLCurrentAdmin(ctx, r.ServerDB)
 	if err != nil {
 		return nil, err
@@ -934,11 +868,6 @@ func (r *mutationResolver) AdminDeleteServerAdmin(ctx context.Context, id string
 
 // AdminDisableServerAdmin is the resolver for the adminDisableServerAdmin field.
 func (r *mutationResolver) AdminDisableServerAdmin(ctx context.Context, id string) (*GenericResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	currentAdmin, err := loadGraphQLCurrentAdmin(ctx, r.ServerDB)
 	if err != nil {
 		return nil, err
@@ -980,11 +909,6 @@ func (r *mutationResolver) AdminDisableServerAdmin(ctx context.Context, id strin
 
 // AdminEnableServerAdmin is the resolver for the adminEnableServerAdmin field.
 func (r *mutationResolver) AdminEnableServerAdmin(ctx context.Context, id string) (*GenericResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	adminID, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid admin id")
@@ -1005,11 +929,6 @@ func (r *mutationResolver) AdminEnableServerAdmin(ctx context.Context, id string
 
 // AdminUpdateSetting is the resolver for the adminUpdateSetting field.
 func (r *mutationResolver) AdminUpdateSetting(ctx context.Context, key string, value string) (*models.Setting, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	result, err := r.ServerDB.Exec(`
 		UPDATE server_config
 		SET value = ?, updated_at = CURRENT_TIMESTAMP
@@ -1032,11 +951,6 @@ func (r *mutationResolver) AdminUpdateSetting(ctx context.Context, key string, v
 
 // AdminUpdateSettings is the resolver for the adminUpdateSettings field.
 func (r *mutationResolver) AdminUpdateSettings(ctx context.Context, settings []*SettingInput) (*BulkResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	successCount := 0
 	failedCount := 0
 
@@ -1069,11 +983,6 @@ func (r *mutationResolver) AdminUpdateSettings(ctx context.Context, settings []*
 
 // AdminResetSettings is the resolver for the adminResetSettings field.
 func (r *mutationResolver) AdminResetSettings(ctx context.Context) (*GenericResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	settingsModel := &models.SettingsModel{DB: r.ServerDB}
 	backupPath := settingsModel.GetString("backup.location", "/data/backups")
 
@@ -1099,11 +1008,6 @@ func (r *mutationResolver) AdminResetSettings(ctx context.Context) (*GenericResp
 
 // AdminGenerateToken is the resolver for the adminGenerateToken field.
 func (r *mutationResolver) AdminGenerateToken(ctx context.Context) (*models.APIToken, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	adminID, ok := ctx.Value("admin_id").(int)
 	if !ok || adminID <= 0 {
 		return nil, fmt.Errorf("unauthorized: admin session required")
@@ -1130,11 +1034,6 @@ func (r *mutationResolver) AdminGenerateToken(ctx context.Context) (*models.APIT
 
 // AdminRevokeToken is the resolver for the adminRevokeToken field.
 func (r *mutationResolver) AdminRevokeToken(ctx context.Context, id string) (*GenericResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	adminID, ok := ctx.Value("admin_id").(int)
 	if !ok || adminID <= 0 {
 		return nil, fmt.Errorf("unauthorized: admin session required")
@@ -1154,11 +1053,6 @@ func (r *mutationResolver) AdminRevokeToken(ctx context.Context, id string) (*Ge
 
 // AdminClearAuditLogs is the resolver for the adminClearAuditLogs field.
 func (r *mutationResolver) AdminClearAuditLogs(ctx context.Context) (*GenericResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	_, err := r.ServerDB.Exec("DELETE FROM server_audit_log")
 	if err != nil {
 		return nil, fmt.Errorf("failed to clear audit logs: %w", err)
@@ -1169,11 +1063,6 @@ func (r *mutationResolver) AdminClearAuditLogs(ctx context.Context) (*GenericRes
 
 // AdminEnableTask is the resolver for the adminEnableTask field.
 func (r *mutationResolver) AdminEnableTask(ctx context.Context, name string) (*ScheduledTask, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	task, err := r.updateGraphQLScheduledTaskEnabled(name, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to enable task: %w", err)
@@ -1184,11 +1073,6 @@ func (r *mutationResolver) AdminEnableTask(ctx context.Context, name string) (*S
 
 // AdminUpdateTask is the resolver for the adminUpdateTask field.
 func (r *mutationResolver) AdminUpdateTask(ctx context.Context, name string, enabled bool) (*ScheduledTask, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	task, err := r.updateGraphQLScheduledTaskEnabled(name, enabled)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update task: %w", err)
@@ -1199,11 +1083,6 @@ func (r *mutationResolver) AdminUpdateTask(ctx context.Context, name string, ena
 
 // AdminDisableTask is the resolver for the adminDisableTask field.
 func (r *mutationResolver) AdminDisableTask(ctx context.Context, name string) (*ScheduledTask, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	task, err := r.updateGraphQLScheduledTaskEnabled(name, false)
 	if err != nil {
 		return nil, fmt.Errorf("failed to disable task: %w", err)
@@ -1214,11 +1093,6 @@ func (r *mutationResolver) AdminDisableTask(ctx context.Context, name string) (*
 
 // AdminTriggerTask is the resolver for the adminTriggerTask field.
 func (r *mutationResolver) AdminTriggerTask(ctx context.Context, name string) (*GenericResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	err := r.SchedulerHandler.Scheduler.TriggerTask(name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to trigger task: %w", err)
@@ -1229,11 +1103,6 @@ func (r *mutationResolver) AdminTriggerTask(ctx context.Context, name string) (*
 
 // AdminUpdateChannel is the resolver for the adminUpdateChannel field.
 func (r *mutationResolver) AdminUpdateChannel(ctx context.Context, typeArg string, enabled *bool, config any) (*NotificationChannel, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	if enabled != nil {
 		channelManager := service.NewChannelManager(r.ServerDB)
 		var err error
@@ -1268,11 +1137,6 @@ func (r *mutationResolver) AdminUpdateChannel(ctx context.Context, typeArg strin
 
 // AdminEnableChannel is the resolver for the adminEnableChannel field.
 func (r *mutationResolver) AdminEnableChannel(ctx context.Context, typeArg string) (*NotificationChannel, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	channelManager := service.NewChannelManager(r.ServerDB)
 	if err := channelManager.EnableChannel(typeArg); err != nil {
 		return nil, fmt.Errorf("failed to enable channel: %w", err)
@@ -1283,11 +1147,6 @@ func (r *mutationResolver) AdminEnableChannel(ctx context.Context, typeArg strin
 
 // AdminDisableChannel is the resolver for the adminDisableChannel field.
 func (r *mutationResolver) AdminDisableChannel(ctx context.Context, typeArg string) (*NotificationChannel, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	channelManager := service.NewChannelManager(r.ServerDB)
 	if err := channelManager.DisableChannel(typeArg); err != nil {
 		return nil, fmt.Errorf("failed to disable channel: %w", err)
@@ -1298,11 +1157,6 @@ func (r *mutationResolver) AdminDisableChannel(ctx context.Context, typeArg stri
 
 // AdminTestChannel is the resolver for the adminTestChannel field.
 func (r *mutationResolver) AdminTestChannel(ctx context.Context, typeArg string, recipient *string) (*GenericResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	recipientValue, err := r.resolveAdminChannelTestRecipient(ctx, typeArg, recipient)
 	if err != nil {
 		return nil, err
@@ -1334,11 +1188,6 @@ func (r *mutationResolver) AdminTestChannel(ctx context.Context, typeArg string,
 
 // AdminInitializeChannels is the resolver for the adminInitializeChannels field.
 func (r *mutationResolver) AdminInitializeChannels(ctx context.Context) (*GenericResponse, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	channelManager := service.NewChannelManager(r.ServerDB)
 	if err := channelManager.InitializeChannels(); err != nil {
 		return nil, fmt.Errorf("failed to initialize notification channels: %w", err)
@@ -1352,11 +1201,6 @@ func (r *mutationResolver) AdminInitializeChannels(ctx context.Context) (*Generi
 
 // AdminAutoDetectSMTP is the resolver for the adminAutoDetectSMTP field.
 func (r *mutationResolver) AdminAutoDetectSMTP(ctx context.Context) (*SMTPProvider, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	smtpService := service.NewSMTPService(r.ServerDB)
 	found, err := smtpService.AutoDetect()
 	if err != nil {
@@ -1398,10 +1242,6 @@ func (r *mutationResolver) AdminAutoDetectSMTP(ctx context.Context) (*SMTPProvid
 
 // SubmitContactForm is the resolver for the submitContactForm field.
 func (r *mutationResolver) SubmitContactForm(ctx context.Context, name string, email string, subject string, message string) (*ContactSubmission, error) {
-	if err := ensureGraphQLContactSubmissionsTable(r.ServerDB); err != nil {
-		return nil, fmt.Errorf("failed to prepare contact submission storage: %w", err)
-	}
-
 	requestIP, _ := ctx.Value("request_ip").(string)
 	userAgent, _ := ctx.Value("request_user_agent").(string)
 
@@ -2091,7 +1931,7 @@ func (r *queryResolver) UserSettings(ctx context.Context) (*UserSettings, error)
 		return nil, fmt.Errorf("unauthorized: user not authenticated")
 	}
 
-	settings, err := handler.LoadUserSettings(r.UsersDB, int64(userID))
+	settings, err := handler.LoadUserSettings(ctx, r.Store, int64(userID))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load user settings: %w", err)
 	}
@@ -2288,6 +2128,82 @@ func mapGraphQLSevereWeatherAlert(alert service.Alert) *SevereWeather {
 	}
 }
 
+// graphQLWeatherUpdateInterval is how often weatherUpdates refreshes conditions
+const graphQLWeatherUpdateInterval = 10 * time.Minute
+
+// subscribeGraphQLHub forwards matching WebSocket hub messages to a
+// subscription channel until the subscription context ends.
+func subscribeGraphQLHub[T any](ctx context.Context, hub *service.WebSocketHub, userID, adminID *int, convert func(*service.WebSocketMessage) (*T, bool), types ...string) <-chan *T {
+	sub := hub.Subscribe(userID, adminID, types...)
+	out := make(chan *T, 1)
+
+	go func() {
+		defer close(out)
+		defer hub.Unsubscribe(sub)
+
+		for {
+			select {
+			case message, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				item, match := convert(message)
+				if !match {
+					continue
+				}
+				select {
+				case out <- item:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+func mapGraphQLWeatherAlert(alert service.Alert) *WeatherAlert {
+	description := strings.TrimSpace(alert.Description)
+	if description == "" {
+		description = strings.TrimSpace(alert.Headline)
+	}
+
+	headline := strings.TrimSpace(alert.Headline)
+	if headline == "" {
+		headline = alert.Event
+	}
+
+	item := &WeatherAlert{
+		Headline:    headline,
+		Severity:    alert.Severity,
+		Event:       alert.Event,
+		Description: description,
+	}
+	if value := strings.TrimSpace(alert.Urgency); value != "" {
+		item.Urgency = &value
+	}
+	if value := strings.TrimSpace(alert.AreaDesc); value != "" {
+		item.Areas = &value
+	}
+	if value := strings.TrimSpace(alert.Category); value != "" {
+		item.Category = &value
+	}
+	if value := strings.TrimSpace(alert.Instruction); value != "" {
+		item.Instruction = &value
+	}
+	if effective := parseGraphQLTime(firstNonEmpty(alert.Effective, alert.Sent)); !effective.IsZero() {
+		item.Effective = &effective
+	}
+	if expires := parseGraphQLTime(alert.Expires); !expires.IsZero() {
+		item.Expires = &expires
+	}
+
+	return item
+}
+
 func hurricaneCategory(windSpeed int) int {
 	switch {
 	case windSpeed >= 157:
@@ -2941,27 +2857,6 @@ func loadGraphQLSQLiteStats(db *sql.DB) (float64, int, error) {
 	return float64(pageCount * pageSize), tables, nil
 }
 
-func ensureGraphQLContactSubmissionsTable(db *sql.DB) error {
-	if db == nil {
-		return fmt.Errorf("server database unavailable")
-	}
-
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS contact_submissions (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			email TEXT NOT NULL,
-			subject TEXT NOT NULL,
-			message TEXT NOT NULL,
-			ip_address TEXT,
-			user_agent TEXT,
-			status TEXT NOT NULL DEFAULT 'pending',
-			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
-		)
-	`)
-	return err
-}
-
 func (r *mutationResolver) resolveAdminChannelTestRecipient(ctx context.Context, typeArg string, recipient *string) (string, error) {
 	if recipient != nil {
 		trimmed := strings.TrimSpace(*recipient)
@@ -3147,11 +3042,6 @@ func (r *queryResolver) UnreadNotifications(ctx context.Context) (*UnreadCount,
 
 // AdminUsers is the resolver for the adminUsers field.
 func (r *queryResolver) AdminUsers(ctx context.Context) ([]*models.User, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	rows, err := r.UsersDB.Query(
 		"SELECT id, email, username, role, email_verified, two_factor_enabled, created_at, updated_at FROM user_accounts ORDER BY created_at DESC",
 	)
@@ -3175,11 +3065,6 @@ func (r *queryResolver) AdminUsers(ctx context.Context) ([]*models.User, error)
 
 // AdminServerAdmins is the resolver for the adminServerAdmins field.
 func (r *queryResolver) AdminServerAdmins(ctx context.Context) (*ServerAdminOverview, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	adminModel := &models.AdminModel{DB: r.ServerDB}
 	count, err := adminModel.GetCount()
 	if err != nil {
@@ -3206,11 +3091,6 @@ func (r *queryResolver) AdminServerAdmins(ctx context.Context) (*ServerAdminOver
 
 // AdminServerAdmin is the resolver for the adminServerAdmin field.
 func (r *queryResolver) AdminServerAdmin(ctx context.Context, id string) (*ServerAdmin, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	adminID, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid admin id")
@@ -3229,11 +3109,6 @@ func (r *queryResolver) AdminServerAdmin(ctx context.Context, id string) (*Serve
 
 // AdminUserInvites is the resolver for the adminUserInvites field.
 func (r *queryResolver) AdminUserInvites(ctx context.Context) ([]*UserInvite, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	inviteModel := &models.UserInviteModel{DB: r.UsersDB}
 	invites, err := inviteModel.ListInvites()
 	if err != nil {
@@ -3251,11 +3126,6 @@ func (r *queryResolver) AdminUserInvites(ctx context.Context) ([]*UserInvite, er
 
 // AdminUserInvite is the resolver for the adminUserInvite field.
 func (r *queryResolver) AdminUserInvite(ctx context.Context, id string) (*UserInvite, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	inviteID, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid invite id")
@@ -3275,11 +3145,6 @@ func (r *queryResolver) AdminUserInvite(ctx context.Context, id string) (*UserIn
 
 // AdminSettings is the resolver for the adminSettings field.
 func (r *queryResolver) AdminSettings(ctx context.Context) ([]*models.Setting, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	rows, err := r.ServerDB.Query(
 		"SELECT key, value, type, COALESCE(description, ''), updated_at FROM server_config ORDER BY key",
 	)
@@ -3302,11 +3167,6 @@ func (r *queryResolver) AdminSettings(ctx context.Context) ([]*models.Setting, e
 
 // AdminSetting is the resolver for the adminSetting field.
 func (r *queryResolver) AdminSetting(ctx context.Context, key string) (*models.Setting, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	setting, err := loadGraphQLSetting(r.ServerDB, key)
 	if err != nil {
 		return nil, fmt.Errorf("setting not found: %w", err)
@@ -3317,11 +3177,6 @@ func (r *queryResolver) AdminSetting(ctx context.Context, key string) (*models.S
 
 // AdminTokens is the resolver for the adminTokens field.
 func (r *queryResolver) AdminTokens(ctx context.Context) ([]*models.APIToken, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	adminID, ok := ctx.Value("admin_id").(int)
 	if !ok || adminID <= 0 {
 		return nil, fmt.Errorf("unauthorized: admin session required")
@@ -3349,11 +3204,6 @@ func (r *queryResolver) AdminTokens(ctx context.Context) ([]*models.APIToken, er
 
 // AdminAuditLogs is the resolver for the adminAuditLogs field.
 func (r *queryResolver) AdminAuditLogs(ctx context.Context, limit *int, offset *int) ([]*AuditLog, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	limitVal := 50
 	if limit != nil {
 		limitVal = *limit
@@ -3414,11 +3264,6 @@ func (r *queryResolver) AdminAuditLogs(ctx context.Context, limit *int, offset *
 
 // AdminStats is the resolver for the adminStats field.
 func (r *queryResolver) AdminStats(ctx context.Context) (*SystemStats, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	var totalUsers, activeUsers int
 	var adminUsers int
 	var totalLocations int
@@ -3486,11 +3331,6 @@ func (r *queryResolver) AdminStats(ctx context.Context) (*SystemStats, error) {
 
 // AdminTasks is the resolver for the adminTasks field.
 func (r *queryResolver) AdminTasks(ctx context.Context) ([]*ScheduledTask, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	rows, err := r.ServerDB.Query(
 		"SELECT task_name, schedule, enabled, last_run, next_run, run_count, fail_count FROM server_scheduler_state ORDER BY task_name",
 	)
@@ -3513,11 +3353,6 @@ func (r *queryResolver) AdminTasks(ctx context.Context) ([]*ScheduledTask, error
 
 // AdminTaskHistory is the resolver for the adminTaskHistory field.
 func (r *queryResolver) AdminTaskHistory(ctx context.Context, name string, limit *int) ([]*TaskHistory, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	if r.SchedulerHandler == nil || r.SchedulerHandler.Scheduler == nil {
 		return nil, fmt.Errorf("scheduler runtime unavailable")
 	}
@@ -3542,11 +3377,6 @@ func (r *queryResolver) AdminTaskHistory(ctx context.Context, name string, limit
 
 // AdminChannels is the resolver for the adminChannels field.
 func (r *queryResolver) AdminChannels(ctx context.Context) ([]*NotificationChannel, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	rows, err := r.ServerDB.Query(
 		"SELECT channel_type, enabled, config FROM notification_channels ORDER BY channel_type",
 	)
@@ -3569,11 +3399,6 @@ func (r *queryResolver) AdminChannels(ctx context.Context) ([]*NotificationChann
 
 // AdminChannel is the resolver for the adminChannel field.
 func (r *queryResolver) AdminChannel(ctx context.Context, typeArg string) (*NotificationChannel, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	channel, err := loadGraphQLNotificationChannel(r.ServerDB, typeArg)
 	if err != nil {
 		return nil, fmt.Errorf("channel not found: %w", err)
@@ -3584,11 +3409,6 @@ func (r *queryResolver) AdminChannel(ctx context.Context, typeArg string) (*Noti
 
 // AdminChannelStats is the resolver for the adminChannelStats field.
 func (r *queryResolver) AdminChannelStats(ctx context.Context, typeArg string) (*ChannelStats, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	var sent, failed int
 	var lastSent sql.NullTime
 	if err := r.ServerDB.QueryRow(`
@@ -3616,11 +3436,6 @@ func (r *queryResolver) AdminChannelStats(ctx context.Context, typeArg string) (
 
 // AdminQueueStats is the resolver for the adminQueueStats field.
 func (r *queryResolver) AdminQueueStats(ctx context.Context) (*QueueStats, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	var pending, processing, completed, failed int
 	if err := r.ServerDB.QueryRow("SELECT COUNT(*) FROM notification_queue WHERE state IN ('created', 'queued')").Scan(&pending); err != nil {
 		return nil, fmt.Errorf("failed to load pending queue count: %w", err)
@@ -3645,11 +3460,6 @@ func (r *queryResolver) AdminQueueStats(ctx context.Context) (*QueueStats, error
 
 // AdminSMTPProviders is the resolver for the adminSMTPProviders field.
 func (r *queryResolver) AdminSMTPProviders(ctx context.Context) ([]*SMTPProvider, error) {
-	userRole, ok := ctx.Value("user_role").(string)
-	if !ok || userRole != "admin" {
-		return nil, fmt.Errorf("unauthorized: admin access required")
-	}
-
 	presets := service.ListProviderPresets()
 	providers := make([]*SMTPProvider, 0, len(presets))
 	for _, preset := range presets {
@@ -3696,6 +3506,80 @@ func (r *savedLocationResolver) Alerts(ctx context.Context, obj *models.SavedLoc
 	return obj.AlertsEnabled, nil
 }
 
+// Weather is the resolver for the weather field.
+func (r *savedLocationResolver) Weather(ctx context.Context, obj *models.SavedLocation) (*Weather, error) {
+	if r.WeatherService == nil {
+		return nil, fmt.Errorf("weather service not initialized")
+	}
+
+	loaders := loadersFromContext(ctx, r.WeatherService)
+	point := service.WeatherPoint{Latitude: obj.Latitude, Longitude: obj.Longitude}
+	timezone := obj.Timezone
+
+	weather := &Weather{
+		Location: &Location{
+			Name:     obj.Name,
+			Lat:      obj.Latitude,
+			Lon:      obj.Longitude,
+			Timezone: &timezone,
+		},
+		Timestamp: time.Now(),
+	}
+
+	// Only hit the upstream API for the parts that were selected
+	for _, field := range gqlupload.CollectFieldsCtx(ctx, nil) {
+		switch field.Name {
+		case "current":
+			current, err := loaders.CurrentWeather.Load(ctx, point)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get weather: %w", err)
+			}
+			feelsLike := current.FeelsLike
+			pressure := current.Pressure
+			precipitation := current.Precipitation
+			cloudCover := current.CloudCover
+			weather.Current = &CurrentWeather{
+				Temperature:   current.Temperature,
+				FeelsLike:     &feelsLike,
+				Humidity:      current.Humidity,
+				Pressure:      &pressure,
+				WindSpeed:     current.WindSpeed,
+				Precipitation: &precipitation,
+				CloudCover:    &cloudCover,
+				Condition: &WeatherCondition{
+					Text: r.WeatherService.GetWeatherDescription(current.WeatherCode),
+					Icon: stringPtr(r.WeatherService.GetWeatherIcon(current.WeatherCode, current.IsDay == 1)),
+				},
+				LastUpdated: time.Now(),
+			}
+		case "forecast":
+			forecast, err := loaders.Forecast.Load(ctx, forecastKey{Point: point, Days: savedLocationForecastDays})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get forecast: %w", err)
+			}
+			for _, day := range forecast.Days {
+				precipitation := day.Precipitation
+				chanceOfRain := day.PrecipitationProbability
+				weather.Forecast = append(weather.Forecast, &ForecastDay{
+					Date: day.Date,
+					Day: &DayForecast{
+						MaxTemp:            day.TempMax,
+						MinTemp:            day.TempMin,
+						TotalPrecipitation: &precipitation,
+						ChanceOfRain:       &chanceOfRain,
+						Condition: &WeatherCondition{
+							Text: r.WeatherService.GetWeatherDescription(day.WeatherCode),
+							Icon: stringPtr(r.WeatherService.GetWeatherIcon(day.WeatherCode, true)),
+						},
+					},
+				})
+			}
+		}
+	}
+
+	return weather, nil
+}
+
 // UpdatedAt is the resolver for the updatedAt field.
 func (r *settingResolver) UpdatedAt(ctx context.Context, obj *models.Setting) (*time.Time, error) {
 	return &obj.UpdatedAt, nil
@@ -3707,6 +3591,123 @@ func (r *settingResolver) UpdatedBy(ctx context.Context, obj *models.Setting) (*
 	return nil, nil
 }
 
+// SevereWeatherAlerts is the resolver for the severeWeatherAlerts field.
+func (r *subscriptionResolver) SevereWeatherAlerts(ctx context.Context, lat float64, lon float64, radius *float64) (<-chan *WeatherAlert, error) {
+	if r.WSHub == nil {
+		return nil, fmt.Errorf("subscriptions not available")
+	}
+
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return nil, fmt.Errorf("invalid coordinates")
+	}
+
+	maxMiles := 50.0
+	if radius != nil {
+		if *radius <= 0 {
+			return nil, fmt.Errorf("radius must be positive")
+		}
+		maxMiles = *radius
+	}
+
+	return subscribeGraphQLHub(ctx, r.WSHub, nil, nil, func(message *service.WebSocketMessage) (*WeatherAlert, bool) {
+		alert, ok := message.Data.(service.Alert)
+		if !ok || !service.AlertNearLocation(alert, lat, lon, maxMiles) {
+			return nil, false
+		}
+		return mapGraphQLWeatherAlert(alert), true
+	}, service.HubMessageSevereWeatherAlert), nil
+}
+
+// Notifications is the resolver for the notifications field.
+func (r *subscriptionResolver) Notifications(ctx context.Context) (<-chan *models.Notification, error) {
+	if r.WSHub == nil {
+		return nil, fmt.Errorf("subscriptions not available")
+	}
+
+	var userID, adminID *int
+	if id := getUserIDFromContext(ctx); id > 0 {
+		userID = &id
+	} else if id, ok := ctx.Value("admin_id").(int); ok && id > 0 {
+		adminID = &id
+	} else {
+		return nil, fmt.Errorf("unauthorized: authentication required")
+	}
+
+	return subscribeGraphQLHub(ctx, r.WSHub, userID, adminID, func(message *service.WebSocketMessage) (*models.Notification, bool) {
+		notification, ok := message.Data.(*models.Notification)
+		return notification, ok && notification != nil
+	}, service.HubMessageNotification), nil
+}
+
+// Earthquakes is the resolver for the earthquakes field.
+func (r *subscriptionResolver) Earthquakes(ctx context.Context, minMagnitude *float64, region *string) (<-chan *Earthquake, error) {
+	if r.WSHub == nil {
+		return nil, fmt.Errorf("subscriptions not available")
+	}
+
+	if minMagnitude != nil && *minMagnitude < 0 {
+		return nil, fmt.Errorf("minMagnitude must be non-negative")
+	}
+
+	regionFilter := ""
+	if region != nil {
+		regionFilter = strings.ToLower(strings.TrimSpace(*region))
+	}
+
+	return subscribeGraphQLHub(ctx, r.WSHub, nil, nil, func(message *service.WebSocketMessage) (*Earthquake, bool) {
+		eq, ok := message.Data.(service.Earthquake)
+		if !ok {
+			return nil, false
+		}
+		if minMagnitude != nil && eq.Magnitude < *minMagnitude {
+			return nil, false
+		}
+		if regionFilter != "" && !strings.Contains(strings.ToLower(eq.Place), regionFilter) {
+			return nil, false
+		}
+		return mapGraphQLEarthquake(eq), true
+	}, service.HubMessageEarthquake), nil
+}
+
+// WeatherUpdates is the resolver for the weatherUpdates field.
+func (r *subscriptionResolver) WeatherUpdates(ctx context.Context, locationID string) (<-chan *Weather, error) {
+	location, err := r.Query().SavedLocation(ctx, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	lat := location.Latitude
+	lon := location.Longitude
+	updates := make(chan *Weather, 1)
+
+	go func() {
+		defer close(updates)
+
+		ticker := time.NewTicker(graphQLWeatherUpdateInterval)
+		defer ticker.Stop()
+
+		for {
+			weather, err := r.Query().Weather(ctx, nil, &lat, &lon)
+			if err == nil {
+				weather.Location.Name = location.Name
+				select {
+				case updates <- weather:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return updates, nil
+}
+
 // LastLoginAt is the resolver for the lastLoginAt field.
 func (r *userResolver) LastLoginAt(ctx context.Context, obj *models.User) (*time.Time, error) {
 	return obj.LastLoginAt, nil
@@ -3730,6 +3731,9 @@ func (r *Resolver) SavedLocation() SavedLocationResolver { return &savedLocation
 // Setting returns SettingResolver implementation.
 func (r *Resolver) Setting() SettingResolver { return &settingResolver{r} }
 
+// Subscription returns SubscriptionResolver implementation.
+func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
+
 // User returns UserResolver implementation.
 func (r *Resolver) User() UserResolver { return &userResolver{r} }
 
@@ -3787,4 +3791,5 @@ type notificationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type savedLocationResolver struct{ *Resolver }
 type settingResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
 type userResolver struct{ *Resolver }
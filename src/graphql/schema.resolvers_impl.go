@@ -7,6 +7,8 @@ import (
 	"context"
 	"fmt"
 	"time"
+
+	"github.com/apimgr/weather/src/server/service"
 )
 
 // Helper function to get user ID from context.
@@ -47,6 +49,16 @@ func getIPFromContext(ctx context.Context) string {
 	return ip
 }
 
+// Helper function to describe the request a login came from
+func getLoginContext(ctx context.Context) service.LoginContext {
+	userAgent, _ := ctx.Value("request_user_agent").(string)
+	return service.LoginContext{
+		IP:        getIPFromContext(ctx),
+		UserAgent: userAgent,
+		AppURL:    graphQLRequestBaseURL(ctx),
+	}
+}
+
 // Helper function to create a string pointer
 func stringPtr(s string) *string {
 	return &s
@@ -26,7 +26,10 @@ import (
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
 
+	"github.com/apimgr/weather/src/backup"
+	"github.com/apimgr/weather/src/backup/objectstore"
 	"github.com/apimgr/weather/src/cli"
+	"github.com/apimgr/weather/src/cluster"
 	"github.com/apimgr/weather/src/common/i18n"
 	"github.com/apimgr/weather/src/config"
 	"github.com/apimgr/weather/src/database"
@@ -40,6 +43,7 @@ import (
 	"github.com/apimgr/weather/src/server/middleware"
 	"github.com/apimgr/weather/src/server/model"
 	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/server/store"
 	"github.com/apimgr/weather/src/utils"
 )
 
@@ -269,23 +273,97 @@ func main() {
 		appLogger.Printf("Setup token generated (will be displayed in banner)")
 	}
 
+	// Load server configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		appLogger.Error("Warning: Could not load server.yml: %v (using defaults)", err)
+		fmt.Printf("⚠️  Warning: Could not load server.yml: %v (using defaults)\n", err)
+	} else {
+		appLogger.Printf("Configuration loaded from server.yml")
+		fmt.Printf("✅ Configuration loaded from server.yml\n")
+	}
+
+	// Set global config for handler access
+	config.SetGlobalConfig(cfg)
+
 	// Initialize database - TEMPLATE.md PART 31: Dual database architecture
-	// SQLite dual database: server.db + users.db
+	// SQLite dual database: server.db + users.db (or two PostgreSQL/MySQL
+	// databases per server.database.driver)
 	// server.db = admin credentials, config, scheduler, audit log
 	// users.db = user accounts, tokens, sessions, locations
-	dualDB, err := database.InitDualDB(dirPaths.Data)
+	dbCfg := cfg.Server.Database
+	databaseConfig := dbCfg.Connection()
+	dualDB, err := database.OpenDualDB(dirPaths.Data, databaseConfig)
 	if err != nil {
 		appLogger.Fatal("Failed to initialize dual database system: %v", err)
 	}
+	// Apply pending schema migrations, backing up existing databases first
+	if err := dualDB.Migrate(cli.MigrationBackupHook(dirPaths.Config, dirPaths.Data, dualDB.Dialect)); err != nil {
+		dualDB.Close()
+		appLogger.Fatal("Failed to migrate databases: %v", err)
+	}
 	defer dualDB.Close()
 
 	// Set global instance for handler access
 	database.SetGlobalDualDB(dualDB)
 	dbPath := fmt.Sprintf("%s/db/server.db + %s/db/users.db", dirPaths.Data, dirPaths.Data)
+	if dualDB.Dialect != database.DialectSQLite {
+		serverName, usersName := databaseConfig.DualDatabaseNames()
+		dbPath = fmt.Sprintf("%s %s + %s on %s", dualDB.Dialect, serverName, usersName, dbCfg.Host)
+	}
+
+	auditLogger, err := newAuditLogger(cfg, dirPaths)
+	if err != nil {
+		appLogger.Error("Failed to open audit log: %v", err)
+	}
+
+	// PostgreSQL/MySQL: writes made while a database is down are queued in
+	// {data_dir}/db and replayed on recovery; reads can use replicas
+	var failoverManagers map[string]*database.FailoverManager
+	if dualDB.Dialect != database.DialectSQLite {
+		failoverManagers, err = database.StartDualFailover(dualDB, databaseConfig, filepath.Join(dirPaths.Data, "db"), func(name string, report *database.ReplayReport) {
+			if auditLogger == nil {
+				return
+			}
+			logWrite := func(event service.EventType, write database.ReplayConflict) {
+				auditLogger.Log(service.AuditEvent{
+					Event:    string(event),
+					Category: "system",
+					Severity: "error",
+					Actor:    service.Actor{Type: "system", ID: "failover"},
+					Target:   &service.Target{Type: "database", ID: name},
+					Details: map[string]interface{}{
+						"write_seq": write.Seq,
+						"attempts":  write.Attempts,
+						"remaining": report.Remaining,
+						"error":     write.Error,
+					},
+					Result: "failure",
+				})
+			}
+			for _, letter := range report.DeadLetters {
+				logWrite(service.EventSystemDBDeadLetter, letter)
+			}
+			if report.Conflict != nil {
+				logWrite(service.EventSystemDBReplayConflict, *report.Conflict)
+			}
+		})
+		if err != nil {
+			appLogger.Error("Failed to start database failover: %v", err)
+		}
+		for _, fm := range failoverManagers {
+			defer fm.Close()
+		}
+		// Every handler, model, store and task gets the routed handles
+		dualDB = dualDB.WithFailover(failoverManagers)
+		database.SetGlobalDualDB(dualDB)
+	}
 
 	// Create wrapper for handlers that use database.DB struct
 	// Uses Users database for user-related operations
 	db := &database.DB{DB: dualDB.Users}
+	// Typed data access for handlers and scheduler tasks
+	dataStore := store.New(dualDB)
 
 	// Check if setup is complete
 	var setupComplete bool
@@ -311,19 +389,6 @@ func main() {
 		fmt.Printf("✅ Database initialized: %s (setup mode)\n", dbPath)
 	}
 
-	// Load server configuration
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		appLogger.Error("Warning: Could not load server.yml: %v (using defaults)", err)
-		fmt.Printf("⚠️  Warning: Could not load server.yml: %v (using defaults)\n", err)
-	} else {
-		appLogger.Printf("Configuration loaded from server.yml")
-		fmt.Printf("✅ Configuration loaded from server.yml\n")
-	}
-
-	// Set global config for handler access
-	config.SetGlobalConfig(cfg)
-
 	// Note: Version and BuildDate are embedded in binary via LDFLAGS, not in config file
 
 	// Initialize default settings with proper backup path
@@ -416,8 +481,53 @@ func main() {
 	// Create Gin router
 	r := gin.New()
 
-	// Trust reverse proxy headers
-	r.SetTrustedProxies([]string{"127.0.0.1", "::1", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"})
+	// Trust reverse proxy headers only from server.trusted_proxies, so
+	// c.ClientIP() cannot be spoofed by clients connecting directly
+	if err := r.SetTrustedProxies(cfg.GetTrustedProxies()); err != nil {
+		appLogger.Error("Invalid server.trusted_proxies: %v", err)
+		r.SetTrustedProxies(config.DefaultTrustedProxies)
+	}
+	switch strings.ToLower(cfg.Server.TrustedPlatform) {
+	case "":
+	case "cloudflare":
+		r.TrustedPlatform = gin.PlatformCloudflare
+	case "google":
+		r.TrustedPlatform = gin.PlatformGoogleAppEngine
+	default:
+		r.TrustedPlatform = cfg.Server.TrustedPlatform
+	}
+
+	// Request IP blocklist: downloaded lists plus admin allow/deny/country
+	// entries, held in memory and reloaded when they change
+	ipBlocklist := service.NewIPBlocklistService(dualDB.Server)
+	go ipBlocklist.RunReloader(5 * time.Minute)
+
+	// SQLite: ship the WAL of both databases to the replication target for
+	// point-in-time restore
+	var replicators []*backup.Replicator
+	var replicationStore objectstore.Store
+	if replication := cfg.Server.Maintenance.Backup.Replication; replication.Enabled {
+		if dualDB.Dialect != database.DialectSQLite {
+			appLogger.Warn("Backup replication only supports SQLite; disabled for %s", dualDB.Dialect)
+		} else if replicationStore, err = objectstore.Open(replication.ObjectStore()); err != nil {
+			appLogger.Error("Failed to open backup replication target: %v", err)
+		} else {
+			replicators, err = backup.StartReplication(filepath.Join(dirPaths.Data, "db"), backup.ReplicationOptions{
+				Store:            replicationStore,
+				SyncInterval:     time.Duration(replication.SyncInterval) * time.Second,
+				SnapshotInterval: time.Duration(replication.SnapshotInterval) * time.Hour,
+				Retention:        time.Duration(replication.Retention) * time.Hour,
+			})
+			if err != nil {
+				appLogger.Error("Failed to start backup replication: %v", err)
+			} else {
+				appLogger.Info("Backup replication to %s started", replicationStore)
+			}
+			for _, r := range replicators {
+				defer r.Close()
+			}
+		}
+	}
 
 	// AI.md PART 5: Middleware order - security first!
 	// 1. URL normalization (FIRST - normalize before anything else)
@@ -429,6 +539,9 @@ func main() {
 	// Request ID middleware - for request tracing in logs
 	r.Use(middleware.RequestID())
 
+	// Reject blocklisted client addresses before any further work
+	r.Use(middleware.IPBlocklist(ipBlocklist, auditLogger))
+
 	// Access logging middleware (writes to log files)
 	r.Use(middleware.AccessLogger(appLogger))
 
@@ -437,7 +550,8 @@ func main() {
 
 	// Response compression per AI.md PART 18 lines 15704-15719
 	// Compresses text/html, text/css, application/json, etc.
-	r.Use(gzip.Gzip(gzip.DefaultCompression))
+	// The SSE stream is excluded: the gzip writer buffers and would hold back events
+	r.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{cfg.GetAPIPath() + "/events"})))
 
 	// Prometheus metrics middleware (AI.md PART 21 - NON-NEGOTIABLE)
 	r.Use(middleware.MetricsMiddleware())
@@ -638,9 +752,41 @@ func main() {
 
 	// Initialize GeoIP service (downloads database on first run, updates weekly)
 	geoipService := service.NewGeoIPService(dirPaths.Config)
+	ipBlocklist.SetGeoIP(geoipService)
+
+	// Account security: breached password checks against the local dataset,
+	// lockout auditing and new-device login alerts
+	pwnedPasswords := service.NewPwnedPasswordService(filepath.Join(dirPaths.Data, "pwned-passwords"))
+	accountSecurity := service.NewAccountSecurityService(dualDB.Users, dualDB.Server, pwnedPasswords)
+	accountSecurity.SetGeoIP(geoipService)
+	accountSecurity.SetAudit(auditLogger)
+	handler.SetAccountSecurity(accountSecurity)
+
+	// Retention policy per data class, "download my data" exports and
+	// verified account erasure
+	privacyService := service.NewPrivacyService(dualDB.Users, dualDB.Server, filepath.Join(dirPaths.Data, "exports"))
+	if err := privacyService.SetPolicy(service.RetentionPolicy(cfg.Server.Privacy.Retention), cfg.Server.Privacy.DeletionLinkHours); err != nil {
+		log.Printf("⚠️  server.privacy.retention: %v", err)
+	}
+	privacyService.SetAudit(auditLogger)
+	handler.SetPrivacy(privacyService)
 
 	weatherService := service.NewWeatherService(locationEnhancer, geoipService)
 
+	// Hourly observation archive of saved and popular locations
+	observationCfg := cfg.Weather.Observations
+	observationService := service.NewObservationService(dualDB.Server, dualDB.Users, weatherService)
+	observationService.SetPolicy(service.ObservationPolicy{
+		PopularLocations:    observationCfg.PopularLocations,
+		HourlyDays:          observationCfg.HourlyDays,
+		DailyDays:           observationCfg.DailyDays,
+		ForecastHistoryDays: observationCfg.ForecastHistoryDays,
+	})
+	// Forecasts served for recorded sites are kept for verification
+	if observationCfg.Enabled {
+		weatherService.SetForecastRecorder(observationService)
+	}
+
 	// Data loads automatically in the background via loadData()
 	// Mark service as ready after 2 minute initialization timeout (keep as fallback)
 	go func() {
@@ -703,14 +849,16 @@ func main() {
 		cfg.Server.RateLimit = newCfg.Server.RateLimit
 		cfg.Server.Tor = newCfg.Server.Tor
 		cfg.Server.Features = newCfg.Server.Features
+		cfg.Server.Auth = newCfg.Server.Auth
 
 		// Update global config for handlers
 		config.SetGlobalConfig(cfg)
+		middleware.ReloadRateLimitPolicy()
 
 		// Note: Port changes would require graceful restart (not implemented yet)
 		// For now, port changes require manual restart
 
-		log.Println("✅ All configuration sections reloaded (branding, SEO, theme, email, notifications, rate limiting, web, Tor, features)")
+		log.Println("✅ All configuration sections reloaded (branding, SEO, theme, email, notifications, rate limiting, web, Tor, features, auth)")
 		fmt.Println("✅ All configuration sections reloaded successfully")
 
 		return nil
@@ -721,29 +869,41 @@ func main() {
 	}
 
 	// Initialize scheduler for periodic tasks
-	taskScheduler := scheduler.NewScheduler(db.DB)
+	taskScheduler := scheduler.NewScheduler(db.DB, dataStore)
 
 	// Register log rotation task - AI.md PART 19: daily at midnight
 	taskScheduler.AddTask("rotate-logs", "0 0 * * *", func() error {
+		if auditLogger != nil {
+			if err := auditLogger.Rotate(); err != nil {
+				return err
+			}
+		}
 		return appLogger.RotateLogs()
 	})
 
 	// Register cleanup tasks - AI.md PART 19: session cleanup every 15 minutes
 	taskScheduler.AddTask("cleanup-sessions", "@every 15m", func() error {
-		return scheduler.CleanupOldSessions(db.DB)
+		return scheduler.CleanupOldSessions(dataStore)
 	})
 
 	// AI.md PART 19: token cleanup every 15 minutes
 	taskScheduler.AddTask("cleanup-tokens", "@every 15m", func() error {
-		return scheduler.CleanupExpiredTokens(db.DB)
+		return scheduler.CleanupExpiredTokens(dataStore)
 	})
 
 	taskScheduler.AddTask("cleanup-rate-limits", "@hourly", func() error {
 		return scheduler.CleanupRateLimitCounters(db.DB)
 	})
 
-	taskScheduler.AddTask("cleanup-audit-logs", "@daily", func() error {
-		return scheduler.CleanupOldAuditLogs(db.DB)
+	// Expire and cap client-registered GraphQL persisted queries
+	taskScheduler.AddTask("cleanup-persisted-queries", "@hourly", func() error {
+		return scheduler.CleanupPersistedQueries(dataStore)
+	})
+
+	// Audit log, activity, devices, notifications, token usage, contact
+	// submissions and data exports past their server.privacy.retention
+	taskScheduler.AddTask("data-retention", "@daily", func() error {
+		return scheduler.EnforceDataRetention(privacyService)
 	})
 
 	// Register weather alert checks - run every 5 minutes per IDEA.md
@@ -761,15 +921,37 @@ func main() {
 		return deliverySystem.ProcessQueue()
 	})
 
-	// Register cleanup of old delivered notifications - daily
-	// Keep 30 days
-	taskScheduler.AddTask("cleanup-notifications", "@daily", func() error {
-		return deliverySystem.CleanupOld(30)
-	})
+	// Remote backup targets, GFS retention and restore drill results
+	// reported with the backup_complete/backup_failed emails
+	backupCfg := cfg.Server.Maintenance.Backup
+	backupDist := &scheduler.BackupDistribution{
+		Retention: backup.RetentionPolicy{
+			Hourly:  backupCfg.Retention.Hourly,
+			Daily:   backupCfg.Retention.Daily,
+			Weekly:  backupCfg.Retention.Weekly,
+			Monthly: backupCfg.Retention.Monthly,
+		},
+		Notify: scheduler.BackupEmailNotifier(smtpService, taskScheduler.NextRun),
+	}
+	for _, t := range backupCfg.Targets {
+		store, err := objectstore.Open(t.ObjectStore())
+		if err != nil {
+			appLogger.Error("Backup target %s disabled: %v", t.DisplayName(), err)
+			continue
+		}
+		target := scheduler.BackupTarget{Name: t.DisplayName(), Store: store, ChunkSize: t.ChunkSize << 20}
+		for _, schedule := range []string{"daily", "hourly"} {
+			if t.HasSchedule(schedule) {
+				target.Schedules = append(target.Schedules, schedule)
+			}
+		}
+		backupDist.Targets = append(backupDist.Targets, target)
+		appLogger.Info("Backup target %s (%s) for %s backups", target.Name, store, strings.Join(target.Schedules, ", "))
+	}
 
 	// AI.md PART 19: backup daily at 02:00
 	taskScheduler.AddTask("backup-daily", "0 2 * * *", func() error {
-		return scheduler.CreateSystemBackup(db.DB)
+		return scheduler.CreateSystemBackup(dataStore, backupDist)
 	})
 
 	// AI.md PART 19 line 27050: backup_hourly - hourly incremental (disabled by default)
@@ -782,22 +964,55 @@ func main() {
 		if p == nil {
 			return fmt.Errorf("failed to get paths for hourly backup")
 		}
-		return scheduler.BackupHourlyTask(p.ConfigDir, p.DataDir)()
+		return scheduler.BackupHourlyTask(p.ConfigDir, p.DataDir, backupDist)()
 	})
 
+	// Restore drill: restore the latest backup into a temporary directory
+	// and check it (disabled by default)
+	if backupCfg.Drill.Enabled {
+		schedule := backupCfg.Drill.Schedule
+		if schedule == "" {
+			schedule = "0 4 * * 0"
+		}
+		taskScheduler.AddTask("backup-drill", schedule, func() error {
+			p := paths.GetDefaultPaths("weather")
+			if p == nil {
+				return fmt.Errorf("failed to get paths for restore drill")
+			}
+			return scheduler.RestoreDrill(p.ConfigDir, p.DataDir, scheduler.BackupPassword(dataStore), backupCfg.Drill.Target, backupDist)
+		})
+	}
+
+	// Incremental snapshots of the selected backup sets into the
+	// deduplicating repository (disabled by default)
+	if backupCfg.Incremental.Enabled {
+		schedule := backupCfg.Incremental.Schedule
+		if schedule == "" {
+			schedule = "@hourly"
+		}
+		taskScheduler.AddTask("backup-snapshot", schedule, func() error {
+			p := paths.GetDefaultPaths("weather")
+			if p == nil {
+				return fmt.Errorf("failed to get paths for incremental snapshot")
+			}
+			return scheduler.BackupSnapshotTask(p.ConfigDir, p.DataDir, scheduler.BackupPassword(dataStore),
+				backupCfg.Incremental.Sets, backupCfg.Incremental.Target, backupDist)
+		})
+	}
+
 	// AI.md PART 19: SSL renewal check daily at 03:00
 	taskScheduler.AddTask("ssl-renewal", "0 3 * * *", func() error {
-		return scheduler.CheckSSLRenewal()
+		return scheduler.CheckSSLRenewal(dataStore)
 	})
 
 	// AI.md PART 19: self health check every 5 minutes
 	taskScheduler.AddTask("healthcheck-self", "@every 5m", func() error {
-		return scheduler.SelfHealthCheck()
+		return scheduler.SelfHealthCheck(dataStore)
 	})
 
 	// AI.md PART 19: Tor health check every 10 minutes (when Tor installed)
 	taskScheduler.AddTask("tor-health", "@every 10m", func() error {
-		return scheduler.CheckTorHealth()
+		return scheduler.CheckTorHealth(dataStore)
 	})
 
 	// Register weather cache refresh - run every 15 minutes per IDEA.md
@@ -805,6 +1020,14 @@ func main() {
 		return scheduler.RefreshWeatherCache(db.DB)
 	})
 
+	// Observations of saved and popular locations, daily aggregates and
+	// observation retention
+	if observationCfg.Enabled {
+		taskScheduler.AddTask("record-observations", "@hourly", func() error {
+			return scheduler.RecordObservations(observationService)
+		})
+	}
+
 	// Register GeoIP database update - AI.md PART 19: weekly Sunday at 03:00
 	taskScheduler.AddTask("update-geoip-database", "0 3 * * 0", func() error {
 		fmt.Println("🌍 Weekly GeoIP database update starting...")
@@ -817,12 +1040,29 @@ func main() {
 
 	// AI.md PART 19: blocklist update daily at 04:00
 	taskScheduler.AddTask("blocklist-update", "0 4 * * *", func() error {
-		return scheduler.UpdateBlocklist()
+		if err := scheduler.UpdateBlocklist(dataStore); err != nil {
+			return err
+		}
+		return ipBlocklist.Reload()
 	})
 
 	// AI.md PART 19: CVE database update daily at 05:00
 	taskScheduler.AddTask("cve-update", "0 5 * * *", func() error {
-		return scheduler.UpdateCVEDatabase()
+		return scheduler.UpdateCVEDatabase(dataStore)
+	})
+
+	// LDAP directory sync hourly: disables accounts removed from the directory
+	// or its allowed groups (no-op unless LDAP login is enabled)
+	taskScheduler.AddTask("ldap-sync", "@hourly", func() error {
+		ldapService := service.NewLDAPService(config.GetGlobalConfig().Server.Auth.LDAP)
+		result, err := service.SyncLDAPAccounts(ldapService, db.DB, database.GetServerDB())
+		if err != nil {
+			return err
+		}
+		if result.Disabled > 0 || result.RolesChanged > 0 {
+			log.Printf("LDAP sync: %d checked, %d disabled, %d roles changed", result.Checked, result.Disabled, result.RolesChanged)
+		}
+		return nil
 	})
 
 	// AI.md PART 19 line 24792: cluster.heartbeat every 30 seconds (cluster mode only)
@@ -832,15 +1072,9 @@ func main() {
 		nodeIDForHeartbeat = "default"
 	}
 	taskScheduler.AddTask("cluster-heartbeat", "@every 30s", func() error {
-		return scheduler.ClusterHeartbeat(nodeIDForHeartbeat)
+		return scheduler.ClusterHeartbeat(dataStore, nodeIDForHeartbeat)
 	})
 
-	// Initialize task history table for scheduler tracking
-	if err := taskScheduler.InitTaskHistoryTable(); err != nil {
-		fmt.Printf("❌ Failed to initialize task history table: %v\n", err)
-		log.Fatalf("Failed to initialize task history table: %v", err)
-	}
-
 	// Start the scheduler
 	taskScheduler.Start()
 
@@ -856,6 +1090,7 @@ func main() {
 	// Create handlers
 	weatherHandler := handler.NewWeatherHandler(weatherService, locationEnhancer)
 	apiHandler := handler.NewAPIHandler(weatherService, locationEnhancer)
+	observationHandler := handler.NewObservationHandler(observationService, weatherService)
 	webHandler := handler.NewWebHandler(weatherService, locationEnhancer)
 	earthquakeHandler := handler.NewEarthquakeHandler(earthquakeService, weatherService, locationEnhancer)
 	hurricaneHandler := handler.NewHurricaneHandler(hurricaneService)
@@ -863,27 +1098,125 @@ func main() {
 	moonHandler := handler.NewMoonHandler(weatherService, locationEnhancer)
 
 	// Create auth handlers
-	authHandler := &handler.AuthHandler{DB: db.DB}
-	authAPIHandler := handler.NewAuthAPIHandler(db.DB)
+	authHandler := &handler.AuthHandler{DB: db.DB, Store: dataStore}
+	authAPIHandler := handler.NewAuthAPIHandler(db.DB, dataStore)
 	twoFAHandler := &handler.TwoFactorHandler{DB: db.DB}
-	passkeyHandler := handler.NewPasskeyHandler(db.DB)
-	setupHandler := &handler.SetupHandler{DB: db.DB}
-	dashboardHandler := &handler.DashboardHandler{DB: db.DB}
-	adminHandler := &handler.AdminHandler{DB: db.DB}
+	passkeyHandler := handler.NewPasskeyHandler(db.DB, database.GetServerDB(), dataStore)
+	accountSecurityHandler := &handler.AccountSecurityHandler{DB: db.DB}
+	privacyHandler := &handler.PrivacyHandler{}
+	setupHandler := &handler.SetupHandler{DB: db.DB, Store: dataStore}
+	dashboardHandler := &handler.DashboardHandler{DB: db.DB, Store: dataStore}
+	adminHandler := &handler.AdminHandler{DB: db.DB, Store: dataStore}
 	serverDB := database.GetServerDB()
 	adminInviteService := service.NewAdminInviteService(serverDB, "")
 	userInviteModel := &models.UserInviteModel{DB: database.GetUsersDB()}
 	locationHandler := &handler.LocationHandler{
-		DB:               db.DB,
+		Store:            dataStore,
 		WeatherService:   weatherService,
 		LocationEnhancer: locationEnhancer,
 	}
+	orgHandler := handler.NewOrgHandler(db.DB)
 
 	// Initialize WebSocket Hub for real-time notifications (TEMPLATE.md Part 25)
 	wsHub := service.NewWebSocketHub()
 	// Start hub in goroutine
 	go wsHub.Run()
 
+	// Publish new earthquakes and severe weather alerts to the hub (GraphQL subscriptions)
+	hubEventFeed := service.NewHubEventFeed(wsHub, earthquakeService, severeWeatherService, dataStore, time.Minute)
+	go hubEventFeed.Run()
+
+	// Cluster mode: hub events and cache invalidations are exchanged over the
+	// event bus so clients connected to any node receive them (WebSocket,
+	// SSE, GraphQL). Backend: Redis, PostgreSQL LISTEN/NOTIFY or a polling
+	// table in the shared database.
+	var eventBus service.EventBus
+	clusterSettings := &models.SettingsModel{DB: serverDB}
+	if clusterSettings.GetBool("cluster.enabled", false) {
+		bus, err := service.NewEventBus(service.EventBusOptions{
+			Backend:     clusterSettings.GetString("cluster.event_bus", service.EventBusAuto),
+			NodeID:      nodeIDForHeartbeat,
+			Cache:       cacheManager,
+			PostgresDSN: cfg.GetPostgresDSN(),
+			DB:          serverDB,
+			Driver:      "sqlite",
+			Interval:    time.Second,
+		})
+		if err != nil {
+			appLogger.Error("Cluster event bus unavailable: %v", err)
+		} else {
+			service.NewHubClusterRelay(bus, wsHub, nodeIDForHeartbeat).Attach()
+			eventBus = bus
+		}
+	}
+
+	// In-process caches are invalidated on every node
+	cacheInvalidator := service.NewCacheInvalidator(eventBus)
+	cacheInvalidator.Register("weather", weatherService.LocalCache())
+	cacheInvalidator.Register("earthquakes", earthquakeService.LocalCache())
+
+	if eventBus != nil {
+		if err := eventBus.Start(); err != nil {
+			appLogger.Error("Failed to start cluster event bus (%s): %v", eventBus.Name(), err)
+		} else {
+			appLogger.Printf("Cluster event bus started (%s)", eventBus.Name())
+		}
+	}
+
+	// Rate limit counters are shared by every node using the same Redis or
+	// database; limits are re-read from settings as they change
+	rateLimitStore, err := service.NewRateLimitStore(service.RateLimitStoreOptions{
+		Backend: cfg.Server.RateLimit.Store,
+		Cache:   cacheManager,
+		DB:      serverDB,
+		Dialect: dualDB.Dialect,
+	})
+	if err != nil {
+		appLogger.Error("Rate limit store unavailable, counting per node: %v", err)
+		rateLimitStore = service.NewMemoryRateLimitStore()
+	}
+	middleware.ConfigureRateLimiting(rateLimitStore, clusterSettings)
+	appLogger.Printf("Rate limit store: %s", rateLimitStore.Name())
+
+	// Cluster mode: each node keeps its own database, so settings, templates,
+	// notification channels and certificates are replicated as versioned
+	// change sets between nodes (signed with cluster.secret and/or mTLS)
+	var configSync *cluster.ConfigSync
+	var clusterManager *cluster.ClusterManager
+	if clusterSettings.GetBool("cluster.enabled", false) {
+		clusterSecret := os.Getenv("CLUSTER_SECRET")
+		if clusterSecret == "" {
+			clusterSecret = clusterSettings.GetString("cluster.secret", "")
+		}
+		advertiseURL := clusterSettings.GetString("cluster.advertise_url", "")
+		syncer, err := cluster.NewConfigSync(serverDB, cluster.ConfigSyncOptions{
+			NodeID:       nodeIDForHeartbeat,
+			AdvertiseURL: advertiseURL,
+			JoinURL:      clusterSettings.GetString("cluster.join_url", ""),
+			Secret:       clusterSecret,
+			CAFile:       clusterSettings.GetString("cluster.tls.ca_file", ""),
+			CertFile:     clusterSettings.GetString("cluster.tls.cert_file", ""),
+			KeyFile:      clusterSettings.GetString("cluster.tls.key_file", ""),
+			SSLDir:       utils.GetCertsPath(dirPaths),
+			APIPath:      cfg.GetAPIPath(),
+		})
+		if err != nil {
+			appLogger.Error("Cluster config sync unavailable: %v", err)
+		} else {
+			configSync = syncer
+			clusterManager = cluster.NewClusterManager(serverDB, nodeIDForHeartbeat, advertiseURL, true)
+			clusterManager.SetConfigSync(configSync)
+			go func() {
+				if err := clusterManager.Start(); err != nil {
+					appLogger.Error("Failed to start cluster manager: %v", err)
+				}
+			}()
+		}
+	}
+	clusterSyncHandler := handler.NewClusterSyncHandler(configSync, clusterManager)
+	failoverHandler := &handler.DatabaseFailoverHandler{Managers: failoverManagers, Audit: auditLogger}
+	replicationHandler := &handler.BackupReplicationHandler{Replicators: replicators, Store: replicationStore}
+
 	// Initialize Notification Service (TEMPLATE.md Part 25 - WebUI Notifications)
 	notificationService := &service.NotificationService{
 		UserDB:     dualDB.Users,
@@ -901,15 +1234,15 @@ func main() {
 	}
 
 	adminSettingsHandler := &handler.AdminSettingsHandler{
-		DB:                  db.DB,
+		Store:               dataStore,
 		NotificationService: notificationService,
 	}
 
 	// Legacy notification handler (for email notifications only)
-	notificationHandler := &handler.NotificationHandler{DB: db.DB}
+	notificationHandler := &handler.NotificationHandler{Store: dataStore}
 
 	// Create notification system handlers
-	channelHandler := handler.NewNotificationChannelHandler(db.DB)
+	channelHandler := handler.NewNotificationChannelHandler(db.DB, dataStore)
 	preferencesHandler := handler.NewNotificationPreferencesHandler(db.DB)
 	templateHandler := handler.NewNotificationTemplateHandler(db.DB)
 	metricsHandler := handler.NewNotificationMetricsHandler(notificationMetrics)
@@ -932,16 +1265,21 @@ func main() {
 
 	// Create logs handler
 	logsHandler := handler.NewLogsHandler(dirPaths.Log)
+	if auditLogger != nil {
+		logsHandler.SetAuditPublicKey(auditLogger.PublicKey())
+	}
 
 	// Create admin settings handlers
 	adminUsersHandler := &handler.AdminUsersHandler{ConfigPath: configPath}
 	adminAuthHandler := &handler.AdminAuthSettingsHandler{ConfigPath: configPath}
-	adminWeatherHandler := &handler.AdminWeatherHandler{ConfigPath: configPath}
+	adminWeatherHandler := &handler.AdminWeatherHandler{ConfigPath: configPath, Observations: observationService}
 	adminNotificationsHandler := &handler.AdminNotificationsHandler{ConfigPath: configPath}
 	adminGeoIPHandler := &handler.AdminGeoIPHandler{ConfigPath: configPath}
+	adminBlocklistsHandler := handler.NewAdminBlocklistsHandler(dualDB.Server, ipBlocklist)
+	adminRolesHandler := handler.NewAdminRolesHandler(dualDB.Server, db.DB, auditLogger, r.Routes, cfg.GetAPIPath()+"/"+cfg.GetAdminPath())
 
 	// Create user settings handler (AI.md PART 34: Multi-user support)
-	userSettingsHandler := handler.NewUserSettingsHandler(db.DB)
+	userSettingsHandler := handler.NewUserSettingsHandler(db.DB, dataStore)
 
 	// Create user public handler (AI.md PART 34: Public profiles, avatars)
 	userPublicHandler := handler.NewUserPublicHandler(db.DB)
@@ -1524,6 +1862,10 @@ func main() {
 			})
 			return
 		}
+		// Organization invites also add the new account to the organization
+		if err := (&models.OrgModel{DB: db.DB}).JoinFromInvite(invite.ID, user.ID); err != nil {
+			log.Printf("Failed to add user %d to invited organization: %v", user.ID, err)
+		}
 
 		sessionModel := &models.SessionModel{DB: db.DB}
 		session, err := sessionModel.Create(user.ID, 2592000)
@@ -1552,24 +1894,16 @@ func main() {
 		c.Redirect(http.StatusSeeOther, "/users/dashboard")
 	})
 
-	// OIDC authentication routes (public)
-	r.GET("/auth/oidc/:provider", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "page/oidc_redirect.tmpl", utils.TemplateData(c, gin.H{
-			"title":    "OIDC Login",
-			"provider": c.Param("provider"),
-		}))
-	})
-	r.GET("/auth/oidc/:provider/callback", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "page/oidc_callback.tmpl", utils.TemplateData(c, gin.H{
-			"title":    "OIDC Callback",
-			"provider": c.Param("provider"),
-		}))
-	})
+	// OIDC authentication routes (public): user login, admin SSO and the
+	// shared callback registered with the provider
+	oidcHandler := handler.NewOIDCHandler(db.DB, serverDB, dataStore, service.NewOIDCService())
+	r.GET("/auth/oidc/:provider", oidcHandler.UserLogin)
+	r.GET("/auth/oidc/:provider/admin", oidcHandler.AdminLogin)
+	r.GET("/auth/oidc/:provider/callback", middleware.LoginRateLimitMiddleware(), oidcHandler.Callback)
 
 	// LDAP authentication route (public)
-	r.POST("/auth/ldap", func(c *gin.Context) {
-		c.JSON(http.StatusNotImplemented, gin.H{"error": "LDAP authentication not yet configured"})
-	})
+	ldapHandler := handler.NewLDAPHandler(db.DB, serverDB, dataStore)
+	r.POST("/auth/ldap", middleware.LoginRateLimitMiddleware(), ldapHandler.Login)
 
 	// User routes (require authentication) - per AI.md PART 14: /users/ is plural
 	usersRoutes := r.Group("/users")
@@ -1808,12 +2142,7 @@ func main() {
 		})
 
 		// /{admin_path}/server/roles - Role definitions
-		adminRoutes.GET("/server/roles", func(c *gin.Context) {
-			c.HTML(http.StatusOK, "admin/admin_roles.tmpl", utils.TemplateData(c, gin.H{
-				"title": "Role Definitions - Admin",
-				"page":  "server-roles",
-			}))
-		})
+		adminRoutes.GET("/server/roles", adminRolesHandler.ShowRolesPage)
 
 		// /{admin_path}/server/security/auth - Authentication config
 		adminRoutes.GET("/server/security/auth", adminAuthHandler.ShowAuthSettings)
@@ -2018,12 +2347,7 @@ func main() {
 		})
 
 		// /{admin_path}/server/network/blocklists - IP/domain blocklists
-		adminRoutes.GET("/server/network/blocklists", func(c *gin.Context) {
-			c.HTML(http.StatusOK, "admin/admin_blocklists.tmpl", utils.TemplateData(c, gin.H{
-				"title": "Blocklists - Admin",
-				"page":  "network-blocklists",
-			}))
-		})
+		adminRoutes.GET("/server/network/blocklists", adminBlocklistsHandler.ShowBlocklistsPage)
 
 		// /{admin_path}/server/maintenance - Maintenance mode
 		adminRoutes.GET("/server/maintenance", func(c *gin.Context) {
@@ -2043,12 +2367,7 @@ func main() {
 		})
 
 		// /{admin_path}/server/cluster/nodes - Cluster node management
-		adminRoutes.GET("/server/cluster/nodes", func(c *gin.Context) {
-			c.HTML(http.StatusOK, "admin/admin_cluster_nodes.tmpl", utils.TemplateData(c, gin.H{
-				"title": "Cluster Nodes - Admin",
-				"page":  "server-cluster-nodes",
-			}))
-		})
+		adminRoutes.GET("/server/cluster/nodes", clusterSyncHandler.ShowNodesPage)
 
 		// /{admin_path}/server/cluster/add - Add cluster node
 		adminRoutes.GET("/server/cluster/add", func(c *gin.Context) {
@@ -2105,36 +2424,47 @@ func main() {
 	weatherAPI := apiV1.Group("")
 	weatherAPI.Use(middleware.OptionalAuth(db.DB))
 	weatherAPI.Use(middleware.APIRateLimitMiddleware())
+	// Location-bound API tokens only see their saved location
+	weatherAPI.Use(middleware.BindTokenLocation(db.DB))
 	{
+		// Scopes only apply to API token requests
+		weatherScope := middleware.RequireTokenScope(models.ScopeWeatherRead)
+		alertsScope := middleware.RequireTokenScope(models.ScopeAlertsRead)
+
 		// Weather endpoints per AI.md PART 36
-		weatherAPI.GET("/weather", apiHandler.GetWeather)
-		weatherAPI.GET("/weather/:location", apiHandler.GetWeatherByLocation)
-		weatherAPI.GET("/weather/forecast", apiHandler.GetForecast)
-		weatherAPI.GET("/weather/locations", apiHandler.GetLocation)
+		weatherAPI.GET("/weather", weatherScope, apiHandler.GetWeather)
+		weatherAPI.GET("/weather/:location", weatherScope, apiHandler.GetWeatherByLocation)
+		weatherAPI.GET("/weather/forecast", weatherScope, apiHandler.GetForecast)
+		weatherAPI.GET("/weather/locations", weatherScope, apiHandler.GetLocation)
+
+		// Recorded observations of saved and popular locations
+		weatherAPI.GET("/observations", weatherScope, observationHandler.GetObservations)
+		weatherAPI.GET("/observations/summary", weatherScope, observationHandler.GetObservationSummary)
+		weatherAPI.GET("/observations/accuracy", weatherScope, observationHandler.GetForecastAccuracy)
 
 		// Backwards compatibility - old paths (deprecated)
-		weatherAPI.GET("/forecasts", apiHandler.GetForecast)
-		weatherAPI.GET("/forecasts/:location", apiHandler.GetForecastByLocation)
+		weatherAPI.GET("/forecasts", weatherScope, apiHandler.GetForecast)
+		weatherAPI.GET("/forecasts/:location", weatherScope, apiHandler.GetForecastByLocation)
 
 		// Additional endpoints
 		weatherAPI.GET("/ip", apiHandler.GetIP)
 		weatherAPI.GET("/docs", apiHandler.GetDocsJSON)
-		weatherAPI.GET("/earthquakes", earthquakeHandler.HandleEarthquakeAPI)
-		weatherAPI.GET("/earthquakes/:id", earthquakeHandler.HandleEarthquakeByIDAPI)
+		weatherAPI.GET("/earthquakes", alertsScope, earthquakeHandler.HandleEarthquakeAPI)
+		weatherAPI.GET("/earthquakes/:id", alertsScope, earthquakeHandler.HandleEarthquakeByIDAPI)
 		// Backwards compat
-		weatherAPI.GET("/hurricanes", hurricaneHandler.HandleHurricaneAPI)
-		weatherAPI.GET("/hurricanes/:id", hurricaneHandler.HandleHurricaneByIDAPI)
-		weatherAPI.GET("/severe-weather", severeWeatherHandler.HandleSevereWeatherAPI)
-		weatherAPI.GET("/severe-weather/:id", severeWeatherHandler.HandleAlertByIDAPI)
-		weatherAPI.GET("/moon", moonHandler.HandleMoonAPI)
-		weatherAPI.GET("/moon/calendar", moonHandler.HandleMoonCalendarAPI)
-		weatherAPI.GET("/sun", moonHandler.HandleSunAPI)
-		weatherAPI.GET("/history", apiHandler.GetHistoricalWeather)
+		weatherAPI.GET("/hurricanes", alertsScope, hurricaneHandler.HandleHurricaneAPI)
+		weatherAPI.GET("/hurricanes/:id", alertsScope, hurricaneHandler.HandleHurricaneByIDAPI)
+		weatherAPI.GET("/severe-weather", alertsScope, severeWeatherHandler.HandleSevereWeatherAPI)
+		weatherAPI.GET("/severe-weather/:id", alertsScope, severeWeatherHandler.HandleAlertByIDAPI)
+		weatherAPI.GET("/moon", weatherScope, moonHandler.HandleMoonAPI)
+		weatherAPI.GET("/moon/calendar", weatherScope, moonHandler.HandleMoonCalendarAPI)
+		weatherAPI.GET("/sun", weatherScope, moonHandler.HandleSunAPI)
+		weatherAPI.GET("/history", weatherScope, apiHandler.GetHistoricalWeather)
 
 		// CLI client compatibility aliases (IDEA.md endpoints)
-		weatherAPI.GET("/weather/alerts", severeWeatherHandler.HandleSevereWeatherAPI)
-		weatherAPI.GET("/weather/moon", moonHandler.HandleMoonAPI)
-		weatherAPI.GET("/weather/history", apiHandler.GetHistoricalWeather)
+		weatherAPI.GET("/weather/alerts", alertsScope, severeWeatherHandler.HandleSevereWeatherAPI)
+		weatherAPI.GET("/weather/moon", weatherScope, moonHandler.HandleMoonAPI)
+		weatherAPI.GET("/weather/history", weatherScope, apiHandler.GetHistoricalWeather)
 
 		// Root /api/{api_version} endpoint - return all endpoints
 		// AI.md PART 14: Never hardcode v1 - use cfg.GetAPIPath()
@@ -2193,6 +2523,8 @@ func main() {
 		authAPI.POST("/2fa", authAPIHandler.HandleAPI2FA)
 		authAPI.POST("/passkey/challenge", passkeyHandler.BeginPasskeyChallenge)
 		authAPI.POST("/passkey/verify", passkeyHandler.VerifyPasskey)
+		authAPI.POST("/passkey/register", passkeyHandler.RegisterPasswordless)
+		authAPI.POST("/passkey/recover", passkeyHandler.RecoverPasswordless)
 		authAPI.POST("/recovery/use", authAPIHandler.HandleAPIRecoveryUse)
 		authAPI.POST("/password/forgot", authAPIHandler.HandleAPIPasswordForgot)
 		authAPI.POST("/password/reset", authAPIHandler.HandleAPIPasswordReset)
@@ -2213,6 +2545,8 @@ func main() {
 	usersAPI := apiV1.Group("/users")
 	usersAPI.Use(middleware.RequireAuth(db.DB))
 	usersAPI.Use(middleware.BlockAdminFromUserRoutes())
+	// Account, token and security management need a full-access token
+	usersAPI.Use(middleware.RequireTokenScope(models.ScopeGlobal))
 	{
 		usersAPI.GET("", authHandler.GetCurrentUser)
 		usersAPI.PATCH("", authHandler.UpdateProfile)
@@ -2242,9 +2576,20 @@ func main() {
 		usersAPI.GET("/security/passkeys", passkeyHandler.ListPasskeys)
 		usersAPI.POST("/security/passkeys", passkeyHandler.RegisterPasskey)
 		usersAPI.DELETE("/security/passkeys/:passkey_id", passkeyHandler.DeletePasskey)
+		usersAPI.GET("/security/devices", accountSecurityHandler.ListDevices)
+		usersAPI.DELETE("/security/devices/:device_id", accountSecurityHandler.RevokeDevice)
 
 		// Password change per AI.md PART 34
 		usersAPI.POST("/security/password", userPublicHandler.ChangePassword)
+
+		// Download my data and delete my account
+		usersAPI.POST("/export", privacyHandler.RequestExport)
+		usersAPI.GET("/export", privacyHandler.GetExport)
+		usersAPI.GET("/export/:id/download", privacyHandler.DownloadExport)
+		usersAPI.POST("/account/delete", privacyHandler.RequestAccountDeletion)
+		usersAPI.GET("/account/delete", privacyHandler.GetAccountDeletion)
+		usersAPI.DELETE("/account/delete", privacyHandler.CancelAccountDeletion)
+		usersAPI.POST("/account/delete/confirm", privacyHandler.ConfirmAccountDeletion)
 	}
 
 	// Note: 2FA routes already registered under usersAPI (/users/security/2fa/*)
@@ -2263,6 +2608,7 @@ func main() {
 	// Protected location endpoints (require auth)
 	locationAPI := apiV1.Group("/locations")
 	locationAPI.Use(middleware.RequireAuth(db.DB))
+	locationAPI.Use(middleware.RequireTokenScopeByMethod(models.ScopeLocationsRead, models.ScopeLocationsWrite))
 	{
 		locationAPI.GET("", locationHandler.ListLocations)
 		locationAPI.GET("/:id", locationHandler.GetLocation)
@@ -2272,10 +2618,55 @@ func main() {
 		locationAPI.PUT("/:id/alerts", locationHandler.ToggleAlerts)
 	}
 
+	// Organization API routes: shared locations, alert subscriptions and
+	// channels. Organization tokens (org_) work for their own organization.
+	orgsAPI := apiV1.Group("/orgs")
+	orgsAPI.Use(middleware.OrgAuth(db.DB))
+	{
+		// Organization, member, invite and token management need a
+		// full-access token
+		manageScope := middleware.RequireTokenScope(models.ScopeGlobal)
+		locationsScope := middleware.RequireTokenScopeByMethod(models.ScopeLocationsRead, models.ScopeLocationsWrite)
+		alertsScope := middleware.RequireTokenScopeByMethod(models.ScopeNotificationsRead, models.ScopeGlobal)
+
+		orgsAPI.GET("", manageScope, orgHandler.ListOrgs)
+		orgsAPI.POST("", manageScope, orgHandler.CreateOrg)
+		orgsAPI.GET("/invites/:code", manageScope, orgHandler.GetInvite)
+		orgsAPI.POST("/invites/:code/accept", manageScope, orgHandler.AcceptInvite)
+
+		orgsAPI.GET("/:org_id", orgHandler.GetOrg)
+		orgsAPI.PATCH("/:org_id", manageScope, orgHandler.UpdateOrg)
+		orgsAPI.DELETE("/:org_id", manageScope, orgHandler.DeleteOrg)
+		orgsAPI.GET("/:org_id/members", manageScope, orgHandler.ListMembers)
+		orgsAPI.PATCH("/:org_id/members/:user_id", manageScope, orgHandler.UpdateMember)
+		orgsAPI.DELETE("/:org_id/members/:user_id", manageScope, orgHandler.RemoveMember)
+		orgsAPI.GET("/:org_id/invites", manageScope, orgHandler.ListInvites)
+		orgsAPI.POST("/:org_id/invites", manageScope, orgHandler.CreateInvite)
+		orgsAPI.DELETE("/:org_id/invites/:invite_id", manageScope, orgHandler.RevokeInvite)
+		orgsAPI.GET("/:org_id/tokens", manageScope, orgHandler.ListTokens)
+		orgsAPI.POST("/:org_id/tokens", manageScope, orgHandler.CreateToken)
+		orgsAPI.DELETE("/:org_id/tokens/:token_id", manageScope, orgHandler.RevokeToken)
+
+		orgsAPI.GET("/:org_id/locations", locationsScope, orgHandler.ListLocations)
+		orgsAPI.POST("/:org_id/locations", locationsScope, orgHandler.CreateLocation)
+		orgsAPI.GET("/:org_id/locations/:location_id", locationsScope, orgHandler.GetLocation)
+		orgsAPI.PUT("/:org_id/locations/:location_id", locationsScope, orgHandler.UpdateLocation)
+		orgsAPI.DELETE("/:org_id/locations/:location_id", locationsScope, orgHandler.DeleteLocation)
+
+		orgsAPI.GET("/:org_id/subscriptions", alertsScope, orgHandler.ListSubscriptions)
+		orgsAPI.POST("/:org_id/subscriptions", alertsScope, orgHandler.CreateSubscription)
+		orgsAPI.DELETE("/:org_id/subscriptions/:subscription_id", alertsScope, orgHandler.DeleteSubscription)
+		orgsAPI.GET("/:org_id/channels", alertsScope, orgHandler.ListChannels)
+		orgsAPI.POST("/:org_id/channels", alertsScope, orgHandler.CreateChannel)
+		orgsAPI.PUT("/:org_id/channels/:channel_id", alertsScope, orgHandler.UpdateChannel)
+		orgsAPI.DELETE("/:org_id/channels/:channel_id", alertsScope, orgHandler.DeleteChannel)
+	}
+
 	// WebUI Notification API routes - User (per AI.md PART 14: /users/ is plural)
 	usersNotificationAPI := apiV1.Group("/users/notifications")
 	usersNotificationAPI.Use(middleware.RequireAuth(db.DB))
 	usersNotificationAPI.Use(middleware.BlockAdminFromUserRoutes())
+	usersNotificationAPI.Use(middleware.RequireTokenScope(models.ScopeNotificationsRead))
 	{
 		usersNotificationAPI.GET("", notificationAPIHandler.GetUserNotifications)
 		usersNotificationAPI.GET("/unread", notificationAPIHandler.GetUserUnreadNotifications)
@@ -2296,6 +2687,8 @@ func main() {
 	adminAPI.Use(middleware.AdminRateLimitMiddleware())
 	// Log all admin API actions
 	adminAPI.Use(middleware.AuditLogger(db.DB))
+	// Every admin API route needs the permission its path maps to
+	adminAPI.Use(middleware.AdminRBAC(serverDB))
 	{
 		adminModel := &models.AdminModel{DB: serverDB}
 
@@ -2465,6 +2858,8 @@ func main() {
 		adminAPI.GET("/server/users", adminHandler.ListUsers)
 		adminAPI.PUT("/server/users/:id", adminHandler.UpdateUser)
 		adminAPI.DELETE("/server/users/:id", adminHandler.DeleteUser)
+		adminAPI.POST("/server/users/:id/unlock", accountSecurityHandler.UnlockUser)
+		adminAPI.GET("/server/privacy/retention", privacyHandler.RetentionReport)
 		adminAPI.GET("/server/users/invites", func(c *gin.Context) {
 			invites, err := userInviteModel.ListInvites()
 			if err != nil {
@@ -2612,12 +3007,18 @@ func main() {
 		adminAPI.POST("/server/users/settings", adminUsersHandler.UpdateUserSettings)
 		adminAPI.POST("/server/security/auth", adminAuthHandler.UpdateAuthSettings)
 		adminAPI.POST("/server/weather", adminWeatherHandler.UpdateWeatherSettings)
+		adminAPI.GET("/server/weather/verification", adminWeatherHandler.GetForecastVerification)
 		adminAPI.POST("/server/notifications", adminNotificationsHandler.UpdateNotificationSettings)
 		adminAPI.POST("/server/network/geoip", adminGeoIPHandler.UpdateGeoIPSettings)
 
+		// Request IP blocklists with per-list hit counts
+		adminAPI.GET("/server/network/blocklists", adminBlocklistsHandler.ListBlocklists)
+		adminAPI.POST("/server/network/blocklists/entries", adminBlocklistsHandler.CreateBlocklistEntry)
+		adminAPI.DELETE("/server/network/blocklists/entries/:id", adminBlocklistsHandler.DeleteBlocklistEntry)
+
 		// API token management under /server/security/
 		adminAPI.GET("/server/security/tokens", adminHandler.ListTokens)
-		adminAPI.POST("/server/security/tokens", adminHandler.GenerateToken)
+		adminAPI.POST("/server/security/tokens", handler.RequireAdminReauth(), adminHandler.GenerateToken)
 		adminAPI.DELETE("/server/security/tokens/:id", adminHandler.RevokeToken)
 
 		// Audit logs under /server/logs/
@@ -2858,6 +3259,12 @@ func main() {
 				"profile": updatedAdmin,
 			})
 		})
+		// Admin passkeys and step-up re-authentication for sensitive actions
+		adminAPI.GET("/profile/passkeys", passkeyHandler.ListAdminPasskeys)
+		adminAPI.POST("/profile/passkeys", passkeyHandler.RegisterAdminPasskey)
+		adminAPI.DELETE("/profile/passkeys/:passkey_id", passkeyHandler.DeleteAdminPasskey)
+		adminAPI.POST("/server/reauth/challenge", passkeyHandler.BeginAdminReauth)
+		adminAPI.POST("/server/reauth", passkeyHandler.AdminReauth)
 		adminAPI.POST("/profile/password", func(c *gin.Context) {
 			admin, ok := getCurrentAdmin(c)
 			if !ok {
@@ -2914,7 +3321,7 @@ func main() {
 				"token": maskAdminToken(admin.APITokenPrefix),
 			})
 		})
-		adminAPI.POST("/profile/token", func(c *gin.Context) {
+		adminAPI.POST("/profile/token", handler.RequireAdminReauth(), func(c *gin.Context) {
 			admin, ok := getCurrentAdmin(c)
 			if !ok {
 				return
@@ -2932,6 +3339,104 @@ func main() {
 				"token":   newToken,
 			})
 		})
+		// Scoped admin tokens for integrations (e.g. notifications:send
+		// or admin:backup only); managing them needs a global token
+		adminTokens := &models.TokenModelV2{DB: serverDB}
+		adminAPI.GET("/profile/tokens", func(c *gin.Context) {
+			admin, ok := getCurrentAdmin(c)
+			if !ok {
+				return
+			}
+
+			tokens, err := adminTokens.ListTokens(models.OwnerTypeAdmin, admin.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to list tokens"})
+				return
+			}
+			usageModel := &models.TokenUsageModel{DB: serverDB}
+			since := time.Now().Add(-7 * 24 * time.Hour)
+			items := make([]gin.H, 0, len(tokens))
+			for _, token := range tokens {
+				usage, _ := usageModel.Summary(models.OwnerTypeAdmin, token.ID, since)
+				items = append(items, gin.H{"token": token, "usage": usage})
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"ok":     true,
+				"tokens": items,
+				"scopes": models.TokenScopeCatalog,
+			})
+		})
+		adminAPI.POST("/profile/tokens", handler.RequireAdminReauth(), func(c *gin.Context) {
+			admin, ok := getCurrentAdmin(c)
+			if !ok {
+				return
+			}
+
+			var req struct {
+				Name       string `json:"name" binding:"required"`
+				Scopes     string `json:"scopes" binding:"required"`
+				ExpiresIn  int    `json:"expires_in"`
+				AllowedIPs string `json:"allowed_ips"`
+				RateLimit  int    `json:"rate_limit"`
+				DailyQuota int    `json:"daily_quota"`
+			}
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+				return
+			}
+
+			allowedIPs, err := models.ParseAllowedIPs(req.AllowedIPs)
+			if err == nil {
+				_, err = models.ParseScopes(req.Scopes)
+			}
+			restrictions := models.TokenRestrictions{
+				AllowedIPs:        allowedIPs,
+				RequestsPerMinute: req.RateLimit,
+				DailyQuota:        req.DailyQuota,
+			}
+			if err == nil {
+				err = restrictions.Validate()
+			}
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+				return
+			}
+
+			var expiration time.Duration
+			if req.ExpiresIn > 0 {
+				expiration = time.Duration(req.ExpiresIn) * 24 * time.Hour
+			}
+			token, err := adminTokens.CreateToken(models.OwnerTypeAdmin, admin.ID, req.Name, req.Scopes, expiration, restrictions)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to create token"})
+				return
+			}
+
+			c.JSON(http.StatusCreated, gin.H{
+				"ok":      true,
+				"message": "Token created. This token will only be shown once.",
+				"token":   token,
+			})
+		})
+		adminAPI.DELETE("/profile/tokens/:id", func(c *gin.Context) {
+			admin, ok := getCurrentAdmin(c)
+			if !ok {
+				return
+			}
+
+			id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid token ID"})
+				return
+			}
+			if err := adminTokens.DeleteToken(id, models.OwnerTypeAdmin, admin.ID); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "Token not found"})
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Token revoked"})
+		})
 		adminAPI.GET("/profile/preferences", func(c *gin.Context) {
 			admin, ok := getCurrentAdmin(c)
 			if !ok {
@@ -3241,15 +3746,26 @@ func main() {
 		adminAPI.POST("/server/database/test-config", handler.TestDatabaseConfigConnection)
 		adminAPI.POST("/server/database/optimize", handler.OptimizeDatabase)
 		adminAPI.POST("/server/database/vacuum", handler.VacuumDatabase)
-		adminAPI.POST("/server/cache/clear", handler.ClearCache)
+		adminAPI.GET("/server/database/failover", failoverHandler.GetFailoverStatus)
+		adminAPI.POST("/server/database/failover/:database/resolve", failoverHandler.ResolveReplayConflict)
+		adminAPI.POST("/server/database/failover/:database/dead-letters/:seq", failoverHandler.ResolveDeadLetter)
+		adminAPI.POST("/server/cache/clear", func(c *gin.Context) {
+			c.Set("cache", cacheManager)
+			c.Set("cache_invalidator", cacheInvalidator)
+			handler.ClearCache(c)
+		})
+
+		// Cluster nodes with config drift relative to this node
+		adminAPI.GET("/server/cluster/nodes", clusterSyncHandler.ListNodes)
 
 		// Backup management per spec: /api/{api_version}/{admin_path}/server/backup/
 		adminAPI.GET("/server/backup", handler.ListBackups)
 		adminAPI.POST("/server/backup", handler.CreateBackup)
+		adminAPI.GET("/server/backup/replication", replicationHandler.GetReplicationStatus)
 		adminAPI.GET("/server/backup/:id", handler.DownloadBackup)
 		adminAPI.DELETE("/server/backup/:id", handler.DeleteBackup)
 		adminAPI.GET("/server/backup/:id/download", handler.DownloadBackup)
-		adminAPI.POST("/server/backup/restore", handler.RestoreBackup)
+		adminAPI.POST("/server/backup/restore", handler.RequireAdminReauth(), handler.RestoreBackup)
 
 		// Template management under /server/
 		adminAPI.GET("/server/templates", templateHandler.ListTemplates)
@@ -3268,6 +3784,24 @@ func main() {
 		adminAPI.GET("/server/metrics/notifications/errors", metricsHandler.GetRecentErrors)
 		adminAPI.GET("/server/metrics/notifications/health", metricsHandler.GetHealthStatus)
 
+		// GraphQL persisted query allowlist management
+		adminGraphQLHandler := handler.NewAdminGraphQLHandler(serverDB)
+		adminAPI.GET("/server/graphql/persisted-queries", adminGraphQLHandler.ListPersistedQueries)
+		adminAPI.POST("/server/graphql/persisted-queries", adminGraphQLHandler.RegisterPersistedQuery)
+		adminAPI.DELETE("/server/graphql/persisted-queries/:hash", adminGraphQLHandler.DeletePersistedQuery)
+
+		// Roles, permissions and their assignment to admins and users
+		adminAPI.GET("/server/permissions", adminRolesHandler.ListPermissions)
+		adminAPI.GET("/server/roles", adminRolesHandler.ListRoles)
+		adminAPI.POST("/server/roles", adminRolesHandler.CreateRole)
+		adminAPI.GET("/server/roles/:name", adminRolesHandler.GetRole)
+		adminAPI.PUT("/server/roles/:name", adminRolesHandler.UpdateRole)
+		adminAPI.DELETE("/server/roles/:name", adminRolesHandler.DeleteRole)
+		adminAPI.GET("/server/roles/:name/preview", adminRolesHandler.PreviewRole)
+		adminAPI.GET("/server/admins/:id/roles", adminRolesHandler.GetAdminRoles)
+		adminAPI.PUT("/server/admins/:id/roles", adminRolesHandler.SetAdminRoles)
+		adminAPI.PUT("/server/users/:id/role", adminRolesHandler.SetUserRole)
+
 		// Tor hidden service management (AI.md PART 32)
 		// API per spec: /api/{api_version}/{admin_path}/server/tor/
 		torAPI := adminAPI.Group("/server/tor")
@@ -3313,6 +3847,8 @@ func main() {
 			logsAPI.GET("/audit/download", logsHandler.DownloadAuditLogs)
 			logsAPI.POST("/audit/search", logsHandler.SearchAuditLogs)
 			logsAPI.GET("/audit/stats", logsHandler.GetAuditStats)
+			logsAPI.GET("/audit/verify", logsHandler.VerifyAuditLogs)
+			logsAPI.GET("/audit/export", logsHandler.ExportAuditLogs)
 			logsAPI.GET("/stats", logsHandler.GetLogStats)
 			logsAPI.GET("/archives", logsHandler.ListArchivedLogs)
 			logsAPI.GET("/stream", logsHandler.StreamLogs)
@@ -3477,6 +4013,7 @@ func main() {
 	graphqlResolver := appgraphql.NewResolver(
 		dualDB.Server,
 		dualDB.Users,
+		dataStore,
 		weatherService,
 		apiHandler,
 		authHandler,
@@ -3490,12 +4027,13 @@ func main() {
 		hurricaneHandler,
 		severeWeatherHandler,
 		moonHandler,
+		wsHub,
 	)
 	graphqlServer := appgraphql.NewServer(graphqlResolver)
 
 	// Root-level endpoint required by AI.md PART 14.
 	r.POST("/graphql", appgraphql.GraphQLHandler(graphqlServer))
-	r.GET("/graphql", appgraphql.PlaygroundHandler("/graphql"))
+	r.GET("/graphql", appgraphql.GraphQLGetHandler(graphqlServer, "/graphql"))
 
 	// Temporary compatibility alias while remaining GraphQL consumers are updated.
 	graphqlAliasPath := cfg.GetAPIPath() + "/graphql"
@@ -3512,6 +4050,15 @@ func main() {
 	// Requires authentication for both users and admins
 	r.GET("/ws/notifications", middleware.OptionalAuth(db.DB), notificationAPIHandler.HandleWebSocketConnection)
 
+	// Server-Sent Events alternative for clients behind proxies that block WebSocket upgrades
+	eventsHandler := handler.NewEventsHandler(wsHub, serverDB, database.GetUsersDB())
+	r.GET(cfg.GetAPIPath()+"/events", middleware.OptionalAuth(db.DB), eventsHandler.StreamEvents)
+
+	// Node-to-node config sync; requests are authenticated by the handler
+	r.GET(cfg.GetAPIPath()+cluster.SyncChangesPath, clusterSyncHandler.GetChanges)
+	r.POST(cfg.GetAPIPath()+cluster.SyncChangesPath, clusterSyncHandler.PostChanges)
+	r.GET(cfg.GetAPIPath()+cluster.SyncDigestPath, clusterSyncHandler.GetDigest)
+
 	// Public /server/ pages (AI.md PART 14: /server/* are public, no auth required)
 	r.GET("/server", func(c *gin.Context) {
 		c.Redirect(http.StatusMovedPermanently, "/server/about")
@@ -3757,6 +4304,16 @@ JSON API:
 				}
 			}
 
+			// Leave the cluster so another node can take over as primary
+			if clusterManager != nil {
+				clusterManager.Stop()
+			}
+
+			// Stop the cluster event bus before its Redis connection closes
+			if eventBus != nil {
+				eventBus.Close()
+			}
+
 			// Close cache connection
 			if err := cacheManager.Close(); err != nil {
 				log.Printf("Cache shutdown error: %v", err)
@@ -3772,6 +4329,11 @@ JSON API:
 				fmt.Printf("⚠️  Server forced to shutdown: %v\n", err)
 			}
 
+			// Seal the audit log with a final signed checkpoint
+			if auditLogger != nil {
+				auditLogger.Close()
+			}
+
 			log.Println("Server exited gracefully")
 			fmt.Println("✅ Server exited gracefully")
 			return
@@ -3800,6 +4362,16 @@ JSON API:
 					}
 				}
 
+				// Leave the cluster so another node can take over as primary
+				if clusterManager != nil {
+					clusterManager.Stop()
+				}
+
+				// Stop the cluster event bus before its Redis connection closes
+				if eventBus != nil {
+					eventBus.Close()
+				}
+
 				// Close cache connection
 				if err := cacheManager.Close(); err != nil {
 					log.Printf("Cache shutdown error: %v", err)
@@ -3815,6 +4387,11 @@ JSON API:
 					fmt.Printf("⚠️  Server forced to shutdown: %v\n", err)
 				}
 
+				// Seal the audit log with a final signed checkpoint
+				if auditLogger != nil {
+					auditLogger.Close()
+				}
+
 				log.Println("Server exited gracefully")
 				fmt.Println("✅ Server exited gracefully")
 				return
@@ -3823,6 +4400,30 @@ JSON API:
 	}
 }
 
+// newAuditLogger opens the hash-chained audit log with checkpoints signed
+// by the server's audit key and the forwarders from server.audit.forward
+func newAuditLogger(cfg *config.AppConfig, dirPaths *utils.DirectoryPaths) (*service.AuditLogger, error) {
+	key, err := service.LoadAuditSigningKey(filepath.Join(dirPaths.Config, service.AuditSigningKeyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	opts := service.AuditLoggerOptions{
+		SigningKey:         key,
+		CheckpointEvery:    cfg.Server.Audit.CheckpointEvery,
+		CheckpointInterval: time.Duration(cfg.Server.Audit.CheckpointInterval) * time.Second,
+	}
+	for _, target := range cfg.Server.Audit.Forward {
+		forwarder, err := service.NewAuditForwarder(target.Format, target.Target)
+		if err != nil {
+			log.Printf("Audit forward %s skipped: %v", target.Target, err)
+			continue
+		}
+		opts.Forwarders = append(opts.Forwarders, forwarder)
+	}
+	return service.NewAuditLoggerWithOptions(dirPaths.Log, opts)
+}
+
 // apacheLoggingMiddleware logs requests in Apache2 combined format
 func apacheLoggingMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,240 @@
+// Package scheduler - remote backup targets, retention and restore drills
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/backup"
+	"github.com/apimgr/weather/src/backup/objectstore"
+	"github.com/apimgr/weather/src/config"
+)
+
+// remoteSyncTimeout bounds the upload of one backup schedule to one target
+const remoteSyncTimeout = time.Hour
+
+// BackupReport describes the outcome of a scheduled backup or restore drill
+type BackupReport struct {
+	// daily, hourly, snapshot or drill
+	Type      string
+	Filename  string
+	Size      int64
+	StartedAt time.Time
+	Duration  time.Duration
+	// The local backup directory and the targets that hold the backup
+	Locations []string
+	Err       error
+}
+
+// BackupTarget is a remote destination of scheduled backups
+type BackupTarget struct {
+	Name  string
+	Store objectstore.Store
+	// Backups uploaded here: daily, hourly
+	Schedules []string
+	// Upload chunk size in bytes; backup.DefaultChunkSize when 0
+	ChunkSize int
+}
+
+// BackupDistribution uploads scheduled backups to remote targets, applies
+// the retention policy and reports the outcome. A nil distribution keeps
+// backups local and reports nothing
+type BackupDistribution struct {
+	Targets   []BackupTarget
+	Retention backup.RetentionPolicy
+	// Called after every scheduled backup and restore drill; may be nil
+	Notify func(BackupReport)
+}
+
+func (d *BackupDistribution) retention() backup.RetentionPolicy {
+	if d == nil {
+		return backup.RetentionPolicy{}
+	}
+	return d.Retention
+}
+
+// Target returns the target called name
+func (d *BackupDistribution) Target(name string) *BackupTarget {
+	if d == nil {
+		return nil
+	}
+	for i := range d.Targets {
+		if d.Targets[i].Name == name {
+			return &d.Targets[i]
+		}
+	}
+	return nil
+}
+
+// complete uploads the backups of schedule to its targets once the local
+// backup at backupPath was created (or failed with createErr), and reports
+// the outcome
+func (d *BackupDistribution) complete(schedule string, started time.Time, backupPath string, createErr error) error {
+	report := BackupReport{Type: schedule, StartedAt: started, Err: createErr}
+	if createErr == nil {
+		report.Filename = filepath.Base(backupPath)
+		if info, err := os.Stat(backupPath); err == nil {
+			report.Size = info.Size()
+		}
+		report.Locations = []string{filepath.Dir(backupPath)}
+
+		var errs []error
+		for _, t := range d.targetsFor(schedule) {
+			ctx, cancel := context.WithTimeout(context.Background(), remoteSyncTimeout)
+			result, err := backup.SyncRemote(ctx, t.Store, filepath.Dir(backupPath), d.Retention, t.ChunkSize)
+			cancel()
+			if err != nil {
+				log.Printf("❌ Backup upload to %s failed: %v", t.Name, err)
+				errs = append(errs, fmt.Errorf("%s: %w", t.Name, err))
+				continue
+			}
+			log.Printf("✅ Backups synced to %s (%d uploaded, %d pruned)", t.Name, len(result.Uploaded), len(result.Pruned))
+			report.Locations = append(report.Locations, t.Name)
+		}
+		report.Err = errors.Join(errs...)
+	}
+	report.Duration = time.Since(started)
+	d.notify(report)
+	return report.Err
+}
+
+func (d *BackupDistribution) targetsFor(schedule string) []BackupTarget {
+	if d == nil {
+		return nil
+	}
+	var targets []BackupTarget
+	for _, t := range d.Targets {
+		if slices.Contains(t.Schedules, schedule) {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+func (d *BackupDistribution) notify(report BackupReport) {
+	if d != nil && d.Notify != nil {
+		d.Notify(report)
+	}
+}
+
+// RestoreDrill restores the latest backup from the target called
+// targetName (the local backup directory when empty) into a temporary
+// directory and checks it with Verify and the database integrity check
+func RestoreDrill(configDir, dataDir, password, targetName string, d *BackupDistribution) error {
+	started := time.Now()
+	opts := backup.DrillOptions{Password: password}
+	if targetName != "" {
+		target := d.Target(targetName)
+		if target == nil {
+			err := fmt.Errorf("restore drill: no backup target named %q", targetName)
+			d.notify(BackupReport{Type: "drill", StartedAt: started, Duration: time.Since(started), Err: err})
+			return err
+		}
+		opts.Store = target.Store
+	}
+
+	log.Println("🔄 Starting restore drill...")
+	ctx, cancel := context.WithTimeout(context.Background(), remoteSyncTimeout)
+	defer cancel()
+	result, err := backup.New(configDir, dataDir).Drill(ctx, opts)
+	report := BackupReport{Type: "drill", StartedAt: started, Duration: time.Since(started)}
+	if err != nil {
+		log.Printf("❌ Restore drill failed: %v", err)
+		report.Err = fmt.Errorf("restore drill: %w", err)
+		d.notify(report)
+		return report.Err
+	}
+	log.Printf("✅ Restore drill passed: %s from %s (%d databases checked)", result.Backup, result.Source, len(result.Databases))
+	report.Filename = result.Backup
+	report.Size = result.Size
+	report.Locations = []string{result.Source}
+	d.notify(report)
+	return nil
+}
+
+// BackupMailer sends a plain text email template, e.g. *service.SMTPService
+type BackupMailer interface {
+	SendTemplate(to, name string, vars map[string]string) error
+}
+
+// backupTasks maps report types to the scheduler task that runs them
+var backupTasks = map[string]string{
+	"daily":    "backup-daily",
+	"hourly":   "backup-hourly",
+	"drill":    "backup-drill",
+	"snapshot": "backup-snapshot",
+}
+
+// BackupEmailNotifier returns a Notify function that emails each report to
+// the admin with the backup_complete or backup_failed template, as far as
+// the notification settings allow. nextRun returns when a task runs next
+func BackupEmailNotifier(mailer BackupMailer, nextRun func(task string) time.Time) func(BackupReport) {
+	return func(report BackupReport) {
+		cfg := config.GetGlobalConfig()
+		if cfg == nil {
+			return
+		}
+		template, vars := backupEmail(report, cfg, nextRun)
+		if !cfg.Server.Notifications.EmailEvent(template) {
+			return
+		}
+		if err := mailer.SendTemplate(config.DefaultEmailAddress("admin", cfg), template, vars); err != nil {
+			log.Printf("⚠️  Failed to send %s email: %v", template, err)
+		}
+	}
+}
+
+// backupEmail returns the template and variables of the email for report
+func backupEmail(report BackupReport, cfg *config.AppConfig, nextRun func(string) time.Time) (string, map[string]string) {
+	backupType := map[string]string{
+		"daily":    "Daily backup",
+		"hourly":   "Hourly backup",
+		"drill":    "Restore drill",
+		"snapshot": "Incremental snapshot",
+	}[report.Type]
+	if backupType == "" {
+		backupType = report.Type
+	}
+	vars := map[string]string{
+		"backup_type": backupType,
+		"admin_url":   "https://" + cfg.Server.FQDN + "/" + cfg.GetAdminPath(),
+	}
+	if report.Err != nil {
+		vars["start_time"] = report.StartedAt.Format("2006-01-02 15:04:05 MST")
+		vars["error"] = report.Err.Error()
+		return "backup_failed", vars
+	}
+
+	vars["filename"] = report.Filename
+	vars["size"] = formatSize(report.Size)
+	vars["duration"] = report.Duration.Round(time.Second).String()
+	vars["backup_location"] = strings.Join(report.Locations, ", ")
+	vars["next_backup"] = "Not scheduled"
+	if nextRun != nil {
+		if next := nextRun(backupTasks[report.Type]); !next.IsZero() {
+			vars["next_backup"] = next.Format("2006-01-02 15:04:05 MST")
+		}
+	}
+	return "backup_complete", vars
+}
+
+// formatSize formats a byte count for people
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
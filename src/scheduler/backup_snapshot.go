@@ -0,0 +1,83 @@
+// Package scheduler - incremental snapshots into the deduplicating backup repository
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/apimgr/weather/src/backup"
+	"github.com/apimgr/weather/src/backup/objectstore"
+)
+
+// SnapshotRepository opens the backup repository on the target called
+// targetName, or the local repository in dataDir when empty
+func SnapshotRepository(ctx context.Context, dataDir, password, targetName string, d *BackupDistribution) (*backup.Repository, error) {
+	if targetName != "" {
+		target := d.Target(targetName)
+		if target == nil {
+			return nil, fmt.Errorf("no backup target named %q", targetName)
+		}
+		return backup.OpenRepository(ctx, target.Store, backup.RepositoryPrefix, password)
+	}
+	dir := backup.LocalRepositoryDir(dataDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	store, err := objectstore.NewFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	return backup.OpenRepository(ctx, store, "", password)
+}
+
+// BackupSnapshotTask stores a snapshot of the selected backup sets, only
+// uploading what changed, then forgets the snapshots outside the retention
+// policy and the chunks they alone used
+func BackupSnapshotTask(configDir, dataDir, password string, sets []string, targetName string, d *BackupDistribution) error {
+	started := time.Now()
+	report := BackupReport{Type: "snapshot", StartedAt: started}
+	fail := func(err error) error {
+		log.Printf("❌ Incremental snapshot failed: %v", err)
+		report.Err = fmt.Errorf("incremental snapshot: %w", err)
+		report.Duration = time.Since(started)
+		d.notify(report)
+		return report.Err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteSyncTimeout)
+	defer cancel()
+	repo, err := SnapshotRepository(ctx, dataDir, password, targetName, d)
+	if err != nil {
+		return fail(err)
+	}
+	result, err := repo.CreateSnapshot(ctx, backup.SnapshotOptions{
+		ConfigDir:  configDir,
+		DataDir:    dataDir,
+		Sets:       sets,
+		CreatedBy:  "scheduler",
+		AppVersion: "1.0.0",
+	})
+	if err != nil {
+		return fail(err)
+	}
+	log.Printf("✅ Snapshot %s stored in %s (%d new chunks, %s; %d files unchanged)",
+		result.Snapshot.ID, repo, result.NewChunks, formatSize(result.NewBytes), result.UnchangedFiles)
+
+	forgotten, err := repo.Forget(ctx, d.retention())
+	if err != nil {
+		return fail(fmt.Errorf("snapshot stored, but pruning failed: %w", err))
+	}
+	if len(forgotten.Snapshots) > 0 {
+		log.Printf("🧹 Forgot %d snapshots, freed %d chunks (%s)", len(forgotten.Snapshots), forgotten.Chunks, formatSize(forgotten.Bytes))
+	}
+
+	report.Filename = result.Snapshot.ID
+	report.Size = result.Snapshot.Size
+	report.Locations = []string{repo.String()}
+	report.Duration = time.Since(started)
+	d.notify(report)
+	return nil
+}
@@ -5,6 +5,7 @@ package scheduler
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/apimgr/weather/src/backup"
 	"github.com/apimgr/weather/src/paths"
@@ -55,7 +56,8 @@ func BackupTask(configDir, dataDir string) func() error {
 // BackupHourlyTask performs automated hourly incremental backups per AI.md PART 19 line 27050
 // Schedule: @hourly (disabled by default)
 // Creates: {projectname}-hourly.tar.gz[.enc] (single file, replaced each hour)
-func BackupHourlyTask(configDir, dataDir string) func() error {
+// and uploads it to the hourly backup targets of dist
+func BackupHourlyTask(configDir, dataDir string, dist *BackupDistribution) func() error {
 	return func() error {
 		log.Println("🔄 Starting hourly backup...")
 
@@ -73,16 +75,20 @@ func BackupHourlyTask(configDir, dataDir string) func() error {
 			IncludeData: false,
 			CreatedBy:   "scheduler-hourly",
 			AppVersion:  "1.0.0",
+			Retention:   dist.retention(),
 		}
 
+		started := time.Now()
 		backupPath, err := svc.Create(opts)
 		if err != nil {
 			log.Printf("❌ Hourly backup failed: %v", err)
-			return fmt.Errorf("hourly backup failed: %w", err)
+			err = fmt.Errorf("hourly backup failed: %w", err)
+			dist.complete("hourly", started, "", err)
+			return err
 		}
 
 		log.Printf("✅ Hourly backup completed: %s", backupPath)
-		return nil
+		return dist.complete("hourly", started, backupPath, nil)
 	}
 }
 
@@ -0,0 +1,40 @@
+// Package scheduler - observation archive of saved and popular locations
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/apimgr/weather/src/server/service"
+)
+
+// RecordObservations records the latest hours and the daily forecast of
+// saved and popular locations, writes the daily aggregates of completed
+// days and prunes observations past weather.observations retention
+func RecordObservations(observations *service.ObservationService) error {
+	ctx := context.Background()
+
+	run, err := observations.Record(ctx)
+	if err != nil {
+		return fmt.Errorf("record observations: %w", err)
+	}
+	if run.Sites > 0 {
+		log.Printf("🌡️  Recorded %d observations and %d forecasts for %d sites (%d failed)",
+			run.Observations, run.Forecasts, run.Sites, run.Failed)
+	}
+
+	if _, err := observations.Downsample(ctx); err != nil {
+		return fmt.Errorf("downsample observations: %w", err)
+	}
+
+	removed, err := observations.Prune(ctx)
+	if err != nil {
+		return fmt.Errorf("prune observations: %w", err)
+	}
+	if len(removed) > 0 {
+		log.Printf("🧹 Observation retention removed: %d hourly, %d daily, %d forecasts, %d sites",
+			removed["hourly"], removed["daily"], removed["forecasts"], removed["sites"])
+	}
+	return nil
+}
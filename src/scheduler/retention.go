@@ -0,0 +1,30 @@
+// Package scheduler - data retention across both databases
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/apimgr/weather/src/server/service"
+)
+
+// EnforceDataRetention deletes personal data older than the retention
+// period of its class (server.privacy.retention)
+func EnforceDataRetention(privacy *service.PrivacyService) error {
+	removed, err := privacy.EnforceRetention(context.Background())
+	if len(removed) > 0 {
+		classes := make([]string, 0, len(removed))
+		for class, n := range removed {
+			classes = append(classes, fmt.Sprintf("%s %d", class, n))
+		}
+		sort.Strings(classes)
+		log.Printf("🧹 Data retention removed: %s", strings.Join(classes, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("data retention: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,6 +22,8 @@ import (
 	"github.com/apimgr/weather/src/backup"
 	"github.com/apimgr/weather/src/database"
 	"github.com/apimgr/weather/src/paths"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
 	"github.com/robfig/cron/v3"
 )
 
@@ -46,6 +50,8 @@ var globalTasks = map[string]bool{
 	"cve-update":            true,
 	"backup-daily":          true,
 	"backup-hourly":         true,
+	"backup-drill":          true,
+	"backup-snapshot":       true,
 	"update-geoip-database": true,
 }
 
@@ -58,12 +64,13 @@ type Scheduler struct {
 	cron   *cron.Cron
 	tasks  map[string]*Task
 	db     *sql.DB
+	store  store.Store
 	nodeID string
 	mu     sync.RWMutex
 }
 
 // NewScheduler creates a new scheduler instance with robfig/cron
-func NewScheduler(db *sql.DB) *Scheduler {
+func NewScheduler(db *sql.DB, st store.Store) *Scheduler {
 	// Get node ID from hostname
 	nodeID, err := getNodeID()
 	if err != nil {
@@ -80,6 +87,7 @@ func NewScheduler(db *sql.DB) *Scheduler {
 		cron:   c,
 		tasks:  make(map[string]*Task),
 		db:     db,
+		store:  st,
 		nodeID: nodeID,
 	}
 }
@@ -271,9 +279,7 @@ func (s *Scheduler) executeTask(task *Task) {
 // logTaskExecution logs task execution to audit log
 func (s *Scheduler) logTaskExecution(taskName string, duration time.Duration, err error) {
 	// Check if audit logging is enabled
-	var auditEnabled string
-	queryErr := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'audit.enabled'").Scan(&auditEnabled)
-	if queryErr != nil || auditEnabled != "true" {
+	if !settingEnabled(s.store, "audit.enabled") {
 		return
 	}
 
@@ -294,6 +300,30 @@ func (s *Scheduler) logTaskExecution(taskName string, duration time.Duration, er
 	}
 }
 
+// settingValue returns a server setting, empty when it is unset or cannot
+// be read
+func settingValue(st store.Store, key string) string {
+	setting, err := st.GetSetting(context.Background(), key)
+	if err != nil {
+		return ""
+	}
+	return setting.Value
+}
+
+// settingInt returns an integer server setting, or def when unset or invalid
+func settingInt(st store.Store, key string, def int) int {
+	value, err := strconv.Atoi(settingValue(st, key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// settingEnabled reports whether a boolean server setting is on
+func settingEnabled(st store.Store, key string) bool {
+	return settingValue(st, key) == "true"
+}
+
 // GetTaskStatus returns status of all tasks
 func (s *Scheduler) GetTaskStatus() []map[string]interface{} {
 	s.mu.RLock()
@@ -322,73 +352,32 @@ func (s *Scheduler) GetTaskStatus() []map[string]interface{} {
 }
 
 // CleanupOldSessions removes expired sessions
-func CleanupOldSessions(db *sql.DB) error {
-	result, err := database.GetUsersDB().Exec("DELETE FROM user_sessions WHERE expires_at < datetime('now')")
+func CleanupOldSessions(st store.Store) error {
+	removed, err := st.DeleteExpiredSessions(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to cleanup sessions: %w", err)
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected > 0 {
-		log.Printf("🧹 Cleaned up %d expired sessions", rowsAffected)
-	}
-
-	return nil
-}
-
-// CleanupOldAuditLogs removes audit logs older than retention period
-func CleanupOldAuditLogs(db *sql.DB) error {
-	// Get retention days from settings
-	var retentionDays int
-	err := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'audit.retention_days'").Scan(&retentionDays)
-	if err != nil {
-		// Default to 90 days
-		retentionDays = 90
-	}
-
-	result, err := database.GetServerDB().Exec(`
-		DELETE FROM server_audit_log
-		WHERE created_at < datetime('now', '-' || ? || ' days')
-	`, retentionDays)
-
-	if err != nil {
-		return fmt.Errorf("failed to cleanup audit logs: %w", err)
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected > 0 {
-		log.Printf("🧹 Cleaned up %d old audit logs (retention: %d days)", rowsAffected, retentionDays)
+	if removed > 0 {
+		log.Printf("🧹 Cleaned up %d expired sessions", removed)
 	}
 
 	return nil
 }
 
 // CheckWeatherAlerts checks for weather alerts on saved locations
-func CheckWeatherAlerts(db *sql.DB) error {
+func CheckWeatherAlerts(st store.Store) error {
 	// Get all locations with alerts enabled
-	rows, err := database.GetUsersDB().Query(`
-		SELECT l.id, l.name, l.latitude, l.longitude, l.user_id
-		FROM user_saved_locations l
-		JOIN user_accounts u ON l.user_id = u.id
-		WHERE l.alerts_enabled = 1
-	`)
+	locations, err := st.ListAlertLocations(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to fetch locations: %w", err)
 	}
-	defer rows.Close()
 
 	alertCount := 0
 
-	for rows.Next() {
-		var locationID int
-		var name string
-		var latitude, longitude float64
-		var userID int
-
-		if err := rows.Scan(&locationID, &name, &latitude, &longitude, &userID); err != nil {
-			log.Printf("⚠️  Failed to scan location: %v", err)
-			continue
-		}
+	for _, location := range locations {
+		locationID, name, userID := location.ID, location.Name, location.UserID
+		latitude, longitude := location.Latitude, location.Longitude
 
 		// Fetch weather data from Open-Meteo API
 		url := fmt.Sprintf("https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&current=temperature_2m,wind_speed_10m,precipitation,weather_code&temperature_unit=fahrenheit&wind_speed_unit=mph&precipitation_unit=inch",
@@ -416,7 +405,7 @@ func CheckWeatherAlerts(db *sql.DB) error {
 		}
 
 		// Check for alert conditions and create notifications
-		created := checkAndCreateAlerts(db, userID, locationID, name, weatherData)
+		created := checkAndCreateAlerts(st, userID, locationID, name, weatherData)
 		alertCount += created
 	}
 
@@ -428,7 +417,7 @@ func CheckWeatherAlerts(db *sql.DB) error {
 }
 
 // checkAndCreateAlerts checks weather conditions and creates notifications
-func checkAndCreateAlerts(db *sql.DB, userID, locationID int, locationName string, weather struct {
+func checkAndCreateAlerts(st store.Store, userID, locationID int, locationName string, weather struct {
 	Current struct {
 		Temperature   float64 `json:"temperature_2m"`
 		WindSpeed     float64 `json:"wind_speed_10m"`
@@ -440,7 +429,7 @@ func checkAndCreateAlerts(db *sql.DB, userID, locationID int, locationName strin
 
 	// Check for extreme cold (below 32°F / 0°C)
 	if weather.Current.Temperature < 32 {
-		createNotification(db, userID, "alert", "⚠️ Freezing Temperature Alert",
+		createNotification(st, userID, models.NotificationTypeWarning, "⚠️ Freezing Temperature Alert",
 			fmt.Sprintf("%s: Temperature is %.1f°F. Bundle up!", locationName, weather.Current.Temperature),
 			fmt.Sprintf("/dashboard?location=%d", locationID))
 		alertCount++
@@ -448,7 +437,7 @@ func checkAndCreateAlerts(db *sql.DB, userID, locationID int, locationName strin
 
 	// Check for extreme heat (above 95°F / 35°C)
 	if weather.Current.Temperature > 95 {
-		createNotification(db, userID, "alert", "🌡️ Heat Alert",
+		createNotification(st, userID, models.NotificationTypeWarning, "🌡️ Heat Alert",
 			fmt.Sprintf("%s: Temperature is %.1f°F. Stay hydrated!", locationName, weather.Current.Temperature),
 			fmt.Sprintf("/dashboard?location=%d", locationID))
 		alertCount++
@@ -456,7 +445,7 @@ func checkAndCreateAlerts(db *sql.DB, userID, locationID int, locationName strin
 
 	// Check for high winds (above 40 mph)
 	if weather.Current.WindSpeed > 40 {
-		createNotification(db, userID, "warning", "💨 High Wind Alert",
+		createNotification(st, userID, models.NotificationTypeWarning, "💨 High Wind Alert",
 			fmt.Sprintf("%s: Wind speed is %.0f mph. Secure loose objects!", locationName, weather.Current.WindSpeed),
 			fmt.Sprintf("/dashboard?location=%d", locationID))
 		alertCount++
@@ -464,7 +453,7 @@ func checkAndCreateAlerts(db *sql.DB, userID, locationID int, locationName strin
 
 	// Check for heavy precipitation (above 0.5 inches)
 	if weather.Current.Precipitation > 0.5 {
-		createNotification(db, userID, "info", "🌧️ Heavy Rain Alert",
+		createNotification(st, userID, models.NotificationTypeInfo, "🌧️ Heavy Rain Alert",
 			fmt.Sprintf("%s: Heavy precipitation detected (%.1f in). Prepare for flooding!", locationName, weather.Current.Precipitation),
 			fmt.Sprintf("/dashboard?location=%d", locationID))
 		alertCount++
@@ -472,7 +461,7 @@ func checkAndCreateAlerts(db *sql.DB, userID, locationID int, locationName strin
 
 	// Check for severe weather codes (thunderstorms, snow, etc.)
 	if weather.Current.WeatherCode >= 95 {
-		createNotification(db, userID, "alert", "⛈️ Severe Weather Alert",
+		createNotification(st, userID, models.NotificationTypeWarning, "⛈️ Severe Weather Alert",
 			fmt.Sprintf("%s: Severe weather detected. Stay safe!", locationName),
 			fmt.Sprintf("/dashboard?location=%d", locationID))
 		alertCount++
@@ -481,13 +470,15 @@ func checkAndCreateAlerts(db *sql.DB, userID, locationID int, locationName strin
 	return alertCount
 }
 
-// createNotification creates a notification in the database
-func createNotification(db *sql.DB, userID int, notifType, title, message, link string) {
-	_, err := database.GetUsersDB().Exec(`
-		INSERT INTO user_notifications (user_id, type, title, message, link, read)
-		VALUES (?, ?, ?, ?, ?, 0)
-	`, userID, notifType, title, message, link)
-
+// createNotification creates a notification linking to the location
+func createNotification(st store.Store, userID int, notifType models.NotificationType, title, message, link string) {
+	err := st.CreateNotification(context.Background(), &models.Notification{
+		UserID:  &userID,
+		Type:    notifType,
+		Title:   title,
+		Message: message,
+		Action:  &models.NotificationAction{Label: "View", URL: link},
+	})
 	if err != nil {
 		log.Printf("⚠️  Failed to create notification: %v", err)
 	}
@@ -504,12 +495,11 @@ func RefreshWeatherCache(db *sql.DB) error {
 }
 
 // CreateSystemBackup creates a backup of the database
-// AI.md PART 19/25: backup_daily task - creates verified backups
-func CreateSystemBackup(db *sql.DB) error {
+// AI.md PART 19/25: backup_daily task - creates verified backups, then
+// uploads them to the daily backup targets of dist
+func CreateSystemBackup(st store.Store, dist *BackupDistribution) error {
 	// Get backup settings
-	var backupEnabled string
-	err := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'backup.enabled'").Scan(&backupEnabled)
-	if err != nil || backupEnabled != "true" {
+	if !settingEnabled(st, "backup.enabled") {
 		// Backups disabled, skip silently
 		return nil
 	}
@@ -523,9 +513,7 @@ func CreateSystemBackup(db *sql.DB) error {
 	// Create backup service per AI.md PART 25
 	svc := backup.New(p.ConfigDir, p.DataDir)
 
-	// Check for encryption password from settings
-	var encryptionPassword string
-	_ = database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'backup.encryption_password'").Scan(&encryptionPassword)
+	encryptionPassword := BackupPassword(st)
 
 	// Create backup with options per AI.md PART 25
 	opts := backup.BackupOptions{
@@ -537,49 +525,39 @@ func CreateSystemBackup(db *sql.DB) error {
 		IncludeData: false, // Don't include data files in automated backups
 		CreatedBy:   "scheduler",
 		AppVersion:  "1.0.0",
+		Retention:   dist.retention(),
 	}
 
 	log.Println("💾 Starting automated backup...")
+	started := time.Now()
 	backupPath, err := svc.Create(opts)
 	if err != nil {
 		log.Printf("❌ Automated backup failed: %v", err)
-		return fmt.Errorf("backup failed: %w", err)
+		err = fmt.Errorf("backup failed: %w", err)
+		dist.complete("daily", started, "", err)
+		return err
 	}
 
 	log.Printf("✅ Automated backup completed: %s", backupPath)
-	return nil
+	return dist.complete("daily", started, backupPath, nil)
+}
+
+// BackupPassword returns the encryption password of scheduled backups
+// from the server settings, empty when backups are not encrypted
+func BackupPassword(st store.Store) string {
+	return settingValue(st, "backup.encryption_password")
 }
 
-// CleanupExpiredTokens removes expired API and setup tokens
+// CleanupExpiredTokens removes expired user, admin and organization API tokens
 // AI.md PART 19: token cleanup every 15 minutes
-func CleanupExpiredTokens(db *sql.DB) error {
-	// Clean up expired API tokens
-	result, err := database.GetServerDB().Exec(`
-		DELETE FROM server_api_tokens
-		WHERE expires_at IS NOT NULL AND expires_at < datetime('now')
-	`)
+func CleanupExpiredTokens(st store.Store) error {
+	removed, err := st.DeleteExpiredTokens(context.Background())
 	if err != nil {
 		return fmt.Errorf("failed to cleanup expired API tokens: %w", err)
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected > 0 {
-		log.Printf("🧹 Cleaned up %d expired API tokens", rowsAffected)
-	}
-
-	// Clean up expired setup tokens
-	result2, err := database.GetServerDB().Exec(`
-		DELETE FROM server_setup_tokens
-		WHERE expires_at < datetime('now')
-	`)
-	if err != nil {
-		// Table may not exist, that's ok
-		return nil
-	}
-
-	rowsAffected2, _ := result2.RowsAffected()
-	if rowsAffected2 > 0 {
-		log.Printf("🧹 Cleaned up %d expired setup tokens", rowsAffected2)
+	if removed > 0 {
+		log.Printf("🧹 Cleaned up %d expired API tokens", removed)
 	}
 
 	return nil
@@ -587,19 +565,16 @@ func CleanupExpiredTokens(db *sql.DB) error {
 
 // CheckSSLRenewal checks if SSL certificates need renewal
 // AI.md PART 19: SSL renewal daily at 03:00, renew 7 days before expiry
-func CheckSSLRenewal() error {
+func CheckSSLRenewal(st store.Store) error {
 	// Check if SSL is enabled via Let's Encrypt
-	var sslEnabled string
-	err := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'ssl.letsencrypt.enabled'").Scan(&sslEnabled)
-	if err != nil || sslEnabled != "true" {
+	if !settingEnabled(st, "ssl.letsencrypt.enabled") {
 		// SSL not using Let's Encrypt, skip renewal
 		return nil
 	}
 
 	// Get the domain from settings
-	var domain string
-	domainErr := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'ssl.domain'").Scan(&domain)
-	if domainErr != nil || domain == "" {
+	domain := settingValue(st, "ssl.domain")
+	if domain == "" {
 		// No domain configured, skip
 		return nil
 	}
@@ -673,10 +648,9 @@ func CheckSSLRenewal() error {
 
 // SelfHealthCheck performs internal health verification
 // AI.md PART 19: healthcheck_self every 5 minutes
-func SelfHealthCheck() error {
-	// Check database connectivity
-	err := database.GetServerDB().Ping()
-	if err != nil {
+func SelfHealthCheck(st store.Store) error {
+	// Check server and users database connectivity
+	if err := st.Ping(context.Background()); err != nil {
 		log.Printf("⚠️ Self health check: database ping failed: %v", err)
 		return fmt.Errorf("database health check failed: %w", err)
 	}
@@ -696,21 +670,12 @@ func SelfHealthCheck() error {
 		}
 	}
 
-	// Check users database connectivity too
-	usersDB := database.GetUsersDB()
-	if usersDB != nil {
-		if err := usersDB.Ping(); err != nil {
-			log.Printf("⚠️ Self health check: users database ping failed: %v", err)
-			return fmt.Errorf("users database health check failed: %w", err)
-		}
-	}
-
 	return nil
 }
 
 // CheckTorHealth checks Tor service connectivity
 // AI.md PART 19: tor_health every 10 minutes, auto-restart if needed
-func CheckTorHealth() error {
+func CheckTorHealth(st store.Store) error {
 	// Check if Tor binary exists
 	torPath, err := exec.LookPath("tor")
 	if err != nil {
@@ -719,9 +684,7 @@ func CheckTorHealth() error {
 	}
 
 	// Check if Tor service is enabled
-	var torEnabled string
-	queryErr := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'tor.enabled'").Scan(&torEnabled)
-	if queryErr != nil || torEnabled != "true" {
+	if !settingEnabled(st, "tor.enabled") {
 		// Tor not enabled, skip
 		return nil
 	}
@@ -737,9 +700,7 @@ func CheckTorHealth() error {
 		log.Printf("⚠️ Tor health check: Tor process not running")
 
 		// Check if auto-restart is enabled
-		var restartOnFail string
-		queryErr := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'tor.restart_on_fail'").Scan(&restartOnFail)
-		if queryErr == nil && restartOnFail == "true" {
+		if settingEnabled(st, "tor.restart_on_fail") {
 			log.Printf("🧅 Attempting to restart Tor service...")
 			// Note: The actual restart is handled by TorService, we just log the status
 			// The TorService has its own monitoring loop that handles restarts
@@ -750,9 +711,7 @@ func CheckTorHealth() error {
 	}
 
 	// Check if onion address is configured (indicates successful Tor initialization)
-	var onionAddress string
-	addrErr := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'tor.onion_address'").Scan(&onionAddress)
-	if addrErr != nil || onionAddress == "" {
+	if settingValue(st, "tor.onion_address") == "" {
 		log.Printf("⚠️ Tor health check: No .onion address configured")
 		// This might be normal during startup, don't fail
 	}
@@ -760,12 +719,13 @@ func CheckTorHealth() error {
 	return nil
 }
 
-// CleanupRateLimitCounters resets rate limit counters
+// CleanupRateLimitCounters removes rate limit counters of windows that ended
 func CleanupRateLimitCounters(db *sql.DB) error {
-	// Reset hourly counters that are older than 1 hour
+	// A window's count is read until the next window ends; token daily quotas
+	// use one-day windows, so keep two days
 	result, err := database.GetServerDB().Exec(`
 		DELETE FROM server_rate_limits
-		WHERE window_start < datetime('now', '-1 hour')
+		WHERE window_start < datetime('now', '-2 days')
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to cleanup rate limits: %w", err)
@@ -779,15 +739,39 @@ func CleanupRateLimitCounters(db *sql.DB) error {
 	return nil
 }
 
+// CleanupPersistedQueries removes client-registered GraphQL persisted
+// queries unused for graphql.persisted_queries.apq_ttl_days and trims them to
+// the least recently used apq_max_entries. Admin-registered queries are kept.
+func CleanupPersistedQueries(st store.Store) error {
+	serverDB := database.GetServerDB()
+	if serverDB == nil {
+		return nil
+	}
+	ttlDays := settingInt(st, "graphql.persisted_queries.apq_ttl_days", models.DefaultAPQTTLDays)
+	maxEntries := settingInt(st, "graphql.persisted_queries.apq_max_entries", models.DefaultAPQMaxEntries)
+
+	var cutoff time.Time
+	if ttlDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -ttlDays)
+	}
+	pq := &models.PersistedQueryModel{DB: serverDB}
+	deleted, err := pq.PruneAPQ(cutoff, maxEntries)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		log.Printf("🧹 Pruned %d GraphQL persisted queries", deleted)
+	}
+	return nil
+}
+
 // UpdateBlocklist updates the IP blocklist database
 // AI.md PART 19: blocklist_update daily at 04:00
-func UpdateBlocklist() error {
+func UpdateBlocklist(st store.Store) error {
 	log.Println("🛡️ Updating IP blocklist database...")
 
 	// Check if blocklist is enabled
-	var blocklistEnabled string
-	err := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'security.blocklist.enabled'").Scan(&blocklistEnabled)
-	if err != nil || blocklistEnabled != "true" {
+	if !settingEnabled(st, "security.blocklist.enabled") {
 		// Blocklist not enabled, skip
 		return nil
 	}
@@ -801,24 +785,9 @@ func UpdateBlocklist() error {
 		{"spamhaus_edrop", "https://www.spamhaus.org/drop/edrop.txt"},
 	}
 
+	// server_ip_blocklist is created by server migration 0002
 	db := database.GetServerDB()
 
-	// Create table if not exists
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS server_ip_blocklist (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			source TEXT NOT NULL,
-			ip_range TEXT NOT NULL,
-			description TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE(source, ip_range)
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create blocklist table: %w", err)
-	}
-
 	client := &http.Client{Timeout: 30 * time.Second}
 	totalAdded := 0
 
@@ -883,39 +852,18 @@ func UpdateBlocklist() error {
 
 // UpdateCVEDatabase updates the CVE vulnerability database
 // AI.md PART 19: cve_update daily at 05:00
-func UpdateCVEDatabase() error {
+func UpdateCVEDatabase(st store.Store) error {
 	log.Println("🔒 Updating CVE database...")
 
 	// Check if CVE monitoring is enabled
-	var cveEnabled string
-	err := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'security.cve.enabled'").Scan(&cveEnabled)
-	if err != nil || cveEnabled != "true" {
+	if !settingEnabled(st, "security.cve.enabled") {
 		// CVE monitoring not enabled, skip
 		return nil
 	}
 
+	// server_cve_alerts is created by server migration 0002
 	db := database.GetServerDB()
 
-	// Create table if not exists
-	_, err = db.Exec(`
-		CREATE TABLE IF NOT EXISTS server_cve_alerts (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			cve_id TEXT NOT NULL UNIQUE,
-			description TEXT,
-			severity TEXT,
-			cvss_score REAL,
-			published_at DATETIME,
-			affected_packages TEXT,
-			references TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			acknowledged INTEGER DEFAULT 0
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create CVE table: %w", err)
-	}
-
 	// NVD API v2 - fetch recent CVEs (last 7 days)
 	// Using the public API (no API key required, but rate limited)
 	pubStartDate := time.Now().AddDate(0, 0, -7).Format("2006-01-02T15:04:05.000")
@@ -1006,18 +954,16 @@ func UpdateCVEDatabase() error {
 
 // ClusterHeartbeat sends a heartbeat to indicate this node is alive
 // AI.md PART 19 line 24792: cluster.heartbeat every 30 seconds (cluster mode only)
-func ClusterHeartbeat(nodeID string) error {
+func ClusterHeartbeat(st store.Store, nodeID string) error {
 	// Check if cluster mode is enabled
-	var clusterEnabled string
-	err := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'cluster.enabled'").Scan(&clusterEnabled)
-	if err != nil || clusterEnabled != "true" {
+	if !settingEnabled(st, "cluster.enabled") {
 		// Not in cluster mode, skip silently
 		return nil
 	}
 
 	// Update node heartbeat in cluster nodes table
 	// Per AI.md lines 22616-22620
-	_, err = database.GetServerDB().Exec(`
+	_, err := database.GetServerDB().Exec(`
 		INSERT INTO server_nodes (node_id, last_heartbeat, status)
 		VALUES (?, datetime('now'), 'online')
 		ON CONFLICT(node_id) DO UPDATE SET
@@ -1081,6 +1027,18 @@ func (s *Scheduler) TriggerTask(taskName string) error {
 	return nil
 }
 
+// NextRun returns when the task runs next, zero when it is unknown
+func (s *Scheduler) NextRun(taskName string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	task, ok := s.tasks[taskName]
+	if !ok {
+		return time.Time{}
+	}
+	return s.cron.Entry(task.entryID).Next
+}
+
 // GetTask returns a task by name
 func (s *Scheduler) GetTask(taskName string) *Task {
 	s.mu.RLock()
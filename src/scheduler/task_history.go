@@ -2,7 +2,6 @@ package scheduler
 
 import (
 	"database/sql"
-	"fmt"
 	"log"
 	"time"
 
@@ -35,27 +34,6 @@ type TaskInfo struct {
 	ErrorCount   int        `json:"error_count"`
 }
 
-// InitTaskHistoryTable creates the server_scheduler_history table if it doesn't exist
-func (s *Scheduler) InitTaskHistoryTable() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS server_scheduler_history (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		task_name TEXT NOT NULL,
-		start_time DATETIME NOT NULL,
-		end_time DATETIME NOT NULL,
-		duration_ms INTEGER NOT NULL,
-		status TEXT NOT NULL,
-		error TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	);
-	CREATE INDEX IF NOT EXISTS idx_server_scheduler_history_name ON server_scheduler_history(task_name);
-	CREATE INDEX IF NOT EXISTS idx_server_scheduler_history_start ON server_scheduler_history(start_time DESC);
-	`
-
-	_, err := database.GetServerDB().Exec(query)
-	return err
-}
-
 // RecordTaskRun records a task execution in the database
 func (s *Scheduler) RecordTaskRun(taskName string, startTime, endTime time.Time, err error) error {
 	duration := endTime.Sub(startTime).Milliseconds()
@@ -197,8 +175,8 @@ func (s *Scheduler) CleanupOldTaskHistory(days int) error {
 
 	result, err := database.GetServerDB().Exec(`
 		DELETE FROM server_scheduler_history
-		WHERE start_time < datetime('now', ?)
-	`, fmt.Sprintf("-%d days", days))
+		WHERE start_time < datetime('now', '-' || ? || ' days')
+	`, days)
 
 	if err != nil {
 		return err
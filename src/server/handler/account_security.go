@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/apimgr/weather/src/server/middleware"
+	models "github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	accountSecurity      *service.AccountSecurityService
+	accountSecurityMutex sync.RWMutex
+)
+
+// SetAccountSecurity sets the service used for breached password checks,
+// lockout auditing and login alerts
+func SetAccountSecurity(s *service.AccountSecurityService) {
+	accountSecurityMutex.Lock()
+	defer accountSecurityMutex.Unlock()
+	accountSecurity = s
+}
+
+// getAccountSecurity returns the service, nil when it was never set. The
+// service's methods are nil-safe.
+func getAccountSecurity() *service.AccountSecurityService {
+	accountSecurityMutex.RLock()
+	defer accountSecurityMutex.RUnlock()
+	return accountSecurity
+}
+
+// requestLoginContext describes the request a login came from
+func requestLoginContext(c *gin.Context) service.LoginContext {
+	return service.LoginContext{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		AppURL:    utils.GetHostInfo(c).FullHost,
+	}
+}
+
+// checkNewPassword rejects a password being set when it appears in the
+// breached password dataset
+func checkNewPassword(password string) error {
+	return getAccountSecurity().CheckNewPassword(password)
+}
+
+// credentialError maps a VerifyCredentials error to the message the login
+// endpoints return. Lock errors are passed through for respondAccountLocked.
+func credentialError(err error, login service.LoginContext) error {
+	var locked *models.AccountLockedError
+	if errors.As(err, &locked) {
+		if locked.Started {
+			if user, uerr := (&models.UserModel{}).GetByID(locked.UserID); uerr == nil {
+				getAccountSecurity().AccountLocked(user, locked.Until, login)
+			}
+		}
+		return err
+	}
+
+	switch {
+	case err.Error() == "account is disabled":
+		return fmt.Errorf("Account is disabled")
+	case strings.HasPrefix(err.Error(), "account is banned"):
+		return fmt.Errorf("Account is suspended")
+	default:
+		return fmt.Errorf("Invalid credentials")
+	}
+}
+
+// respondAccountLocked answers a login for a locked account with 429 and
+// Retry-After, returning false when err is not a lock
+func respondAccountLocked(c *gin.Context, err error) bool {
+	var locked *models.AccountLockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter().Seconds())))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"ok":          false,
+		"error":       "Too many failed login attempts. Try again later",
+		"retry_after": int(locked.RetryAfter().Seconds()),
+	})
+	return true
+}
+
+// notePasswordVerified checks an accepted login password against the
+// breached password dataset
+func notePasswordVerified(user *models.User, password string, login service.LoginContext) {
+	getAccountSecurity().PasswordVerified(user, password, login)
+}
+
+// noteLoginSucceeded records the login's device and sends login alerts in
+// the background so GeoIP lookups do not delay the response
+func noteLoginSucceeded(user *models.User, login service.LoginContext) {
+	s := getAccountSecurity()
+	if s == nil {
+		return
+	}
+	go func() {
+		if _, err := s.LoginSucceeded(user, login); err != nil {
+			log.Printf("Failed to record login device for user %d: %v", user.ID, err)
+		}
+	}()
+}
+
+// AccountSecurityHandler handles the trusted device list
+type AccountSecurityHandler struct {
+	DB *sql.DB
+}
+
+// ListDevices handles GET /api/v1/users/security/devices
+func (h *AccountSecurityHandler) ListDevices(c *gin.Context) {
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Not authenticated"})
+		return
+	}
+
+	devices, err := (&models.UserDeviceModel{DB: h.DB}).ListByUser(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to load devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"devices": devices,
+	})
+}
+
+// RevokeDevice handles DELETE /api/v1/users/security/devices/:device_id
+func (h *AccountSecurityHandler) RevokeDevice(c *gin.Context) {
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Not authenticated"})
+		return
+	}
+
+	deviceID, err := strconv.ParseInt(strings.TrimSpace(c.Param("device_id")), 10, 64)
+	if err != nil || deviceID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid device id"})
+		return
+	}
+
+	if s := getAccountSecurity(); s != nil {
+		err = s.RevokeDevice(user, deviceID, requestLoginContext(c))
+	} else {
+		err = (&models.UserDeviceModel{DB: h.DB}).Delete(user.ID, deviceID)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "Device not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to remove device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"message": "Device removed",
+	})
+}
+
+// UnlockUser handles POST /api/v1/{admin_path}/server/users/:id/unlock,
+// lifting a failed-login lock early
+func (h *AccountSecurityHandler) UnlockUser(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || userID <= 0 {
+		BadRequest(c, "Invalid user ID")
+		return
+	}
+
+	if _, err := (&models.UserModel{DB: h.DB}).GetByID(userID); err != nil {
+		NotFound(c, "User not found")
+		return
+	}
+	if err := (&models.LoginStateModel{DB: h.DB}).Unlock(userID); err != nil {
+		InternalError(c, "Failed to unlock user")
+		return
+	}
+
+	RespondSuccess(c, "User unlocked")
+}
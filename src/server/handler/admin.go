@@ -2,27 +2,29 @@ package handler
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
-	"github.com/apimgr/weather/src/database"
 	"github.com/apimgr/weather/src/server/middleware"
 	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/server/store"
 	"github.com/apimgr/weather/src/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AdminHandler struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Store store.Store
 }
 
 // User Management APIs
 
 func (h *AdminHandler) ListUsers(c *gin.Context) {
-	userModel := &models.UserModel{DB: h.DB}
-	users, err := userModel.GetAll()
+	users, err := h.Store.ListUsers(c.Request.Context(), 10000, 0)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
@@ -97,8 +99,30 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 	// Normalize username
 	username := utils.NormalizeUsername(req.Username)
 
-	userModel := &models.UserModel{DB: h.DB}
-	if err := userModel.Update(id, username, req.Email, req.Role); err != nil {
+	user, err := h.Store.GetUserByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Changing a role grants permissions, so it needs roles.write
+	if req.Role != user.Role {
+		if !middleware.HasPermission(c, models.PermRolesWrite) {
+			Forbidden(c, "changing a role needs the "+models.PermRolesWrite+" permission")
+			return
+		}
+		if !canAssignUserRole(c, &models.RoleModel{}, user.Role, req.Role) {
+			return
+		}
+	}
+
+	user.Username = username
+	user.Email = req.Email
+	user.Role = req.Role
+	if err := h.Store.UpdateUser(c.Request.Context(), user); err != nil {
+		if RespondWriteQueued(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
 		return
 	}
@@ -120,8 +144,34 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	userModel := &models.UserModel{DB: h.DB}
-	if err := userModel.Delete(id); err != nil {
+	// Erase the account from both databases when the privacy service runs
+	if s := getPrivacy(); s != nil {
+		_, err := s.EraseUser(c.Request.Context(), id, service.Actor{
+			Type:      "admin",
+			ID:        strconv.FormatInt(currentUser.ID, 10),
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrAccountNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			case errors.Is(err, models.ErrLastOrgOwner):
+				c.JSON(http.StatusConflict, gin.H{"error": "User is the last owner of an organization with other members"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
+			}
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+		return
+	}
+
+	if err := h.Store.DeleteUser(c.Request.Context(), id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
@@ -145,6 +195,11 @@ func (h *AdminHandler) UpdateUserPassword(c *gin.Context) {
 		return
 	}
 
+	if err := checkNewPassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	userModel := &models.UserModel{DB: h.DB}
 	if err := userModel.UpdatePassword(id, req.Password); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
@@ -157,41 +212,23 @@ func (h *AdminHandler) UpdateUserPassword(c *gin.Context) {
 // Settings Management APIs
 
 func (h *AdminHandler) ListSettings(c *gin.Context) {
-	rows, err := database.GetServerDB().Query("SELECT key, value, type, COALESCE(description, ''), updated_at FROM server_config ORDER BY key")
+	stored, err := h.Store.ListSettings(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settings"})
 		return
 	}
-	defer rows.Close()
 
-	settings := make([]map[string]interface{}, 0)
-	for rows.Next() {
-		var key, value, settingType, description string
-		var updatedAt time.Time
-		if err := rows.Scan(&key, &value, &settingType, &description, &updatedAt); err != nil {
-			continue
-		}
-		settings = append(settings, map[string]interface{}{
-			"key":         key,
-			"value":       value,
-			"type":        settingType,
-			"description": description,
-			"updated_at":  updatedAt,
-		})
+	settings := make([]map[string]interface{}, 0, len(stored))
+	for _, setting := range stored {
+		settings = append(settings, settingJSON(setting))
 	}
 
 	c.JSON(http.StatusOK, settings)
 }
 
 func (h *AdminHandler) GetSetting(c *gin.Context) {
-	key := c.Param("key")
-	var value, settingType, description string
-	var updatedAt time.Time
-
-	err := database.GetServerDB().QueryRow("SELECT value, type, COALESCE(description, ''), updated_at FROM server_config WHERE key = ?", key).
-		Scan(&value, &settingType, &description, &updatedAt)
-
-	if err == sql.ErrNoRows {
+	setting, err := h.Store.GetSetting(c.Request.Context(), c.Param("key"))
+	if errors.Is(err, store.ErrNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Setting not found"})
 		return
 	}
@@ -200,13 +237,17 @@ func (h *AdminHandler) GetSetting(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"key":         key,
-		"value":       value,
-		"type":        settingType,
-		"description": description,
-		"updated_at":  updatedAt,
-	})
+	c.JSON(http.StatusOK, settingJSON(setting))
+}
+
+func settingJSON(setting *models.Setting) map[string]interface{} {
+	return map[string]interface{}{
+		"key":         setting.Key,
+		"value":       setting.Value,
+		"type":        setting.Type,
+		"description": setting.Description,
+		"updated_at":  setting.UpdatedAt,
+	}
 }
 
 func (h *AdminHandler) UpdateSetting(c *gin.Context) {
@@ -221,10 +262,15 @@ func (h *AdminHandler) UpdateSetting(c *gin.Context) {
 		return
 	}
 
-	_, err := database.GetServerDB().Exec("UPDATE server_config SET value = ?, updated_at = ? WHERE key = ?",
-		req.Value, time.Now(), key)
-
+	err := h.Store.UpdateSetting(c.Request.Context(), key, req.Value)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Setting not found"})
+		return
+	}
 	if err != nil {
+		if RespondWriteQueued(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update setting"})
 		return
 	}
@@ -235,68 +281,51 @@ func (h *AdminHandler) UpdateSetting(c *gin.Context) {
 // API Token Management APIs
 
 func (h *AdminHandler) ListTokens(c *gin.Context) {
-	userID := c.Query("user_id")
+	ctx := c.Request.Context()
 
-	var rows *sql.Rows
+	var tokens []*models.Token
 	var err error
-
-	if userID != "" {
-		uid, _ := strconv.Atoi(userID)
-		tokenModel := &models.TokenModel{DB: h.DB}
-		tokens, err := tokenModel.GetByUserID(uid)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
-			return
-		}
-		c.JSON(http.StatusOK, tokens)
-		return
+	if userID := c.Query("user_id"); userID != "" {
+		uid, _ := strconv.ParseInt(userID, 10, 64)
+		tokens, err = h.Store.ListTokens(ctx, models.OwnerTypeUser, uid)
+	} else {
+		tokens, err = h.Store.ListTokensByType(ctx, models.OwnerTypeUser)
 	}
-
-	// Get all tokens for admin view - uses unified tokens table with token_prefix
-	rows, err = database.GetServerDB().Query(`
-		SELECT t.id, t.owner_id, u.email, t.name, t.token_prefix, t.created_at, t.last_used_at, t.expires_at
-		FROM tokens t
-		LEFT JOIN users u ON t.owner_id = u.id AND t.owner_type = 'user'
-		WHERE t.owner_type = 'user'
-		ORDER BY t.created_at DESC
-	`)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
 		return
 	}
-	defer rows.Close()
-
-	var tokens []map[string]interface{}
-	for rows.Next() {
-		var id, ownerID int
-		var email, name, tokenPrefix string
-		var createdAt time.Time
-		var lastUsedAt, expiresAt sql.NullTime
 
-		if err := rows.Scan(&id, &ownerID, &email, &name, &tokenPrefix, &createdAt, &lastUsedAt, &expiresAt); err != nil {
-			continue
+	// Tokens live in users.db next to the accounts; look each owner up once
+	emails := make(map[int64]string)
+	list := make([]map[string]interface{}, 0, len(tokens))
+	for _, t := range tokens {
+		email, ok := emails[t.OwnerID]
+		if !ok {
+			if user, err := h.Store.GetUserByID(ctx, t.OwnerID); err == nil {
+				email = user.Email
+			}
+			emails[t.OwnerID] = email
 		}
 
 		token := map[string]interface{}{
-			"id":           id,
-			"user_id":      ownerID,
+			"id":           t.ID,
+			"user_id":      t.OwnerID,
 			"user_email":   email,
-			"name":         name,
-			"token_prefix": tokenPrefix,
-			"created_at":   createdAt,
+			"name":         t.Name,
+			"token_prefix": t.TokenPrefix,
+			"created_at":   t.CreatedAt,
 		}
-
-		if lastUsedAt.Valid {
-			token["last_used_at"] = lastUsedAt.Time
+		if t.LastUsedAt != nil {
+			token["last_used_at"] = *t.LastUsedAt
 		}
-		if expiresAt.Valid {
-			token["expires_at"] = expiresAt.Time
+		if t.ExpiresAt != nil {
+			token["expires_at"] = *t.ExpiresAt
 		}
-
-		tokens = append(tokens, token)
+		list = append(list, token)
 	}
 
-	c.JSON(http.StatusOK, tokens)
+	c.JSON(http.StatusOK, list)
 }
 
 func (h *AdminHandler) GenerateToken(c *gin.Context) {
@@ -349,48 +378,30 @@ func (h *AdminHandler) ListAuditLogs(c *gin.Context) {
 		}
 	}
 
-	rows, err := database.GetServerDB().Query(`
-		SELECT a.id, a.user_id, u.email, a.action, a.resource, a.details,
-		       a.ip_address, a.user_agent, a.created_at
-		FROM server_audit_log a
-		LEFT JOIN user_accounts u ON a.user_id = u.id
-		ORDER BY a.created_at DESC
-		LIMIT ?
-	`, limit)
-
+	entries, err := h.Store.ListAuditLog(c.Request.Context(), limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit logs"})
 		return
 	}
-	defer rows.Close()
-
-	var logs []map[string]interface{}
-	for rows.Next() {
-		var id int
-		var userID sql.NullInt64
-		var email, action, resource, details, ipAddress, userAgent sql.NullString
-		var createdAt time.Time
-
-		if err := rows.Scan(&id, &userID, &email, &action, &resource, &details, &ipAddress, &userAgent, &createdAt); err != nil {
-			continue
-		}
-
-		log := map[string]interface{}{
-			"id":         id,
-			"action":     action.String,
-			"resource":   resource.String,
-			"details":    details.String,
-			"ip_address": ipAddress.String,
-			"user_agent": userAgent.String,
-			"created_at": createdAt,
-		}
 
-		if userID.Valid {
-			log["user_id"] = userID.Int64
-			log["user_email"] = email.String
+	logs := make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		resource := e.ResourceType
+		if e.ResourceID != "" {
+			resource += ":" + e.ResourceID
 		}
-
-		logs = append(logs, log)
+		logs = append(logs, map[string]interface{}{
+			"id":         e.ID,
+			"actor_type": e.ActorType,
+			"actor_id":   e.ActorID,
+			"action":     e.Action,
+			"resource":   resource,
+			"details":    e.Details,
+			"ip_address": e.IPAddress,
+			"user_agent": e.UserAgent,
+			"status":     e.Status,
+			"created_at": e.Timestamp,
+		})
 	}
 
 	c.JSON(http.StatusOK, logs)
@@ -406,196 +417,44 @@ func (h *AdminHandler) ClearAuditLogs(c *gin.Context) {
 	}
 
 	cutoff := time.Now().AddDate(0, 0, -days)
-	result, err := database.GetServerDB().Exec("DELETE FROM server_audit_log WHERE created_at < ?", cutoff)
+	affected, err := h.Store.DeleteAuditLogBefore(c.Request.Context(), cutoff)
 	if err != nil {
+		if RespondWriteQueued(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear logs"})
 		return
 	}
 
-	affected, _ := result.RowsAffected()
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Audit logs cleared successfully",
 		"deleted": affected,
 	})
 }
 
-// GetLogsStats returns audit log statistics
-func (h *AdminHandler) GetLogsStats(c *gin.Context) {
-	var totalLogs, errorLogs, successLogs, recentLogs int64
-
-	// Get total count
-	database.GetServerDB().QueryRow("SELECT COUNT(*) FROM server_audit_log").Scan(&totalLogs)
-
-	// Get counts by success status
-	database.GetServerDB().QueryRow("SELECT COUNT(*) FROM server_audit_log WHERE success = 0").Scan(&errorLogs)
-	database.GetServerDB().QueryRow("SELECT COUNT(*) FROM server_audit_log WHERE success = 1").Scan(&successLogs)
-
-	// Get recent activity (last 24 hours)
-	database.GetServerDB().QueryRow("SELECT COUNT(*) FROM server_audit_log WHERE created_at >= datetime('now', '-1 day')").Scan(&recentLogs)
-
-	c.JSON(http.StatusOK, gin.H{
-		"total":      totalLogs,
-		"errors":     errorLogs,
-		"success":    successLogs,
-		"recent_24h": recentLogs,
-	})
-}
-
-// GetTasksStats returns scheduled task statistics
-func (h *AdminHandler) GetTasksStats(c *gin.Context) {
-	var totalTasks, enabledTasks, disabledTasks, failedTasks int64
-
-	// Get total count
-	database.GetServerDB().QueryRow("SELECT COUNT(*) FROM server_scheduler_state").Scan(&totalTasks)
-
-	// Get counts by status
-	database.GetServerDB().QueryRow("SELECT COUNT(*) FROM server_scheduler_state WHERE enabled = 1").Scan(&enabledTasks)
-	database.GetServerDB().QueryRow("SELECT COUNT(*) FROM server_scheduler_state WHERE enabled = 0").Scan(&disabledTasks)
-	database.GetServerDB().QueryRow("SELECT COUNT(*) FROM server_scheduler_state WHERE last_status = 'failed'").Scan(&failedTasks)
-
-	c.JSON(http.StatusOK, gin.H{
-		"total":    totalTasks,
-		"enabled":  enabledTasks,
-		"disabled": disabledTasks,
-		"failed":   failedTasks,
-	})
-}
-
 // System Stats APIs
 
 func (h *AdminHandler) GetSystemStats(c *gin.Context) {
-	userModel := &models.UserModel{DB: h.DB}
-
-	totalUsers, _ := userModel.Count()
-	adminCount, _ := userModel.CountByRole("admin")
-
-	var totalLocations, totalTokens, totalSessions, totalNotifications int
-	database.GetUsersDB().QueryRow("SELECT COUNT(*) FROM user_saved_locations").Scan(&totalLocations)
-	database.GetUsersDB().QueryRow("SELECT COUNT(*) FROM user_tokens").Scan(&totalTokens)
-	database.GetUsersDB().QueryRow("SELECT COUNT(*) FROM user_sessions").Scan(&totalSessions)
-	database.GetUsersDB().QueryRow("SELECT COUNT(*) FROM user_notifications").Scan(&totalNotifications)
+	stats, err := h.Store.Stats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statistics"})
+		return
+	}
+	adminCount, _ := h.Store.CountUsers(c.Request.Context(), "admin")
 
 	c.JSON(http.StatusOK, gin.H{
 		"users": gin.H{
-			"total": totalUsers,
+			"total": stats.Users,
 			"admin": adminCount,
-			"user":  totalUsers - adminCount,
+			"user":  stats.Users - adminCount,
 		},
-		"locations":     totalLocations,
-		"tokens":        totalTokens,
-		"sessions":      totalSessions,
-		"notifications": totalNotifications,
+		"locations":     stats.Locations,
+		"tokens":        stats.Tokens,
+		"sessions":      stats.Sessions,
+		"notifications": stats.Notifications,
 	})
 }
 
-// GetScheduledTasks returns status of all scheduled tasks
-func (h *AdminHandler) GetScheduledTasks(c *gin.Context) {
-	// Check if table exists first
-	var tableExists int
-	err := database.GetServerDB().QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='scheduled_tasks'").Scan(&tableExists)
-	if err != nil || tableExists == 0 {
-		// Table doesn't exist yet, return empty array
-		c.JSON(http.StatusOK, []map[string]interface{}{})
-		return
-	}
-
-	// Check if tasks are already seeded
-	var count int
-	database.GetServerDB().QueryRow("SELECT COUNT(*) FROM server_scheduler_state").Scan(&count)
-
-	// If no tasks exist, seed them from the known scheduler tasks
-	if count == 0 {
-		h.seedScheduledTasks()
-	}
-
-	// Get scheduled tasks from database
-	rows, err := database.GetServerDB().Query(`
-		SELECT name, schedule, task_type, enabled, last_run, next_run, last_result
-		FROM server_scheduler_state
-		ORDER BY name
-	`)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch scheduled tasks", "details": err.Error()})
-		return
-	}
-	defer rows.Close()
-
-	var tasks []map[string]interface{}
-	for rows.Next() {
-		var taskName, schedule, taskType, lastResult sql.NullString
-		var enabled bool
-		var lastRun, nextRun sql.NullTime
-
-		if err := rows.Scan(&taskName, &schedule, &taskType, &enabled, &lastRun, &nextRun, &lastResult); err != nil {
-			continue
-		}
-
-		task := map[string]interface{}{
-			"task_name": taskName.String,
-			"name":      taskName.String,
-			"status":    map[bool]string{true: "success", false: "disabled"}[enabled],
-			// Running state from scheduler (defaults to false)
-			"running":   false,
-			"enabled":   enabled,
-		}
-
-		if lastRun.Valid {
-			task["last_run"] = lastRun.Time
-		}
-		if nextRun.Valid {
-			task["next_run"] = nextRun.Time
-		}
-
-		// Use schedule as interval if available
-		if schedule.Valid && schedule.String != "" {
-			task["schedule"] = schedule.String
-		}
-
-		tasks = append(tasks, task)
-	}
-
-	// If no tasks in database after seeding, return empty array
-	if len(tasks) == 0 {
-		tasks = []map[string]interface{}{}
-	}
-
-	c.JSON(http.StatusOK, tasks)
-}
-
-// seedScheduledTasks seeds the database with default scheduled tasks
-func (h *AdminHandler) seedScheduledTasks() {
-	// Define all scheduled tasks matching main.go scheduler
-	defaultTasks := []struct {
-		Name     string
-		Schedule string
-		TaskType string
-	}{
-		{"rotate-logs", "Daily at midnight", "maintenance"},
-		{"cleanup-sessions", "Every 1 hour", "cleanup"},
-		{"cleanup-rate-limits", "Every 1 hour", "cleanup"},
-		{"cleanup-audit-logs", "Every 24 hours", "cleanup"},
-		{"check-weather-alerts", "Every 15 minutes", "weather"},
-		{"daily-forecast", "Every 24 hours", "weather"},
-		{"process-notification-queue", "Every 2 minutes", "notifications"},
-		{"cleanup-notifications", "Every 24 hours", "cleanup"},
-		{"system-backup", "Every 6 hours", "backup"},
-		{"refresh-weather-cache", "Every 30 minutes", "weather"},
-		{"update-geoip-database", "Every 7 days", "maintenance"},
-	}
-
-	for _, task := range defaultTasks {
-		_, err := database.GetServerDB().Exec(`
-			INSERT OR IGNORE INTO server_scheduler_state (name, schedule, task_type, enabled, next_run)
-			VALUES (?, ?, ?, 1, datetime('now'))
-		`, task.Name, task.Schedule, task.TaskType)
-
-		if err != nil {
-			// Skip on error
-			continue
-		}
-	}
-}
-
 // ShowSettingsPage renders the admin settings page
 func (h *AdminHandler) ShowSettingsPage(c *gin.Context) {
 	adminIDValue, exists := c.Get("admin_id")
@@ -610,8 +469,7 @@ func (h *AdminHandler) ShowSettingsPage(c *gin.Context) {
 		return
 	}
 
-	adminModel := &models.AdminModel{DB: database.GetServerDB()}
-	admin, err := adminModel.GetByID(int64(adminID))
+	admin, err := h.Store.GetAdminByID(c.Request.Context(), int64(adminID))
 	if err != nil {
 		c.Redirect(http.StatusFound, "/admin")
 		return
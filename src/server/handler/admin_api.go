@@ -143,15 +143,23 @@ func OptimizeDatabase(c *gin.Context) {
 
 // ClearCache clears the application cache
 func ClearCache(c *gin.Context) {
-	// Get cache manager from context
-	cacheInterface, exists := c.Get("cache")
-	if !exists {
-		RespondSuccess(c, "Cache not configured (running without cache)")
-		return
+	// In-process caches are flushed on every cluster node
+	localCleared := false
+	if inv, ok := c.Get("cache_invalidator"); ok {
+		if invalidator, ok := inv.(*service.CacheInvalidator); ok {
+			invalidator.InvalidateAll()
+			localCleared = true
+		}
 	}
 
+	// Get cache manager from context
+	cacheInterface, exists := c.Get("cache")
 	cache, ok := cacheInterface.(*service.CacheManager)
-	if !ok || !cache.IsEnabled() {
+	if !exists || !ok || !cache.IsEnabled() {
+		if localCleared {
+			RespondSuccess(c, "In-memory caches cleared")
+			return
+		}
 		RespondSuccess(c, "Cache not enabled")
 		return
 	}
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"net/http"
+	"strings"
 
+	"github.com/apimgr/weather/src/config"
 	"github.com/apimgr/weather/src/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -31,6 +33,13 @@ func (h *AdminAuthSettingsHandler) UpdateAuthSettings(c *gin.Context) {
 		LDAPBindPassword string         `json:"ldap_bind_password"`
 		LDAPBaseDN       string         `json:"ldap_base_dn"`
 		LDAPUserFilter   string         `json:"ldap_user_filter"`
+		LDAPSecurity     string         `json:"ldap_security"`
+		LDAPCAFile       string         `json:"ldap_ca_file"`
+		LDAPGroupBaseDN  string         `json:"ldap_group_base_dn"`
+		LDAPGroupFilter  string         `json:"ldap_group_filter"`
+		LDAPAllowed      []string       `json:"ldap_allowed_groups"`
+		LDAPAdminGroups  []string       `json:"ldap_admin_groups"`
+		LDAPRoleMapping  map[string]string `json:"ldap_role_mapping"`
 		TOTPEnabled      bool           `json:"totp_enabled"`
 		TOTPIssuer       string         `json:"totp_issuer"`
 		TOTPDigits       int            `json:"totp_digits"`
@@ -45,8 +54,42 @@ func (h *AdminAuthSettingsHandler) UpdateAuthSettings(c *gin.Context) {
 		return
 	}
 
+	switch strings.ToLower(req.LDAPSecurity) {
+	case "", "none", "starttls", "ldaps":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ldap_security must be none, starttls or ldaps"})
+		return
+	}
+	if req.LDAPUserFilter != "" && !strings.Contains(req.LDAPUserFilter, "{username}") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ldap_user_filter must contain {username}"})
+		return
+	}
+
+	providers := make([]config.OIDCProviderConfig, 0, len(req.OIDCProviders))
+	for _, p := range req.OIDCProviders {
+		if p.Name == "" || p.IssuerURL == "" || p.ClientID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "each OIDC provider needs a name, issuer_url and client_id"})
+			return
+		}
+		providers = append(providers, config.OIDCProviderConfig{
+			Name:          p.Name,
+			DisplayName:   p.DisplayName,
+			IssuerURL:     p.IssuerURL,
+			ClientID:      p.ClientID,
+			ClientSecret:  p.ClientSecret,
+			RedirectURL:   p.RedirectURL,
+			Scopes:        p.Scopes,
+			UsernameClaim: p.UsernameClaim,
+			RoleClaim:     p.RoleClaim,
+			RoleMapping:   p.RoleMapping,
+			DefaultRole:   p.DefaultRole,
+			AdminLogin:    p.AdminLogin,
+		})
+	}
+
 	updates := map[string]interface{}{
 		"server.auth.oidc.enabled":      req.OIDCEnabled,
+		"server.auth.oidc.providers":    providers,
 		"server.auth.ldap.enabled":      req.LDAPEnabled,
 		"server.auth.ldap.server":       req.LDAPServer,
 		"server.auth.ldap.port":         req.LDAPPort,
@@ -54,6 +97,13 @@ func (h *AdminAuthSettingsHandler) UpdateAuthSettings(c *gin.Context) {
 		"server.auth.ldap.bind_password": req.LDAPBindPassword,
 		"server.auth.ldap.base_dn":      req.LDAPBaseDN,
 		"server.auth.ldap.user_filter":  req.LDAPUserFilter,
+		"server.auth.ldap.security":     strings.ToLower(req.LDAPSecurity),
+		"server.auth.ldap.ca_file":      req.LDAPCAFile,
+		"server.auth.ldap.group_base_dn": req.LDAPGroupBaseDN,
+		"server.auth.ldap.group_filter": req.LDAPGroupFilter,
+		"server.auth.ldap.allowed_groups": req.LDAPAllowed,
+		"server.auth.ldap.admin_groups": req.LDAPAdminGroups,
+		"server.auth.ldap.role_mapping": req.LDAPRoleMapping,
 		"server.auth.totp.enabled":      req.TOTPEnabled,
 		"server.auth.totp.issuer":       req.TOTPIssuer,
 		"server.auth.totp.digits":       req.TOTPDigits,
@@ -72,9 +122,16 @@ func (h *AdminAuthSettingsHandler) UpdateAuthSettings(c *gin.Context) {
 }
 
 type OIDCProvider struct {
-	Name         string `json:"name"`
-	ClientID     string `json:"client_id"`
-	ClientSecret string `json:"client_secret"`
-	IssuerURL    string `json:"issuer_url"`
-	RedirectURL  string `json:"redirect_url"`
+	Name          string            `json:"name"`
+	DisplayName   string            `json:"display_name"`
+	ClientID      string            `json:"client_id"`
+	ClientSecret  string            `json:"client_secret"`
+	IssuerURL     string            `json:"issuer_url"`
+	RedirectURL   string            `json:"redirect_url"`
+	Scopes        []string          `json:"scopes"`
+	UsernameClaim string            `json:"username_claim"`
+	RoleClaim     string            `json:"role_claim"`
+	RoleMapping   map[string]string `json:"role_mapping"`
+	DefaultRole   string            `json:"default_role"`
+	AdminLogin    bool              `json:"admin_login"`
 }
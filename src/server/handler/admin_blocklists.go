@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/utils"
+)
+
+// AdminBlocklistsHandler manages the request IP blocklist: downloaded lists,
+// manual allow/deny entries and denied countries
+type AdminBlocklistsHandler struct {
+	DB        *sql.DB
+	Blocklist *service.IPBlocklistService
+}
+
+// NewAdminBlocklistsHandler creates a new blocklist handler
+func NewAdminBlocklistsHandler(db *sql.DB, blocklist *service.IPBlocklistService) *AdminBlocklistsHandler {
+	return &AdminBlocklistsHandler{DB: db, Blocklist: blocklist}
+}
+
+func (h *AdminBlocklistsHandler) overview() ([]service.BlocklistListStats, []*models.BlocklistEntry, error) {
+	lists, err := h.Blocklist.Stats()
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := (&models.BlocklistModel{DB: h.DB}).List()
+	if err != nil {
+		return nil, nil, err
+	}
+	return lists, entries, nil
+}
+
+// ShowBlocklistsPage renders the blocklist overview with hit counts
+// GET /{admin_path}/server/network/blocklists
+func (h *AdminBlocklistsHandler) ShowBlocklistsPage(c *gin.Context) {
+	lists, entries, err := h.overview()
+	data := gin.H{
+		"title":   "Blocklists - Admin",
+		"page":    "network-blocklists",
+		"lists":   lists,
+		"entries": entries,
+		"enabled": h.Blocklist.SourcesEnabled(),
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	c.HTML(http.StatusOK, "admin/admin_blocklists.tmpl", utils.TemplateData(c, data))
+}
+
+// ListBlocklists returns every list with its hit count, plus the manual
+// entries
+// GET /api/v1/{admin_path}/server/network/blocklists
+func (h *AdminBlocklistsHandler) ListBlocklists(c *gin.Context) {
+	lists, entries, err := h.overview()
+	if err != nil {
+		InternalError(c, "failed to load blocklists: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "lists": lists, "entries": entries})
+}
+
+// CreateBlocklistEntry adds or replaces an allow, deny or country entry
+// POST /api/v1/{admin_path}/server/network/blocklists/entries
+func (h *AdminBlocklistsHandler) CreateBlocklistEntry(c *gin.Context) {
+	var req struct {
+		Type   string `json:"type" binding:"required"`
+		Value  string `json:"value" binding:"required"`
+		Action string `json:"action"`
+		Reason string `json:"reason"`
+		// Seconds until the entry stops applying; 0 keeps it forever
+		ExpiresIn int64 `json:"expires_in"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "type and value are required")
+		return
+	}
+	if req.ExpiresIn < 0 {
+		BadRequest(c, "expires_in must not be negative")
+		return
+	}
+
+	entry := &models.BlocklistEntry{
+		Type:   req.Type,
+		Value:  req.Value,
+		Action: req.Action,
+		Reason: req.Reason,
+	}
+	if admin, ok := c.Get("admin"); ok {
+		if a, ok := admin.(*models.Admin); ok {
+			entry.AddedBy = a.Username
+		}
+	}
+	if req.ExpiresIn > 0 {
+		expires := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		entry.ExpiresAt = &expires
+	}
+	if err := entry.Normalize(); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	if err := (&models.BlocklistModel{DB: h.DB}).Create(entry); err != nil {
+		InternalError(c, err.Error())
+		return
+	}
+	if err := h.Blocklist.Reload(); err != nil {
+		InternalError(c, "entry saved but blocklist reload failed: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "entry": entry})
+}
+
+// DeleteBlocklistEntry removes a manual entry
+// DELETE /api/v1/{admin_path}/server/network/blocklists/entries/:id
+func (h *AdminBlocklistsHandler) DeleteBlocklistEntry(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		BadRequest(c, "invalid entry id")
+		return
+	}
+	if err := (&models.BlocklistModel{DB: h.DB}).Delete(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			NotFound(c, "blocklist entry not found")
+			return
+		}
+		InternalError(c, err.Error())
+		return
+	}
+	if err := h.Blocklist.Reload(); err != nil {
+		InternalError(c, "entry deleted but blocklist reload failed: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
@@ -171,6 +171,9 @@ func isValidTemplateName(name string) bool {
 		"login_alert",
 		"security_alert",
 		"scheduler_error",
+		"data_export_ready",
+		"account_deletion_confirm",
+		"account_deleted",
 		"test",
 	}
 
@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DatabaseFailoverHandler shows the write queue and read replicas of the
+// server and users databases and resolves replay conflicts and dead letters
+type DatabaseFailoverHandler struct {
+	// By database (server, users); empty when failover is not running
+	Managers map[string]*database.FailoverManager
+	Audit    *service.AuditLogger
+}
+
+// GetFailoverStatus returns read-only mode, queued writes, the last replay
+// and replica lag of each database
+// GET /api/v1/{admin_path}/server/database/failover
+func (h *DatabaseFailoverHandler) GetFailoverStatus(c *gin.Context) {
+	databases := make(map[string]database.FailoverStatus, len(h.Managers))
+	for name, fm := range h.Managers {
+		databases[name] = fm.Status()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok":        true,
+		"enabled":   len(h.Managers) > 0,
+		"databases": databases,
+	})
+}
+
+// ResolveReplayConflict resumes a replay stopped on a conflicting write:
+// {action: retry|skip}. Skip drops the write for good
+// POST /api/v1/{admin_path}/server/database/failover/:database/resolve
+func (h *DatabaseFailoverHandler) ResolveReplayConflict(c *gin.Context) {
+	name := c.Param("database")
+	fm, ok := h.Managers[name]
+	if !ok {
+		NotFound(c, "Failover is not running for database "+name)
+		return
+	}
+	var req struct {
+		Action string `json:"action"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Action != "retry" && req.Action != "skip") {
+		BadRequest(c, "action must be retry or skip")
+		return
+	}
+
+	conflict := fm.Status().Conflict
+	report, err := fm.ResolveConflict(req.Action == "skip")
+	if err != nil {
+		Conflict(c, err.Error())
+		return
+	}
+	h.audit(c, name, req.Action, conflict, report)
+
+	message := "Queued writes replayed"
+	if report.Conflict != nil {
+		message = "Replay stopped on a conflicting write"
+	}
+	RespondSuccess(c, message, map[string]interface{}{"report": report})
+}
+
+// ResolveDeadLetter requeues or discards a write the database rejected on
+// every replay attempt: {action: requeue|discard}
+// POST /api/v1/{admin_path}/server/database/failover/:database/dead-letters/:seq
+func (h *DatabaseFailoverHandler) ResolveDeadLetter(c *gin.Context) {
+	name := c.Param("database")
+	fm, ok := h.Managers[name]
+	if !ok {
+		NotFound(c, "Failover is not running for database "+name)
+		return
+	}
+	seq, err := strconv.ParseInt(c.Param("seq"), 10, 64)
+	if err != nil {
+		BadRequest(c, "Invalid write sequence number")
+		return
+	}
+	var req struct {
+		Action string `json:"action"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Action != "requeue" && req.Action != "discard") {
+		BadRequest(c, "action must be requeue or discard")
+		return
+	}
+
+	var letter *database.ReplayConflict
+	for _, dead := range fm.Status().DeadLetters {
+		if dead.Seq == seq {
+			letter = &dead
+			break
+		}
+	}
+	if letter == nil {
+		NotFound(c, "No dead letter with that sequence number")
+		return
+	}
+
+	if req.Action == "discard" {
+		if err := fm.DiscardDeadLetter(seq); err != nil {
+			Conflict(c, err.Error())
+			return
+		}
+		h.audit(c, name, req.Action, letter, &database.ReplayReport{Remaining: fm.GetQueuedWriteCount()})
+		RespondSuccess(c, "Dead letter discarded")
+		return
+	}
+
+	report, err := fm.RequeueDeadLetter(seq)
+	if err != nil {
+		Conflict(c, err.Error())
+		return
+	}
+	h.audit(c, name, req.Action, letter, report)
+
+	message := "Write requeued and replayed"
+	switch {
+	case report.Error != "":
+		message = "Write requeued; " + report.Error
+	case report.Conflict != nil:
+		message = "Write requeued; replay stopped on a conflicting write"
+	}
+	RespondSuccess(c, message, map[string]interface{}{"report": report})
+}
+
+// audit records a replay conflict or dead letter resolution in the audit log
+func (h *DatabaseFailoverHandler) audit(c *gin.Context, name, action string, conflict *database.ReplayConflict, report *database.ReplayReport) {
+	if h.Audit == nil {
+		return
+	}
+	actor := service.Actor{Type: "admin", IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	if admin, ok := currentAdmin(c); ok {
+		actor.ID = admin.Username
+	}
+	details := map[string]interface{}{
+		"action":    action,
+		"applied":   report.Applied,
+		"remaining": report.Remaining,
+	}
+	if conflict != nil {
+		details["write_seq"] = conflict.Seq
+		details["write_key"] = conflict.Key
+		details["statements"] = conflict.Statements
+	}
+	severity := "info"
+	if action == "skip" || action == "discard" {
+		severity = "warn"
+	}
+	err := h.Audit.Log(service.AuditEvent{
+		Event:    string(service.EventAdminDatabaseReplay),
+		Category: "admin",
+		Severity: severity,
+		Actor:    actor,
+		Target:   &service.Target{Type: "database", ID: name},
+		Details:  details,
+		Result:   "success",
+	})
+	if err != nil {
+		log.Printf("Failover: audit log failed: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/apimgr/weather/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDatabaseFailoverHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, dialect, cleanup, err := database.OpenScratchDB("sqlite:", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if err := database.MigrateDatabase(db, dialect, database.MigrationsServer, nil); err != nil {
+		t.Fatal(err)
+	}
+	fm := database.NewFailoverManager(db, nil)
+	defer fm.Close()
+
+	h := &DatabaseFailoverHandler{Managers: map[string]*database.FailoverManager{"server": fm}}
+	r := gin.New()
+	r.GET("/failover", h.GetFailoverStatus)
+	r.POST("/failover/:database/resolve", h.ResolveReplayConflict)
+	r.POST("/failover/:database/dead-letters/:seq", h.ResolveDeadLetter)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/failover", nil))
+	var status struct {
+		Enabled   bool                               `json:"enabled"`
+		Databases map[string]database.FailoverStatus `json:"databases"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil || !status.Enabled || status.Databases["server"].ReadOnly {
+		t.Fatalf("status = %s", w.Body)
+	}
+
+	for _, tc := range []struct {
+		path, body string
+		want       int
+	}{
+		{"/failover/reports/resolve", `{"action": "skip"}`, http.StatusNotFound},
+		{"/failover/server/resolve", `{"action": "drop"}`, http.StatusBadRequest},
+		// Nothing to resolve while replay is not stopped
+		{"/failover/server/resolve", `{"action": "retry"}`, http.StatusConflict},
+		{"/failover/reports/dead-letters/1", `{"action": "discard"}`, http.StatusNotFound},
+		{"/failover/server/dead-letters/x", `{"action": "discard"}`, http.StatusBadRequest},
+		{"/failover/server/dead-letters/1", `{"action": "retry"}`, http.StatusBadRequest},
+		{"/failover/server/dead-letters/1", `{"action": "requeue"}`, http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body)))
+		if w.Code != tc.want {
+			t.Errorf("POST %s %s = %d, want %d", tc.path, tc.body, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+
+	models "github.com/apimgr/weather/src/server/model"
+)
+
+// AdminGraphQLHandler manages GraphQL persisted queries (APQ store and allowlist)
+type AdminGraphQLHandler struct {
+	PersistedQueries *models.PersistedQueryModel
+}
+
+// NewAdminGraphQLHandler creates a new GraphQL admin handler
+func NewAdminGraphQLHandler(db *sql.DB) *AdminGraphQLHandler {
+	return &AdminGraphQLHandler{
+		PersistedQueries: &models.PersistedQueryModel{DB: db},
+	}
+}
+
+// ListPersistedQueries returns stored queries, optionally filtered by ?source=apq|admin
+func (h *AdminGraphQLHandler) ListPersistedQueries(c *gin.Context) {
+	queries, err := h.PersistedQueries.List(c.Query("source"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to list persisted queries"})
+		return
+	}
+	if queries == nil {
+		queries = []*models.PersistedQuery{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "queries": queries, "count": len(queries)})
+}
+
+// RegisterPersistedQuery adds a query to the allowlist
+func (h *AdminGraphQLHandler) RegisterPersistedQuery(c *gin.Context) {
+	var req struct {
+		Query string `json:"query" binding:"required"`
+		Name  string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Query is required"})
+		return
+	}
+
+	// Reject documents that would never parse so the allowlist only holds usable queries
+	if _, err := parser.ParseQuery(&ast.Source{Input: req.Query}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid GraphQL query: " + err.Error()})
+		return
+	}
+
+	query, err := h.PersistedQueries.Save(req.Query, strings.TrimSpace(req.Name), models.PersistedQuerySourceAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to save persisted query"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "query": query})
+}
+
+// DeletePersistedQuery removes a query by hash
+func (h *AdminGraphQLHandler) DeletePersistedQuery(c *gin.Context) {
+	if err := h.PersistedQueries.Delete(c.Param("hash")); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"ok": false, "error": "Persisted query not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to delete persisted query"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Persisted query deleted"})
+}
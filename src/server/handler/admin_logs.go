@@ -2,6 +2,7 @@ package handler
 
 import (
 	"bufio"
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -18,6 +19,8 @@ import (
 type LogsHandler struct {
 	logsDir string
 	logFile string
+	// Verifies audit checkpoint signatures; nil skips signature checks
+	auditKey ed25519.PublicKey
 }
 
 func NewLogsHandler(logsDir string) *LogsHandler {
@@ -357,6 +360,45 @@ func (h *LogsHandler) GetAuditLogs(c *gin.Context) {
 	})
 }
 
+// SetAuditPublicKey sets the key audit checkpoints are verified against
+func (h *LogsHandler) SetAuditPublicKey(key ed25519.PublicKey) {
+	h.auditKey = key
+}
+
+// VerifyAuditLogs checks the audit log hash chain and checkpoint
+// signatures across all archives
+// GET /api/v1/{admin_path}/server/logs/audit/verify
+func (h *LogsHandler) VerifyAuditLogs(c *gin.Context) {
+	report, err := service.VerifyAuditLog(h.logsDir, h.auditKey)
+	if err != nil {
+		InternalError(c, "failed to verify audit log: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "report": report})
+}
+
+// ExportAuditLogs streams every audit record, archives included, oldest
+// first
+// GET /api/v1/{admin_path}/server/logs/audit/export?format=jsonl|cef|syslog
+func (h *LogsHandler) ExportAuditLogs(c *gin.Context) {
+	format, err := service.ParseAuditExportFormat(c.Query("format"))
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	ext, contentType := "jsonl", "application/x-ndjson"
+	if format != service.LogFormatJSON {
+		ext, contentType = string(format), "text/plain; charset=utf-8"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=audit_%s.%s", time.Now().Format("2006-01-02"), ext))
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	if err := service.ExportAuditLog(c.Writer, h.logsDir, format); err != nil {
+		c.Error(err)
+	}
+}
+
 // DownloadAuditLogs allows downloading the complete audit log file
 func (h *LogsHandler) DownloadAuditLogs(c *gin.Context) {
 	auditFile := filepath.Join(h.logsDir, "audit.log")
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/apimgr/weather/src/backup"
+	"github.com/apimgr/weather/src/backup/objectstore"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BackupReplicationHandler shows the continuous WAL replication of the
+// SQLite databases on the backup page
+type BackupReplicationHandler struct {
+	// Empty when replication is off
+	Replicators []*backup.Replicator
+	Store       objectstore.Store
+}
+
+// replicationDatabase is the status of one database with the time range it
+// can be restored to
+type replicationDatabase struct {
+	backup.ReplicationStatus
+	RestoreFrom *time.Time `json:"restore_from,omitempty"`
+	RestoreTo   *time.Time `json:"restore_to,omitempty"`
+	Generations int        `json:"generations"`
+}
+
+// GetReplicationStatus returns lag, generation and restore window of each
+// replicated database
+// GET /api/v1/{admin_path}/server/backup/replication
+func (h *BackupReplicationHandler) GetReplicationStatus(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	databases := make([]replicationDatabase, 0, len(h.Replicators))
+	for _, r := range h.Replicators {
+		db := replicationDatabase{ReplicationStatus: r.Status()}
+		generations, err := backup.ListGenerations(ctx, h.Store, db.Database)
+		if err != nil {
+			if db.LastError == "" {
+				db.LastError = "failed to list restore points: " + err.Error()
+			}
+		} else if len(generations) > 0 {
+			from, to := generations[0].Start, generations[len(generations)-1].End
+			db.RestoreFrom, db.RestoreTo = &from, &to
+			db.Generations = len(generations)
+		}
+		databases = append(databases, db)
+	}
+
+	target := ""
+	if h.Store != nil {
+		target = h.Store.String()
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok":        true,
+		"enabled":   len(h.Replicators) > 0,
+		"target":    target,
+		"databases": databases,
+	})
+}
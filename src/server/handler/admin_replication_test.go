@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/apimgr/weather/src/backup"
+	"github.com/apimgr/weather/src/backup/objectstore"
+	"github.com/apimgr/weather/src/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBackupReplicationHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("PRAGMA journal_mode = WAL"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.MigrateDatabase(db, database.DialectSQLite, database.MigrationsServer, nil); err != nil {
+		t.Fatal(err)
+	}
+	store, err := objectstore.NewFile(filepath.Join(dir, "replica"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := backup.NewReplicator(backup.ReplicationOptions{Store: store, Name: "server", Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		handler *BackupReplicationHandler
+		enabled bool
+	}{
+		{"off", &BackupReplicationHandler{}, false},
+		{"on", &BackupReplicationHandler{Replicators: []*backup.Replicator{r}, Store: store}, true},
+	} {
+		router := gin.New()
+		router.GET("/replication", tc.handler.GetReplicationStatus)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/replication", nil))
+
+		var resp struct {
+			Enabled   bool                  `json:"enabled"`
+			Databases []replicationDatabase `json:"databases"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Enabled != tc.enabled {
+			t.Fatalf("%s: %s", tc.name, w.Body)
+		}
+		if !tc.enabled {
+			continue
+		}
+		got := resp.Databases
+		if len(got) != 1 || got[0].Generation == "" || got[0].RestoreFrom == nil || got[0].Generations != 1 || got[0].LastError != "" {
+			t.Errorf("%s: databases = %s", tc.name, w.Body)
+		}
+	}
+}
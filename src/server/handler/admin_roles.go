@@ -0,0 +1,466 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/apimgr/weather/src/server/middleware"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/utils"
+)
+
+// AdminRolesHandler manages custom roles, their assignment to admins and
+// users, and previews of what a role can access
+type AdminRolesHandler struct {
+	ServerDB *sql.DB
+	UsersDB  *sql.DB
+	Audit    *service.AuditLogger
+	// Routes returns the registered routes and AdminAPIPrefix selects the
+	// admin API ones, for previews
+	Routes         func() gin.RoutesInfo
+	AdminAPIPrefix string
+}
+
+// NewAdminRolesHandler creates a new roles handler
+func NewAdminRolesHandler(serverDB, usersDB *sql.DB, audit *service.AuditLogger, routes func() gin.RoutesInfo, adminAPIPrefix string) *AdminRolesHandler {
+	return &AdminRolesHandler{ServerDB: serverDB, UsersDB: usersDB, Audit: audit, Routes: routes, AdminAPIPrefix: adminAPIPrefix}
+}
+
+func (h *AdminRolesHandler) roles() *models.RoleModel {
+	return &models.RoleModel{DB: h.ServerDB}
+}
+
+// RoutePreview is one admin API route in a role preview
+type RoutePreview struct {
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	Permission string `json:"permission"`
+	Allowed    bool   `json:"allowed"`
+}
+
+// FieldPreview is one admin GraphQL field in a role preview
+type FieldPreview struct {
+	Field      string `json:"field"`
+	Permission string `json:"permission"`
+	Allowed    bool   `json:"allowed"`
+}
+
+// ShowRolesPage renders the roles and the permission catalog
+// GET /{admin_path}/server/roles
+func (h *AdminRolesHandler) ShowRolesPage(c *gin.Context) {
+	roles, err := h.roles().List()
+	data := gin.H{
+		"title":       "Role Definitions - Admin",
+		"page":        "server-roles",
+		"roles":       roles,
+		"permissions": models.PermissionCatalog,
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	c.HTML(http.StatusOK, "admin/admin_roles.tmpl", utils.TemplateData(c, data))
+}
+
+// ListPermissions returns the permission catalog
+// GET /api/v1/{admin_path}/server/permissions
+func (h *AdminRolesHandler) ListPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"ok": true, "permissions": models.PermissionCatalog})
+}
+
+// ListRoles returns the built-in and custom roles
+// GET /api/v1/{admin_path}/server/roles
+func (h *AdminRolesHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roles().List()
+	if err != nil {
+		InternalError(c, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "roles": roles})
+}
+
+// GetRole returns one role
+// GET /api/v1/{admin_path}/server/roles/:name
+func (h *AdminRolesHandler) GetRole(c *gin.Context) {
+	role, ok := h.loadRole(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "role": role})
+}
+
+type roleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// CreateRole adds a custom role: {name, description, permissions}
+// POST /api/v1/{admin_path}/server/roles
+func (h *AdminRolesHandler) CreateRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+	if !h.canGrant(c, req.Permissions) {
+		return
+	}
+
+	role, err := h.roles().Create(strings.TrimSpace(req.Name), req.Description, req.Permissions)
+	if err != nil {
+		h.roleError(c, err)
+		return
+	}
+	h.audit(c, service.EventAdminRoleCreate, role.Name, map[string]interface{}{"permissions": role.Permissions})
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "role": role})
+}
+
+// UpdateRole replaces a custom role's description and permissions
+// PUT /api/v1/{admin_path}/server/roles/:name
+func (h *AdminRolesHandler) UpdateRole(c *gin.Context) {
+	var req roleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+	existing, ok := h.loadRole(c)
+	if !ok {
+		return
+	}
+	// Changing a role changes what its holders can do, so the caller needs
+	// both the old and the new permissions
+	if !h.canGrant(c, append(existing.Permissions, req.Permissions...)) {
+		return
+	}
+
+	role, err := h.roles().Update(existing.Name, req.Description, req.Permissions)
+	if err != nil {
+		h.roleError(c, err)
+		return
+	}
+	h.audit(c, service.EventAdminRoleUpdate, role.Name, map[string]interface{}{
+		"previous_permissions": existing.Permissions,
+		"permissions":          role.Permissions,
+	})
+	c.JSON(http.StatusOK, gin.H{"ok": true, "role": role})
+}
+
+// DeleteRole removes a custom role and its admin assignments
+// DELETE /api/v1/{admin_path}/server/roles/:name
+func (h *AdminRolesHandler) DeleteRole(c *gin.Context) {
+	role, ok := h.loadRole(c)
+	if !ok {
+		return
+	}
+	if !h.canGrant(c, role.Permissions) {
+		return
+	}
+	if err := h.roles().Delete(role.Name); err != nil {
+		h.roleError(c, err)
+		return
+	}
+	h.audit(c, service.EventAdminRoleDelete, role.Name, map[string]interface{}{"permissions": role.Permissions})
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// PreviewRole lists every admin API route and admin GraphQL field with
+// whether the role can use it. Routes without a permission are an admin's
+// own profile and are open to every admin.
+// GET /api/v1/{admin_path}/server/roles/:name/preview
+func (h *AdminRolesHandler) PreviewRole(c *gin.Context) {
+	role, ok := h.loadRole(c)
+	if !ok {
+		return
+	}
+	permissions := models.NewPermissionSet(role.Permissions)
+
+	routes := []RoutePreview{}
+	if h.Routes != nil {
+		for _, route := range h.Routes() {
+			if !strings.HasPrefix(route.Path, h.AdminAPIPrefix+"/") {
+				continue
+			}
+			permission := models.AdminRoutePermission(route.Method, route.Path)
+			routes = append(routes, RoutePreview{
+				Method:     route.Method,
+				Path:       strings.TrimPrefix(route.Path, h.AdminAPIPrefix),
+				Permission: permission,
+				Allowed:    permissions.Has(permission),
+			})
+		}
+		sort.Slice(routes, func(i, j int) bool {
+			if routes[i].Path != routes[j].Path {
+				return routes[i].Path < routes[j].Path
+			}
+			return routes[i].Method < routes[j].Method
+		})
+	}
+
+	fields := []FieldPreview{}
+	for _, field := range models.AdminGraphQLFields() {
+		permission := models.AdminGraphQLPermission(field)
+		fields = append(fields, FieldPreview{Field: field, Permission: permission, Allowed: permissions.Has(permission)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"role":    role,
+		"routes":  routes,
+		"graphql": fields,
+	})
+}
+
+// GetAdminRoles returns an admin's assigned and effective roles and the
+// resulting permissions
+// GET /api/v1/{admin_path}/server/admins/:id/roles
+func (h *AdminRolesHandler) GetAdminRoles(c *gin.Context) {
+	admin, ok := h.loadAdmin(c)
+	if !ok {
+		return
+	}
+	h.respondAdminRoles(c, admin)
+}
+
+// SetAdminRoles replaces an admin's roles: {roles: [...]}; an empty list
+// restores the default admin role
+// PUT /api/v1/{admin_path}/server/admins/:id/roles
+func (h *AdminRolesHandler) SetAdminRoles(c *gin.Context) {
+	var req struct {
+		Roles []string `json:"roles"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+	admin, ok := h.loadAdmin(c)
+	if !ok {
+		return
+	}
+	if admin.IsSuperAdmin {
+		BadRequest(c, "super admins always hold every permission")
+		return
+	}
+
+	previous, err := h.roles().EffectiveAdminRoles(admin)
+	if err != nil {
+		InternalError(c, err.Error())
+		return
+	}
+	next := req.Roles
+	if len(next) == 0 {
+		next = []string{models.RoleAdmin}
+	}
+	// The caller must already hold everything the admin had and will have
+	if !h.canGrantRoles(c, append(previous, next...)) {
+		return
+	}
+
+	if err := h.roles().SetAdminRoles(admin.ID, req.Roles); err != nil {
+		h.roleError(c, err)
+		return
+	}
+	h.audit(c, service.EventAdminRoleAssign, admin.Username, map[string]interface{}{
+		"admin_id":       admin.ID,
+		"previous_roles": previous,
+		"roles":          next,
+	})
+	h.respondAdminRoles(c, admin)
+}
+
+// SetUserRole changes the role of a user account: {role}
+// PUT /api/v1/{admin_path}/server/users/:id/role
+func (h *AdminRolesHandler) SetUserRole(c *gin.Context) {
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "role is required")
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		BadRequest(c, "invalid user id")
+		return
+	}
+	user, err := (&models.UserModel{DB: h.UsersDB}).GetByID(id)
+	if err != nil {
+		NotFound(c, "user not found")
+		return
+	}
+	if !canAssignUserRole(c, h.roles(), user.Role, req.Role) {
+		return
+	}
+
+	if err := (&models.UserModel{DB: h.UsersDB}).UpdateRole(user.ID, req.Role); err != nil {
+		InternalError(c, err.Error())
+		return
+	}
+	h.audit(c, service.EventAdminRoleAssign, user.Username, map[string]interface{}{
+		"user_id":       user.ID,
+		"previous_role": user.Role,
+		"role":          req.Role,
+	})
+	c.JSON(http.StatusOK, gin.H{"ok": true, "user_id": user.ID, "role": req.Role})
+}
+
+func (h *AdminRolesHandler) loadRole(c *gin.Context) (*models.Role, bool) {
+	role, err := h.roles().Get(c.Param("name"))
+	if err != nil {
+		h.roleError(c, err)
+		return nil, false
+	}
+	return role, true
+}
+
+func (h *AdminRolesHandler) loadAdmin(c *gin.Context) (*models.Admin, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		BadRequest(c, "invalid admin id")
+		return nil, false
+	}
+	admin, err := (&models.AdminModel{DB: h.ServerDB}).GetByID(id)
+	if err != nil {
+		NotFound(c, "admin not found")
+		return nil, false
+	}
+	return admin, true
+}
+
+func (h *AdminRolesHandler) respondAdminRoles(c *gin.Context, admin *models.Admin) {
+	roles := h.roles()
+	assigned, err := roles.AdminRoles(admin.ID)
+	if err != nil {
+		InternalError(c, err.Error())
+		return
+	}
+	effective, err := roles.EffectiveAdminRoles(admin)
+	if err != nil {
+		InternalError(c, err.Error())
+		return
+	}
+	permissions, err := roles.Permissions(effective)
+	if err != nil {
+		InternalError(c, err.Error())
+		return
+	}
+	if assigned == nil {
+		assigned = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"ok":          true,
+		"admin_id":    admin.ID,
+		"assigned":    assigned,
+		"effective":   effective,
+		"permissions": permissions.List(),
+	})
+}
+
+// canGrant stops callers from granting permissions they do not hold
+func (h *AdminRolesHandler) canGrant(c *gin.Context, permissions []string) bool {
+	parsed, err := models.ParsePermissions(permissions)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return false
+	}
+	if !middleware.GetPermissions(c).Covers(parsed) {
+		Forbidden(c, "cannot grant permissions you do not hold")
+		return false
+	}
+	return true
+}
+
+func (h *AdminRolesHandler) canGrantRoles(c *gin.Context, names []string) bool {
+	var permissions []string
+	for _, name := range names {
+		role, err := h.roles().Get(name)
+		if err != nil {
+			h.roleError(c, err)
+			return false
+		}
+		permissions = append(permissions, role.Permissions...)
+	}
+	return h.canGrant(c, permissions)
+}
+
+// canAssignUserRole checks that a user's role may change from one role to
+// another: the new role must exist and the caller must hold every
+// permission of both. A deleted old role grants nothing.
+func canAssignUserRole(c *gin.Context, roles *models.RoleModel, from, to string) bool {
+	role, err := roles.Get(to)
+	if errors.Is(err, models.ErrRoleNotFound) {
+		BadRequest(c, "unknown role: "+to)
+		return false
+	}
+	if err != nil {
+		InternalError(c, err.Error())
+		return false
+	}
+	permissions := role.Permissions
+	if previous, err := roles.Get(from); err == nil {
+		permissions = append(permissions, previous.Permissions...)
+	}
+	if !middleware.GetPermissions(c).Covers(permissions) {
+		Forbidden(c, "cannot grant permissions you do not hold")
+		return false
+	}
+	return true
+}
+
+func (h *AdminRolesHandler) roleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrRoleNotFound):
+		NotFound(c, err.Error())
+	case errors.Is(err, models.ErrRoleExists):
+		Conflict(c, err.Error())
+	case errors.Is(err, models.ErrRoleBuiltIn):
+		Forbidden(c, err.Error())
+	case strings.HasPrefix(err.Error(), "failed to"):
+		InternalError(c, err.Error())
+	default:
+		BadRequest(c, err.Error())
+	}
+}
+
+// audit records a role change in the audit log
+func (h *AdminRolesHandler) audit(c *gin.Context, event service.EventType, target string, details map[string]interface{}) {
+	if h.Audit == nil {
+		return
+	}
+	actor := service.Actor{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+	if admin, ok := currentAdmin(c); ok {
+		actor.Type, actor.ID = "admin", admin.Username
+	} else if value, ok := c.Get("user"); ok {
+		if user, ok := value.(*models.User); ok {
+			actor.Type, actor.ID = "user", user.Username
+		}
+	}
+
+	targetType := "role"
+	if event == service.EventAdminRoleAssign {
+		targetType = "admin"
+		if _, ok := details["user_id"]; ok {
+			targetType = "user"
+		}
+	}
+
+	err := h.Audit.Log(service.AuditEvent{
+		Event:    string(event),
+		Category: "admin",
+		Severity: "info",
+		Actor:    actor,
+		Target:   &service.Target{Type: targetType, ID: target},
+		Details:  details,
+		Result:   "success",
+	})
+	if err != nil {
+		log.Printf("Roles: audit log failed: %v", err)
+	}
+}
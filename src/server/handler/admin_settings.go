@@ -1,8 +1,8 @@
 package handler
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,39 +10,32 @@ import (
 	"github.com/apimgr/weather/src/database"
 	models "github.com/apimgr/weather/src/server/model"
 	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/server/store"
 
 	"github.com/gin-gonic/gin"
 )
 
 // AdminSettingsHandler handles admin settings API
 type AdminSettingsHandler struct {
-	DB                  *sql.DB
+	Store               store.Store
 	NotificationService *service.NotificationService
 }
 
 // GetAllSettings returns all settings
 func (h *AdminSettingsHandler) GetAllSettings(c *gin.Context) {
-	rows, err := database.GetServerDB().Query(`
-		SELECT key, value, type, COALESCE(description, '') as description
-		FROM server_config
-		ORDER BY key
-	`)
+	stored, err := h.Store.ListSettings(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to fetch settings",
 		})
 		return
 	}
-	defer rows.Close()
 
 	settings := make(map[string]interface{})
 	categories := make(map[string][]gin.H)
 
-	for rows.Next() {
-		var key, value, typ, description string
-		if err := rows.Scan(&key, &value, &typ, &description); err != nil {
-			continue
-		}
+	for _, setting := range stored {
+		key, value, typ, description := setting.Key, setting.Value, setting.Type, setting.Description
 
 		// Extract category from key prefix (e.g., "smtp.host" → "smtp")
 		category := "other"
@@ -123,23 +116,17 @@ func (h *AdminSettingsHandler) UpdateSettings(c *gin.Context) {
 		}
 
 		// Update in database
-		result, err := database.GetServerDB().Exec(`
-			UPDATE server_config
-			SET value = ?, updated_at = CURRENT_TIMESTAMP
-			WHERE key = ?
-		`, valueStr, key)
-
+		err := h.Store.UpdateSetting(c.Request.Context(), key, valueStr)
+		if errors.Is(err, store.ErrNotFound) {
+			failed[key] = "Setting not found"
+			continue
+		}
 		if err != nil {
 			failed[key] = err.Error()
 			continue
 		}
 
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected > 0 {
-			applied = append(applied, key)
-		} else {
-			failed[key] = "Setting not found"
-		}
+		applied = append(applied, key)
 	}
 
 	// Send success notification to admin (TEMPLATE.md Part 25 - WebUI Notifications)
@@ -170,32 +157,17 @@ func (h *AdminSettingsHandler) UpdateSettings(c *gin.Context) {
 
 // ResetSettings resets all settings to defaults
 func (h *AdminSettingsHandler) ResetSettings(c *gin.Context) {
+	// Seeding the defaults stays with the settings model, which owns them
 	settingsModel := &models.SettingsModel{DB: database.GetServerDB()}
 	backupPath := settingsModel.GetString("backup.location", "/data/backups")
 
-	tx, err := database.GetServerDB().Begin()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to start settings reset",
-		})
-		return
-	}
-	defer tx.Rollback()
-
-	if _, err := tx.Exec("DELETE FROM server_config"); err != nil {
+	if _, err := h.Store.DeleteSettings(c.Request.Context()); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to clear settings",
 		})
 		return
 	}
 
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Failed to commit settings reset",
-		})
-		return
-	}
-
 	if err := settingsModel.InitializeDefaults(backupPath); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to restore default settings",
@@ -210,21 +182,17 @@ func (h *AdminSettingsHandler) ResetSettings(c *gin.Context) {
 
 // ExportSettings exports configuration as JSON
 func (h *AdminSettingsHandler) ExportSettings(c *gin.Context) {
-	rows, err := database.GetServerDB().Query("SELECT key, value FROM server_config ORDER BY key")
+	stored, err := h.Store.ListSettings(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to export settings",
 		})
 		return
 	}
-	defer rows.Close()
 
 	settings := make(map[string]string)
-	for rows.Next() {
-		var key, value string
-		if err := rows.Scan(&key, &value); err == nil {
-			settings[key] = value
-		}
+	for _, setting := range stored {
+		settings[setting.Key] = setting.Value
 	}
 
 	c.Header("Content-Disposition", "attachment; filename=weather-settings.json")
@@ -250,13 +218,7 @@ func (h *AdminSettingsHandler) ImportSettings(c *gin.Context) {
 
 	imported := 0
 	for key, value := range req.Settings {
-		_, err := database.GetServerDB().Exec(`
-			UPDATE server_config
-			SET value = ?, updated_at = CURRENT_TIMESTAMP
-			WHERE key = ?
-		`, value, key)
-
-		if err == nil {
+		if err := h.Store.UpdateSetting(c.Request.Context(), key, value); err == nil {
 			imported++
 		}
 	}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/apimgr/weather/src/server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdminSettingsHandlerUpdateAndExport(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	st.SetSetting("server.title", "Weather", "string")
+	st.SetSetting("backup.enabled", "false", "boolean")
+	st.SetSetting("backup.max_backups", "4", "number")
+	h := &AdminSettingsHandler{Store: st}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/settings", h.GetAllSettings)
+	r.PUT("/settings", h.UpdateSettings)
+	r.GET("/settings/export", h.ExportSettings)
+	r.POST("/settings/import", h.ImportSettings)
+
+	body := `{"settings": {"backup.enabled": true, "backup.max_backups": 7, "server.missing": "x"}}`
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/settings", strings.NewReader(body)))
+	var update struct {
+		Applied []string          `json:"applied"`
+		Failed  map[string]string `json:"failed"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &update); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	if len(update.Applied) != 2 || update.Failed["server.missing"] != "Setting not found" {
+		t.Errorf("update = %+v", update)
+	}
+	if setting, _ := st.GetSetting(ctx, "backup.max_backups"); setting.Value != "7" {
+		t.Errorf("backup.max_backups = %q, want 7", setting.Value)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/settings", nil))
+	var all struct {
+		Settings   map[string]interface{}   `json:"settings"`
+		Categories map[string][]interface{} `json:"categories"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("get: %d %s", w.Code, w.Body)
+	}
+	if all.Settings["backup.enabled"] != true || all.Settings["backup.max_backups"] != float64(7) {
+		t.Errorf("typed settings = %v", all.Settings)
+	}
+	if len(all.Categories["backup"]) != 2 {
+		t.Errorf("backup category = %v", all.Categories["backup"])
+	}
+
+	body = `{"settings": {"server.title": "Forecasts", "server.missing": "x"}}`
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/settings/import", strings.NewReader(body)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"imported":1`) {
+		t.Errorf("import: %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/settings/export", nil))
+	var export struct {
+		Settings map[string]string `json:"settings"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("export: %d %s", w.Code, w.Body)
+	}
+	if len(export.Settings) != 3 || export.Settings["server.title"] != "Forecasts" {
+		t.Errorf("export = %v", export.Settings)
+	}
+}
@@ -1,8 +1,12 @@
 package handler
 
 import (
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/apimgr/weather/src/server/service"
 	"github.com/apimgr/weather/src/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -10,13 +14,15 @@ import (
 // AdminWeatherHandler handles weather-specific settings
 type AdminWeatherHandler struct {
 	ConfigPath string
+	// Scores recorded forecasts for the verification section
+	Observations *service.ObservationService
 }
 
 // ShowWeatherSettings displays weather settings page
 func (h *AdminWeatherHandler) ShowWeatherSettings(c *gin.Context) {
-	c.HTML(http.StatusOK, "admin_weather.tmpl", gin.H{
+	c.HTML(http.StatusOK, "admin_weather.tmpl", utils.TemplateData(c, gin.H{
 		"title": "Weather Settings",
-	})
+	}))
 }
 
 // UpdateWeatherSettings updates weather settings in server.yml
@@ -80,3 +86,39 @@ func (h *AdminWeatherHandler) UpdateWeatherSettings(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"ok": true})
 }
+
+// GetForecastVerification scores the forecasts recorded over the last days
+// against the observations, per provider and lead time overall and for the
+// sites with the most verified days
+// GET /api/v1/{admin_path}/server/weather/verification?days=30&units=metric&sites=50
+func (h *AdminWeatherHandler) GetForecastVerification(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > maxDailyRangeDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and " + strconv.Itoa(maxDailyRangeDays)})
+		return
+	}
+	sites, err := strconv.Atoi(c.DefaultQuery("sites", "50"))
+	if err != nil || sites < 1 || sites > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sites must be between 1 and 1000"})
+		return
+	}
+	units := c.DefaultQuery("units", "metric")
+	if units != "metric" && units != "imperial" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "units must be metric or imperial"})
+		return
+	}
+
+	to := time.Now().UTC()
+	verification, err := h.Observations.Verification(c.Request.Context(), to.AddDate(0, 0, -days), to, sites, units)
+	if err != nil {
+		log.Printf("Forecast verification failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to score forecasts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":           true,
+		"units":        units,
+		"verification": verification,
+	})
+}
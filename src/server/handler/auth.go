@@ -1,7 +1,9 @@
 package handler
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -12,13 +14,15 @@ import (
 	"github.com/apimgr/weather/src/database"
 	"github.com/apimgr/weather/src/server/middleware"
 	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
 	"github.com/apimgr/weather/src/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthHandler struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Store store.Store
 }
 
 type CurrentUserProfileResponse struct {
@@ -83,6 +87,9 @@ func (h *AuthHandler) ShowLoginPage(c *gin.Context) {
 		"verified":           c.Query("verified") == "1",
 		"pendingVerification": c.Query("pending_verification") == "1",
 		"registrationPublic": isPublicRegistrationEnabled(),
+		"oidcProviders":      cfg.OIDCLoginProviders(false),
+		"ldapEnabled":        cfg.Server.Auth.LDAP.Enabled,
+		"redirect":           c.Query("redirect"),
 	}))
 }
 
@@ -102,7 +109,8 @@ func (h *AuthHandler) ShowRegisterPage(c *gin.Context) {
 	}
 
 	NegotiateResponse(c, "page/register.tmpl", utils.TemplateData(c, gin.H{
-		"title": "Register",
+		"title":              "Register",
+		"passwordlessSignup": models.LoadPasskeyPolicy().PasswordlessSignup,
 	}))
 }
 
@@ -192,18 +200,25 @@ func (h *AuthHandler) HandleLogin(c *gin.Context) {
 		return
 	}
 
-	// Step 2: Check user_accounts
+	// Step 2: Check user_accounts (failed passwords count towards a lockout)
+	login := requestLoginContext(c)
 	userModel := &models.UserModel{DB: h.DB}
-	user, err := userModel.GetByIdentifier(req.Identifier)
+	user, err := userModel.VerifyCredentials(req.Identifier, req.Password)
 	if err != nil {
-		respondWithError(c, http.StatusUnauthorized, "Invalid credentials")
-		return
-	}
-
-	if !userModel.CheckPassword(user, req.Password) {
-		respondWithError(c, http.StatusUnauthorized, "Invalid credentials")
+		err = credentialError(err, login)
+		var locked *models.AccountLockedError
+		switch {
+		case errors.As(err, &locked):
+			c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter().Seconds())))
+			respondWithError(c, http.StatusTooManyRequests, "Too many failed login attempts. Try again later")
+		case err.Error() == "Invalid credentials":
+			respondWithError(c, http.StatusUnauthorized, err.Error())
+		default:
+			respondWithError(c, http.StatusForbidden, err.Error())
+		}
 		return
 	}
+	notePasswordVerified(user, req.Password, login)
 
 	if requiresEmailVerification() && !user.EmailVerified {
 		respondWithError(c, http.StatusUnauthorized, "Invalid credentials")
@@ -256,21 +271,15 @@ func (h *AuthHandler) HandleLogin(c *gin.Context) {
 		}
 	}
 
-	// Get session timeout from settings
-	sessionTimeout, err := h.getSessionTimeout()
-	if err != nil {
-		// Default 30 days
-		sessionTimeout = 2592000
-	}
-
 	// Create user session
-	sessionModel := &models.SessionModel{DB: h.DB}
-	session, err := sessionModel.Create(user.ID, sessionTimeout)
+	session, sessionTimeout, err := startUserSession(c.Request.Context(), h.Store, user.ID)
 	if err != nil {
 		respondWithError(c, http.StatusInternalServerError, "Failed to create session")
 		return
 	}
 
+	noteLoginSucceeded(user, login)
+
 	// Set weather_session cookie (user sessions only)
 	http.SetCookie(c.Writer, &http.Cookie{
 		Name:     middleware.SessionCookieName,
@@ -344,6 +353,11 @@ func (h *AuthHandler) HandleRegister(c *gin.Context) {
 		return
 	}
 
+	if err := checkNewPassword(req.Password); err != nil {
+		respondWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	if err := utils.ValidateEmail(req.Email); err != nil {
 		respondWithError(c, http.StatusBadRequest, "Please enter a valid email address")
 		return
@@ -399,16 +413,8 @@ func (h *AuthHandler) HandleRegister(c *gin.Context) {
 		return
 	}
 
-	// Get session timeout from settings
-	sessionTimeout, err := h.getSessionTimeout()
-	if err != nil {
-		// Default 30 days
-		sessionTimeout = 2592000
-	}
-
 	// Auto-login after registration
-	sessionModel := &models.SessionModel{DB: h.DB}
-	session, err := sessionModel.Create(user.ID, sessionTimeout)
+	session, sessionTimeout, err := startUserSession(c.Request.Context(), h.Store, user.ID)
 	if err != nil {
 		respondWithError(c, http.StatusInternalServerError, "User created but failed to login")
 		return
@@ -455,8 +461,7 @@ func (h *AuthHandler) HandleLogout(c *gin.Context) {
 	// Get session from context
 	session, exists := middleware.GetCurrentSession(c)
 	if exists {
-		sessionModel := &models.SessionModel{DB: h.DB}
-		sessionModel.Delete(session.ID)
+		h.Store.DeleteSession(c.Request.Context(), session.ID)
 	}
 
 	// Clear session cookie
@@ -547,20 +552,32 @@ func UpdateCurrentUserProfile(db *sql.DB, userID int64, req *UpdateCurrentUserPr
 
 // Helper functions
 
-func (h *AuthHandler) getSessionTimeout() (int, error) {
-	var timeoutStr string
-
-	err := database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = ?", "auth.session_timeout").Scan(&timeoutStr)
+// sessionTimeoutSetting returns the auth.session_timeout setting in seconds
+func sessionTimeoutSetting(ctx context.Context, st store.Store) (int, error) {
+	setting, err := st.GetSetting(ctx, "auth.session_timeout")
 	if err != nil {
 		return 0, err
 	}
+	return strconv.Atoi(setting.Value)
+}
 
-	timeout, err := strconv.Atoi(timeoutStr)
+// startUserSession creates a web session for a user lasting the configured
+// session timeout, and returns it with that timeout in seconds
+func startUserSession(ctx context.Context, st store.Store, userID int64) (*models.Session, int, error) {
+	sessionTimeout, err := sessionTimeoutSetting(ctx, st)
 	if err != nil {
-		return 0, err
+		// Default 30 days
+		sessionTimeout = 2592000
 	}
 
-	return timeout, nil
+	session := &models.Session{
+		UserID:    int(userID),
+		ExpiresAt: time.Now().Add(time.Duration(sessionTimeout) * time.Second),
+	}
+	if err := st.CreateSession(ctx, session); err != nil {
+		return nil, 0, fmt.Errorf("failed to create session: %w", err)
+	}
+	return session, sessionTimeout, nil
 }
 
 func respondWithError(c *gin.Context, statusCode int, message string) {
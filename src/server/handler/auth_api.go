@@ -2,8 +2,11 @@
 package handler
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -13,6 +16,7 @@ import (
 	"github.com/apimgr/weather/src/server/middleware"
 	models "github.com/apimgr/weather/src/server/model"
 	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/server/store"
 	"github.com/apimgr/weather/src/utils"
 
 	"github.com/gin-gonic/gin"
@@ -20,12 +24,13 @@ import (
 
 // AuthAPIHandler handles auth API endpoints per AI.md PART 33
 type AuthAPIHandler struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Store store.Store
 }
 
 // NewAuthAPIHandler creates a new auth API handler
-func NewAuthAPIHandler(db *sql.DB) *AuthAPIHandler {
-	return &AuthAPIHandler{DB: db}
+func NewAuthAPIHandler(db *sql.DB, st store.Store) *AuthAPIHandler {
+	return &AuthAPIHandler{DB: db, Store: st}
 }
 
 // APILoginRequest represents login API request per AI.md PART 33
@@ -151,10 +156,12 @@ func validateAuthUser(user *models.User) error {
 	return nil
 }
 
-func createFullAuthSession(db *sql.DB, user *models.User) (*AuthLoginResponse, error) {
-	sessionModel := &models.SessionModel{DB: db}
-	session, err := sessionModel.Create(user.ID, authSessionTTLSeconds)
-	if err != nil {
+func createFullAuthSession(ctx context.Context, st store.Store, user *models.User) (*AuthLoginResponse, error) {
+	session := &models.Session{
+		UserID:    int(user.ID),
+		ExpiresAt: time.Now().Add(authSessionTTLSeconds * time.Second),
+	}
+	if err := st.CreateSession(ctx, session); err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
@@ -191,36 +198,31 @@ func userHasPasskeys(db *sql.DB, userID int64) (bool, error) {
 	return passkeyModel.HasPasskeys(userID)
 }
 
-func createPendingTwoFactorSession(db *sql.DB, userID int64) (*models.Session, error) {
-	sessionModel := &models.SessionModel{DB: db}
-	session, err := sessionModel.Create(userID, authPendingSessionTTLSeconds)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create pending session: %w", err)
-	}
-
-	if err := sessionModel.UpdateData(session.ID, map[string]interface{}{
-		"auth_stage":        authPendingStageTwoFactor,
-		"requires_2fa":      true,
-		"temporary_session": true,
-	}); err != nil {
-		_ = sessionModel.Delete(session.ID)
-		return nil, fmt.Errorf("failed to store pending session: %w", err)
+func createPendingTwoFactorSession(ctx context.Context, st store.Store, userID int64) (*models.Session, error) {
+	session := &models.Session{
+		UserID: int(userID),
+		Data: map[string]interface{}{
+			"auth_stage":        authPendingStageTwoFactor,
+			"requires_2fa":      true,
+			"temporary_session": true,
+		},
+		ExpiresAt: time.Now().Add(authPendingSessionTTLSeconds * time.Second),
 	}
-
-	session.Data = map[string]interface{}{
-		"auth_stage":        authPendingStageTwoFactor,
-		"requires_2fa":      true,
-		"temporary_session": true,
+	if err := st.CreateSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create pending session: %w", err)
 	}
 	return session, nil
 }
 
-func loadPendingTwoFactorSession(db *sql.DB, sessionToken string) (*models.Session, error) {
-	sessionModel := &models.SessionModel{DB: db}
-	session, err := sessionModel.GetByID(strings.TrimSpace(sessionToken))
+func loadPendingTwoFactorSession(ctx context.Context, st store.Store, sessionToken string) (*models.Session, error) {
+	session, err := st.GetSession(ctx, strings.TrimSpace(sessionToken))
 	if err != nil {
 		return nil, fmt.Errorf("invalid session token")
 	}
+	if time.Now().After(session.ExpiresAt) {
+		_ = st.DeleteSession(ctx, session.ID)
+		return nil, fmt.Errorf("invalid session token")
+	}
 	if session.Data == nil {
 		return nil, fmt.Errorf("invalid session token")
 	}
@@ -234,7 +236,7 @@ func loadPendingTwoFactorSession(db *sql.DB, sessionToken string) (*models.Sessi
 	return session, nil
 }
 
-func LoginAPIUser(db *sql.DB, req *APILoginRequest, clientIP string) (*AuthLoginResponse, error) {
+func LoginAPIUser(ctx context.Context, db *sql.DB, st store.Store, req *APILoginRequest, login service.LoginContext) (*AuthLoginResponse, error) {
 	req.Identifier = strings.TrimSpace(req.Identifier)
 
 	if req.Password != strings.TrimSpace(req.Password) {
@@ -242,18 +244,15 @@ func LoginAPIUser(db *sql.DB, req *APILoginRequest, clientIP string) (*AuthLogin
 	}
 
 	userModel := &models.UserModel{DB: db}
-	user, err := userModel.GetByIdentifier(req.Identifier)
+	user, err := userModel.VerifyCredentials(req.Identifier, req.Password)
 	if err != nil {
-		return nil, fmt.Errorf("Invalid credentials")
-	}
-
-	if !userModel.CheckPassword(user, req.Password) {
-		return nil, fmt.Errorf("Invalid credentials")
+		return nil, credentialError(err, login)
 	}
 
 	if err := validateAuthUser(user); err != nil {
 		return nil, err
 	}
+	notePasswordVerified(user, req.Password, login)
 
 	hasPasskeys, err := userHasPasskeys(db, user.ID)
 	if err != nil {
@@ -262,16 +261,16 @@ func LoginAPIUser(db *sql.DB, req *APILoginRequest, clientIP string) (*AuthLogin
 
 	if user.TwoFactorEnabled || hasPasskeys {
 		if req.RecoveryKey != "" {
-			return loginWithRecoveryKey(db, user, req.RecoveryKey, clientIP)
+			return loginWithRecoveryKey(ctx, db, st, user, req.RecoveryKey, login)
 		}
 		if req.TwoFactorCode != "" {
 			if !user.TwoFactorEnabled {
 				return nil, fmt.Errorf("Invalid two-factor code")
 			}
-			return loginWithTwoFactorCode(db, user, req.TwoFactorCode, clientIP)
+			return loginWithTwoFactorCode(ctx, db, st, user, req.TwoFactorCode, login)
 		}
 
-		pendingSession, err := createPendingTwoFactorSession(db, user.ID)
+		pendingSession, err := createPendingTwoFactorSession(ctx, st, user.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -282,38 +281,40 @@ func LoginAPIUser(db *sql.DB, req *APILoginRequest, clientIP string) (*AuthLogin
 		}, nil
 	}
 
-	response, err := createFullAuthSession(db, user)
+	response, err := createFullAuthSession(ctx, st, user)
 	if err != nil {
 		return nil, err
 	}
-	_ = userModel.UpdateLastLogin(user.ID, clientIP)
+	_ = userModel.UpdateLastLogin(user.ID, login.IP)
+	noteLoginSucceeded(user, login)
 	return response, nil
 }
 
-func loginWithTwoFactorCode(db *sql.DB, user *models.User, code string, clientIP string) (*AuthLoginResponse, error) {
+func loginWithTwoFactorCode(ctx context.Context, db *sql.DB, st store.Store, user *models.User, code string, login service.LoginContext) (*AuthLoginResponse, error) {
 	verified, err := utils.VerifyTOTP(user.TwoFactorSecret, code)
 	if err != nil || !verified {
 		return nil, fmt.Errorf("Invalid two-factor code")
 	}
 
-	response, err := createFullAuthSession(db, user)
+	response, err := createFullAuthSession(ctx, st, user)
 	if err != nil {
 		return nil, err
 	}
 
 	userModel := &models.UserModel{DB: db}
-	_ = userModel.UpdateLastLogin(user.ID, clientIP)
+	_ = userModel.UpdateLastLogin(user.ID, login.IP)
+	noteLoginSucceeded(user, login)
 	return response, nil
 }
 
-func loginWithRecoveryKey(db *sql.DB, user *models.User, recoveryKey string, clientIP string) (*AuthLoginResponse, error) {
+func loginWithRecoveryKey(ctx context.Context, db *sql.DB, st store.Store, user *models.User, recoveryKey string, login service.LoginContext) (*AuthLoginResponse, error) {
 	recoveryKeyModel := &models.RecoveryKeyModel{DB: db}
 	verified, err := recoveryKeyModel.VerifyAndUseRecoveryKey(int(user.ID), recoveryKey)
 	if err != nil || !verified {
 		return nil, fmt.Errorf("Invalid recovery key")
 	}
 
-	response, err := createFullAuthSession(db, user)
+	response, err := createFullAuthSession(ctx, st, user)
 	if err != nil {
 		return nil, err
 	}
@@ -325,12 +326,13 @@ func loginWithRecoveryKey(db *sql.DB, user *models.User, recoveryKey string, cli
 	response.RemainingKeys = &remainingKeys
 
 	userModel := &models.UserModel{DB: db}
-	_ = userModel.UpdateLastLogin(user.ID, clientIP)
+	_ = userModel.UpdateLastLogin(user.ID, login.IP)
+	noteLoginSucceeded(user, login)
 	return response, nil
 }
 
-func CompleteAPIUserTwoFactor(db *sql.DB, req *API2FARequest, clientIP string) (*AuthLoginResponse, error) {
-	pendingSession, err := loadPendingTwoFactorSession(db, req.SessionToken)
+func CompleteAPIUserTwoFactor(ctx context.Context, db *sql.DB, st store.Store, req *API2FARequest, login service.LoginContext) (*AuthLoginResponse, error) {
+	pendingSession, err := loadPendingTwoFactorSession(ctx, st, req.SessionToken)
 	if err != nil {
 		return nil, err
 	}
@@ -345,19 +347,18 @@ func CompleteAPIUserTwoFactor(db *sql.DB, req *API2FARequest, clientIP string) (
 		return nil, err
 	}
 
-	response, err := loginWithTwoFactorCode(db, user, req.TwoFactorCode, clientIP)
+	response, err := loginWithTwoFactorCode(ctx, db, st, user, req.TwoFactorCode, login)
 	if err != nil {
 		return nil, err
 	}
 
-	sessionModel := &models.SessionModel{DB: db}
-	_ = sessionModel.Delete(pendingSession.ID)
+	_ = st.DeleteSession(ctx, pendingSession.ID)
 
 	return response, nil
 }
 
-func UseAPIUserRecoveryKey(db *sql.DB, req *APIRecoveryUseRequest, clientIP string) (*AuthLoginResponse, error) {
-	pendingSession, err := loadPendingTwoFactorSession(db, req.SessionToken)
+func UseAPIUserRecoveryKey(ctx context.Context, db *sql.DB, st store.Store, req *APIRecoveryUseRequest, login service.LoginContext) (*AuthLoginResponse, error) {
+	pendingSession, err := loadPendingTwoFactorSession(ctx, st, req.SessionToken)
 	if err != nil {
 		return nil, err
 	}
@@ -372,18 +373,17 @@ func UseAPIUserRecoveryKey(db *sql.DB, req *APIRecoveryUseRequest, clientIP stri
 		return nil, err
 	}
 
-	response, err := loginWithRecoveryKey(db, user, req.RecoveryKey, clientIP)
+	response, err := loginWithRecoveryKey(ctx, db, st, user, req.RecoveryKey, login)
 	if err != nil {
 		return nil, err
 	}
 
-	sessionModel := &models.SessionModel{DB: db}
-	_ = sessionModel.Delete(pendingSession.ID)
+	_ = st.DeleteSession(ctx, pendingSession.ID)
 
 	return response, nil
 }
 
-func RegisterAPIUser(db *sql.DB, req *APIRegisterRequest) (*AuthRegisterResponse, error) {
+func RegisterAPIUser(ctx context.Context, db *sql.DB, st store.Store, req *APIRegisterRequest) (*AuthRegisterResponse, error) {
 	if !config.IsMultiUserEnabled() {
 		return nil, fmt.Errorf("Registration is not available")
 	}
@@ -403,6 +403,9 @@ func RegisterAPIUser(db *sql.DB, req *APIRegisterRequest) (*AuthRegisterResponse
 	if len(req.Password) < 8 {
 		return nil, fmt.Errorf("Password must be at least 8 characters")
 	}
+	if err := checkNewPassword(req.Password); err != nil {
+		return nil, err
+	}
 
 	userModel := &models.UserModel{DB: db}
 	user, err := userModel.Create(utils.NormalizeUsername(req.Username), req.Email, req.Password, "user")
@@ -425,7 +428,7 @@ func RegisterAPIUser(db *sql.DB, req *APIRegisterRequest) (*AuthRegisterResponse
 		return response, nil
 	}
 
-	sessionResponse, err := createFullAuthSession(db, user)
+	sessionResponse, err := createFullAuthSession(ctx, st, user)
 	if err != nil {
 		return nil, fmt.Errorf("Account created but failed to login")
 	}
@@ -434,30 +437,28 @@ func RegisterAPIUser(db *sql.DB, req *APIRegisterRequest) (*AuthRegisterResponse
 	return response, nil
 }
 
-func LogoutCurrentUserSession(db *sql.DB, session *models.Session) error {
+func LogoutCurrentUserSession(ctx context.Context, st store.Store, session *models.Session) error {
 	if session == nil {
 		return fmt.Errorf("Session authentication required")
 	}
 
-	sessionModel := &models.SessionModel{DB: db}
-	if err := sessionModel.Delete(session.ID); err != nil {
+	if err := st.DeleteSession(ctx, session.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
 
 	return nil
 }
 
-func RefreshCurrentUserSession(db *sql.DB, session *models.Session, user *models.User) (*AuthLoginResponse, error) {
+func RefreshCurrentUserSession(ctx context.Context, st store.Store, session *models.Session, user *models.User) (*AuthLoginResponse, error) {
 	if session == nil || user == nil {
 		return nil, fmt.Errorf("Session authentication required")
 	}
 
-	sessionModel := &models.SessionModel{DB: db}
-	if err := sessionModel.Delete(session.ID); err != nil {
+	if err := st.DeleteSession(ctx, session.ID); err != nil {
 		return nil, fmt.Errorf("failed to refresh session")
 	}
 
-	response, err := createFullAuthSession(db, user)
+	response, err := createFullAuthSession(ctx, st, user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to refresh session")
 	}
@@ -465,37 +466,26 @@ func RefreshCurrentUserSession(db *sql.DB, session *models.Session, user *models
 	return response, nil
 }
 
-func VerifyAPIUserEmail(db *sql.DB, req *APIVerifyEmailRequest) error {
-	var verification struct {
-		ID        int64
-		UserID    int64
-		Email     string
-		ExpiresAt time.Time
-	}
-
-	err := db.QueryRow(`
-		SELECT id, user_id, email, expires_at
-		FROM user_email_verifications
-		WHERE token = ? AND expires_at > ?
-	`, strings.TrimSpace(req.Token), time.Now()).Scan(&verification.ID, &verification.UserID, &verification.Email, &verification.ExpiresAt)
-	if err != nil {
+func VerifyAPIUserEmail(ctx context.Context, st store.Store, req *APIVerifyEmailRequest) error {
+	verification, err := st.GetEmailVerification(ctx, strings.TrimSpace(req.Token))
+	if err != nil || time.Now().After(verification.ExpiresAt) {
 		return fmt.Errorf("Invalid or expired verification token")
 	}
 
-	_, err = db.Exec(`
-		UPDATE user_accounts
-		SET email_verified = 1, updated_at = ?
-		WHERE id = ?
-	`, time.Now(), verification.UserID)
+	user, err := st.GetUserByID(ctx, verification.UserID)
 	if err != nil {
 		return fmt.Errorf("Failed to verify email")
 	}
+	user.EmailVerified = true
+	if err := st.UpdateUser(ctx, user); err != nil {
+		return fmt.Errorf("Failed to verify email")
+	}
 
-	_, _ = db.Exec(`DELETE FROM user_email_verifications WHERE id = ?`, verification.ID)
+	_ = st.DeleteEmailVerification(ctx, verification.ID)
 	return nil
 }
 
-func RequestAPIUserPasswordReset(db *sql.DB, req *APIPasswordForgotRequest, resetContext *APIPasswordResetContext) error {
+func RequestAPIUserPasswordReset(db *sql.DB, st store.Store, req *APIPasswordForgotRequest, resetContext *APIPasswordResetContext) error {
 	email := strings.TrimSpace(req.Email)
 	if err := utils.ValidateEmail(email); err != nil {
 		return fmt.Errorf("Invalid email format")
@@ -508,16 +498,12 @@ func RequestAPIUserPasswordReset(db *sql.DB, req *APIPasswordForgotRequest, rese
 		fullHost = strings.TrimSpace(resetContext.FullHost)
 	}
 
+	// The request has returned by the time this runs, so it gets its own
+	// context
 	go func(emailAddress string, requestIP string, baseURL string) {
-		var user struct {
-			ID    int64
-			Email string
-		}
-
-		err := db.QueryRow(`
-			SELECT id, email FROM user_accounts WHERE email = ? AND is_active = 1
-		`, emailAddress).Scan(&user.ID, &user.Email)
-		if err != nil {
+		ctx := context.Background()
+		user, err := st.GetUserByEmail(ctx, emailAddress)
+		if err != nil || !user.IsActive {
 			return
 		}
 
@@ -526,10 +512,12 @@ func RequestAPIUserPasswordReset(db *sql.DB, req *APIPasswordForgotRequest, rese
 			return
 		}
 
-		_, err = db.Exec(`
-			INSERT INTO user_password_resets (user_id, token, ip_address, created_at, expires_at)
-			VALUES (?, ?, ?, ?, ?)
-		`, user.ID, token, requestIP, time.Now(), time.Now().Add(1*time.Hour))
+		err = st.CreatePasswordReset(ctx, &models.UserPasswordReset{
+			UserID:    user.ID,
+			Token:     token,
+			IPAddress: requestIP,
+			ExpiresAt: time.Now().Add(1 * time.Hour),
+		})
 		if err != nil {
 			return
 		}
@@ -558,23 +546,16 @@ func RequestAPIUserPasswordReset(db *sql.DB, req *APIPasswordForgotRequest, rese
 	return nil
 }
 
-func ResetAPIUserPassword(db *sql.DB, req *APIPasswordResetRequest) error {
+func ResetAPIUserPassword(ctx context.Context, db *sql.DB, st store.Store, req *APIPasswordResetRequest) error {
 	if len(req.Password) < 8 {
 		return fmt.Errorf("Invalid request format")
 	}
-
-	var reset struct {
-		ID        int64
-		UserID    int64
-		ExpiresAt time.Time
+	if err := checkNewPassword(req.Password); err != nil {
+		return err
 	}
 
-	err := db.QueryRow(`
-		SELECT id, user_id, expires_at
-		FROM user_password_resets
-		WHERE token = ? AND expires_at > ?
-	`, strings.TrimSpace(req.Token), time.Now()).Scan(&reset.ID, &reset.UserID, &reset.ExpiresAt)
-	if err != nil {
+	reset, err := st.GetPasswordReset(ctx, strings.TrimSpace(req.Token))
+	if err != nil || time.Now().After(reset.ExpiresAt) {
 		return fmt.Errorf("Invalid or expired reset token")
 	}
 
@@ -583,17 +564,19 @@ func ResetAPIUserPassword(db *sql.DB, req *APIPasswordResetRequest) error {
 		return fmt.Errorf("Failed to process password")
 	}
 
-	_, err = db.Exec(`
-		UPDATE user_accounts
-		SET password_hash = ?, updated_at = ?
-		WHERE id = ?
-	`, hashedPassword, time.Now(), reset.UserID)
+	user, err := st.GetUserByID(ctx, reset.UserID)
 	if err != nil {
 		return fmt.Errorf("Failed to reset password")
 	}
+	user.PasswordHash = hashedPassword
+	if err := st.UpdateUser(ctx, user); err != nil {
+		return fmt.Errorf("Failed to reset password")
+	}
 
-	_, _ = db.Exec(`DELETE FROM user_password_resets WHERE id = ?`, reset.ID)
-	_, _ = db.Exec(`DELETE FROM user_sessions WHERE user_id = ?`, reset.UserID)
+	_ = st.DeletePasswordReset(ctx, reset.ID)
+	_, _ = st.DeleteUserSessions(ctx, reset.UserID)
+	_ = (&models.LoginStateModel{DB: db}).Unlock(reset.UserID)
+	_ = (&models.LoginStateModel{DB: db}).ClearBreachNotified(reset.UserID)
 	return nil
 }
 
@@ -617,7 +600,7 @@ func ValidateAPIUserInvite(db *sql.DB, token string) (*UserInviteValidationRespo
 	}, nil
 }
 
-func CompleteAPIUserInvite(db *sql.DB, token string, username string, password string) (*UserInviteCompletionResponse, error) {
+func CompleteAPIUserInvite(ctx context.Context, db *sql.DB, st store.Store, token string, username string, password string) (*UserInviteCompletionResponse, error) {
 	token = strings.TrimSpace(token)
 	if token == "" {
 		return nil, fmt.Errorf("Token required")
@@ -641,6 +624,9 @@ func CompleteAPIUserInvite(db *sql.DB, token string, username string, password s
 	if invite.Email == "" {
 		return nil, fmt.Errorf("Invite is missing an email address")
 	}
+	if err := checkNewPassword(password); err != nil {
+		return nil, err
+	}
 
 	userModel := &models.UserModel{DB: db}
 	user, err := userModel.Create(username, invite.Email, password, invite.Role)
@@ -648,16 +634,21 @@ func CompleteAPIUserInvite(db *sql.DB, token string, username string, password s
 		return nil, fmt.Errorf("Failed to create account")
 	}
 
-	if _, err := db.Exec(`UPDATE user_accounts SET email_verified = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, user.ID); err != nil {
+	// The invite went to this address, so it is already verified
+	user.EmailVerified = true
+	if err := st.UpdateUser(ctx, user); err != nil {
 		return nil, fmt.Errorf("Failed to finalize account")
 	}
 
 	if err := inviteModel.MarkUsed(token, user.ID); err != nil {
 		return nil, fmt.Errorf("Failed to finalize invite")
 	}
+	// Organization invites also add the new account to the organization
+	if err := (&models.OrgModel{DB: db}).JoinFromInvite(invite.ID, user.ID); err != nil {
+		log.Printf("Failed to add user %d to invited organization: %v", user.ID, err)
+	}
 
-	sessionModel := &models.SessionModel{DB: db}
-	session, err := sessionModel.Create(user.ID, authSessionTTLSeconds)
+	session, err := createFullAuthSession(ctx, st, user)
 	if err != nil {
 		return &UserInviteCompletionResponse{
 			Message: "Account created. Please log in.",
@@ -665,8 +656,8 @@ func CompleteAPIUserInvite(db *sql.DB, token string, username string, password s
 	}
 
 	return &UserInviteCompletionResponse{
-		Token: session.ID,
-		User:  buildAuthUserSummary(user),
+		Token: session.Token,
+		User:  session.User,
 	}, nil
 }
 
@@ -721,8 +712,12 @@ func (h *AuthAPIHandler) HandleAPILogin(c *gin.Context) {
 		return
 	}
 
-	response, err := LoginAPIUser(h.DB, &req, c.ClientIP())
+	response, err := LoginAPIUser(c.Request.Context(), h.DB, h.Store, &req, requestLoginContext(c))
 	if err != nil {
+		if respondAccountLocked(c, err) {
+			return
+		}
+
 		status := http.StatusUnauthorized
 		switch err.Error() {
 		case "Password cannot start or end with whitespace":
@@ -761,7 +756,7 @@ func (h *AuthAPIHandler) HandleAPIRegister(c *gin.Context) {
 		return
 	}
 
-	response, err := RegisterAPIUser(h.DB, &req)
+	response, err := RegisterAPIUser(c.Request.Context(), h.DB, h.Store, &req)
 	if err != nil {
 		status := http.StatusInternalServerError
 		switch err.Error() {
@@ -769,7 +764,7 @@ func (h *AuthAPIHandler) HandleAPIRegister(c *gin.Context) {
 			status = http.StatusNotFound
 		case "Username or email already exists":
 			status = http.StatusConflict
-		case "Password must be at least 8 characters":
+		case "Password must be at least 8 characters", service.ErrPasswordBreached.Error():
 			status = http.StatusBadRequest
 		default:
 			if strings.HasPrefix(err.Error(), "Username") || strings.HasPrefix(err.Error(), "Email") {
@@ -801,7 +796,7 @@ func (h *AuthAPIHandler) HandleAPILogout(c *gin.Context) {
 		return
 	}
 
-	if err := LogoutCurrentUserSession(h.DB, session); err != nil {
+	if err := LogoutCurrentUserSession(c.Request.Context(), h.Store, session); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"ok":    false,
 			"error": err.Error(),
@@ -827,7 +822,7 @@ func (h *AuthAPIHandler) HandleAPI2FA(c *gin.Context) {
 		return
 	}
 
-	response, err := CompleteAPIUserTwoFactor(h.DB, &req, c.ClientIP())
+	response, err := CompleteAPIUserTwoFactor(c.Request.Context(), h.DB, h.Store, &req, requestLoginContext(c))
 	if err != nil {
 		status := http.StatusUnauthorized
 		if err.Error() == "Invalid request format" {
@@ -861,7 +856,7 @@ func (h *AuthAPIHandler) HandleAPIRecoveryUse(c *gin.Context) {
 		return
 	}
 
-	response, err := UseAPIUserRecoveryKey(h.DB, &req, c.ClientIP())
+	response, err := UseAPIUserRecoveryKey(c.Request.Context(), h.DB, h.Store, &req, requestLoginContext(c))
 	if err != nil {
 		status := http.StatusUnauthorized
 		if strings.Contains(err.Error(), "failed to create session") || strings.Contains(err.Error(), "failed to load remaining recovery keys") {
@@ -901,7 +896,7 @@ func (h *AuthAPIHandler) HandleAPIRefresh(c *gin.Context) {
 		return
 	}
 
-	response, err := RefreshCurrentUserSession(h.DB, session, user)
+	response, err := RefreshCurrentUserSession(c.Request.Context(), h.Store, session, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"ok":    false,
@@ -928,7 +923,7 @@ func (h *AuthAPIHandler) HandleAPIVerifyEmail(c *gin.Context) {
 		return
 	}
 
-	if err := VerifyAPIUserEmail(h.DB, &req); err != nil {
+	if err := VerifyAPIUserEmail(c.Request.Context(), h.Store, &req); err != nil {
 		status := http.StatusBadRequest
 		if err.Error() == "Failed to verify email" {
 			status = http.StatusInternalServerError
@@ -958,7 +953,7 @@ func (h *AuthAPIHandler) HandleAPIPasswordForgot(c *gin.Context) {
 		return
 	}
 
-	if err := RequestAPIUserPasswordReset(h.DB, &req, &APIPasswordResetContext{
+	if err := RequestAPIUserPasswordReset(h.DB, h.Store, &req, &APIPasswordResetContext{
 		ClientIP: c.ClientIP(),
 		FullHost: utils.GetHostInfo(c).FullHost,
 	}); err != nil {
@@ -989,7 +984,7 @@ func (h *AuthAPIHandler) HandleAPIPasswordReset(c *gin.Context) {
 		return
 	}
 
-	if err := ResetAPIUserPassword(h.DB, &req); err != nil {
+	if err := ResetAPIUserPassword(c.Request.Context(), h.DB, h.Store, &req); err != nil {
 		status := http.StatusBadRequest
 		if err.Error() == "Failed to process password" || err.Error() == "Failed to reset password" {
 			status = http.StatusInternalServerError
@@ -1043,7 +1038,7 @@ func (h *AuthAPIHandler) HandleAPIUserInviteComplete(c *gin.Context) {
 		return
 	}
 
-	response, err := CompleteAPIUserInvite(h.DB, c.Param("token"), req.Username, req.Password)
+	response, err := CompleteAPIUserInvite(c.Request.Context(), h.DB, h.Store, c.Param("token"), req.Username, req.Password)
 	if err != nil {
 		status := http.StatusBadRequest
 		switch err.Error() {
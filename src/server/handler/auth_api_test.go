@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
+)
+
+func TestStartUserSessionUsesTimeoutSetting(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	user := &models.User{Username: "alice", Email: "alice@example.com"}
+	if err := st.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unset falls back to 30 days
+	session, timeout, err := startUserSession(ctx, st, user.ID)
+	if err != nil || timeout != 2592000 {
+		t.Fatalf("startUserSession = %d, %v", timeout, err)
+	}
+
+	st.SetSetting("auth.session_timeout", "3600", "number")
+	session, timeout, err = startUserSession(ctx, st, user.ID)
+	if err != nil || timeout != 3600 {
+		t.Fatalf("startUserSession = %d, %v", timeout, err)
+	}
+	stored, err := st.GetSession(ctx, session.ID)
+	if err != nil || stored.UserID != int(user.ID) || time.Until(stored.ExpiresAt) > time.Hour {
+		t.Errorf("stored session = %+v, %v", stored, err)
+	}
+
+	if err := LogoutCurrentUserSession(ctx, st, session); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.GetSession(ctx, session.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("session after logout: %v", err)
+	}
+	// Logging out twice is not an error
+	if err := LogoutCurrentUserSession(ctx, st, session); err != nil {
+		t.Errorf("second logout = %v", err)
+	}
+}
+
+func TestPendingTwoFactorSession(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	user := &models.User{Username: "alice", Email: "alice@example.com"}
+	if err := st.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := createPendingTwoFactorSession(ctx, st, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadPendingTwoFactorSession(ctx, st, " "+pending.ID+" ")
+	if err != nil || loaded.UserID != int(user.ID) {
+		t.Fatalf("loadPendingTwoFactorSession = %+v, %v", loaded, err)
+	}
+
+	// A full session is not a pending one
+	full, err := createFullAuthSession(ctx, st, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPendingTwoFactorSession(ctx, st, full.Token); err == nil {
+		t.Error("full session accepted as pending")
+	}
+
+	expired := &models.Session{
+		UserID:    int(user.ID),
+		Data:      pending.Data,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	if err := st.CreateSession(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPendingTwoFactorSession(ctx, st, expired.ID); err == nil {
+		t.Error("expired pending session accepted")
+	}
+	if _, err := st.GetSession(ctx, expired.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expired pending session kept: %v", err)
+	}
+}
+
+func TestVerifyAPIUserEmail(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	user := &models.User{Username: "alice", Email: "alice@example.com"}
+	if err := st.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []*models.UserEmailVerification{
+		{UserID: user.ID, Email: user.Email, Token: "expired", ExpiresAt: time.Now().Add(-time.Hour)},
+		{UserID: user.ID, Email: user.Email, Token: "valid", ExpiresAt: time.Now().Add(time.Hour)},
+	} {
+		if err := st.CreateEmailVerification(ctx, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, token := range []string{"expired", "unknown"} {
+		if err := VerifyAPIUserEmail(ctx, st, &APIVerifyEmailRequest{Token: token}); err == nil {
+			t.Errorf("token %q accepted", token)
+		}
+	}
+	if got, _ := st.GetUserByID(ctx, user.ID); got.EmailVerified {
+		t.Fatal("email verified by a rejected token")
+	}
+
+	if err := VerifyAPIUserEmail(ctx, st, &APIVerifyEmailRequest{Token: "valid"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := st.GetUserByID(ctx, user.ID); !got.EmailVerified {
+		t.Error("email not verified")
+	}
+	if _, err := st.GetEmailVerification(ctx, "valid"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("used verification kept: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/apimgr/weather/src/cluster"
+	"github.com/apimgr/weather/src/utils"
+)
+
+// Drift checks against all peers must finish within this time
+const clusterDriftTimeout = 10 * time.Second
+
+// ClusterSyncHandler serves the node-to-node config sync API and the admin
+// cluster node overview. Both fields are nil when cluster mode is disabled.
+type ClusterSyncHandler struct {
+	Sync    *cluster.ConfigSync
+	Manager *cluster.ClusterManager
+}
+
+// NewClusterSyncHandler creates a new cluster sync handler
+func NewClusterSyncHandler(configSync *cluster.ConfigSync, manager *cluster.ClusterManager) *ClusterSyncHandler {
+	return &ClusterSyncHandler{
+		Sync:    configSync,
+		Manager: manager,
+	}
+}
+
+// authenticateNode verifies the calling node and returns the request body
+func (h *ClusterSyncHandler) authenticateNode(c *gin.Context) ([]byte, bool) {
+	if h.Sync == nil {
+		NotFound(c, "cluster mode is disabled")
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 64<<20))
+	if err != nil {
+		BadRequest(c, "failed to read request body")
+		return nil, false
+	}
+	nodeID, err := h.Sync.Authenticate(c.Request, body)
+	if err != nil {
+		Unauthorized(c, err.Error())
+		return nil, false
+	}
+	h.Sync.TouchNode(nodeID, c.GetHeader(cluster.HeaderClusterAddress))
+	return body, true
+}
+
+// GetChanges returns config changes recorded after ?since=<seq>
+// GET /api/v1/cluster/sync/changes
+func (h *ClusterSyncHandler) GetChanges(c *gin.Context) {
+	if _, ok := h.authenticateNode(c); !ok {
+		return
+	}
+
+	since, _ := strconv.ParseInt(c.Query("since"), 10, 64)
+	set, err := h.Sync.ChangesSince(since)
+	if err != nil {
+		InternalError(c, "failed to read changes: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, set)
+}
+
+// PostChanges applies a change set pushed by another node
+// POST /api/v1/cluster/sync/changes
+func (h *ClusterSyncHandler) PostChanges(c *gin.Context) {
+	body, ok := h.authenticateNode(c)
+	if !ok {
+		return
+	}
+
+	var set cluster.ChangeSet
+	if err := json.Unmarshal(body, &set); err != nil {
+		BadRequest(c, "invalid change set")
+		return
+	}
+	applied, err := h.Sync.ApplyChangeSet(&set, false)
+	if err != nil {
+		InternalError(c, "failed to apply changes: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "node": h.Sync.NodeID(), "applied": applied})
+}
+
+// GetDigest returns the current version of every replicated item
+// GET /api/v1/cluster/sync/digest
+func (h *ClusterSyncHandler) GetDigest(c *gin.Context) {
+	if _, ok := h.authenticateNode(c); !ok {
+		return
+	}
+
+	entries, err := h.Sync.Digest()
+	if err != nil {
+		InternalError(c, "failed to read digest: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// clusterNodeStatus is a node with its config drift relative to this node
+type clusterNodeStatus struct {
+	ID            string             `json:"id"`
+	Address       string             `json:"address"`
+	State         string             `json:"state"`
+	Healthy       bool               `json:"healthy"`
+	LastHeartbeat time.Time          `json:"last_heartbeat"`
+	Self          bool               `json:"self"`
+	Drift         *cluster.NodeDrift `json:"drift,omitempty"`
+	DriftError    string             `json:"drift_error,omitempty"`
+}
+
+// nodeStatuses lists cluster nodes and checks drift against each healthy peer
+func (h *ClusterSyncHandler) nodeStatuses() ([]*clusterNodeStatus, error) {
+	if h.Manager == nil {
+		return []*clusterNodeStatus{}, nil
+	}
+
+	nodes, err := h.Manager.GetClusterInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*clusterNodeStatus, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		status := &clusterNodeStatus{
+			ID:            node.ID,
+			Address:       node.Address,
+			State:         string(node.State),
+			Healthy:       node.IsHealthy,
+			LastHeartbeat: node.LastHeartbeat,
+			Self:          node.ID == h.Manager.NodeID(),
+		}
+		statuses[i] = status
+
+		if status.Self || h.Sync == nil || node.Address == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			drift, err := h.Sync.Drift(status.Address)
+			if err != nil {
+				status.DriftError = err.Error()
+				return
+			}
+			status.Drift = drift
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return statuses, nil
+	case <-time.After(clusterDriftTimeout):
+		// Report what finished; slow peers show as timed out
+		result := make([]*clusterNodeStatus, len(statuses))
+		for i, s := range statuses {
+			copied := *s
+			if !copied.Self && copied.Drift == nil && copied.DriftError == "" && copied.Address != "" {
+				copied.DriftError = "timed out"
+			}
+			result[i] = &copied
+		}
+		return result, nil
+	}
+}
+
+// ListNodes returns cluster nodes with per-node config drift
+// GET /api/v1/{admin_path}/server/cluster/nodes
+func (h *ClusterSyncHandler) ListNodes(c *gin.Context) {
+	statuses, err := h.nodeStatuses()
+	if err != nil {
+		InternalError(c, "failed to list cluster nodes: "+err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "enabled": h.Manager != nil, "nodes": statuses})
+}
+
+// ShowNodesPage renders the cluster node overview
+// GET /{admin_path}/server/cluster/nodes
+func (h *ClusterSyncHandler) ShowNodesPage(c *gin.Context) {
+	statuses, err := h.nodeStatuses()
+	data := gin.H{
+		"title":          "Cluster Nodes - Admin",
+		"page":           "server-cluster-nodes",
+		"clusterEnabled": h.Manager != nil,
+		"nodes":          statuses,
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	c.HTML(http.StatusOK, "admin/admin_cluster_nodes.tmpl", utils.TemplateData(c, data))
+}
@@ -4,16 +4,17 @@ import (
 	"database/sql"
 	"net/http"
 
-	"github.com/apimgr/weather/src/database"
 	"github.com/apimgr/weather/src/server/middleware"
 	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
 	"github.com/apimgr/weather/src/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type DashboardHandler struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Store store.Store
 }
 
 // ShowDashboard renders the user dashboard
@@ -25,8 +26,7 @@ func (h *DashboardHandler) ShowDashboard(c *gin.Context) {
 	}
 
 	// Get user's saved locations
-	locationModel := &models.LocationModel{DB: h.DB}
-	locations, err := locationModel.GetByUserID(int(user.ID))
+	locations, err := h.Store.ListUserLocations(c.Request.Context(), user.ID)
 	if err != nil {
 		// Empty array on error
 		locations = []*models.SavedLocation{}
@@ -63,29 +63,25 @@ func (h *DashboardHandler) ShowAdminPanel(c *gin.Context) {
 		return
 	}
 
-	adminModel := &models.AdminModel{DB: database.GetServerDB()}
-	admin, err := adminModel.GetByID(int64(adminID))
+	admin, err := h.Store.GetAdminByID(c.Request.Context(), int64(adminID))
 	if err != nil {
 		c.Redirect(http.StatusFound, "/admin")
 		return
 	}
 
 	// Get system statistics
-	userModel := &models.UserModel{DB: h.DB}
-
-	totalUsers, _ := userModel.Count()
-	adminCount, _ := userModel.CountByRole("admin")
-
-	// Count total locations across all users
-	var totalLocations int
-	h.DB.QueryRow("SELECT COUNT(*) FROM user_saved_locations").Scan(&totalLocations)
+	stats, err := h.Store.Stats(c.Request.Context())
+	if err != nil {
+		stats = &store.Stats{}
+	}
+	adminCount, _ := h.Store.CountUsers(c.Request.Context(), "admin")
 
 	c.HTML(http.StatusOK, "admin/admin.tmpl", utils.TemplateData(c, gin.H{
 		"title":          "Admin Panel - Weather Service",
 		"user":           admin,
-		"totalUsers":     totalUsers,
+		"totalUsers":     stats.Users,
 		"adminCount":     adminCount,
-		"totalLocations": totalLocations,
+		"totalLocations": stats.Locations,
 		"page":           "admin",
 	}))
 }
@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/apimgr/weather/src/server/middleware"
+	models "github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/service"
+)
+
+const (
+	// Comment line sent when no event was written for this long, so proxies
+	// keep the connection open
+	eventsHeartbeatInterval = 15 * time.Second
+	// Client reconnect delay advertised in the stream (milliseconds)
+	eventsRetryMillis = 5000
+	// Default radius for alerts near saved locations
+	eventsAlertRadiusMiles = 50.0
+)
+
+// eventTopics maps SSE topic names to hub message types
+var eventTopics = map[string]string{
+	"notifications": service.HubMessageNotification,
+	"alerts":        service.HubMessageSevereWeatherAlert,
+	"earthquakes":   service.HubMessageEarthquake,
+	"system":        service.HubMessageSystem,
+}
+
+// EventsHandler streams hub events over Server-Sent Events, for clients
+// behind proxies that block WebSocket upgrades
+type EventsHandler struct {
+	WSHub    *service.WebSocketHub
+	ServerDB *sql.DB
+	UsersDB  *sql.DB
+}
+
+// NewEventsHandler creates a new SSE events handler
+func NewEventsHandler(wsHub *service.WebSocketHub, serverDB, usersDB *sql.DB) *EventsHandler {
+	return &EventsHandler{
+		WSHub:    wsHub,
+		ServerDB: serverDB,
+		UsersDB:  usersDB,
+	}
+}
+
+// eventsPoint is a location alerts are matched against
+type eventsPoint struct {
+	lat, lon float64
+}
+
+// StreamEvents streams WebSocketMessage payloads as SSE
+// GET /api/v1/events?topics=notifications,alerts,earthquakes,system
+func (h *EventsHandler) StreamEvents(c *gin.Context) {
+	userID, adminID, err := h.authenticate(c)
+	if err != nil {
+		Unauthorized(c, err.Error())
+		return
+	}
+	if userID == nil && adminID == nil {
+		Unauthorized(c, "authentication required")
+		return
+	}
+
+	types, err := parseEventTopics(c.Query("topics"))
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	alertPoints, allAlerts, err := h.alertFilter(c, userID, adminID)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	radius := eventsAlertRadiusMiles
+	if v := c.Query("radius"); v != "" {
+		if r, err := strconv.ParseFloat(v, 64); err == nil && r > 0 {
+			radius = r
+		}
+	}
+
+	// Only alerts with geometry near one of the points are sent
+	allow := func(message *service.WebSocketMessage) bool {
+		if message.Type != service.HubMessageSevereWeatherAlert || allAlerts {
+			return true
+		}
+		alert, ok := message.Data.(service.Alert)
+		if !ok {
+			return false
+		}
+		for _, p := range alertPoints {
+			if service.AlertNearLocation(alert, p.lat, p.lon, radius) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// EventSource sends Last-Event-ID on reconnect; the query parameter lets
+	// clients resume on a fresh connection
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	// Subscribe before replaying so nothing published in between is lost
+	sub := h.WSHub.Subscribe(userID, adminID, types...)
+	defer h.WSHub.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+
+	w := c.Writer
+	fmt.Fprintf(w, "retry: %d\n\n", eventsRetryMillis)
+
+	replayed := make(map[string]bool)
+	for _, event := range h.WSHub.EventsSince(lastEventID) {
+		if !sub.Matches(event) || !allow(event.Message) {
+			continue
+		}
+		if err := writeSSEMessage(w, event.Message); err != nil {
+			return
+		}
+		replayed[event.Message.ID] = true
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		case message, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			// Already sent during replay
+			if replayed[message.ID] {
+				continue
+			}
+			if !allow(message) {
+				continue
+			}
+			if err := writeSSEMessage(w, message); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
+
+// writeSSEMessage writes one event; data is the same JSON as over WebSocket
+func writeSSEMessage(w io.Writer, message *service.WebSocketMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", message.ID, message.Type, data)
+	return err
+}
+
+// parseEventTopics converts a comma-separated topic list to hub message types.
+// No topics subscribes to all of them.
+func parseEventTopics(topics string) ([]string, error) {
+	var types []string
+	for _, topic := range strings.Split(topics, ",") {
+		topic = strings.TrimSpace(strings.ToLower(topic))
+		if topic == "" {
+			continue
+		}
+		messageType, ok := eventTopics[topic]
+		if !ok {
+			return nil, fmt.Errorf("unknown topic %q (valid: notifications, alerts, earthquakes, system)", topic)
+		}
+		types = append(types, messageType)
+	}
+	return types, nil
+}
+
+// alertFilter returns the points alerts are matched against: explicit
+// lat/lon, otherwise the user's saved locations with alerts enabled.
+// Admins without coordinates receive every alert.
+func (h *EventsHandler) alertFilter(c *gin.Context, userID, adminID *int) ([]eventsPoint, bool, error) {
+	if latStr, lonStr := c.Query("lat"), c.Query("lon"); latStr != "" || lonStr != "" {
+		lat, latErr := strconv.ParseFloat(latStr, 64)
+		lon, lonErr := strconv.ParseFloat(lonStr, 64)
+		if latErr != nil || lonErr != nil {
+			return nil, false, fmt.Errorf("lat and lon must both be valid numbers")
+		}
+		return []eventsPoint{{lat: lat, lon: lon}}, false, nil
+	}
+
+	if userID == nil {
+		return nil, adminID != nil, nil
+	}
+
+	locationModel := &models.LocationModel{DB: h.UsersDB}
+	locations, err := locationModel.GetByUserID(*userID)
+	if err != nil {
+		return nil, false, nil
+	}
+	var points []eventsPoint
+	for _, loc := range locations {
+		if loc.AlertsEnabled {
+			points = append(points, eventsPoint{lat: loc.Latitude, lon: loc.Longitude})
+		}
+	}
+	return points, false, nil
+}
+
+// authenticate resolves the caller from a session (set by OptionalAuth), a
+// usr_/adm_ bearer token, or the admin session cookie
+func (h *EventsHandler) authenticate(c *gin.Context) (*int, *int, error) {
+	if user, ok := middleware.GetCurrentUser(c); ok && user != nil {
+		id := int(user.ID)
+		return &id, nil, nil
+	}
+
+	if authHeader := strings.TrimSpace(c.GetHeader("Authorization")); authHeader != "" {
+		parts := strings.SplitN(authHeader, " ", 2)
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return nil, nil, fmt.Errorf("invalid authorization format")
+		}
+		token := strings.TrimSpace(parts[1])
+
+		switch middleware.DetectTokenType(token) {
+		case middleware.TokenTypeAdmin:
+			adminModel := &models.AdminModel{DB: h.ServerDB}
+			admin, err := adminModel.GetByAPIToken(token)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid admin token")
+			}
+			id := int(admin.ID)
+			return nil, &id, nil
+		case middleware.TokenTypeUser:
+			tokenModel := &models.TokenModelV2{DB: h.UsersDB}
+			validatedToken, err := tokenModel.ValidateToken(token)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid user token")
+			}
+			if !validatedToken.AllowsIP(c.ClientIP()) {
+				return nil, nil, fmt.Errorf("token is not allowed from this IP address")
+			}
+			go tokenModel.UpdateLastUsed(validatedToken, c.ClientIP())
+			id := int(validatedToken.OwnerID)
+			return &id, nil, nil
+		default:
+			return nil, nil, fmt.Errorf("unsupported authorization token")
+		}
+	}
+
+	if sessionID, err := c.Cookie(AdminSessionCookieName); err == nil && sessionID != "" && h.ServerDB != nil {
+		var adminID int
+		err := h.ServerDB.QueryRow(`
+			SELECT admin_id
+			FROM server_admin_sessions
+			WHERE id = ? AND expires_at > CURRENT_TIMESTAMP
+		`, sessionID).Scan(&adminID)
+		if err == nil {
+			return nil, &adminID, nil
+		}
+	}
+
+	return nil, nil, nil
+}
@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/apimgr/weather/src/config"
+	"github.com/apimgr/weather/src/server/middleware"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/server/store"
+	"github.com/apimgr/weather/src/utils"
+)
+
+// LDAPHandler handles directory login for users and admins
+type LDAPHandler struct {
+	// users.db
+	DB *sql.DB
+	// server.db
+	ServerDB *sql.DB
+	Store    store.Store
+}
+
+// NewLDAPHandler creates a new LDAP handler
+func NewLDAPHandler(usersDB, serverDB *sql.DB, st store.Store) *LDAPHandler {
+	return &LDAPHandler{DB: usersDB, ServerDB: serverDB, Store: st}
+}
+
+// errLDAPLogin is shown to the user; details go to the log
+var errLDAPLogin = errors.New("Directory sign-in failed. Please try again.")
+
+type ldapLoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// "admin" when submitted from the admin login page
+	Target   string `json:"target"`
+	Redirect string `json:"redirect"`
+}
+
+// Login authenticates against the directory. Members of the admin groups get
+// an admin session; everyone else allowed in gets a user session.
+// POST /auth/ldap
+func (h *LDAPHandler) Login(c *gin.Context) {
+	var req ldapLoginRequest
+	if strings.Contains(c.GetHeader("Content-Type"), "application/json") {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	} else {
+		req.Username = c.PostForm("username")
+		req.Password = c.PostForm("password")
+		req.Target = c.PostForm("target")
+		req.Redirect = c.PostForm("redirect")
+	}
+
+	cfg := config.GetGlobalConfig()
+	ldapService := service.NewLDAPService(cfg.Server.Auth.LDAP)
+	if !ldapService.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "LDAP authentication is not enabled"})
+		return
+	}
+
+	entry, err := ldapService.Authenticate(req.Username, req.Password)
+	if errors.Is(err, service.ErrLDAPInvalidCredentials) {
+		h.fail(c, req.Target, "Invalid credentials", nil)
+		return
+	}
+	if err != nil {
+		h.fail(c, req.Target, "The directory server is unavailable", err)
+		return
+	}
+
+	access := ldapService.Access(entry)
+	if !access.Allowed {
+		h.fail(c, req.Target, "Your directory account is not allowed to sign in", nil)
+		return
+	}
+	if access.Admin {
+		h.completeAdmin(c, ldapService, entry, req.Target)
+		return
+	}
+	if req.Target == "admin" {
+		h.fail(c, req.Target, "Your account is not authorised for the admin panel", nil)
+		return
+	}
+	h.completeUser(c, ldapService, entry, access, req.Redirect)
+}
+
+// completeUser signs in the linked user, linking by email or provisioning
+// a new account on first login
+func (h *LDAPHandler) completeUser(c *gin.Context, ldapService *service.LDAPService, entry *service.LDAPEntry, access service.LDAPAccess, returnTo string) {
+	user, err := h.resolveUser(ldapService, entry, access)
+	if err != nil {
+		h.fail(c, "", err.Error(), nil)
+		return
+	}
+	if !user.IsActive || user.IsBanned {
+		h.fail(c, "", "This account is disabled", nil)
+		return
+	}
+
+	session, sessionTimeout, err := startUserSession(c.Request.Context(), h.Store, user.ID)
+	if err != nil {
+		h.fail(c, "", "Failed to create session", err)
+		return
+	}
+	(&models.UserModel{DB: h.DB}).UpdateLastLogin(user.ID, c.ClientIP())
+	noteLoginSucceeded(user, requestLoginContext(c))
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     middleware.SessionCookieName,
+		Value:    session.ID,
+		Path:     "/",
+		MaxAge:   sessionTimeout,
+		HttpOnly: true,
+		Secure:   isHTTPSRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if strings.Contains(c.GetHeader("Content-Type"), "application/json") {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Login successful",
+			"type":    "user",
+			"user": gin.H{
+				"id":       user.ID,
+				"username": user.Username,
+				"email":    user.Email,
+				"role":     user.Role,
+			},
+		})
+		return
+	}
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+		returnTo = "/users/dashboard"
+	}
+	c.Redirect(http.StatusFound, returnTo)
+}
+
+// resolveUser finds or creates the local account for a directory entry
+func (h *LDAPHandler) resolveUser(ldapService *service.LDAPService, entry *service.LDAPEntry, access service.LDAPAccess) (*models.User, error) {
+	userModel := &models.UserModel{DB: h.DB}
+	mappings := &models.LDAPMappingModel{DB: h.DB}
+	server := ldapService.Server()
+
+	var user *models.User
+	userID, err := mappings.GetUserID(server, entry.DN)
+	switch {
+	case err == nil:
+		user, err = userModel.GetByID(userID)
+		if err != nil {
+			return nil, errLDAPLogin
+		}
+		if err := mappings.Touch(server, entry.DN, entry.Username, entry.Groups); err != nil {
+			log.Printf("LDAP: failed to update entry %s: %v", entry.DN, err)
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		if entry.Email == "" {
+			return nil, errors.New("Your directory account has no email address")
+		}
+		// The directory is authoritative for its email addresses, so an
+		// existing account with the same email is linked
+		user, err = userModel.GetByEmail(entry.Email)
+		if err != nil {
+			user, err = h.provisionUser(entry, access.Role)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := mappings.Link(user.ID, server, entry.DN, entry.Username, entry.Groups); err != nil {
+			log.Printf("LDAP: %v", err)
+			return nil, errLDAPLogin
+		}
+	default:
+		log.Printf("LDAP: entry lookup failed: %v", err)
+		return nil, errLDAPLogin
+	}
+
+	// Roles follow directory groups on every login
+	if ldapService.MapsRoles() && access.Role != user.Role {
+		if err := userModel.Update(user.ID, user.Username, user.Email, access.Role); err != nil {
+			log.Printf("LDAP: failed to update role for user %d: %v", user.ID, err)
+		} else {
+			user.Role = access.Role
+		}
+	}
+	return user, nil
+}
+
+func (h *LDAPHandler) provisionUser(entry *service.LDAPEntry, role string) (*models.User, error) {
+	userModel := &models.UserModel{DB: h.DB}
+
+	username, err := (&OIDCHandler{DB: h.DB}).availableUsername(&service.OIDCIdentity{
+		Username: entry.Username,
+		Email:    entry.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Password login stays unusable; the directory checks passwords
+	password, err := models.GenerateSecureToken(32)
+	if err != nil {
+		return nil, errLDAPLogin
+	}
+	user, err := userModel.Create(username, entry.Email, password, role)
+	if err != nil {
+		log.Printf("LDAP: failed to provision user: %v", err)
+		return nil, errLDAPLogin
+	}
+	userModel.VerifyEmail(user.ID)
+	user.EmailVerified = true
+	return user, nil
+}
+
+// completeAdmin signs in a member of the admin groups, linking an existing
+// admin by email or creating one on first login
+func (h *LDAPHandler) completeAdmin(c *gin.Context, ldapService *service.LDAPService, entry *service.LDAPEntry, target string) {
+	adminModel := &models.AdminModel{DB: h.ServerDB}
+	mappings := &models.AdminLDAPMappingModel{DB: h.ServerDB}
+	server := ldapService.Server()
+
+	var admin *models.Admin
+	adminID, err := mappings.GetAdminID(server, entry.DN)
+	switch {
+	case err == nil:
+		admin, err = adminModel.GetByID(adminID)
+		if err != nil {
+			h.fail(c, target, errLDAPLogin.Error(), err)
+			return
+		}
+		mappings.Touch(server, entry.DN, entry.Username, entry.Groups)
+	case errors.Is(err, sql.ErrNoRows):
+		if entry.Email == "" {
+			h.fail(c, target, "Your directory account has no email address", nil)
+			return
+		}
+		admin, err = adminModel.GetByEmail(entry.Email)
+		if err != nil {
+			password, tokenErr := models.GenerateSecureToken(32)
+			if tokenErr != nil {
+				h.fail(c, target, errLDAPLogin.Error(), tokenErr)
+				return
+			}
+			admin, err = adminModel.Create(sanitizeUsername(entry.Username), entry.Email, password, false)
+			if err != nil {
+				h.fail(c, target, "Could not create an administrator account for this sign-in", err)
+				return
+			}
+		}
+		if err := mappings.Link(admin.ID, server, entry.DN, entry.Username, entry.Groups); err != nil {
+			h.fail(c, target, errLDAPLogin.Error(), err)
+			return
+		}
+	default:
+		h.fail(c, target, errLDAPLogin.Error(), err)
+		return
+	}
+
+	if !admin.IsActive {
+		h.fail(c, target, "This administrator account is disabled", nil)
+		return
+	}
+
+	duration := 30 * 24 * time.Hour
+	adminSession, err := (&models.AdminSessionModel{DB: h.ServerDB}).CreateSession(admin.ID, c.ClientIP(), c.Request.UserAgent(), duration)
+	if err != nil {
+		h.fail(c, target, "Failed to create session", err)
+		return
+	}
+	adminModel.UpdateLastLogin(admin.ID)
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     "admin_session",
+		Value:    adminSession.SessionID,
+		Path:     "/",
+		MaxAge:   int(duration.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPSRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	adminPath := "/" + config.GetGlobalConfig().GetAdminPath()
+	if strings.Contains(c.GetHeader("Content-Type"), "application/json") {
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Login successful",
+			"type":     "admin",
+			"redirect": adminPath,
+			"admin": gin.H{
+				"id":       admin.ID,
+				"username": admin.Username,
+				"email":    admin.Email,
+			},
+		})
+		return
+	}
+	c.Redirect(http.StatusFound, adminPath)
+}
+
+// fail renders the matching login page with an error
+func (h *LDAPHandler) fail(c *gin.Context, target, message string, err error) {
+	if err != nil {
+		log.Printf("LDAP login failed: %v", err)
+	}
+
+	cfg := config.GetGlobalConfig()
+	if strings.Contains(c.GetHeader("Content-Type"), "application/json") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+		return
+	}
+	if target == "admin" {
+		title := "Weather Service"
+		if cfg != nil && cfg.Server.Branding.Title != "" {
+			title = cfg.Server.Branding.Title
+		}
+		c.HTML(http.StatusUnauthorized, "admin/login.tmpl", gin.H{
+			"error":          message,
+			"branding":       gin.H{"Title": title},
+			"version":        middleware.GetVersion(),
+			"oidc_providers": cfg.OIDCLoginProviders(true),
+			"ldap_enabled":   cfg.Server.Auth.LDAP.Enabled,
+		})
+		return
+	}
+
+	c.HTML(http.StatusUnauthorized, "page/login.tmpl", utils.TemplateData(c, gin.H{
+		"title":              "Login",
+		"error":              message,
+		"registrationPublic": isPublicRegistrationEnabled(),
+		"oidcProviders":      cfg.OIDCLoginProviders(false),
+		"ldapEnabled":        cfg.Server.Auth.LDAP.Enabled,
+	}))
+}
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"database/sql"
 	"net/http"
 	"strconv"
 	"strings"
@@ -9,13 +8,14 @@ import (
 	"github.com/apimgr/weather/src/server/middleware"
 	"github.com/apimgr/weather/src/server/model"
 	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/server/store"
 	"github.com/apimgr/weather/src/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type LocationHandler struct {
-	DB               *sql.DB
+	Store            store.Store
 	WeatherService   *service.WeatherService
 	LocationEnhancer *service.LocationEnhancer
 }
@@ -38,8 +38,7 @@ func (h *LocationHandler) ListLocations(c *gin.Context) {
 		return
 	}
 
-	locationModel := &models.LocationModel{DB: h.DB}
-	locations, err := locationModel.GetByUserID(int(user.ID))
+	locations, err := h.Store.ListUserLocations(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch locations"})
 		return
@@ -75,8 +74,7 @@ func (h *LocationHandler) GetLocation(c *gin.Context) {
 		return
 	}
 
-	locationModel := &models.LocationModel{DB: h.DB}
-	location, err := locationModel.GetByID(id)
+	location, err := h.Store.GetLocation(c.Request.Context(), int64(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
 		return
@@ -133,21 +131,29 @@ func (h *LocationHandler) CreateLocation(c *gin.Context) {
 		return
 	}
 
-	locationModel := &models.LocationModel{DB: h.DB}
-	
 	// Check location limit per IDEA.md: Save up to 10 locations per user
-	count, err := locationModel.Count(int(user.ID))
+	count, err := h.Store.CountUserLocations(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check location count"})
 		return
 	}
-	if count >= 10 {
+	if count >= store.MaxLocationsPerUser {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Maximum of 10 saved locations allowed per user"})
 		return
 	}
 	
-	location, err := locationModel.Create(int(user.ID), req.Name, req.Latitude, req.Longitude, req.Timezone)
-	if err != nil {
+	location := &models.SavedLocation{
+		UserID:        int(user.ID),
+		Name:          req.Name,
+		Latitude:      req.Latitude,
+		Longitude:     req.Longitude,
+		Timezone:      req.Timezone,
+		AlertsEnabled: true,
+	}
+	if err := h.Store.CreateLocation(c.Request.Context(), location); err != nil {
+		if RespondWriteQueued(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create location"})
 		return
 	}
@@ -197,10 +203,8 @@ func (h *LocationHandler) UpdateLocation(c *gin.Context) {
 		return
 	}
 
-	locationModel := &models.LocationModel{DB: h.DB}
-
 	// Verify ownership
-	location, err := locationModel.GetByID(id)
+	location, err := h.Store.GetLocation(c.Request.Context(), int64(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
 		return
@@ -211,7 +215,15 @@ func (h *LocationHandler) UpdateLocation(c *gin.Context) {
 	}
 
 	// Update location
-	if err := locationModel.Update(id, req.Name, req.Latitude, req.Longitude, req.Timezone, req.AlertsEnabled); err != nil {
+	location.Name = req.Name
+	location.Latitude = req.Latitude
+	location.Longitude = req.Longitude
+	location.Timezone = req.Timezone
+	location.AlertsEnabled = req.AlertsEnabled
+	if err := h.Store.UpdateLocation(c.Request.Context(), location); err != nil {
+		if RespondWriteQueued(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
 		return
 	}
@@ -247,10 +259,8 @@ func (h *LocationHandler) DeleteLocation(c *gin.Context) {
 		return
 	}
 
-	locationModel := &models.LocationModel{DB: h.DB}
-
 	// Verify ownership
-	location, err := locationModel.GetByID(id)
+	location, err := h.Store.GetLocation(c.Request.Context(), int64(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
 		return
@@ -261,7 +271,10 @@ func (h *LocationHandler) DeleteLocation(c *gin.Context) {
 	}
 
 	// Delete location
-	if err := locationModel.Delete(id); err != nil {
+	if err := h.Store.DeleteLocation(c.Request.Context(), int64(id)); err != nil {
+		if RespondWriteQueued(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
 		return
 	}
@@ -292,10 +305,8 @@ func (h *LocationHandler) ToggleAlerts(c *gin.Context) {
 		return
 	}
 
-	locationModel := &models.LocationModel{DB: h.DB}
-
 	// Verify ownership
-	location, err := locationModel.GetByID(id)
+	location, err := h.Store.GetLocation(c.Request.Context(), int64(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
 		return
@@ -306,7 +317,11 @@ func (h *LocationHandler) ToggleAlerts(c *gin.Context) {
 	}
 
 	// Toggle alerts
-	if err := locationModel.ToggleAlerts(id, req.Enabled); err != nil {
+	location.AlertsEnabled = req.Enabled
+	if err := h.Store.UpdateLocation(c.Request.Context(), location); err != nil {
+		if RespondWriteQueued(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to toggle alerts"})
 		return
 	}
@@ -343,8 +358,7 @@ func (h *LocationHandler) ShowEditLocationPage(c *gin.Context) {
 		return
 	}
 
-	locationModel := &models.LocationModel{DB: h.DB}
-	location, err := locationModel.GetByID(id)
+	location, err := h.Store.GetLocation(c.Request.Context(), int64(id))
 	if err != nil {
 		c.HTML(http.StatusNotFound, "page/error.tmpl", gin.H{"error": "Location not found"})
 		return
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/middleware"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func locationRouter(h *LocationHandler, user *models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(middleware.UserContextKey, user)
+	})
+	r.POST("/locations", h.CreateLocation)
+	r.PUT("/locations/:id", h.UpdateLocation)
+	r.DELETE("/locations/:id", h.DeleteLocation)
+	return r
+}
+
+func TestLocationHandlerOwnershipAndLimit(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	alice := &models.User{Username: "alice", Email: "alice@example.com"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com"}
+	for _, user := range []*models.User{alice, bob} {
+		if err := st.CreateUser(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &LocationHandler{Store: st}
+
+	body := `{"name": "Home", "latitude": 40.7, "longitude": -74.0}`
+	for i := 0; i < store.MaxLocationsPerUser; i++ {
+		w := httptest.NewRecorder()
+		locationRouter(h, alice).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/locations", strings.NewReader(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %d: %d %s", i, w.Code, w.Body)
+		}
+	}
+	w := httptest.NewRecorder()
+	locationRouter(h, alice).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/locations", strings.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("create over the limit: %d %s", w.Code, w.Body)
+	}
+
+	locations, _ := st.ListUserLocations(ctx, alice.ID)
+	path := "/locations/" + strconv.Itoa(locations[0].ID)
+
+	w = httptest.NewRecorder()
+	locationRouter(h, bob).ServeHTTP(w, httptest.NewRequest(http.MethodDelete, path, nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("delete by another user: %d %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	update := `{"name": "Office", "latitude": 51.5, "longitude": -0.1, "alerts_enabled": false}`
+	locationRouter(h, alice).ServeHTTP(w, httptest.NewRequest(http.MethodPut, path, strings.NewReader(update)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	if got, _ := st.GetLocation(ctx, int64(locations[0].ID)); got.Name != "Office" || got.AlertsEnabled {
+		t.Errorf("updated location = %+v", got)
+	}
+}
+
+// queuingStore queues every location write, as the store does while the
+// database is down
+type queuingStore struct {
+	store.Store
+}
+
+func (queuingStore) CreateLocation(context.Context, *models.SavedLocation) error {
+	return fmt.Errorf("failed to create location: %w", database.ErrWriteQueued)
+}
+
+func TestLocationHandlerAcceptsQueuedWrite(t *testing.T) {
+	st := store.NewMemory()
+	alice := &models.User{Username: "alice", Email: "alice@example.com"}
+	if err := st.CreateUser(context.Background(), alice); err != nil {
+		t.Fatal(err)
+	}
+	h := &LocationHandler{Store: queuingStore{st}}
+
+	w := httptest.NewRecorder()
+	body := `{"name": "Home", "latitude": 40.7, "longitude": -74.0}`
+	locationRouter(h, alice).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/locations", strings.NewReader(body)))
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"queued":true`) {
+		t.Errorf("create with the database down: %d %s", w.Code, w.Body)
+	}
+}
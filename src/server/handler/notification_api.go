@@ -21,45 +21,48 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// Implement proper origin checking per AI.md PART 17
-		// Development mode: allow all origins
-		if !mode.IsAppModeProd() {
-			return true
-		}
+	CheckOrigin:     CheckWebSocketOrigin,
+}
 
-		// Production mode: check against configured CORS origins
-		origin := r.Header.Get("Origin")
-		if origin == "" {
-			// No origin header - allow (same-origin)
-			return true
-		}
+// CheckWebSocketOrigin validates the Origin of a WebSocket upgrade request
+func CheckWebSocketOrigin(r *http.Request) bool {
+	// Implement proper origin checking per AI.md PART 17
+	// Development mode: allow all origins
+	if !mode.IsAppModeProd() {
+		return true
+	}
 
-		// Load config to check allowed origins
-		cfg, err := config.LoadConfig()
-		if err != nil || cfg == nil {
-			// Config load failed - reject for safety
-			return false
-		}
+	// Production mode: check against configured CORS origins
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// No origin header - allow (same-origin)
+		return true
+	}
 
-		// Check if CORS is set to allow all
-		if cfg.Web.CORS == "*" {
-			return true
-		}
+	// Load config to check allowed origins
+	cfg, err := config.LoadConfig()
+	if err != nil || cfg == nil {
+		// Config load failed - reject for safety
+		return false
+	}
+
+	// Check if CORS is set to allow all
+	if cfg.Web.CORS == "*" {
+		return true
+	}
 
-		// Check if origin is in allowed CORS list
-		if cfg.Web.CORS != "" {
-			allowedOrigins := strings.Split(cfg.Web.CORS, ",")
-			for _, allowed := range allowedOrigins {
-				if strings.TrimSpace(allowed) == origin {
-					return true
-				}
+	// Check if origin is in allowed CORS list
+	if cfg.Web.CORS != "" {
+		allowedOrigins := strings.Split(cfg.Web.CORS, ",")
+		for _, allowed := range allowedOrigins {
+			if strings.TrimSpace(allowed) == origin {
+				return true
 			}
 		}
+	}
 
-		// Origin not allowed
-		return false
-	},
+	// Origin not allowed
+	return false
 }
 
 // NotificationAPIHandlers handles all notification API endpoints
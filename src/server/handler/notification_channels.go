@@ -3,28 +3,32 @@ package handler
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/server/store"
 )
 
 // NotificationChannelHandler handles notification channel management
 type NotificationChannelHandler struct {
 	DB             *sql.DB
+	Store          store.Store
 	ChannelManager *service.ChannelManager
 	SMTP           *service.SMTPService
 }
 
 // NewNotificationChannelHandler creates a new notification channel handler
-func NewNotificationChannelHandler(db *sql.DB) *NotificationChannelHandler {
+func NewNotificationChannelHandler(db *sql.DB, st store.Store) *NotificationChannelHandler {
 	cm := service.NewChannelManager(db)
 	smtp := service.NewSMTPService(db)
 
 	return &NotificationChannelHandler{
 		DB:             db,
+		Store:          st,
 		ChannelManager: cm,
 		SMTP:           smtp,
 	}
@@ -32,63 +36,17 @@ func NewNotificationChannelHandler(db *sql.DB) *NotificationChannelHandler {
 
 // ListChannels returns all notification channels
 func (h *NotificationChannelHandler) ListChannels(c *gin.Context) {
-	rows, err := h.DB.Query(`
-		SELECT channel_type, channel_name, enabled, state,
-		       last_test_at, last_success_at, last_error, failure_count,
-		       created_at, updated_at
-		FROM notification_channels
-		ORDER BY channel_name ASC
-	`)
+	list, err := h.Store.ListNotificationChannels(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch channels"})
 		return
 	}
-	defer rows.Close()
 
 	var channels []gin.H
-	for rows.Next() {
-		var channelType, channelName, state string
-		var enabled bool
-		var lastTestAt, lastSuccessAt, createdAt, updatedAt sql.NullTime
-		var lastError sql.NullString
-		var failureCount int
-
-		err := rows.Scan(&channelType, &channelName, &enabled, &state,
-			&lastTestAt, &lastSuccessAt, &lastError, &failureCount,
-			&createdAt, &updatedAt)
-		if err != nil {
-			continue
-		}
-
-		channel := gin.H{
-			"channel_type":    channelType,
-			"channel_name":    channelName,
-			"enabled":         enabled,
-			"state":           state,
-			"failure_count":   failureCount,
-			"last_test_at":    nil,
-			"last_success_at": nil,
-			"last_error":      nil,
-			"created_at":      nil,
-			"updated_at":      nil,
-		}
-
-		if lastTestAt.Valid {
-			channel["last_test_at"] = lastTestAt.Time
-		}
-		if lastSuccessAt.Valid {
-			channel["last_success_at"] = lastSuccessAt.Time
-		}
-		if lastError.Valid {
-			channel["last_error"] = lastError.String
-		}
-		if createdAt.Valid {
-			channel["created_at"] = createdAt.Time
-		}
-		if updatedAt.Valid {
-			channel["updated_at"] = updatedAt.Time
-		}
-
+	for _, ch := range list {
+		channel := channelJSON(ch)
+		channel["created_at"] = ch.CreatedAt
+		channel["updated_at"] = ch.UpdatedAt
 		channels = append(channels, channel)
 	}
 
@@ -100,50 +58,42 @@ func (h *NotificationChannelHandler) ListChannels(c *gin.Context) {
 
 // GetChannel returns a specific channel
 func (h *NotificationChannelHandler) GetChannel(c *gin.Context) {
-	channelType := c.Param("type")
-
-	var channelName, state, config string
-	var enabled bool
-	var lastTestAt, lastSuccessAt sql.NullTime
-	var lastError sql.NullString
-	var failureCount int
-
-	err := h.DB.QueryRow(`
-		SELECT channel_name, enabled, state, config,
-		       last_test_at, last_success_at, last_error, failure_count
-		FROM notification_channels
-		WHERE channel_type = ?
-	`, channelType).Scan(&channelName, &enabled, &state, &config,
-		&lastTestAt, &lastSuccessAt, &lastError, &failureCount)
-
+	ch, err := h.Store.GetNotificationChannel(c.Request.Context(), c.Param("type"))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
 		return
 	}
 
+	channel := channelJSON(ch)
+	channel["config"] = ch.Config
+
+	c.JSON(http.StatusOK, channel)
+}
+
+// channelJSON returns the fields shared by the channel list and detail
+func channelJSON(ch *store.NotificationChannel) gin.H {
 	channel := gin.H{
-		"channel_type":    channelType,
-		"channel_name":    channelName,
-		"enabled":         enabled,
-		"state":           state,
-		"config":          config,
-		"failure_count":   failureCount,
+		"channel_type":    ch.Type,
+		"channel_name":    ch.Name,
+		"enabled":         ch.Enabled,
+		"state":           ch.State,
+		"failure_count":   ch.FailureCount,
 		"last_test_at":    nil,
 		"last_success_at": nil,
 		"last_error":      nil,
 	}
 
-	if lastTestAt.Valid {
-		channel["last_test_at"] = lastTestAt.Time
+	if ch.LastTestAt != nil {
+		channel["last_test_at"] = *ch.LastTestAt
 	}
-	if lastSuccessAt.Valid {
-		channel["last_success_at"] = lastSuccessAt.Time
+	if ch.LastSuccessAt != nil {
+		channel["last_success_at"] = *ch.LastSuccessAt
 	}
-	if lastError.Valid {
-		channel["last_error"] = lastError.String
+	if ch.LastError != "" {
+		channel["last_error"] = ch.LastError
 	}
 
-	c.JSON(http.StatusOK, channel)
+	return channel
 }
 
 // UpdateChannel updates channel configuration
@@ -164,13 +114,15 @@ func (h *NotificationChannelHandler) UpdateChannel(c *gin.Context) {
 	configJSON, _ := json.Marshal(req.Config)
 
 	// Update channel
-	_, err := h.DB.Exec(`
-		UPDATE notification_channels
-		SET enabled = ?, config = ?, updated_at = datetime('now')
-		WHERE channel_type = ?
-	`, req.Enabled, string(configJSON), channelType)
-
+	err := h.Store.UpdateNotificationChannel(c.Request.Context(), channelType, req.Enabled, string(configJSON))
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+		return
+	}
 	if err != nil {
+		if RespondWriteQueued(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update channel"})
 		return
 	}
@@ -347,37 +299,10 @@ func (h *NotificationChannelHandler) GetChannelDefinitions(c *gin.Context) {
 
 // GetQueueStats returns notification queue statistics
 func (h *NotificationChannelHandler) GetQueueStats(c *gin.Context) {
-	var stats struct {
-		Total       int            `json:"total"`
-		Pending     int            `json:"pending"`
-		Sending     int            `json:"sending"`
-		Delivered   int            `json:"delivered"`
-		Failed      int            `json:"failed"`
-		DeadLetters int            `json:"dead_letters"`
-		ByChannel   map[string]int `json:"by_channel"`
-	}
-
-	// Total
-	h.DB.QueryRow("SELECT COUNT(*) FROM notification_queue").Scan(&stats.Total)
-
-	// By state
-	h.DB.QueryRow("SELECT COUNT(*) FROM notification_queue WHERE state IN ('created', 'queued')").Scan(&stats.Pending)
-	h.DB.QueryRow("SELECT COUNT(*) FROM notification_queue WHERE state = 'sending'").Scan(&stats.Sending)
-	h.DB.QueryRow("SELECT COUNT(*) FROM notification_queue WHERE state = 'delivered'").Scan(&stats.Delivered)
-	h.DB.QueryRow("SELECT COUNT(*) FROM notification_queue WHERE state = 'failed'").Scan(&stats.Failed)
-	h.DB.QueryRow("SELECT COUNT(*) FROM notification_queue WHERE state = 'dead_letter'").Scan(&stats.DeadLetters)
-
-	// By channel
-	stats.ByChannel = make(map[string]int)
-	rows, err := h.DB.Query("SELECT channel_type, COUNT(*) as count FROM notification_queue GROUP BY channel_type")
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var channelType string
-			var count int
-			rows.Scan(&channelType, &count)
-			stats.ByChannel[channelType] = count
-		}
+	stats, err := h.Store.NotificationQueueStats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch queue statistics"})
+		return
 	}
 
 	c.JSON(http.StatusOK, stats)
@@ -392,73 +317,11 @@ func (h *NotificationChannelHandler) GetNotificationHistory(c *gin.Context) {
 		}
 	}
 
-	channelType := c.Query("channel")
-	status := c.Query("status")
-
-	query := `
-		SELECT id, queue_id, user_id, channel_type, status, subject,
-		       sent_at, delivered_at, error_message
-		FROM notification_history
-		WHERE 1=1
-	`
-	args := []interface{}{}
-
-	if channelType != "" {
-		query += " AND channel_type = ?"
-		args = append(args, channelType)
-	}
-	if status != "" {
-		query += " AND status = ?"
-		args = append(args, status)
-	}
-
-	query += " ORDER BY sent_at DESC LIMIT ?"
-	args = append(args, limit)
-
-	rows, err := h.DB.Query(query, args...)
+	history, err := h.Store.ListNotificationHistory(c.Request.Context(), c.Query("channel"), c.Query("status"), limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history"})
 		return
 	}
-	defer rows.Close()
-
-	var history []gin.H
-	for rows.Next() {
-		var id, queueID sql.NullInt64
-		var userID sql.NullInt64
-		var channelType, status, subject string
-		var sentAt sql.NullTime
-		var deliveredAt sql.NullTime
-		var errorMessage sql.NullString
-
-		rows.Scan(&id, &queueID, &userID, &channelType, &status, &subject,
-			&sentAt, &deliveredAt, &errorMessage)
-
-		item := gin.H{
-			"id":           id.Int64,
-			"channel_type": channelType,
-			"status":       status,
-			"subject":      subject,
-		}
-
-		if queueID.Valid {
-			item["queue_id"] = queueID.Int64
-		}
-		if userID.Valid {
-			item["user_id"] = userID.Int64
-		}
-		if sentAt.Valid {
-			item["sent_at"] = sentAt.Time
-		}
-		if deliveredAt.Valid {
-			item["delivered_at"] = deliveredAt.Time
-		}
-		if errorMessage.Valid {
-			item["error_message"] = errorMessage.String
-		}
-
-		history = append(history, item)
-	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"history": history,
@@ -1,93 +1,60 @@
 package handler
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
-	"time"
 
+	"github.com/apimgr/weather/src/server/middleware"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
 	"github.com/apimgr/weather/src/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type NotificationHandler struct {
-	DB *sql.DB
-}
-
-// Notification represents a user notification
-type Notification struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	Type      string    `json:"type"`
-	Title     string    `json:"title"`
-	Message   string    `json:"message"`
-	Link      string    `json:"link,omitempty"`
-	Read      bool      `json:"read"`
-	CreatedAt time.Time `json:"created_at"`
+	Store store.Store
 }
 
 // ListNotifications returns all notifications for the current user
 func (h *NotificationHandler) ListNotifications(c *gin.Context) {
-	userID := c.GetInt("user_id")
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
 
 	// Get pagination params
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
 	offset := (page - 1) * limit
 
 	// Get unread filter
 	unreadOnly := c.DefaultQuery("unread", "false") == "true"
 
-	// Build query
-	query := `
-		SELECT id, user_id, type, title, message, link, read, created_at
-		FROM notifications
-		WHERE user_id = ?
-	`
-	args := []interface{}{userID}
-
-	if unreadOnly {
-		query += " AND read = 0"
-	}
-
-	query += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
-	args = append(args, limit, offset)
-
-	rows, err := h.DB.Query(query, args...)
+	ctx := c.Request.Context()
+	notifications, err := h.Store.ListUserNotifications(ctx, user.ID, unreadOnly, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
 		return
 	}
-	defer rows.Close()
-
-	notifications := []Notification{}
-	for rows.Next() {
-		var n Notification
-		var link sql.NullString
-		var readInt int
-
-		err := rows.Scan(&n.ID, &n.UserID, &n.Type, &n.Title, &n.Message, &link, &readInt, &n.CreatedAt)
-		if err != nil {
-			continue
-		}
-
-		n.Read = readInt == 1
-		if link.Valid {
-			n.Link = link.String
-		}
-
-		notifications = append(notifications, n)
+	if notifications == nil {
+		notifications = []*models.Notification{}
 	}
 
-	// Get total count
-	var total int
-	countQuery := "SELECT COUNT(*) FROM notifications WHERE user_id = ?"
-	countArgs := []interface{}{userID}
-	if unreadOnly {
-		countQuery += " AND read = 0"
+	total, err := h.Store.CountUserNotifications(ctx, user.ID, unreadOnly)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
 	}
-	h.DB.QueryRow(countQuery, countArgs...).Scan(&total)
 
 	c.JSON(http.StatusOK, gin.H{
 		"notifications": notifications,
@@ -99,10 +66,13 @@ func (h *NotificationHandler) ListNotifications(c *gin.Context) {
 
 // GetUnreadCount returns the count of unread notifications
 func (h *NotificationHandler) GetUnreadCount(c *gin.Context) {
-	userID := c.GetInt("user_id")
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
 
-	var count int
-	err := h.DB.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read = 0", userID).Scan(&count)
+	count, err := h.Store.CountUserNotifications(c.Request.Context(), user.ID, true)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get unread count"})
 		return
@@ -115,25 +85,15 @@ func (h *NotificationHandler) GetUnreadCount(c *gin.Context) {
 
 // MarkAsRead marks a notification as read
 func (h *NotificationHandler) MarkAsRead(c *gin.Context) {
-	userID := c.GetInt("user_id")
-	notificationID := c.Param("id")
-
-	// Verify ownership
-	var ownerID int
-	err := h.DB.QueryRow("SELECT user_id FROM notifications WHERE id = ?", notificationID).Scan(&ownerID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
-		return
-	}
-
-	if ownerID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	id, ok := h.ownedNotification(c)
+	if !ok {
 		return
 	}
 
-	// Mark as read
-	_, err = h.DB.Exec("UPDATE notifications SET read = 1 WHERE id = ?", notificationID)
-	if err != nil {
+	if err := h.Store.MarkNotificationRead(c.Request.Context(), id); err != nil {
+		if RespondWriteQueued(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification as read"})
 		return
 	}
@@ -143,10 +103,16 @@ func (h *NotificationHandler) MarkAsRead(c *gin.Context) {
 
 // MarkAllAsRead marks all notifications as read for the current user
 func (h *NotificationHandler) MarkAllAsRead(c *gin.Context) {
-	userID := c.GetInt("user_id")
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
 
-	_, err := h.DB.Exec("UPDATE notifications SET read = 1 WHERE user_id = ? AND read = 0", userID)
-	if err != nil {
+	if _, err := h.Store.MarkAllNotificationsRead(c.Request.Context(), user.ID); err != nil {
+		if RespondWriteQueued(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications as read"})
 		return
 	}
@@ -156,40 +122,64 @@ func (h *NotificationHandler) MarkAllAsRead(c *gin.Context) {
 
 // DeleteNotification deletes a notification
 func (h *NotificationHandler) DeleteNotification(c *gin.Context) {
-	userID := c.GetInt("user_id")
-	notificationID := c.Param("id")
-
-	// Verify ownership
-	var ownerID int
-	err := h.DB.QueryRow("SELECT user_id FROM notifications WHERE id = ?", notificationID).Scan(&ownerID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+	id, ok := h.ownedNotification(c)
+	if !ok {
 		return
 	}
 
-	if ownerID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	if err := h.Store.DeleteNotification(c.Request.Context(), id); err != nil {
+		if RespondWriteQueued(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification"})
 		return
 	}
 
-	// Delete
-	_, err = h.DB.Exec("DELETE FROM notifications WHERE id = ?", notificationID)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// ownedNotification returns the ID in the path after checking the
+// notification belongs to the current user, writing the error response
+// otherwise
+func (h *NotificationHandler) ownedNotification(c *gin.Context) (string, bool) {
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return "", false
+	}
+
+	id := c.Param("id")
+	notification, err := h.Store.GetNotification(c.Request.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return "", false
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification"})
-		return
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notification"})
+		return "", false
 	}
 
-	c.JSON(http.StatusOK, gin.H{"ok": true})
+	if notification.UserID == nil || int64(*notification.UserID) != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return "", false
+	}
+
+	return id, true
 }
 
 // CreateNotification creates a new notification (internal use)
-func (h *NotificationHandler) CreateNotification(userID int, notifType, title, message, link string) error {
-	_, err := h.DB.Exec(`
-		INSERT INTO notifications (user_id, type, title, message, link, read)
-		VALUES (?, ?, ?, ?, ?, 0)
-	`, userID, notifType, title, message, sql.NullString{String: link, Valid: link != ""})
+func (h *NotificationHandler) CreateNotification(ctx context.Context, userID int, notifType models.NotificationType, title, message, link string) error {
+	notification := &models.Notification{
+		UserID:  &userID,
+		Type:    notifType,
+		Title:   title,
+		Message: message,
+	}
+	if link != "" {
+		notification.Action = &models.NotificationAction{Label: "View", URL: link}
+	}
 
-	return err
+	return h.Store.CreateNotification(ctx, notification)
 }
 
 // ShowNotificationsPage renders the notifications page
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/apimgr/weather/src/server/middleware"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func notificationRouter(h *NotificationHandler, user *models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(middleware.UserContextKey, user)
+	})
+	r.GET("/notifications", h.ListNotifications)
+	r.GET("/notifications/unread", h.GetUnreadCount)
+	r.PATCH("/notifications/read", h.MarkAllAsRead)
+	r.PATCH("/notifications/:id/read", h.MarkAsRead)
+	r.DELETE("/notifications/:id", h.DeleteNotification)
+	return r
+}
+
+func TestNotificationHandlerOwnershipAndReadState(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	alice := &models.User{Username: "alice", Email: "alice@example.com"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com"}
+	for _, user := range []*models.User{alice, bob} {
+		if err := st.CreateUser(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &NotificationHandler{Store: st}
+	for _, title := range []string{"Frost", "Wind", "Rain"} {
+		if err := h.CreateNotification(ctx, int(alice.ID), models.NotificationTypeWarning, title, "Check the forecast", "/dashboard"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	serve := func(user *models.User, method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		notificationRouter(h, user).ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	w := serve(alice, http.MethodGet, "/notifications?limit=2")
+	var list struct {
+		Notifications []*models.Notification `json:"notifications"`
+		Total         int                    `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", w.Code, w.Body)
+	}
+	if len(list.Notifications) != 2 || list.Total != 3 {
+		t.Fatalf("list = %d of %d, want 2 of 3", len(list.Notifications), list.Total)
+	}
+	if action := list.Notifications[0].Action; action == nil || action.URL != "/dashboard" {
+		t.Errorf("action = %+v, want the link", action)
+	}
+	id := list.Notifications[0].ID
+
+	if w := serve(bob, http.MethodPatch, "/notifications/"+id+"/read"); w.Code != http.StatusForbidden {
+		t.Errorf("mark read by another user: %d %s", w.Code, w.Body)
+	}
+	if w := serve(bob, http.MethodDelete, "/notifications/"+id); w.Code != http.StatusForbidden {
+		t.Errorf("delete by another user: %d %s", w.Code, w.Body)
+	}
+	if w := serve(alice, http.MethodDelete, "/notifications/missing"); w.Code != http.StatusNotFound {
+		t.Errorf("delete missing: %d %s", w.Code, w.Body)
+	}
+
+	if w := serve(alice, http.MethodPatch, "/notifications/"+id+"/read"); w.Code != http.StatusOK {
+		t.Fatalf("mark read: %d %s", w.Code, w.Body)
+	}
+	if n, _ := st.CountUserNotifications(ctx, alice.ID, true); n != 2 {
+		t.Errorf("unread after mark read = %d, want 2", n)
+	}
+
+	if w := serve(alice, http.MethodDelete, "/notifications/"+id); w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if w := serve(alice, http.MethodPatch, "/notifications/read"); w.Code != http.StatusOK {
+		t.Fatalf("mark all read: %d %s", w.Code, w.Body)
+	}
+
+	w = serve(alice, http.MethodGet, "/notifications/unread")
+	var unread struct {
+		Count int `json:"unread_count"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &unread); err != nil || unread.Count != 0 {
+		t.Errorf("unread count: %d %s", w.Code, w.Body)
+	}
+	if n, _ := st.CountUserNotifications(ctx, alice.ID, false); n != 2 {
+		t.Errorf("notifications left = %d, want 2", n)
+	}
+}
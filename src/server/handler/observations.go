@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Longest range of one hourly series request
+	maxHourlyRangeDays = 31
+	// Longest range of daily series, summaries and forecast comparisons
+	maxDailyRangeDays = 3660
+)
+
+// ObservationHandler serves the observation archive of saved and popular
+// locations
+type ObservationHandler struct {
+	observations   *service.ObservationService
+	weatherService *service.WeatherService
+}
+
+// NewObservationHandler creates a new observation handler
+func NewObservationHandler(observations *service.ObservationService, ws *service.WeatherService) *ObservationHandler {
+	return &ObservationHandler{
+		observations:   observations,
+		weatherService: ws,
+	}
+}
+
+// observationQuery is the site, range and units of a request
+type observationQuery struct {
+	site  *service.ObservationSite
+	from  time.Time
+	to    time.Time
+	units string
+}
+
+// parseQuery resolves the location (lat and lon, or location) to its site
+// and parses from, to (YYYY-MM-DD or RFC 3339, to exclusive) and units.
+// The range defaults to the defaultDays before now. It answers the request
+// itself on errors.
+func (h *ObservationHandler) parseQuery(c *gin.Context, defaultDays, maxDays int) (*observationQuery, bool) {
+	lat := strings.TrimSpace(c.Query("lat"))
+	lon := strings.TrimSpace(c.Query("lon"))
+	location := strings.TrimSpace(c.Query("location"))
+
+	var latitude, longitude float64
+	switch {
+	case lat != "" || lon != "":
+		var latErr, lonErr error
+		latitude, latErr = strconv.ParseFloat(lat, 64)
+		longitude, lonErr = strconv.ParseFloat(lon, 64)
+		if latErr != nil || lonErr != nil || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+			InvalidInput(c, "Both 'lat' and 'lon' are required: latitude -90 to 90, longitude -180 to 180")
+			return nil, false
+		}
+	case location != "":
+		coords, err := h.weatherService.ParseAndResolveLocation(location, utils.GetClientIP(c))
+		if err != nil {
+			RespondError(c, http.StatusBadRequest, "LOCATION_ERROR", err.Error())
+			return nil, false
+		}
+		latitude, longitude = coords.Latitude, coords.Longitude
+	default:
+		InvalidInput(c, "Either 'lat' and 'lon' or 'location' is required")
+		return nil, false
+	}
+
+	q := &observationQuery{units: "metric"}
+	if units := strings.TrimSpace(c.Query("units")); units != "" {
+		if units != "metric" && units != "imperial" {
+			InvalidInput(c, "Units must be metric or imperial")
+			return nil, false
+		}
+		q.units = units
+	}
+
+	now := time.Now().UTC()
+	q.to = now
+	if to := strings.TrimSpace(c.Query("to")); to != "" {
+		t, ok := parseObservationTime(to)
+		if !ok {
+			InvalidInput(c, "Invalid 'to', use YYYY-MM-DD or RFC 3339")
+			return nil, false
+		}
+		q.to = t
+	}
+	q.from = q.to.AddDate(0, 0, -defaultDays)
+	if from := strings.TrimSpace(c.Query("from")); from != "" {
+		t, ok := parseObservationTime(from)
+		if !ok {
+			InvalidInput(c, "Invalid 'from', use YYYY-MM-DD or RFC 3339")
+			return nil, false
+		}
+		q.from = t
+	}
+	if !q.from.Before(q.to) {
+		InvalidInput(c, "'from' must be before 'to'")
+		return nil, false
+	}
+	if q.to.Sub(q.from) > time.Duration(maxDays)*24*time.Hour {
+		InvalidInput(c, "Range is limited to "+strconv.Itoa(maxDays)+" days")
+		return nil, false
+	}
+
+	site, err := h.observations.FindSite(c.Request.Context(), latitude, longitude)
+	if err != nil {
+		if errors.Is(err, service.ErrNoObservations) {
+			NotFound(c, "No observations are recorded for this location. Observations are recorded for saved and frequently requested locations.")
+			return nil, false
+		}
+		log.Printf("Observation site lookup failed: %v", err)
+		InternalError(c, "Failed to load observations")
+		return nil, false
+	}
+	q.site = site
+	return q, true
+}
+
+// parseObservationTime parses a date (UTC midnight) or an RFC 3339 time
+func parseObservationTime(value string) (time.Time, bool) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// siteJSON describes the site of a response
+func siteJSON(site *service.ObservationSite) gin.H {
+	return gin.H{
+		"latitude":       site.Latitude,
+		"longitude":      site.Longitude,
+		"timezone":       site.Timezone,
+		"lastObservedAt": site.LastObservedAt,
+	}
+}
+
+// GetObservations returns the hourly or daily observations of a location
+// @Summary Get recorded observations
+// @Description Hourly or daily observations recorded for a saved or frequently requested location. Hourly observations are kept for weather.observations.hourly_days; daily ones longer.
+// @Tags Weather
+// @Produce json
+// @Param lat query number false "Latitude"
+// @Param lon query number false "Longitude"
+// @Param location query string false "Location name (instead of lat and lon)"
+// @Param from query string false "Start, YYYY-MM-DD or RFC 3339 (default: 7 days before to)"
+// @Param to query string false "End, exclusive (default: now)"
+// @Param resolution query string false "hour or day (default: hour up to 7 days, else day)"
+// @Param units query string false "metric (default) or imperial"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Location not recorded"
+// @Router /api/v1/observations [get]
+func (h *ObservationHandler) GetObservations(c *gin.Context) {
+	q, ok := h.parseQuery(c, 7, maxDailyRangeDays)
+	if !ok {
+		return
+	}
+
+	resolution := strings.TrimSpace(c.Query("resolution"))
+	switch resolution {
+	case "":
+		resolution = service.ResolutionDay
+		if q.to.Sub(q.from) <= 7*24*time.Hour {
+			resolution = service.ResolutionHour
+		}
+	case service.ResolutionHour, service.ResolutionDay:
+	default:
+		InvalidInput(c, "Resolution must be hour or day")
+		return
+	}
+	if resolution == service.ResolutionHour && q.to.Sub(q.from) > maxHourlyRangeDays*24*time.Hour {
+		InvalidInput(c, "Hourly observations are limited to "+strconv.Itoa(maxHourlyRangeDays)+" days per request")
+		return
+	}
+
+	series, err := h.observations.Series(c.Request.Context(), q.site.ID, resolution, q.from, q.to, q.units)
+	if err != nil {
+		log.Printf("Observation series failed: %v", err)
+		InternalError(c, "Failed to load observations")
+		return
+	}
+
+	RespondNegotiatedData(c, http.StatusOK, gin.H{
+		"site":         siteJSON(q.site),
+		"resolution":   resolution,
+		"from":         q.from,
+		"to":           q.to,
+		"observations": series,
+		"meta": gin.H{
+			"source":    "Open-Meteo",
+			"timestamp": utils.Now(),
+			"units":     q.units,
+		},
+	})
+}
+
+// GetObservationSummary returns aggregates of the daily observations of a
+// location
+// @Summary Get observation aggregates
+// @Description Minimum, maximum and mean temperature, precipitation total, wet days and heating and cooling degree days of a period.
+// @Tags Weather
+// @Produce json
+// @Param lat query number false "Latitude"
+// @Param lon query number false "Longitude"
+// @Param location query string false "Location name (instead of lat and lon)"
+// @Param from query string false "Start, YYYY-MM-DD or RFC 3339 (default: 30 days before to)"
+// @Param to query string false "End, exclusive (default: now)"
+// @Param base query number false "Degree day base temperature (default: 18 °C or 65 °F)"
+// @Param units query string false "metric (default) or imperial"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Location not recorded"
+// @Router /api/v1/observations/summary [get]
+func (h *ObservationHandler) GetObservationSummary(c *gin.Context) {
+	q, ok := h.parseQuery(c, 30, maxDailyRangeDays)
+	if !ok {
+		return
+	}
+
+	base := 18.0
+	if q.units == "imperial" {
+		base = 65
+	}
+	if b := strings.TrimSpace(c.Query("base")); b != "" {
+		v, err := strconv.ParseFloat(b, 64)
+		if err != nil {
+			InvalidInput(c, "Invalid degree day base")
+			return
+		}
+		base = v
+	}
+
+	summary, err := h.observations.Summary(c.Request.Context(), q.site.ID, q.from, q.to, base, q.units)
+	if err != nil {
+		log.Printf("Observation summary failed: %v", err)
+		InternalError(c, "Failed to summarise observations")
+		return
+	}
+
+	RespondNegotiatedData(c, http.StatusOK, gin.H{
+		"site":    siteJSON(q.site),
+		"summary": summary,
+		"meta": gin.H{
+			"source":    "Open-Meteo",
+			"timestamp": utils.Now(),
+			"units":     q.units,
+		},
+	})
+}
+
+// GetForecastAccuracy compares the recorded forecasts of a location with
+// what was observed
+// @Summary Get forecast accuracy
+// @Description Recorded daily forecasts next to the observed values, with mean absolute error and bias of temperatures, wet/dry hit rate, Brier score of precipitation probability and threshold alert hit and false alarm rates per provider and forecast lead time.
+// @Tags Weather
+// @Produce json
+// @Param lat query number false "Latitude"
+// @Param lon query number false "Longitude"
+// @Param location query string false "Location name (instead of lat and lon)"
+// @Param from query string false "Start, YYYY-MM-DD or RFC 3339 (default: 30 days before to)"
+// @Param to query string false "End, exclusive (default: now)"
+// @Param units query string false "metric (default) or imperial"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{} "Location not recorded"
+// @Router /api/v1/observations/accuracy [get]
+func (h *ObservationHandler) GetForecastAccuracy(c *gin.Context) {
+	q, ok := h.parseQuery(c, 30, maxDailyRangeDays)
+	if !ok {
+		return
+	}
+
+	accuracy, err := h.observations.ForecastAccuracy(c.Request.Context(), q.site.ID, q.from, q.to, q.units)
+	if err != nil {
+		log.Printf("Forecast accuracy failed: %v", err)
+		InternalError(c, "Failed to compare forecasts")
+		return
+	}
+
+	RespondNegotiatedData(c, http.StatusOK, gin.H{
+		"site":     siteJSON(q.site),
+		"accuracy": accuracy,
+		"meta": gin.H{
+			"source":    "Open-Meteo",
+			"timestamp": utils.Now(),
+			"units":     q.units,
+		},
+	})
+}
@@ -0,0 +1,470 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/apimgr/weather/src/config"
+	"github.com/apimgr/weather/src/server/middleware"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/service"
+	"github.com/apimgr/weather/src/server/store"
+	"github.com/apimgr/weather/src/utils"
+)
+
+// Cookie holding the pending OIDC login (state, nonce, PKCE verifier)
+const (
+	oidcRequestCookie = "oidc_request"
+	oidcRequestMaxAge = 600
+)
+
+// OIDCHandler handles OpenID Connect login for users and admin SSO
+type OIDCHandler struct {
+	// users.db
+	DB *sql.DB
+	// server.db
+	ServerDB *sql.DB
+	Store    store.Store
+	OIDC     *service.OIDCService
+}
+
+// NewOIDCHandler creates a new OIDC handler
+func NewOIDCHandler(usersDB, serverDB *sql.DB, st store.Store, oidcService *service.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		DB:       usersDB,
+		ServerDB: serverDB,
+		Store:    st,
+		OIDC:     oidcService,
+	}
+}
+
+// errOIDCLogin is shown to the user; details go to the log
+var errOIDCLogin = errors.New("Single sign-on failed. Please try again.")
+
+// UserLogin redirects to the provider for user login
+// GET /auth/oidc/:provider
+func (h *OIDCHandler) UserLogin(c *gin.Context) {
+	h.begin(c, service.OIDCPurposeUser)
+}
+
+// AdminLogin redirects to the provider for admin panel login
+// GET /auth/oidc/:provider/admin
+func (h *OIDCHandler) AdminLogin(c *gin.Context) {
+	h.begin(c, service.OIDCPurposeAdmin)
+}
+
+func (h *OIDCHandler) begin(c *gin.Context, purpose string) {
+	cfg := config.GetGlobalConfig()
+	provider, ok := cfg.GetOIDCProvider(c.Param("provider"))
+	if !ok || (purpose == service.OIDCPurposeAdmin && !provider.AdminLogin) {
+		h.fail(c, purpose, "Unknown sign-in provider", nil)
+		return
+	}
+
+	returnTo := c.Query("redirect")
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") {
+		returnTo = ""
+	}
+
+	authURL, req, err := h.OIDC.Begin(c.Request.Context(), provider, h.redirectURL(c, provider), purpose, returnTo)
+	if err != nil {
+		h.fail(c, purpose, "The sign-in provider is unavailable", err)
+		return
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		h.fail(c, purpose, errOIDCLogin.Error(), err)
+		return
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcRequestCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(data),
+		Path:     "/auth/oidc/",
+		MaxAge:   oidcRequestMaxAge,
+		HttpOnly: true,
+		Secure:   isHTTPSRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes a user or admin login started by this browser
+// GET /auth/oidc/:provider/callback
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	req := h.takeRequest(c)
+	purpose := service.OIDCPurposeUser
+	if req != nil {
+		purpose = req.Purpose
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		h.fail(c, purpose, "Sign-in was cancelled or denied", fmt.Errorf("provider error %s: %s", errCode, c.Query("error_description")))
+		return
+	}
+
+	cfg := config.GetGlobalConfig()
+	provider, ok := cfg.GetOIDCProvider(c.Param("provider"))
+	if !ok {
+		h.fail(c, purpose, "Unknown sign-in provider", nil)
+		return
+	}
+
+	identity, err := h.OIDC.Complete(c.Request.Context(), provider, req, c.Query("state"), c.Query("code"))
+	if err != nil {
+		h.fail(c, purpose, errOIDCLogin.Error(), err)
+		return
+	}
+
+	if purpose == service.OIDCPurposeAdmin {
+		h.completeAdmin(c, provider, identity)
+		return
+	}
+	h.completeUser(c, provider, identity, req.ReturnTo)
+}
+
+// completeUser signs in the linked user, linking by verified email or
+// provisioning a new account when registration allows it
+func (h *OIDCHandler) completeUser(c *gin.Context, provider *config.OIDCProviderConfig, identity *service.OIDCIdentity, returnTo string) {
+	user, err := h.resolveUser(provider, identity)
+	if err != nil {
+		h.fail(c, service.OIDCPurposeUser, err.Error(), nil)
+		return
+	}
+	if !user.IsActive || user.IsBanned {
+		h.fail(c, service.OIDCPurposeUser, "This account is disabled", nil)
+		return
+	}
+
+	session, sessionTimeout, err := startUserSession(c.Request.Context(), h.Store, user.ID)
+	if err != nil {
+		h.fail(c, service.OIDCPurposeUser, "Failed to create session", err)
+		return
+	}
+	(&models.UserModel{DB: h.DB}).UpdateLastLogin(user.ID, c.ClientIP())
+	noteLoginSucceeded(user, requestLoginContext(c))
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     middleware.SessionCookieName,
+		Value:    session.ID,
+		Path:     "/",
+		MaxAge:   sessionTimeout,
+		HttpOnly: true,
+		Secure:   isHTTPSRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if returnTo == "" {
+		returnTo = "/users/dashboard"
+	}
+	c.Redirect(http.StatusFound, returnTo)
+}
+
+// resolveUser finds or creates the local account for a provider identity
+func (h *OIDCHandler) resolveUser(provider *config.OIDCProviderConfig, identity *service.OIDCIdentity) (*models.User, error) {
+	userModel := &models.UserModel{DB: h.DB}
+	mappings := &models.OIDCMappingModel{DB: h.DB}
+	claims := encodeClaims(identity.Claims)
+
+	// 1. Identity already linked
+	userID, err := mappings.GetUserID(identity.Provider, identity.Subject)
+	if err == nil {
+		user, err := userModel.GetByID(userID)
+		if err != nil {
+			return nil, errOIDCLogin
+		}
+		if err := mappings.Touch(identity.Provider, identity.Subject, identity.Email, identity.Name, claims); err != nil {
+			log.Printf("OIDC: failed to update identity %s/%s: %v", identity.Provider, identity.Subject, err)
+		}
+		h.syncRole(provider, user, identity.Role)
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("OIDC: identity lookup failed: %v", err)
+		return nil, errOIDCLogin
+	}
+
+	if identity.Email == "" {
+		return nil, errors.New("The sign-in provider did not share an email address")
+	}
+
+	// 2. Existing account with the same email; only a provider-verified
+	// email may take over an account
+	if existing, err := userModel.GetByEmail(identity.Email); err == nil {
+		if !identity.EmailVerified {
+			return nil, errors.New("An account with this email already exists. Sign in with your password first.")
+		}
+		if err := mappings.Link(existing.ID, identity.Provider, identity.Subject, identity.Issuer, identity.Email, identity.Name, claims); err != nil {
+			log.Printf("OIDC: %v", err)
+			return nil, errOIDCLogin
+		}
+		if !existing.EmailVerified {
+			userModel.VerifyEmail(existing.ID)
+		}
+		h.syncRole(provider, existing, identity.Role)
+		return existing, nil
+	}
+
+	// 3. Just-in-time provisioning, subject to the registration mode
+	if !isPublicRegistrationEnabled() {
+		return nil, errors.New("No account is linked to this sign-in and registration is closed")
+	}
+	if requiresEmailVerification() && !identity.EmailVerified {
+		return nil, errors.New("Your email address must be verified by the sign-in provider")
+	}
+
+	username, err := h.availableUsername(identity)
+	if err != nil {
+		return nil, err
+	}
+	// Password login stays unusable until the user sets a password
+	password, err := models.GenerateSecureToken(32)
+	if err != nil {
+		return nil, errOIDCLogin
+	}
+	user, err := userModel.Create(username, identity.Email, password, identity.Role)
+	if err != nil {
+		log.Printf("OIDC: failed to provision user: %v", err)
+		return nil, errOIDCLogin
+	}
+	if identity.EmailVerified {
+		userModel.VerifyEmail(user.ID)
+		user.EmailVerified = true
+	}
+	if err := mappings.Link(user.ID, identity.Provider, identity.Subject, identity.Issuer, identity.Email, identity.Name, claims); err != nil {
+		log.Printf("OIDC: %v", err)
+		return nil, errOIDCLogin
+	}
+	return user, nil
+}
+
+// syncRole applies the provider's role mapping on every login so role
+// changes at the provider take effect
+func (h *OIDCHandler) syncRole(provider *config.OIDCProviderConfig, user *models.User, role string) {
+	if provider.RoleClaim == "" || role == "" || role == user.Role {
+		return
+	}
+	if err := (&models.UserModel{DB: h.DB}).Update(user.ID, user.Username, user.Email, role); err != nil {
+		log.Printf("OIDC: failed to update role for user %d: %v", user.ID, err)
+		return
+	}
+	user.Role = role
+}
+
+// availableUsername derives a valid, unused username from the identity
+func (h *OIDCHandler) availableUsername(identity *service.OIDCIdentity) (string, error) {
+	userModel := &models.UserModel{DB: h.DB}
+
+	candidates := []string{identity.Username}
+	if local, _, ok := strings.Cut(identity.Email, "@"); ok {
+		candidates = append(candidates, local)
+	}
+	for _, candidate := range candidates {
+		base := sanitizeUsername(candidate)
+		if base == "" {
+			continue
+		}
+		for i := 0; i < 20; i++ {
+			name := base
+			if i > 0 {
+				suffix := fmt.Sprintf("%d", i+1)
+				if len(base)+len(suffix) > utils.MaxUsernameLength {
+					name = base[:utils.MaxUsernameLength-len(suffix)]
+				}
+				name = strings.TrimRight(name, "_-") + suffix
+			}
+			if utils.ValidateUsername(name) != nil {
+				break
+			}
+			if _, err := userModel.GetByUsername(name); err != nil {
+				return name, nil
+			}
+		}
+	}
+	return "", errors.New("Could not choose a username for this account. Please register first.")
+}
+
+// sanitizeUsername maps a provider name onto the local username rules
+func sanitizeUsername(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	var b strings.Builder
+	lastSep := true
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9' && b.Len() > 0:
+			b.WriteRune(r)
+			lastSep = false
+		case (r == '_' || r == '-' || r == '.') && !lastSep:
+			if r == '.' {
+				r = '_'
+			}
+			b.WriteRune(r)
+			lastSep = true
+		}
+	}
+	name := strings.TrimRight(b.String(), "_-")
+	if len(name) > utils.MaxUsernameLength {
+		name = strings.TrimRight(name[:utils.MaxUsernameLength], "_-")
+	}
+	for len(name) > 0 && len(name) < utils.MinUsernameLength {
+		name += "0"
+	}
+	return name
+}
+
+// completeAdmin signs in an existing administrator. Admin accounts are
+// never created through SSO.
+func (h *OIDCHandler) completeAdmin(c *gin.Context, provider *config.OIDCProviderConfig, identity *service.OIDCIdentity) {
+	if !provider.AdminLogin {
+		h.fail(c, service.OIDCPurposeAdmin, "This provider is not enabled for admin sign-in", nil)
+		return
+	}
+	// With a role mapping configured, the provider must grant admin
+	if provider.RoleClaim != "" && identity.Role != "admin" {
+		h.fail(c, service.OIDCPurposeAdmin, "Your account is not authorised for the admin panel", nil)
+		return
+	}
+
+	adminModel := &models.AdminModel{DB: h.ServerDB}
+	mappings := &models.AdminOIDCMappingModel{DB: h.ServerDB}
+
+	var admin *models.Admin
+	adminID, err := mappings.GetAdminID(identity.Provider, identity.Subject)
+	switch {
+	case err == nil:
+		admin, err = adminModel.GetByID(adminID)
+		if err != nil {
+			h.fail(c, service.OIDCPurposeAdmin, errOIDCLogin.Error(), err)
+			return
+		}
+		mappings.Touch(identity.Provider, identity.Subject, identity.Email)
+	case errors.Is(err, sql.ErrNoRows):
+		if identity.Email == "" || !identity.EmailVerified {
+			h.fail(c, service.OIDCPurposeAdmin, "A verified email address is required for admin sign-in", nil)
+			return
+		}
+		admin, err = adminModel.GetByEmail(identity.Email)
+		if err != nil {
+			h.fail(c, service.OIDCPurposeAdmin, "No administrator account matches this sign-in", err)
+			return
+		}
+		if err := mappings.Link(admin.ID, identity.Provider, identity.Subject, identity.Issuer, identity.Email); err != nil {
+			h.fail(c, service.OIDCPurposeAdmin, errOIDCLogin.Error(), err)
+			return
+		}
+	default:
+		h.fail(c, service.OIDCPurposeAdmin, errOIDCLogin.Error(), err)
+		return
+	}
+
+	if !admin.IsActive {
+		h.fail(c, service.OIDCPurposeAdmin, "This administrator account is disabled", nil)
+		return
+	}
+
+	duration := 30 * 24 * time.Hour
+	adminSession, err := (&models.AdminSessionModel{DB: h.ServerDB}).CreateSession(admin.ID, c.ClientIP(), c.Request.UserAgent(), duration)
+	if err != nil {
+		h.fail(c, service.OIDCPurposeAdmin, "Failed to create session", err)
+		return
+	}
+	adminModel.UpdateLastLogin(admin.ID)
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     "admin_session",
+		Value:    adminSession.SessionID,
+		Path:     "/",
+		MaxAge:   int(duration.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPSRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Redirect(http.StatusFound, "/"+config.GetGlobalConfig().GetAdminPath())
+}
+
+// takeRequest reads and clears the pending login cookie
+func (h *OIDCHandler) takeRequest(c *gin.Context) *service.OIDCAuthRequest {
+	value, err := c.Cookie(oidcRequestCookie)
+	if err != nil || value == "" {
+		return nil
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcRequestCookie,
+		Value:    "",
+		Path:     "/auth/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isHTTPSRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+	var req service.OIDCAuthRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil
+	}
+	return &req
+}
+
+// redirectURL returns the callback URL registered with the provider
+func (h *OIDCHandler) redirectURL(c *gin.Context, provider *config.OIDCProviderConfig) string {
+	if provider.RedirectURL != "" {
+		return provider.RedirectURL
+	}
+	return utils.GetHostInfo(c).FullHost + "/auth/oidc/" + provider.Name + "/callback"
+}
+
+// fail renders the matching login page with an error
+func (h *OIDCHandler) fail(c *gin.Context, purpose, message string, err error) {
+	if err != nil {
+		log.Printf("OIDC login failed (%s): %v", c.Param("provider"), err)
+	}
+
+	cfg := config.GetGlobalConfig()
+	if purpose == service.OIDCPurposeAdmin {
+		title := "Weather Service"
+		if cfg != nil && cfg.Server.Branding.Title != "" {
+			title = cfg.Server.Branding.Title
+		}
+		c.HTML(http.StatusUnauthorized, "admin/login.tmpl", gin.H{
+			"error":          message,
+			"branding":       gin.H{"Title": title},
+			"version":        middleware.GetVersion(),
+			"oidc_providers": cfg.OIDCLoginProviders(true),
+			"ldap_enabled":   cfg.Server.Auth.LDAP.Enabled,
+		})
+		return
+	}
+
+	NegotiateErrorResponse(c, http.StatusUnauthorized, "page/login.tmpl", ErrUnauthorized, message, utils.TemplateData(c, gin.H{
+		"title":              "Login",
+		"error":              message,
+		"registrationPublic": isPublicRegistrationEnabled(),
+		"oidcProviders":      cfg.OIDCLoginProviders(false),
+		"ldapEnabled":        cfg.Server.Auth.LDAP.Enabled,
+	}))
+}
+
+func encodeClaims(claims map[string]interface{}) string {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func isHTTPSRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
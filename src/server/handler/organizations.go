@@ -0,0 +1,845 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/apimgr/weather/src/config"
+	"github.com/apimgr/weather/src/server/middleware"
+	"github.com/apimgr/weather/src/server/model"
+)
+
+const (
+	// maxOrgLocations caps an organization's shared locations
+	maxOrgLocations = 100
+	// maxOrgTokens caps an organization's API tokens
+	maxOrgTokens = 10
+)
+
+// OrgHandler serves the organization API: organizations, members, invites,
+// shared locations, alert subscriptions, channels and org tokens
+type OrgHandler struct {
+	DB *sql.DB
+}
+
+// NewOrgHandler creates a new organization handler
+func NewOrgHandler(db *sql.DB) *OrgHandler {
+	return &OrgHandler{DB: db}
+}
+
+func (h *OrgHandler) orgs() *models.OrgModel {
+	return &models.OrgModel{DB: h.DB}
+}
+
+func (h *OrgHandler) alerts() *models.OrgAlertModel {
+	return &models.OrgAlertModel{DB: h.DB}
+}
+
+// requireUser returns the signed-in user. Organization tokens are rejected:
+// they act for an organization, not a person.
+func (h *OrgHandler) requireUser(c *gin.Context) (*models.User, bool) {
+	if _, ok := middleware.GetOrgToken(c); ok {
+		Forbidden(c, "organization tokens cannot be used for this request")
+		return nil, false
+	}
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		Unauthorized(c, "Authentication required")
+		return nil, false
+	}
+	return user, true
+}
+
+// orgAccess resolves :org_id and checks the caller holds at least min.
+// Members are checked by their role; organization tokens act as editors of
+// their own organization. Organizations the caller cannot see are reported
+// as not found.
+func (h *OrgHandler) orgAccess(c *gin.Context, min string) (int64, string, bool) {
+	orgID, err := strconv.ParseInt(c.Param("org_id"), 10, 64)
+	if err != nil {
+		BadRequest(c, "invalid organization id")
+		return 0, "", false
+	}
+
+	if token, ok := middleware.GetOrgToken(c); ok {
+		if token.OwnerID != orgID {
+			NotFound(c, "organization not found")
+			return 0, "", false
+		}
+		if !models.OrgRoleAtLeast(models.OrgRoleEditor, min) {
+			Forbidden(c, "organization tokens cannot manage members, invites or tokens")
+			return 0, "", false
+		}
+		return orgID, models.OrgRoleEditor, true
+	}
+
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		Unauthorized(c, "Authentication required")
+		return 0, "", false
+	}
+	role, err := h.orgs().MemberRole(orgID, user.ID)
+	if errors.Is(err, models.ErrNotOrgMember) {
+		NotFound(c, "organization not found")
+		return 0, "", false
+	}
+	if err != nil {
+		InternalError(c, "failed to load membership")
+		return 0, "", false
+	}
+	if !models.OrgRoleAtLeast(role, min) {
+		Forbidden(c, fmt.Sprintf("requires the %s role", min))
+		return 0, "", false
+	}
+	return orgID, role, true
+}
+
+func paramID(c *gin.Context, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		BadRequest(c, "invalid "+strings.ReplaceAll(name, "_", " "))
+		return 0, false
+	}
+	return id, true
+}
+
+// orgError maps model errors to responses
+func orgError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, models.ErrOrgNotFound), errors.Is(err, models.ErrNotOrgMember):
+		NotFound(c, err.Error())
+	case errors.Is(err, models.ErrOrgSlugTaken), errors.Is(err, models.ErrLastOrgOwner):
+		Conflict(c, err.Error())
+	case errors.Is(err, models.ErrOrgInviteEmail):
+		Forbidden(c, err.Error())
+	case strings.HasSuffix(err.Error(), "not found"):
+		NotFound(c, err.Error())
+	default:
+		BadRequest(c, err.Error())
+	}
+}
+
+// ListOrgs returns the caller's organizations and roles
+// GET /api/v1/orgs
+func (h *OrgHandler) ListOrgs(c *gin.Context) {
+	user, ok := h.requireUser(c)
+	if !ok {
+		return
+	}
+	orgs, err := h.orgs().ListForUser(user.ID)
+	if err != nil {
+		InternalError(c, "failed to list organizations")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "organizations": orgs})
+}
+
+// CreateOrg creates an organization owned by the caller: {name, slug}
+// POST /api/v1/orgs
+func (h *OrgHandler) CreateOrg(c *gin.Context) {
+	user, ok := h.requireUser(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+		Slug string `json:"slug"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+	org, err := h.orgs().Create(req.Name, strings.ToLower(strings.TrimSpace(req.Slug)), user.ID)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "organization": org})
+}
+
+// GetOrg returns an organization and the caller's role in it
+// GET /api/v1/orgs/:org_id
+func (h *OrgHandler) GetOrg(c *gin.Context) {
+	orgID, role, ok := h.orgAccess(c, models.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	org, err := h.orgs().Get(orgID)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	org.Role = role
+	c.JSON(http.StatusOK, gin.H{"ok": true, "organization": org})
+}
+
+// UpdateOrg renames an organization: {name}
+// PATCH /api/v1/orgs/:org_id
+func (h *OrgHandler) UpdateOrg(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+	if err := h.orgs().Rename(orgID, req.Name); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Organization updated"})
+}
+
+// DeleteOrg deletes an organization with its locations, subscriptions,
+// channels, invites and tokens
+// DELETE /api/v1/orgs/:org_id
+func (h *OrgHandler) DeleteOrg(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	if err := h.orgs().Delete(orgID); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Organization deleted"})
+}
+
+// ListMembers returns an organization's members
+// GET /api/v1/orgs/:org_id/members
+func (h *OrgHandler) ListMembers(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	members, err := h.orgs().ListMembers(orgID)
+	if err != nil {
+		InternalError(c, "failed to list members")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "members": members})
+}
+
+// UpdateMember changes a member's role or on-call flag: {role, on_call}.
+// Owners can change anyone; members can put themselves on or off call.
+// PATCH /api/v1/orgs/:org_id/members/:user_id
+func (h *OrgHandler) UpdateMember(c *gin.Context) {
+	orgID, callerRole, ok := h.orgAccess(c, models.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	memberID, ok := paramID(c, "user_id")
+	if !ok {
+		return
+	}
+	var req struct {
+		Role   *string `json:"role"`
+		OnCall *bool   `json:"on_call"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+
+	member, err := h.orgs().GetMember(orgID, memberID)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	current, onCall := member.Role, member.OnCall
+
+	role := current
+	if req.Role != nil {
+		role = *req.Role
+	}
+	if req.OnCall != nil {
+		onCall = *req.OnCall
+	}
+
+	caller, _ := middleware.GetCurrentUser(c)
+	selfOnCallOnly := caller != nil && caller.ID == memberID && role == current
+	if callerRole != models.OrgRoleOwner && !selfOnCallOnly {
+		Forbidden(c, "requires the owner role")
+		return
+	}
+
+	if err := h.orgs().UpdateMember(orgID, memberID, role, onCall); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Member updated"})
+}
+
+// RemoveMember removes a member. Owners can remove anyone; members can
+// remove themselves to leave.
+// DELETE /api/v1/orgs/:org_id/members/:user_id
+func (h *OrgHandler) RemoveMember(c *gin.Context) {
+	orgID, callerRole, ok := h.orgAccess(c, models.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	memberID, ok := paramID(c, "user_id")
+	if !ok {
+		return
+	}
+	caller, _ := middleware.GetCurrentUser(c)
+	if callerRole != models.OrgRoleOwner && (caller == nil || caller.ID != memberID) {
+		Forbidden(c, "requires the owner role")
+		return
+	}
+	if err := h.orgs().RemoveMember(orgID, memberID); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Member removed"})
+}
+
+// ListInvites returns an organization's pending invites
+// GET /api/v1/orgs/:org_id/invites
+func (h *OrgHandler) ListInvites(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	invites, err := h.orgs().ListInvites(orgID)
+	if err != nil {
+		InternalError(c, "failed to list invites")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "invites": invites})
+}
+
+// CreateInvite invites someone by email: {email, role, expires_in_days}.
+// The returned URL registers new users; existing users accept the code
+// through the API.
+// POST /api/v1/orgs/:org_id/invites
+func (h *OrgHandler) CreateInvite(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	caller, _ := middleware.GetCurrentUser(c)
+	var req struct {
+		Email         string `json:"email"`
+		Role          string `json:"role"`
+		ExpiresInDays int    `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+	if !strings.Contains(req.Email, "@") {
+		BadRequest(c, "a valid email address is required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.OrgRoleViewer
+	}
+	if req.ExpiresInDays <= 0 {
+		req.ExpiresInDays = config.GetUserInviteExpirationDays()
+	}
+
+	invite, err := h.orgs().CreateInvite(orgID, req.Email, req.Role, caller.ID, req.ExpiresInDays)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"ok":         true,
+		"invite":     invite,
+		"invite_url": fmt.Sprintf("%s://%s/auth/invite/user/%s", requestScheme(c), c.Request.Host, invite.Token),
+	})
+}
+
+func requestScheme(c *gin.Context) string {
+	if scheme := c.GetHeader("X-Forwarded-Proto"); scheme != "" {
+		return scheme
+	}
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// RevokeInvite deletes a pending invite
+// DELETE /api/v1/orgs/:org_id/invites/:invite_id
+func (h *OrgHandler) RevokeInvite(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	inviteID, ok := paramID(c, "invite_id")
+	if !ok {
+		return
+	}
+	if err := h.orgs().RevokeInvite(orgID, inviteID); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Invite revoked"})
+}
+
+// GetInvite shows which organization and role an invite code grants
+// GET /api/v1/orgs/invites/:code
+func (h *OrgHandler) GetInvite(c *gin.Context) {
+	if _, ok := h.requireUser(c); !ok {
+		return
+	}
+	invite, err := h.orgs().GetInvite(c.Param("code"))
+	if err != nil {
+		NotFound(c, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "organization": gin.H{
+		"id": invite.OrgID, "name": invite.OrgName,
+	}, "role": invite.OrgRole, "expires_at": invite.ExpiresAt})
+}
+
+// AcceptInvite adds the caller to the invite's organization
+// POST /api/v1/orgs/invites/:code/accept
+func (h *OrgHandler) AcceptInvite(c *gin.Context) {
+	user, ok := h.requireUser(c)
+	if !ok {
+		return
+	}
+	invite, err := h.orgs().AcceptInvite(c.Param("code"), user)
+	if err != nil {
+		if errors.Is(err, models.ErrOrgInviteEmail) {
+			orgError(c, err)
+			return
+		}
+		NotFound(c, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "org_id": invite.OrgID, "role": invite.OrgRole})
+}
+
+type orgLocationRequest struct {
+	Name          string   `json:"name"`
+	Latitude      *float64 `json:"latitude"`
+	Longitude     *float64 `json:"longitude"`
+	Timezone      string   `json:"timezone"`
+	AlertsEnabled *bool    `json:"alerts_enabled"`
+}
+
+func (r *orgLocationRequest) validate() error {
+	if strings.TrimSpace(r.Name) == "" || r.Latitude == nil || r.Longitude == nil {
+		return fmt.Errorf("name, latitude and longitude are required")
+	}
+	if *r.Latitude < -90 || *r.Latitude > 90 {
+		return fmt.Errorf("Latitude must be between -90 and 90")
+	}
+	if *r.Longitude < -180 || *r.Longitude > 180 {
+		return fmt.Errorf("Longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// ListLocations returns an organization's shared locations
+// GET /api/v1/orgs/:org_id/locations
+func (h *OrgHandler) ListLocations(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	locations, err := h.alerts().ListLocations(orgID)
+	if err != nil {
+		InternalError(c, "failed to list locations")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "locations": locations})
+}
+
+// GetLocation returns one shared location
+// GET /api/v1/orgs/:org_id/locations/:location_id
+func (h *OrgHandler) GetLocation(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	locationID, ok := paramID(c, "location_id")
+	if !ok {
+		return
+	}
+	location, err := h.alerts().GetLocation(orgID, locationID)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "location": location})
+}
+
+// CreateLocation adds a shared location: {name, latitude, longitude, timezone}
+// POST /api/v1/orgs/:org_id/locations
+func (h *OrgHandler) CreateLocation(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleEditor)
+	if !ok {
+		return
+	}
+	var req orgLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+	if err := req.validate(); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	count, err := h.alerts().CountLocations(orgID)
+	if err != nil {
+		InternalError(c, "failed to check location count")
+		return
+	}
+	if count >= maxOrgLocations {
+		BadRequest(c, fmt.Sprintf("Maximum of %d locations allowed per organization", maxOrgLocations))
+		return
+	}
+
+	location, err := h.alerts().CreateLocation(orgID, strings.TrimSpace(req.Name), *req.Latitude, *req.Longitude, req.Timezone)
+	if err != nil {
+		InternalError(c, "failed to create location")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "location": location})
+}
+
+// UpdateLocation replaces a shared location's details
+// PUT /api/v1/orgs/:org_id/locations/:location_id
+func (h *OrgHandler) UpdateLocation(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleEditor)
+	if !ok {
+		return
+	}
+	locationID, ok := paramID(c, "location_id")
+	if !ok {
+		return
+	}
+	location, err := h.alerts().GetLocation(orgID, locationID)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	var req orgLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+	if err := req.validate(); err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+
+	location.Name = strings.TrimSpace(req.Name)
+	location.Latitude, location.Longitude = *req.Latitude, *req.Longitude
+	location.Timezone = req.Timezone
+	if req.AlertsEnabled != nil {
+		location.AlertsEnabled = *req.AlertsEnabled
+	}
+	if err := h.alerts().UpdateLocation(location); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "location": location})
+}
+
+// DeleteLocation removes a shared location
+// DELETE /api/v1/orgs/:org_id/locations/:location_id
+func (h *OrgHandler) DeleteLocation(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleEditor)
+	if !ok {
+		return
+	}
+	locationID, ok := paramID(c, "location_id")
+	if !ok {
+		return
+	}
+	if err := h.alerts().DeleteLocation(orgID, locationID); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Location deleted"})
+}
+
+// ListSubscriptions returns an organization's alert subscriptions
+// GET /api/v1/orgs/:org_id/subscriptions
+func (h *OrgHandler) ListSubscriptions(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	subs, err := h.alerts().ListSubscriptions(orgID)
+	if err != nil {
+		InternalError(c, "failed to list subscriptions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "subscriptions": subs})
+}
+
+// CreateSubscription subscribes to alerts:
+// {location_id, alert_type, min_severity, enabled}. A subscription for the
+// same location and alert type is replaced.
+// POST /api/v1/orgs/:org_id/subscriptions
+func (h *OrgHandler) CreateSubscription(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleEditor)
+	if !ok {
+		return
+	}
+	var req struct {
+		LocationID  int64  `json:"location_id"`
+		AlertType   string `json:"alert_type"`
+		MinSeverity string `json:"min_severity"`
+		Enabled     *bool  `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+	sub := &models.OrgSubscription{
+		OrgID:       orgID,
+		LocationID:  req.LocationID,
+		AlertType:   strings.TrimSpace(req.AlertType),
+		MinSeverity: strings.ToLower(strings.TrimSpace(req.MinSeverity)),
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	}
+	sub, err := h.alerts().CreateSubscription(sub)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "subscription": sub})
+}
+
+// DeleteSubscription removes an alert subscription
+// DELETE /api/v1/orgs/:org_id/subscriptions/:subscription_id
+func (h *OrgHandler) DeleteSubscription(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleEditor)
+	if !ok {
+		return
+	}
+	subID, ok := paramID(c, "subscription_id")
+	if !ok {
+		return
+	}
+	if err := h.alerts().DeleteSubscription(orgID, subID); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Subscription deleted"})
+}
+
+type orgChannelRequest struct {
+	ChannelType string                 `json:"channel_type"`
+	Name        string                 `json:"name"`
+	Route       string                 `json:"route"`
+	Config      map[string]interface{} `json:"config"`
+	Enabled     *bool                  `json:"enabled"`
+}
+
+// ListChannels returns an organization's notification channel configs
+// GET /api/v1/orgs/:org_id/channels
+func (h *OrgHandler) ListChannels(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleViewer)
+	if !ok {
+		return
+	}
+	channels, err := h.alerts().ListChannels(orgID)
+	if err != nil {
+		InternalError(c, "failed to list channels")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "channels": channels})
+}
+
+// CreateChannel adds a channel config: {channel_type, name, route, config,
+// enabled}. Route is on_call (default), members or address.
+// POST /api/v1/orgs/:org_id/channels
+func (h *OrgHandler) CreateChannel(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleEditor)
+	if !ok {
+		return
+	}
+	var req orgChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+	channel, err := h.alerts().CreateChannel(&models.OrgChannel{
+		OrgID:       orgID,
+		ChannelType: strings.ToLower(strings.TrimSpace(req.ChannelType)),
+		Name:        strings.TrimSpace(req.Name),
+		Route:       req.Route,
+		Config:      req.Config,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	})
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"ok": true, "channel": channel})
+}
+
+// UpdateChannel replaces a channel config
+// PUT /api/v1/orgs/:org_id/channels/:channel_id
+func (h *OrgHandler) UpdateChannel(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleEditor)
+	if !ok {
+		return
+	}
+	channelID, ok := paramID(c, "channel_id")
+	if !ok {
+		return
+	}
+	channel, err := h.alerts().GetChannel(orgID, channelID)
+	if err != nil {
+		orgError(c, err)
+		return
+	}
+	var req orgChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+
+	if req.ChannelType != "" {
+		channel.ChannelType = strings.ToLower(strings.TrimSpace(req.ChannelType))
+	}
+	if req.Route != "" {
+		channel.Route = req.Route
+	}
+	if req.Config != nil {
+		channel.Config = req.Config
+	}
+	if req.Enabled != nil {
+		channel.Enabled = *req.Enabled
+	}
+	channel.Name = strings.TrimSpace(req.Name)
+	if err := h.alerts().UpdateChannel(channel); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "channel": channel})
+}
+
+// DeleteChannel removes a channel config
+// DELETE /api/v1/orgs/:org_id/channels/:channel_id
+func (h *OrgHandler) DeleteChannel(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleEditor)
+	if !ok {
+		return
+	}
+	channelID, ok := paramID(c, "channel_id")
+	if !ok {
+		return
+	}
+	if err := h.alerts().DeleteChannel(orgID, channelID); err != nil {
+		orgError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Channel deleted"})
+}
+
+// ListTokens returns an organization's API tokens
+// GET /api/v1/orgs/:org_id/tokens
+func (h *OrgHandler) ListTokens(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	tokens, err := (&models.TokenModelV2{DB: h.DB}).ListTokens(models.OwnerTypeOrg, orgID)
+	if err != nil {
+		InternalError(c, "failed to list tokens")
+		return
+	}
+	if tokens == nil {
+		tokens = []*models.Token{}
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "tokens": tokens})
+}
+
+// CreateToken creates an org_ API token: {name, scopes, expires_in,
+// allowed_ips, rate_limit, daily_quota}. The token is only shown once.
+// POST /api/v1/orgs/:org_id/tokens
+func (h *OrgHandler) CreateToken(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "invalid request body")
+		return
+	}
+	if req.LocationID != nil {
+		BadRequest(c, "organization tokens cannot be bound to a location")
+		return
+	}
+
+	tokenModel := &models.TokenModelV2{DB: h.DB}
+	count, err := tokenModel.CountTokens(models.OwnerTypeOrg, orgID)
+	if err != nil {
+		InternalError(c, "failed to count tokens")
+		return
+	}
+	if count >= maxOrgTokens {
+		BadRequest(c, fmt.Sprintf("Maximum %d tokens per organization", maxOrgTokens))
+		return
+	}
+
+	allowedIPs, err := models.ParseAllowedIPs(req.AllowedIPs)
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	scopes := strings.TrimSpace(req.Scopes)
+	if scopes == "" {
+		scopes = models.ScopeGlobal
+	}
+	var expiration time.Duration
+	if req.ExpiresIn > 0 {
+		expiration = time.Duration(req.ExpiresIn) * 24 * time.Hour
+	}
+
+	token, err := tokenModel.CreateToken(models.OwnerTypeOrg, orgID, req.Name, scopes, expiration, models.TokenRestrictions{
+		AllowedIPs:        allowedIPs,
+		RequestsPerMinute: req.RateLimit,
+		DailyQuota:        req.DailyQuota,
+	})
+	if err != nil {
+		BadRequest(c, err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"ok":      true,
+		"token":   token,
+		"message": "Token created. This token will only be shown once.",
+	})
+}
+
+// RevokeToken deletes an organization API token
+// DELETE /api/v1/orgs/:org_id/tokens/:token_id
+func (h *OrgHandler) RevokeToken(c *gin.Context) {
+	orgID, _, ok := h.orgAccess(c, models.OrgRoleOwner)
+	if !ok {
+		return
+	}
+	tokenID, ok := paramID(c, "token_id")
+	if !ok {
+		return
+	}
+	if err := (&models.TokenModelV2{DB: h.DB}).DeleteToken(tokenID, models.OwnerTypeOrg, orgID); err != nil {
+		NotFound(c, "token not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message": "Token revoked"})
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/apimgr/weather/src/server/middleware"
 	models "github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-webauthn/webauthn/protocol"
@@ -27,13 +28,19 @@ const (
 	passkeyKindLogin          = "login"
 	passkeyKindTwoFactor      = "two_factor"
 	passkeyKindRegistration   = "registration"
+	passkeyKindSignup         = "signup"
 	passkeyUserHandlePrefix   = "usr:"
+	passkeyAdminHandlePrefix  = "adm:"
 )
 
 var passkeyCeremonyCache = cache.New(passkeyCeremonyTTL, 30*time.Minute)
 
 type PasskeyHandler struct {
+	// users.db
 	DB *sql.DB
+	// server.db, for admin passkeys
+	ServerDB *sql.DB
+	Store    store.Store
 }
 
 type passkeyCeremonyState struct {
@@ -41,7 +48,13 @@ type passkeyCeremonyState struct {
 	UserID              int64
 	PendingSessionToken string
 	Name                string
-	SessionData         webauthn.SessionData
+	// AdminOnly rejects discoverable logins that resolve to a user
+	AdminOnly bool
+	// Signup only: the account to create once the passkey is registered
+	Username    string
+	Email       string
+	UserHandle  []byte
+	SessionData webauthn.SessionData
 }
 
 type passkeyRegistrationStartRequest struct {
@@ -51,6 +64,8 @@ type passkeyRegistrationStartRequest struct {
 
 type passkeyChallengeRequest struct {
 	SessionToken string `json:"session_token"`
+	// Target "admin" restricts a discoverable login to admin passkeys
+	Target string `json:"target"`
 }
 
 type passkeySummary struct {
@@ -63,9 +78,14 @@ type passkeySummary struct {
 type passkeyUser struct {
 	user        *models.User
 	credentials []webauthn.Credential
+	// handle overrides the usr:<id> handle for accounts created with a passkey
+	handle []byte
 }
 
 func (u *passkeyUser) WebAuthnID() []byte {
+	if len(u.handle) > 0 {
+		return u.handle
+	}
 	return []byte(fmt.Sprintf("%s%d", passkeyUserHandlePrefix, u.user.ID))
 }
 
@@ -87,8 +107,8 @@ func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
 	return u.credentials
 }
 
-func NewPasskeyHandler(db *sql.DB) *PasskeyHandler {
-	return &PasskeyHandler{DB: db}
+func NewPasskeyHandler(usersDB, serverDB *sql.DB, st store.Store) *PasskeyHandler {
+	return &PasskeyHandler{DB: usersDB, ServerDB: serverDB, Store: st}
 }
 
 func (h *PasskeyHandler) loadWebAuthnUser(user *models.User) (*passkeyUser, error) {
@@ -97,8 +117,12 @@ func (h *PasskeyHandler) loadWebAuthnUser(user *models.User) (*passkeyUser, erro
 	if err != nil {
 		return nil, err
 	}
+	handle, err := passkeyModel.GetUserHandle(user.ID)
+	if err != nil {
+		return nil, err
+	}
 
-	return &passkeyUser{user: user, credentials: credentials}, nil
+	return &passkeyUser{user: user, credentials: credentials, handle: handle}, nil
 }
 
 func (h *PasskeyHandler) buildWebAuthn(c *gin.Context) (*webauthn.WebAuthn, error) {
@@ -119,9 +143,10 @@ func (h *PasskeyHandler) buildWebAuthn(c *gin.Context) (*webauthn.WebAuthn, erro
 	}
 
 	return webauthn.New(&webauthn.Config{
-		RPID:          rpID,
-		RPDisplayName: "Weather",
-		RPOrigins:     []string{fmt.Sprintf("%s://%s", scheme, host)},
+		RPID:                  rpID,
+		RPDisplayName:         "Weather",
+		RPOrigins:             []string{fmt.Sprintf("%s://%s", scheme, host)},
+		AttestationPreference: models.LoadPasskeyPolicy().Conveyance(),
 		AuthenticatorSelection: protocol.AuthenticatorSelection{
 			UserVerification: protocol.VerificationRequired,
 		},
@@ -195,10 +220,19 @@ func cloneRequestWithBody(c *gin.Context, body []byte) *http.Request {
 	return req
 }
 
+// passkeyLookup resolves a discoverable login to a user or, for adm:
+// handles, an admin
 func (h *PasskeyHandler) passkeyLookup(rawID []byte, userHandle []byte) (webauthn.User, error) {
+	if strings.HasPrefix(string(userHandle), passkeyAdminHandlePrefix) {
+		return h.adminPasskeyLookup(rawID, userHandle)
+	}
+
 	userID, err := parsePasskeyUserHandle(userHandle)
 	if err != nil {
-		return nil, err
+		userID, err = (&models.UserPasskeyModel{DB: h.DB}).UserIDForHandle(userHandle)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	userModel := &models.UserModel{DB: h.DB}
@@ -285,15 +319,28 @@ func (h *PasskeyHandler) RegisterPasskey(c *gin.Context) {
 	}
 
 	req.Name = strings.TrimSpace(req.Name)
-	if req.Name == "" || strings.TrimSpace(req.Password) == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Passkey name and password are required"})
-		return
-	}
+	if !user.HasPassword() {
+		// Passkey-only accounts prove themselves with a recent sign-in
+		if req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Passkey name is required"})
+			return
+		}
+		session, _ := middleware.GetCurrentSession(c)
+		if session == nil || !withinReauthWindow(session.CreatedAt) {
+			c.JSON(http.StatusForbidden, gin.H{"ok": false, "error": "Sign in again with a passkey or recovery key to add a passkey", "reauth_required": true})
+			return
+		}
+	} else {
+		if req.Name == "" || strings.TrimSpace(req.Password) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Passkey name and password are required"})
+			return
+		}
 
-	userModel := &models.UserModel{DB: h.DB}
-	if !userModel.CheckPassword(user, req.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Invalid password"})
-		return
+		userModel := &models.UserModel{DB: h.DB}
+		if !userModel.CheckPassword(user, req.Password) {
+			c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Invalid password"})
+			return
+		}
 	}
 
 	waUser, err := h.loadWebAuthnUser(user)
@@ -371,6 +418,10 @@ func (h *PasskeyHandler) finishPasskeyRegistration(c *gin.Context, user *models.
 		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
 		return
 	}
+	if err := models.LoadPasskeyPolicy().Check(credential); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
 
 	passkeyModel := &models.UserPasskeyModel{DB: h.DB}
 	passkey, err := passkeyModel.Create(user.ID, state.Name, credential)
@@ -422,6 +473,17 @@ func (h *PasskeyHandler) DeletePasskey(c *gin.Context) {
 	}
 
 	passkeyModel := &models.UserPasskeyModel{DB: h.DB}
+	if !user.HasPassword() {
+		count, err := passkeyModel.CountByUserID(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to load passkeys"})
+			return
+		}
+		if count <= 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Cannot delete the only passkey of an account without a password"})
+			return
+		}
+	}
 	if err := passkeyModel.DeleteByID(user.ID, passkeyID); err != nil {
 		status := http.StatusInternalServerError
 		if err.Error() == "passkey not found" {
@@ -451,7 +513,7 @@ func (h *PasskeyHandler) BeginPasskeyChallenge(c *gin.Context) {
 	}
 
 	if strings.TrimSpace(req.SessionToken) != "" {
-		pendingSession, err := loadPendingTwoFactorSession(h.DB, req.SessionToken)
+		pendingSession, err := loadPendingTwoFactorSession(c.Request.Context(), h.Store, req.SessionToken)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": err.Error()})
 			return
@@ -509,6 +571,7 @@ func (h *PasskeyHandler) BeginPasskeyChallenge(c *gin.Context) {
 
 	if err := storePasskeyCeremonyState(c, &passkeyCeremonyState{
 		Kind:        passkeyKindLogin,
+		AdminOnly:   req.Target == "admin",
 		SessionData: *sessionData,
 	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to start passkey challenge"})
@@ -563,7 +626,16 @@ func (h *PasskeyHandler) VerifyPasskey(c *gin.Context) {
 			return
 		}
 
+		if resolvedAdmin, isAdmin := waResolvedUser.(*passkeyAdmin); isAdmin {
+			h.finishAdminPasskeyLogin(c, token, resolvedAdmin.admin, resolvedCredential)
+			return
+		}
+
 		resolvedUser, ok := waResolvedUser.(*passkeyUser)
+		if ok && state.AdminOnly {
+			c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "This passkey does not belong to an administrator"})
+			return
+		}
 		if !ok {
 			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to resolve passkey user"})
 			return
@@ -571,13 +643,13 @@ func (h *PasskeyHandler) VerifyPasskey(c *gin.Context) {
 
 		user = resolvedUser.user
 		credential = resolvedCredential
-		response, err = createFullAuthSession(h.DB, user)
+		response, err = createFullAuthSession(c.Request.Context(), h.Store, user)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to create session"})
 			return
 		}
 	case passkeyKindTwoFactor:
-		pendingSession, sessionErr := loadPendingTwoFactorSession(h.DB, state.PendingSessionToken)
+		pendingSession, sessionErr := loadPendingTwoFactorSession(c.Request.Context(), h.Store, state.PendingSessionToken)
 		if sessionErr != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": sessionErr.Error()})
 			return
@@ -605,14 +677,13 @@ func (h *PasskeyHandler) VerifyPasskey(c *gin.Context) {
 			return
 		}
 
-		response, err = createFullAuthSession(h.DB, user)
+		response, err = createFullAuthSession(c.Request.Context(), h.Store, user)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to create session"})
 			return
 		}
 
-		sessionModel := &models.SessionModel{DB: h.DB}
-		_ = sessionModel.Delete(pendingSession.ID)
+		_ = h.Store.DeleteSession(c.Request.Context(), pendingSession.ID)
 	default:
 		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid passkey session"})
 		return
@@ -624,6 +695,7 @@ func (h *PasskeyHandler) VerifyPasskey(c *gin.Context) {
 	}
 
 	_ = userModel.UpdateLastLogin(user.ID, c.ClientIP())
+	noteLoginSucceeded(user, requestLoginContext(c))
 	passkeyCeremonyCache.Delete(token)
 	clearPasskeyCeremonyCookie(c)
 	setUserSessionCookie(c, response.Token, *response.ExpiresAt)
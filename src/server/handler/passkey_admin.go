@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/config"
+	models "github.com/apimgr/weather/src/server/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// passkeyAdmin is an admin as a WebAuthn user; its handle is adm:<id> so
+// discoverable logins can tell admins from users
+type passkeyAdmin struct {
+	admin       *models.Admin
+	credentials []webauthn.Credential
+}
+
+func (a *passkeyAdmin) WebAuthnID() []byte {
+	return []byte(fmt.Sprintf("%s%d", passkeyAdminHandlePrefix, a.admin.ID))
+}
+
+func (a *passkeyAdmin) WebAuthnName() string {
+	return a.admin.Username
+}
+
+func (a *passkeyAdmin) WebAuthnDisplayName() string {
+	return a.admin.Username
+}
+
+func (a *passkeyAdmin) WebAuthnCredentials() []webauthn.Credential {
+	return a.credentials
+}
+
+// Admin ceremonies are keyed by admin id rather than a cookie so bearer
+// token clients can complete them
+func adminPasskeyCeremonyKey(kind string, adminID int64) string {
+	return fmt.Sprintf("admin:%s:%d", kind, adminID)
+}
+
+func currentAdmin(c *gin.Context) (*models.Admin, bool) {
+	value, ok := c.Get("admin")
+	if !ok {
+		return nil, false
+	}
+	admin, ok := value.(*models.Admin)
+	return admin, ok && admin != nil
+}
+
+func (h *PasskeyHandler) loadWebAuthnAdmin(admin *models.Admin) (*passkeyAdmin, error) {
+	credentials, err := (&models.AdminPasskeyModel{DB: h.ServerDB}).ListCredentialsByAdminID(admin.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &passkeyAdmin{admin: admin, credentials: credentials}, nil
+}
+
+func (h *PasskeyHandler) adminPasskeyLookup(rawID []byte, userHandle []byte) (webauthn.User, error) {
+	adminID, err := strconv.ParseInt(strings.TrimPrefix(string(userHandle), passkeyAdminHandlePrefix), 10, 64)
+	if err != nil || adminID <= 0 {
+		return nil, fmt.Errorf("invalid user handle")
+	}
+
+	admin, err := (&models.AdminModel{DB: h.ServerDB}).GetByID(adminID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin")
+	}
+	if !admin.IsActive {
+		return nil, fmt.Errorf("Account is disabled")
+	}
+
+	waAdmin, err := h.loadWebAuthnAdmin(admin)
+	if err != nil {
+		return nil, err
+	}
+	for _, credential := range waAdmin.credentials {
+		if bytes.Equal(credential.ID, rawID) {
+			return waAdmin, nil
+		}
+	}
+
+	return nil, fmt.Errorf("credential not found")
+}
+
+// finishAdminPasskeyLogin starts an admin panel session after a
+// discoverable passkey login resolved to an admin
+func (h *PasskeyHandler) finishAdminPasskeyLogin(c *gin.Context, ceremonyToken string, admin *models.Admin, credential *webauthn.Credential) {
+	if err := (&models.AdminPasskeyModel{DB: h.ServerDB}).UpdateCredential(admin.ID, credential); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to update passkey"})
+		return
+	}
+
+	duration := 30 * 24 * time.Hour
+	adminSession, err := (&models.AdminSessionModel{DB: h.ServerDB}).CreateSession(admin.ID, c.ClientIP(), c.Request.UserAgent(), duration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to create session"})
+		return
+	}
+	(&models.AdminModel{DB: h.ServerDB}).UpdateLastLogin(admin.ID)
+
+	passkeyCeremonyCache.Delete(ceremonyToken)
+	clearPasskeyCeremonyCookie(c)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     "admin_session",
+		Value:    adminSession.SessionID,
+		Path:     "/",
+		MaxAge:   int(duration.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPSRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":       true,
+		"message":  "Login successful",
+		"type":     "admin",
+		"redirect": "/" + config.GetGlobalConfig().GetAdminPath(),
+		"admin": gin.H{
+			"id":       admin.ID,
+			"username": admin.Username,
+			"email":    admin.Email,
+		},
+	})
+}
+
+// ListAdminPasskeys lists the current admin's passkeys
+func (h *PasskeyHandler) ListAdminPasskeys(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Not authenticated"})
+		return
+	}
+
+	passkeys, err := (&models.AdminPasskeyModel{DB: h.ServerDB}).ListByAdminID(admin.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to load passkeys"})
+		return
+	}
+
+	summaries := make([]passkeySummary, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		summaries = append(summaries, passkeySummary{
+			ID:         passkey.ID,
+			Name:       passkey.Name,
+			CreatedAt:  passkey.CreatedAt,
+			LastUsedAt: passkey.LastUsedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":       true,
+		"passkeys": summaries,
+	})
+}
+
+// RegisterAdminPasskey adds a passkey to the current admin: {name, password}
+// returns creation options, then the attestation saves the passkey
+func (h *PasskeyHandler) RegisterAdminPasskey(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Not authenticated"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid request body"})
+		return
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid request body"})
+		return
+	}
+
+	key := adminPasskeyCeremonyKey(passkeyKindRegistration, admin.ID)
+	if _, hasResponse := envelope["response"]; hasResponse {
+		h.finishAdminPasskeyRegistration(c, admin, key, body)
+		return
+	}
+
+	var req passkeyRegistrationStartRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid request body"})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || strings.TrimSpace(req.Password) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Passkey name and password are required"})
+		return
+	}
+	if valid, err := models.VerifyPassword(req.Password, admin.PasswordHash); err != nil || !valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Invalid password"})
+		return
+	}
+
+	waAdmin, err := h.loadWebAuthnAdmin(admin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to load passkeys"})
+		return
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(waAdmin.credentials))
+	for _, credential := range waAdmin.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	wa, err := h.buildWebAuthn(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to initialize passkeys"})
+		return
+	}
+
+	options, sessionData, err := wa.BeginRegistration(
+		waAdmin,
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			UserVerification: protocol.VerificationRequired,
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+		}),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	passkeyCeremonyCache.Set(key, &passkeyCeremonyState{
+		Kind:        passkeyKindRegistration,
+		UserID:      admin.ID,
+		Name:        req.Name,
+		SessionData: *sessionData,
+	}, passkeyCeremonyTTL)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"options": options,
+	})
+}
+
+func (h *PasskeyHandler) finishAdminPasskeyRegistration(c *gin.Context, admin *models.Admin, key string, body []byte) {
+	rawState, found := passkeyCeremonyCache.Get(key)
+	state, ok := rawState.(*passkeyCeremonyState)
+	if !found || !ok || state.UserID != admin.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid passkey registration session"})
+		return
+	}
+
+	waAdmin, err := h.loadWebAuthnAdmin(admin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to load passkeys"})
+		return
+	}
+
+	wa, err := h.buildWebAuthn(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to initialize passkeys"})
+		return
+	}
+
+	credential, err := wa.FinishRegistration(waAdmin, state.SessionData, cloneRequestWithBody(c, body))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if err := models.LoadPasskeyPolicy().Check(credential); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	passkey, err := (&models.AdminPasskeyModel{DB: h.ServerDB}).Create(admin.ID, state.Name, credential)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	passkeyCeremonyCache.Delete(key)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"message": "Passkey registered successfully",
+		"passkey": passkeySummary{
+			ID:         passkey.ID,
+			Name:       passkey.Name,
+			CreatedAt:  passkey.CreatedAt,
+			LastUsedAt: passkey.LastUsedAt,
+		},
+	})
+}
+
+// DeleteAdminPasskey removes one of the current admin's passkeys
+func (h *PasskeyHandler) DeleteAdminPasskey(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Not authenticated"})
+		return
+	}
+
+	passkeyID, err := strconv.ParseInt(strings.TrimSpace(c.Param("passkey_id")), 10, 64)
+	if err != nil || passkeyID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid passkey id"})
+		return
+	}
+
+	if err := (&models.AdminPasskeyModel{DB: h.ServerDB}).DeleteByID(admin.ID, passkeyID); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "passkey not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"message": "Passkey deleted successfully",
+	})
+}
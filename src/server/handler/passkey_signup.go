@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/config"
+	models "github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+type passkeySignupRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+}
+
+type passkeyRecoverRequest struct {
+	Identifier  string `json:"identifier"`
+	RecoveryKey string `json:"recovery_key"`
+}
+
+// RegisterPasswordless signs up a passkey-only account. The first call
+// sends {username, email, name} and returns creation options; the second
+// sends the attestation and creates the account.
+func (h *PasskeyHandler) RegisterPasswordless(c *gin.Context) {
+	if !config.IsMultiUserEnabled() || !config.IsRegistrationPublic() || !models.LoadPasskeyPolicy().PasswordlessSignup {
+		c.JSON(http.StatusForbidden, gin.H{"ok": false, "error": "Passkey registration is not available"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid request body"})
+		return
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid request body"})
+		return
+	}
+
+	if _, hasResponse := envelope["response"]; hasResponse {
+		h.finishPasswordlessSignup(c, body)
+		return
+	}
+
+	var req passkeySignupRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid request body"})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = "Passkey"
+	}
+	if err := utils.ValidateUsername(req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if err := utils.ValidateEmail(req.Email); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	username := utils.NormalizeUsername(req.Username)
+	userModel := &models.UserModel{DB: h.DB}
+	if _, err := userModel.GetByUsername(username); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"ok": false, "error": "Username or email already exists"})
+		return
+	}
+	if _, err := userModel.GetByEmail(req.Email); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"ok": false, "error": "Username or email already exists"})
+		return
+	}
+
+	// The account does not exist yet, so its handle is random rather than
+	// usr:<id>; it is stored with the account when the passkey is saved
+	handle := make([]byte, 32)
+	if _, err := rand.Read(handle); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to start passkey registration"})
+		return
+	}
+
+	wa, err := h.buildWebAuthn(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to initialize passkeys"})
+		return
+	}
+
+	options, sessionData, err := wa.BeginRegistration(
+		signupPasskeyUser(username, req.Email, handle),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			UserVerification: protocol.VerificationRequired,
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+		}),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	if err := storePasskeyCeremonyState(c, &passkeyCeremonyState{
+		Kind:        passkeyKindSignup,
+		Name:        req.Name,
+		Username:    username,
+		Email:       req.Email,
+		UserHandle:  handle,
+		SessionData: *sessionData,
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to start passkey registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"options": options,
+	})
+}
+
+func signupPasskeyUser(username, email string, handle []byte) *passkeyUser {
+	return &passkeyUser{
+		user:   &models.User{Username: username, Email: email},
+		handle: handle,
+	}
+}
+
+func (h *PasskeyHandler) finishPasswordlessSignup(c *gin.Context, body []byte) {
+	state, token, err := loadPasskeyCeremonyState(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if state.Kind != passkeyKindSignup {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid passkey registration session"})
+		return
+	}
+
+	wa, err := h.buildWebAuthn(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to initialize passkeys"})
+		return
+	}
+
+	credential, err := wa.FinishRegistration(signupPasskeyUser(state.Username, state.Email, state.UserHandle), state.SessionData, cloneRequestWithBody(c, body))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+	if err := models.LoadPasskeyPolicy().Check(credential); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	userModel := &models.UserModel{DB: h.DB}
+	user, err := userModel.CreatePasswordless(state.Username, state.Email, "user")
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") || strings.Contains(err.Error(), "duplicate key") {
+			c.JSON(http.StatusConflict, gin.H{"ok": false, "error": "Username or email already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to create account"})
+		return
+	}
+
+	passkeyModel := &models.UserPasskeyModel{DB: h.DB}
+	recoveryKeyModel := &models.RecoveryKeyModel{DB: h.DB}
+	var recoveryKeys []string
+	err = passkeyModel.SetUserHandle(user.ID, state.UserHandle)
+	if err == nil {
+		_, err = passkeyModel.Create(user.ID, state.Name, credential)
+	}
+	if err == nil {
+		recoveryKeys, err = recoveryKeyModel.GenerateRecoveryKeys(int(user.ID))
+	}
+	if err != nil {
+		// Without its passkey or recovery keys the account is unusable
+		_ = userModel.Delete(user.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to create account"})
+		return
+	}
+
+	passkeyCeremonyCache.Delete(token)
+	clearPasskeyCeremonyCookie(c)
+
+	response := gin.H{
+		"ok":            true,
+		"message":       "Account created. Save your recovery keys: they are the only way back in if you lose your passkey",
+		"user":          buildAuthUserSummary(user),
+		"recovery_keys": recoveryKeys,
+	}
+
+	if requiresEmailVerification() {
+		if _, err := createUserEmailVerification(user.ID, user.Email); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to start email verification"})
+			return
+		}
+		response["verification_required"] = true
+		c.JSON(http.StatusCreated, response)
+		return
+	}
+
+	session, err := createFullAuthSession(c.Request.Context(), h.Store, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Account created but failed to login"})
+		return
+	}
+	_ = userModel.UpdateLastLogin(user.ID, c.ClientIP())
+	noteLoginSucceeded(user, requestLoginContext(c))
+	setUserSessionCookie(c, session.Token, *session.ExpiresAt)
+
+	response["result"] = session
+	response["redirect"] = "/users/dashboard"
+	c.JSON(http.StatusCreated, response)
+}
+
+// RecoverPasswordless signs a passkey-only account in with a recovery key
+// so the user can register a replacement passkey. Accounts with a password
+// recover through password reset instead.
+func (h *PasskeyHandler) RecoverPasswordless(c *gin.Context) {
+	var req passkeyRecoverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid request body"})
+		return
+	}
+
+	req.Identifier = strings.TrimSpace(req.Identifier)
+	req.RecoveryKey = strings.TrimSpace(req.RecoveryKey)
+	if req.Identifier == "" || req.RecoveryKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Identifier and recovery key are required"})
+		return
+	}
+
+	userModel := &models.UserModel{DB: h.DB}
+	user, err := userModel.GetByIdentifier(req.Identifier)
+	if err != nil || user.HasPassword() {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Invalid identifier or recovery key"})
+		return
+	}
+	if err := validateAuthUser(user); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	// Wrong recovery keys count towards the same lockout as wrong passwords
+	login := requestLoginContext(c)
+	loginState := &models.LoginStateModel{DB: h.DB}
+	now := time.Now()
+	state, err := loginState.Get(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to verify recovery key"})
+		return
+	}
+	if state.Locked(now) {
+		respondAccountLocked(c, &models.AccountLockedError{UserID: user.ID, Until: *state.LockedUntil})
+		return
+	}
+
+	recoveryKeyModel := &models.RecoveryKeyModel{DB: h.DB}
+	valid, err := recoveryKeyModel.VerifyAndUseRecoveryKey(int(user.ID), req.RecoveryKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to verify recovery key"})
+		return
+	}
+	if !valid {
+		state, err := loginState.RecordFailure(user.ID, models.LoadLockoutPolicy(), now)
+		if err == nil && state.Locked(now) {
+			respondAccountLocked(c, credentialError(&models.AccountLockedError{UserID: user.ID, Until: *state.LockedUntil, Started: true}, login))
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Invalid identifier or recovery key"})
+		return
+	}
+	_ = loginState.RecordSuccess(user.ID)
+
+	session, err := createFullAuthSession(c.Request.Context(), h.Store, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to create session"})
+		return
+	}
+	_ = userModel.UpdateLastLogin(user.ID, c.ClientIP())
+	noteLoginSucceeded(user, login)
+	setUserSessionCookie(c, session.Token, *session.ExpiresAt)
+
+	remaining, _ := recoveryKeyModel.GetUnusedKeysCount(int(user.ID))
+	c.JSON(http.StatusOK, gin.H{
+		"ok":             true,
+		"message":        "Recovery key accepted. Register a new passkey now",
+		"result":         session,
+		"remaining_keys": remaining,
+		"redirect":       "/users/security",
+	})
+}
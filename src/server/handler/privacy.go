@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/apimgr/weather/src/server/middleware"
+	models "github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	privacyService      *service.PrivacyService
+	privacyServiceMutex sync.RWMutex
+)
+
+// SetPrivacy sets the service used for data exports, account erasure and
+// the retention report
+func SetPrivacy(s *service.PrivacyService) {
+	privacyServiceMutex.Lock()
+	defer privacyServiceMutex.Unlock()
+	privacyService = s
+}
+
+// getPrivacy returns the service, nil when it was never set
+func getPrivacy() *service.PrivacyService {
+	privacyServiceMutex.RLock()
+	defer privacyServiceMutex.RUnlock()
+	return privacyService
+}
+
+// PrivacyHandler handles personal data exports, account deletion and the
+// admin retention report
+type PrivacyHandler struct{}
+
+// privacyUser returns the current user and the privacy service, answering
+// the request itself when either is missing
+func privacyUser(c *gin.Context) (*models.User, *service.PrivacyService, bool) {
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Not authenticated"})
+		return nil, nil, false
+	}
+	s := getPrivacy()
+	if s == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"ok": false, "error": "Privacy service is not available"})
+		return nil, nil, false
+	}
+	return user, s, true
+}
+
+// RequestExport handles POST /api/v1/users/export
+func (h *PrivacyHandler) RequestExport(c *gin.Context) {
+	user, s, ok := privacyUser(c)
+	if !ok {
+		return
+	}
+
+	export, err := s.RequestExport(user, requestLoginContext(c))
+	if err != nil {
+		log.Printf("Failed to start data export for user %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to start data export"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"ok":      true,
+		"message": "Your data export is being prepared. You will get an email when it is ready.",
+		"export":  export,
+	})
+}
+
+// GetExport handles GET /api/v1/users/export, returning the latest export
+func (h *PrivacyHandler) GetExport(c *gin.Context) {
+	user, s, ok := privacyUser(c)
+	if !ok {
+		return
+	}
+
+	export, err := s.LatestExport(user.ID)
+	if err != nil && !errors.Is(err, service.ErrExportNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to load data export"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":     true,
+		"export": export,
+	})
+}
+
+// DownloadExport handles GET /api/v1/users/export/:id/download
+func (h *PrivacyHandler) DownloadExport(c *gin.Context) {
+	user, s, ok := privacyUser(c)
+	if !ok {
+		return
+	}
+
+	export, err := s.ReadyExport(user.ID, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, service.ErrExportNotFound) {
+			NotFound(c, "Data export not found or expired")
+			return
+		}
+		InternalError(c, "Failed to load data export")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(s.ExportPath(export.ID), fmt.Sprintf("%s-data-%s.zip", user.Username, export.CreatedAt.Format("20060102")))
+}
+
+// RequestAccountDeletion handles POST /api/v1/users/account/delete. The
+// account password is required, and the account is only deleted once the
+// link emailed to the account address is confirmed.
+func (h *PrivacyHandler) RequestAccountDeletion(c *gin.Context) {
+	user, s, ok := privacyUser(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Password is required")
+		return
+	}
+
+	expires, err := s.RequestAccountDeletion(user, req.Password, requestLoginContext(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrPasswordIncorrect):
+			c.JSON(http.StatusForbidden, gin.H{"ok": false, "error": "Password is incorrect"})
+		case errors.Is(err, models.ErrLastOrgOwner):
+			c.JSON(http.StatusConflict, gin.H{"ok": false, "error": "You are the last owner of an organization with other members. Transfer ownership or remove the members first."})
+		case errors.Is(err, service.ErrDeletionMailFailed):
+			log.Printf("Account deletion request for user %d: %v", user.ID, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"ok": false, "error": "The confirmation email could not be sent. Try again later."})
+		default:
+			log.Printf("Account deletion request for user %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to request account deletion"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"ok":         true,
+		"message":    "Check your email to confirm deleting your account.",
+		"expires_at": expires,
+	})
+}
+
+// GetAccountDeletion handles GET /api/v1/users/account/delete
+func (h *PrivacyHandler) GetAccountDeletion(c *gin.Context) {
+	user, s, ok := privacyUser(c)
+	if !ok {
+		return
+	}
+
+	expires, err := s.PendingDeletion(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to load deletion request"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":         true,
+		"pending":    expires != nil,
+		"expires_at": expires,
+	})
+}
+
+// CancelAccountDeletion handles DELETE /api/v1/users/account/delete
+func (h *PrivacyHandler) CancelAccountDeletion(c *gin.Context) {
+	user, s, ok := privacyUser(c)
+	if !ok {
+		return
+	}
+
+	if err := s.CancelAccountDeletion(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to cancel account deletion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"message": "Account deletion cancelled",
+	})
+}
+
+// ConfirmAccountDeletion handles POST /api/v1/users/account/delete/confirm
+// with the token from the emailed link, and erases the account
+func (h *PrivacyHandler) ConfirmAccountDeletion(c *gin.Context) {
+	user, s, ok := privacyUser(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		BadRequest(c, "Token is required")
+		return
+	}
+
+	receipt, err := s.ConfirmAccountDeletion(user.ID, req.Token, requestLoginContext(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrDeletionLinkInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "The deletion link is invalid or has expired"})
+		case errors.Is(err, models.ErrLastOrgOwner):
+			c.JSON(http.StatusConflict, gin.H{"ok": false, "error": "You are the last owner of an organization with other members. Transfer ownership or remove the members first."})
+		default:
+			log.Printf("Account deletion for user %d failed: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to delete account"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"message": "Your account and personal data have been deleted",
+		"receipt": receipt,
+	})
+}
+
+// RetentionReport handles GET /api/v1/{admin_path}/server/privacy/retention,
+// listing what personal data is kept and for how long
+func (h *PrivacyHandler) RetentionReport(c *gin.Context) {
+	s := getPrivacy()
+	if s == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"ok": false, "error": "Privacy service is not available"})
+		return
+	}
+
+	report, err := s.RetentionReport(c.Request.Context())
+	if err != nil {
+		log.Printf("Retention report failed: %v", err)
+		InternalError(c, "Failed to build retention report")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"classes": report,
+	})
+}
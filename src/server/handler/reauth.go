@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+	models "github.com/apimgr/weather/src/server/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/patrickmn/go-cache"
+)
+
+const (
+	// ReauthTokenHeader carries the token from AdminReauth on sensitive
+	// admin requests
+	ReauthTokenHeader    = "X-Reauth-Token"
+	passkeyKindReauth    = "reauth"
+	defaultReauthMinutes = 5
+)
+
+// reauthTokens maps step-up tokens to the admin id that earned them
+var reauthTokens = cache.New(defaultReauthMinutes*time.Minute, 10*time.Minute)
+
+// reauthWindow is how long a step-up re-authentication lasts; zero disables
+// the check
+func reauthWindow() time.Duration {
+	minutes := defaultReauthMinutes
+	if database.GetServerDB() != nil {
+		minutes = (&models.SettingsModel{}).GetInt("security.reauth_window", defaultReauthMinutes)
+	}
+	if minutes < 0 {
+		minutes = 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// withinReauthWindow reports whether an authentication at t is recent
+// enough to stand in for re-authentication
+func withinReauthWindow(t time.Time) bool {
+	window := reauthWindow()
+	return window == 0 || time.Since(t) <= window
+}
+
+// RequireAdminReauth rejects requests without a current step-up token for
+// the authenticated admin
+func RequireAdminReauth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if reauthWindow() == 0 {
+			c.Next()
+			return
+		}
+
+		admin, ok := currentAdmin(c)
+		token := strings.TrimSpace(c.GetHeader(ReauthTokenHeader))
+		if ok && token != "" {
+			if adminID, found := reauthTokens.Get(token); found && adminID.(int64) == admin.ID {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"ok":              false,
+			"error":           "Re-authentication required",
+			"reauth_required": true,
+		})
+	}
+}
+
+// BeginAdminReauth returns passkey request options for step-up
+// re-authentication of the current admin
+func (h *PasskeyHandler) BeginAdminReauth(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Not authenticated"})
+		return
+	}
+
+	waAdmin, err := h.loadWebAuthnAdmin(admin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to load passkeys"})
+		return
+	}
+	if len(waAdmin.credentials) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "No passkeys registered; re-authenticate with your password"})
+		return
+	}
+
+	wa, err := h.buildWebAuthn(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to initialize passkeys"})
+		return
+	}
+
+	options, sessionData, err := wa.BeginLogin(waAdmin, webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": err.Error()})
+		return
+	}
+
+	passkeyCeremonyCache.Set(adminPasskeyCeremonyKey(passkeyKindReauth, admin.ID), &passkeyCeremonyState{
+		Kind:        passkeyKindReauth,
+		UserID:      admin.ID,
+		SessionData: *sessionData,
+	}, passkeyCeremonyTTL)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":      true,
+		"options": options,
+	})
+}
+
+// AdminReauth verifies a passkey assertion from BeginAdminReauth, or
+// {"password"}, and returns a token for the X-Reauth-Token header
+func (h *PasskeyHandler) AdminReauth(c *gin.Context) {
+	admin, ok := currentAdmin(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Not authenticated"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid request body"})
+		return
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Invalid request body"})
+		return
+	}
+
+	if _, hasResponse := envelope["response"]; hasResponse {
+		key := adminPasskeyCeremonyKey(passkeyKindReauth, admin.ID)
+		rawState, found := passkeyCeremonyCache.Get(key)
+		state, ok := rawState.(*passkeyCeremonyState)
+		if !found || !ok || state.UserID != admin.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "passkey session expired"})
+			return
+		}
+
+		waAdmin, err := h.loadWebAuthnAdmin(admin)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to load passkeys"})
+			return
+		}
+		wa, err := h.buildWebAuthn(c)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to initialize passkeys"})
+			return
+		}
+
+		credential, err := wa.FinishLogin(waAdmin, state.SessionData, cloneRequestWithBody(c, body))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": err.Error()})
+			return
+		}
+		passkeyCeremonyCache.Delete(key)
+		if err := (&models.AdminPasskeyModel{DB: h.ServerDB}).UpdateCredential(admin.ID, credential); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to update passkey"})
+			return
+		}
+	} else {
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil || req.Password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"ok": false, "error": "Passkey assertion or password is required"})
+			return
+		}
+		if valid, err := models.VerifyPassword(req.Password, admin.PasswordHash); err != nil || !valid {
+			c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Invalid password"})
+			return
+		}
+	}
+
+	token, err := models.GenerateSessionID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to issue re-authentication token"})
+		return
+	}
+	window := reauthWindow()
+	if window == 0 {
+		window = defaultReauthMinutes * time.Minute
+	}
+	reauthTokens.Set(token, admin.ID, window)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ok":           true,
+		"reauth_token": token,
+		"expires_at":   time.Now().Add(window).UTC(),
+	})
+}
@@ -2,11 +2,14 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"path/filepath"
 	"strings"
 
+	"github.com/apimgr/weather/src/database"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -136,6 +139,27 @@ func RespondCreated(c *gin.Context, message string, id string, data ...map[strin
 	c.JSON(http.StatusCreated, response)
 }
 
+// RespondWriteQueued answers 202 Accepted when err is database.ErrWriteQueued:
+// the database is down and the write is applied once it recovers, so the
+// request succeeded. It reports whether it answered; other errors are left
+// to the caller
+func RespondWriteQueued(c *gin.Context, err error) bool {
+	if !errors.Is(err, database.ErrWriteQueued) {
+		return false
+	}
+	const message = "Saved; the change is applied once the database is available again"
+	if shouldRespondText(c) {
+		c.String(http.StatusAccepted, "%s\n", message)
+		return true
+	}
+	c.JSON(http.StatusAccepted, APIResponse{
+		OK:      true,
+		Message: message,
+		Data:    map[string]interface{}{"queued": true},
+	})
+	return true
+}
+
 // RespondData sends a data response per AI.md PART 20 line 17591
 // Returns the item directly without wrapper
 func RespondData(c *gin.Context, data interface{}) {
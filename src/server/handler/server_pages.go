@@ -341,35 +341,15 @@ Time: %s`, form.Name, form.Email, form.Subject, form.Message, c.ClientIP(), c.Re
 // saveContactToDB saves contact form submission to database when SMTP unavailable
 // Per AI.md PART 26: Graceful degradation when SMTP not configured
 func saveContactToDB(c *gin.Context, name, email, subject, message string) error {
-	dbInterface, exists := c.Get("db")
-	if !exists {
+	// contact_submissions lives in the server database (server migration
+	// 0002), alongside submissions from the GraphQL API
+	db := database.GetServerDB()
+	if db == nil {
 		return fmt.Errorf("database not available")
 	}
-	db, ok := dbInterface.(*database.DB)
-	if !ok || db == nil {
-		return fmt.Errorf("database not available")
-	}
-
-	// Create contact_submissions table if not exists
-	_, err := db.DB.Exec(`
-		CREATE TABLE IF NOT EXISTS contact_submissions (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			email TEXT NOT NULL,
-			subject TEXT NOT NULL,
-			message TEXT NOT NULL,
-			ip_address TEXT,
-			user_agent TEXT,
-			status TEXT NOT NULL DEFAULT 'pending',
-			created_at INTEGER NOT NULL DEFAULT (strftime('%s', 'now'))
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create table: %w", err)
-	}
 
 	// Insert contact submission
-	_, err = db.DB.Exec(`
+	_, err := db.Exec(`
 		INSERT INTO contact_submissions (name, email, subject, message, ip_address, user_agent)
 		VALUES (?, ?, ?, ?, ?, ?)
 	`, name, email, subject, message, c.ClientIP(), c.Request.UserAgent())
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
@@ -11,15 +12,17 @@ import (
 	"time"
 
 	"github.com/apimgr/weather/src/config"
-	"github.com/apimgr/weather/src/database"
 	"github.com/apimgr/weather/src/paths"
+	models "github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
 	"github.com/apimgr/weather/src/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type SetupHandler struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Store store.Store
 }
 
 // ShowSetupTokenEntry shows the setup token entry form
@@ -151,6 +154,11 @@ func (h *SetupHandler) ShowAdminSetup(c *gin.Context) {
 	})
 }
 
+// saveSetting stores a server_config value set by the wizard
+func (h *SetupHandler) saveSetting(c *gin.Context, key, value string) error {
+	return h.Store.UpsertSetting(c.Request.Context(), &models.Setting{Key: key, Value: value})
+}
+
 // setupError renders error for form submissions or returns JSON for API
 func (h *SetupHandler) setupError(c *gin.Context, status int, errorMsg string) {
 	// Check Accept header to determine response type
@@ -254,15 +262,14 @@ func (h *SetupHandler) CreateAdmin(c *gin.Context) {
 	}
 
 	// Check if admin username already exists in server_admin_credentials
-	var count int
-	err = database.GetServerDB().QueryRow("SELECT COUNT(*) FROM server_admin_credentials WHERE username = ?", username).Scan(&count)
-	if err != nil {
-		h.setupError(c, http.StatusInternalServerError, "Database error")
+	ctx := c.Request.Context()
+	_, err = h.Store.GetAdminByUsername(ctx, username)
+	if err == nil {
+		h.setupError(c, http.StatusConflict, "Username already exists")
 		return
 	}
-
-	if count > 0 {
-		h.setupError(c, http.StatusConflict, "Username already exists")
+	if !errors.Is(err, store.ErrNotFound) {
+		h.setupError(c, http.StatusInternalServerError, "Database error")
 		return
 	}
 
@@ -274,22 +281,18 @@ func (h *SetupHandler) CreateAdmin(c *gin.Context) {
 	}
 
 	// Create administrator account in server_admin_credentials (NOT user_accounts)
-	result, err := database.GetServerDB().Exec(`
-		INSERT INTO server_admin_credentials (username, email, password_hash, is_super_admin, is_active, created_at, updated_at)
-		VALUES (?, ?, ?, 1, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
-	`, username, email, hashedPassword)
-
-	if err != nil {
+	admin := &models.Admin{
+		Username:     username,
+		Email:        email,
+		PasswordHash: hashedPassword,
+		IsSuperAdmin: true,
+		IsActive:     true,
+	}
+	if err := h.Store.CreateAdmin(ctx, admin); err != nil {
 		h.setupError(c, http.StatusInternalServerError, "Failed to create administrator")
 		return
 	}
-
-	// Get the newly created admin ID
-	adminID, err := result.LastInsertId()
-	if err != nil {
-		h.setupError(c, http.StatusInternalServerError, "Failed to retrieve admin ID")
-		return
-	}
+	adminID := admin.ID
 
 	// Create admin session (auto-login) in server_admin_sessions
 	sessionID, err := generateSessionID()
@@ -300,11 +303,13 @@ func (h *SetupHandler) CreateAdmin(c *gin.Context) {
 	// 7 days
 	expiresAt := time.Now().Add(7 * 24 * time.Hour)
 
-	_, err = database.GetServerDB().Exec(`
-		INSERT INTO server_admin_sessions (id, admin_id, ip_address, user_agent, created_at, expires_at)
-		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, ?)
-	`, sessionID, adminID, c.ClientIP(), c.Request.UserAgent(), expiresAt)
-
+	err = h.Store.CreateAdminSession(ctx, &models.AdminSession{
+		AdminID:   adminID,
+		SessionID: sessionID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		ExpiresAt: expiresAt,
+	})
 	if err != nil {
 		h.setupError(c, http.StatusInternalServerError, "Failed to create session")
 		return
@@ -344,12 +349,7 @@ func (h *SetupHandler) CreateAdmin(c *gin.Context) {
 
 	// Hash and store the API token
 	tokenHash := utils.HashAPIToken(apiToken)
-	_, err = database.GetServerDB().Exec(`
-		UPDATE server_admin_credentials
-		SET api_token_hash = ?, api_token_prefix = 'adm_', updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
-	`, tokenHash, adminID)
-	if err != nil {
+	if err := h.Store.SetAdminAPIToken(ctx, adminID, tokenHash, "adm_"); err != nil {
 		// Log but don't fail - admin was created successfully
 		fmt.Printf("Warning: failed to store admin API token: %v\n", err)
 	}
@@ -514,12 +514,7 @@ func (h *SetupHandler) ProcessServerConfig(c *gin.Context) {
 
 	for key, value := range settings {
 		if value != "" {
-			_, err := database.GetServerDB().Exec(`
-				INSERT INTO server_config (key, value, updated_at)
-				VALUES (?, ?, datetime('now'))
-				ON CONFLICT(key) DO UPDATE SET value = ?, updated_at = datetime('now')
-			`, key, value, value)
-			if err != nil {
+			if err := h.saveSetting(c, key, value); err != nil {
 				fmt.Printf("Warning: failed to save setting %s: %v\n", key, err)
 			}
 		}
@@ -582,11 +577,7 @@ func (h *SetupHandler) ProcessSecurity(c *gin.Context) {
 		// Hash the backup password
 		hashedPassword, err := utils.HashPassword(input.BackupPassword)
 		if err == nil {
-			database.GetServerDB().Exec(`
-				INSERT INTO server_config (key, value, updated_at)
-				VALUES ('backup.encryption_hash', ?, datetime('now'))
-				ON CONFLICT(key) DO UPDATE SET value = ?, updated_at = datetime('now')
-			`, hashedPassword, hashedPassword)
+			h.saveSetting(c, "backup.encryption_hash", hashedPassword)
 		}
 	}
 
@@ -619,7 +610,9 @@ func (h *SetupHandler) ShowServices(c *gin.Context) {
 
 	// Get admin email for SSL contact
 	var adminEmail string
-	database.GetServerDB().QueryRow("SELECT email FROM server_admin_credentials LIMIT 1").Scan(&adminEmail)
+	if admins, err := h.Store.ListAdmins(c.Request.Context()); err == nil && len(admins) > 0 {
+		adminEmail = admins[0].Email
+	}
 
 	c.HTML(http.StatusOK, "page/setup_services.tmpl", gin.H{
 		"Title":        "Optional Services - " + title,
@@ -648,40 +641,20 @@ func (h *SetupHandler) ProcessServices(c *gin.Context) {
 
 	// Save SSL settings
 	if input.EnableSSL {
-		database.GetServerDB().Exec(`
-			INSERT INTO server_config (key, value, updated_at)
-			VALUES ('ssl.enabled', 'true', datetime('now'))
-			ON CONFLICT(key) DO UPDATE SET value = 'true', updated_at = datetime('now')
-		`)
+		h.saveSetting(c, "ssl.enabled", "true")
 		if input.SSLDomain != "" {
-			database.GetServerDB().Exec(`
-				INSERT INTO server_config (key, value, updated_at)
-				VALUES ('ssl.domain', ?, datetime('now'))
-				ON CONFLICT(key) DO UPDATE SET value = ?, updated_at = datetime('now')
-			`, input.SSLDomain, input.SSLDomain)
+			h.saveSetting(c, "ssl.domain", input.SSLDomain)
 		}
 		if input.SSLEmail != "" {
-			database.GetServerDB().Exec(`
-				INSERT INTO server_config (key, value, updated_at)
-				VALUES ('ssl.email', ?, datetime('now'))
-				ON CONFLICT(key) DO UPDATE SET value = ?, updated_at = datetime('now')
-			`, input.SSLEmail, input.SSLEmail)
+			h.saveSetting(c, "ssl.email", input.SSLEmail)
 		}
 	}
 
 	// Save multi-user settings
 	if input.EnableMultiUser {
-		database.GetServerDB().Exec(`
-			INSERT INTO server_config (key, value, updated_at)
-			VALUES ('features.multiuser', 'true', datetime('now'))
-			ON CONFLICT(key) DO UPDATE SET value = 'true', updated_at = datetime('now')
-		`)
+		h.saveSetting(c, "features.multiuser", "true")
 		if input.RegistrationMode != "" {
-			database.GetServerDB().Exec(`
-				INSERT INTO server_config (key, value, updated_at)
-				VALUES ('users.registration_mode', ?, datetime('now'))
-				ON CONFLICT(key) DO UPDATE SET value = ?, updated_at = datetime('now')
-			`, input.RegistrationMode, input.RegistrationMode)
+			h.saveSetting(c, "users.registration_mode", input.RegistrationMode)
 		}
 	}
 
@@ -694,11 +667,12 @@ func (h *SetupHandler) ProcessServices(c *gin.Context) {
 // AI.md: Setup is complete when Primary Admin is created
 func (h *SetupHandler) CompleteSetup(c *gin.Context) {
 	// Mark setup as complete in database
-	_, err := database.GetServerDB().Exec(`
-		INSERT INTO server_config (key, value, type, description, updated_at)
-		VALUES ('setup.completed', 'true', 'bool', 'Server setup completed', datetime('now'))
-		ON CONFLICT(key) DO UPDATE SET value = 'true', updated_at = datetime('now')
-	`)
+	err := h.Store.UpsertSetting(c.Request.Context(), &models.Setting{
+		Key:         "setup.completed",
+		Value:       "true",
+		Type:        "bool",
+		Description: "Server setup completed",
+	})
 	if err != nil {
 		fmt.Printf("Warning: failed to mark setup complete: %v\n", err)
 	}
@@ -727,8 +701,9 @@ func (h *SetupHandler) GetSetupStatus(c *gin.Context) {
 	}
 
 	// Check if a primary admin exists
-	var adminCount int
-	err := database.GetServerDB().QueryRow("SELECT COUNT(*) FROM server_admin_credentials").Scan(&adminCount)
+	ctx := c.Request.Context()
+	admins, err := h.Store.ListAdmins(ctx)
+	adminCount := len(admins)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"status":  "error",
@@ -752,11 +727,10 @@ func (h *SetupHandler) GetSetupStatus(c *gin.Context) {
 	}
 
 	// Check if setup is completed
-	var setupComplete string
-	err = database.GetServerDB().QueryRow("SELECT value FROM server_config WHERE key = 'setup.completed'").Scan(&setupComplete)
+	setupComplete, err := h.Store.GetSetting(ctx, "setup.completed")
 
 	// If setup.completed doesn't exist or is not "true", continue the setup wizard
-	if err != nil || setupComplete != "true" {
+	if err != nil || setupComplete.Value != "true" {
 		c.JSON(http.StatusOK, gin.H{
 			"status":      "admin_created",
 			"step":        1,
@@ -232,12 +232,15 @@ func (h *TwoFactorHandler) ShowSecurityPage(c *gin.Context) {
 		recoveryKeysCount, _ = recoveryKeyModel.GetUnusedKeysCount(int(user.ID))
 	}
 
+	devices, _ := (&models.UserDeviceModel{DB: h.DB}).ListByUser(user.ID)
+
 	NegotiateResponse(c, "page/user/security.tmpl", utils.TemplateData(c, gin.H{
 		"title":             "Security Settings",
 		"user":              user,
 		"recoveryKeysCount": recoveryKeysCount,
 		"passkeys":          passkeys,
 		"hasPasskeys":       len(passkeys) > 0,
+		"devices":           devices,
 	}))
 }
 
@@ -11,6 +11,8 @@ import (
 	"time"
 
 	"github.com/apimgr/weather/src/server/middleware"
+	models "github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/service"
 	"github.com/apimgr/weather/src/utils"
 
 	"github.com/gin-gonic/gin"
@@ -452,6 +454,10 @@ func (h *UserPublicHandler) changeCurrentUserPassword(userID int64, req *ChangeP
 		return fmt.Errorf("current password is incorrect")
 	}
 
+	if err := checkNewPassword(req.NewPassword); err != nil {
+		return err
+	}
+
 	newHash, err := utils.HashPassword(req.NewPassword)
 	if err != nil {
 		return fmt.Errorf("failed to hash new password")
@@ -466,6 +472,7 @@ func (h *UserPublicHandler) changeCurrentUserPassword(userID int64, req *ChangeP
 		return fmt.Errorf("failed to update password")
 	}
 
+	_ = (&models.LoginStateModel{DB: h.DB}).ClearBreachNotified(userID)
 	return nil
 }
 
@@ -489,6 +496,10 @@ func (h *UserPublicHandler) ChangePassword(c *gin.Context) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
 			return
 		}
+		if err == service.ErrPasswordBreached {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -3,14 +3,18 @@
 package handler
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/apimgr/weather/src/server/middleware"
 	models "github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
 	"github.com/apimgr/weather/src/utils"
 
 	"github.com/gin-gonic/gin"
@@ -18,12 +22,13 @@ import (
 
 // UserSettingsHandler handles user settings pages and API
 type UserSettingsHandler struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Store store.Store
 }
 
 // NewUserSettingsHandler creates a new UserSettingsHandler
-func NewUserSettingsHandler(db *sql.DB) *UserSettingsHandler {
-	return &UserSettingsHandler{DB: db}
+func NewUserSettingsHandler(db *sql.DB, st store.Store) *UserSettingsHandler {
+	return &UserSettingsHandler{DB: db, Store: st}
 }
 
 // ShowAccountSettings renders the account settings page
@@ -53,7 +58,7 @@ func (h *UserSettingsHandler) ShowPrivacySettings(c *gin.Context) {
 	}
 
 	// Get user preferences for privacy settings
-	prefs, _ := h.getOrCreatePreferences(user.ID)
+	prefs, _ := h.getOrCreatePreferences(c.Request.Context(), user.ID)
 
 	NegotiateResponse(c, "page/user/settings-privacy.tmpl", utils.TemplateData(c, gin.H{
 		"title":       "Privacy Settings",
@@ -74,7 +79,7 @@ func (h *UserSettingsHandler) ShowNotificationSettings(c *gin.Context) {
 	}
 
 	// Get user preferences
-	prefs, _ := h.getOrCreatePreferences(user.ID)
+	prefs, _ := h.getOrCreatePreferences(c.Request.Context(), user.ID)
 
 	NegotiateResponse(c, "page/user/settings-notifications.tmpl", utils.TemplateData(c, gin.H{
 		"title":       "Notification Settings",
@@ -95,7 +100,7 @@ func (h *UserSettingsHandler) ShowAppearanceSettings(c *gin.Context) {
 	}
 
 	// Get user preferences
-	prefs, _ := h.getOrCreatePreferences(user.ID)
+	prefs, _ := h.getOrCreatePreferences(c.Request.Context(), user.ID)
 
 	NegotiateResponse(c, "page/user/settings-appearance.tmpl", utils.TemplateData(c, gin.H{
 		"title":       "Appearance Settings",
@@ -116,7 +121,15 @@ func (h *UserSettingsHandler) ShowTokensSettings(c *gin.Context) {
 	}
 
 	// Get user's API tokens
-	tokens, _ := h.getUserTokens(user.ID)
+	tokens, _ := h.getUserTokens(c.Request.Context(), user.ID)
+	locations, _ := h.Store.ListUserLocations(c.Request.Context(), user.ID)
+
+	var scopes []models.TokenScopeInfo
+	for _, scope := range models.TokenScopeCatalog {
+		if !scope.AdminOnly {
+			scopes = append(scopes, scope)
+		}
+	}
 
 	NegotiateResponse(c, "page/user/settings-tokens.tmpl", utils.TemplateData(c, gin.H{
 		"title":       "API Tokens",
@@ -124,6 +137,8 @@ func (h *UserSettingsHandler) ShowTokensSettings(c *gin.Context) {
 		"settingsTab": "tokens",
 		"user":        user,
 		"tokens":      tokens,
+		"scopes":      scopes,
+		"locations":   locations,
 	}))
 }
 
@@ -184,7 +199,7 @@ func (h *UserSettingsHandler) GetSettings(c *gin.Context) {
 		return
 	}
 
-	response, err := h.loadSettings(user.ID)
+	response, err := h.loadSettings(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get preferences"})
 		return
@@ -215,7 +230,7 @@ func (h *UserSettingsHandler) UpdateSettings(c *gin.Context) {
 		return
 	}
 
-	if err := h.applySettingsUpdate(user.ID, &req); err != nil {
+	if err := h.applySettingsUpdate(c.Request.Context(), user.ID, &req); err != nil {
 		switch err.Error() {
 		case "bio must be 500 characters or fewer", "theme must be one of: dark, light, auto":
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -228,32 +243,22 @@ func (h *UserSettingsHandler) UpdateSettings(c *gin.Context) {
 }
 
 // LoadUserSettings loads the live user settings payload used by /api/v1/users/settings.
-func LoadUserSettings(db *sql.DB, userID int64) (*UserSettingsResponse, error) {
-	return NewUserSettingsHandler(db).loadSettings(userID)
+func LoadUserSettings(ctx context.Context, st store.Store, userID int64) (*UserSettingsResponse, error) {
+	return (&UserSettingsHandler{Store: st}).loadSettings(ctx, userID)
 }
 
 // ApplyUserSettingsUpdate applies the same section-based settings update used by PATCH /api/v1/users/settings.
-func ApplyUserSettingsUpdate(db *sql.DB, userID int64, req *UpdateSettingsRequest) error {
-	return NewUserSettingsHandler(db).applySettingsUpdate(userID, req)
-}
-
-func (h *UserSettingsHandler) loadSettings(userID int64) (*UserSettingsResponse, error) {
-	user := &models.User{}
-	err := h.DB.QueryRow(`
-		SELECT id, email, username, display_name, bio, location, website, timezone, language,
-		       role, visibility, is_active, email_verified, created_at, updated_at
-		FROM user_accounts
-		WHERE id = ?
-	`, userID).Scan(
-		&user.ID, &user.Email, &user.Username, &user.DisplayName, &user.Bio, &user.Location,
-		&user.Website, &user.Timezone, &user.Language, &user.Role, &user.Visibility,
-		&user.IsActive, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
-	)
+func ApplyUserSettingsUpdate(ctx context.Context, st store.Store, userID int64, req *UpdateSettingsRequest) error {
+	return (&UserSettingsHandler{Store: st}).applySettingsUpdate(ctx, userID, req)
+}
+
+func (h *UserSettingsHandler) loadSettings(ctx context.Context, userID int64) (*UserSettingsResponse, error) {
+	user, err := h.Store.GetUserByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	prefs, err := h.getOrCreatePreferences(userID)
+	prefs, err := h.getOrCreatePreferences(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -298,24 +303,24 @@ func (h *UserSettingsHandler) loadSettings(userID int64) (*UserSettingsResponse,
 	}, nil
 }
 
-func (h *UserSettingsHandler) applySettingsUpdate(userID int64, req *UpdateSettingsRequest) error {
+func (h *UserSettingsHandler) applySettingsUpdate(ctx context.Context, userID int64, req *UpdateSettingsRequest) error {
 	if req.Account != nil {
-		if err := h.updateAccountSettings(userID, req.Account); err != nil {
+		if err := h.updateAccountSettings(ctx, userID, req.Account); err != nil {
 			return err
 		}
 	}
 	if req.Privacy != nil {
-		if err := h.updatePrivacySettings(userID, req.Privacy); err != nil {
+		if err := h.updatePrivacySettings(ctx, userID, req.Privacy); err != nil {
 			return err
 		}
 	}
 	if req.Notifications != nil {
-		if err := h.updateNotificationSettings(userID, req.Notifications); err != nil {
+		if err := h.updateNotificationSettings(ctx, userID, req.Notifications); err != nil {
 			return err
 		}
 	}
 	if req.Appearance != nil {
-		if err := h.updateAppearanceSettings(userID, req.Appearance); err != nil {
+		if err := h.updateAppearanceSettings(ctx, userID, req.Appearance); err != nil {
 			return err
 		}
 	}
@@ -339,21 +344,9 @@ type ExtendedPreferences struct {
 }
 
 // getOrCreatePreferences gets or creates user preferences
-func (h *UserSettingsHandler) getOrCreatePreferences(userID int64) (*models.UserPreferences, error) {
-	prefs := &models.UserPreferences{}
-
-	err := h.DB.QueryRow(`
-		SELECT id, user_id, theme, language, timezone, temperature_unit, pressure_unit,
-		       wind_speed_unit, precipitation_unit, notifications_enabled, email_notifications,
-		       created_at, updated_at
-		FROM user_preferences WHERE user_id = ?
-	`, userID).Scan(
-		&prefs.ID, &prefs.UserID, &prefs.Theme, &prefs.Language, &prefs.Timezone,
-		&prefs.TemperatureUnit, &prefs.PressureUnit, &prefs.WindSpeedUnit, &prefs.PrecipitationUnit,
-		&prefs.NotificationsEnabled, &prefs.EmailNotifications, &prefs.CreatedAt, &prefs.UpdatedAt,
-	)
-
-	if err == sql.ErrNoRows {
+func (h *UserSettingsHandler) getOrCreatePreferences(ctx context.Context, userID int64) (*models.UserPreferences, error) {
+	prefs, err := h.Store.GetUserPreferences(ctx, userID)
+	if errors.Is(err, store.ErrNotFound) {
 		// Create default preferences
 		prefs = &models.UserPreferences{
 			UserID:               userID,
@@ -366,23 +359,10 @@ func (h *UserSettingsHandler) getOrCreatePreferences(userID int64) (*models.User
 			PrecipitationUnit:    "mm",
 			NotificationsEnabled: true,
 			EmailNotifications:   true,
-			CreatedAt:            time.Now(),
-			UpdatedAt:            time.Now(),
-		}
-
-		_, err = h.DB.Exec(`
-			INSERT INTO user_preferences (user_id, theme, language, timezone, temperature_unit,
-			                              pressure_unit, wind_speed_unit, precipitation_unit,
-			                              notifications_enabled, email_notifications, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		`, prefs.UserID, prefs.Theme, prefs.Language, prefs.Timezone, prefs.TemperatureUnit,
-			prefs.PressureUnit, prefs.WindSpeedUnit, prefs.PrecipitationUnit,
-			prefs.NotificationsEnabled, prefs.EmailNotifications, prefs.CreatedAt, prefs.UpdatedAt)
-
-		if err != nil {
-			return nil, err
 		}
-	} else if err != nil {
+		err = h.Store.SaveUserPreferences(ctx, prefs)
+	}
+	if err != nil {
 		return nil, err
 	}
 
@@ -410,7 +390,7 @@ func (h *UserSettingsHandler) getExtendedPreferences(userID int64) (*ExtendedPre
 }
 
 // updateAccountSettings updates account settings in users table
-func (h *UserSettingsHandler) updateAccountSettings(userID int64, settings *AccountSettings) error {
+func (h *UserSettingsHandler) updateAccountSettings(ctx context.Context, userID int64, settings *AccountSettings) error {
 	// Validate bio length (max 500 chars per AI.md PART 34)
 	if len(settings.Bio) > 500 {
 		return fmt.Errorf("bio must be 500 characters or fewer")
@@ -421,113 +401,139 @@ func (h *UserSettingsHandler) updateAccountSettings(userID int64, settings *Acco
 		settings.Website = "https://" + settings.Website
 	}
 
-	_, err := h.DB.Exec(`
-		UPDATE user_accounts
-		SET display_name = ?, bio = ?, location = ?, website = ?, timezone = ?, language = ?, updated_at = ?
-		WHERE id = ?
-	`, settings.DisplayName, settings.Bio, settings.Location, settings.Website,
-		settings.Timezone, settings.Language, time.Now(), userID)
+	user, err := h.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	user.DisplayName = settings.DisplayName
+	user.Bio = settings.Bio
+	user.Location = settings.Location
+	user.Website = settings.Website
+	user.Timezone = settings.Timezone
+	user.Language = settings.Language
 
-	return err
+	return h.Store.UpdateUser(ctx, user)
 }
 
 // updatePrivacySettings updates privacy settings
-func (h *UserSettingsHandler) updatePrivacySettings(userID int64, settings *PrivacySettings) error {
+func (h *UserSettingsHandler) updatePrivacySettings(ctx context.Context, userID int64, settings *PrivacySettings) error {
 	// Update visibility in users table
-	_, err := h.DB.Exec(`
-		UPDATE user_accounts
-		SET visibility = ?, updated_at = ?
-		WHERE id = ?
-	`, settings.Visibility, time.Now(), userID)
+	user, err := h.Store.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	user.Visibility = settings.Visibility
 
 	// Note: Other privacy settings (show_email, show_activity, etc.) would be stored
 	// in user_preferences table with extended columns
-	return err
+	return h.Store.UpdateUser(ctx, user)
 }
 
 // updateNotificationSettings updates notification settings
-func (h *UserSettingsHandler) updateNotificationSettings(userID int64, settings *NotificationSettings) error {
+func (h *UserSettingsHandler) updateNotificationSettings(ctx context.Context, userID int64, settings *NotificationSettings) error {
 	// email_security is always true and cannot be changed per AI.md PART 34
-	_, err := h.DB.Exec(`
-		UPDATE user_preferences
-		SET notifications_enabled = ?, email_notifications = ?, updated_at = ?
-		WHERE user_id = ?
-	`, settings.PushEnabled, settings.EmailMentions, time.Now(), userID)
+	prefs, err := h.getOrCreatePreferences(ctx, userID)
+	if err != nil {
+		return err
+	}
+	prefs.NotificationsEnabled = settings.PushEnabled
+	prefs.EmailNotifications = settings.EmailMentions
 
-	return err
+	return h.Store.SaveUserPreferences(ctx, prefs)
 }
 
 // updateAppearanceSettings updates appearance settings
-func (h *UserSettingsHandler) updateAppearanceSettings(userID int64, settings *AppearanceSettings) error {
+func (h *UserSettingsHandler) updateAppearanceSettings(ctx context.Context, userID int64, settings *AppearanceSettings) error {
 	// Validate theme
 	validThemes := map[string]bool{"dark": true, "light": true, "auto": true}
 	if !validThemes[settings.Theme] {
 		return fmt.Errorf("theme must be one of: dark, light, auto")
 	}
 
-	_, err := h.DB.Exec(`
-		UPDATE user_preferences
-		SET theme = ?, updated_at = ?
-		WHERE user_id = ?
-	`, settings.Theme, time.Now(), userID)
+	prefs, err := h.getOrCreatePreferences(ctx, userID)
+	if err != nil {
+		return err
+	}
+	prefs.Theme = settings.Theme
 
-	return err
+	return h.Store.SaveUserPreferences(ctx, prefs)
 }
 
 // UserToken represents a user API token for display
 type UserToken struct {
-	ID          int64      `json:"id"`
-	Name        string     `json:"name"`
-	TokenPrefix string     `json:"token_prefix"`
-	Scopes      string     `json:"scopes"`
-	CreatedAt   time.Time  `json:"created_at"`
-	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
-	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
-}
-
-// getUserTokens gets all API tokens for a user
-func (h *UserSettingsHandler) getUserTokens(userID int64) ([]UserToken, error) {
-	rows, err := h.DB.Query(`
-		SELECT id, name, token_prefix, scopes, created_at, expires_at, last_used_at
-		FROM user_tokens WHERE user_id = ?
-		ORDER BY created_at DESC
-	`, userID)
+	ID           int64                     `json:"id"`
+	Name         string                    `json:"name"`
+	TokenPrefix  string                    `json:"token_prefix"`
+	Scopes       string                    `json:"scopes"`
+	CreatedAt    time.Time                 `json:"created_at"`
+	ExpiresAt    *time.Time                `json:"expires_at,omitempty"`
+	LastUsedAt   *time.Time                `json:"last_used_at,omitempty"`
+	AllowedIPs   []string                  `json:"allowed_ips,omitempty"`
+	LocationID   *int64                    `json:"location_id,omitempty"`
+	LocationName string                    `json:"location_name,omitempty"`
+	RateLimit    int                       `json:"rate_limit"`
+	DailyQuota   int                       `json:"daily_quota"`
+	Usage        *models.TokenUsageSummary `json:"usage,omitempty"`
+}
+
+// tokenUsagePeriod is the window shown in token usage analytics
+const tokenUsagePeriod = 7 * 24 * time.Hour
+
+// getUserTokens gets all API tokens for a user with their usage over the
+// last week
+func (h *UserSettingsHandler) getUserTokens(ctx context.Context, userID int64) ([]UserToken, error) {
+	tokens, err := h.Store.ListTokens(ctx, models.OwnerTypeUser, userID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var tokens []UserToken
-	for rows.Next() {
-		var t UserToken
-		var name, scopes sql.NullString
-		var expiresAt, lastUsedAt sql.NullTime
 
-		err := rows.Scan(&t.ID, &name, &t.TokenPrefix, &scopes, &t.CreatedAt, &expiresAt, &lastUsedAt)
-		if err != nil {
-			continue
+	locations := make(map[int64]string)
+	if saved, err := h.Store.ListUserLocations(ctx, userID); err == nil {
+		for _, location := range saved {
+			locations[int64(location.ID)] = location.Name
 		}
+	}
 
-		t.Name = name.String
-		t.Scopes = scopes.String
-		if expiresAt.Valid {
-			t.ExpiresAt = &expiresAt.Time
+	usage := &models.TokenUsageModel{DB: h.DB}
+	since := time.Now().Add(-tokenUsagePeriod)
+	result := make([]UserToken, 0, len(tokens))
+	for _, token := range tokens {
+		t := UserToken{
+			ID:          token.ID,
+			Name:        token.Name,
+			TokenPrefix: token.TokenPrefix,
+			Scopes:      token.Scope,
+			CreatedAt:   token.CreatedAt,
+			ExpiresAt:   token.ExpiresAt,
+			LastUsedAt:  token.LastUsedAt,
+			AllowedIPs:  token.AllowedIPs,
+			LocationID:  token.LocationID,
+			RateLimit:   token.RateLimit,
+			DailyQuota:  token.DailyQuota,
 		}
-		if lastUsedAt.Valid {
-			t.LastUsedAt = &lastUsedAt.Time
+		if token.LocationID != nil {
+			t.LocationName = locations[*token.LocationID]
 		}
-
-		tokens = append(tokens, t)
+		if summary, err := usage.Summary(models.OwnerTypeUser, token.ID, since); err == nil {
+			t.Usage = summary
+		}
+		result = append(result, t)
 	}
 
-	return tokens, nil
+	return result, nil
 }
 
 // CreateTokenRequest represents a request to create a new API token
 type CreateTokenRequest struct {
-	Name      string `json:"name" binding:"required"`
+	Name string `json:"name" binding:"required"`
+	// Comma separated; empty grants full access
 	Scopes    string `json:"scopes"`
 	ExpiresIn int    `json:"expires_in"` // days, 0 = never
+	// Comma separated IP addresses or CIDR ranges
+	AllowedIPs string `json:"allowed_ips"`
+	LocationID *int64 `json:"location_id"`
+	RateLimit  int    `json:"rate_limit"`  // requests per minute, 0 = unlimited
+	DailyQuota int    `json:"daily_quota"` // requests per day, 0 = unlimited
 }
 
 // CreateToken creates a new API token for the user
@@ -545,44 +551,68 @@ func (h *UserSettingsHandler) CreateToken(c *gin.Context) {
 		return
 	}
 
+	ctx := c.Request.Context()
+
 	// Check token limit (max 5 per user per AI.md)
-	var count int
-	h.DB.QueryRow("SELECT COUNT(*) FROM user_tokens WHERE user_id = ?", user.ID).Scan(&count)
-	if count >= 5 {
+	existing, _ := h.Store.ListTokens(ctx, models.OwnerTypeUser, user.ID)
+	if len(existing) >= 5 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Maximum 5 tokens per user"})
 		return
 	}
 
-	// Generate token with usr_ prefix per AI.md PART 11
-	token, err := models.GenerateTokenWithPrefix(models.PrefixUser)
+	restrictions := models.TokenRestrictions{
+		RequestsPerMinute: req.RateLimit,
+		DailyQuota:        req.DailyQuota,
+	}
+	allowedIPs, err := models.ParseAllowedIPs(req.AllowedIPs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	restrictions.AllowedIPs = allowedIPs
+	if req.LocationID != nil && *req.LocationID > 0 {
+		location, err := h.Store.GetLocation(ctx, *req.LocationID)
+		if err != nil || int64(location.UserID) != user.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Location not found"})
+			return
+		}
+		restrictions.LocationID = req.LocationID
+	}
+
+	scopes := strings.TrimSpace(req.Scopes)
+	if scopes == "" {
+		scopes = models.ScopeGlobal
+	}
+	parsed, err := models.ParseScopes(scopes)
+	if err == nil {
+		err = models.ValidateScopesForOwner(parsed, models.OwnerTypeUser)
+	}
+	if err == nil {
+		err = restrictions.Validate()
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	tokenHash := models.HashToken(token)
-	tokenPrefix := models.GetTokenPrefix(token) + "..."
 
-	var expiresAt sql.NullTime
+	var expiration time.Duration
 	if req.ExpiresIn > 0 {
-		expiresAt = sql.NullTime{
-			Time:  time.Now().AddDate(0, 0, req.ExpiresIn),
-			Valid: true,
-		}
+		expiration = time.Duration(req.ExpiresIn) * 24 * time.Hour
 	}
 
-	_, dbErr := h.DB.Exec(`
-		INSERT INTO user_tokens (user_id, token_hash, token_prefix, name, scopes, created_at, expires_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, user.ID, tokenHash, tokenPrefix, req.Name, req.Scopes, time.Now(), expiresAt)
-
-	if dbErr != nil {
+	token, err := models.NewToken(models.OwnerTypeUser, user.ID, req.Name, scopes, expiration, restrictions)
+	if err == nil {
+		err = h.Store.CreateToken(ctx, token)
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
 		return
 	}
 
 	// Return the full token (only shown once)
 	c.JSON(http.StatusOK, gin.H{
-		"token":   token,
+		"token":   token.Token,
+		"scopes":  token.Scope,
 		"message": "Token created. This token will only be shown once.",
 	})
 }
@@ -596,22 +626,21 @@ func (h *UserSettingsHandler) RevokeToken(c *gin.Context) {
 		return
 	}
 
-	tokenID := c.Param("id")
-
-	result, err := h.DB.Exec(`
-		DELETE FROM user_tokens WHERE id = ? AND user_id = ?
-	`, tokenID, user.ID)
-
+	tokenID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
 		return
 	}
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
+	err = h.Store.DeleteToken(c.Request.Context(), models.OwnerTypeUser, user.ID, tokenID)
+	if errors.Is(err, store.ErrNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
 }
@@ -625,7 +654,7 @@ func (h *UserSettingsHandler) ListTokens(c *gin.Context) {
 		return
 	}
 
-	tokens, err := h.getUserTokens(user.ID)
+	tokens, err := h.getUserTokens(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tokens"})
 		return
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apimgr/weather/src/server/middleware"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUserTokenCreateAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	alice := &models.User{Username: "alice", Email: "alice@example.com"}
+	bob := &models.User{Username: "bob", Email: "bob@example.com"}
+	for _, user := range []*models.User{alice, bob} {
+		if err := st.CreateUser(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &UserSettingsHandler{Store: st}
+	serve := func(user *models.User, method, path, body string) *httptest.ResponseRecorder {
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(middleware.UserContextKey, user)
+		})
+		r.POST("/tokens", h.CreateToken)
+		r.DELETE("/tokens/:id", h.RevokeToken)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	for i := 0; i < 5; i++ {
+		if w := serve(alice, http.MethodPost, "/tokens", `{"name": "cli"}`); w.Code != http.StatusOK {
+			t.Fatalf("create %d: %d %s", i, w.Code, w.Body)
+		}
+	}
+	if w := serve(alice, http.MethodPost, "/tokens", `{"name": "cli"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("create over the limit: %d %s", w.Code, w.Body)
+	}
+
+	tokens, _ := st.ListTokens(ctx, models.OwnerTypeUser, alice.ID)
+	if len(tokens) != 5 || tokens[0].TokenHash == "" || tokens[0].Token != "" {
+		t.Fatalf("stored tokens = %+v", tokens)
+	}
+	path := "/tokens/" + strconv.FormatInt(tokens[0].ID, 10)
+
+	if w := serve(bob, http.MethodDelete, path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("revoke by another user: %d %s", w.Code, w.Body)
+	}
+	if w := serve(alice, http.MethodDelete, path, ""); w.Code != http.StatusOK {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body)
+	}
+	if tokens, _ := st.ListTokens(ctx, models.OwnerTypeUser, alice.ID); len(tokens) != 4 {
+		t.Errorf("tokens after revoke = %d, want 4", len(tokens))
+	}
+}
+
+func TestUserSettingsUpdate(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	alice := &models.User{Username: "alice", Email: "alice@example.com"}
+	if err := st.CreateUser(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ApplyUserSettingsUpdate(ctx, st, alice.ID, &UpdateSettingsRequest{
+		Account:       &AccountSettings{DisplayName: "Alice", Website: "example.com", Language: "de"},
+		Privacy:       &PrivacySettings{Visibility: "private"},
+		Notifications: &NotificationSettings{PushEnabled: false, EmailMentions: true},
+		Appearance:    &AppearanceSettings{Theme: "light"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyUserSettingsUpdate(ctx, st, alice.ID, &UpdateSettingsRequest{Appearance: &AppearanceSettings{Theme: "neon"}}); err == nil {
+		t.Error("Expected an unknown theme to be rejected")
+	}
+
+	settings, err := LoadUserSettings(ctx, st, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Account.DisplayName != "Alice" || settings.Account.Website != "https://example.com" || settings.Account.Language != "de" {
+		t.Errorf("account = %+v", settings.Account)
+	}
+	if settings.Privacy.Visibility != "private" {
+		t.Errorf("visibility = %q, want private", settings.Privacy.Visibility)
+	}
+	if settings.Notifications.PushEnabled || !settings.Notifications.EmailMentions {
+		t.Errorf("notifications = %+v", settings.Notifications)
+	}
+	if settings.Appearance.Theme != "light" {
+		t.Errorf("theme = %q, want light", settings.Appearance.Theme)
+	}
+	// Other account fields are kept
+	if user, _ := st.GetUserByID(ctx, alice.ID); user.Email != "alice@example.com" || user.Username != "alice" {
+		t.Errorf("user after update = %+v", user)
+	}
+}
@@ -39,7 +39,9 @@ func RequireAdminAuth() gin.HandlerFunc {
 				"branding": gin.H{
 					"Title": title,
 				},
-				"version": version,
+				"version":        version,
+				"oidc_providers": cfg.OIDCLoginProviders(true),
+				"ldap_enabled":   cfg.Server.Auth.LDAP.Enabled,
 			})
 			c.Abort()
 			return
@@ -75,7 +77,9 @@ func RequireAdminAuth() gin.HandlerFunc {
 				"branding": gin.H{
 					"Title": title,
 				},
-				"version": version,
+				"version":        version,
+				"oidc_providers": cfg.OIDCLoginProviders(true),
+				"ldap_enabled":   cfg.Server.Auth.LDAP.Enabled,
 			})
 			c.Abort()
 			return
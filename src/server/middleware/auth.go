@@ -22,7 +22,7 @@ func AuthMiddleware(db *sql.DB, required bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		sessionModel := &models.SessionModel{DB: db}
 		userModel := &models.UserModel{DB: db}
-		tokenModel := &models.TokenModel{DB: db}
+		tokenModel := &models.TokenModelV2{DB: db}
 
 		var user *models.User
 		var session *models.Session
@@ -32,18 +32,21 @@ func AuthMiddleware(db *sql.DB, required bool) gin.HandlerFunc {
 		if authHeader != "" {
 			// Extract token from "Bearer <token>" format
 			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) == 2 && parts[0] == "Bearer" {
+			if len(parts) == 2 && parts[0] == "Bearer" && DetectTokenType(parts[1]) == TokenTypeUser {
 				token := parts[1]
-				apiToken, err := tokenModel.GetByToken(token)
+				apiToken, err := tokenModel.ValidateToken(token)
 				if err == nil {
 					// Valid API token found
-					user, err = userModel.GetByID(int64(apiToken.UserID))
+					user, err = userModel.GetByID(apiToken.OwnerID)
 					if err == nil {
-						// Update last used timestamp asynchronously
-						go tokenModel.UpdateLastUsed(apiToken.ID)
+						if !authorizeAPIToken(c, apiToken) {
+							return
+						}
 						c.Set(UserContextKey, user)
 						c.Set("auth_method", "api_token")
+						c.Set(APITokenContextKey, apiToken)
 						c.Next()
+						recordAPITokenUse(db, apiToken, c)
 						return
 					}
 				}
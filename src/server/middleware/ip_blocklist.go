@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/apimgr/weather/src/server/service"
+	"github.com/gin-gonic/gin"
+)
+
+// Blocked requests from the same address and list are audit-logged at most
+// once per interval, so a scanner cannot flood the audit log
+const blocklistAuditInterval = 10 * time.Minute
+
+// IPBlocklist rejects requests whose client address is on a blocklist. The
+// address comes from c.ClientIP(), so forwarded headers are only honoured
+// from the router's trusted proxies.
+func IPBlocklist(blocklist *service.IPBlocklistService, audit *service.AuditLogger) gin.HandlerFunc {
+	var mu sync.Mutex
+	lastAudit := make(map[string]time.Time)
+
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		match, blocked := blocklist.Check(ip)
+		if !blocked {
+			c.Next()
+			return
+		}
+
+		if audit != nil {
+			now := time.Now()
+			key := ip + "|" + match.List
+
+			mu.Lock()
+			due := now.Sub(lastAudit[key]) >= blocklistAuditInterval
+			if due {
+				if len(lastAudit) > 10000 {
+					for k, t := range lastAudit {
+						if now.Sub(t) >= blocklistAuditInterval {
+							delete(lastAudit, k)
+						}
+					}
+				}
+				lastAudit[key] = now
+			}
+			mu.Unlock()
+
+			if due {
+				err := audit.Log(service.AuditEvent{
+					RequestID: GetRequestID(c),
+					Event:     string(service.EventSecurityIPBlocked),
+					Category:  "security",
+					Severity:  "warn",
+					Actor: service.Actor{
+						Type:      "anonymous",
+						IP:        ip,
+						UserAgent: c.Request.UserAgent(),
+					},
+					Details: map[string]interface{}{
+						"list":   match.List,
+						"entry":  match.Entry,
+						"method": c.Request.Method,
+						"path":   c.Request.URL.Path,
+					},
+					Result: "failure",
+					Reason: "blocklist " + match.List,
+				})
+				if err != nil {
+					log.Printf("IP blocklist: audit log failed: %v", err)
+				}
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"ok":    false,
+			"error": "Access denied",
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/gin-gonic/gin"
+)
+
+// OrgAuth authenticates the organization API. Organization tokens (org_)
+// are accepted alongside the session and user token authentication of
+// RequireAuth; handlers check the token belongs to the requested
+// organization.
+func OrgAuth(db *sql.DB) gin.HandlerFunc {
+	userAuth := RequireAuth(db)
+	return func(c *gin.Context) {
+		parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+		if len(parts) != 2 || parts[0] != "Bearer" || DetectTokenType(parts[1]) != TokenTypeOrg {
+			userAuth(c)
+			return
+		}
+
+		token, err := (&models.TokenModelV2{DB: db}).ValidateToken(parts[1])
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "invalid organization token"})
+			c.Abort()
+			return
+		}
+		if !authorizeAPIToken(c, token) {
+			return
+		}
+
+		c.Set(APITokenContextKey, token)
+		c.Set("auth_method", "org_token")
+		c.Next()
+		recordAPITokenUse(db, token, c)
+	}
+}
+
+// GetOrgToken returns the organization token the request authenticated
+// with, if any
+func GetOrgToken(c *gin.Context) (*models.Token, bool) {
+	token, ok := GetAPIToken(c)
+	if !ok || token.OwnerType != models.OwnerTypeOrg {
+		return nil, false
+	}
+	return token, true
+}
@@ -1,14 +1,24 @@
 package middleware
 
 import (
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/go-chi/httprate"
+
+	"github.com/apimgr/weather/src/config"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/service"
 )
 
-// Rate limit constants per AI.md PART 1: Security-First Design
+// Built-in rate limits per AI.md PART 1: Security-First Design. Server
+// settings and server.yml rate_limit override them.
 const (
 	// Login attempts: 5 per 15 minutes
 	LoginRequestsPerWindow = 5
@@ -43,188 +53,399 @@ const (
 	GlobalBurst = 200
 )
 
+// Rate limited endpoint classes (rate_limit.endpoints)
+const (
+	RateLimitLogin         = "login"
+	RateLimitPasswordReset = "password_reset"
+	RateLimitRegistration  = "registration"
+	RateLimitUpload        = "upload"
+	RateLimitAdmin         = "admin"
+)
+
+// API caller tiers (rate_limit.tiers). A user role is also a tier name.
+const (
+	RateLimitTierAnonymous = "anonymous"
+	RateLimitTierUser      = "user"
+	RateLimitTierToken     = "token"
+)
+
+// How often limits are re-read from server settings, which other cluster
+// nodes may have changed
+const rateLimitPolicyRefresh = 30 * time.Second
+
+// rateLimitRule allows requests per sliding window
+type rateLimitRule struct {
+	requests int
+	window   time.Duration
+}
+
+// rateLimitPolicy is the effective rate limit configuration
+type rateLimitPolicy struct {
+	enabled   bool
+	global    rateLimitRule
+	endpoints map[string]rateLimitRule
+	tiers     map[string]rateLimitRule
+	// Request cost by route, relative to the API path
+	costs   map[string]int
+	apiPath string
+}
+
 var (
-	// Rate limiters initialized in init()
-	globalLimiter        *httprate.RateLimiter
-	loginLimiter         *httprate.RateLimiter
-	passwordResetLimiter *httprate.RateLimiter
-	apiAuthLimiter       *httprate.RateLimiter
-	apiUnauthLimiter     *httprate.RateLimiter
-	registrationLimiter  *httprate.RateLimiter
-	fileUploadLimiter    *httprate.RateLimiter
-	adminLimiter         *httprate.RateLimiter
+	rateLimitPolicyValue atomic.Pointer[rateLimitPolicy]
+
+	rateLimitMu       sync.RWMutex
+	rateLimitStore    service.RateLimitStore = service.NewMemoryRateLimitStore()
+	rateLimitSettings *models.SettingsModel
+	rateLimitRefresh  sync.Once
+
+	// Per-node counters for the global limiter, and for requests the shared
+	// store cannot count
+	localRateLimitStore = service.NewMemoryRateLimitStore()
+
+	rateLimitErrorMu   sync.Mutex
+	rateLimitErrorLast time.Time
 )
 
-func init() {
-	// Initialize all rate limiters per AI.md PART 1 specifications
-	globalLimiter = httprate.NewRateLimiter(
-		GlobalRPS,
-		time.Second,
-		httprate.WithKeyFuncs(httprate.KeyByIP),
-	)
-
-	loginLimiter = httprate.NewRateLimiter(
-		LoginRequestsPerWindow,
-		LoginWindowDuration,
-		httprate.WithKeyFuncs(httprate.KeyByIP),
-	)
-
-	passwordResetLimiter = httprate.NewRateLimiter(
-		PasswordResetRequestsPerWindow,
-		PasswordResetWindowDuration,
-		httprate.WithKeyFuncs(httprate.KeyByIP),
-	)
-
-	apiAuthLimiter = httprate.NewRateLimiter(
-		APIAuthRequestsPerWindow,
-		APIAuthWindowDuration,
-		httprate.WithKeyFuncs(httprate.KeyByIP),
-	)
-
-	apiUnauthLimiter = httprate.NewRateLimiter(
-		APIUnauthRequestsPerWindow,
-		APIUnauthWindowDuration,
-		httprate.WithKeyFuncs(httprate.KeyByIP),
-	)
-
-	registrationLimiter = httprate.NewRateLimiter(
-		RegistrationRequestsPerWindow,
-		RegistrationWindowDuration,
-		httprate.WithKeyFuncs(httprate.KeyByIP),
-	)
-
-	fileUploadLimiter = httprate.NewRateLimiter(
-		FileUploadRequestsPerWindow,
-		FileUploadWindowDuration,
-		httprate.WithKeyFuncs(httprate.KeyByIP),
-	)
-
-	adminLimiter = httprate.NewRateLimiter(
-		AdminRequestsPerWindow,
-		AdminWindowDuration,
-		httprate.WithKeyFuncs(httprate.KeyByIP),
-	)
-}
-
-// GlobalRateLimitMiddleware applies global rate limiting (100 req/s)
+// ConfigureRateLimiting sets the store shared by all limiters and the
+// settings limits are read from, and keeps re-reading them
+func ConfigureRateLimiting(store service.RateLimitStore, settings *models.SettingsModel) {
+	rateLimitMu.Lock()
+	if store != nil {
+		rateLimitStore = store
+	}
+	rateLimitSettings = settings
+	rateLimitMu.Unlock()
+
+	ReloadRateLimitPolicy()
+	rateLimitRefresh.Do(func() {
+		go func() {
+			ticker := time.NewTicker(rateLimitPolicyRefresh)
+			defer ticker.Stop()
+			for range ticker.C {
+				ReloadRateLimitPolicy()
+			}
+		}()
+	})
+}
+
+// ReloadRateLimitPolicy rebuilds the limits from the global config and
+// server settings. Call after either changes.
+func ReloadRateLimitPolicy() {
+	rateLimitMu.RLock()
+	settings := rateLimitSettings
+	rateLimitMu.RUnlock()
+
+	rateLimitPolicyValue.Store(buildRateLimitPolicy(config.GetGlobalConfig(), settings))
+}
+
+func currentRateLimitPolicy() *rateLimitPolicy {
+	if policy := rateLimitPolicyValue.Load(); policy != nil {
+		return policy
+	}
+	policy := buildRateLimitPolicy(config.GetGlobalConfig(), nil)
+	rateLimitPolicyValue.CompareAndSwap(nil, policy)
+	return rateLimitPolicyValue.Load()
+}
+
+func currentRateLimitStore() service.RateLimitStore {
+	rateLimitMu.RLock()
+	defer rateLimitMu.RUnlock()
+	return rateLimitStore
+}
+
+// buildRateLimitPolicy layers the limits: built-in defaults, the rate_limit
+// settings edited in the admin panel, then the tiers, endpoints and costs
+// maps from server.yml and finally from the rate_limit.tiers,
+// rate_limit.endpoints and rate_limit.costs JSON settings
+func buildRateLimitPolicy(cfg *config.AppConfig, settings *models.SettingsModel) *rateLimitPolicy {
+	policy := &rateLimitPolicy{
+		enabled: true,
+		global:  rateLimitRule{GlobalRPS, time.Second},
+		endpoints: map[string]rateLimitRule{
+			RateLimitLogin:         {LoginRequestsPerWindow, LoginWindowDuration},
+			RateLimitPasswordReset: {PasswordResetRequestsPerWindow, PasswordResetWindowDuration},
+			RateLimitRegistration:  {RegistrationRequestsPerWindow, RegistrationWindowDuration},
+			RateLimitUpload:        {FileUploadRequestsPerWindow, FileUploadWindowDuration},
+			RateLimitAdmin:         {AdminRequestsPerWindow, AdminWindowDuration},
+		},
+		tiers: map[string]rateLimitRule{
+			RateLimitTierAnonymous: {APIUnauthRequestsPerWindow, APIUnauthWindowDuration},
+			RateLimitTierUser:      {APIAuthRequestsPerWindow, APIAuthWindowDuration},
+		},
+		costs: make(map[string]int),
+	}
+
+	var rl *config.RateLimitConfig
+	if cfg != nil {
+		rl = &cfg.Server.RateLimit
+		policy.enabled = rl.Enabled
+		policy.apiPath = cfg.GetAPIPath()
+		if rl.Requests > 0 && rl.Window > 0 {
+			policy.tiers[RateLimitTierUser] = rateLimitRule{rl.Requests, time.Duration(rl.Window) * time.Second}
+		}
+	}
+
+	if settings != nil {
+		policy.enabled = policy.enabled && settings.GetBool("rate_limit.enabled", true)
+		if n := settings.GetInt("rate_limit.global", 0); n > 0 {
+			policy.global.requests = n
+		}
+		perMinute := func(rules map[string]rateLimitRule, name, key string) {
+			if n := settings.GetInt(key, 0); n > 0 {
+				rules[name] = rateLimitRule{n, time.Minute}
+			}
+		}
+		perMinute(policy.tiers, RateLimitTierAnonymous, "rate_limit.per_ip")
+		perMinute(policy.tiers, RateLimitTierUser, "rate_limit.api")
+		perMinute(policy.endpoints, RateLimitAdmin, "rate_limit.admin")
+	}
+
+	if rl != nil {
+		mergeRateLimitRules(policy.tiers, rl.Tiers)
+		mergeRateLimitRules(policy.endpoints, rl.Endpoints)
+		mergeRateLimitCosts(policy.costs, rl.Costs)
+	}
+
+	if settings != nil {
+		var rules map[string]config.RateLimitRule
+		if settings.GetJSON("rate_limit.tiers", &rules) == nil {
+			mergeRateLimitRules(policy.tiers, rules)
+		}
+		rules = nil
+		if settings.GetJSON("rate_limit.endpoints", &rules) == nil {
+			mergeRateLimitRules(policy.endpoints, rules)
+		}
+		var costs map[string]int
+		if settings.GetJSON("rate_limit.costs", &costs) == nil {
+			mergeRateLimitCosts(policy.costs, costs)
+		}
+	}
+
+	return policy
+}
+
+// mergeRateLimitRules copies valid rules over dst
+func mergeRateLimitRules(dst map[string]rateLimitRule, src map[string]config.RateLimitRule) {
+	for name, rule := range src {
+		if rule.Requests <= 0 || rule.Window <= 0 {
+			continue
+		}
+		dst[strings.ToLower(name)] = rateLimitRule{rule.Requests, time.Duration(rule.Window) * time.Second}
+	}
+}
+
+// mergeRateLimitCosts copies valid costs over dst
+func mergeRateLimitCosts(dst map[string]int, src map[string]int) {
+	for route, cost := range src {
+		if cost < 1 {
+			continue
+		}
+		dst["/"+strings.Trim(route, "/")] = cost
+	}
+}
+
+// routeCost returns the cost of the matched route; unlisted routes cost 1
+func (p *rateLimitPolicy) routeCost(c *gin.Context) int {
+	route := c.FullPath()
+	if cost, ok := p.costs[route]; ok {
+		return cost
+	}
+	if p.apiPath != "" && strings.HasPrefix(route, p.apiPath) {
+		if cost, ok := p.costs["/"+strings.Trim(strings.TrimPrefix(route, p.apiPath), "/")]; ok {
+			return cost
+		}
+	}
+	return 1
+}
+
+// GlobalRateLimitMiddleware applies the per-IP global limit (100 req/s by
+// default). It is a flood guard for this node, so it never leaves the
+// process.
 func GlobalRateLimitMiddleware() gin.HandlerFunc {
-	return wrapRateLimiter(globalLimiter, GlobalRPS, time.Second)
+	return func(c *gin.Context) {
+		policy := currentRateLimitPolicy()
+		if policy.enabled && !limitRequest(c, localRateLimitStore, "global:"+c.ClientIP(), policy.global, 1) {
+			return
+		}
+		c.Next()
+	}
 }
 
 // LoginRateLimitMiddleware applies login rate limiting (5 req/15min)
 func LoginRateLimitMiddleware() gin.HandlerFunc {
-	return wrapRateLimiter(loginLimiter, LoginRequestsPerWindow, LoginWindowDuration)
+	return endpointRateLimit(RateLimitLogin)
 }
 
 // PasswordResetRateLimitMiddleware applies password reset rate limiting (3 req/1hr)
 func PasswordResetRateLimitMiddleware() gin.HandlerFunc {
-	return wrapRateLimiter(passwordResetLimiter, PasswordResetRequestsPerWindow, PasswordResetWindowDuration)
+	return endpointRateLimit(RateLimitPasswordReset)
 }
 
-// APIAuthRateLimitMiddleware applies authenticated API rate limiting (100 req/1min)
+// APIAuthRateLimitMiddleware applies the user tier to every request
 func APIAuthRateLimitMiddleware() gin.HandlerFunc {
-	return wrapRateLimiter(apiAuthLimiter, APIAuthRequestsPerWindow, APIAuthWindowDuration)
+	return tierRateLimit(RateLimitTierUser)
 }
 
-// APIUnauthRateLimitMiddleware applies unauthenticated API rate limiting (20 req/1min)
+// APIUnauthRateLimitMiddleware applies the anonymous tier to every request
 func APIUnauthRateLimitMiddleware() gin.HandlerFunc {
-	return wrapRateLimiter(apiUnauthLimiter, APIUnauthRequestsPerWindow, APIUnauthWindowDuration)
+	return tierRateLimit(RateLimitTierAnonymous)
 }
 
-// APIRateLimitMiddleware applies API rate limiting based on authentication status
+// APIRateLimitMiddleware applies the caller's tier. Token requests use the
+// token tier when one is configured; otherwise tokens share their owner's
+// limit. Signed-in users get the tier named after their role, or the user
+// tier. Everyone else is limited per IP by the anonymous tier. Each request
+// costs its route's weight.
 func APIRateLimitMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Check if user is authenticated
-		_, exists := c.Get("user_id")
-		if exists {
-			// Authenticated: 100 req/min
-			wrapRateLimiter(apiAuthLimiter, APIAuthRequestsPerWindow, APIAuthWindowDuration)(c)
-		} else {
-			// Unauthenticated: 20 req/min
-			wrapRateLimiter(apiUnauthLimiter, APIUnauthRequestsPerWindow, APIUnauthWindowDuration)(c)
+		policy := currentRateLimitPolicy()
+		if !policy.enabled {
+			c.Next()
+			return
+		}
+		tier, key := apiRateLimitCaller(c, policy)
+		if !limitRequest(c, currentRateLimitStore(), "api:"+key, policy.tiers[tier], policy.routeCost(c)) {
+			return
 		}
+		c.Next()
 	}
 }
 
+// apiRateLimitCaller returns the caller's tier and counter key
+func apiRateLimitCaller(c *gin.Context, policy *rateLimitPolicy) (string, string) {
+	if token, ok := GetAPIToken(c); ok {
+		if _, ok := policy.tiers[RateLimitTierToken]; ok {
+			return RateLimitTierToken, fmt.Sprintf("token:%s:%d", token.OwnerType, token.ID)
+		}
+	}
+	if user, ok := GetCurrentUser(c); ok && user != nil {
+		tier := RateLimitTierUser
+		if _, ok := policy.tiers[strings.ToLower(user.Role)]; ok {
+			tier = strings.ToLower(user.Role)
+		}
+		return tier, "user:" + strconv.FormatInt(user.ID, 10)
+	}
+	return RateLimitTierAnonymous, "ip:" + c.ClientIP()
+}
+
 // RegistrationRateLimitMiddleware applies registration rate limiting (5 req/1hr)
 func RegistrationRateLimitMiddleware() gin.HandlerFunc {
-	return wrapRateLimiter(registrationLimiter, RegistrationRequestsPerWindow, RegistrationWindowDuration)
+	return endpointRateLimit(RateLimitRegistration)
 }
 
 // FileUploadRateLimitMiddleware applies file upload rate limiting (10 req/1hr)
 func FileUploadRateLimitMiddleware() gin.HandlerFunc {
-	return wrapRateLimiter(fileUploadLimiter, FileUploadRequestsPerWindow, FileUploadWindowDuration)
+	return endpointRateLimit(RateLimitUpload)
 }
 
-// AdminRateLimitMiddleware applies admin rate limiting (30 req/15min)
+// AdminRateLimitMiddleware applies admin rate limiting (30 req/15min, or the
+// rate_limit.admin setting per minute)
 func AdminRateLimitMiddleware() gin.HandlerFunc {
-	return wrapRateLimiter(adminLimiter, AdminRequestsPerWindow, AdminWindowDuration)
+	return endpointRateLimit(RateLimitAdmin)
 }
 
-// wrapRateLimiter wraps httprate.RateLimiter for Gin
-func wrapRateLimiter(limiter *httprate.RateLimiter, limit int, window time.Duration) gin.HandlerFunc {
+// endpointRateLimit limits an endpoint class per client IP
+func endpointRateLimit(name string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Create a wrapper to capture rate limit status
-		rateLimitExceeded := false
-
-		handler := limiter.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Check if rate limit headers were set by httprate
-			if w.Header().Get("X-RateLimit-Remaining") == "0" {
-				rateLimitExceeded = true
-			}
-			c.Next()
-		}))
-
-		// Create response writer wrapper
-		writer := &rateLimitResponseWriter{
-			ResponseWriter: c.Writer,
-			ginContext:     c,
-		}
-		c.Writer = writer
-
-		// Call httprate handler
-		handler.ServeHTTP(writer, c.Request)
-
-		// If rate limited, abort with 429
-		if rateLimitExceeded {
-			retryAfter := int(window.Seconds())
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":       "Rate limit exceeded",
-				"message":     "Too many requests. Please try again later.",
-				"retry_after": retryAfter,
-			})
-			c.Abort()
+		policy := currentRateLimitPolicy()
+		if policy.enabled && !limitRequest(c, currentRateLimitStore(), name+":"+c.ClientIP(), policy.endpoints[name], 1) {
 			return
 		}
+		c.Next()
+	}
+}
 
-		// Set rate limit headers for successful requests
-		c.Header("X-RateLimit-Limit", writer.Header().Get("X-RateLimit-Limit"))
-		c.Header("X-RateLimit-Remaining", writer.Header().Get("X-RateLimit-Remaining"))
-		c.Header("X-RateLimit-Reset", writer.Header().Get("X-RateLimit-Reset"))
+// tierRateLimit limits every request per client IP with one API tier
+func tierRateLimit(tier string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy := currentRateLimitPolicy()
+		if policy.enabled && !limitRequest(c, currentRateLimitStore(), "api:"+tier+":"+c.ClientIP(), policy.tiers[tier], policy.routeCost(c)) {
+			return
+		}
+		c.Next()
 	}
 }
 
-// rateLimitResponseWriter wraps gin.ResponseWriter to work with httprate
-type rateLimitResponseWriter struct {
-	gin.ResponseWriter
-	ginContext *gin.Context
-	statusCode int
+// takeRateLimit counts a request, falling back to this node's counters when
+// the shared store fails so an outage does not disable limiting
+func takeRateLimit(store service.RateLimitStore, key string, cost int, rule rateLimitRule) service.RateLimitResult {
+	result, err := store.Take(key, cost, rule.requests, rule.window)
+	if err == nil {
+		return result
+	}
+
+	rateLimitErrorMu.Lock()
+	if time.Since(rateLimitErrorLast) > time.Minute {
+		log.Printf("Rate limit store (%s) failed, using local counters: %v", store.Name(), err)
+		rateLimitErrorLast = time.Now()
+	}
+	rateLimitErrorMu.Unlock()
+
+	result, _ = localRateLimitStore.Take(key, cost, rule.requests, rule.window)
+	return result
 }
 
-func (w *rateLimitResponseWriter) WriteHeader(statusCode int) {
-	w.statusCode = statusCode
-	if statusCode == http.StatusTooManyRequests {
-		// Don't write header yet, let Gin handle it
-		return
+// limitRequest counts the request against rule and sets the RateLimit
+// headers. It aborts with 429 and returns false when the limit is used up.
+// Rules without requests (unknown tiers) do not limit.
+func limitRequest(c *gin.Context, store service.RateLimitStore, key string, rule rateLimitRule, cost int) bool {
+	if rule.requests <= 0 || rule.window <= 0 {
+		return true
 	}
-	w.ResponseWriter.WriteHeader(statusCode)
+
+	result := takeRateLimit(store, key, cost, rule)
+	reset := int((result.Reset + time.Second - 1) / time.Second)
+
+	// IETF RateLimit header fields (draft-ietf-httpapi-ratelimit-headers),
+	// plus the X-RateLimit-* headers older clients read
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(reset))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rule.requests, int(rule.window/time.Second)))
+	c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(result.Reset).Unix(), 10))
+
+	if result.Allowed {
+		return true
+	}
+
+	c.Header("Retry-After", strconv.Itoa(reset))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Rate limit exceeded",
+		"message":     "Too many requests. Please try again later.",
+		"retry_after": reset,
+	})
+	c.Abort()
+	return false
 }
 
-func (w *rateLimitResponseWriter) Write(b []byte) (int, error) {
-	if w.statusCode == http.StatusTooManyRequests {
-		// Don't write body for rate limited requests
-		// Gin will handle the JSON response
-		return len(b), nil
+// enforceTokenQuota aborts with 429 when the token has used up its
+// per-minute limit or daily quota. Quotas are counted in the shared store,
+// so they hold across cluster nodes.
+func enforceTokenQuota(c *gin.Context, t *models.Token) bool {
+	store := currentRateLimitStore()
+	key := fmt.Sprintf("token-quota:%s:%d", t.OwnerType, t.ID)
+
+	var result service.RateLimitResult
+	result.Allowed = true
+	if t.RateLimit > 0 {
+		result = takeRateLimit(store, key+":minute", 1, rateLimitRule{t.RateLimit, time.Minute})
+	}
+	if result.Allowed && t.DailyQuota > 0 {
+		result = takeRateLimit(store, key+":day", 1, rateLimitRule{t.DailyQuota, 24 * time.Hour})
 	}
-	return w.ResponseWriter.Write(b)
+	if result.Allowed {
+		return true
+	}
+
+	retryAfter := int((result.Reset + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Token quota exceeded",
+		"message":     "This API token has used up its request quota. Please try again later.",
+		"retry_after": retryAfter,
+	})
+	c.Abort()
+	return false
 }
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"database/sql"
+	"net/http"
+
+	models "github.com/apimgr/weather/src/server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PermissionsContextKey holds the models.PermissionSet of the admin API
+// caller
+const PermissionsContextKey = "permissions"
+
+// AdminRBAC enforces role permissions on every admin API route. It runs
+// after TokenAuthMiddleware: admins are checked against their assigned
+// roles, users against the role named by their account. Routes that need
+// no permission (an admin's own profile) still need an admin.
+func AdminRBAC(serverDB *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles := &models.RoleModel{DB: serverDB}
+		var permissions models.PermissionSet
+		var err error
+		isAdmin := false
+
+		if value, ok := c.Get("admin"); ok {
+			if admin, ok := value.(*models.Admin); ok && admin != nil {
+				permissions, err = roles.AdminPermissions(admin)
+				isAdmin = true
+			}
+		} else if value, ok := c.Get("user"); ok {
+			if user, ok := value.(*models.User); ok && user != nil {
+				permissions, err = roles.UserPermissions(user)
+			}
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"ok": false, "error": "Failed to load permissions"})
+			return
+		}
+		if permissions == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"ok": false, "error": "Not authenticated"})
+			return
+		}
+
+		required := models.AdminRoutePermission(c.Request.Method, c.FullPath())
+		if (required == "" && !isAdmin) || !permissions.Has(required) {
+			abortMissingPermission(c, required)
+			return
+		}
+
+		c.Set(PermissionsContextKey, permissions)
+		c.Next()
+	}
+}
+
+// HasPermission reports whether the admin API caller holds permission, for
+// handlers that need more than their route's permission
+func HasPermission(c *gin.Context, permission string) bool {
+	value, ok := c.Get(PermissionsContextKey)
+	if !ok {
+		return false
+	}
+	permissions, ok := value.(models.PermissionSet)
+	return ok && permissions.Has(permission)
+}
+
+// GetPermissions returns the admin API caller's permissions
+func GetPermissions(c *gin.Context) models.PermissionSet {
+	if value, ok := c.Get(PermissionsContextKey); ok {
+		if permissions, ok := value.(models.PermissionSet); ok {
+			return permissions
+		}
+	}
+	return models.PermissionSet{}
+}
+
+func abortMissingPermission(c *gin.Context, permission string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"ok":                  false,
+		"error":               "Permission denied",
+		"required_permission": permission,
+	})
+}
@@ -4,7 +4,10 @@ package middleware
 import (
 	"database/sql"
 	"fmt"
+	"log"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/apimgr/weather/src/server/model"
 	"github.com/gin-gonic/gin"
@@ -89,11 +92,36 @@ func TokenAuthMiddleware(serverDB, usersDB *sql.DB) gin.HandlerFunc {
 
 		// Determine token type and validate
 		tokenType := DetectTokenType(token)
+		var apiToken *models.Token
+		var tokenDB *sql.DB
 
 		switch tokenType {
 		case TokenTypeAdmin:
-			// Validate admin token (adm_)
+			// Validate admin token (adm_). Scoped tokens are checked first;
+			// the per-admin token on the credentials row keeps full access.
 			adminModel := &models.AdminModel{DB: serverDB}
+			if scoped, err := (&models.TokenModelV2{DB: serverDB}).ValidateToken(token); err == nil {
+				admin, err := adminModel.GetByID(scoped.OwnerID)
+				if err != nil || !admin.IsActive {
+					c.JSON(401, gin.H{"ok": false, "error": "invalid admin token"})
+					c.Abort()
+					return
+				}
+				if !authorizeAPIToken(c, scoped) {
+					return
+				}
+				if required := adminTokenScope(c); !scoped.HasScope(required) {
+					abortMissingScope(c, required)
+					return
+				}
+				apiToken, tokenDB = scoped, serverDB
+				c.Set("admin", admin)
+				c.Set("db", serverDB)
+				c.Set("auth_type", "admin_token")
+				c.Set(APITokenContextKey, scoped)
+				break
+			}
+
 			admin, err := adminModel.GetByAPIToken(token)
 			if err != nil {
 				c.JSON(401, gin.H{"ok": false, "error": "invalid admin token"})
@@ -123,11 +151,14 @@ func TokenAuthMiddleware(serverDB, usersDB *sql.DB) gin.HandlerFunc {
 				return
 			}
 
-			// Update last used timestamp
-			go tokenModelV2.UpdateLastUsed(validatedToken.ID)
+			if !authorizeAPIToken(c, validatedToken) {
+				return
+			}
 
+			apiToken, tokenDB = validatedToken, usersDB
 			c.Set("user", user)
 			c.Set("token", validatedToken)
+			c.Set(APITokenContextKey, validatedToken)
 			c.Set("auth_type", "user_token")
 
 		case TokenTypeAdminAgent, TokenTypeUserAgent, TokenTypeOrgAgent:
@@ -137,8 +168,8 @@ func TokenAuthMiddleware(serverDB, usersDB *sql.DB) gin.HandlerFunc {
 			return
 
 		case TokenTypeOrg:
-			// Organization tokens - implement when PART 34 is needed
-			c.JSON(401, gin.H{"ok": false, "error": "organization tokens not yet implemented"})
+			// Organization tokens only reach their organization's API
+			c.JSON(401, gin.H{"ok": false, "error": "organization tokens cannot access the admin API"})
 			c.Abort()
 			return
 
@@ -149,5 +180,76 @@ func TokenAuthMiddleware(serverDB, usersDB *sql.DB) gin.HandlerFunc {
 		}
 
 		c.Next()
+
+		if apiToken != nil {
+			recordAPITokenUse(tokenDB, apiToken, c)
+		}
+	}
+}
+
+// APITokenContextKey holds the *models.Token a request authenticated with
+const APITokenContextKey = "api_token"
+
+// GetAPIToken returns the token the request authenticated with, if any
+func GetAPIToken(c *gin.Context) (*models.Token, bool) {
+	value, exists := c.Get(APITokenContextKey)
+	if !exists {
+		return nil, false
+	}
+	token, ok := value.(*models.Token)
+	return token, ok && token != nil
+}
+
+// authorizeAPIToken applies a token's IP binding and request quota. It
+// aborts the request and returns false when either rejects it.
+func authorizeAPIToken(c *gin.Context, t *models.Token) bool {
+	if !t.AllowsIP(c.ClientIP()) {
+		c.JSON(http.StatusForbidden, gin.H{"ok": false, "error": "token is not allowed from this IP address"})
+		c.Abort()
+		return false
+	}
+	return enforceTokenQuota(c, t)
+}
+
+// adminTokenScope returns the scope a scoped admin token needs for the
+// current admin API route
+func adminTokenScope(c *gin.Context) string {
+	path := c.FullPath()
+	switch {
+	case strings.Contains(path, "/profile/token"), strings.Contains(path, "/profile/passkeys"), strings.Contains(path, "/server/reauth"):
+		// Token, passkey and re-authentication management could grant
+		// broader access
+		return models.ScopeGlobal
+	case strings.Contains(path, "/server/backup"):
+		return models.ScopeAdminBackup
+	case strings.HasSuffix(path, "/notifications/send"):
+		return models.ScopeNotificationsSend
+	}
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return models.ScopeAdminRead
+	default:
+		return models.ScopeAdminWrite
 	}
 }
+
+// recordAPITokenUse updates the token's last use and hourly usage counts
+// once the request has been handled
+func recordAPITokenUse(db *sql.DB, t *models.Token, c *gin.Context) {
+	if db == nil {
+		return
+	}
+	ip := c.ClientIP()
+	route := c.Request.Method + " " + c.FullPath()
+	failed := c.Writer.Status() >= http.StatusBadRequest
+	now := time.Now()
+
+	go func() {
+		if err := (&models.TokenModelV2{DB: db}).UpdateLastUsed(t, ip); err != nil {
+			log.Printf("Token %d: failed to update last use: %v", t.ID, err)
+		}
+		if err := (&models.TokenUsageModel{DB: db}).Record(t, route, failed, now); err != nil {
+			log.Printf("Token %d: %v", t.ID, err)
+		}
+	}()
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/gin-gonic/gin"
+)
+
+// tokenLocationTolerance is how far (in degrees, about 1 km) requested
+// coordinates may be from a location-bound token's saved location
+const tokenLocationTolerance = 0.01
+
+// RequireTokenScope rejects API token requests whose token lacks scope.
+// Session requests are not affected.
+func RequireTokenScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, ok := GetAPIToken(c); ok && !token.HasScope(scope) {
+			abortMissingScope(c, scope)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireTokenScopeByMethod requires readScope for GET and HEAD requests
+// and writeScope for everything else
+func RequireTokenScopeByMethod(readScope, writeScope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := writeScope
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			scope = readScope
+		}
+		if token, ok := GetAPIToken(c); ok && !token.HasScope(scope) {
+			abortMissingScope(c, scope)
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortMissingScope(c *gin.Context, scope string) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"ok":             false,
+		"error":          "token does not have the required scope",
+		"required_scope": scope,
+	})
+	c.Abort()
+}
+
+// BindTokenLocation restricts location-bound tokens to their saved location.
+// Requests without a location get the saved coordinates; requests for any
+// other place are rejected.
+func BindTokenLocation(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := GetAPIToken(c)
+		if !ok || token.LocationID == nil {
+			c.Next()
+			return
+		}
+
+		location, err := (&models.LocationModel{DB: db}).GetByID(int(*token.LocationID))
+		if err != nil || int64(location.UserID) != token.OwnerID {
+			abortWrongLocation(c, "the token's location no longer exists")
+			return
+		}
+
+		query := c.Request.URL.Query()
+		if c.Param("location") != "" || query.Get("location") != "" || query.Get("city_id") != "" || query.Get("nearest") != "" {
+			abortWrongLocation(c, "this token may only request its bound location")
+			return
+		}
+
+		lat, lon := query.Get("lat"), query.Get("lon")
+		if lat == "" && lon == "" {
+			query.Set("lat", strconv.FormatFloat(location.Latitude, 'f', -1, 64))
+			query.Set("lon", strconv.FormatFloat(location.Longitude, 'f', -1, 64))
+			c.Request.URL.RawQuery = query.Encode()
+			c.Next()
+			return
+		}
+
+		latitude, latErr := strconv.ParseFloat(lat, 64)
+		longitude, lonErr := strconv.ParseFloat(lon, 64)
+		if latErr != nil || lonErr != nil ||
+			math.Abs(latitude-location.Latitude) > tokenLocationTolerance ||
+			math.Abs(longitude-location.Longitude) > tokenLocationTolerance {
+			abortWrongLocation(c, "this token may only request its bound location")
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortWrongLocation(c *gin.Context, message string) {
+	c.JSON(http.StatusForbidden, gin.H{"ok": false, "error": message})
+	c.Abort()
+}
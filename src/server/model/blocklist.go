@@ -0,0 +1,236 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Blocklist entry types enforced by the request blocklist
+const (
+	BlocklistTypeIP      = "ip"
+	BlocklistTypeCIDR    = "cidr"
+	BlocklistTypeCountry = "country"
+)
+
+// Blocklist entry actions. Allow entries take precedence over every deny
+// entry and downloaded list.
+const (
+	BlocklistActionAllow = "allow"
+	BlocklistActionDeny  = "deny"
+)
+
+// BlocklistSourceManual marks entries added by an administrator
+const BlocklistSourceManual = "manual"
+
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// BlocklistEntry is an administrator-managed allow or deny entry
+type BlocklistEntry struct {
+	ID        int64      `json:"id"`
+	Type      string     `json:"type"`
+	Value     string     `json:"value"`
+	Action    string     `json:"action"`
+	Reason    string     `json:"reason,omitempty"`
+	Source    string     `json:"source"`
+	AddedBy   string     `json:"added_by,omitempty"`
+	AddedAt   time.Time  `json:"added_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Prefix returns the entry's address range; only valid for ip and cidr
+// entries
+func (e *BlocklistEntry) Prefix() (netip.Prefix, error) {
+	if e.Type == BlocklistTypeIP {
+		addr, err := netip.ParseAddr(e.Value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	return netip.ParsePrefix(e.Value)
+}
+
+// Normalize validates the entry and puts its value in canonical form
+func (e *BlocklistEntry) Normalize() error {
+	e.Type = strings.ToLower(strings.TrimSpace(e.Type))
+	e.Action = strings.ToLower(strings.TrimSpace(e.Action))
+	e.Value = strings.TrimSpace(e.Value)
+	if e.Action == "" {
+		e.Action = BlocklistActionDeny
+	}
+	if e.Action != BlocklistActionAllow && e.Action != BlocklistActionDeny {
+		return fmt.Errorf("action must be allow or deny")
+	}
+
+	switch e.Type {
+	case BlocklistTypeIP:
+		addr, err := netip.ParseAddr(e.Value)
+		if err != nil {
+			return fmt.Errorf("invalid IP address: %s", e.Value)
+		}
+		e.Value = addr.Unmap().String()
+	case BlocklistTypeCIDR:
+		prefix, err := netip.ParsePrefix(e.Value)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR range: %s", e.Value)
+		}
+		e.Value = prefix.Masked().String()
+	case BlocklistTypeCountry:
+		e.Value = strings.ToUpper(e.Value)
+		if !countryCodePattern.MatchString(e.Value) {
+			return fmt.Errorf("country must be a two-letter ISO code")
+		}
+		if e.Action != BlocklistActionDeny {
+			return fmt.Errorf("country entries can only deny")
+		}
+	default:
+		return fmt.Errorf("type must be ip, cidr or country")
+	}
+	return nil
+}
+
+// BlocklistSource summarizes a downloaded blocklist
+type BlocklistSource struct {
+	Name      string `json:"name"`
+	Entries   int    `json:"entries"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// BlocklistModel handles server_blocklists (manual entries) and
+// server_ip_blocklist (downloaded lists)
+type BlocklistModel struct {
+	DB *sql.DB
+}
+
+// List returns all manual entries, including expired ones
+func (m *BlocklistModel) List() ([]*BlocklistEntry, error) {
+	return m.query(`
+		SELECT id, type, value, action, reason, source, added_by, added_at, expires_at
+		FROM server_blocklists
+		ORDER BY type, value
+	`)
+}
+
+// ListActive returns the ip, cidr and country entries that have not expired
+func (m *BlocklistModel) ListActive() ([]*BlocklistEntry, error) {
+	return m.query(`
+		SELECT id, type, value, action, reason, source, added_by, added_at, expires_at
+		FROM server_blocklists
+		WHERE type IN ('ip', 'cidr', 'country')
+		  AND (expires_at IS NULL OR expires_at > ?)
+	`, time.Now())
+}
+
+func (m *BlocklistModel) query(query string, args ...interface{}) ([]*BlocklistEntry, error) {
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocklist entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*BlocklistEntry{}
+	for rows.Next() {
+		e := &BlocklistEntry{}
+		var reason, source, addedBy sql.NullString
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&e.ID, &e.Type, &e.Value, &e.Action, &reason, &source, &addedBy, &e.AddedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		e.Reason, e.Source, e.AddedBy = reason.String, source.String, addedBy.String
+		if e.Source == "" {
+			e.Source = BlocklistSourceManual
+		}
+		if expiresAt.Valid {
+			e.ExpiresAt = &expiresAt.Time
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Create validates and stores an entry. An existing entry for the same type
+// and value is replaced.
+func (m *BlocklistModel) Create(e *BlocklistEntry) error {
+	if err := e.Normalize(); err != nil {
+		return err
+	}
+	if e.Source == "" {
+		e.Source = BlocklistSourceManual
+	}
+	e.AddedAt = time.Now()
+
+	err := m.DB.QueryRow(`
+		INSERT INTO server_blocklists (type, value, action, reason, source, added_by, added_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(type, value) DO UPDATE SET
+			action = excluded.action,
+			reason = excluded.reason,
+			source = excluded.source,
+			added_by = excluded.added_by,
+			added_at = excluded.added_at,
+			expires_at = excluded.expires_at
+		RETURNING id
+	`, e.Type, e.Value, e.Action, e.Reason, e.Source, e.AddedBy, e.AddedAt, e.ExpiresAt).Scan(&e.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save blocklist entry: %w", err)
+	}
+	return nil
+}
+
+// Delete removes an entry
+func (m *BlocklistModel) Delete(id int64) error {
+	result, err := m.DB.Exec("DELETE FROM server_blocklists WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete blocklist entry: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// EachSourceRange calls fn for every range of the downloaded lists
+func (m *BlocklistModel) EachSourceRange(fn func(source, ipRange string)) error {
+	rows, err := m.DB.Query("SELECT source, ip_range FROM server_ip_blocklist")
+	if err != nil {
+		return fmt.Errorf("failed to read downloaded blocklists: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var source, ipRange string
+		if err := rows.Scan(&source, &ipRange); err != nil {
+			return err
+		}
+		fn(source, ipRange)
+	}
+	return rows.Err()
+}
+
+// Sources summarizes the downloaded lists
+func (m *BlocklistModel) Sources() ([]BlocklistSource, error) {
+	rows, err := m.DB.Query(`
+		SELECT source, COUNT(*), COALESCE(MAX(updated_at), '')
+		FROM server_ip_blocklist
+		GROUP BY source
+		ORDER BY source
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize downloaded blocklists: %w", err)
+	}
+	defer rows.Close()
+
+	sources := []BlocklistSource{}
+	for rows.Next() {
+		var s BlocklistSource
+		if err := rows.Scan(&s.Name, &s.Entries, &s.UpdatedAt); err != nil {
+			return nil, err
+		}
+		sources = append(sources, s)
+	}
+	return sources, rows.Err()
+}
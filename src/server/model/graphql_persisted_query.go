@@ -0,0 +1,230 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Persisted query sources
+const (
+	// PersistedQuerySourceAPQ marks queries registered by clients via APQ
+	PersistedQuerySourceAPQ = "apq"
+	// PersistedQuerySourceAdmin marks queries registered by an administrator
+	PersistedQuerySourceAdmin = "admin"
+)
+
+// Defaults for graphql.persisted_queries.apq_max_entries and apq_ttl_days
+const (
+	DefaultAPQMaxEntries = 1000
+	DefaultAPQTTLDays    = 30
+)
+
+// PersistedQuery represents a stored GraphQL query keyed by its SHA-256 hash
+type PersistedQuery struct {
+	Hash       string     `json:"hash"`
+	Query      string     `json:"query"`
+	Name       string     `json:"name,omitempty"`
+	Source     string     `json:"source"`
+	HitCount   int        `json:"hit_count"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// PersistedQueryModel handles GraphQL persisted query database operations
+type PersistedQueryModel struct {
+	DB *sql.DB
+}
+
+// HashQuery returns the APQ hash (hex SHA-256) of a query document
+func HashQuery(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the persisted query for a hash
+func (m *PersistedQueryModel) Get(hash string) (*PersistedQuery, error) {
+	q := &PersistedQuery{}
+	var name sql.NullString
+	var lastUsedAt sql.NullTime
+	err := m.DB.QueryRow(`
+		SELECT hash, query, name, source, hit_count, created_at, last_used_at
+		FROM server_graphql_persisted_queries
+		WHERE hash = ?
+	`, hash).Scan(&q.Hash, &q.Query, &name, &q.Source, &q.HitCount, &q.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	q.Name = name.String
+	if lastUsedAt.Valid {
+		q.LastUsedAt = &lastUsedAt.Time
+	}
+	return q, nil
+}
+
+// Save stores a query under its hash. Existing entries keep their source,
+// so an admin-registered query is never downgraded to an APQ entry.
+func (m *PersistedQueryModel) Save(query, name, source string) (*PersistedQuery, error) {
+	if query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if source != PersistedQuerySourceAPQ && source != PersistedQuerySourceAdmin {
+		return nil, fmt.Errorf("invalid persisted query source: %s", source)
+	}
+
+	hash := HashQuery(query)
+	_, err := m.DB.Exec(`
+		INSERT INTO server_graphql_persisted_queries (hash, query, name, source, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(hash) DO UPDATE SET
+			name = COALESCE(NULLIF(excluded.name, ''), server_graphql_persisted_queries.name),
+			source = CASE WHEN excluded.source = 'admin' THEN 'admin' ELSE server_graphql_persisted_queries.source END
+	`, hash, query, name, source, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to save persisted query: %w", err)
+	}
+
+	return m.Get(hash)
+}
+
+// RecordUses adds the hit counts collected since the last flush, keyed by
+// hash, in one transaction
+func (m *PersistedQueryModel) RecordUses(counts map[string]int, usedAt time.Time) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for hash, count := range counts {
+		if _, err := tx.Exec(`
+			UPDATE server_graphql_persisted_queries
+			SET hit_count = hit_count + ?, last_used_at = ?
+			WHERE hash = ?
+		`, count, usedAt.UTC(), hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CountBySource returns the number of persisted queries from a source
+func (m *PersistedQueryModel) CountBySource(source string) (int, error) {
+	var count int
+	err := m.DB.QueryRow(
+		"SELECT COUNT(*) FROM server_graphql_persisted_queries WHERE source = ?", source,
+	).Scan(&count)
+	return count, err
+}
+
+// PruneAPQ removes client-registered queries not used since before cutoff,
+// then the least recently used ones above maxEntries. Queries registered by
+// an administrator are never pruned. A zero cutoff or maxEntries skips that
+// step.
+func (m *PersistedQueryModel) PruneAPQ(cutoff time.Time, maxEntries int) (int64, error) {
+	var deleted int64
+	if !cutoff.IsZero() {
+		result, err := m.DB.Exec(`
+			DELETE FROM server_graphql_persisted_queries
+			WHERE source = ? AND COALESCE(last_used_at, created_at) < ?
+		`, PersistedQuerySourceAPQ, cutoff.UTC())
+		if err != nil {
+			return 0, fmt.Errorf("failed to prune persisted queries: %w", err)
+		}
+		deleted, _ = result.RowsAffected()
+	}
+	if maxEntries <= 0 {
+		return deleted, nil
+	}
+
+	rows, err := m.DB.Query(`
+		SELECT hash FROM server_graphql_persisted_queries
+		WHERE source = ?
+		ORDER BY COALESCE(last_used_at, created_at) DESC, hash
+	`, PersistedQuerySourceAPQ)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to list persisted queries: %w", err)
+	}
+	var excess []string
+	for seen := 0; rows.Next(); seen++ {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return deleted, err
+		}
+		if seen >= maxEntries {
+			excess = append(excess, hash)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return deleted, err
+	}
+
+	for _, hash := range excess {
+		result, err := m.DB.Exec(
+			"DELETE FROM server_graphql_persisted_queries WHERE hash = ? AND source = ?",
+			hash, PersistedQuerySourceAPQ,
+		)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to prune persisted queries: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+	return deleted, nil
+}
+
+// List returns persisted queries, optionally filtered by source
+func (m *PersistedQueryModel) List(source string) ([]*PersistedQuery, error) {
+	query := `
+		SELECT hash, query, name, source, hit_count, created_at, last_used_at
+		FROM server_graphql_persisted_queries
+	`
+	var args []interface{}
+	if source != "" {
+		query += " WHERE source = ?"
+		args = append(args, source)
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := m.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var queries []*PersistedQuery
+	for rows.Next() {
+		q := &PersistedQuery{}
+		var name sql.NullString
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&q.Hash, &q.Query, &name, &q.Source, &q.HitCount, &q.CreatedAt, &lastUsedAt); err != nil {
+			return nil, err
+		}
+		q.Name = name.String
+		if lastUsedAt.Valid {
+			q.LastUsedAt = &lastUsedAt.Time
+		}
+		queries = append(queries, q)
+	}
+
+	return queries, rows.Err()
+}
+
+// Delete removes a persisted query
+func (m *PersistedQueryModel) Delete(hash string) error {
+	result, err := m.DB.Exec("DELETE FROM server_graphql_persisted_queries WHERE hash = ?", hash)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+func TestPersistedQueryRecordUses(t *testing.T) {
+	db := setupTokenDB(t, database.ServerSchema)
+	m := &PersistedQueryModel{DB: db}
+
+	q, err := m.Save("{ health { status } }", "", PersistedQuerySourceAPQ)
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := m.RecordUses(map[string]int{q.Hash: 3, "missing": 1}, time.Now()); err != nil {
+		t.Fatalf("RecordUses: %v", err)
+	}
+	if err := m.RecordUses(map[string]int{q.Hash: 2}, time.Now()); err != nil {
+		t.Fatalf("RecordUses: %v", err)
+	}
+
+	got, err := m.Get(q.Hash)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.HitCount != 5 {
+		t.Errorf("HitCount = %d, want 5", got.HitCount)
+	}
+	if got.LastUsedAt == nil {
+		t.Error("LastUsedAt not set")
+	}
+}
+
+func TestPersistedQueryPruneAPQ(t *testing.T) {
+	db := setupTokenDB(t, database.ServerSchema)
+	m := &PersistedQueryModel{DB: db}
+
+	save := func(query, source string) string {
+		t.Helper()
+		q, err := m.Save(query, "", source)
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		return q.Hash
+	}
+	stale := save("{ a }", PersistedQuerySourceAPQ)
+	old := save("{ b }", PersistedQuerySourceAPQ)
+	recent := save("{ c }", PersistedQuerySourceAPQ)
+	admin := save("{ d }", PersistedQuerySourceAdmin)
+
+	now := time.Now()
+	uses := map[string]time.Time{
+		stale:  now.AddDate(0, 0, -40),
+		old:    now.Add(-2 * time.Hour),
+		recent: now.Add(-time.Minute),
+		admin:  now.AddDate(0, 0, -90),
+	}
+	for hash, usedAt := range uses {
+		if err := m.RecordUses(map[string]int{hash: 1}, usedAt); err != nil {
+			t.Fatalf("RecordUses: %v", err)
+		}
+	}
+
+	deleted, err := m.PruneAPQ(now.AddDate(0, 0, -30), 1)
+	if err != nil {
+		t.Fatalf("PruneAPQ: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("deleted = %d, want 2", deleted)
+	}
+	for hash, want := range map[string]bool{stale: false, old: false, recent: true, admin: true} {
+		_, err := m.Get(hash)
+		if exists := err == nil; exists != want {
+			t.Errorf("%s exists = %v, want %v (err %v)", hash[:8], exists, want, err)
+		}
+		if err != nil && err != sql.ErrNoRows {
+			t.Fatalf("Get: %v", err)
+		}
+	}
+
+	count, err := m.CountBySource(PersistedQuerySourceAPQ)
+	if err != nil || count != 1 {
+		t.Errorf("CountBySource = %d, %v; want 1", count, err)
+	}
+}
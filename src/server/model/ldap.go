@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// LDAPMapping links a local account to a directory entry
+type LDAPMapping struct {
+	ID int64 `json:"id"`
+	// User ID in users.db, or admin ID in server.db
+	AccountID  int64      `json:"account_id"`
+	Server     string     `json:"server"`
+	DN         string     `json:"dn"`
+	UID        string     `json:"uid"`
+	Groups     []string   `json:"groups"`
+	LastSyncAt *time.Time `json:"last_sync_at,omitempty"`
+}
+
+func encodeLDAPGroups(groups []string) string {
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
+
+func scanLDAPMappings(rows *sql.Rows) ([]LDAPMapping, error) {
+	defer rows.Close()
+
+	var mappings []LDAPMapping
+	for rows.Next() {
+		var mapping LDAPMapping
+		var groups string
+		var lastSync sql.NullTime
+		if err := rows.Scan(&mapping.ID, &mapping.AccountID, &mapping.Server, &mapping.DN,
+			&mapping.UID, &groups, &lastSync); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(groups), &mapping.Groups)
+		if lastSync.Valid {
+			mapping.LastSyncAt = &lastSync.Time
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, rows.Err()
+}
+
+// LDAPMappingModel handles user_ldap_mappings in users.db
+type LDAPMappingModel struct {
+	DB *sql.DB
+}
+
+// GetUserID returns the user linked to a directory entry, or sql.ErrNoRows
+// when the entry is not linked
+func (m *LDAPMappingModel) GetUserID(server, dn string) (int64, error) {
+	var userID int64
+	err := m.DB.QueryRow(`
+		SELECT user_id FROM user_ldap_mappings
+		WHERE ldap_server = ? AND ldap_dn = ?
+	`, server, dn).Scan(&userID)
+	return userID, err
+}
+
+// Link records a directory entry for a user
+func (m *LDAPMappingModel) Link(userID int64, server, dn, uid string, groups []string) error {
+	_, err := m.DB.Exec(`
+		INSERT INTO user_ldap_mappings (user_id, ldap_server, ldap_dn, ldap_uid, groups, created_at, updated_at, last_sync_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, userID, server, dn, uid, encodeLDAPGroups(groups))
+	if err != nil {
+		return fmt.Errorf("failed to link LDAP entry: %w", err)
+	}
+	return nil
+}
+
+// Touch stores the groups seen at login or sync
+func (m *LDAPMappingModel) Touch(server, dn, uid string, groups []string) error {
+	_, err := m.DB.Exec(`
+		UPDATE user_ldap_mappings
+		SET ldap_uid = ?, groups = ?, updated_at = CURRENT_TIMESTAMP, last_sync_at = CURRENT_TIMESTAMP
+		WHERE ldap_server = ? AND ldap_dn = ?
+	`, uid, encodeLDAPGroups(groups), server, dn)
+	return err
+}
+
+// ListByServer returns every user linked to a directory
+func (m *LDAPMappingModel) ListByServer(server string) ([]LDAPMapping, error) {
+	rows, err := m.DB.Query(`
+		SELECT id, user_id, ldap_server, ldap_dn, ldap_uid, COALESCE(groups, '[]'), last_sync_at
+		FROM user_ldap_mappings
+		WHERE ldap_server = ?
+		ORDER BY id
+	`, server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list LDAP users: %w", err)
+	}
+	return scanLDAPMappings(rows)
+}
+
+// AdminLDAPMappingModel handles server_admin_ldap_mappings in server.db
+type AdminLDAPMappingModel struct {
+	DB *sql.DB
+}
+
+// GetAdminID returns the admin linked to a directory entry, or
+// sql.ErrNoRows when the entry is not linked
+func (m *AdminLDAPMappingModel) GetAdminID(server, dn string) (int64, error) {
+	var adminID int64
+	err := m.DB.QueryRow(`
+		SELECT admin_id FROM server_admin_ldap_mappings
+		WHERE ldap_server = ? AND ldap_dn = ?
+	`, server, dn).Scan(&adminID)
+	return adminID, err
+}
+
+// Link records a directory entry for an admin
+func (m *AdminLDAPMappingModel) Link(adminID int64, server, dn, uid string, groups []string) error {
+	_, err := m.DB.Exec(`
+		INSERT INTO server_admin_ldap_mappings (admin_id, ldap_server, ldap_dn, ldap_uid, groups, created_at, updated_at, last_sync_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, adminID, server, dn, uid, encodeLDAPGroups(groups))
+	if err != nil {
+		return fmt.Errorf("failed to link admin LDAP entry: %w", err)
+	}
+	return nil
+}
+
+// Touch stores the groups seen at login or sync
+func (m *AdminLDAPMappingModel) Touch(server, dn, uid string, groups []string) error {
+	_, err := m.DB.Exec(`
+		UPDATE server_admin_ldap_mappings
+		SET ldap_uid = ?, groups = ?, updated_at = CURRENT_TIMESTAMP, last_sync_at = CURRENT_TIMESTAMP
+		WHERE ldap_server = ? AND ldap_dn = ?
+	`, uid, encodeLDAPGroups(groups), server, dn)
+	return err
+}
+
+// ListByServer returns every admin linked to a directory
+func (m *AdminLDAPMappingModel) ListByServer(server string) ([]LDAPMapping, error) {
+	rows, err := m.DB.Query(`
+		SELECT id, admin_id, ldap_server, ldap_dn, ldap_uid, COALESCE(groups, '[]'), last_sync_at
+		FROM server_admin_ldap_mappings
+		WHERE ldap_server = ?
+		ORDER BY id
+	`, server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list LDAP admins: %w", err)
+	}
+	return scanLDAPMappings(rows)
+}
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+// LockoutPolicy controls how failed password logins lock an account. Every
+// MaxAttempts consecutive failures lock it; the first lock lasts Duration and
+// each further lock is Multiplier times longer, up to MaxDuration. A
+// successful login resets both counters.
+type LockoutPolicy struct {
+	MaxAttempts int
+	Duration    time.Duration
+	Multiplier  float64
+	MaxDuration time.Duration
+}
+
+// DefaultLockoutPolicy matches the security.* setting defaults
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		MaxAttempts: 5,
+		Duration:    30 * time.Minute,
+		Multiplier:  2,
+		MaxDuration: 24 * time.Hour,
+	}
+}
+
+// LoadLockoutPolicy reads the policy from the security.* settings
+func LoadLockoutPolicy() LockoutPolicy {
+	policy := DefaultLockoutPolicy()
+	if database.GetServerDB() == nil {
+		return policy
+	}
+
+	settings := &SettingsModel{}
+	policy.MaxAttempts = settings.GetInt("security.max_login_attempts", policy.MaxAttempts)
+	policy.Duration = time.Duration(settings.GetInt("security.lockout_duration", 30)) * time.Minute
+	policy.MaxDuration = time.Duration(settings.GetInt("security.lockout_max_duration", 1440)) * time.Minute
+	if multiplier, err := strconv.ParseFloat(settings.GetString("security.lockout_multiplier", "2"), 64); err == nil {
+		policy.Multiplier = multiplier
+	}
+	return policy
+}
+
+// Enabled reports whether failed logins lock accounts at all
+func (p LockoutPolicy) Enabled() bool {
+	return p.MaxAttempts > 0 && p.Duration > 0
+}
+
+// LockFor returns how long the n-th consecutive lock lasts
+func (p LockoutPolicy) LockFor(lockouts int) time.Duration {
+	if lockouts < 1 {
+		lockouts = 1
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	d := float64(p.Duration) * math.Pow(multiplier, float64(lockouts-1))
+	if p.MaxDuration > 0 && d > float64(p.MaxDuration) {
+		return p.MaxDuration
+	}
+	return time.Duration(d)
+}
+
+// AccountLockedError is returned by VerifyCredentials while an account is
+// locked after too many failed logins
+type AccountLockedError struct {
+	UserID int64
+	Until  time.Time
+	// Started is true when this attempt's failure started the lock
+	Started bool
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("account is locked until %s", e.Until.UTC().Format(time.RFC3339))
+}
+
+// RetryAfter returns the time left on the lock, at least one second
+func (e *AccountLockedError) RetryAfter() time.Duration {
+	return max(time.Until(e.Until).Round(time.Second), time.Second)
+}
+
+// LoginState is the per-user failed login and breach notification state
+type LoginState struct {
+	UserID           int64      `json:"user_id"`
+	FailedAttempts   int        `json:"failed_attempts"`
+	Lockouts         int        `json:"lockouts"`
+	LockedUntil      *time.Time `json:"locked_until,omitempty"`
+	LastFailedAt     *time.Time `json:"last_failed_at,omitempty"`
+	BreachNotifiedAt *time.Time `json:"breach_notified_at,omitempty"`
+}
+
+// Locked reports whether the account is locked at now
+func (s *LoginState) Locked(now time.Time) bool {
+	return s.LockedUntil != nil && now.Before(*s.LockedUntil)
+}
+
+// LoginStateModel stores LoginState in user_login_state
+type LoginStateModel struct {
+	DB *sql.DB
+}
+
+func (m *LoginStateModel) getDB() *sql.DB {
+	if m.DB != nil {
+		return m.DB
+	}
+	return database.GetUsersDB()
+}
+
+// Get returns the user's state; users without failures get a zero state
+func (m *LoginStateModel) Get(userID int64) (*LoginState, error) {
+	state := &LoginState{UserID: userID}
+	var lockedUntil, lastFailedAt, breachNotifiedAt sql.NullTime
+	err := m.getDB().QueryRow(`
+		SELECT failed_attempts, lockouts, locked_until, last_failed_at, breach_notified_at
+		FROM user_login_state WHERE user_id = ?
+	`, userID).Scan(&state.FailedAttempts, &state.Lockouts, &lockedUntil, &lastFailedAt, &breachNotifiedAt)
+	if err == sql.ErrNoRows {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load login state: %w", err)
+	}
+	if lockedUntil.Valid {
+		state.LockedUntil = &lockedUntil.Time
+	}
+	if lastFailedAt.Valid {
+		state.LastFailedAt = &lastFailedAt.Time
+	}
+	if breachNotifiedAt.Valid {
+		state.BreachNotifiedAt = &breachNotifiedAt.Time
+	}
+	return state, nil
+}
+
+// RecordFailure counts a failed password and locks the account when the
+// policy says so. The returned state has LockedUntil set when this failure
+// started a lock. Concurrent failures are all counted and only one of them
+// starts the lock.
+func (m *LoginStateModel) RecordFailure(userID int64, policy LockoutPolicy, now time.Time) (*LoginState, error) {
+	db := m.getDB()
+	// Increment in the database, not in Go, so parallel failures are not lost.
+	// locked_until is left alone: a lock set meanwhile must stay
+	_, err := db.Exec(`
+		INSERT INTO user_login_state (user_id, failed_attempts, last_failed_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			failed_attempts = user_login_state.failed_attempts + 1,
+			last_failed_at = excluded.last_failed_at
+	`, userID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record failed login: %w", err)
+	}
+
+	state, err := m.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	state.LockedUntil = nil
+	if !policy.Enabled() || state.FailedAttempts < policy.MaxAttempts {
+		return state, nil
+	}
+
+	// Claim the lock only if no other failure has claimed it since the read:
+	// a concurrent claim resets the counter and bumps lockouts
+	lockouts := state.Lockouts + 1
+	until := now.Add(policy.LockFor(lockouts))
+	result, err := db.Exec(`
+		UPDATE user_login_state
+		SET failed_attempts = 0, lockouts = ?, locked_until = ?
+		WHERE user_id = ? AND lockouts = ? AND failed_attempts >= ?
+	`, lockouts, until, userID, state.Lockouts, policy.MaxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock account: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return state, nil
+	}
+	state.FailedAttempts = 0
+	state.Lockouts = lockouts
+	state.LockedUntil = &until
+	return state, nil
+}
+
+// RecordSuccess clears the failure counters after a successful login
+func (m *LoginStateModel) RecordSuccess(userID int64) error {
+	_, err := m.getDB().Exec(`
+		UPDATE user_login_state
+		SET failed_attempts = 0, lockouts = 0, locked_until = NULL
+		WHERE user_id = ?
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to reset failed logins: %w", err)
+	}
+	return nil
+}
+
+// Unlock lifts a lock early (admin action)
+func (m *LoginStateModel) Unlock(userID int64) error {
+	return m.RecordSuccess(userID)
+}
+
+// MarkBreachNotified records that the user was told their password is
+// breached. It returns false when they had already been told since their
+// last password change.
+func (m *LoginStateModel) MarkBreachNotified(userID int64, now time.Time) (bool, error) {
+	result, err := m.getDB().Exec(`
+		INSERT INTO user_login_state (user_id, breach_notified_at)
+		VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET breach_notified_at = excluded.breach_notified_at
+		WHERE user_login_state.breach_notified_at IS NULL
+	`, userID, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to record breach notification: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// ClearBreachNotified forgets the breach notification after a password
+// change, so a new breached password is reported again
+func (m *LoginStateModel) ClearBreachNotified(userID int64) error {
+	_, err := m.getDB().Exec(`UPDATE user_login_state SET breach_notified_at = NULL WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to clear breach notification: %w", err)
+	}
+	return nil
+}
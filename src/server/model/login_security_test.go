@@ -0,0 +1,170 @@
+package models
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+func TestLockoutPolicyLockFor(t *testing.T) {
+	policy := LockoutPolicy{MaxAttempts: 5, Duration: 30 * time.Minute, Multiplier: 2, MaxDuration: 3 * time.Hour}
+	tests := []struct {
+		lockouts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Minute},
+		{1, 30 * time.Minute},
+		{2, time.Hour},
+		{3, 2 * time.Hour},
+		{4, 3 * time.Hour},
+		{10, 3 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := policy.LockFor(tt.lockouts); got != tt.want {
+			t.Errorf("LockFor(%d) = %v, want %v", tt.lockouts, got, tt.want)
+		}
+	}
+
+	flat := LockoutPolicy{MaxAttempts: 5, Duration: time.Minute, Multiplier: 0.5}
+	if got := flat.LockFor(3); got != time.Minute {
+		t.Errorf("multiplier below 1: LockFor(3) = %v, want 1m", got)
+	}
+}
+
+func TestLoginStateLockout(t *testing.T) {
+	db := setupTokenDB(t, database.UsersSchema)
+	m := &LoginStateModel{DB: db}
+	policy := LockoutPolicy{MaxAttempts: 3, Duration: 10 * time.Minute, Multiplier: 2, MaxDuration: time.Hour}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	for i := 1; i < 3; i++ {
+		state, err := m.RecordFailure(1, policy, now)
+		if err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+		if state.FailedAttempts != i || state.Locked(now) {
+			t.Fatalf("failure %d: attempts %d, locked %v", i, state.FailedAttempts, state.Locked(now))
+		}
+	}
+
+	state, err := m.RecordFailure(1, policy, now)
+	if err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	if !state.Locked(now) || state.Lockouts != 1 || !state.LockedUntil.Equal(now.Add(10*time.Minute)) {
+		t.Fatalf("third failure should lock for 10m, got %+v", state)
+	}
+
+	stored, err := m.Get(1)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !stored.Locked(now) || stored.Locked(now.Add(11*time.Minute)) {
+		t.Fatalf("stored lock = %v, want until %v", stored.LockedUntil, now.Add(10*time.Minute))
+	}
+
+	// The next run of failures doubles the lock
+	later := now.Add(11 * time.Minute)
+	for i := 0; i < 3; i++ {
+		state, err = m.RecordFailure(1, policy, later)
+		if err != nil {
+			t.Fatalf("RecordFailure: %v", err)
+		}
+	}
+	if state.Lockouts != 2 || !state.LockedUntil.Equal(later.Add(20*time.Minute)) {
+		t.Fatalf("second lock = %+v, want 20m", state)
+	}
+
+	if err := m.RecordSuccess(1); err != nil {
+		t.Fatalf("RecordSuccess: %v", err)
+	}
+	stored, err = m.Get(1)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if stored.Locked(later) || stored.FailedAttempts != 0 || stored.Lockouts != 0 {
+		t.Fatalf("after success = %+v, want reset", stored)
+	}
+}
+
+func TestLoginStateBreachNotified(t *testing.T) {
+	db := setupTokenDB(t, database.UsersSchema)
+	m := &LoginStateModel{DB: db}
+	now := time.Now()
+
+	first, err := m.MarkBreachNotified(7, now)
+	if err != nil || !first {
+		t.Fatalf("first MarkBreachNotified = %v, %v; want true", first, err)
+	}
+	again, err := m.MarkBreachNotified(7, now)
+	if err != nil || again {
+		t.Fatalf("second MarkBreachNotified = %v, %v; want false", again, err)
+	}
+
+	if err := m.ClearBreachNotified(7); err != nil {
+		t.Fatalf("ClearBreachNotified: %v", err)
+	}
+	afterChange, err := m.MarkBreachNotified(7, now)
+	if err != nil || !afterChange {
+		t.Fatalf("MarkBreachNotified after clear = %v, %v; want true", afterChange, err)
+	}
+}
+
+func TestLoginStateConcurrentFailures(t *testing.T) {
+	db := setupTokenDB(t, database.UsersSchema)
+	m := &LoginStateModel{DB: db}
+	policy := LockoutPolicy{MaxAttempts: 5, Duration: 10 * time.Minute, Multiplier: 2, MaxDuration: time.Hour}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	// A burst of parallel wrong passwords must still reach the limit, and
+	// exactly one of them starts the lock
+	var wg sync.WaitGroup
+	var started atomic.Int32
+	errs := make(chan error, policy.MaxAttempts)
+	for i := 0; i < policy.MaxAttempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			state, err := m.RecordFailure(1, policy, now)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if state.Locked(now) {
+				started.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	if started.Load() != 1 {
+		t.Errorf("%d failures started a lock, want 1", started.Load())
+	}
+
+	stored, err := m.Get(1)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !stored.Locked(now) || stored.Lockouts != 1 {
+		t.Fatalf("after %d parallel failures = %+v, want locked once", policy.MaxAttempts, stored)
+	}
+
+	// A failure that passed the lock check before the lock was set must not
+	// lift it
+	state, err := m.RecordFailure(1, policy, now)
+	if err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	if state.Locked(now) {
+		t.Error("a failure during the lock reported starting a new one")
+	}
+	if stored, _ := m.Get(1); !stored.Locked(now) || !stored.LockedUntil.Equal(now.Add(10*time.Minute)) {
+		t.Errorf("lock after a racing failure = %v, want until %v", stored.LockedUntil, now.Add(10*time.Minute))
+	}
+}
@@ -2,8 +2,6 @@ package models
 
 import (
 	"database/sql"
-	"fmt"
-	"sync/atomic"
 	"testing"
 	"time"
 
@@ -15,20 +13,13 @@ var dbCounter int64
 
 // setupTestDB creates an in-memory SQLite database for testing
 func setupTestDB(t *testing.T) *sql.DB {
-	// Using file:NAME?mode=memory&cache=shared ensures all connections share the same in-memory database
-	// This is required because sql.DB uses connection pooling, and with plain :memory:
-	// each connection would get its own separate database
-	// We use unique names per test + counter to ensure test isolation even when called multiple times
-	testName := t.Name()
-	counter := atomic.AddInt64(&dbCounter, 1)
-	dbName := fmt.Sprintf("file:%s_model_%d?mode=memory&cache=shared", testName, counter)
-	db, err := sql.Open("sqlite", dbName)
-	if err != nil {
-		t.Fatalf("Failed to open test database: %v", err)
-	}
+	// In-memory SQLite databases are shared per name (mode=memory&cache=shared)
+	// because sql.DB pools connections; unique names per test + counter keep
+	// tests isolated even when called multiple times
+	db, _ := openTestDB(t, "model")
 
 	// Create user_notifications table
-	_, err = db.Exec(`
+	_, err := db.Exec(`
 		CREATE TABLE user_notifications (
 			id TEXT PRIMARY KEY,
 			user_id INTEGER NOT NULL,
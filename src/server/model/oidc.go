@@ -0,0 +1,125 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// OIDCMapping links a user account to an identity at an OIDC provider
+type OIDCMapping struct {
+	ID             int64      `json:"id"`
+	UserID         int64      `json:"user_id"`
+	ProviderName   string     `json:"provider_name"`
+	ProviderUserID string     `json:"provider_user_id"`
+	Issuer         string     `json:"issuer"`
+	Email          string     `json:"email,omitempty"`
+	Name           string     `json:"name,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastLoginAt    *time.Time `json:"last_login_at,omitempty"`
+}
+
+// OIDCMappingModel handles user_oidc_mappings in users.db
+type OIDCMappingModel struct {
+	DB *sql.DB
+}
+
+// GetUserID returns the user linked to a provider identity, or
+// sql.ErrNoRows when the identity is not linked
+func (m *OIDCMappingModel) GetUserID(provider, subject string) (int64, error) {
+	var userID int64
+	err := m.DB.QueryRow(`
+		SELECT user_id FROM user_oidc_mappings
+		WHERE provider_name = ? AND provider_user_id = ?
+	`, provider, subject).Scan(&userID)
+	return userID, err
+}
+
+// Link records a provider identity for a user
+func (m *OIDCMappingModel) Link(userID int64, provider, subject, issuer, email, name, claims string) error {
+	_, err := m.DB.Exec(`
+		INSERT INTO user_oidc_mappings (user_id, provider_name, provider_user_id, issuer, email, name, claims, created_at, updated_at, last_login_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, userID, provider, subject, issuer, email, name, claims)
+	if err != nil {
+		return fmt.Errorf("failed to link OIDC identity: %w", err)
+	}
+	return nil
+}
+
+// Touch refreshes the stored profile and last login of a linked identity
+func (m *OIDCMappingModel) Touch(provider, subject, email, name, claims string) error {
+	_, err := m.DB.Exec(`
+		UPDATE user_oidc_mappings
+		SET email = ?, name = ?, claims = ?, updated_at = CURRENT_TIMESTAMP, last_login_at = CURRENT_TIMESTAMP
+		WHERE provider_name = ? AND provider_user_id = ?
+	`, email, name, claims, provider, subject)
+	return err
+}
+
+// ListForUser returns the provider identities linked to a user
+func (m *OIDCMappingModel) ListForUser(userID int64) ([]OIDCMapping, error) {
+	rows, err := m.DB.Query(`
+		SELECT id, user_id, provider_name, provider_user_id, issuer, COALESCE(email, ''), COALESCE(name, ''), created_at, last_login_at
+		FROM user_oidc_mappings
+		WHERE user_id = ?
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OIDC identities: %w", err)
+	}
+	defer rows.Close()
+
+	var mappings []OIDCMapping
+	for rows.Next() {
+		var mapping OIDCMapping
+		var lastLogin sql.NullTime
+		if err := rows.Scan(&mapping.ID, &mapping.UserID, &mapping.ProviderName, &mapping.ProviderUserID,
+			&mapping.Issuer, &mapping.Email, &mapping.Name, &mapping.CreatedAt, &lastLogin); err != nil {
+			return nil, err
+		}
+		if lastLogin.Valid {
+			mapping.LastLoginAt = &lastLogin.Time
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, rows.Err()
+}
+
+// AdminOIDCMappingModel handles server_admin_oidc_mappings in server.db
+type AdminOIDCMappingModel struct {
+	DB *sql.DB
+}
+
+// GetAdminID returns the admin linked to a provider identity, or
+// sql.ErrNoRows when the identity is not linked
+func (m *AdminOIDCMappingModel) GetAdminID(provider, subject string) (int64, error) {
+	var adminID int64
+	err := m.DB.QueryRow(`
+		SELECT admin_id FROM server_admin_oidc_mappings
+		WHERE provider_name = ? AND provider_user_id = ?
+	`, provider, subject).Scan(&adminID)
+	return adminID, err
+}
+
+// Link records a provider identity for an admin
+func (m *AdminOIDCMappingModel) Link(adminID int64, provider, subject, issuer, email string) error {
+	_, err := m.DB.Exec(`
+		INSERT INTO server_admin_oidc_mappings (admin_id, provider_name, provider_user_id, issuer, email, created_at, last_login_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, adminID, provider, subject, issuer, email)
+	if err != nil {
+		return fmt.Errorf("failed to link admin OIDC identity: %w", err)
+	}
+	return nil
+}
+
+// Touch records an admin SSO login
+func (m *AdminOIDCMappingModel) Touch(provider, subject, email string) error {
+	_, err := m.DB.Exec(`
+		UPDATE server_admin_oidc_mappings
+		SET email = ?, last_login_at = CURRENT_TIMESTAMP
+		WHERE provider_name = ? AND provider_user_id = ?
+	`, email, provider, subject)
+	return err
+}
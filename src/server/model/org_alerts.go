@@ -0,0 +1,460 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+// Organization channel routes
+const (
+	// OrgRouteOnCall delivers to each on-call member's own contact for the
+	// channel, or to the owners when nobody is on call
+	OrgRouteOnCall = "on_call"
+	// OrgRouteMembers delivers to every member
+	OrgRouteMembers = "members"
+	// OrgRouteAddress delivers once to the address in the channel config,
+	// such as a team inbox or a webhook URL
+	OrgRouteAddress = "address"
+)
+
+// OrgAnyAlertType matches every alert type in a subscription
+const OrgAnyAlertType = "*"
+
+// alertSeverityRank orders weather alert severities
+var alertSeverityRank = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+var orgChannelTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,31}$`)
+
+// OrgLocation is a location shared by an organization's members
+type OrgLocation struct {
+	ID            int64     `json:"id"`
+	OrgID         int64     `json:"org_id"`
+	Name          string    `json:"name"`
+	Latitude      float64   `json:"latitude"`
+	Longitude     float64   `json:"longitude"`
+	Timezone      string    `json:"timezone,omitempty"`
+	AlertsEnabled bool      `json:"alerts_enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// OrgSubscription selects the alerts an organization is notified about.
+// LocationID 0 covers every org location.
+type OrgSubscription struct {
+	ID          int64     `json:"id"`
+	OrgID       int64     `json:"org_id"`
+	LocationID  int64     `json:"location_id"`
+	AlertType   string    `json:"alert_type"`
+	MinSeverity string    `json:"min_severity"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// OrgChannel routes an organization's alerts through a notification channel
+type OrgChannel struct {
+	ID          int64                  `json:"id"`
+	OrgID       int64                  `json:"org_id"`
+	ChannelType string                 `json:"channel_type"`
+	Name        string                 `json:"name"`
+	Route       string                 `json:"route"`
+	Config      map[string]interface{} `json:"config,omitempty"`
+	Enabled     bool                   `json:"enabled"`
+	CreatedAt   time.Time              `json:"created_at"`
+	UpdatedAt   time.Time              `json:"updated_at"`
+}
+
+// Address returns the configured delivery address for OrgRouteAddress
+func (c *OrgChannel) Address() string {
+	if c.Config == nil {
+		return ""
+	}
+	if address, ok := c.Config["address"]; ok {
+		return strings.TrimSpace(fmt.Sprintf("%v", address))
+	}
+	return ""
+}
+
+// Validate checks the channel type, route and address
+func (c *OrgChannel) Validate() error {
+	if !orgChannelTypePattern.MatchString(c.ChannelType) {
+		return fmt.Errorf("invalid channel type: %s", c.ChannelType)
+	}
+	switch c.Route {
+	case OrgRouteOnCall, OrgRouteMembers:
+	case OrgRouteAddress:
+		if c.Address() == "" {
+			return fmt.Errorf("config.address is required for the address route")
+		}
+	default:
+		return fmt.Errorf("route must be on_call, members or address")
+	}
+	return nil
+}
+
+// SeverityAtLeast reports whether an alert severity meets min. Unknown
+// severities never match.
+func SeverityAtLeast(severity, min string) bool {
+	return alertSeverityRank[severity] > 0 && alertSeverityRank[severity] >= alertSeverityRank[min]
+}
+
+// Matches reports whether the subscription covers an alert
+func (s *OrgSubscription) Matches(locationID int64, alertType, severity string) bool {
+	if !s.Enabled {
+		return false
+	}
+	if s.LocationID != 0 && s.LocationID != locationID {
+		return false
+	}
+	if s.AlertType != OrgAnyAlertType && !strings.EqualFold(s.AlertType, alertType) {
+		return false
+	}
+	return SeverityAtLeast(severity, s.MinSeverity)
+}
+
+// OrgAlertModel handles an organization's shared locations, alert
+// subscriptions and notification channels
+type OrgAlertModel struct {
+	DB *sql.DB
+}
+
+func (m *OrgAlertModel) getDB() *sql.DB {
+	if m.DB != nil {
+		return m.DB
+	}
+	return database.GetUsersDB()
+}
+
+const orgLocationColumns = `id, org_id, name, latitude, longitude, timezone, alerts_enabled, created_at, updated_at`
+
+func scanOrgLocation(row tokenScanner) (*OrgLocation, error) {
+	location := &OrgLocation{}
+	var timezone sql.NullString
+	if err := row.Scan(&location.ID, &location.OrgID, &location.Name, &location.Latitude, &location.Longitude,
+		&timezone, &location.AlertsEnabled, &location.CreatedAt, &location.UpdatedAt); err != nil {
+		return nil, err
+	}
+	location.Timezone = timezone.String
+	return location, nil
+}
+
+// CreateLocation adds a shared location
+func (m *OrgAlertModel) CreateLocation(orgID int64, name string, latitude, longitude float64, timezone string) (*OrgLocation, error) {
+	now := time.Now()
+	result, err := m.getDB().Exec(`
+		INSERT INTO org_saved_locations (org_id, name, latitude, longitude, timezone, alerts_enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?)
+	`, orgID, name, latitude, longitude, timezone, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create location: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return m.GetLocation(orgID, id)
+}
+
+// GetLocation returns one of orgID's locations
+func (m *OrgAlertModel) GetLocation(orgID, id int64) (*OrgLocation, error) {
+	location, err := scanOrgLocation(m.getDB().QueryRow(`
+		SELECT `+orgLocationColumns+` FROM org_saved_locations WHERE id = ? AND org_id = ?
+	`, id, orgID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("location not found")
+	}
+	return location, err
+}
+
+// ListLocations returns orgID's locations
+func (m *OrgAlertModel) ListLocations(orgID int64) ([]*OrgLocation, error) {
+	return m.queryLocations(`WHERE org_id = ? ORDER BY name`, orgID)
+}
+
+// AlertLocations returns every org location with alerts enabled
+func (m *OrgAlertModel) AlertLocations() ([]*OrgLocation, error) {
+	return m.queryLocations(`WHERE alerts_enabled = 1 ORDER BY org_id, id`)
+}
+
+func (m *OrgAlertModel) queryLocations(where string, args ...interface{}) ([]*OrgLocation, error) {
+	rows, err := m.getDB().Query(`SELECT `+orgLocationColumns+` FROM org_saved_locations `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []*OrgLocation{}
+	for rows.Next() {
+		location, err := scanOrgLocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+	return locations, rows.Err()
+}
+
+// UpdateLocation replaces a location's details
+func (m *OrgAlertModel) UpdateLocation(location *OrgLocation) error {
+	result, err := m.getDB().Exec(`
+		UPDATE org_saved_locations
+		SET name = ?, latitude = ?, longitude = ?, timezone = ?, alerts_enabled = ?, updated_at = ?
+		WHERE id = ? AND org_id = ?
+	`, location.Name, location.Latitude, location.Longitude, location.Timezone, location.AlertsEnabled,
+		time.Now(), location.ID, location.OrgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("location not found")
+	}
+	return nil
+}
+
+// DeleteLocation removes a location and the subscriptions bound to it
+func (m *OrgAlertModel) DeleteLocation(orgID, id int64) error {
+	result, err := m.getDB().Exec(`DELETE FROM org_saved_locations WHERE id = ? AND org_id = ?`, id, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("location not found")
+	}
+	_, err = m.getDB().Exec(`DELETE FROM org_alert_subscriptions WHERE org_id = ? AND location_id = ?`, orgID, id)
+	return err
+}
+
+// CountLocations returns how many locations orgID has
+func (m *OrgAlertModel) CountLocations(orgID int64) (int, error) {
+	var count int
+	err := m.getDB().QueryRow(`SELECT COUNT(*) FROM org_saved_locations WHERE org_id = ?`, orgID).Scan(&count)
+	return count, err
+}
+
+// CreateSubscription adds an alert subscription. An empty alert type
+// means every type and an empty severity means medium.
+func (m *OrgAlertModel) CreateSubscription(sub *OrgSubscription) (*OrgSubscription, error) {
+	if sub.AlertType == "" {
+		sub.AlertType = OrgAnyAlertType
+	}
+	if sub.MinSeverity == "" {
+		sub.MinSeverity = "medium"
+	}
+	if alertSeverityRank[sub.MinSeverity] == 0 {
+		return nil, fmt.Errorf("min_severity must be low, medium, high or critical")
+	}
+	if sub.LocationID != 0 {
+		if _, err := m.GetLocation(sub.OrgID, sub.LocationID); err != nil {
+			return nil, err
+		}
+	}
+
+	sub.CreatedAt = time.Now()
+	_, err := m.getDB().Exec(`
+		INSERT INTO org_alert_subscriptions (org_id, location_id, alert_type, min_severity, enabled, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (org_id, location_id, alert_type) DO UPDATE SET
+			min_severity = excluded.min_severity, enabled = excluded.enabled
+	`, sub.OrgID, sub.LocationID, sub.AlertType, sub.MinSeverity, sub.Enabled, sub.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save subscription: %w", err)
+	}
+	// An existing subscription for the same location and type is updated,
+	// so look the row up rather than trusting LastInsertId
+	if err := m.getDB().QueryRow(`
+		SELECT id, created_at FROM org_alert_subscriptions WHERE org_id = ? AND location_id = ? AND alert_type = ?
+	`, sub.OrgID, sub.LocationID, sub.AlertType).Scan(&sub.ID, &sub.CreatedAt); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ListSubscriptions returns orgID's alert subscriptions
+func (m *OrgAlertModel) ListSubscriptions(orgID int64) ([]*OrgSubscription, error) {
+	rows, err := m.getDB().Query(`
+		SELECT id, org_id, location_id, alert_type, min_severity, enabled, created_at
+		FROM org_alert_subscriptions WHERE org_id = ?
+		ORDER BY location_id, alert_type
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []*OrgSubscription{}
+	for rows.Next() {
+		sub := &OrgSubscription{}
+		if err := rows.Scan(&sub.ID, &sub.OrgID, &sub.LocationID, &sub.AlertType, &sub.MinSeverity,
+			&sub.Enabled, &sub.CreatedAt); err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// DeleteSubscription removes one of orgID's subscriptions
+func (m *OrgAlertModel) DeleteSubscription(orgID, id int64) error {
+	result, err := m.getDB().Exec(`DELETE FROM org_alert_subscriptions WHERE id = ? AND org_id = ?`, id, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("subscription not found")
+	}
+	return nil
+}
+
+// CreateChannel adds a notification channel config
+func (m *OrgAlertModel) CreateChannel(channel *OrgChannel) (*OrgChannel, error) {
+	if channel.Route == "" {
+		channel.Route = OrgRouteOnCall
+	}
+	if err := channel.Validate(); err != nil {
+		return nil, err
+	}
+	config, err := json.Marshal(channel.Config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	now := time.Now()
+	result, err := m.getDB().Exec(`
+		INSERT INTO org_notification_channels (org_id, channel_type, name, route, config, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, channel.OrgID, channel.ChannelType, channel.Name, channel.Route, string(config), channel.Enabled, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create channel: %w", err)
+	}
+	channel.ID, _ = result.LastInsertId()
+	channel.CreatedAt, channel.UpdatedAt = now, now
+	return channel, nil
+}
+
+// UpdateChannel replaces a channel config
+func (m *OrgAlertModel) UpdateChannel(channel *OrgChannel) error {
+	if err := channel.Validate(); err != nil {
+		return err
+	}
+	config, err := json.Marshal(channel.Config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	result, err := m.getDB().Exec(`
+		UPDATE org_notification_channels
+		SET channel_type = ?, name = ?, route = ?, config = ?, enabled = ?, updated_at = ?
+		WHERE id = ? AND org_id = ?
+	`, channel.ChannelType, channel.Name, channel.Route, string(config), channel.Enabled, time.Now(), channel.ID, channel.OrgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("channel not found")
+	}
+	return nil
+}
+
+// GetChannel returns one of orgID's channels
+func (m *OrgAlertModel) GetChannel(orgID, id int64) (*OrgChannel, error) {
+	channels, err := m.queryChannels(`WHERE id = ? AND org_id = ?`, id, orgID)
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("channel not found")
+	}
+	return channels[0], nil
+}
+
+// ListChannels returns orgID's channels
+func (m *OrgAlertModel) ListChannels(orgID int64) ([]*OrgChannel, error) {
+	return m.queryChannels(`WHERE org_id = ?`, orgID)
+}
+
+// EnabledChannels returns orgID's enabled channels
+func (m *OrgAlertModel) EnabledChannels(orgID int64) ([]*OrgChannel, error) {
+	return m.queryChannels(`WHERE org_id = ? AND enabled = 1`, orgID)
+}
+
+func (m *OrgAlertModel) queryChannels(where string, args ...interface{}) ([]*OrgChannel, error) {
+	rows, err := m.getDB().Query(`
+		SELECT id, org_id, channel_type, name, route, config, enabled, created_at, updated_at
+		FROM org_notification_channels `+where+` ORDER BY id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []*OrgChannel{}
+	for rows.Next() {
+		channel := &OrgChannel{}
+		var name, config sql.NullString
+		if err := rows.Scan(&channel.ID, &channel.OrgID, &channel.ChannelType, &name, &channel.Route,
+			&config, &channel.Enabled, &channel.CreatedAt, &channel.UpdatedAt); err != nil {
+			return nil, err
+		}
+		channel.Name = name.String
+		if config.String != "" {
+			json.Unmarshal([]byte(config.String), &channel.Config)
+		}
+		channels = append(channels, channel)
+	}
+	return channels, rows.Err()
+}
+
+// DeleteChannel removes one of orgID's channels
+func (m *OrgAlertModel) DeleteChannel(orgID, id int64) error {
+	result, err := m.getDB().Exec(`DELETE FROM org_notification_channels WHERE id = ? AND org_id = ?`, id, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("channel not found")
+	}
+	return nil
+}
+
+// Subscribed reports whether any of orgID's subscriptions covers an alert
+func (m *OrgAlertModel) Subscribed(orgID, locationID int64, alertType, severity string) (bool, error) {
+	subs, err := m.ListSubscriptions(orgID)
+	if err != nil {
+		return false, err
+	}
+	for _, sub := range subs {
+		if sub.Matches(locationID, alertType, severity) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasRecentAlert reports whether orgID was alerted about alertType at a
+// location within the window
+func (m *OrgAlertModel) HasRecentAlert(orgID, locationID int64, alertType string, window time.Duration) bool {
+	var count int
+	err := m.getDB().QueryRow(`
+		SELECT COUNT(*) FROM org_weather_alert_history
+		WHERE org_id = ? AND location_id = ? AND alert_type = ? AND sent_at > ?
+	`, orgID, locationID, alertType, time.Now().Add(-window)).Scan(&count)
+	return err == nil && count > 0
+}
+
+// RecordAlertSent records an alert sent to orgID
+func (m *OrgAlertModel) RecordAlertSent(orgID, locationID int64, alertType string) error {
+	_, err := m.getDB().Exec(`
+		INSERT INTO org_weather_alert_history (org_id, location_id, alert_type, sent_at)
+		VALUES (?, ?, ?, ?)
+	`, orgID, locationID, alertType, time.Now())
+	return err
+}
@@ -0,0 +1,539 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+// Organization member roles. Owners manage members, invites and tokens;
+// editors manage shared locations, subscriptions and channels; viewers
+// only read them.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleEditor = "editor"
+	OrgRoleViewer = "viewer"
+)
+
+var orgRoleRank = map[string]int{
+	OrgRoleViewer: 1,
+	OrgRoleEditor: 2,
+	OrgRoleOwner:  3,
+}
+
+var (
+	ErrOrgNotFound    = errors.New("organization not found")
+	ErrOrgSlugTaken   = errors.New("organization slug is already taken")
+	ErrNotOrgMember   = errors.New("not a member of this organization")
+	ErrLastOrgOwner   = errors.New("an organization must keep at least one owner")
+	ErrNotOrgInvite   = errors.New("invite is not for an organization")
+	ErrOrgInviteEmail = errors.New("invite was sent to a different email address")
+)
+
+var orgSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,38}[a-z0-9]$`)
+
+// Organization is a team that shares locations, alert subscriptions and
+// notification channels
+type Organization struct {
+	ID        int64     `json:"id"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	CreatedBy int64     `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Role is the requesting user's role, set by ListForUser
+	Role string `json:"role,omitempty"`
+}
+
+// OrgMember is a user's membership in an organization
+type OrgMember struct {
+	OrgID    int64     `json:"org_id"`
+	UserID   int64     `json:"user_id"`
+	Username string    `json:"username"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	OnCall   bool      `json:"on_call"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// OrgInvite is a user invite that adds its recipient to an organization
+type OrgInvite struct {
+	UserInvite
+	OrgID     int64  `json:"org_id"`
+	OrgName   string `json:"org_name"`
+	OrgRole   string `json:"org_role"`
+	InvitedBy int64  `json:"invited_by,omitempty"`
+}
+
+// IsValidOrgRole reports whether role is owner, editor or viewer
+func IsValidOrgRole(role string) bool {
+	_, ok := orgRoleRank[role]
+	return ok
+}
+
+// OrgRoleAtLeast reports whether role is min or a more powerful role
+func OrgRoleAtLeast(role, min string) bool {
+	return orgRoleRank[role] > 0 && orgRoleRank[role] >= orgRoleRank[min]
+}
+
+// ValidateOrgSlug checks an organization slug: 3-40 lowercase letters,
+// digits and inner hyphens
+func ValidateOrgSlug(slug string) error {
+	if !orgSlugPattern.MatchString(slug) {
+		return fmt.Errorf("slug must be 3-40 lowercase letters, digits or hyphens")
+	}
+	return nil
+}
+
+// OrgSlugFromName derives a slug from an organization name
+func OrgSlugFromName(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			hyphen = false
+		case b.Len() > 0 && !hyphen:
+			b.WriteByte('-')
+			hyphen = true
+		}
+	}
+	slug := strings.Trim(b.String(), "-")
+	if len(slug) > 40 {
+		slug = strings.Trim(slug[:40], "-")
+	}
+	return slug
+}
+
+// OrgModel handles organizations, their members and invites
+type OrgModel struct {
+	DB *sql.DB
+}
+
+func (m *OrgModel) getDB() *sql.DB {
+	if m.DB != nil {
+		return m.DB
+	}
+	return database.GetUsersDB()
+}
+
+// Create adds an organization with ownerID as its first owner. An empty
+// slug is derived from the name.
+func (m *OrgModel) Create(name, slug string, ownerID int64) (*Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if slug == "" {
+		slug = OrgSlugFromName(name)
+	}
+	if err := ValidateOrgSlug(slug); err != nil {
+		return nil, err
+	}
+
+	tx, err := m.getDB().Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM org_accounts WHERE slug = ?`, slug).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists > 0 {
+		return nil, ErrOrgSlugTaken
+	}
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		INSERT INTO org_accounts (slug, name, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, slug, name, ownerID, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO org_members (org_id, user_id, role, on_call, joined_at)
+		VALUES (?, ?, ?, 1, ?)
+	`, id, ownerID, OrgRoleOwner, now); err != nil {
+		return nil, fmt.Errorf("failed to add owner: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &Organization{ID: id, Slug: slug, Name: name, CreatedBy: ownerID, CreatedAt: now, UpdatedAt: now, Role: OrgRoleOwner}, nil
+}
+
+// Get returns an organization by ID
+func (m *OrgModel) Get(id int64) (*Organization, error) {
+	org := &Organization{}
+	var createdBy sql.NullInt64
+	err := m.getDB().QueryRow(`
+		SELECT id, slug, name, created_by, created_at, updated_at
+		FROM org_accounts WHERE id = ?
+	`, id).Scan(&org.ID, &org.Slug, &org.Name, &createdBy, &org.CreatedAt, &org.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrgNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	org.CreatedBy = createdBy.Int64
+	return org, nil
+}
+
+// ListForUser returns the organizations userID belongs to, with their role
+func (m *OrgModel) ListForUser(userID int64) ([]*Organization, error) {
+	rows, err := m.getDB().Query(`
+		SELECT o.id, o.slug, o.name, o.created_by, o.created_at, o.updated_at, om.role
+		FROM org_accounts o
+		JOIN org_members om ON om.org_id = o.id
+		WHERE om.user_id = ?
+		ORDER BY o.name
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Organization{}
+	for rows.Next() {
+		org := &Organization{}
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&org.ID, &org.Slug, &org.Name, &createdBy, &org.CreatedAt, &org.UpdatedAt, &org.Role); err != nil {
+			return nil, err
+		}
+		org.CreatedBy = createdBy.Int64
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// Rename changes an organization's display name
+func (m *OrgModel) Rename(id int64, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	result, err := m.getDB().Exec(`UPDATE org_accounts SET name = ?, updated_at = ? WHERE id = ?`, name, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrOrgNotFound
+	}
+	return nil
+}
+
+// Delete removes an organization and everything it owns
+func (m *OrgModel) Delete(id int64) error {
+	tx, err := m.getDB().Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Foreign keys are not enforced on every connection, so remove the
+	// dependent rows explicitly
+	for _, query := range []string{
+		`DELETE FROM org_token_usage WHERE token_id IN (SELECT id FROM org_tokens WHERE org_id = ?)`,
+		`DELETE FROM org_tokens WHERE org_id = ?`,
+		`DELETE FROM user_invites WHERE id IN (SELECT invite_id FROM org_invites WHERE org_id = ?)`,
+		`DELETE FROM org_invites WHERE org_id = ?`,
+		`DELETE FROM org_weather_alert_history WHERE org_id = ?`,
+		`DELETE FROM org_notification_channels WHERE org_id = ?`,
+		`DELETE FROM org_alert_subscriptions WHERE org_id = ?`,
+		`DELETE FROM org_saved_locations WHERE org_id = ?`,
+		`DELETE FROM org_members WHERE org_id = ?`,
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return fmt.Errorf("failed to delete organization: %w", err)
+		}
+	}
+	result, err := tx.Exec(`DELETE FROM org_accounts WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrOrgNotFound
+	}
+	return tx.Commit()
+}
+
+// MemberRole returns userID's role in orgID, or ErrNotOrgMember
+func (m *OrgModel) MemberRole(orgID, userID int64) (string, error) {
+	var role string
+	err := m.getDB().QueryRow(`SELECT role FROM org_members WHERE org_id = ? AND user_id = ?`, orgID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotOrgMember
+	}
+	return role, err
+}
+
+// ListMembers returns an organization's members, owners first
+func (m *OrgModel) ListMembers(orgID int64) ([]*OrgMember, error) {
+	return m.queryMembers(`WHERE om.org_id = ?`, orgID)
+}
+
+// GetMember returns userID's membership in orgID, or ErrNotOrgMember
+func (m *OrgModel) GetMember(orgID, userID int64) (*OrgMember, error) {
+	members, err := m.queryMembers(`WHERE om.org_id = ? AND om.user_id = ?`, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, ErrNotOrgMember
+	}
+	return members[0], nil
+}
+
+// OnCallMembers returns the members alerts are routed to. When nobody is
+// on call the owners are paged instead, so alerts are never dropped.
+func (m *OrgModel) OnCallMembers(orgID int64) ([]*OrgMember, error) {
+	members, err := m.queryMembers(`WHERE om.org_id = ? AND om.on_call = 1`, orgID)
+	if err != nil || len(members) > 0 {
+		return members, err
+	}
+	return m.queryMembers(`WHERE om.org_id = ? AND om.role = '`+OrgRoleOwner+`'`, orgID)
+}
+
+func (m *OrgModel) queryMembers(where string, args ...interface{}) ([]*OrgMember, error) {
+	rows, err := m.getDB().Query(`
+		SELECT om.org_id, om.user_id, u.username, u.email, om.role, om.on_call, om.joined_at
+		FROM org_members om
+		JOIN user_accounts u ON u.id = om.user_id
+		`+where+`
+		ORDER BY CASE om.role WHEN 'owner' THEN 0 WHEN 'editor' THEN 1 ELSE 2 END, u.username
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*OrgMember{}
+	for rows.Next() {
+		member := &OrgMember{}
+		if err := rows.Scan(&member.OrgID, &member.UserID, &member.Username, &member.Email,
+			&member.Role, &member.OnCall, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// AddMember adds userID to orgID with role. Existing members keep their
+// current role.
+func (m *OrgModel) AddMember(orgID, userID int64, role string) error {
+	if !IsValidOrgRole(role) {
+		return fmt.Errorf("invalid organization role: %s", role)
+	}
+	_, err := m.getDB().Exec(`
+		INSERT OR IGNORE INTO org_members (org_id, user_id, role, on_call, joined_at)
+		VALUES (?, ?, ?, 0, ?)
+	`, orgID, userID, role, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to add member: %w", err)
+	}
+	return nil
+}
+
+// UpdateMember changes a member's role and on-call flag. Demoting the last
+// owner fails with ErrLastOrgOwner.
+func (m *OrgModel) UpdateMember(orgID, userID int64, role string, onCall bool) error {
+	if !IsValidOrgRole(role) {
+		return fmt.Errorf("invalid organization role: %s", role)
+	}
+	current, err := m.MemberRole(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if current == OrgRoleOwner && role != OrgRoleOwner {
+		if err := m.checkNotLastOwner(orgID); err != nil {
+			return err
+		}
+	}
+	_, err = m.getDB().Exec(`
+		UPDATE org_members SET role = ?, on_call = ? WHERE org_id = ? AND user_id = ?
+	`, role, onCall, orgID, userID)
+	return err
+}
+
+// RemoveMember removes userID from orgID. Removing the last owner fails
+// with ErrLastOrgOwner.
+func (m *OrgModel) RemoveMember(orgID, userID int64) error {
+	current, err := m.MemberRole(orgID, userID)
+	if err != nil {
+		return err
+	}
+	if current == OrgRoleOwner {
+		if err := m.checkNotLastOwner(orgID); err != nil {
+			return err
+		}
+	}
+	_, err = m.getDB().Exec(`DELETE FROM org_members WHERE org_id = ? AND user_id = ?`, orgID, userID)
+	return err
+}
+
+func (m *OrgModel) checkNotLastOwner(orgID int64) error {
+	var owners int
+	if err := m.getDB().QueryRow(`
+		SELECT COUNT(*) FROM org_members WHERE org_id = ? AND role = ?
+	`, orgID, OrgRoleOwner).Scan(&owners); err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastOrgOwner
+	}
+	return nil
+}
+
+// CreateInvite invites email to orgID with role. The invite is a regular
+// user invite, so recipients without an account can register with it.
+func (m *OrgModel) CreateInvite(orgID int64, email, role string, invitedBy int64, expiresInDays int) (*OrgInvite, error) {
+	if !IsValidOrgRole(role) {
+		return nil, fmt.Errorf("invalid organization role: %s", role)
+	}
+	org, err := m.Get(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	invites := &UserInviteModel{DB: m.getDB()}
+	invite, err := invites.CreateInvite("", strings.ToLower(strings.TrimSpace(email)), RoleUser, expiresInDays)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.getDB().Exec(`
+		INSERT INTO org_invites (invite_id, org_id, role, invited_by) VALUES (?, ?, ?, ?)
+	`, invite.ID, orgID, role, invitedBy); err != nil {
+		m.getDB().Exec(`DELETE FROM user_invites WHERE id = ?`, invite.ID)
+		return nil, fmt.Errorf("failed to create organization invite: %w", err)
+	}
+
+	return &OrgInvite{UserInvite: *invite, OrgID: orgID, OrgName: org.Name, OrgRole: role, InvitedBy: invitedBy}, nil
+}
+
+// GetInvite returns the usable organization invite for token
+func (m *OrgModel) GetInvite(token string) (*OrgInvite, error) {
+	invite, err := (&UserInviteModel{DB: m.getDB()}).VerifyInvite(token)
+	if err != nil {
+		return nil, err
+	}
+	return m.orgInvite(invite)
+}
+
+func (m *OrgModel) orgInvite(invite *UserInvite) (*OrgInvite, error) {
+	result := &OrgInvite{UserInvite: *invite}
+	var invitedBy sql.NullInt64
+	err := m.getDB().QueryRow(`
+		SELECT oi.org_id, o.name, oi.role, oi.invited_by
+		FROM org_invites oi
+		JOIN org_accounts o ON o.id = oi.org_id
+		WHERE oi.invite_id = ?
+	`, invite.ID).Scan(&result.OrgID, &result.OrgName, &result.OrgRole, &invitedBy)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotOrgInvite
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.InvitedBy = invitedBy.Int64
+	return result, nil
+}
+
+// ListInvites returns an organization's pending invites
+func (m *OrgModel) ListInvites(orgID int64) ([]*OrgInvite, error) {
+	rows, err := m.getDB().Query(`
+		SELECT ui.code FROM org_invites oi
+		JOIN user_invites ui ON ui.id = oi.invite_id
+		WHERE oi.org_id = ? AND ui.used_at IS NULL
+		ORDER BY ui.id DESC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	rows.Close()
+
+	// GetInvite skips expired invites
+	invites := []*OrgInvite{}
+	for _, token := range tokens {
+		invite, err := m.GetInvite(token)
+		if err != nil {
+			continue
+		}
+		invites = append(invites, invite)
+	}
+	return invites, nil
+}
+
+// RevokeInvite deletes one of orgID's invites
+func (m *OrgModel) RevokeInvite(orgID, inviteID int64) error {
+	result, err := m.getDB().Exec(`
+		DELETE FROM user_invites
+		WHERE id = ? AND id IN (SELECT invite_id FROM org_invites WHERE org_id = ?)
+	`, inviteID, orgID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("invite not found")
+	}
+	_, err = m.getDB().Exec(`DELETE FROM org_invites WHERE invite_id = ?`, inviteID)
+	return err
+}
+
+// AcceptInvite adds an existing user to the invite's organization. The
+// user's email must match the address the invite was sent to.
+func (m *OrgModel) AcceptInvite(token string, user *User) (*OrgInvite, error) {
+	invite, err := m.GetInvite(token)
+	if err != nil {
+		return nil, err
+	}
+	if invite.Email != "" && !strings.EqualFold(invite.Email, user.Email) {
+		return nil, ErrOrgInviteEmail
+	}
+	if err := m.AddMember(invite.OrgID, user.ID, invite.OrgRole); err != nil {
+		return nil, err
+	}
+	if err := (&UserInviteModel{DB: m.getDB()}).MarkUsed(token, user.ID); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// JoinFromInvite adds a user who registered with inviteID to the invite's
+// organization. Invites that are not for an organization are ignored.
+func (m *OrgModel) JoinFromInvite(inviteID, userID int64) error {
+	var orgID int64
+	var role string
+	err := m.getDB().QueryRow(`SELECT org_id, role FROM org_invites WHERE invite_id = ?`, inviteID).Scan(&orgID, &role)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return m.AddMember(orgID, userID, role)
+}
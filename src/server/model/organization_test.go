@@ -0,0 +1,254 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+func createOrgTestUser(t *testing.T, db *sql.DB, username string) *User {
+	t.Helper()
+	result, err := db.Exec(`INSERT INTO user_accounts (username, email, password_hash, role) VALUES (?, ?, 'x', 'user')`,
+		username, username+"@example.com")
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	id, _ := result.LastInsertId()
+	return &User{ID: id, Username: username, Email: username + "@example.com"}
+}
+
+func TestOrgSlugFromName(t *testing.T) {
+	tests := map[string]string{
+		"Emergency Ops":        "emergency-ops",
+		"  Stadiums & Arenas ": "stadiums-arenas",
+		"--North--East--":      "north-east",
+	}
+	for name, want := range tests {
+		if got := OrgSlugFromName(name); got != want {
+			t.Errorf("OrgSlugFromName(%q) = %q, want %q", name, got, want)
+		}
+	}
+	if err := ValidateOrgSlug("ab"); err == nil {
+		t.Error("Expected a two character slug to fail")
+	}
+}
+
+func TestOrgMembers(t *testing.T) {
+	db := setupTokenDB(t, database.UsersSchema)
+	orgs := &OrgModel{DB: db}
+	owner := createOrgTestUser(t, db, "owner")
+	editor := createOrgTestUser(t, db, "editor")
+
+	org, err := orgs.Create("Emergency Ops", "", owner.ID)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if org.Slug != "emergency-ops" {
+		t.Errorf("slug = %q", org.Slug)
+	}
+	if _, err := orgs.Create("Emergency Ops", "", editor.ID); !errors.Is(err, ErrOrgSlugTaken) {
+		t.Errorf("Create duplicate = %v, want ErrOrgSlugTaken", err)
+	}
+
+	if err := orgs.AddMember(org.ID, editor.ID, OrgRoleEditor); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	if role, _ := orgs.MemberRole(org.ID, editor.ID); role != OrgRoleEditor {
+		t.Errorf("MemberRole = %q", role)
+	}
+	if err := orgs.UpdateMember(org.ID, owner.ID, OrgRoleViewer, true); !errors.Is(err, ErrLastOrgOwner) {
+		t.Errorf("demoting the last owner = %v, want ErrLastOrgOwner", err)
+	}
+	if err := orgs.RemoveMember(org.ID, owner.ID); !errors.Is(err, ErrLastOrgOwner) {
+		t.Errorf("removing the last owner = %v, want ErrLastOrgOwner", err)
+	}
+
+	// The creator starts on call; with nobody on call the owners are paged
+	onCall, err := orgs.OnCallMembers(org.ID)
+	if err != nil || len(onCall) != 1 || onCall[0].UserID != owner.ID {
+		t.Fatalf("OnCallMembers = %v, %v", onCall, err)
+	}
+	if err := orgs.UpdateMember(org.ID, owner.ID, OrgRoleOwner, false); err != nil {
+		t.Fatalf("UpdateMember: %v", err)
+	}
+	if err := orgs.UpdateMember(org.ID, editor.ID, OrgRoleEditor, true); err != nil {
+		t.Fatalf("UpdateMember: %v", err)
+	}
+	if onCall, _ := orgs.OnCallMembers(org.ID); len(onCall) != 1 || onCall[0].UserID != editor.ID {
+		t.Errorf("OnCallMembers = %v, want the editor", onCall)
+	}
+	if err := orgs.UpdateMember(org.ID, editor.ID, OrgRoleEditor, false); err != nil {
+		t.Fatalf("UpdateMember: %v", err)
+	}
+	if onCall, _ := orgs.OnCallMembers(org.ID); len(onCall) != 1 || onCall[0].UserID != owner.ID {
+		t.Errorf("OnCallMembers with nobody on call = %v, want the owner", onCall)
+	}
+
+	if list, _ := orgs.ListForUser(editor.ID); len(list) != 1 || list[0].Role != OrgRoleEditor {
+		t.Errorf("ListForUser = %v", list)
+	}
+	if err := orgs.Delete(org.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := orgs.MemberRole(org.ID, editor.ID); !errors.Is(err, ErrNotOrgMember) {
+		t.Errorf("MemberRole after delete = %v", err)
+	}
+}
+
+func TestOrgInvites(t *testing.T) {
+	db := setupTokenDB(t, database.UsersSchema)
+	orgs := &OrgModel{DB: db}
+	owner := createOrgTestUser(t, db, "owner")
+	invitee := createOrgTestUser(t, db, "invitee")
+	other := createOrgTestUser(t, db, "other")
+
+	org, err := orgs.Create("Stadiums", "", owner.ID)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	invite, err := orgs.CreateInvite(org.ID, invitee.Email, OrgRoleEditor, owner.ID, 7)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	if pending, _ := orgs.ListInvites(org.ID); len(pending) != 1 || pending[0].OrgRole != OrgRoleEditor {
+		t.Errorf("ListInvites = %v", pending)
+	}
+
+	if _, err := orgs.AcceptInvite(invite.Token, other); !errors.Is(err, ErrOrgInviteEmail) {
+		t.Errorf("AcceptInvite by another user = %v, want ErrOrgInviteEmail", err)
+	}
+	if _, err := orgs.AcceptInvite(invite.Token, invitee); err != nil {
+		t.Fatalf("AcceptInvite: %v", err)
+	}
+	if role, _ := orgs.MemberRole(org.ID, invitee.ID); role != OrgRoleEditor {
+		t.Errorf("invitee role = %q", role)
+	}
+	if _, err := orgs.AcceptInvite(invite.Token, invitee); err == nil {
+		t.Error("Expected a used invite to fail")
+	}
+
+	// Plain user invites are not organization invites
+	plain, err := (&UserInviteModel{DB: db}).CreateInvite("", "plain@example.com", RoleUser, 7)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	if _, err := orgs.GetInvite(plain.Token); !errors.Is(err, ErrNotOrgInvite) {
+		t.Errorf("GetInvite(plain) = %v, want ErrNotOrgInvite", err)
+	}
+	if err := orgs.JoinFromInvite(plain.ID, other.ID); err != nil {
+		t.Errorf("JoinFromInvite(plain) = %v", err)
+	}
+
+	// New accounts registered with an org invite join the organization
+	registration, err := orgs.CreateInvite(org.ID, "new@example.com", OrgRoleViewer, owner.ID, 7)
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	newcomer := createOrgTestUser(t, db, "new")
+	if err := orgs.JoinFromInvite(registration.ID, newcomer.ID); err != nil {
+		t.Fatalf("JoinFromInvite: %v", err)
+	}
+	if role, _ := orgs.MemberRole(org.ID, newcomer.ID); role != OrgRoleViewer {
+		t.Errorf("newcomer role = %q", role)
+	}
+}
+
+func TestOrgSubscriptionsAndChannels(t *testing.T) {
+	db := setupTokenDB(t, database.UsersSchema)
+	owner := createOrgTestUser(t, db, "owner")
+	org, err := (&OrgModel{DB: db}).Create("Warehouses", "", owner.ID)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	alerts := &OrgAlertModel{DB: db}
+
+	north, err := alerts.CreateLocation(org.ID, "North depot", 41.88, -87.63, "")
+	if err != nil {
+		t.Fatalf("CreateLocation: %v", err)
+	}
+	south, _ := alerts.CreateLocation(org.ID, "South depot", 29.76, -95.37, "")
+
+	if _, err := alerts.CreateSubscription(&OrgSubscription{OrgID: org.ID, AlertType: "High Winds", MinSeverity: "high", Enabled: true}); err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	if _, err := alerts.CreateSubscription(&OrgSubscription{OrgID: org.ID, LocationID: north.ID, Enabled: true}); err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	if _, err := alerts.CreateSubscription(&OrgSubscription{OrgID: org.ID, MinSeverity: "extreme"}); err == nil {
+		t.Error("Expected an unknown severity to fail")
+	}
+	if _, err := alerts.CreateSubscription(&OrgSubscription{OrgID: org.ID, LocationID: 9999}); err == nil {
+		t.Error("Expected an unknown location to fail")
+	}
+
+	tests := []struct {
+		location  int64
+		alertType string
+		severity  string
+		want      bool
+	}{
+		{south.ID, "High Winds", "high", true},
+		{south.ID, "High Winds", "medium", false},
+		{south.ID, "Heavy Snow", "high", false},
+		{north.ID, "Heavy Snow", "medium", true},
+	}
+	for _, tt := range tests {
+		got, err := alerts.Subscribed(org.ID, tt.location, tt.alertType, tt.severity)
+		if err != nil || got != tt.want {
+			t.Errorf("Subscribed(%d, %s, %s) = %v, %v; want %v", tt.location, tt.alertType, tt.severity, got, err, tt.want)
+		}
+	}
+
+	if _, err := alerts.CreateChannel(&OrgChannel{OrgID: org.ID, ChannelType: "webhook", Route: OrgRouteAddress}); err == nil {
+		t.Error("Expected an address route without an address to fail")
+	}
+	channel, err := alerts.CreateChannel(&OrgChannel{OrgID: org.ID, ChannelType: "email", Enabled: true})
+	if err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+	if channel.Route != OrgRouteOnCall {
+		t.Errorf("default route = %q", channel.Route)
+	}
+	if enabled, _ := alerts.EnabledChannels(org.ID); len(enabled) != 1 {
+		t.Errorf("EnabledChannels = %v", enabled)
+	}
+
+	if alerts.HasRecentAlert(org.ID, north.ID, "Heavy Snow", 6*time.Hour) {
+		t.Error("Expected no recent alert")
+	}
+	if err := alerts.RecordAlertSent(org.ID, north.ID, "Heavy Snow"); err != nil {
+		t.Fatalf("RecordAlertSent: %v", err)
+	}
+	if !alerts.HasRecentAlert(org.ID, north.ID, "Heavy Snow", 6*time.Hour) {
+		t.Error("Expected a recent alert")
+	}
+}
+
+func TestOrgTokens(t *testing.T) {
+	db := setupTokenDB(t, database.UsersSchema)
+	tokens := &TokenModelV2{DB: db}
+
+	created, err := tokens.CreateToken(OwnerTypeOrg, 3, "dashboard", ScopeLocationsRead, 0)
+	if err != nil {
+		t.Fatalf("CreateToken: %v", err)
+	}
+	if len(created.Token) != len(PrefixOrg)+32 || created.Token[:len(PrefixOrg)] != PrefixOrg {
+		t.Errorf("token = %q, want an org_ token", created.Token)
+	}
+	validated, err := tokens.ValidateToken(created.Token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if validated.OwnerType != OwnerTypeOrg || validated.OwnerID != 3 || validated.HasScope(ScopeLocationsWrite) {
+		t.Errorf("validated = %+v", validated)
+	}
+	if err := (&TokenUsageModel{DB: db}).Record(validated, "GET /api/v1/orgs/:org_id/locations", false, created.CreatedAt); err != nil {
+		t.Errorf("Record: %v", err)
+	}
+	if _, err := tokens.CreateToken(OwnerTypeOrg, 3, "admin", ScopeAdminRead, 0); err == nil {
+		t.Error("Expected admin scopes to be rejected for org tokens")
+	}
+}
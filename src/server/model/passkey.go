@@ -41,68 +41,6 @@ func (m *UserPasskeyModel) getDB() *sql.DB {
 	return database.GetUsersDB()
 }
 
-func (m *UserPasskeyModel) ensurePasskeySchema() error {
-	rows, err := m.getDB().Query(`PRAGMA table_info(user_passkeys)`)
-	if err != nil {
-		return fmt.Errorf("failed to inspect user_passkeys schema: %w", err)
-	}
-	defer rows.Close()
-
-	hasTransport := false
-	hasAttestationType := false
-	hasBackupEligible := false
-	hasBackupState := false
-
-	for rows.Next() {
-		var cid int
-		var name string
-		var columnType string
-		var notNull int
-		var defaultValue sql.NullString
-		var pk int
-		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
-			return fmt.Errorf("failed to scan user_passkeys schema: %w", err)
-		}
-
-		switch name {
-		case "transport":
-			hasTransport = true
-		case "attestation_type":
-			hasAttestationType = true
-		case "backup_eligible":
-			hasBackupEligible = true
-		case "backup_state":
-			hasBackupState = true
-		}
-	}
-
-	if !hasTransport {
-		if _, err := m.getDB().Exec(`ALTER TABLE user_passkeys ADD COLUMN transport TEXT NOT NULL DEFAULT '[]'`); err != nil {
-			return fmt.Errorf("failed to add user_passkeys.transport: %w", err)
-		}
-	}
-
-	if !hasAttestationType {
-		if _, err := m.getDB().Exec(`ALTER TABLE user_passkeys ADD COLUMN attestation_type TEXT NOT NULL DEFAULT ''`); err != nil {
-			return fmt.Errorf("failed to add user_passkeys.attestation_type: %w", err)
-		}
-	}
-
-	if !hasBackupEligible {
-		if _, err := m.getDB().Exec(`ALTER TABLE user_passkeys ADD COLUMN backup_eligible BOOLEAN NOT NULL DEFAULT 0`); err != nil {
-			return fmt.Errorf("failed to add user_passkeys.backup_eligible: %w", err)
-		}
-	}
-
-	if !hasBackupState {
-		if _, err := m.getDB().Exec(`ALTER TABLE user_passkeys ADD COLUMN backup_state BOOLEAN NOT NULL DEFAULT 0`); err != nil {
-			return fmt.Errorf("failed to add user_passkeys.backup_state: %w", err)
-		}
-	}
-
-	return nil
-}
-
 func encodePasskeyBytes(data []byte) string {
 	return base64.RawURLEncoding.EncodeToString(data)
 }
@@ -159,7 +97,21 @@ func unmarshalPasskeyTransport(raw string) ([]protocol.AuthenticatorTransport, e
 	return transports, nil
 }
 
-func (m *UserPasskeyModel) scanPasskey(rowScanner interface {
+// passkeyStore holds the queries shared by user and admin passkeys; the
+// tables differ only in name and owner column
+type passkeyStore struct {
+	db    *sql.DB
+	table string
+	owner string
+}
+
+func (s passkeyStore) columns() string {
+	return s.owner + `, credential_id, public_key, COALESCE(aaguid, ''), sign_count, name,
+		       COALESCE(transport, '[]'), COALESCE(attestation_type, ''), backup_eligible, backup_state,
+		       created_at, last_used_at`
+}
+
+func scanPasskey(rowScanner interface {
 	Scan(dest ...interface{}) error
 }) (*UserPasskey, error) {
 	var (
@@ -198,19 +150,13 @@ func (m *UserPasskeyModel) scanPasskey(rowScanner interface {
 	return &passkey, nil
 }
 
-func (m *UserPasskeyModel) ListByUserID(userID int64) ([]*UserPasskey, error) {
-	if err := m.ensurePasskeySchema(); err != nil {
-		return nil, err
-	}
-
-	rows, err := m.getDB().Query(`
-		SELECT id, user_id, credential_id, public_key, COALESCE(aaguid, ''), sign_count, name,
-		       COALESCE(transport, '[]'), COALESCE(attestation_type, ''), backup_eligible, backup_state,
-		       created_at, last_used_at
-		FROM user_passkeys
-		WHERE user_id = ?
+func (s passkeyStore) list(ownerID int64) ([]*UserPasskey, error) {
+	rows, err := s.db.Query(`
+		SELECT id, `+s.columns()+`
+		FROM `+s.table+`
+		WHERE `+s.owner+` = ?
 		ORDER BY created_at ASC, id ASC
-	`, userID)
+	`, ownerID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query passkeys: %w", err)
 	}
@@ -218,7 +164,7 @@ func (m *UserPasskeyModel) ListByUserID(userID int64) ([]*UserPasskey, error) {
 
 	passkeys := make([]*UserPasskey, 0)
 	for rows.Next() {
-		passkey, err := m.scanPasskey(rows)
+		passkey, err := scanPasskey(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan passkey: %w", err)
 		}
@@ -228,30 +174,17 @@ func (m *UserPasskeyModel) ListByUserID(userID int64) ([]*UserPasskey, error) {
 	return passkeys, nil
 }
 
-func (m *UserPasskeyModel) CountByUserID(userID int64) (int, error) {
-	if err := m.ensurePasskeySchema(); err != nil {
-		return 0, err
-	}
-
+func (s passkeyStore) count(ownerID int64) (int, error) {
 	var count int
-	if err := m.getDB().QueryRow(`SELECT COUNT(*) FROM user_passkeys WHERE user_id = ?`, userID).Scan(&count); err != nil {
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM `+s.table+` WHERE `+s.owner+` = ?`, ownerID).Scan(&count); err != nil {
 		return 0, fmt.Errorf("failed to count passkeys: %w", err)
 	}
 
 	return count, nil
 }
 
-func (m *UserPasskeyModel) HasPasskeys(userID int64) (bool, error) {
-	count, err := m.CountByUserID(userID)
-	if err != nil {
-		return false, err
-	}
-
-	return count > 0, nil
-}
-
-func (m *UserPasskeyModel) ListCredentialsByUserID(userID int64) ([]webauthn.Credential, error) {
-	passkeys, err := m.ListByUserID(userID)
+func (s passkeyStore) credentials(ownerID int64) ([]webauthn.Credential, error) {
+	passkeys, err := s.list(ownerID)
 	if err != nil {
 		return nil, err
 	}
@@ -294,24 +227,20 @@ func (m *UserPasskeyModel) ListCredentialsByUserID(userID int64) ([]webauthn.Cre
 	return credentials, nil
 }
 
-func (m *UserPasskeyModel) Create(userID int64, name string, credential *webauthn.Credential) (*UserPasskey, error) {
-	if err := m.ensurePasskeySchema(); err != nil {
-		return nil, err
-	}
-
+func (s passkeyStore) create(ownerID int64, name string, credential *webauthn.Credential) (*UserPasskey, error) {
 	transportJSON, err := marshalPasskeyTransport(credential.Transport)
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := m.getDB().Exec(`
-		INSERT INTO user_passkeys (
-			user_id, credential_id, public_key, aaguid, sign_count, name, transport,
+	result, err := s.db.Exec(`
+		INSERT INTO `+s.table+` (
+			`+s.owner+`, credential_id, public_key, aaguid, sign_count, name, transport,
 			attestation_type, backup_eligible, backup_state, created_at, last_used_at
 		)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, NULL)
 	`,
-		userID,
+		ownerID,
 		encodePasskeyBytes(credential.ID),
 		encodePasskeyBytes(credential.PublicKey),
 		encodePasskeyBytes(credential.Authenticator.AAGUID),
@@ -331,15 +260,13 @@ func (m *UserPasskeyModel) Create(userID int64, name string, credential *webauth
 		return nil, fmt.Errorf("failed to load passkey id: %w", err)
 	}
 
-	row := m.getDB().QueryRow(`
-		SELECT id, user_id, credential_id, public_key, COALESCE(aaguid, ''), sign_count, name,
-		       COALESCE(transport, '[]'), COALESCE(attestation_type, ''), backup_eligible, backup_state,
-		       created_at, last_used_at
-		FROM user_passkeys
+	row := s.db.QueryRow(`
+		SELECT id, `+s.columns()+`
+		FROM `+s.table+`
 		WHERE id = ?
 	`, id)
 
-	passkey, err := m.scanPasskey(row)
+	passkey, err := scanPasskey(row)
 	if err != nil {
 		return nil, fmt.Errorf("failed to reload passkey: %w", err)
 	}
@@ -347,21 +274,17 @@ func (m *UserPasskeyModel) Create(userID int64, name string, credential *webauth
 	return passkey, nil
 }
 
-func (m *UserPasskeyModel) UpdateCredential(userID int64, credential *webauthn.Credential) error {
-	if err := m.ensurePasskeySchema(); err != nil {
-		return err
-	}
-
+func (s passkeyStore) updateCredential(ownerID int64, credential *webauthn.Credential) error {
 	transportJSON, err := marshalPasskeyTransport(credential.Transport)
 	if err != nil {
 		return err
 	}
 
-	result, err := m.getDB().Exec(`
-		UPDATE user_passkeys
+	result, err := s.db.Exec(`
+		UPDATE `+s.table+`
 		SET sign_count = ?, last_used_at = CURRENT_TIMESTAMP, transport = ?, attestation_type = ?,
 		    backup_eligible = ?, backup_state = ?, aaguid = ?
-		WHERE user_id = ? AND credential_id = ?
+		WHERE `+s.owner+` = ? AND credential_id = ?
 	`,
 		credential.Authenticator.SignCount,
 		transportJSON,
@@ -369,7 +292,7 @@ func (m *UserPasskeyModel) UpdateCredential(userID int64, credential *webauthn.C
 		credential.Flags.BackupEligible,
 		credential.Flags.BackupState,
 		encodePasskeyBytes(credential.Authenticator.AAGUID),
-		userID,
+		ownerID,
 		encodePasskeyBytes(credential.ID),
 	)
 	if err != nil {
@@ -387,12 +310,8 @@ func (m *UserPasskeyModel) UpdateCredential(userID int64, credential *webauthn.C
 	return nil
 }
 
-func (m *UserPasskeyModel) DeleteByID(userID int64, passkeyID int64) error {
-	if err := m.ensurePasskeySchema(); err != nil {
-		return err
-	}
-
-	result, err := m.getDB().Exec(`DELETE FROM user_passkeys WHERE id = ? AND user_id = ?`, passkeyID, userID)
+func (s passkeyStore) delete(ownerID int64, passkeyID int64) error {
+	result, err := s.db.Exec(`DELETE FROM `+s.table+` WHERE id = ? AND `+s.owner+` = ?`, passkeyID, ownerID)
 	if err != nil {
 		return fmt.Errorf("failed to delete passkey: %w", err)
 	}
@@ -407,3 +326,114 @@ func (m *UserPasskeyModel) DeleteByID(userID int64, passkeyID int64) error {
 
 	return nil
 }
+
+func (m *UserPasskeyModel) store() passkeyStore {
+	return passkeyStore{db: m.getDB(), table: "user_passkeys", owner: "user_id"}
+}
+
+func (m *UserPasskeyModel) ListByUserID(userID int64) ([]*UserPasskey, error) {
+	return m.store().list(userID)
+}
+
+func (m *UserPasskeyModel) CountByUserID(userID int64) (int, error) {
+	return m.store().count(userID)
+}
+
+func (m *UserPasskeyModel) HasPasskeys(userID int64) (bool, error) {
+	count, err := m.CountByUserID(userID)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (m *UserPasskeyModel) ListCredentialsByUserID(userID int64) ([]webauthn.Credential, error) {
+	return m.store().credentials(userID)
+}
+
+func (m *UserPasskeyModel) Create(userID int64, name string, credential *webauthn.Credential) (*UserPasskey, error) {
+	return m.store().create(userID, name, credential)
+}
+
+func (m *UserPasskeyModel) UpdateCredential(userID int64, credential *webauthn.Credential) error {
+	return m.store().updateCredential(userID, credential)
+}
+
+func (m *UserPasskeyModel) DeleteByID(userID int64, passkeyID int64) error {
+	return m.store().delete(userID, passkeyID)
+}
+
+// SetUserHandle records the WebAuthn user handle of an account created with
+// a passkey
+func (m *UserPasskeyModel) SetUserHandle(userID int64, handle []byte) error {
+	_, err := m.getDB().Exec(`INSERT INTO user_passkey_handles (user_id, handle) VALUES (?, ?)`,
+		userID, encodePasskeyBytes(handle))
+	if err != nil {
+		return fmt.Errorf("failed to store passkey user handle: %w", err)
+	}
+	return nil
+}
+
+// GetUserHandle returns the stored WebAuthn user handle, or nil when the
+// account uses the default handle derived from its id
+func (m *UserPasskeyModel) GetUserHandle(userID int64) ([]byte, error) {
+	var handle string
+	err := m.getDB().QueryRow(`SELECT handle FROM user_passkey_handles WHERE user_id = ?`, userID).Scan(&handle)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load passkey user handle: %w", err)
+	}
+	return decodePasskeyBytes(handle)
+}
+
+// UserIDForHandle resolves a stored WebAuthn user handle to its account
+func (m *UserPasskeyModel) UserIDForHandle(handle []byte) (int64, error) {
+	var userID int64
+	err := m.getDB().QueryRow(`SELECT user_id FROM user_passkey_handles WHERE handle = ?`,
+		encodePasskeyBytes(handle)).Scan(&userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user handle")
+	}
+	return userID, nil
+}
+
+// AdminPasskeyModel stores admin passkeys in server.db. Records reuse the
+// UserPasskey type; UserID holds the admin id.
+type AdminPasskeyModel struct {
+	DB *sql.DB
+}
+
+func (m *AdminPasskeyModel) store() passkeyStore {
+	db := m.DB
+	if db == nil {
+		db = database.GetServerDB()
+	}
+	return passkeyStore{db: db, table: "server_admin_passkeys", owner: "admin_id"}
+}
+
+func (m *AdminPasskeyModel) ListByAdminID(adminID int64) ([]*UserPasskey, error) {
+	return m.store().list(adminID)
+}
+
+func (m *AdminPasskeyModel) CountByAdminID(adminID int64) (int, error) {
+	return m.store().count(adminID)
+}
+
+func (m *AdminPasskeyModel) ListCredentialsByAdminID(adminID int64) ([]webauthn.Credential, error) {
+	return m.store().credentials(adminID)
+}
+
+func (m *AdminPasskeyModel) Create(adminID int64, name string, credential *webauthn.Credential) (*UserPasskey, error) {
+	return m.store().create(adminID, name, credential)
+}
+
+func (m *AdminPasskeyModel) UpdateCredential(adminID int64, credential *webauthn.Credential) error {
+	return m.store().updateCredential(adminID, credential)
+}
+
+func (m *AdminPasskeyModel) DeleteByID(adminID int64, passkeyID int64) error {
+	return m.store().delete(adminID, passkeyID)
+}
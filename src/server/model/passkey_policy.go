@@ -0,0 +1,114 @@
+package models
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/apimgr/weather/src/database"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// Attestation conveyance values for security.passkey_attestation
+const (
+	PasskeyAttestationNone     = "none"
+	PasskeyAttestationIndirect = "indirect"
+	PasskeyAttestationDirect   = "direct"
+)
+
+// ErrPasskeyAttestation is returned when a new passkey does not satisfy the
+// attestation policy
+var ErrPasskeyAttestation = errors.New("passkey does not meet the attestation policy")
+
+// PasskeyPolicy controls which authenticators may register passkeys
+type PasskeyPolicy struct {
+	// Attestation is none, indirect or direct
+	Attestation string
+	// AllowedAAGUIDs lists authenticator models allowed to register, as
+	// lowercase UUIDs; empty allows any
+	AllowedAAGUIDs []string
+	// PasswordlessSignup allows new accounts with a passkey and no password
+	PasswordlessSignup bool
+}
+
+// DefaultPasskeyPolicy requests no attestation and accepts any authenticator
+func DefaultPasskeyPolicy() PasskeyPolicy {
+	return PasskeyPolicy{Attestation: PasskeyAttestationNone, PasswordlessSignup: true}
+}
+
+// LoadPasskeyPolicy reads the policy from the security.passkey_* settings
+func LoadPasskeyPolicy() PasskeyPolicy {
+	policy := DefaultPasskeyPolicy()
+	if database.GetServerDB() == nil {
+		return policy
+	}
+
+	settings := &SettingsModel{}
+	policy.Attestation = normalizePasskeyAttestation(settings.GetString("security.passkey_attestation", policy.Attestation))
+	policy.AllowedAAGUIDs = ParseAAGUIDList(settings.GetString("security.passkey_aaguids", ""))
+	policy.PasswordlessSignup = settings.GetBool("security.passwordless_registration", policy.PasswordlessSignup)
+	return policy
+}
+
+func normalizePasskeyAttestation(value string) string {
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case PasskeyAttestationIndirect, PasskeyAttestationDirect:
+		return value
+	default:
+		return PasskeyAttestationNone
+	}
+}
+
+// ParseAAGUIDList parses a comma-separated AAGUID list, skipping entries that
+// are not UUIDs
+func ParseAAGUIDList(raw string) []string {
+	var aaguids []string
+	for _, entry := range strings.Split(raw, ",") {
+		parsed, err := uuid.Parse(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		aaguids = append(aaguids, parsed.String())
+	}
+	return aaguids
+}
+
+// Conveyance returns the attestation preference sent to authenticators
+func (p PasskeyPolicy) Conveyance() protocol.ConveyancePreference {
+	switch p.Attestation {
+	case PasskeyAttestationIndirect:
+		return protocol.PreferIndirectAttestation
+	case PasskeyAttestationDirect:
+		return protocol.PreferDirectAttestation
+	default:
+		return protocol.PreferNoAttestation
+	}
+}
+
+// Check verifies a newly registered credential against the policy. Direct
+// attestation requires the authenticator to have attested; an AAGUID
+// allowlist rejects authenticators that report no AAGUID.
+func (p PasskeyPolicy) Check(credential *webauthn.Credential) error {
+	if p.Attestation == PasskeyAttestationDirect {
+		if credential.AttestationType == "" || credential.AttestationType == "none" {
+			return ErrPasskeyAttestation
+		}
+	}
+
+	if len(p.AllowedAAGUIDs) == 0 {
+		return nil
+	}
+
+	aaguid, err := uuid.FromBytes(credential.Authenticator.AAGUID)
+	if err != nil || aaguid == uuid.Nil {
+		return ErrPasskeyAttestation
+	}
+	for _, allowed := range p.AllowedAAGUIDs {
+		if allowed == aaguid.String() {
+			return nil
+		}
+	}
+	return ErrPasskeyAttestation
+}
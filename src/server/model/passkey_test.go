@@ -0,0 +1,154 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/apimgr/weather/src/database"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+const yubikeyAAGUID = "cb69481e-8ff7-4039-93ec-0a2729a154a8"
+
+func testCredential(id string, aaguid string, attestation string) *webauthn.Credential {
+	credential := &webauthn.Credential{
+		ID:              []byte(id),
+		PublicKey:       []byte("public-key-" + id),
+		AttestationType: attestation,
+		Transport:       []protocol.AuthenticatorTransport{protocol.USB},
+	}
+	if aaguid != "" {
+		parsed := uuid.MustParse(aaguid)
+		credential.Authenticator.AAGUID = parsed[:]
+	}
+	return credential
+}
+
+func TestParseAAGUIDList(t *testing.T) {
+	got := ParseAAGUIDList(" CB69481E-8FF7-4039-93EC-0A2729A154A8 , not-a-uuid,, ee882879-721c-4913-9775-3dfcce97072a")
+	want := []string{yubikeyAAGUID, "ee882879-721c-4913-9775-3dfcce97072a"}
+	if len(got) != len(want) {
+		t.Fatalf("ParseAAGUIDList = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ParseAAGUIDList[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPasskeyPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     PasskeyPolicy
+		credential *webauthn.Credential
+		wantErr    bool
+	}{
+		{"default accepts anything", DefaultPasskeyPolicy(), testCredential("a", "", "none"), false},
+		{"direct rejects none", PasskeyPolicy{Attestation: PasskeyAttestationDirect}, testCredential("a", yubikeyAAGUID, "none"), true},
+		{"direct accepts packed", PasskeyPolicy{Attestation: PasskeyAttestationDirect}, testCredential("a", yubikeyAAGUID, "packed"), false},
+		{"indirect accepts none", PasskeyPolicy{Attestation: PasskeyAttestationIndirect}, testCredential("a", "", "none"), false},
+		{"allowlist accepts listed", PasskeyPolicy{AllowedAAGUIDs: []string{yubikeyAAGUID}}, testCredential("a", yubikeyAAGUID, "packed"), false},
+		{"allowlist rejects unlisted", PasskeyPolicy{AllowedAAGUIDs: []string{yubikeyAAGUID}}, testCredential("a", "ee882879-721c-4913-9775-3dfcce97072a", "packed"), true},
+		{"allowlist rejects zero aaguid", PasskeyPolicy{AllowedAAGUIDs: []string{yubikeyAAGUID}}, testCredential("a", uuid.Nil.String(), "none"), true},
+		{"allowlist rejects missing aaguid", PasskeyPolicy{AllowedAAGUIDs: []string{yubikeyAAGUID}}, testCredential("a", "", "none"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.credential)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := (PasskeyPolicy{Attestation: PasskeyAttestationDirect}).Conveyance(); got != protocol.PreferDirectAttestation {
+		t.Errorf("Conveyance() = %q, want direct", got)
+	}
+	if got := normalizePasskeyAttestation("Enterprise"); got != PasskeyAttestationNone {
+		t.Errorf("normalizePasskeyAttestation(unknown) = %q, want none", got)
+	}
+}
+
+func TestAdminPasskeyModel(t *testing.T) {
+	db := setupTokenDB(t, database.ServerSchema)
+	m := &AdminPasskeyModel{DB: db}
+
+	first, err := m.Create(3, "YubiKey", testCredential("cred-1", yubikeyAAGUID, "packed"))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if first.UserID != 3 || first.Name != "YubiKey" {
+		t.Fatalf("Create = %+v", first)
+	}
+	if _, err := m.Create(3, "Duplicate", testCredential("cred-1", "", "none")); err == nil {
+		t.Fatal("Expected a duplicate credential id to fail")
+	}
+	if _, err := m.Create(4, "Other admin", testCredential("cred-2", "", "none")); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	credentials, err := m.ListCredentialsByAdminID(3)
+	if err != nil || len(credentials) != 1 {
+		t.Fatalf("ListCredentialsByAdminID = %d, %v; want 1", len(credentials), err)
+	}
+	if string(credentials[0].ID) != "cred-1" || credentials[0].Transport[0] != protocol.USB {
+		t.Errorf("Credential = %+v", credentials[0])
+	}
+
+	credentials[0].Authenticator.SignCount = 9
+	if err := m.UpdateCredential(3, &credentials[0]); err != nil {
+		t.Fatalf("UpdateCredential: %v", err)
+	}
+	if err := m.UpdateCredential(4, &credentials[0]); err == nil {
+		t.Error("Expected another admin's credential update to fail")
+	}
+	passkeys, _ := m.ListByAdminID(3)
+	if passkeys[0].SignCount != 9 || passkeys[0].LastUsedAt == nil {
+		t.Errorf("After update = %+v", passkeys[0])
+	}
+
+	if err := m.DeleteByID(4, first.ID); err == nil {
+		t.Error("Expected deleting another admin's passkey to fail")
+	}
+	if err := m.DeleteByID(3, first.ID); err != nil {
+		t.Fatalf("DeleteByID: %v", err)
+	}
+	if count, _ := m.CountByAdminID(3); count != 0 {
+		t.Errorf("CountByAdminID after delete = %d, want 0", count)
+	}
+}
+
+func TestPasskeyUserHandles(t *testing.T) {
+	db := setupTokenDB(t, database.UsersSchema)
+	if _, err := db.Exec(`INSERT INTO user_accounts (id, username, email, password_hash, role) VALUES (5, 'jane', 'jane@example.org', '', 'user')`); err != nil {
+		t.Fatal(err)
+	}
+	m := &UserPasskeyModel{DB: db}
+
+	if handle, err := m.GetUserHandle(5); err != nil || handle != nil {
+		t.Fatalf("GetUserHandle before set = %v, %v; want nil", handle, err)
+	}
+
+	handle := []byte{0x01, 0xfe, 0x42, 0x00, 0x99}
+	if err := m.SetUserHandle(5, handle); err != nil {
+		t.Fatalf("SetUserHandle: %v", err)
+	}
+	got, err := m.GetUserHandle(5)
+	if err != nil || string(got) != string(handle) {
+		t.Fatalf("GetUserHandle = %v, %v; want %v", got, err, handle)
+	}
+	if userID, err := m.UserIDForHandle(handle); err != nil || userID != 5 {
+		t.Fatalf("UserIDForHandle = %d, %v; want 5", userID, err)
+	}
+	if _, err := m.UserIDForHandle([]byte("usr:5")); err == nil {
+		t.Error("Expected an unknown handle to fail")
+	}
+
+	if !(&User{PasswordHash: "$argon2id$..."}).HasPassword() || (&User{}).HasPassword() {
+		t.Error("HasPassword should follow the password hash")
+	}
+}
@@ -0,0 +1,589 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+// Admin permissions use the resource.action form. Read permissions cover
+// GET requests; the others cover changes.
+const (
+	PermUsersRead         = "users.read"
+	PermUsersWrite        = "users.write"
+	PermAdminsRead        = "admins.read"
+	PermAdminsWrite       = "admins.write"
+	PermRolesRead         = "roles.read"
+	PermRolesWrite        = "roles.write"
+	PermSettingsRead      = "settings.read"
+	PermSettingsWrite     = "settings.write"
+	PermSecurityRead      = "security.read"
+	PermSecurityWrite     = "security.write"
+	PermBackupRead        = "backup.read"
+	PermBackupRun         = "backup.run"
+	PermBackupRestore     = "backup.restore"
+	PermChannelsRead      = "channels.read"
+	PermChannelsManage    = "channels.manage"
+	PermNotificationsSend = "notifications.send"
+	PermLogsRead          = "logs.read"
+	PermLogsWrite         = "logs.write"
+	PermSystemRead        = "system.read"
+	PermSystemManage      = "system.manage"
+)
+
+// PermissionInfo describes a permission for role management pages
+type PermissionInfo struct {
+	Permission  string `json:"permission"`
+	Description string `json:"description"`
+}
+
+// PermissionCatalog lists every permission in display order
+var PermissionCatalog = []PermissionInfo{
+	{PermUsersRead, "List users and user invites"},
+	{PermUsersWrite, "Update, delete, unlock and invite users"},
+	{PermAdminsRead, "List server admins"},
+	{PermAdminsWrite, "Invite, disable, enable and delete server admins"},
+	{PermRolesRead, "List roles and preview what they can access"},
+	{PermRolesWrite, "Create, edit and delete roles and assign them"},
+	{PermSettingsRead, "Read server settings, branding, pages and setup"},
+	{PermSettingsWrite, "Change server settings, branding, pages and setup"},
+	{PermSecurityRead, "Read authentication, SSL and Tor settings, admin tokens, blocklists and persisted queries"},
+	{PermSecurityWrite, "Change authentication, SSL and Tor settings, admin tokens, blocklists and persisted queries"},
+	{PermBackupRead, "List and download backups"},
+	{PermBackupRun, "Create and delete backups"},
+	{PermBackupRestore, "Restore a backup"},
+	{PermChannelsRead, "Read notification channels, templates and email settings"},
+	{PermChannelsManage, "Configure and test notification channels, templates and email"},
+	{PermNotificationsSend, "Send notifications"},
+	{PermLogsRead, "Read, search and download server and audit logs"},
+	{PermLogsWrite, "Clear and rotate logs and change logging formats"},
+	{PermSystemRead, "Read status, statistics, metrics, scheduler and cluster state"},
+	{PermSystemManage, "Restart, reload, run tasks and maintain the database and cache"},
+}
+
+// Built-in roles cannot be edited or deleted
+const (
+	RoleSuperAdmin = "super_admin"
+	RoleAdmin      = "admin"
+	RoleOperator   = "operator"
+	RoleViewer     = "viewer"
+	RoleUser       = "user"
+)
+
+var (
+	ErrRoleNotFound = errors.New("role not found")
+	ErrRoleExists   = errors.New("role already exists")
+	ErrRoleBuiltIn  = errors.New("built-in roles cannot be changed")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// Role is a named set of permissions
+type Role struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Permissions []string   `json:"permissions"`
+	BuiltIn     bool       `json:"built_in"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// PermissionSet is the union of permissions from one or more roles
+type PermissionSet map[string]bool
+
+// Has reports whether the set grants permission; the empty permission is
+// granted to everyone
+func (s PermissionSet) Has(permission string) bool {
+	return permission == "" || s[permission]
+}
+
+// Covers reports whether every permission in list is in the set
+func (s PermissionSet) Covers(list []string) bool {
+	for _, permission := range list {
+		if !s.Has(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// List returns the permissions in catalog order
+func (s PermissionSet) List() []string {
+	list := make([]string, 0, len(s))
+	for _, info := range PermissionCatalog {
+		if s[info.Permission] {
+			list = append(list, info.Permission)
+		}
+	}
+	return list
+}
+
+func allPermissions() []string {
+	list := make([]string, 0, len(PermissionCatalog))
+	for _, info := range PermissionCatalog {
+		list = append(list, info.Permission)
+	}
+	return list
+}
+
+func readPermissions() []string {
+	var list []string
+	for _, info := range PermissionCatalog {
+		if strings.HasSuffix(info.Permission, ".read") {
+			list = append(list, info.Permission)
+		}
+	}
+	return list
+}
+
+// BuiltInRoles returns the roles every server has. The admin role is what
+// admins without an assignment get, so existing admins keep full access.
+func BuiltInRoles() []Role {
+	operator := append(readPermissions(), PermBackupRun, PermChannelsManage, PermNotificationsSend, PermSystemManage)
+	return []Role{
+		{Name: RoleSuperAdmin, Description: "Every permission; held by super admins", Permissions: allPermissions(), BuiltIn: true},
+		{Name: RoleAdmin, Description: "Every permission; the default for admins", Permissions: allPermissions(), BuiltIn: true},
+		{Name: RoleOperator, Description: "Read everything, run backups and tasks, manage notifications", Permissions: NewPermissionSet(operator).List(), BuiltIn: true},
+		{Name: RoleViewer, Description: "Read-only access to the admin API", Permissions: readPermissions(), BuiltIn: true},
+		{Name: RoleUser, Description: "No admin access; the default for users", Permissions: []string{}, BuiltIn: true},
+	}
+}
+
+func builtInRole(name string) (Role, bool) {
+	for _, role := range BuiltInRoles() {
+		if role.Name == name {
+			return role, true
+		}
+	}
+	return Role{}, false
+}
+
+// NewPermissionSet builds a set from a list of permissions
+func NewPermissionSet(list []string) PermissionSet {
+	set := make(PermissionSet, len(list))
+	for _, permission := range list {
+		set[permission] = true
+	}
+	return set
+}
+
+// IsKnownPermission reports whether permission is in the catalog
+func IsKnownPermission(permission string) bool {
+	for _, info := range PermissionCatalog {
+		if info.Permission == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePermissions validates a permission list, accepting "resource.*" for
+// every permission on a resource. The result is in catalog order.
+func ParsePermissions(list []string) ([]string, error) {
+	set := make(PermissionSet)
+	for _, raw := range list {
+		permission := strings.ToLower(strings.TrimSpace(raw))
+		if permission == "" {
+			continue
+		}
+		if resource, ok := strings.CutSuffix(permission, ".*"); ok {
+			matched := false
+			for _, info := range PermissionCatalog {
+				if strings.HasPrefix(info.Permission, resource+".") {
+					set[info.Permission] = true
+					matched = true
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unknown permission: %s", raw)
+			}
+			continue
+		}
+		if !IsKnownPermission(permission) {
+			return nil, fmt.Errorf("unknown permission: %s", raw)
+		}
+		set[permission] = true
+	}
+	return set.List(), nil
+}
+
+// adminRouteRule maps admin API routes containing path to the permission
+// needed to read (GET) or change them. Rules are checked in order, so more
+// specific paths come first.
+type adminRouteRule struct {
+	path  string
+	read  string
+	write string
+}
+
+var adminRouteRules = []adminRouteRule{
+	// Every admin manages their own profile, passkeys, tokens and
+	// notifications, and can re-authenticate
+	{"/profile", "", ""},
+	{"/server/reauth", "", ""},
+	{"/notifications/send", PermNotificationsSend, PermNotificationsSend},
+	{"/server/backup/restore", PermBackupRestore, PermBackupRestore},
+	{"/server/backup", PermBackupRead, PermBackupRun},
+	{"/server/users/:id/role", PermRolesRead, PermRolesWrite},
+	{"/server/users/settings", PermSettingsRead, PermSettingsWrite},
+	{"/server/users", PermUsersRead, PermUsersWrite},
+	{"/server/privacy", PermUsersRead, PermUsersWrite},
+	{"/server/admins/:id/roles", PermRolesRead, PermRolesWrite},
+	{"/server/admins", PermAdminsRead, PermAdminsWrite},
+	{"/server/roles", PermRolesRead, PermRolesWrite},
+	{"/server/permissions", PermRolesRead, PermRolesWrite},
+	{"/server/security", PermSecurityRead, PermSecurityWrite},
+	{"/server/network", PermSecurityRead, PermSecurityWrite},
+	{"/server/graphql", PermSecurityRead, PermSecurityWrite},
+	{"/server/ssl", PermSecurityRead, PermSecurityWrite},
+	{"/server/tor", PermSecurityRead, PermSecurityWrite},
+	{"/server/logs/audit/search", PermLogsRead, PermLogsRead},
+	{"/server/logs", PermLogsRead, PermLogsWrite},
+	{"/server/logging", PermLogsRead, PermLogsWrite},
+	{"/server/channels", PermChannelsRead, PermChannelsManage},
+	{"/server/templates", PermChannelsRead, PermChannelsManage},
+	{"/server/smtp", PermChannelsRead, PermChannelsManage},
+	{"/server/email", PermChannelsRead, PermChannelsManage},
+	{"/server/settings", PermSettingsRead, PermSettingsWrite},
+	{"/server/setup", PermSettingsRead, PermSettingsWrite},
+	{"/server/branding", PermSettingsRead, PermSettingsWrite},
+	{"/server/pages", PermSettingsRead, PermSettingsWrite},
+	{"/server/web", PermSettingsRead, PermSettingsWrite},
+	{"/server/weather", PermSettingsRead, PermSettingsWrite},
+	{"/server/notifications", PermSettingsRead, PermSettingsWrite},
+	{"/server/metrics", PermSystemRead, PermSystemManage},
+	{"/notifications", "", ""},
+}
+
+// AdminRoutePermission returns the permission an admin API route needs;
+// path is the route pattern (gin's FullPath). Routes without a rule, such
+// as status, scheduler, database and cache maintenance, need
+// system.read or system.manage. The empty string means any admin.
+func AdminRoutePermission(method, path string) string {
+	read := method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+	for _, rule := range adminRouteRules {
+		if strings.Contains(path, rule.path) {
+			if read {
+				return rule.read
+			}
+			return rule.write
+		}
+	}
+	if read {
+		return PermSystemRead
+	}
+	return PermSystemManage
+}
+
+// adminGraphQLPermissions maps admin GraphQL fields to permissions
+var adminGraphQLPermissions = map[string]string{
+	"adminUsers":              PermUsersRead,
+	"adminUserInvites":        PermUsersRead,
+	"adminUserInvite":         PermUsersRead,
+	"adminUpdateUser":         PermUsersWrite,
+	"adminDeleteUser":         PermUsersWrite,
+	"adminCreateUserInvite":   PermUsersWrite,
+	"adminDeleteUserInvite":   PermUsersWrite,
+	"adminServerAdmins":       PermAdminsRead,
+	"adminServerAdmin":        PermAdminsRead,
+	"adminInviteServerAdmin":  PermAdminsWrite,
+	"adminDeleteServerAdmin":  PermAdminsWrite,
+	"adminDisableServerAdmin": PermAdminsWrite,
+	"adminEnableServerAdmin":  PermAdminsWrite,
+	"adminSettings":           PermSettingsRead,
+	"adminSetting":            PermSettingsRead,
+	"adminUpdateSetting":      PermSettingsWrite,
+	"adminUpdateSettings":     PermSettingsWrite,
+	"adminResetSettings":      PermSettingsWrite,
+	"adminTokens":             PermSecurityRead,
+	"adminGenerateToken":      PermSecurityWrite,
+	"adminRevokeToken":        PermSecurityWrite,
+	"adminAuditLogs":          PermLogsRead,
+	"adminClearAuditLogs":     PermLogsWrite,
+	"adminStats":              PermSystemRead,
+	"adminTasks":              PermSystemRead,
+	"adminTaskHistory":        PermSystemRead,
+	"adminUpdateTask":         PermSystemManage,
+	"adminEnableTask":         PermSystemManage,
+	"adminDisableTask":        PermSystemManage,
+	"adminTriggerTask":        PermSystemManage,
+	"adminChannels":           PermChannelsRead,
+	"adminChannel":            PermChannelsRead,
+	"adminChannelStats":       PermChannelsRead,
+	"adminQueueStats":         PermChannelsRead,
+	"adminSMTPProviders":      PermChannelsRead,
+	"adminUpdateChannel":      PermChannelsManage,
+	"adminEnableChannel":      PermChannelsManage,
+	"adminDisableChannel":     PermChannelsManage,
+	"adminTestChannel":        PermChannelsManage,
+	"adminInitializeChannels": PermChannelsManage,
+	"adminAutoDetectSMTP":     PermChannelsManage,
+}
+
+// AdminGraphQLPermission returns the permission an admin Query or Mutation
+// field needs; unlisted admin fields need system.manage
+func AdminGraphQLPermission(field string) string {
+	if permission, ok := adminGraphQLPermissions[field]; ok {
+		return permission
+	}
+	return PermSystemManage
+}
+
+// AdminGraphQLFields lists the admin GraphQL fields in name order
+func AdminGraphQLFields() []string {
+	fields := make([]string, 0, len(adminGraphQLPermissions))
+	for field := range adminGraphQLPermissions {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// RoleModel manages custom roles and admin role assignments in server.db
+type RoleModel struct {
+	DB *sql.DB
+}
+
+func (m *RoleModel) db() *sql.DB {
+	if m.DB != nil {
+		return m.DB
+	}
+	return database.GetServerDB()
+}
+
+// ValidateRoleName checks a custom role name
+func ValidateRoleName(name string) error {
+	if !roleNamePattern.MatchString(name) {
+		return fmt.Errorf("role names are 2-32 lowercase letters, digits, '-' or '_' and start with a letter")
+	}
+	return nil
+}
+
+// List returns the built-in roles followed by custom roles by name
+func (m *RoleModel) List() ([]Role, error) {
+	roles := BuiltInRoles()
+	rows, err := m.db().Query(`SELECT name, description, permissions, created_at, updated_at FROM server_roles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, *role)
+	}
+	return roles, rows.Err()
+}
+
+type roleScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRole(row roleScanner) (*Role, error) {
+	var role Role
+	var permissions string
+	var createdAt, updatedAt time.Time
+	if err := row.Scan(&role.Name, &role.Description, &permissions, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	role.Permissions = []string{}
+	for _, permission := range strings.Split(permissions, ",") {
+		// Permissions removed from the catalog are dropped
+		if IsKnownPermission(permission) {
+			role.Permissions = append(role.Permissions, permission)
+		}
+	}
+	role.CreatedAt, role.UpdatedAt = &createdAt, &updatedAt
+	return &role, nil
+}
+
+// Get returns a built-in or custom role
+func (m *RoleModel) Get(name string) (*Role, error) {
+	if role, ok := builtInRole(name); ok {
+		return &role, nil
+	}
+	role, err := scanRole(m.db().QueryRow(`SELECT name, description, permissions, created_at, updated_at FROM server_roles WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load role: %w", err)
+	}
+	return role, nil
+}
+
+// Create adds a custom role
+func (m *RoleModel) Create(name, description string, permissions []string) (*Role, error) {
+	if err := ValidateRoleName(name); err != nil {
+		return nil, err
+	}
+	if _, ok := builtInRole(name); ok {
+		return nil, ErrRoleExists
+	}
+	parsed, err := ParsePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.db().Exec(`INSERT INTO server_roles (name, description, permissions) VALUES (?, ?, ?)`,
+		name, strings.TrimSpace(description), strings.Join(parsed, ","))
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, ErrRoleExists
+		}
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+	return m.Get(name)
+}
+
+// Update replaces a custom role's description and permissions
+func (m *RoleModel) Update(name, description string, permissions []string) (*Role, error) {
+	if _, ok := builtInRole(name); ok {
+		return nil, ErrRoleBuiltIn
+	}
+	parsed, err := ParsePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := m.db().Exec(`UPDATE server_roles SET description = ?, permissions = ?, updated_at = CURRENT_TIMESTAMP WHERE name = ?`,
+		strings.TrimSpace(description), strings.Join(parsed, ","), name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, ErrRoleNotFound
+	}
+	return m.Get(name)
+}
+
+// Delete removes a custom role and its admin assignments. Users whose role
+// was deleted have no admin permissions.
+func (m *RoleModel) Delete(name string) error {
+	if _, ok := builtInRole(name); ok {
+		return ErrRoleBuiltIn
+	}
+
+	tx, err := m.db().Begin()
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM server_roles WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrRoleNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM server_admin_roles WHERE role = ?`, name); err != nil {
+		return fmt.Errorf("failed to delete role assignments: %w", err)
+	}
+	return tx.Commit()
+}
+
+// AdminRoles returns the roles assigned to an admin, or nil when none are
+func (m *RoleModel) AdminRoles(adminID int64) ([]string, error) {
+	rows, err := m.db().Query(`SELECT role FROM server_admin_roles WHERE admin_id = ? ORDER BY role`, adminID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// SetAdminRoles replaces an admin's roles; an empty list restores the
+// default admin role
+func (m *RoleModel) SetAdminRoles(adminID int64, roles []string) error {
+	for _, role := range roles {
+		if _, err := m.Get(role); err != nil {
+			return fmt.Errorf("%w: %s", err, role)
+		}
+	}
+
+	tx, err := m.db().Begin()
+	if err != nil {
+		return fmt.Errorf("failed to assign roles: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM server_admin_roles WHERE admin_id = ?`, adminID); err != nil {
+		return fmt.Errorf("failed to assign roles: %w", err)
+	}
+	for _, role := range roles {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO server_admin_roles (admin_id, role) VALUES (?, ?)`, adminID, role); err != nil {
+			return fmt.Errorf("failed to assign roles: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// EffectiveAdminRoles returns the roles that apply to an admin: super
+// admins always hold super_admin, and admins without assignments hold admin
+func (m *RoleModel) EffectiveAdminRoles(admin *Admin) ([]string, error) {
+	if admin.IsSuperAdmin {
+		return []string{RoleSuperAdmin}, nil
+	}
+	roles, err := m.AdminRoles(admin.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return []string{RoleAdmin}, nil
+	}
+	return roles, nil
+}
+
+// Permissions returns the union of the named roles' permissions; unknown
+// roles grant nothing
+func (m *RoleModel) Permissions(roles []string) (PermissionSet, error) {
+	set := make(PermissionSet)
+	for _, name := range roles {
+		role, err := m.Get(name)
+		if err == ErrRoleNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, permission := range role.Permissions {
+			set[permission] = true
+		}
+	}
+	return set, nil
+}
+
+// AdminPermissions returns what an admin may do
+func (m *RoleModel) AdminPermissions(admin *Admin) (PermissionSet, error) {
+	roles, err := m.EffectiveAdminRoles(admin)
+	if err != nil {
+		return nil, err
+	}
+	return m.Permissions(roles)
+}
+
+// UserPermissions returns what a user may do in the admin API and GraphQL
+// admin fields, from the role named by User.Role
+func (m *RoleModel) UserPermissions(user *User) (PermissionSet, error) {
+	return m.Permissions([]string{user.Role})
+}
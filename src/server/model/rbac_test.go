@@ -0,0 +1,164 @@
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+func TestAdminRoutePermission(t *testing.T) {
+	const prefix = "/api/v1/admin"
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", prefix + "/server/users", PermUsersRead},
+		{"DELETE", prefix + "/server/users/:id", PermUsersWrite},
+		{"PUT", prefix + "/server/users/:id/role", PermRolesWrite},
+		{"POST", prefix + "/server/users/settings", PermSettingsWrite},
+		{"PUT", prefix + "/server/admins/:id/roles", PermRolesWrite},
+		{"POST", prefix + "/server/admins/invite", PermAdminsWrite},
+		{"GET", prefix + "/server/roles/:name/preview", PermRolesRead},
+		{"POST", prefix + "/server/backup", PermBackupRun},
+		{"GET", prefix + "/server/backup/:id/download", PermBackupRead},
+		{"POST", prefix + "/server/backup/restore", PermBackupRestore},
+		{"PATCH", prefix + "/server/settings", PermSettingsWrite},
+		{"PUT", prefix + "/server/settings/web", PermSettingsWrite},
+		{"POST", prefix + "/server/channels/:type/test", PermChannelsManage},
+		{"POST", prefix + "/notifications/send", PermNotificationsSend},
+		{"PATCH", prefix + "/notifications/:id/read", ""},
+		{"POST", prefix + "/profile/passkeys", ""},
+		{"POST", prefix + "/server/reauth", ""},
+		{"POST", prefix + "/server/logs/audit/search", PermLogsRead},
+		{"DELETE", prefix + "/server/logs/audit-logs", PermLogsWrite},
+		{"PUT", prefix + "/server/logging/formats", PermLogsWrite},
+		{"POST", prefix + "/server/ssl/renew", PermSecurityWrite},
+		{"GET", prefix + "/server/status", PermSystemRead},
+		{"POST", prefix + "/server/restart", PermSystemManage},
+		{"GET", prefix + "/server/metrics/notifications/summary", PermSystemRead},
+	}
+
+	for _, tt := range tests {
+		if got := AdminRoutePermission(tt.method, tt.path); got != tt.want {
+			t.Errorf("AdminRoutePermission(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParsePermissions(t *testing.T) {
+	got, err := ParsePermissions([]string{" Settings.Write ", "users.*", "users.read", ""})
+	if err != nil {
+		t.Fatalf("ParsePermissions: %v", err)
+	}
+	want := []string{PermUsersRead, PermUsersWrite, PermSettingsWrite}
+	if len(got) != len(want) {
+		t.Fatalf("ParsePermissions = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ParsePermissions[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"users.delete", "nothing.*", "*"} {
+		if _, err := ParsePermissions([]string{bad}); err == nil {
+			t.Errorf("ParsePermissions(%q) should fail", bad)
+		}
+	}
+}
+
+func TestBuiltInRoles(t *testing.T) {
+	for _, role := range BuiltInRoles() {
+		if _, err := ParsePermissions(role.Permissions); err != nil {
+			t.Errorf("%s: %v", role.Name, err)
+		}
+	}
+
+	viewer, _ := builtInRole(RoleViewer)
+	set := NewPermissionSet(viewer.Permissions)
+	if !set.Has(PermUsersRead) || set.Has(PermUsersWrite) || set.Has(PermBackupRun) {
+		t.Errorf("viewer permissions = %v", viewer.Permissions)
+	}
+	user, _ := builtInRole(RoleUser)
+	if len(user.Permissions) != 0 {
+		t.Errorf("user permissions = %v, want none", user.Permissions)
+	}
+}
+
+func TestRoleModel(t *testing.T) {
+	db := setupTokenDB(t, database.ServerSchema)
+	m := &RoleModel{DB: db}
+
+	if _, err := m.Create("support", "Help desk", []string{"users.*", PermLogsRead}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := m.Create("support", "", nil); !errors.Is(err, ErrRoleExists) {
+		t.Errorf("Create duplicate = %v, want ErrRoleExists", err)
+	}
+	if _, err := m.Create(RoleViewer, "", nil); !errors.Is(err, ErrRoleExists) {
+		t.Errorf("Create built-in name = %v, want ErrRoleExists", err)
+	}
+	if _, err := m.Create("Bad Name", "", nil); err == nil {
+		t.Error("Expected an invalid role name to fail")
+	}
+	if _, err := m.Update(RoleAdmin, "", nil); !errors.Is(err, ErrRoleBuiltIn) {
+		t.Errorf("Update built-in = %v, want ErrRoleBuiltIn", err)
+	}
+
+	role, err := m.Update("support", "Help desk staff", []string{PermUsersRead, PermLogsRead})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if role.Description != "Help desk staff" || len(role.Permissions) != 2 || role.BuiltIn {
+		t.Errorf("Update = %+v", role)
+	}
+
+	roles, err := m.List()
+	if err != nil || len(roles) != len(BuiltInRoles())+1 {
+		t.Fatalf("List = %d roles, %v", len(roles), err)
+	}
+
+	// Admins without assignments hold the admin role; super admins always
+	// hold super_admin
+	admin := &Admin{ID: 7}
+	if got, _ := m.EffectiveAdminRoles(admin); len(got) != 1 || got[0] != RoleAdmin {
+		t.Errorf("EffectiveAdminRoles default = %v", got)
+	}
+	if err := m.SetAdminRoles(admin.ID, []string{"support", RoleViewer}); err != nil {
+		t.Fatalf("SetAdminRoles: %v", err)
+	}
+	if err := m.SetAdminRoles(admin.ID, []string{"missing"}); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("SetAdminRoles unknown = %v, want ErrRoleNotFound", err)
+	}
+	permissions, err := m.AdminPermissions(admin)
+	if err != nil {
+		t.Fatalf("AdminPermissions: %v", err)
+	}
+	if !permissions.Has(PermLogsRead) || !permissions.Has(PermSettingsRead) || permissions.Has(PermUsersWrite) {
+		t.Errorf("AdminPermissions = %v", permissions.List())
+	}
+	super, _ := m.AdminPermissions(&Admin{ID: 7, IsSuperAdmin: true})
+	if !super.Covers(allPermissions()) {
+		t.Errorf("super admin permissions = %v", super.List())
+	}
+
+	if err := m.Delete("support"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got, _ := m.AdminRoles(admin.ID); len(got) != 1 || got[0] != RoleViewer {
+		t.Errorf("AdminRoles after delete = %v, want [viewer]", got)
+	}
+	if err := m.Delete(RoleViewer); !errors.Is(err, ErrRoleBuiltIn) {
+		t.Errorf("Delete built-in = %v, want ErrRoleBuiltIn", err)
+	}
+
+	// A user whose role was deleted has no admin permissions
+	if permissions, _ := m.UserPermissions(&User{Role: "support"}); len(permissions) != 0 {
+		t.Errorf("UserPermissions for deleted role = %v", permissions.List())
+	}
+	if permissions, _ := m.UserPermissions(&User{Role: RoleAdmin}); !permissions.Has(PermRolesWrite) {
+		t.Error("Users with the admin role should keep full access")
+	}
+}
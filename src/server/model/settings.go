@@ -216,7 +216,17 @@ func (m *SettingsModel) InitializeDefaults(backupPath ...string) error {
 		"security.session_timeout":     {Value: "2592000", Type: "number", Description: "Session timeout in seconds (default: 2592000 = 30 days)"},
 		"security.max_login_attempts":  {Value: "5", Type: "number", Description: "Maximum failed login attempts before account lockout"},
 		"security.lockout_duration":    {Value: "30", Type: "number", Description: "Account lockout duration in minutes after max login attempts"},
+		"security.lockout_multiplier":  {Value: "2", Type: "string", Description: "Each further consecutive lockout lasts this many times longer"},
+		"security.lockout_max_duration": {Value: "1440", Type: "number", Description: "Longest account lockout in minutes"},
+		"security.breached_password_check": {Value: "true", Type: "boolean", Description: "Reject new passwords found in the imported breached password dataset and warn users who log in with one"},
+		"security.login_alerts":        {Value: "true", Type: "boolean", Description: "Email users when they log in from a new device or from an impossibly distant location"},
+		"security.impossible_travel_speed": {Value: "1000", Type: "number", Description: "Travel speed in km/h between logins above which a login is treated as impossible travel"},
 		"security.password_min_length": {Value: "8", Type: "number", Description: "Minimum required password length for user accounts"},
+		"security.passkey_attestation": {Value: "none", Type: "string", Description: "Passkey attestation conveyance: none, indirect or direct (direct rejects passkeys without attestation)"},
+		"security.passkey_aaguids":     {Value: "", Type: "string", Description: "Comma-separated authenticator AAGUIDs allowed to register passkeys (empty allows any)"},
+		"security.passwordless_registration": {Value: "true", Type: "boolean", Description: "Allow new accounts to sign up with a passkey and no password"},
+		"security.reauth_window":       {Value: "5", Type: "number", Description: "Minutes a step-up re-authentication stays valid for sensitive admin actions (0 disables the check)"},
+		"security.blocklist.enabled":   {Value: "false", Type: "boolean", Description: "Download Spamhaus DROP/EDROP daily and block requests from the listed ranges"},
 
 		// security.txt (RFC 9116) settings
 		"security.contact":         {Value: "", Type: "string", Description: "Security contact (email, URL, or phone) - comma separated for multiple"},
@@ -308,6 +318,11 @@ Sitemap: {app_url}/sitemap.xml`, Type: "text", Description: "robots.txt content
 		"rate_limit.admin":   {Value: "300", Type: "number", Description: "Admin panel rate limit (requests per minute)"},
 		"rate_limit.window":  {Value: "900", Type: "number", Description: "Rate limit window in seconds (default: 900 = 15 minutes)"},
 
+		// Per-tier, per-endpoint limits and route costs; override the limits above
+		"rate_limit.tiers":     {Value: "{}", Type: "text", Description: `API limits by caller tier (anonymous, user, token or a role) as JSON, e.g. {"premium": {"requests": 1000, "window": 60}}`},
+		"rate_limit.endpoints": {Value: "{}", Type: "text", Description: `Limits for login, password_reset, registration, upload and admin as JSON, e.g. {"login": {"requests": 10, "window": 900}}`},
+		"rate_limit.costs":     {Value: "{}", Type: "text", Description: `Request cost per API route as JSON, e.g. {"/history": 5}; unlisted routes cost 1`},
+
 		// SSL/TLS settings
 		"ssl.enabled":       {Value: "false", Type: "boolean", Description: "Enable SSL/TLS for HTTPS connections"},
 		"ssl.cert_file":     {Value: "", Type: "string", Description: "Path to SSL certificate file"},
@@ -363,6 +378,33 @@ Sitemap: {app_url}/sitemap.xml`, Type: "text", Description: "robots.txt content
 		"history.default_years": {Value: "10", Type: "number", Description: "Default number of years to display in historical view (5-50)"},
 		"history.min_years":     {Value: "5", Type: "number", Description: "Minimum number of years allowed for historical queries"},
 		"history.max_years":     {Value: "50", Type: "number", Description: "Maximum number of years allowed for historical queries"},
+
+		// GraphQL query limits per principal (anonymous, user, admin, and API token scope)
+		"graphql.max_depth.anonymous":               {Value: "8", Type: "number", Description: "Maximum GraphQL query depth for anonymous requests"},
+		"graphql.max_depth.user":                    {Value: "12", Type: "number", Description: "Maximum GraphQL query depth for signed-in users"},
+		"graphql.max_depth.admin":                   {Value: "20", Type: "number", Description: "Maximum GraphQL query depth for administrators"},
+		"graphql.max_depth.token_read":              {Value: "10", Type: "number", Description: "Maximum GraphQL query depth for read-scoped API tokens"},
+		"graphql.max_depth.token_read_write":        {Value: "12", Type: "number", Description: "Maximum GraphQL query depth for read-write API tokens"},
+		"graphql.max_depth.token_global":            {Value: "15", Type: "number", Description: "Maximum GraphQL query depth for global API tokens"},
+		"graphql.max_complexity.anonymous":          {Value: "200", Type: "number", Description: "Maximum GraphQL query complexity for anonymous requests"},
+		"graphql.max_complexity.user":               {Value: "500", Type: "number", Description: "Maximum GraphQL query complexity for signed-in users"},
+		"graphql.max_complexity.admin":              {Value: "2000", Type: "number", Description: "Maximum GraphQL query complexity for administrators"},
+		"graphql.max_complexity.token_read":         {Value: "300", Type: "number", Description: "Maximum GraphQL query complexity for read-scoped API tokens"},
+		"graphql.max_complexity.token_read_write":   {Value: "500", Type: "number", Description: "Maximum GraphQL query complexity for read-write API tokens"},
+		"graphql.max_complexity.token_global":       {Value: "1000", Type: "number", Description: "Maximum GraphQL query complexity for global API tokens"},
+		"graphql.persisted_queries.allowlist":       {Value: "false", Type: "boolean", Description: "Only execute persisted queries registered by an administrator"},
+		"graphql.persisted_queries.admin_bypass":    {Value: "true", Type: "boolean", Description: "Let administrators run arbitrary queries when the allowlist is enforced"},
+		"graphql.persisted_queries.apq_max_entries": {Value: "1000", Type: "number", Description: "Maximum number of client-registered (APQ) queries kept in the database; 0 is unlimited"},
+		"graphql.persisted_queries.apq_ttl_days":    {Value: "30", Type: "number", Description: "Days an unused client-registered (APQ) query is kept before it is pruned; 0 keeps them"},
+
+		// Cluster event bus and config sync
+		"cluster.event_bus":     {Value: "auto", Type: "string", Description: "Cluster event bus backend: auto, redis, postgres or database"},
+		"cluster.advertise_url": {Value: "", Type: "string", Description: "URL other cluster nodes use to reach this node"},
+		"cluster.join_url":      {Value: "", Type: "string", Description: "URL of an existing node to adopt configuration from on first start"},
+		"cluster.secret":        {Value: "", Type: "string", Description: "Shared secret for signing node-to-node sync requests (or CLUSTER_SECRET)"},
+		"cluster.tls.ca_file":   {Value: "", Type: "string", Description: "CA certificate for node-to-node mutual TLS"},
+		"cluster.tls.cert_file": {Value: "", Type: "string", Description: "Client certificate for node-to-node mutual TLS"},
+		"cluster.tls.key_file":  {Value: "", Type: "string", Description: "Client key for node-to-node mutual TLS"},
 	}
 
 	for key, setting := range defaults {
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+// openTestDB opens an empty database for one test. Set
+// WEATHER_TEST_DATABASE_URL to a postgres:// or mysql:// URL to run the
+// model tests against that server; each test gets its own schema or
+// database. Unset, tests use in-memory SQLite
+func openTestDB(t *testing.T, suffix string) (*sql.DB, database.Dialect) {
+	t.Helper()
+	counter := atomic.AddInt64(&dbCounter, 1)
+	url := os.Getenv("WEATHER_TEST_DATABASE_URL")
+	if url == "" {
+		url = "sqlite:"
+	}
+	name := fmt.Sprintf("%s_%s_%d_%d", t.Name(), suffix, os.Getpid(), counter)
+	db, dialect, cleanup, err := database.OpenScratchDB(url, name)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(cleanup)
+	return db, dialect
+}
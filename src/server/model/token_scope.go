@@ -0,0 +1,156 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Fine-grained token scopes use the resource:action form. A token may hold
+// any number of them; "resource:*" grants every action on a resource.
+const (
+	ScopeWeatherRead       = "weather:read"
+	ScopeAlertsRead        = "alerts:read"
+	ScopeLocationsRead     = "locations:read"
+	ScopeLocationsWrite    = "locations:write"
+	ScopeNotificationsRead = "notifications:read"
+	ScopeNotificationsSend = "notifications:send"
+	ScopeAdminRead         = "admin:read"
+	ScopeAdminWrite        = "admin:write"
+	ScopeAdminBackup       = "admin:backup"
+)
+
+// TokenScopeInfo describes a scope for token management pages
+type TokenScopeInfo struct {
+	Scope       string `json:"scope"`
+	Description string `json:"description"`
+	// AdminOnly scopes can only be granted to admin tokens
+	AdminOnly bool `json:"admin_only"`
+}
+
+// TokenScopeCatalog lists every fine-grained scope in display order
+var TokenScopeCatalog = []TokenScopeInfo{
+	{ScopeWeatherRead, "Read current weather, forecasts, history, moon and sun data", false},
+	{ScopeAlertsRead, "Read severe weather alerts, hurricanes and earthquakes", false},
+	{ScopeLocationsRead, "List saved locations", false},
+	{ScopeLocationsWrite, "Create, update and delete saved locations", false},
+	{ScopeNotificationsRead, "Read and manage notifications", false},
+	{ScopeNotificationsSend, "Send notifications", true},
+	{ScopeAdminRead, "Read server settings and status", true},
+	{ScopeAdminWrite, "Change server settings", true},
+	{ScopeAdminBackup, "Create, download and restore backups", true},
+}
+
+// legacyScopeAliases maps scopes accepted before fine-grained scopes existed.
+// "write" was suggested by the old token form.
+var legacyScopeAliases = map[string]string{
+	"write": ScopeReadWrite,
+}
+
+// IsKnownScope reports whether scope is a coarse scope, a catalog scope or a
+// wildcard for a catalog resource
+func IsKnownScope(scope string) bool {
+	switch scope {
+	case ScopeGlobal, ScopeReadWrite, ScopeRead:
+		return true
+	}
+	for _, info := range TokenScopeCatalog {
+		if info.Scope == scope {
+			return true
+		}
+		if resource, _, _ := strings.Cut(info.Scope, ":"); scope == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseScopes parses a comma or space separated scope list, rejecting
+// unknown scopes. The result is sorted and free of duplicates.
+func ParseScopes(raw string) ([]string, error) {
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, field := range splitScopes(raw) {
+		if alias, ok := legacyScopeAliases[field]; ok {
+			field = alias
+		}
+		if !IsKnownScope(field) {
+			return nil, fmt.Errorf("unknown scope: %s", field)
+		}
+		if !seen[field] {
+			seen[field] = true
+			scopes = append(scopes, field)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	sort.Strings(scopes)
+	return scopes, nil
+}
+
+// ValidateScopesForOwner rejects admin-only scopes on user tokens
+func ValidateScopesForOwner(scopes []string, ownerType string) error {
+	if ownerType == OwnerTypeAdmin {
+		return nil
+	}
+	for _, scope := range scopes {
+		resource, _, _ := strings.Cut(scope, ":")
+		for _, info := range TokenScopeCatalog {
+			if !info.AdminOnly {
+				continue
+			}
+			if info.Scope == scope || (resource+":*" == scope && strings.HasPrefix(info.Scope, resource+":")) {
+				return fmt.Errorf("scope %s is only available to admin tokens", scope)
+			}
+		}
+	}
+	return nil
+}
+
+// ScopesAllow reports whether the stored scope list grants required. The
+// coarse scopes grant by action: read covers every :read scope, read-write
+// every :read and :write scope. Stored lists are parsed leniently: unknown
+// entries are ignored and an empty list means global, which is what tokens
+// created without scopes always had.
+func ScopesAllow(stored, required string) bool {
+	fields := splitScopes(stored)
+	if len(fields) == 0 {
+		return true
+	}
+	requiredResource, requiredAction, _ := strings.Cut(required, ":")
+	for _, scope := range fields {
+		if alias, ok := legacyScopeAliases[scope]; ok {
+			scope = alias
+		}
+		switch scope {
+		case ScopeGlobal:
+			return true
+		case ScopeReadWrite:
+			if requiredAction == "read" || requiredAction == "write" {
+				return true
+			}
+			continue
+		case ScopeRead:
+			if requiredAction == "read" {
+				return true
+			}
+			continue
+		}
+		if scope == required || scope == requiredResource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the token grants required
+func (t *Token) HasScope(required string) bool {
+	return ScopesAllow(t.Scope, required)
+}
+
+func splitScopes(raw string) []string {
+	return strings.FieldsFunc(strings.ToLower(raw), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
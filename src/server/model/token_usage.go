@@ -0,0 +1,115 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// tokenUsageHourFormat buckets usage by UTC hour and sorts lexically
+const tokenUsageHourFormat = "2006-01-02T15"
+
+// TokenRouteUsage is the request count for one route
+type TokenRouteUsage struct {
+	Route    string `json:"route"`
+	Requests int64  `json:"requests"`
+	Errors   int64  `json:"errors"`
+}
+
+// TokenUsageSummary aggregates a token's usage over a period
+type TokenUsageSummary struct {
+	Requests  int64             `json:"requests"`
+	Errors    int64             `json:"errors"`
+	LastDay   int64             `json:"last_day"`
+	TopRoutes []TokenRouteUsage `json:"top_routes"`
+}
+
+// TokenUsageModel records hourly per-route request counts for API tokens.
+// User and organization token usage lives in users.db, admin token usage
+// in server.db.
+type TokenUsageModel struct {
+	DB *sql.DB
+}
+
+func tokenUsageTable(ownerType string) (string, error) {
+	switch ownerType {
+	case OwnerTypeUser:
+		return "user_token_usage", nil
+	case OwnerTypeAdmin:
+		return "server_admin_token_usage", nil
+	case OwnerTypeOrg:
+		return "org_token_usage", nil
+	default:
+		return "", fmt.Errorf("invalid owner type: %s", ownerType)
+	}
+}
+
+// Record counts one request; failed marks 4xx/5xx responses
+func (m *TokenUsageModel) Record(t *Token, route string, failed bool, at time.Time) error {
+	table, err := tokenUsageTable(t.OwnerType)
+	if err != nil {
+		return err
+	}
+	if route == "" {
+		route = "unmatched"
+	}
+	errorCount := 0
+	if failed {
+		errorCount = 1
+	}
+
+	_, err = m.DB.Exec(`
+		INSERT INTO `+table+` (token_id, hour, route, requests, errors)
+		VALUES (?, ?, ?, 1, ?)
+		ON CONFLICT(token_id, hour, route) DO UPDATE SET
+			requests = requests + 1,
+			errors = errors + excluded.errors
+	`, t.ID, at.UTC().Format(tokenUsageHourFormat), route, errorCount)
+	if err != nil {
+		return fmt.Errorf("failed to record token usage: %w", err)
+	}
+	return nil
+}
+
+// Summary returns a token's usage since the given time
+func (m *TokenUsageModel) Summary(ownerType string, tokenID int64, since time.Time) (*TokenUsageSummary, error) {
+	table, err := tokenUsageTable(ownerType)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &TokenUsageSummary{TopRoutes: []TokenRouteUsage{}}
+	dayAgo := time.Now().Add(-24 * time.Hour).UTC().Format(tokenUsageHourFormat)
+	err = m.DB.QueryRow(`
+		SELECT COALESCE(SUM(requests), 0), COALESCE(SUM(errors), 0),
+		       COALESCE(SUM(CASE WHEN hour >= ? THEN requests ELSE 0 END), 0)
+		FROM `+table+`
+		WHERE token_id = ? AND hour >= ?
+	`, dayAgo, tokenID, since.UTC().Format(tokenUsageHourFormat)).Scan(
+		&summary.Requests, &summary.Errors, &summary.LastDay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token usage: %w", err)
+	}
+
+	rows, err := m.DB.Query(`
+		SELECT route, SUM(requests), SUM(errors)
+		FROM `+table+`
+		WHERE token_id = ? AND hour >= ?
+		GROUP BY route
+		ORDER BY SUM(requests) DESC, route
+		LIMIT 5
+	`, tokenID, since.UTC().Format(tokenUsageHourFormat))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token routes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var route TokenRouteUsage
+		if err := rows.Scan(&route.Route, &route.Requests, &route.Errors); err != nil {
+			return nil, err
+		}
+		summary.TopRoutes = append(summary.TopRoutes, route)
+	}
+	return summary, rows.Err()
+}
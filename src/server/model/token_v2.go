@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 )
@@ -19,10 +20,16 @@ type Token struct {
 	Name       string     `json:"name"`
 	TokenHash  string     `json:"-"`           // Never expose hash
 	TokenPrefix string    `json:"token_prefix"` // First 8 chars for display
-	Scope      string     `json:"scope"`       // 'global', 'read-write', 'read'
+	Scope      string     `json:"scope"`       // comma separated, see token_scope.go
 	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
 	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
 	CreatedAt  time.Time  `json:"created_at"`
+
+	// Optional restrictions, see TokenRestrictions
+	AllowedIPs []string `json:"allowed_ips,omitempty"`
+	LocationID *int64   `json:"location_id,omitempty"`
+	RateLimit  int      `json:"rate_limit,omitempty"`
+	DailyQuota int      `json:"daily_quota,omitempty"`
 	
 	// Only populated on creation, never stored
 	Token  string     `json:"token,omitempty"`
@@ -31,8 +38,8 @@ type Token struct {
 // TokenScope types per TEMPLATE.md PART 11
 const (
 	ScopeGlobal    = "global"     // All permissions owner has
-	ScopeReadWrite = "read-write" // Read and write, no delete/admin
-	ScopeRead      = "read"       // Read-only
+	ScopeReadWrite = "read-write" // Every :read and :write scope
+	ScopeRead      = "read"       // Every :read scope
 )
 
 // Owner types per TEMPLATE.md PART 11
@@ -138,260 +145,397 @@ func ValidateTokenFormat(token string) error {
 	return nil
 }
 
-// TokenModelV2 handles token database operations per TEMPLATE.md PART 11
+// TokenRestrictions narrows what a token may do beyond its scopes
+type TokenRestrictions struct {
+	// AllowedIPs holds IP addresses or CIDR ranges; empty allows any address
+	AllowedIPs []string
+	// LocationID binds the token to one of the owner's saved locations
+	LocationID *int64
+	// RequestsPerMinute and DailyQuota are 0 when unlimited
+	RequestsPerMinute int
+	DailyQuota        int
+}
+
+// Validate checks the addresses and quotas
+func (r TokenRestrictions) Validate() error {
+	for _, entry := range r.AllowedIPs {
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf("invalid IP address or CIDR range: %s", entry)
+		}
+	}
+	if r.RequestsPerMinute < 0 || r.DailyQuota < 0 {
+		return fmt.Errorf("rate limits cannot be negative")
+	}
+	return nil
+}
+
+// ParseAllowedIPs splits a comma, space or newline separated list of IP
+// addresses and CIDR ranges
+func ParseAllowedIPs(raw string) ([]string, error) {
+	entries := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+	restrictions := TokenRestrictions{AllowedIPs: entries}
+	if err := restrictions.Validate(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// AllowsIP reports whether the token may be used from ip
+func (t *Token) AllowsIP(ip string) bool {
+	if len(t.AllowedIPs) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range t.AllowedIPs {
+		if allowed := net.ParseIP(entry); allowed != nil {
+			if allowed.Equal(addr) {
+				return true
+			}
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenModelV2 handles token database operations per TEMPLATE.md PART 11.
+// User and organization tokens live in users.db (user_tokens, org_tokens)
+// and admin tokens in server.db (server_admin_tokens), so DB must be the
+// database for the owner type.
 type TokenModelV2 struct {
 	DB *sql.DB
 }
 
-// CreateToken creates a new token per TEMPLATE.md PART 11
-func (m *TokenModelV2) CreateToken(ownerType string, ownerID int64, name, scope string, expiration time.Duration) (*Token, error) {
-	// Validate owner type
-	if ownerType != OwnerTypeAdmin && ownerType != OwnerTypeUser && ownerType != OwnerTypeOrg {
-		return nil, fmt.Errorf("invalid owner type: %s", ownerType)
-	}
-	
-	// Validate scope
-	if scope != ScopeGlobal && scope != ScopeReadWrite && scope != ScopeRead {
-		return nil, fmt.Errorf("invalid scope: %s", scope)
+// tokenTable returns the table and owner column for an owner type
+func tokenTable(ownerType string) (string, string, error) {
+	switch ownerType {
+	case OwnerTypeUser:
+		return "user_tokens", "user_id", nil
+	case OwnerTypeAdmin:
+		return "server_admin_tokens", "admin_id", nil
+	case OwnerTypeOrg:
+		return "org_tokens", "org_id", nil
+	default:
+		return "", "", fmt.Errorf("invalid owner type: %s", ownerType)
 	}
-	
-	// Generate token with appropriate prefix
-	var prefix string
+}
+
+// tokenPrefixFor returns the prefix new tokens of an owner type get
+func tokenPrefixFor(ownerType string) string {
 	switch ownerType {
 	case OwnerTypeAdmin:
-		prefix = PrefixAdmin
-	case OwnerTypeUser:
-		prefix = PrefixUser
+		return PrefixAdmin
 	case OwnerTypeOrg:
-		prefix = PrefixOrg
+		return PrefixOrg
+	default:
+		return PrefixUser
 	}
-	
-	fullToken, err := GenerateTokenWithPrefix(prefix)
+}
+
+// tokenOwnerType returns the owner type encoded in a token's prefix
+func tokenOwnerType(token string) string {
+	switch {
+	case strings.HasPrefix(token, PrefixAdmin):
+		return OwnerTypeAdmin
+	case strings.HasPrefix(token, PrefixOrg):
+		return OwnerTypeOrg
+	default:
+		return OwnerTypeUser
+	}
+}
+
+// NewToken mints a token per TEMPLATE.md PART 11 without storing it: the
+// hash and prefix are set for storage and Token holds the plaintext to
+// show once. scope is a comma separated list of coarse or resource:action
+// scopes.
+func NewToken(ownerType string, ownerID int64, name, scope string, expiration time.Duration, restriction TokenRestrictions) (*Token, error) {
+	if _, _, err := tokenTable(ownerType); err != nil {
+		return nil, err
+	}
+
+	scopes, err := ParseScopes(scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateScopesForOwner(scopes, ownerType); err != nil {
+		return nil, err
+	}
+	if err := restriction.Validate(); err != nil {
+		return nil, err
+	}
+
+	fullToken, err := GenerateTokenWithPrefix(tokenPrefixFor(ownerType))
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate token: %w", err)
 	}
-	
-	// Hash token for storage (NEVER store plaintext)
-	tokenHash := HashToken(fullToken)
-	tokenPrefix := GetTokenPrefix(fullToken)
-	
-	// Calculate expiration
+
 	var expiresAt *time.Time
 	if expiration > 0 {
 		exp := time.Now().Add(expiration)
 		expiresAt = &exp
 	}
-	
-	// Insert into database
-	result, err := m.DB.Exec(`
-		INSERT INTO tokens (owner_type, owner_id, name, token_hash, token_prefix, scope, expires_at, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, ownerType, ownerID, name, tokenHash, tokenPrefix, scope, expiresAt, time.Now())
-	
-	if err != nil {
-		return nil, fmt.Errorf("failed to insert token: %w", err)
-	}
-	
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get token id: %w", err)
-	}
-	
-	// Return token with full token value (only shown once)
+
 	return &Token{
-		ID:          id,
 		OwnerType:   ownerType,
 		OwnerID:     ownerID,
 		Name:        name,
-		TokenHash:   tokenHash,
-		TokenPrefix: tokenPrefix,
-		Scope:       scope,
+		// Hash token for storage (NEVER store plaintext)
+		TokenHash:   HashToken(fullToken),
+		TokenPrefix: GetTokenPrefix(fullToken),
+		Scope:       strings.Join(scopes, ","),
 		ExpiresAt:   expiresAt,
 		CreatedAt:   time.Now(),
-		Token:   fullToken, // Only returned on creation
+		AllowedIPs:  restriction.AllowedIPs,
+		LocationID:  restriction.LocationID,
+		RateLimit:   restriction.RequestsPerMinute,
+		DailyQuota:  restriction.DailyQuota,
+		Token:       fullToken,
 	}, nil
 }
 
+// CreateToken creates a new token per TEMPLATE.md PART 11. scope is a comma
+// separated list of coarse or resource:action scopes.
+func (m *TokenModelV2) CreateToken(ownerType string, ownerID int64, name, scope string, expiration time.Duration, restrictions ...TokenRestrictions) (*Token, error) {
+	var restriction TokenRestrictions
+	if len(restrictions) > 0 {
+		restriction = restrictions[0]
+	}
+	token, err := NewToken(ownerType, ownerID, name, scope, expiration, restriction)
+	if err != nil {
+		return nil, err
+	}
+	table, ownerColumn, _ := tokenTable(ownerType)
+
+	result, err := m.DB.Exec(`
+		INSERT INTO `+table+` (`+ownerColumn+`, name, token_hash, token_prefix, scopes, expires_at, created_at,
+			allowed_ips, location_id, rate_limit, daily_quota)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, ownerID, name, token.TokenHash, token.TokenPrefix, token.Scope, token.ExpiresAt, token.CreatedAt,
+		strings.Join(token.AllowedIPs, ","), token.LocationID, token.RateLimit, token.DailyQuota)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert token: %w", err)
+	}
+
+	// Return token with full token value (only shown once)
+	token.ID, err = result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token id: %w", err)
+	}
+	return token, nil
+}
+
+// tokenColumns is the select list shared by the queries below; the owner
+// column is substituted per table
+const tokenColumns = `id, %s, name, token_hash, token_prefix, scopes, expires_at, last_used_at, created_at,
+	allowed_ips, location_id, rate_limit, daily_quota`
+
+type tokenScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanToken(row tokenScanner, ownerType string) (*Token, error) {
+	var t Token
+	var name, scopes, allowedIPs sql.NullString
+	var expiresAt, lastUsedAt sql.NullTime
+	var locationID sql.NullInt64
+
+	err := row.Scan(
+		&t.ID, &t.OwnerID, &name, &t.TokenHash, &t.TokenPrefix, &scopes,
+		&expiresAt, &lastUsedAt, &t.CreatedAt,
+		&allowedIPs, &locationID, &t.RateLimit, &t.DailyQuota,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	t.OwnerType = ownerType
+	t.Name = name.String
+	t.Scope = scopes.String
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	if allowedIPs.String != "" {
+		t.AllowedIPs = strings.Split(allowedIPs.String, ",")
+	}
+	if locationID.Valid {
+		t.LocationID = &locationID.Int64
+	}
+	return &t, nil
+}
+
 // ValidateToken validates a token and returns token info per TEMPLATE.md PART 11
 func (m *TokenModelV2) ValidateToken(token string) (*Token, error) {
 	// Validate format
 	if err := ValidateTokenFormat(token); err != nil {
 		return nil, err
 	}
-	
+
+	ownerType := tokenOwnerType(token)
+	table, ownerColumn, err := tokenTable(ownerType)
+	if err != nil {
+		return nil, err
+	}
 	// Hash token to look up in database
-	tokenHash := HashToken(token)
-	
-	// Look up token
-	var t Token
-	var expiresAt sql.NullTime
-	var lastUsedAt sql.NullTime
-	
-	err := m.DB.QueryRow(`
-		SELECT id, owner_type, owner_id, name, token_hash, token_prefix, scope, expires_at, last_used_at, created_at
-		FROM tokens
+	t, err := scanToken(m.DB.QueryRow(`
+		SELECT `+fmt.Sprintf(tokenColumns, ownerColumn)+`
+		FROM `+table+`
 		WHERE token_hash = ?
-	`, tokenHash).Scan(
-		&t.ID, &t.OwnerType, &t.OwnerID, &t.Name, &t.TokenHash, &t.TokenPrefix,
-		&t.Scope, &expiresAt, &lastUsedAt, &t.CreatedAt,
-	)
-	
+	`, HashToken(token)), ownerType)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("invalid token")
 	}
 	if err != nil {
 		return nil, fmt.Errorf("database error: %w", err)
 	}
-	
+
 	// Check expiration
-	if expiresAt.Valid {
-		t.ExpiresAt = &expiresAt.Time
-		if time.Now().After(*t.ExpiresAt) {
-			return nil, fmt.Errorf("token expired")
-		}
-	}
-	
-	if lastUsedAt.Valid {
-		t.LastUsedAt = &lastUsedAt.Time
+	if t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt) {
+		return nil, fmt.Errorf("token expired")
 	}
-	
-	return &t, nil
+
+	return t, nil
 }
 
-// UpdateLastUsed updates the last_used_at timestamp
-func (m *TokenModelV2) UpdateLastUsed(tokenID int64) error {
-	_, err := m.DB.Exec(`
-		UPDATE tokens SET last_used_at = ?
+// UpdateLastUsed records when and from where a token was last used
+func (m *TokenModelV2) UpdateLastUsed(t *Token, ip string) error {
+	table, _, err := tokenTable(t.OwnerType)
+	if err != nil {
+		return err
+	}
+	_, err = m.DB.Exec(`
+		UPDATE `+table+` SET last_used_at = ?, last_used_ip = ?
 		WHERE id = ?
-	`, time.Now(), tokenID)
+	`, time.Now(), ip, t.ID)
 	return err
 }
 
+// GetToken returns one of the owner's tokens
+func (m *TokenModelV2) GetToken(id int64, ownerType string, ownerID int64) (*Token, error) {
+	table, ownerColumn, err := tokenTable(ownerType)
+	if err != nil {
+		return nil, err
+	}
+	t, err := scanToken(m.DB.QueryRow(`
+		SELECT `+fmt.Sprintf(tokenColumns, ownerColumn)+`
+		FROM `+table+`
+		WHERE id = ? AND `+ownerColumn+` = ?
+	`, id, ownerID), ownerType)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("token not found")
+	}
+	return t, err
+}
+
 // ListTokens lists all tokens for an owner per TEMPLATE.md PART 11
 func (m *TokenModelV2) ListTokens(ownerType string, ownerID int64) ([]*Token, error) {
+	table, ownerColumn, err := tokenTable(ownerType)
+	if err != nil {
+		return nil, err
+	}
 	rows, err := m.DB.Query(`
-		SELECT id, owner_type, owner_id, name, token_prefix, scope, expires_at, last_used_at, created_at
-		FROM tokens
-		WHERE owner_type = ? AND owner_id = ?
+		SELECT `+fmt.Sprintf(tokenColumns, ownerColumn)+`
+		FROM `+table+`
+		WHERE `+ownerColumn+` = ?
 		ORDER BY created_at DESC
-	`, ownerType, ownerID)
-	
+	`, ownerID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	
+
 	var tokens []*Token
 	for rows.Next() {
-		var t Token
-		var expiresAt sql.NullTime
-		var lastUsedAt sql.NullTime
-		
-		err := rows.Scan(
-			&t.ID, &t.OwnerType, &t.OwnerID, &t.Name, &t.TokenPrefix,
-			&t.Scope, &expiresAt, &lastUsedAt, &t.CreatedAt,
-		)
+		t, err := scanToken(rows, ownerType)
 		if err != nil {
 			return nil, err
 		}
-		
-		if expiresAt.Valid {
-			t.ExpiresAt = &expiresAt.Time
-		}
-		if lastUsedAt.Valid {
-			t.LastUsedAt = &lastUsedAt.Time
-		}
-		
-		tokens = append(tokens, &t)
+		t.TokenHash = ""
+		tokens = append(tokens, t)
 	}
-	
-	return tokens, nil
+
+	return tokens, rows.Err()
+}
+
+// CountTokens returns how many tokens an owner has
+func (m *TokenModelV2) CountTokens(ownerType string, ownerID int64) (int, error) {
+	table, ownerColumn, err := tokenTable(ownerType)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = m.DB.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE `+ownerColumn+` = ?`, ownerID).Scan(&count)
+	return count, err
 }
 
 // DeleteToken deletes a token per TEMPLATE.md PART 11
 func (m *TokenModelV2) DeleteToken(id int64, ownerType string, ownerID int64) error {
+	table, ownerColumn, err := tokenTable(ownerType)
+	if err != nil {
+		return err
+	}
+
 	result, err := m.DB.Exec(`
-		DELETE FROM tokens
-		WHERE id = ? AND owner_type = ? AND owner_id = ?
-	`, id, ownerType, ownerID)
-	
+		DELETE FROM `+table+`
+		WHERE id = ? AND `+ownerColumn+` = ?
+	`, id, ownerID)
 	if err != nil {
 		return err
 	}
-	
+
 	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-	
 	if rows == 0 {
 		return fmt.Errorf("token not found or access denied")
 	}
-	
+
 	return nil
 }
 
 // RotateToken generates a new token value while keeping settings per TEMPLATE.md PART 11
 func (m *TokenModelV2) RotateToken(id int64, ownerType string, ownerID int64) (*Token, error) {
-	// Get existing token
-	var existing Token
-	var expiresAt sql.NullTime
-	
-	err := m.DB.QueryRow(`
-		SELECT id, owner_type, owner_id, name, scope, expires_at, created_at
-		FROM tokens
-		WHERE id = ? AND owner_type = ? AND owner_id = ?
-	`, id, ownerType, ownerID).Scan(
-		&existing.ID, &existing.OwnerType, &existing.OwnerID,
-		&existing.Name, &existing.Scope, &expiresAt, &existing.CreatedAt,
-	)
-	
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("token not found")
-	}
+	existing, err := m.GetToken(id, ownerType, ownerID)
 	if err != nil {
 		return nil, err
 	}
-	
-	// Generate new token with same prefix
-	var prefix string
-	switch ownerType {
-	case OwnerTypeAdmin:
-		prefix = PrefixAdmin
-	case OwnerTypeUser:
-		prefix = PrefixUser
-	case OwnerTypeOrg:
-		prefix = PrefixOrg
-	}
-	
-	fullToken, err := GenerateTokenWithPrefix(prefix)
+	table, _, _ := tokenTable(ownerType)
+
+	fullToken, err := GenerateTokenWithPrefix(tokenPrefixFor(ownerType))
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate token: %w", err)
 	}
-	
+
 	tokenHash := HashToken(fullToken)
 	tokenPrefix := GetTokenPrefix(fullToken)
-	
-	// Update token
+
 	_, err = m.DB.Exec(`
-		UPDATE tokens
+		UPDATE `+table+`
 		SET token_hash = ?, token_prefix = ?, last_used_at = NULL
 		WHERE id = ?
 	`, tokenHash, tokenPrefix, id)
-	
 	if err != nil {
 		return nil, fmt.Errorf("failed to update token: %w", err)
 	}
-	
+
 	// Return updated token with full token value
 	existing.TokenHash = tokenHash
 	existing.TokenPrefix = tokenPrefix
 	existing.Token = fullToken
 	existing.LastUsedAt = nil
-	
-	if expiresAt.Valid {
-		existing.ExpiresAt = &expiresAt.Time
-	}
-	
-	return &existing, nil
+
+	return existing, nil
 }
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+func setupTokenDB(t *testing.T, schema string) *sql.DB {
+	t.Helper()
+	db, dialect := openTestDB(t, "tokens")
+	if err := database.ApplySchema(db, dialect, schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	return db
+}
+
+func TestScopesAllow(t *testing.T) {
+	tests := []struct {
+		stored   string
+		required string
+		want     bool
+	}{
+		{"", ScopeAdminBackup, true},
+		{"global", ScopeAdminBackup, true},
+		{"read", ScopeWeatherRead, true},
+		{"read", ScopeLocationsWrite, false},
+		{"read-write", ScopeLocationsWrite, true},
+		{"read-write", ScopeNotificationsSend, false},
+		{"write", ScopeLocationsWrite, true},
+		{"weather:read", ScopeWeatherRead, true},
+		{"weather:read", ScopeAlertsRead, false},
+		{"locations:*", ScopeLocationsWrite, true},
+		{"notifications:send,admin:backup", ScopeAdminBackup, true},
+		{"notifications:send", ScopeAdminRead, false},
+		{"weather:read", ScopeGlobal, false},
+	}
+	for _, tt := range tests {
+		if got := ScopesAllow(tt.stored, tt.required); got != tt.want {
+			t.Errorf("ScopesAllow(%q, %q) = %v, want %v", tt.stored, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes("weather:read, alerts:read weather:read")
+	if err != nil {
+		t.Fatalf("ParseScopes failed: %v", err)
+	}
+	if len(scopes) != 2 || scopes[0] != ScopeAlertsRead || scopes[1] != ScopeWeatherRead {
+		t.Errorf("ParseScopes = %v", scopes)
+	}
+
+	if _, err := ParseScopes("weather:write"); err == nil {
+		t.Error("expected unknown scope to be rejected")
+	}
+	if _, err := ParseScopes(" "); err == nil {
+		t.Error("expected empty scope list to be rejected")
+	}
+	if err := ValidateScopesForOwner([]string{ScopeAdminBackup}, OwnerTypeUser); err == nil {
+		t.Error("expected admin scope to be rejected for user tokens")
+	}
+	if err := ValidateScopesForOwner([]string{"admin:*"}, OwnerTypeUser); err == nil {
+		t.Error("expected admin wildcard to be rejected for user tokens")
+	}
+	if err := ValidateScopesForOwner([]string{ScopeAdminBackup}, OwnerTypeAdmin); err != nil {
+		t.Errorf("admin scope rejected for admin token: %v", err)
+	}
+}
+
+func TestTokenAllowsIP(t *testing.T) {
+	token := &Token{AllowedIPs: []string{"203.0.113.7", "10.0.0.0/8"}}
+	for ip, want := range map[string]bool{
+		"203.0.113.7": true,
+		"10.1.2.3":    true,
+		"192.0.2.1":   false,
+		"not-an-ip":   false,
+	} {
+		if got := token.AllowsIP(ip); got != want {
+			t.Errorf("AllowsIP(%q) = %v, want %v", ip, got, want)
+		}
+	}
+	if !(&Token{}).AllowsIP("192.0.2.1") {
+		t.Error("unrestricted token should allow any IP")
+	}
+	if _, err := ParseAllowedIPs("10.0.0.0/33"); err == nil {
+		t.Error("expected invalid CIDR to be rejected")
+	}
+}
+
+func TestTokenModelV2UserTokens(t *testing.T) {
+	db := setupTokenDB(t, database.UsersSchema)
+	tokens := &TokenModelV2{DB: db}
+
+	locationID := int64(3)
+	created, err := tokens.CreateToken(OwnerTypeUser, 7, "sensor", "weather:read", time.Hour, TokenRestrictions{
+		AllowedIPs:        []string{"10.0.0.0/8"},
+		LocationID:        &locationID,
+		RequestsPerMinute: 10,
+		DailyQuota:        500,
+	})
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+
+	validated, err := tokens.ValidateToken(created.Token)
+	if err != nil {
+		t.Fatalf("ValidateToken failed: %v", err)
+	}
+	if validated.OwnerType != OwnerTypeUser || validated.OwnerID != 7 {
+		t.Errorf("owner = %s/%d", validated.OwnerType, validated.OwnerID)
+	}
+	if validated.Scope != ScopeWeatherRead || !validated.HasScope(ScopeWeatherRead) || validated.HasScope(ScopeLocationsWrite) {
+		t.Errorf("unexpected scopes %q", validated.Scope)
+	}
+	if validated.LocationID == nil || *validated.LocationID != 3 || validated.RateLimit != 10 || validated.DailyQuota != 500 {
+		t.Errorf("restrictions not stored: %+v", validated)
+	}
+	if len(validated.AllowedIPs) != 1 || validated.AllowedIPs[0] != "10.0.0.0/8" {
+		t.Errorf("allowed IPs = %v", validated.AllowedIPs)
+	}
+
+	if _, err := tokens.CreateToken(OwnerTypeUser, 7, "bad", ScopeAdminBackup, 0); err == nil {
+		t.Error("expected admin scope to be rejected for user tokens")
+	}
+
+	if err := tokens.DeleteToken(created.ID, OwnerTypeUser, 8); err == nil {
+		t.Error("expected delete by another user to fail")
+	}
+	if err := tokens.DeleteToken(created.ID, OwnerTypeUser, 7); err != nil {
+		t.Fatalf("DeleteToken failed: %v", err)
+	}
+	if _, err := tokens.ValidateToken(created.Token); err == nil {
+		t.Error("deleted token still validates")
+	}
+}
+
+func TestTokenModelV2LegacyTable(t *testing.T) {
+	// user_tokens as created before restriction columns existed, in a
+	// database that predates versioned migrations
+	db, dialect := openTestDB(t, "tokens")
+	if err := database.ApplySchema(db, dialect, `
+		CREATE TABLE schema_version (
+			version INTEGER PRIMARY KEY,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO schema_version (version) VALUES (5);
+		CREATE TABLE user_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			token_prefix TEXT NOT NULL,
+			name TEXT,
+			scopes TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME,
+			last_used_at DATETIME,
+			last_used_ip TEXT
+		)
+	`); err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+	if err := database.MigrateDatabase(db, dialect, database.MigrationsUsers, nil); err != nil {
+		t.Fatalf("MigrateDatabase failed: %v", err)
+	}
+
+	legacy := "usr_" + "0123456789abcdef0123456789abcdef"
+	if _, err := db.Exec(`INSERT INTO user_tokens (user_id, token_hash, token_prefix, name, scopes, created_at) VALUES (1, ?, 'usr_0123', 'old', '', ?)`,
+		HashToken(legacy), time.Now()); err != nil {
+		t.Fatalf("insert legacy token: %v", err)
+	}
+
+	token, err := (&TokenModelV2{DB: db}).ValidateToken(legacy)
+	if err != nil {
+		t.Fatalf("ValidateToken failed: %v", err)
+	}
+	// Tokens created without scopes keep full access
+	if !token.HasScope(ScopeLocationsWrite) || token.RateLimit != 0 || token.LocationID != nil {
+		t.Errorf("legacy token = %+v", token)
+	}
+}
+
+func TestTokenModelV2AdminTokensAndUsage(t *testing.T) {
+	db := setupTokenDB(t, database.ServerSchema)
+	tokens := &TokenModelV2{DB: db}
+
+	created, err := tokens.CreateToken(OwnerTypeAdmin, 1, "backups", "admin:backup", 0)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	validated, err := tokens.ValidateToken(created.Token)
+	if err != nil {
+		t.Fatalf("ValidateToken failed: %v", err)
+	}
+	if validated.OwnerType != OwnerTypeAdmin || !validated.HasScope(ScopeAdminBackup) || validated.HasScope(ScopeAdminWrite) {
+		t.Errorf("unexpected admin token %+v", validated)
+	}
+
+	usage := &TokenUsageModel{DB: db}
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := usage.Record(validated, "POST /server/backup", false, now); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	if err := usage.Record(validated, "GET /server/backup", true, now.Add(-48*time.Hour)); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	summary, err := usage.Summary(OwnerTypeAdmin, validated.ID, now.Add(-7*24*time.Hour))
+	if err != nil {
+		t.Fatalf("Summary failed: %v", err)
+	}
+	if summary.Requests != 4 || summary.Errors != 1 || summary.LastDay != 3 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if len(summary.TopRoutes) != 2 || summary.TopRoutes[0].Route != "POST /server/backup" || summary.TopRoutes[0].Requests != 3 {
+		t.Errorf("top routes = %+v", summary.TopRoutes)
+	}
+}
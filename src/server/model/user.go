@@ -105,6 +105,8 @@ type UserPasswordReset struct {
 	ID        int64      `json:"id"`
 	UserID    int64      `json:"user_id"`
 	Token     string     `json:"token"`
+	// Address the reset was requested from
+	IPAddress string     `json:"ip_address,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
 	// 1 hour from creation
 	ExpiresAt time.Time  `json:"expires_at"`
@@ -152,23 +154,35 @@ func (r *UserPasswordReset) IsUsed() bool {
 // Per TEMPLATE.md PART 9: All operations MUST use users.db
 type UserModel struct {
 	DB *sql.DB
+	// Lockout overrides the security.* lockout settings
+	Lockout *LockoutPolicy
 }
 
 // Create creates a new user account
 // Per TEMPLATE.md PART 0: Uses Argon2id for password hashing
 func (m *UserModel) Create(username, email, password string, role ...string) (*User, error) {
-	// Default role to "user" if not provided
-	userRole := "user"
-	if len(role) > 0 && role[0] != "" {
-		userRole = role[0]
-	}
-
 	// Hash password using Argon2id (TEMPLATE.md PART 0 requirement)
 	passwordHash, err := HashPassword(password)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
+	return m.create(username, email, passwordHash, role...)
+}
+
+// CreatePasswordless creates a passkey-only user with no password hash;
+// password login always fails for these accounts
+func (m *UserModel) CreatePasswordless(username, email string, role ...string) (*User, error) {
+	return m.create(username, email, "", role...)
+}
+
+func (m *UserModel) create(username, email, passwordHash string, role ...string) (*User, error) {
+	// Default role to "user" if not provided
+	userRole := "user"
+	if len(role) > 0 && role[0] != "" {
+		userRole = role[0]
+	}
+
 	// Insert user into users.db
 	result, err := database.GetUsersDB().Exec(`
 		INSERT INTO user_accounts (username, email, password_hash, role, email_verified, is_active, is_banned, two_factor_enabled, created_at, updated_at)
@@ -500,6 +514,22 @@ func (m *UserModel) Update(id int64, username, email string, role ...string) err
 	return nil
 }
 
+// UpdateRole changes a user's role
+func (m *UserModel) UpdateRole(id int64, role string) error {
+	result, err := database.GetUsersDB().Exec(`
+		UPDATE user_accounts
+		SET role = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, role, id)
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
 // UpdatePassword updates a user's password using Argon2id
 // Per TEMPLATE.md PART 0: MUST use Argon2id for password hashing
 func (m *UserModel) UpdatePassword(id int64, newPassword string) error {
@@ -519,7 +549,7 @@ func (m *UserModel) UpdatePassword(id int64, newPassword string) error {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
 
-	return nil
+	return (&LoginStateModel{}).ClearBreachNotified(id)
 }
 
 // UpdateLastLogin updates the last login timestamp and IP
@@ -609,6 +639,9 @@ func (m *UserModel) Delete(id int64) error {
 
 // VerifyCredentials verifies username/password and returns user if valid
 // Per TEMPLATE.md PART 0: Uses Argon2id for password verification
+// Failed passwords count towards the lockout policy (LoadLockoutPolicy unless
+// Lockout is set); a locked account returns *AccountLockedError without
+// checking the password.
 func (m *UserModel) VerifyCredentials(username, password string) (*User, error) {
 	// Get user by username or email
 	user, err := m.GetByUsername(username)
@@ -620,6 +653,20 @@ func (m *UserModel) VerifyCredentials(username, password string) (*User, error)
 		}
 	}
 
+	policy := LoadLockoutPolicy()
+	if m.Lockout != nil {
+		policy = *m.Lockout
+	}
+	loginState := &LoginStateModel{}
+	now := time.Now()
+	state, err := loginState.Get(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if state.Locked(now) {
+		return nil, &AccountLockedError{UserID: user.ID, Until: *state.LockedUntil}
+	}
+
 	// Verify password with Argon2id
 	valid, err := VerifyPassword(password, user.PasswordHash)
 	if err != nil {
@@ -627,6 +674,10 @@ func (m *UserModel) VerifyCredentials(username, password string) (*User, error)
 	}
 
 	if !valid {
+		state, err := loginState.RecordFailure(user.ID, policy, now)
+		if err == nil && state.Locked(now) {
+			return nil, &AccountLockedError{UserID: user.ID, Until: *state.LockedUntil, Started: true}
+		}
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
@@ -640,6 +691,12 @@ func (m *UserModel) VerifyCredentials(username, password string) (*User, error)
 		return nil, fmt.Errorf("account is banned: %s", user.BanReason)
 	}
 
+	if state.FailedAttempts > 0 || state.Lockouts > 0 {
+		if err := loginState.RecordSuccess(user.ID); err != nil {
+			return nil, err
+		}
+	}
+
 	return user, nil
 }
 
@@ -703,6 +760,12 @@ func (m *UserModel) GetByIdentifier(identifier string) (*User, error) {
 	return m.GetByEmail(identifier)
 }
 
+// HasPassword reports whether the user can sign in with a password;
+// passkey-only accounts have no password hash
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
 // CheckPassword verifies a user's password
 func (m *UserModel) CheckPassword(user *User, password string) bool {
 	valid, err := VerifyPassword(password, user.PasswordHash)
@@ -1200,56 +1263,8 @@ func (m *UserInviteModel) getDB() *sql.DB {
 	return database.GetUsersDB()
 }
 
-func (m *UserInviteModel) ensureInviteSchema() error {
-	rows, err := m.getDB().Query(`PRAGMA table_info(user_invites)`)
-	if err != nil {
-		return fmt.Errorf("failed to inspect user_invites schema: %w", err)
-	}
-	defer rows.Close()
-
-	hasUsername := false
-	hasRole := false
-
-	for rows.Next() {
-		var cid int
-		var name string
-		var columnType string
-		var notNull int
-		var defaultValue sql.NullString
-		var pk int
-		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
-			return fmt.Errorf("failed to scan user_invites schema: %w", err)
-		}
-
-		switch name {
-		case "username":
-			hasUsername = true
-		case "role":
-			hasRole = true
-		}
-	}
-
-	if !hasUsername {
-		if _, err := m.getDB().Exec(`ALTER TABLE user_invites ADD COLUMN username TEXT`); err != nil {
-			return fmt.Errorf("failed to add user_invites.username: %w", err)
-		}
-	}
-
-	if !hasRole {
-		if _, err := m.getDB().Exec(`ALTER TABLE user_invites ADD COLUMN role TEXT NOT NULL DEFAULT 'user'`); err != nil {
-			return fmt.Errorf("failed to add user_invites.role: %w", err)
-		}
-	}
-
-	return nil
-}
-
 // CreateInvite creates a new user invite
 func (m *UserInviteModel) CreateInvite(username, email, role string, expiresInDays int) (*UserInvite, error) {
-	if err := m.ensureInviteSchema(); err != nil {
-		return nil, err
-	}
-
 	// Generate random token
 	token, err := GenerateSecureToken(32)
 	if err != nil {
@@ -1296,10 +1311,6 @@ func (m *UserInviteModel) CreateInvite(username, email, role string, expiresInDa
 
 // GetByToken retrieves invite by token
 func (m *UserInviteModel) GetByToken(token string) (*UserInvite, error) {
-	if err := m.ensureInviteSchema(); err != nil {
-		return nil, err
-	}
-
 	var invite UserInvite
 	var createdBy sql.NullInt64
 	var usedAt sql.NullTime
@@ -1341,10 +1352,6 @@ func (m *UserInviteModel) GetByToken(token string) (*UserInvite, error) {
 
 // GetByID retrieves invite by numeric identifier.
 func (m *UserInviteModel) GetByID(id int64) (*UserInvite, error) {
-	if err := m.ensureInviteSchema(); err != nil {
-		return nil, err
-	}
-
 	var invite UserInvite
 	var createdBy sql.NullInt64
 	var usedAt sql.NullTime
@@ -1408,10 +1415,6 @@ func (m *UserInviteModel) VerifyInvite(token string) (*UserInvite, error) {
 
 // MarkUsed marks invite as used.
 func (m *UserInviteModel) MarkUsed(token string, usedBy int64) error {
-	if err := m.ensureInviteSchema(); err != nil {
-		return err
-	}
-
 	_, err := m.getDB().Exec(`
 		UPDATE user_invites
 		SET used_by = ?, used_at = datetime('now'), use_count = use_count + 1
@@ -1427,10 +1430,6 @@ func (m *UserInviteModel) MarkUsed(token string, usedBy int64) error {
 
 // DeleteExpiredInvites removes expired invites
 func (m *UserInviteModel) DeleteExpiredInvites() error {
-	if err := m.ensureInviteSchema(); err != nil {
-		return err
-	}
-
 	_, err := m.getDB().Exec(`
 		DELETE FROM user_invites
 		WHERE expires_at < datetime('now') OR used_at IS NOT NULL
@@ -1445,10 +1444,6 @@ func (m *UserInviteModel) DeleteExpiredInvites() error {
 
 // ListInvites returns all invites ordered by creation time.
 func (m *UserInviteModel) ListInvites() ([]UserInvite, error) {
-	if err := m.ensureInviteSchema(); err != nil {
-		return nil, err
-	}
-
 	rows, err := m.getDB().Query(`
 		SELECT id, code, COALESCE(username, ''), COALESCE(email, ''), COALESCE(role, 'user'), invited_by, created_at, expires_at, max_uses, use_count, used_at
 		FROM user_invites
@@ -1516,10 +1511,6 @@ func (m *UserInviteModel) GetPendingInvites() ([]UserInvite, error) {
 
 // DeleteInvite removes an invite by identifier.
 func (m *UserInviteModel) DeleteInvite(id int64) error {
-	if err := m.ensureInviteSchema(); err != nil {
-		return err
-	}
-
 	_, err := m.getDB().Exec(`DELETE FROM user_invites WHERE id = ?`, id)
 	if err != nil {
 		return fmt.Errorf("failed to delete invite: %w", err)
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+// UserDevice is a browser or client a user has logged in from. Devices are
+// recognised by a fingerprint of the browser family, OS and network (ASN);
+// removing one makes the next login from it alert again.
+type UserDevice struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Fingerprint string    `json:"-"`
+	Name        string    `json:"name"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	LastIP      string    `json:"last_ip,omitempty"`
+	ASN         uint      `json:"asn,omitempty"`
+	ASNOrg      string    `json:"asn_org,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	Latitude    *float64  `json:"latitude,omitempty"`
+	Longitude   *float64  `json:"longitude,omitempty"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// UserDeviceModel handles user_devices
+type UserDeviceModel struct {
+	DB *sql.DB
+}
+
+func (m *UserDeviceModel) getDB() *sql.DB {
+	if m.DB != nil {
+		return m.DB
+	}
+	return database.GetUsersDB()
+}
+
+const userDeviceColumns = `id, user_id, fingerprint, name, user_agent, last_ip, asn, asn_org, location,
+	latitude, longitude, first_seen_at, last_seen_at`
+
+func scanUserDevice(row interface{ Scan(...interface{}) error }) (*UserDevice, error) {
+	var d UserDevice
+	var userAgent, lastIP, asnOrg, location sql.NullString
+	var latitude, longitude sql.NullFloat64
+	if err := row.Scan(&d.ID, &d.UserID, &d.Fingerprint, &d.Name, &userAgent, &lastIP, &d.ASN, &asnOrg, &location,
+		&latitude, &longitude, &d.FirstSeenAt, &d.LastSeenAt); err != nil {
+		return nil, err
+	}
+	d.UserAgent = userAgent.String
+	d.LastIP = lastIP.String
+	d.ASNOrg = asnOrg.String
+	d.Location = location.String
+	if latitude.Valid && longitude.Valid {
+		d.Latitude = &latitude.Float64
+		d.Longitude = &longitude.Float64
+	}
+	return &d, nil
+}
+
+// GetByFingerprint returns the user's device with the fingerprint
+func (m *UserDeviceModel) GetByFingerprint(userID int64, fingerprint string) (*UserDevice, error) {
+	return scanUserDevice(m.getDB().QueryRow(
+		`SELECT `+userDeviceColumns+` FROM user_devices WHERE user_id = ? AND fingerprint = ?`,
+		userID, fingerprint))
+}
+
+// Latest returns the device the user logged in from most recently
+func (m *UserDeviceModel) Latest(userID int64) (*UserDevice, error) {
+	return scanUserDevice(m.getDB().QueryRow(
+		`SELECT `+userDeviceColumns+` FROM user_devices WHERE user_id = ? ORDER BY last_seen_at DESC, id DESC LIMIT 1`,
+		userID))
+}
+
+// ListByUser returns the user's devices, most recently used first
+func (m *UserDeviceModel) ListByUser(userID int64) ([]*UserDevice, error) {
+	rows, err := m.getDB().Query(
+		`SELECT `+userDeviceColumns+` FROM user_devices WHERE user_id = ? ORDER BY last_seen_at DESC, id DESC`,
+		userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []*UserDevice{}
+	for rows.Next() {
+		device, err := scanUserDevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device: %w", err)
+		}
+		devices = append(devices, device)
+	}
+	return devices, rows.Err()
+}
+
+// Save inserts the device, or updates the last seen details of the user's
+// device with the same fingerprint
+func (m *UserDeviceModel) Save(d *UserDevice) error {
+	if d.LastSeenAt.IsZero() {
+		d.LastSeenAt = time.Now()
+	}
+	if d.FirstSeenAt.IsZero() {
+		d.FirstSeenAt = d.LastSeenAt
+	}
+
+	err := m.getDB().QueryRow(`
+		INSERT INTO user_devices (user_id, fingerprint, name, user_agent, last_ip, asn, asn_org, location,
+			latitude, longitude, first_seen_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, fingerprint) DO UPDATE SET
+			name = excluded.name,
+			user_agent = excluded.user_agent,
+			last_ip = excluded.last_ip,
+			asn_org = excluded.asn_org,
+			location = excluded.location,
+			latitude = excluded.latitude,
+			longitude = excluded.longitude,
+			last_seen_at = excluded.last_seen_at
+		RETURNING id, first_seen_at
+	`, d.UserID, d.Fingerprint, d.Name, d.UserAgent, d.LastIP, d.ASN, d.ASNOrg, d.Location,
+		d.Latitude, d.Longitude, d.FirstSeenAt, d.LastSeenAt).Scan(&d.ID, &d.FirstSeenAt)
+	if err != nil {
+		return fmt.Errorf("failed to save device: %w", err)
+	}
+	return nil
+}
+
+// Delete removes one of the user's devices
+func (m *UserDeviceModel) Delete(userID, id int64) error {
+	result, err := m.getDB().Exec(`DELETE FROM user_devices WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete device: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
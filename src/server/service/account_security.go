@@ -0,0 +1,407 @@
+package service
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/utils"
+)
+
+// Logins further apart than this, faster than security.impossible_travel_speed,
+// are reported as impossible travel. Below it GeoIP city accuracy makes
+// the speed meaningless.
+const impossibleTravelMinKm = 500
+
+// AccountMailer sends account security emails; *SMTPService implements it
+type AccountMailer interface {
+	SendTemplate(to, name string, vars map[string]string) error
+}
+
+// LoginContext describes the request a login came from
+type LoginContext struct {
+	IP        string
+	UserAgent string
+	// Base URL for links in emails, e.g. https://wthr.top
+	AppURL string
+}
+
+// LoginLocation is what GeoIP knows about a login address
+type LoginLocation struct {
+	ASN            uint
+	ASNOrg         string
+	Place          string
+	Latitude       float64
+	Longitude      float64
+	HasCoordinates bool
+}
+
+// LoginAssessment is the outcome of checking a successful login
+type LoginAssessment struct {
+	Device           *models.UserDevice `json:"device"`
+	NewDevice        bool               `json:"new_device"`
+	ImpossibleTravel bool               `json:"impossible_travel"`
+	DistanceKm       float64            `json:"distance_km,omitempty"`
+	SpeedKmh         float64            `json:"speed_kmh,omitempty"`
+	AlertSent        bool               `json:"alert_sent"`
+}
+
+// AccountSecurityService checks passwords against the breached password
+// dataset, and records the device of every login to send login_alert when
+// a user logs in from a new device or from somewhere they cannot have
+// travelled to since their last login
+type AccountSecurityService struct {
+	usersDB  *sql.DB
+	serverDB *sql.DB
+	pwned    *PwnedPasswordService
+
+	mu     sync.RWMutex
+	geoip  *GeoIPService
+	audit  *AuditLogger
+	mailer AccountMailer
+
+	// Overridable for tests
+	now    func() time.Time
+	locate func(ip string) LoginLocation
+}
+
+// NewAccountSecurityService creates the service. Emails go out through the
+// SMTP settings in serverDB.
+func NewAccountSecurityService(usersDB, serverDB *sql.DB, pwned *PwnedPasswordService) *AccountSecurityService {
+	s := &AccountSecurityService{
+		usersDB:  usersDB,
+		serverDB: serverDB,
+		pwned:    pwned,
+		mailer:   NewSMTPService(serverDB),
+		now:      time.Now,
+	}
+	s.locate = s.geoLocate
+	return s
+}
+
+// SetGeoIP enables ASN and location lookups for device recognition and
+// impossible travel
+func (s *AccountSecurityService) SetGeoIP(geoip *GeoIPService) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.geoip = geoip
+}
+
+// SetAudit writes lockouts, breached passwords and login alerts to the
+// audit log
+func (s *AccountSecurityService) SetAudit(audit *AuditLogger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = audit
+}
+
+// SetMailer replaces the SMTP mailer
+func (s *AccountSecurityService) SetMailer(mailer AccountMailer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mailer = mailer
+}
+
+// PwnedPasswords returns the breached password dataset
+func (s *AccountSecurityService) PwnedPasswords() *PwnedPasswordService {
+	return s.pwned
+}
+
+func (s *AccountSecurityService) setting(key, defaultValue string) string {
+	if s.serverDB == nil {
+		return defaultValue
+	}
+	var value string
+	if err := s.serverDB.QueryRow("SELECT value FROM server_config WHERE key = ?", key).Scan(&value); err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func (s *AccountSecurityService) settingBool(key string, defaultValue bool) bool {
+	value := s.setting(key, strconv.FormatBool(defaultValue))
+	return value == "true" || value == "1"
+}
+
+func (s *AccountSecurityService) breachCheckEnabled() bool {
+	return s.pwned != nil && s.pwned.Available() && s.settingBool("security.breached_password_check", true)
+}
+
+func (s *AccountSecurityService) breachCount(password string) int {
+	count, err := s.pwned.Count(password)
+	if err != nil {
+		// Fail open: a damaged dataset must not stop logins or password changes
+		log.Printf("Breached password check failed: %v", err)
+		return 0
+	}
+	return count
+}
+
+// CheckNewPassword returns ErrPasswordBreached when a password being set
+// appears in the breached password dataset
+func (s *AccountSecurityService) CheckNewPassword(password string) error {
+	if s == nil || !s.breachCheckEnabled() {
+		return nil
+	}
+	if s.breachCount(password) > 0 {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+// PasswordVerified is called after a user's password was accepted. When the
+// password is in the breached password dataset the user gets
+// breach_notification, once per password.
+func (s *AccountSecurityService) PasswordVerified(user *models.User, password string, ctx LoginContext) {
+	if s == nil || !s.breachCheckEnabled() {
+		return
+	}
+	count := s.breachCount(password)
+	if count == 0 {
+		return
+	}
+
+	first, err := (&models.LoginStateModel{DB: s.usersDB}).MarkBreachNotified(user.ID, s.now())
+	if err != nil {
+		log.Printf("Breached password notice for user %d: %v", user.ID, err)
+		return
+	}
+	if !first {
+		return
+	}
+
+	s.auditLog(EventUserSecurityAlert, "warn", user, ctx, map[string]interface{}{
+		"alert":       "breached_password",
+		"occurrences": count,
+	})
+	s.sendMail(user, "breach_notification", ctx, map[string]string{
+		"breach_description": fmt.Sprintf("The password you signed in with has appeared %d time(s) in public data breaches from other websites. "+
+			"Attackers try these passwords against every site, so it is no longer safe to use.", count),
+		"incident_date":     "Not applicable - the breach was not on " + s.appName(),
+		"discovery_date":    s.now().Format("2006-01-02"),
+		"affected_data":     "Your password. Your account on this site has not been accessed by anyone else as far as we know.",
+		"remediation_steps": "We checked your password against a local copy of the Have I Been Pwned database; it was never sent anywhere.",
+	})
+}
+
+// AccountLocked records a lock started by too many failed logins
+func (s *AccountSecurityService) AccountLocked(user *models.User, until time.Time, ctx LoginContext) {
+	if s == nil {
+		return
+	}
+	s.auditLog(EventUserAccountLock, "warn", user, ctx, map[string]interface{}{
+		"locked_until": until.UTC().Format(time.RFC3339),
+	})
+}
+
+// LoginSucceeded records the login's device and sends login_alert for a
+// new device or impossible travel. A user's first device never alerts.
+func (s *AccountSecurityService) LoginSucceeded(user *models.User, ctx LoginContext) (*LoginAssessment, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	now := s.now()
+	loc := s.locate(ctx.IP)
+	agent := utils.ParseUserAgent(ctx.UserAgent)
+	devices := &models.UserDeviceModel{DB: s.usersDB}
+
+	previous, err := devices.Latest(user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	fingerprint := DeviceFingerprint(agent, loc.ASN)
+	existing, err := devices.GetByFingerprint(user.ID, fingerprint)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	assessment := &LoginAssessment{NewDevice: existing == nil && previous != nil}
+	if previous != nil && previous.Latitude != nil && loc.HasCoordinates {
+		distance := haversineDistance(*previous.Latitude, *previous.Longitude, loc.Latitude, loc.Longitude)
+		hours := max(now.Sub(previous.LastSeenAt).Hours(), 1.0/60)
+		maxSpeed, _ := strconv.ParseFloat(s.setting("security.impossible_travel_speed", "1000"), 64)
+		if distance >= impossibleTravelMinKm && maxSpeed > 0 && distance/hours > maxSpeed {
+			assessment.ImpossibleTravel = true
+			assessment.DistanceKm = distance
+			assessment.SpeedKmh = distance / hours
+		}
+	}
+
+	device := &models.UserDevice{
+		UserID:      user.ID,
+		Fingerprint: fingerprint,
+		Name:        agent.String(),
+		UserAgent:   ctx.UserAgent,
+		LastIP:      ctx.IP,
+		ASN:         loc.ASN,
+		ASNOrg:      loc.ASNOrg,
+		Location:    loc.Place,
+		LastSeenAt:  now,
+	}
+	if loc.HasCoordinates {
+		device.Latitude = &loc.Latitude
+		device.Longitude = &loc.Longitude
+	}
+	if err := devices.Save(device); err != nil {
+		return nil, err
+	}
+	assessment.Device = device
+
+	if !assessment.NewDevice && !assessment.ImpossibleTravel {
+		return assessment, nil
+	}
+
+	details := map[string]interface{}{
+		"device":            device.Name,
+		"device_id":         device.ID,
+		"new_device":        assessment.NewDevice,
+		"impossible_travel": assessment.ImpossibleTravel,
+	}
+	event, severity, reason := EventUserDeviceAdd, "info", "Login from a new device"
+	if assessment.ImpossibleTravel {
+		details["distance_km"] = int(assessment.DistanceKm)
+		details["speed_kmh"] = int(assessment.SpeedKmh)
+		details["previous_location"] = previous.Location
+		event, severity = EventUserSuspiciousActivity, "warn"
+		reason = fmt.Sprintf("Login %.0f km from your previous login (%s) %s later, faster than travel allows",
+			assessment.DistanceKm, placeOrUnknown(previous.Location), formatTravelTime(now.Sub(previous.LastSeenAt)))
+	}
+	s.auditLog(event, severity, user, ctx, details)
+
+	if s.settingBool("security.login_alerts", true) {
+		s.sendMail(user, "login_alert", ctx, map[string]string{
+			"time":         now.UTC().Format("2006-01-02 15:04:05 UTC"),
+			"ip":           ctx.IP,
+			"location":     placeOrUnknown(loc.Place),
+			"device":       device.Name,
+			"alert_reason": reason,
+		})
+		assessment.AlertSent = true
+	}
+	return assessment, nil
+}
+
+// Devices lists the user's known devices
+func (s *AccountSecurityService) Devices(userID int64) ([]*models.UserDevice, error) {
+	return (&models.UserDeviceModel{DB: s.usersDB}).ListByUser(userID)
+}
+
+// RevokeDevice forgets one of the user's devices; the next login from it
+// sends a login alert again
+func (s *AccountSecurityService) RevokeDevice(user *models.User, deviceID int64, ctx LoginContext) error {
+	if err := (&models.UserDeviceModel{DB: s.usersDB}).Delete(user.ID, deviceID); err != nil {
+		return err
+	}
+	s.auditLog(EventUserDeviceRemove, "info", user, ctx, map[string]interface{}{"device_id": deviceID})
+	return nil
+}
+
+// DeviceFingerprint identifies a device by browser family, OS and network.
+// Versions and the exact IP are left out so updates and DHCP changes do not
+// look like a new device.
+func DeviceFingerprint(agent utils.UserAgentInfo, asn uint) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%t|%d", agent.Browser, agent.OS, agent.Mobile, asn)))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (s *AccountSecurityService) geoLocate(ip string) LoginLocation {
+	s.mu.RLock()
+	geoip := s.geoip
+	s.mu.RUnlock()
+
+	var loc LoginLocation
+	if geoip == nil || !geoip.IsEnabled() {
+		return loc
+	}
+	if asn, org, err := geoip.LookupASN(ip); err == nil {
+		loc.ASN, loc.ASNOrg = asn, org
+	}
+	if data, err := geoip.LookupIP(ip); err == nil {
+		var parts []string
+		for _, part := range []string{data.City, data.Region, data.Country} {
+			if part != "" {
+				parts = append(parts, part)
+			}
+		}
+		loc.Place = strings.Join(parts, ", ")
+		// The country database has no coordinates
+		if data.City != "" {
+			loc.Latitude, loc.Longitude, loc.HasCoordinates = data.Latitude, data.Longitude, true
+		}
+	}
+	return loc
+}
+
+func (s *AccountSecurityService) appName() string {
+	return s.setting("server.title", "Weather Service")
+}
+
+func (s *AccountSecurityService) sendMail(user *models.User, template string, ctx LoginContext, vars map[string]string) {
+	s.mu.RLock()
+	mailer := s.mailer
+	s.mu.RUnlock()
+	if mailer == nil || user.Email == "" {
+		return
+	}
+
+	vars["recipient_username"] = user.Username
+	vars["app_name"] = s.appName()
+	if ctx.AppURL != "" {
+		vars["app_url"] = strings.TrimRight(ctx.AppURL, "/")
+	}
+	go func() {
+		if err := mailer.SendTemplate(user.Email, template, vars); err != nil {
+			log.Printf("Failed to send %s to user %d: %v", template, user.ID, err)
+		}
+	}()
+}
+
+func (s *AccountSecurityService) auditLog(event EventType, severity string, user *models.User, ctx LoginContext, details map[string]interface{}) {
+	s.mu.RLock()
+	audit := s.audit
+	s.mu.RUnlock()
+	if audit == nil {
+		return
+	}
+
+	err := audit.Log(AuditEvent{
+		Event:    string(event),
+		Category: "security",
+		Severity: severity,
+		Actor: Actor{
+			Type:      "user",
+			ID:        strconv.FormatInt(user.ID, 10),
+			IP:        ctx.IP,
+			UserAgent: ctx.UserAgent,
+		},
+		Target:  &Target{Type: "user", ID: user.Username},
+		Details: details,
+		Result:  "success",
+	})
+	if err != nil {
+		log.Printf("Account security: audit log failed: %v", err)
+	}
+}
+
+func placeOrUnknown(place string) string {
+	if place == "" {
+		return "Unknown location"
+	}
+	return place
+}
+
+func formatTravelTime(d time.Duration) string {
+	if d < time.Hour {
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%.1f hours", d.Hours())
+}
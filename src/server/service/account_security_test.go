@@ -0,0 +1,193 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/server/model"
+)
+
+type sentMail struct {
+	to, template string
+	vars         map[string]string
+}
+
+type fakeAccountMailer struct {
+	sent chan sentMail
+}
+
+func (m *fakeAccountMailer) SendTemplate(to, name string, vars map[string]string) error {
+	m.sent <- sentMail{to: to, template: name, vars: vars}
+	return nil
+}
+
+func (m *fakeAccountMailer) next(t *testing.T) sentMail {
+	t.Helper()
+	select {
+	case mail := <-m.sent:
+		return mail
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an email")
+		return sentMail{}
+	}
+}
+
+func (m *fakeAccountMailer) none(t *testing.T) {
+	t.Helper()
+	select {
+	case mail := <-m.sent:
+		t.Fatalf("Unexpected %s email", mail.template)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+const (
+	chromeWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+	firefoxLinux  = "Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0"
+)
+
+func setupAccountSecurity(t *testing.T, pwned *PwnedPasswordService) (*AccountSecurityService, *fakeAccountMailer, *models.User, *time.Time) {
+	t.Helper()
+	usersDB, serverDB := setupLDAPSyncDB(t)
+	if _, err := usersDB.Exec(`INSERT INTO user_accounts (id, username, email, password_hash, role) VALUES (1, 'jane', 'jane@example.org', 'x', 'user')`); err != nil {
+		t.Fatal(err)
+	}
+
+	mailer := &fakeAccountMailer{sent: make(chan sentMail, 10)}
+	s := NewAccountSecurityService(usersDB, serverDB, pwned)
+	s.SetMailer(mailer)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	s.locate = func(ip string) LoginLocation {
+		switch ip {
+		case "203.0.113.10":
+			return LoginLocation{ASN: 3320, ASNOrg: "Deutsche Telekom", Place: "Berlin, Germany", Latitude: 52.52, Longitude: 13.405, HasCoordinates: true}
+		case "203.0.113.20":
+			return LoginLocation{ASN: 3320, ASNOrg: "Deutsche Telekom", Place: "Sydney, Australia", Latitude: -33.87, Longitude: 151.21, HasCoordinates: true}
+		}
+		return LoginLocation{}
+	}
+
+	user := &models.User{ID: 1, Username: "jane", Email: "jane@example.org"}
+	return s, mailer, user, &now
+}
+
+func TestLoginSucceededNewDevice(t *testing.T) {
+	s, mailer, user, now := setupAccountSecurity(t, nil)
+	berlinChrome := LoginContext{IP: "203.0.113.10", UserAgent: chromeWindows}
+
+	// The first device is trusted without an alert
+	assessment, err := s.LoginSucceeded(user, berlinChrome)
+	if err != nil {
+		t.Fatalf("LoginSucceeded: %v", err)
+	}
+	if assessment.NewDevice || assessment.AlertSent {
+		t.Fatalf("First login = %+v, want no alert", assessment)
+	}
+	if assessment.Device.Name != "Chrome on Windows" {
+		t.Errorf("Device name = %q", assessment.Device.Name)
+	}
+
+	*now = now.Add(time.Hour)
+	assessment, err = s.LoginSucceeded(user, berlinChrome)
+	if err != nil || assessment.NewDevice {
+		t.Fatalf("Known device = %+v, %v; want no alert", assessment, err)
+	}
+	mailer.none(t)
+
+	*now = now.Add(time.Hour)
+	assessment, err = s.LoginSucceeded(user, LoginContext{IP: "203.0.113.10", UserAgent: firefoxLinux})
+	if err != nil {
+		t.Fatalf("LoginSucceeded: %v", err)
+	}
+	if !assessment.NewDevice || !assessment.AlertSent {
+		t.Fatalf("New device = %+v, want an alert", assessment)
+	}
+	mail := mailer.next(t)
+	if mail.template != "login_alert" || mail.to != user.Email || mail.vars["device"] != "Firefox on Linux" {
+		t.Errorf("Alert = %+v", mail)
+	}
+
+	devices, err := s.Devices(user.ID)
+	if err != nil || len(devices) != 2 {
+		t.Fatalf("Devices = %d, %v; want 2", len(devices), err)
+	}
+
+	// A removed device alerts again on its next login
+	if err := s.RevokeDevice(user, assessment.Device.ID, LoginContext{}); err != nil {
+		t.Fatalf("RevokeDevice: %v", err)
+	}
+	*now = now.Add(time.Hour)
+	assessment, err = s.LoginSucceeded(user, LoginContext{IP: "203.0.113.10", UserAgent: firefoxLinux})
+	if err != nil || !assessment.NewDevice {
+		t.Fatalf("Revoked device = %+v, %v; want an alert", assessment, err)
+	}
+	mailer.next(t)
+}
+
+func TestLoginSucceededImpossibleTravel(t *testing.T) {
+	s, mailer, user, now := setupAccountSecurity(t, nil)
+
+	if _, err := s.LoginSucceeded(user, LoginContext{IP: "203.0.113.10", UserAgent: chromeWindows}); err != nil {
+		t.Fatalf("LoginSucceeded: %v", err)
+	}
+
+	// Berlin to Sydney is about 16,000 km; two hours later is impossible
+	*now = now.Add(2 * time.Hour)
+	assessment, err := s.LoginSucceeded(user, LoginContext{IP: "203.0.113.20", UserAgent: chromeWindows})
+	if err != nil {
+		t.Fatalf("LoginSucceeded: %v", err)
+	}
+	if assessment.NewDevice || !assessment.ImpossibleTravel || assessment.DistanceKm < 15000 {
+		t.Fatalf("Assessment = %+v, want impossible travel on a known device", assessment)
+	}
+	mail := mailer.next(t)
+	if !strings.Contains(mail.vars["alert_reason"], "Berlin, Germany") || mail.vars["location"] != "Sydney, Australia" {
+		t.Errorf("Alert vars = %v", mail.vars)
+	}
+
+	// Two days later the same trip is plausible
+	*now = now.Add(48 * time.Hour)
+	assessment, err = s.LoginSucceeded(user, LoginContext{IP: "203.0.113.10", UserAgent: chromeWindows})
+	if err != nil || assessment.ImpossibleTravel {
+		t.Fatalf("Assessment = %+v, %v; want no alert", assessment, err)
+	}
+	mailer.none(t)
+}
+
+func TestBreachedPasswordChecks(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "hashes.txt")
+	if err := os.WriteFile(source, []byte(fmt.Sprintf("%s:42\n", pwnedHash("Summer2024!"))), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pwned := NewPwnedPasswordService(filepath.Join(t.TempDir(), "pwned"))
+	if _, err := pwned.Import(source); err != nil {
+		t.Fatal(err)
+	}
+	s, mailer, user, _ := setupAccountSecurity(t, pwned)
+
+	if err := s.CheckNewPassword("Summer2024!"); err != ErrPasswordBreached {
+		t.Errorf("CheckNewPassword(breached) = %v, want ErrPasswordBreached", err)
+	}
+	if err := s.CheckNewPassword("a much longer unbreached passphrase"); err != nil {
+		t.Errorf("CheckNewPassword(unbreached) = %v", err)
+	}
+
+	// Users are told once per password
+	s.PasswordVerified(user, "Summer2024!", LoginContext{})
+	if mail := mailer.next(t); mail.template != "breach_notification" {
+		t.Errorf("Template = %q, want breach_notification", mail.template)
+	}
+	s.PasswordVerified(user, "Summer2024!", LoginContext{})
+	mailer.none(t)
+
+	var nilService *AccountSecurityService
+	if err := nilService.CheckNewPassword("Summer2024!"); err != nil {
+		t.Errorf("nil service CheckNewPassword = %v", err)
+	}
+}
@@ -1,9 +1,10 @@
 package service
 
 import (
+	"crypto/ed25519"
 	"crypto/rand"
-	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
@@ -77,6 +78,7 @@ const (
 	EventAdminDatabaseRestore    EventType = "admin.database.restore"
 	EventAdminDatabaseOptimize   EventType = "admin.database.optimize"
 	EventAdminDatabaseVacuum     EventType = "admin.database.vacuum"
+	EventAdminDatabaseReplay     EventType = "admin.database.replay"
 	EventAdminCacheClear         EventType = "admin.cache.clear"
 	EventAdminCacheFlush         EventType = "admin.cache.flush"
 	EventAdminLogsClear          EventType = "admin.logs.clear"
@@ -128,6 +130,8 @@ const (
 	EventSystemDBConnect     EventType = "system.db.connect"
 	EventSystemDBDisconnect  EventType = "system.db.disconnect"
 	EventSystemDBError       EventType = "system.db.error"
+	EventSystemDBReplayConflict EventType = "system.db.replay.conflict"
+	EventSystemDBDeadLetter     EventType = "system.db.replay.dead_letter"
 	EventSystemCacheConnect  EventType = "system.cache.connect"
 	EventSystemCacheError    EventType = "system.cache.error"
 	EventSystemSMTPConnect   EventType = "system.smtp.connect"
@@ -254,6 +258,11 @@ type AuditEvent struct {
 	NodeID   string                 `json:"node_id,omitempty"`
 	// Optional reason
 	Reason   string                 `json:"reason,omitempty"`
+	// Hash chain: position in the log, SHA-256 of the previous record and
+	// of this record (see audit_chain.go)
+	Seq      int64                  `json:"seq,omitempty"`
+	PrevHash string                 `json:"prev_hash,omitempty"`
+	Hash     string                 `json:"hash,omitempty"`
 
 	// Legacy fields for backwards compatibility
 	// Internal use only
@@ -272,21 +281,65 @@ type AuditEvent struct {
 	EventType EventType `json:"-"`
 }
 
-// AuditLogger handles audit logging
+// AuditLogger handles audit logging. Every record is hash-chained to the
+// one before it, across rotations, and signed checkpoints are written
+// periodically when a signing key is configured.
 type AuditLogger struct {
+	logDir  string
 	logFile string
 	mu      sync.Mutex
 	file    *os.File
+	opts    AuditLoggerOptions
+
+	// Last record written
+	seq      int64
+	lastHash string
+	// Records written since the last checkpoint, and when it was written
+	sinceCheckpoint int
+	lastCheckpoint  time.Time
 }
 
-// NewAuditLogger creates a new audit logger
+// AuditLoggerOptions configures checkpoints and real-time forwarding
+type AuditLoggerOptions struct {
+	// Signs checkpoints; nil disables them
+	SigningKey ed25519.PrivateKey
+	// Write a checkpoint after this many records (default 1000)...
+	CheckpointEvery int
+	// ...or when this much time has passed since the last one (default 1h)
+	CheckpointInterval time.Duration
+	// Written to each record for cluster mode
+	NodeID string
+	// Receive every record as it is written
+	Forwarders []*AuditForwarder
+}
+
+// NewAuditLogger creates a new audit logger without checkpoints or
+// forwarding
 func NewAuditLogger(logDir string) (*AuditLogger, error) {
+	return NewAuditLoggerWithOptions(logDir, AuditLoggerOptions{})
+}
+
+// NewAuditLoggerWithOptions creates a new audit logger. The hash chain
+// continues from the last record in the log directory.
+func NewAuditLoggerWithOptions(logDir string, opts AuditLoggerOptions) (*AuditLogger, error) {
 	// Ensure log directory exists
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create log directory: %w", err)
 	}
 
-	logFile := filepath.Join(logDir, "audit.log")
+	if opts.CheckpointEvery <= 0 {
+		opts.CheckpointEvery = 1000
+	}
+	if opts.CheckpointInterval <= 0 {
+		opts.CheckpointInterval = time.Hour
+	}
+
+	seq, lastHash, err := lastAuditChainRecord(logDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit hash chain: %w", err)
+	}
+
+	logFile := filepath.Join(logDir, AuditLogFileName)
 
 	// Open log file in append mode
 	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
@@ -295,11 +348,30 @@ func NewAuditLogger(logDir string) (*AuditLogger, error) {
 	}
 
 	return &AuditLogger{
-		logFile: logFile,
-		file:    file,
+		logDir:         logDir,
+		logFile:        logFile,
+		file:           file,
+		opts:           opts,
+		seq:            seq,
+		lastHash:       lastHash,
+		lastCheckpoint: time.Now(),
 	}, nil
 }
 
+// PublicKey returns the checkpoint verification key, or nil when
+// checkpoints are disabled
+func (al *AuditLogger) PublicKey() ed25519.PublicKey {
+	if al.opts.SigningKey == nil {
+		return nil
+	}
+	return al.opts.SigningKey.Public().(ed25519.PublicKey)
+}
+
+// LogDir returns the directory holding audit.log and its archives
+func (al *AuditLogger) LogDir() string {
+	return al.logDir
+}
+
 // Log writes an audit event to the log file
 func (al *AuditLogger) Log(event AuditEvent) error {
 	al.mu.Lock()
@@ -324,20 +396,75 @@ func (al *AuditLogger) Log(event AuditEvent) error {
 		}
 	}
 
-	// Marshal event to JSON
-	data, err := json.Marshal(event)
+	if event.NodeID == "" {
+		event.NodeID = al.opts.NodeID
+	}
+
+	if err := al.write(&event); err != nil {
+		return err
+	}
+
+	al.sinceCheckpoint++
+	if al.opts.SigningKey != nil &&
+		(al.sinceCheckpoint >= al.opts.CheckpointEvery || time.Since(al.lastCheckpoint) >= al.opts.CheckpointInterval) {
+		return al.checkpoint()
+	}
+	return nil
+}
+
+// write chains, writes and forwards one record. Callers hold al.mu.
+func (al *AuditLogger) write(event *AuditEvent) error {
+	event.Seq = al.seq + 1
+	event.PrevHash = al.lastHash
+	event.Hash = ""
+
+	line, hash, err := chainAuditRecord(event)
 	if err != nil {
-		return fmt.Errorf("failed to marshal audit event: %w", err)
+		return err
 	}
 
 	// Write to file with newline
-	if _, err := al.file.Write(append(data, '\n')); err != nil {
+	if _, err := al.file.Write(append(line, '\n')); err != nil {
 		return fmt.Errorf("failed to write audit log: %w", err)
 	}
+	al.seq, al.lastHash = event.Seq, hash
+	event.Hash = hash
 
+	for _, forwarder := range al.opts.Forwarders {
+		forwarder.Forward(event, line)
+	}
 	return nil
 }
 
+// checkpoint writes a signed checkpoint covering the last record. Callers
+// hold al.mu.
+func (al *AuditLogger) checkpoint() error {
+	if al.opts.SigningKey == nil || al.seq == 0 {
+		return nil
+	}
+	event := newAuditCheckpoint(al.opts.SigningKey, al.seq, al.lastHash, time.Now().UTC())
+	event.ID = ulid.MustNew(ulid.Timestamp(event.Time), rand.Reader).String()
+	event.NodeID = al.opts.NodeID
+	if err := al.write(&event); err != nil {
+		return err
+	}
+	al.sinceCheckpoint = 0
+	al.lastCheckpoint = time.Now()
+	return nil
+}
+
+// Checkpoint writes a signed checkpoint now, if records were written since
+// the last one
+func (al *AuditLogger) Checkpoint() error {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	if al.sinceCheckpoint == 0 {
+		return nil
+	}
+	return al.checkpoint()
+}
+
 // LogSuccess logs a successful event
 func (al *AuditLogger) LogSuccess(event string, category string, actorType string, actorID string, ip string, details map[string]interface{}) error {
 	return al.Log(AuditEvent{
@@ -375,11 +502,21 @@ func (al *AuditLogger) LogFailure(event string, category string, actorType strin
 	})
 }
 
-// Close closes the audit log file
+// Close writes a final checkpoint and closes the audit log file
 func (al *AuditLogger) Close() error {
 	al.mu.Lock()
 	defer al.mu.Unlock()
 
+	if al.sinceCheckpoint > 0 {
+		if err := al.checkpoint(); err != nil {
+			log.Printf("Audit log: final checkpoint failed: %v", err)
+		}
+	}
+	for _, forwarder := range al.opts.Forwarders {
+		forwarder.Close()
+	}
+	al.opts.Forwarders = nil
+
 	if al.file != nil {
 		return al.file.Close()
 	}
@@ -387,11 +524,21 @@ func (al *AuditLogger) Close() error {
 	return nil
 }
 
-// Rotate rotates the audit log file
+// Rotate rotates the audit log file. The archive ends with a checkpoint and
+// the new file continues the same hash chain.
 func (al *AuditLogger) Rotate() error {
 	al.mu.Lock()
 	defer al.mu.Unlock()
 
+	if info, err := al.file.Stat(); err == nil && info.Size() == 0 {
+		return nil
+	}
+	if al.sinceCheckpoint > 0 {
+		if err := al.checkpoint(); err != nil {
+			return err
+		}
+	}
+
 	// Close current file
 	if al.file != nil {
 		al.file.Close()
@@ -441,7 +588,7 @@ func GetEventTypes() []EventType {
 		EventAdminUserUpdate, EventAdminUserDelete, EventAdminUserImpersonate,
 		EventAdminRoleCreate, EventAdminRoleUpdate, EventAdminRoleDelete, EventAdminRoleAssign,
 		EventAdminDatabaseBackup, EventAdminDatabaseRestore, EventAdminDatabaseOptimize,
-		EventAdminDatabaseVacuum, EventAdminCacheClear, EventAdminCacheFlush,
+		EventAdminDatabaseVacuum, EventAdminDatabaseReplay, EventAdminCacheClear, EventAdminCacheFlush,
 		EventAdminLogsClear, EventAdminLogsRotate, EventAdminLogsDownload,
 		EventAdminEmailTemplateEdit, EventAdminEmailTest, EventAdminNotificationSend,
 		EventAdminSystemRestart, EventAdminSystemShutdown, EventAdminConfigReload,
@@ -458,7 +605,7 @@ func GetEventTypes() []EventType {
 		EventSystemBackupFail, EventSystemRestoreStart, EventSystemRestoreFinish,
 		EventSystemRestoreFail, EventSystemTaskStart, EventSystemTaskFinish,
 		EventSystemTaskFail, EventSystemDiskLow, EventSystemMemoryHigh, EventSystemCPUHigh,
-		EventSystemDBConnect, EventSystemDBDisconnect, EventSystemDBError,
+		EventSystemDBConnect, EventSystemDBDisconnect, EventSystemDBError, EventSystemDBReplayConflict, EventSystemDBDeadLetter,
 		EventSystemCacheConnect, EventSystemCacheError, EventSystemSMTPConnect,
 		EventSystemSMTPError, EventSystemAPIError, EventSystemRateLimit, EventSystemFirewall,
 		EventSystemSSLError, EventSystemSSLExpiring, EventSystemSSLRenew,
@@ -0,0 +1,557 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The audit log is a hash chain. Each record is written as its JSON body
+// (which includes seq and prev_hash) followed by a "hash" field holding the
+// SHA-256 of that body, so editing, removing or reordering a record breaks
+// the chain. The chain continues across rotations. Checkpoint records sign
+// the latest seq and hash with the server's Ed25519 key, so the chain cannot
+// be silently rebuilt by someone without the key.
+
+// AuditLogFileName is the active audit log; rotated archives are named
+// audit.log.<suffix>
+const AuditLogFileName = "audit.log"
+
+// AuditSigningKeyFile holds the checkpoint signing key in the config
+// directory
+const AuditSigningKeyFile = "audit_signing.key"
+
+// AuditEventCheckpoint is the event name of signed checkpoint records
+const AuditEventCheckpoint = "audit.checkpoint"
+
+// Lines longer than this are reported as corrupt
+const maxAuditLineSize = 1 << 20
+
+// Audit verification issue kinds
+const (
+	// Not a valid audit record
+	AuditIssueCorrupt = "corrupt"
+	// Record content does not match its hash
+	AuditIssueEdited = "edited"
+	// Sequence numbers missing
+	AuditIssueGap = "gap"
+	// Record does not link to the one before it
+	AuditIssueBroken = "broken_link"
+	// Sequence number repeats or goes back
+	AuditIssueReordered = "reordered"
+	// Record without a hash after the chain started
+	AuditIssueUnchained = "unchained"
+	// Checkpoint signature or coverage is wrong
+	AuditIssueSignature = "signature"
+)
+
+// Verification stops listing issues after this many
+const maxAuditIssues = 100
+
+// chainAuditRecord returns the line to write for event, whose Seq and
+// PrevHash are set, and the record's hash
+func chainAuditRecord(event *AuditEvent) ([]byte, string, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+
+	line := make([]byte, 0, len(body)+len(hash)+12)
+	line = append(line, body[:len(body)-1]...)
+	line = append(line, `,"hash":"`...)
+	line = append(line, hash...)
+	line = append(line, `"}`...)
+	return line, hash, nil
+}
+
+// splitAuditRecord separates a chained line into the hashed body and the
+// hash it claims
+func splitAuditRecord(line []byte) ([]byte, string, bool) {
+	const suffixLen = len(`,"hash":"`) + sha256.Size*2 + len(`"}`)
+	if len(line) < suffixLen+2 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return nil, "", false
+	}
+	suffix := line[len(line)-suffixLen:]
+	if !bytes.HasPrefix(suffix, []byte(`,"hash":"`)) {
+		return nil, "", false
+	}
+	hash := string(suffix[len(`,"hash":"`) : len(suffix)-2])
+	if _, err := hex.DecodeString(hash); err != nil {
+		return nil, "", false
+	}
+	body := make([]byte, 0, len(line)-suffixLen+1)
+	body = append(body, line[:len(line)-suffixLen]...)
+	body = append(body, '}')
+	return body, hash, true
+}
+
+// auditChainFields are the parts of a record verification needs
+type auditChainFields struct {
+	Seq      int64           `json:"seq"`
+	PrevHash string          `json:"prev_hash"`
+	Event    string          `json:"event"`
+	Time     time.Time       `json:"time"`
+	Details  json.RawMessage `json:"details"`
+}
+
+// auditCheckpointDetails are the details of a checkpoint record
+type auditCheckpointDetails struct {
+	CoversSeq  int64  `json:"covers_seq"`
+	CoversHash string `json:"covers_hash"`
+	KeyID      string `json:"key_id"`
+	Signature  string `json:"signature"`
+}
+
+// auditCheckpointMessage is what a checkpoint signs
+func auditCheckpointMessage(seq int64, hash string, t time.Time) []byte {
+	return []byte(fmt.Sprintf("weather-audit-checkpoint\n%d\n%s\n%s", seq, hash, t.UTC().Format(time.RFC3339Nano)))
+}
+
+// newAuditCheckpoint creates a checkpoint record covering seq and hash
+func newAuditCheckpoint(key ed25519.PrivateKey, seq int64, hash string, t time.Time) AuditEvent {
+	signature := ed25519.Sign(key, auditCheckpointMessage(seq, hash, t))
+	return AuditEvent{
+		Time:     t,
+		Event:    AuditEventCheckpoint,
+		Category: "audit",
+		Severity: "info",
+		Actor:    Actor{Type: "system", ID: "audit"},
+		Details: map[string]interface{}{
+			"covers_seq":  seq,
+			"covers_hash": hash,
+			"key_id":      AuditKeyID(key.Public().(ed25519.PublicKey)),
+			"signature":   base64.StdEncoding.EncodeToString(signature),
+		},
+		Result: "success",
+	}
+}
+
+// AuditKeyID identifies a checkpoint key: the first 8 bytes of the SHA-256
+// of the public key, in hex
+func AuditKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// LoadAuditSigningKey reads the checkpoint signing key, creating it when
+// the file does not exist. The file holds the hex-encoded Ed25519 seed.
+func LoadAuditSigningKey(path string) (ed25519.PrivateKey, error) {
+	if key, err := readAuditSigningKey(path); err == nil || !os.IsNotExist(err) {
+		return key, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate audit signing key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save audit signing key: %w", err)
+	}
+	return key, nil
+}
+
+// ReadAuditPublicKey returns the public half of an existing signing key
+func ReadAuditPublicKey(path string) (ed25519.PublicKey, error) {
+	key, err := readAuditSigningKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return key.Public().(ed25519.PublicKey), nil
+}
+
+func readAuditSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid audit signing key in %s", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// AuditLogFiles returns audit.log and its archives in chain order: files
+// without chained records first (oldest first), then by their first
+// sequence number
+func AuditLogFiles(logDir string) ([]string, error) {
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	type auditFile struct {
+		path     string
+		firstSeq int64
+		modTime  time.Time
+	}
+	var files []auditFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || (name != AuditLogFileName && !strings.HasPrefix(name, AuditLogFileName+".")) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(logDir, name)
+		firstSeq, err := firstAuditSeq(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, auditFile{path: path, firstSeq: firstSeq, modTime: info.ModTime()})
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if (a.firstSeq == 0) != (b.firstSeq == 0) {
+			return a.firstSeq == 0
+		}
+		if a.firstSeq != b.firstSeq {
+			return a.firstSeq < b.firstSeq
+		}
+		return a.modTime.Before(b.modTime)
+	})
+
+	paths := make([]string, len(files))
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	return paths, nil
+}
+
+// firstAuditSeq returns the sequence number of the first chained record in
+// a file, or 0 when it has none
+func firstAuditSeq(path string) (int64, error) {
+	var first int64
+	err := scanAuditFile(path, func(_ int, line []byte) bool {
+		if body, _, ok := splitAuditRecord(line); ok {
+			var fields auditChainFields
+			if json.Unmarshal(body, &fields) == nil && fields.Seq > 0 {
+				first = fields.Seq
+				return false
+			}
+		}
+		return true
+	})
+	return first, err
+}
+
+// scanAuditFile calls fn for each non-empty line until fn returns false
+func scanAuditFile(path string, fn func(lineNo int, line []byte) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxAuditLineSize)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if !fn(lineNo, line) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// lastAuditChainRecord returns the seq and hash of the newest chained
+// record in the log directory, or zero values for a new chain
+func lastAuditChainRecord(logDir string) (int64, string, error) {
+	files, err := AuditLogFiles(logDir)
+	if err != nil {
+		return 0, "", err
+	}
+	for i := len(files) - 1; i >= 0; i-- {
+		var seq int64
+		var hash string
+		err := scanAuditFile(files[i], func(_ int, line []byte) bool {
+			if body, h, ok := splitAuditRecord(line); ok {
+				var fields auditChainFields
+				if json.Unmarshal(body, &fields) == nil && fields.Seq > seq {
+					seq, hash = fields.Seq, h
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return 0, "", err
+		}
+		if seq > 0 {
+			return seq, hash, nil
+		}
+	}
+	return 0, "", nil
+}
+
+// AuditIssue is one problem found while verifying the audit log
+type AuditIssue struct {
+	Kind    string `json:"kind"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Seq     int64  `json:"seq,omitempty"`
+	Message string `json:"message"`
+}
+
+// AuditVerifyReport is the result of verifying the audit log
+type AuditVerifyReport struct {
+	OK    bool     `json:"ok"`
+	Files []string `json:"files"`
+	// Chained records, including checkpoints
+	Records int `json:"records"`
+	// Records written before hash chaining, at the start of the log
+	Legacy int `json:"legacy"`
+	// First seq present; above 1 when older archives were removed by
+	// retention
+	FirstSeq int64  `json:"first_seq"`
+	LastSeq  int64  `json:"last_seq"`
+	LastHash string `json:"last_hash,omitempty"`
+	// Checkpoints found and those whose signature was checked
+	Checkpoints         int   `json:"checkpoints"`
+	VerifiedCheckpoints int   `json:"verified_checkpoints"`
+	LastCheckpointSeq   int64 `json:"last_checkpoint_seq"`
+	// Records after the last verified checkpoint; truncating these cannot
+	// be detected
+	UnsignedTail int64        `json:"unsigned_tail"`
+	Issues       []AuditIssue `json:"issues"`
+	TotalIssues  int          `json:"total_issues"`
+}
+
+func (r *AuditVerifyReport) addIssue(issue AuditIssue) {
+	r.TotalIssues++
+	if len(r.Issues) < maxAuditIssues {
+		r.Issues = append(r.Issues, issue)
+	}
+}
+
+// VerifyAuditLog checks the hash chain of every audit file in logDir and
+// the checkpoint signatures against pub. With a nil pub, signatures are not
+// checked.
+func VerifyAuditLog(logDir string, pub ed25519.PublicKey) (*AuditVerifyReport, error) {
+	files, err := AuditLogFiles(logDir)
+	if err != nil {
+		return nil, err
+	}
+	report := &AuditVerifyReport{Files: []string{}, Issues: []AuditIssue{}}
+
+	started := false
+	var lastSeq, verifiedSeq int64
+	var lastHash string
+
+	for _, path := range files {
+		name := filepath.Base(path)
+		report.Files = append(report.Files, name)
+
+		err := scanAuditFile(path, func(lineNo int, line []byte) bool {
+			issue := AuditIssue{File: name, Line: lineNo}
+
+			body, hash, chained := splitAuditRecord(line)
+			if !chained {
+				if !json.Valid(line) {
+					issue.Kind, issue.Message = AuditIssueCorrupt, "line is not a valid audit record"
+					report.addIssue(issue)
+				} else if started {
+					issue.Kind, issue.Message = AuditIssueUnchained, "record without a hash inside the chain"
+					report.addIssue(issue)
+				} else {
+					report.Legacy++
+				}
+				return true
+			}
+
+			var fields auditChainFields
+			if err := json.Unmarshal(body, &fields); err != nil || fields.Seq <= 0 {
+				issue.Kind, issue.Message = AuditIssueCorrupt, "record has no valid sequence number"
+				report.addIssue(issue)
+				return true
+			}
+			issue.Seq = fields.Seq
+			report.Records++
+
+			sum := sha256.Sum256(body)
+			if hex.EncodeToString(sum[:]) != hash {
+				issue.Kind, issue.Message = AuditIssueEdited, "record content does not match its hash"
+				report.addIssue(issue)
+			}
+
+			if !started {
+				started = true
+				report.FirstSeq = fields.Seq
+			} else {
+				switch {
+				case fields.Seq == lastSeq+1:
+					if fields.PrevHash != lastHash {
+						issue.Kind = AuditIssueBroken
+						issue.Message = fmt.Sprintf("record does not follow seq %d: it was replaced or the previous record was altered", lastSeq)
+						report.addIssue(issue)
+					}
+				case fields.Seq > lastSeq+1:
+					issue.Kind = AuditIssueGap
+					issue.Message = fmt.Sprintf("%d records missing (seq %d to %d)", fields.Seq-lastSeq-1, lastSeq+1, fields.Seq-1)
+					report.addIssue(issue)
+				default:
+					issue.Kind = AuditIssueReordered
+					issue.Message = fmt.Sprintf("seq %d follows seq %d", fields.Seq, lastSeq)
+					report.addIssue(issue)
+				}
+			}
+
+			if fields.Event == AuditEventCheckpoint {
+				report.Checkpoints++
+				if verifyAuditCheckpoint(report, issue, fields, lastSeq, lastHash, pub) {
+					report.VerifiedCheckpoints++
+					report.LastCheckpointSeq = fields.Seq
+					verifiedSeq = fields.Seq
+				}
+			}
+
+			lastSeq, lastHash = fields.Seq, hash
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+
+	report.LastSeq, report.LastHash = lastSeq, lastHash
+	if started {
+		if verifiedSeq == 0 {
+			report.UnsignedTail = lastSeq - report.FirstSeq + 1
+		} else {
+			report.UnsignedTail = lastSeq - verifiedSeq
+		}
+	}
+	report.OK = report.TotalIssues == 0
+	return report, nil
+}
+
+// verifyAuditCheckpoint checks that a checkpoint covers the record before
+// it and, with a key, that its signature is valid
+func verifyAuditCheckpoint(report *AuditVerifyReport, issue AuditIssue, fields auditChainFields, prevSeq int64, prevHash string, pub ed25519.PublicKey) bool {
+	var details auditCheckpointDetails
+	if err := json.Unmarshal(fields.Details, &details); err != nil {
+		issue.Kind, issue.Message = AuditIssueSignature, "checkpoint details are unreadable"
+		report.addIssue(issue)
+		return false
+	}
+	if details.CoversSeq != prevSeq || details.CoversHash != prevHash {
+		issue.Kind = AuditIssueSignature
+		issue.Message = fmt.Sprintf("checkpoint covers seq %d but follows seq %d", details.CoversSeq, prevSeq)
+		report.addIssue(issue)
+		return false
+	}
+	if pub == nil {
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(details.Signature)
+	if err != nil || !ed25519.Verify(pub, auditCheckpointMessage(details.CoversSeq, details.CoversHash, fields.Time), signature) {
+		issue.Kind = AuditIssueSignature
+		issue.Message = "checkpoint signature is invalid for key " + AuditKeyID(pub)
+		if details.KeyID != "" && details.KeyID != AuditKeyID(pub) {
+			issue.Message += " (signed with key " + details.KeyID + ")"
+		}
+		report.addIssue(issue)
+		return false
+	}
+	return true
+}
+
+// ExportAuditLog writes every audit record, oldest first, as JSON lines
+// (the stored records, hashes included), CEF or syslog
+func ExportAuditLog(w io.Writer, logDir string, format LogFormat) error {
+	files, err := AuditLogFiles(logDir)
+	if err != nil {
+		return err
+	}
+	formatter := NewLogFormatter(format)
+	bw := bufio.NewWriter(w)
+
+	for _, path := range files {
+		var writeErr error
+		err := scanAuditFile(path, func(_ int, line []byte) bool {
+			if format == LogFormatJSON {
+				if _, writeErr = bw.Write(line); writeErr == nil {
+					writeErr = bw.WriteByte('\n')
+				}
+				return writeErr == nil
+			}
+			var event AuditEvent
+			if json.Unmarshal(line, &event) != nil {
+				return true
+			}
+			_, writeErr = bw.WriteString(formatter.FormatAudit(&event) + "\n")
+			return writeErr == nil
+		})
+		if err != nil {
+			return err
+		}
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+	return bw.Flush()
+}
+
+// ParseAuditExportFormat maps an export format name to a LogFormat
+func ParseAuditExportFormat(name string) (LogFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "jsonl", "json":
+		return LogFormatJSON, nil
+	case "cef":
+		return LogFormatCEF, nil
+	case "syslog":
+		return LogFormatSyslog, nil
+	default:
+		return "", fmt.Errorf("unknown audit export format %q (valid: jsonl, cef, syslog)", name)
+	}
+}
+
+// auditSeverityLevel ranks an audit severity for CEF (0-10)
+func auditSeverityLevel(severity string) int {
+	switch severity {
+	case "critical":
+		return 10
+	case "error":
+		return 8
+	case "warn":
+		return 5
+	default:
+		return 3
+	}
+}
+
+// formatAuditSeq renders a sequence number, or "-" for legacy records
+func formatAuditSeq(seq int64) string {
+	if seq == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(seq, 10)
+}
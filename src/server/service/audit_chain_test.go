@@ -0,0 +1,179 @@
+package service
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeAuditRecords(t *testing.T, logger *AuditLogger, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := logger.LogSuccess("admin.login", "authentication", "admin", "admin", "192.0.2.1", nil); err != nil {
+			t.Fatalf("Log failed: %v", err)
+		}
+	}
+}
+
+func newTestAuditLog(t *testing.T) (string, ed25519.PrivateKey) {
+	t.Helper()
+	dir := t.TempDir()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := NewAuditLoggerWithOptions(dir, AuditLoggerOptions{SigningKey: key, CheckpointEvery: 3})
+	if err != nil {
+		t.Fatalf("NewAuditLoggerWithOptions failed: %v", err)
+	}
+	writeAuditRecords(t, logger, 4)
+	if err := logger.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	writeAuditRecords(t, logger, 2)
+	logger.Close()
+
+	// A restarted logger continues the chain
+	logger, err = NewAuditLoggerWithOptions(dir, AuditLoggerOptions{SigningKey: key, CheckpointEvery: 3})
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	writeAuditRecords(t, logger, 1)
+	logger.Close()
+	return dir, key
+}
+
+func TestVerifyAuditLog_Intact(t *testing.T) {
+	dir, key := newTestAuditLog(t)
+
+	report, err := VerifyAuditLog(dir, key.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatalf("VerifyAuditLog failed: %v", err)
+	}
+	if !report.OK {
+		t.Fatalf("intact log reported issues: %+v", report.Issues)
+	}
+	if len(report.Files) != 2 {
+		t.Errorf("Files = %v, want audit.log and one archive", report.Files)
+	}
+	// Sequence numbers count checkpoints too and run unbroken across the
+	// rotation and restart
+	if report.FirstSeq != 1 || report.LastSeq != int64(report.Records) {
+		t.Errorf("seq range %d-%d for %d records", report.FirstSeq, report.LastSeq, report.Records)
+	}
+	if report.Checkpoints == 0 || report.VerifiedCheckpoints != report.Checkpoints {
+		t.Errorf("checkpoints %d, verified %d", report.Checkpoints, report.VerifiedCheckpoints)
+	}
+	if report.UnsignedTail != 0 {
+		t.Errorf("UnsignedTail = %d, want 0 after Close", report.UnsignedTail)
+	}
+
+	// Another key cannot vouch for the checkpoints
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	report, err = VerifyAuditLog(dir, other.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK || report.Issues[0].Kind != AuditIssueSignature {
+		t.Errorf("wrong key: %+v", report.Issues)
+	}
+}
+
+func TestVerifyAuditLog_Tampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(lines [][]byte) [][]byte
+		kind   string
+	}{
+		{
+			name: "edited",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[0] = bytes.Replace(lines[0], []byte("192.0.2.1"), []byte("192.0.2.9"), 1)
+				return lines
+			},
+			kind: AuditIssueEdited,
+		},
+		{
+			name: "removed",
+			tamper: func(lines [][]byte) [][]byte {
+				return append(lines[:1], lines[2:]...)
+			},
+			kind: AuditIssueGap,
+		},
+		{
+			name: "reordered",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[0], lines[1] = lines[1], lines[0]
+				return lines
+			},
+			kind: AuditIssueReordered,
+		},
+		{
+			name: "inserted",
+			tamper: func(lines [][]byte) [][]byte {
+				extra := []byte(`{"event":"admin.login","result":"success"}`)
+				return append(lines[:1], append([][]byte{extra}, lines[1:]...)...)
+			},
+			kind: AuditIssueUnchained,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, key := newTestAuditLog(t)
+			files, err := AuditLogFiles(dir)
+			if err != nil || len(files) != 2 {
+				t.Fatalf("AuditLogFiles = %v, %v", files, err)
+			}
+			archive := files[0]
+			data, err := os.ReadFile(archive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+			lines = tt.tamper(lines)
+			if err := os.WriteFile(archive, append(bytes.Join(lines, []byte("\n")), '\n'), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := VerifyAuditLog(dir, key.Public().(ed25519.PublicKey))
+			if err != nil {
+				t.Fatalf("VerifyAuditLog failed: %v", err)
+			}
+			if report.OK {
+				t.Fatal("tampering not detected")
+			}
+			if report.Issues[0].Kind != tt.kind || report.Issues[0].File != filepath.Base(archive) {
+				t.Errorf("first issue = %+v, want kind %s", report.Issues[0], tt.kind)
+			}
+		})
+	}
+}
+
+func TestExportAuditLog(t *testing.T) {
+	dir, _ := newTestAuditLog(t)
+	report, err := VerifyAuditLog(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []LogFormat{LogFormatJSON, LogFormatCEF, LogFormatSyslog} {
+		var buf bytes.Buffer
+		if err := ExportAuditLog(&buf, dir, format); err != nil {
+			t.Fatalf("ExportAuditLog(%s) failed: %v", format, err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != report.Records {
+			t.Errorf("%s: %d lines, want %d", format, len(lines), report.Records)
+		}
+		prefix := map[LogFormat]string{LogFormatJSON: "{", LogFormatCEF: "CEF:0|apimgr|weather|", LogFormatSyslog: "<110>1 "}[format]
+		if !strings.HasPrefix(lines[0], prefix) {
+			t.Errorf("%s: first line %q, want prefix %q", format, lines[0], prefix)
+		}
+	}
+}
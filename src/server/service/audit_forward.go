@@ -0,0 +1,132 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Records waiting to be forwarded; when a target is slow or down, newer
+// records are dropped from forwarding (they stay in audit.log)
+const auditForwardQueue = 1000
+
+// AuditForwarder sends audit records to a SIEM or file as they are
+// written. Targets are udp://host:port, tcp://host:port or a file path.
+type AuditForwarder struct {
+	format    LogFormat
+	target    string
+	formatter *LogFormatter
+
+	queue   chan string
+	stop    chan struct{}
+	done    chan struct{}
+	closed  sync.Once
+	dropped atomic.Int64
+}
+
+// NewAuditForwarder creates and starts a forwarder. format is jsonl, cef
+// or syslog.
+func NewAuditForwarder(format, target string) (*AuditForwarder, error) {
+	logFormat, err := ParseAuditExportFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil, fmt.Errorf("audit forward target is required")
+	}
+
+	f := &AuditForwarder{
+		format:    logFormat,
+		target:    target,
+		formatter: NewLogFormatter(logFormat),
+		queue:     make(chan string, auditForwardQueue),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go f.run()
+	return f, nil
+}
+
+// Forward queues a record without blocking the audit logger
+func (f *AuditForwarder) Forward(event *AuditEvent, line []byte) {
+	msg := string(line)
+	if f.format != LogFormatJSON {
+		msg = f.formatter.FormatAudit(event)
+	}
+	select {
+	case f.queue <- msg:
+	default:
+		if f.dropped.Add(1) == 1 {
+			log.Printf("Audit forward to %s is falling behind; dropping records", f.target)
+		}
+	}
+}
+
+// Dropped returns how many records could not be queued
+func (f *AuditForwarder) Dropped() int64 {
+	return f.dropped.Load()
+}
+
+// Close stops the forwarder after sending queued records. Records still
+// waiting for an unreachable target are dropped.
+func (f *AuditForwarder) Close() {
+	f.closed.Do(func() {
+		close(f.stop)
+		close(f.queue)
+		<-f.done
+	})
+}
+
+func (f *AuditForwarder) run() {
+	defer close(f.done)
+
+	var w io.WriteCloser
+	backoff := time.Second
+	for msg := range f.queue {
+		for {
+			if w == nil {
+				var err error
+				if w, err = f.open(); err != nil {
+					w = nil
+					log.Printf("Audit forward to %s failed: %v", f.target, err)
+					select {
+					case <-f.stop:
+						return
+					case <-time.After(backoff):
+					}
+					backoff = min(backoff*2, time.Minute)
+					continue
+				}
+				backoff = time.Second
+			}
+			if _, err := io.WriteString(w, msg+"\n"); err != nil {
+				log.Printf("Audit forward to %s failed: %v", f.target, err)
+				w.Close()
+				w = nil
+				continue
+			}
+			break
+		}
+	}
+	if w != nil {
+		w.Close()
+	}
+}
+
+func (f *AuditForwarder) open() (io.WriteCloser, error) {
+	switch {
+	case strings.HasPrefix(f.target, "udp://"):
+		return net.DialTimeout("udp", strings.TrimPrefix(f.target, "udp://"), 10*time.Second)
+	case strings.HasPrefix(f.target, "tcp://"):
+		return net.DialTimeout("tcp", strings.TrimPrefix(f.target, "tcp://"), 10*time.Second)
+	default:
+		return os.OpenFile(f.target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	}
+}
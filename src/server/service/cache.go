@@ -229,6 +229,14 @@ func (cm *CacheManager) GetStats() (map[string]string, error) {
 	}, nil
 }
 
+// Client returns the Redis client, or nil when caching is disabled
+func (cm *CacheManager) Client() *redis.Client {
+	if !cm.enabled {
+		return nil
+	}
+	return cm.client
+}
+
 // Close closes the cache connection
 func (cm *CacheManager) Close() error {
 	if cm.enabled && cm.client != nil {
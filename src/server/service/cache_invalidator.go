@@ -0,0 +1,108 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// LocalCache is an in-process cache that can be invalidated cluster-wide
+// (satisfied by *cache.Cache from patrickmn/go-cache)
+type LocalCache interface {
+	Delete(key string)
+	Flush()
+}
+
+// cacheInvalidation is the bus payload; no keys flushes the whole cache
+type cacheInvalidation struct {
+	Cache string   `json:"cache"`
+	Keys  []string `json:"keys,omitempty"`
+}
+
+// CacheInvalidator clears named in-process caches on this node and, when an
+// event bus is attached, on every other cluster node
+type CacheInvalidator struct {
+	bus    EventBus
+	caches map[string]LocalCache
+	mu     sync.RWMutex
+}
+
+// NewCacheInvalidator creates an invalidator; bus may be nil in standalone mode
+func NewCacheInvalidator(bus EventBus) *CacheInvalidator {
+	inv := &CacheInvalidator{
+		bus:    bus,
+		caches: make(map[string]LocalCache),
+	}
+	if bus != nil {
+		bus.Subscribe(EventBusChannelCache, inv.receive)
+	}
+	return inv
+}
+
+// Register adds a cache under name
+func (inv *CacheInvalidator) Register(name string, cache LocalCache) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.caches[name] = cache
+}
+
+// Invalidate deletes keys from the named cache (all entries when no keys are
+// given) on every node
+func (inv *CacheInvalidator) Invalidate(name string, keys ...string) {
+	inv.apply(cacheInvalidation{Cache: name, Keys: keys})
+	inv.publish(cacheInvalidation{Cache: name, Keys: keys})
+}
+
+// InvalidateAll flushes every registered cache on every node
+func (inv *CacheInvalidator) InvalidateAll() {
+	inv.mu.RLock()
+	names := make([]string, 0, len(inv.caches))
+	for name := range inv.caches {
+		names = append(names, name)
+	}
+	inv.mu.RUnlock()
+
+	for _, name := range names {
+		inv.Invalidate(name)
+	}
+}
+
+func (inv *CacheInvalidator) apply(msg cacheInvalidation) {
+	inv.mu.RLock()
+	cache, ok := inv.caches[msg.Cache]
+	inv.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	if len(msg.Keys) == 0 {
+		cache.Flush()
+		return
+	}
+	for _, key := range msg.Keys {
+		cache.Delete(key)
+	}
+}
+
+func (inv *CacheInvalidator) publish(msg cacheInvalidation) {
+	if inv.bus == nil {
+		return
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	if err := inv.bus.Publish(&BusMessage{Channel: EventBusChannelCache, Payload: payload}); err != nil {
+		log.Printf("Cache invalidator: failed to publish invalidation of %s: %v", msg.Cache, err)
+	}
+}
+
+// receive applies an invalidation published by another node
+func (inv *CacheInvalidator) receive(busMsg *BusMessage) {
+	var msg cacheInvalidation
+	if err := json.Unmarshal(busMsg.Payload, &msg); err != nil {
+		log.Printf("Cache invalidator: failed to decode message %s: %v", busMsg.ID, err)
+		return
+	}
+	inv.apply(msg)
+}
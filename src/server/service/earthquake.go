@@ -129,6 +129,11 @@ func NewEarthquakeService() *EarthquakeService {
 	}
 }
 
+// LocalCache returns the in-process feed cache (for cluster-wide invalidation)
+func (es *EarthquakeService) LocalCache() *cache.Cache {
+	return es.cache
+}
+
 // GetEarthquakes fetches earthquakes based on feed type
 // feedType options: "all_hour", "all_day", "all_week", "all_month"
 //
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+)
+
+// Event bus channels
+const (
+	// Hub messages (notifications, alerts, earthquakes, system)
+	EventBusChannelHub = "hub"
+	// Invalidation of in-process caches
+	EventBusChannelCache = "cache"
+)
+
+// Event bus backends (setting cluster.event_bus)
+const (
+	EventBusAuto     = "auto"
+	EventBusRedis    = "redis"
+	EventBusPostgres = "postgres"
+	EventBusDatabase = "database"
+)
+
+// How long delivered message IDs are remembered for dedup
+const eventBusSeenTTL = 10 * time.Minute
+
+// BusMessage is a message exchanged between cluster nodes
+type BusMessage struct {
+	// Unique message ID (ULID); deliveries with a seen ID are dropped
+	ID      string          `json:"id"`
+	NodeID  string          `json:"node_id"`
+	Channel string          `json:"channel"`
+	Payload json.RawMessage `json:"payload"`
+	Time    time.Time       `json:"time"`
+}
+
+// BusHandler handles a message published by another node
+type BusHandler func(msg *BusMessage)
+
+// EventBus is a cluster-wide pub/sub bus. Publishers never receive their own
+// messages, and each message is delivered at most once per node.
+type EventBus interface {
+	// Name returns the backend name
+	Name() string
+	// Publish sends a message to the other nodes
+	Publish(msg *BusMessage) error
+	// Subscribe registers a handler for a channel (call before Start)
+	Subscribe(channel string, handler BusHandler)
+	// Start begins receiving messages
+	Start() error
+	// Close stops receiving and releases connections
+	Close() error
+}
+
+// busDispatcher holds the handler registry and dedup state shared by all
+// backends
+type busDispatcher struct {
+	nodeID   string
+	handlers map[string][]BusHandler
+	seen     map[string]time.Time
+	mu       sync.Mutex
+}
+
+func newBusDispatcher(nodeID string) busDispatcher {
+	return busDispatcher{
+		nodeID:   nodeID,
+		handlers: make(map[string][]BusHandler),
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// Subscribe implements EventBus
+func (d *busDispatcher) Subscribe(channel string, handler BusHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[channel] = append(d.handlers[channel], handler)
+}
+
+// prepare fills in the ID, node and time of an outgoing message and marks it
+// seen, so an echo from the backend is ignored
+func (d *busDispatcher) prepare(msg *BusMessage) {
+	if msg.ID == "" {
+		msg.ID = ulid.Make().String()
+	}
+	if msg.NodeID == "" {
+		msg.NodeID = d.nodeID
+	}
+	if msg.Time.IsZero() {
+		msg.Time = time.Now()
+	}
+	d.markSeen(msg.ID)
+}
+
+// markSeen records id and reports whether it was new
+func (d *busDispatcher) markSeen(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if _, dup := d.seen[id]; dup {
+		return false
+	}
+	d.seen[id] = now
+	if len(d.seen) > 4096 {
+		for seenID, seenAt := range d.seen {
+			if now.Sub(seenAt) > eventBusSeenTTL {
+				delete(d.seen, seenID)
+			}
+		}
+	}
+	return true
+}
+
+// deliver passes a received message to the channel's handlers, dropping
+// messages from this node and duplicates
+func (d *busDispatcher) deliver(msg *BusMessage) {
+	if msg == nil || msg.ID == "" || msg.NodeID == d.nodeID {
+		return
+	}
+	if !d.markSeen(msg.ID) {
+		return
+	}
+
+	d.mu.Lock()
+	handlers := append([]BusHandler(nil), d.handlers[msg.Channel]...)
+	d.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+}
+
+// EventBusOptions selects and configures the event bus backend
+type EventBusOptions struct {
+	// auto, redis, postgres or database
+	Backend string
+	NodeID  string
+	// Redis/Valkey connection; used when enabled
+	Cache *CacheManager
+	// PostgreSQL DSN for LISTEN/NOTIFY
+	PostgresDSN string
+	// Shared database and its driver (sqlite, mysql) for the polling table
+	DB     *sql.DB
+	Driver string
+	// Polling interval for the database backend (default 1 second)
+	Interval time.Duration
+}
+
+// NewEventBus creates the configured event bus backend
+func NewEventBus(opts EventBusOptions) (EventBus, error) {
+	redisAvailable := opts.Cache != nil && opts.Cache.IsEnabled()
+	backend, err := SelectEventBusBackend(opts.Backend, redisAvailable, opts.PostgresDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	switch backend {
+	case EventBusRedis:
+		return NewRedisEventBus(opts.Cache.Client(), opts.NodeID), nil
+	case EventBusPostgres:
+		return NewPostgresEventBus(opts.PostgresDSN, opts.NodeID)
+	default:
+		if opts.DB == nil {
+			return nil, fmt.Errorf("event bus database backend requires a database")
+		}
+		return NewPollingEventBus(opts.DB, opts.Driver, opts.NodeID, opts.Interval), nil
+	}
+}
+
+// SelectEventBusBackend resolves "auto" to a concrete backend: Redis when a
+// cache connection is available, PostgreSQL when configured, otherwise the
+// polling table in the shared database
+func SelectEventBusBackend(backend string, redisAvailable bool, postgresDSN string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(backend)) {
+	case "", EventBusAuto:
+		if redisAvailable {
+			return EventBusRedis, nil
+		}
+		if postgresDSN != "" {
+			return EventBusPostgres, nil
+		}
+		return EventBusDatabase, nil
+	case EventBusRedis:
+		if !redisAvailable {
+			return "", fmt.Errorf("event bus redis requires the cache (CACHE_ENABLED) to be connected")
+		}
+		return EventBusRedis, nil
+	case EventBusPostgres:
+		if postgresDSN == "" {
+			return "", fmt.Errorf("event bus postgres requires database.driver postgres in server.yml")
+		}
+		return EventBusPostgres, nil
+	case EventBusDatabase:
+		return EventBusDatabase, nil
+	default:
+		return "", fmt.Errorf("unknown event bus backend %q (valid: auto, redis, postgres, database)", backend)
+	}
+}
+
+func logBusError(bus, action string, err error) {
+	log.Printf("Event bus (%s): %s: %v", bus, action, err)
+}
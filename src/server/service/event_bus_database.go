@@ -0,0 +1,194 @@
+package service
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// How long messages stay in server_event_bus
+	eventBusRetention = 10 * time.Minute
+	// Rows re-read on each poll, so a row whose insert committed after a
+	// higher ID was seen (MySQL, PostgreSQL) is not skipped. Redelivered
+	// rows are dropped by message ID.
+	eventBusPollLookback = 50
+)
+
+// PollingEventBus exchanges messages through the server_event_bus table in
+// the shared database, which the server migrations create. Used for SQLite
+// and MySQL clusters, and by the PostgreSQL bus for payload storage.
+type PollingEventBus struct {
+	busDispatcher
+
+	DB       *sql.DB
+	Driver   string
+	Interval time.Duration
+
+	startID   int64
+	lastID    int64
+	lastPrune time.Time
+	pollMu    sync.Mutex
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewPollingEventBus creates a bus polling every interval (default 1 second).
+// driver is sqlite, mysql or postgres.
+func NewPollingEventBus(db *sql.DB, driver, nodeID string, interval time.Duration) *PollingEventBus {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &PollingEventBus{
+		busDispatcher: newBusDispatcher(nodeID),
+		DB:            db,
+		Driver:        normalizeSQLDriver(driver),
+		Interval:      interval,
+		done:          make(chan struct{}),
+	}
+}
+
+// Name implements EventBus
+func (b *PollingEventBus) Name() string {
+	return EventBusDatabase
+}
+
+// Start implements EventBus. Only messages published from now on are
+// delivered to this node.
+func (b *PollingEventBus) Start() error {
+	if err := b.init(); err != nil {
+		return err
+	}
+	go b.run()
+	return nil
+}
+
+// init skips messages already stored
+func (b *PollingEventBus) init() error {
+	if err := b.DB.QueryRow("SELECT COALESCE(MAX(id), 0) FROM server_event_bus").Scan(&b.startID); err != nil {
+		return err
+	}
+	b.lastID = b.startID
+	return nil
+}
+
+func (b *PollingEventBus) run() {
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.Poll()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// Close implements EventBus
+func (b *PollingEventBus) Close() error {
+	b.stopOnce.Do(func() {
+		close(b.done)
+	})
+	return nil
+}
+
+// Publish implements EventBus
+func (b *PollingEventBus) Publish(msg *BusMessage) error {
+	b.prepare(msg)
+	_, err := b.DB.Exec(b.rebind(`
+		INSERT INTO server_event_bus (message_id, node_id, channel, payload, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`), msg.ID, msg.NodeID, msg.Channel, string(msg.Payload), msg.Time)
+	return err
+}
+
+// Poll delivers messages written by other nodes since the last poll
+func (b *PollingEventBus) Poll() {
+	b.pollMu.Lock()
+	defer b.pollMu.Unlock()
+
+	from := b.lastID - eventBusPollLookback
+	if from < b.startID {
+		from = b.startID
+	}
+
+	rows, err := b.DB.Query(b.rebind(`
+		SELECT id, message_id, node_id, channel, payload, created_at
+		FROM server_event_bus
+		WHERE id > ? AND node_id != ?
+		ORDER BY id
+		LIMIT 500
+	`), from, b.nodeID)
+	if err != nil {
+		logBusError(b.Name(), "poll failed", err)
+		return
+	}
+
+	var messages []*BusMessage
+	for rows.Next() {
+		var id int64
+		var payload string
+		msg := &BusMessage{}
+		if err := rows.Scan(&id, &msg.ID, &msg.NodeID, &msg.Channel, &payload, &msg.Time); err != nil {
+			logBusError(b.Name(), "failed to read message", err)
+			continue
+		}
+		if id > b.lastID {
+			b.lastID = id
+		}
+		msg.Payload = []byte(payload)
+		messages = append(messages, msg)
+	}
+	rows.Close()
+
+	for _, msg := range messages {
+		b.deliver(msg)
+	}
+
+	if time.Since(b.lastPrune) > time.Minute {
+		b.lastPrune = time.Now()
+		if _, err := b.DB.Exec(b.rebind("DELETE FROM server_event_bus WHERE created_at < ?"), time.Now().Add(-eventBusRetention)); err != nil {
+			logBusError(b.Name(), "prune failed", err)
+		}
+	}
+}
+
+// rebind converts ? placeholders to $n for PostgreSQL
+func (b *PollingEventBus) rebind(query string) string {
+	return rebindQuery(b.Driver, query)
+}
+
+// normalizeSQLDriver maps driver names and aliases to sqlite, mysql or
+// postgres
+func normalizeSQLDriver(driver string) string {
+	switch strings.ToLower(driver) {
+	case "mysql", "mariadb":
+		return "mysql"
+	case "postgres", "postgresql", "pgx":
+		return "postgres"
+	default:
+		return "sqlite"
+	}
+}
+
+// rebindQuery converts ? placeholders to $n when driver is postgres
+func rebindQuery(driver, query string) string {
+	if driver != "postgres" {
+		return query
+	}
+	var sb strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// NOTIFY channel that wakes listeners when a message is stored
+	postgresEventBusChannel = "weather_event_bus"
+	// Safety poll in case a notification is lost while reconnecting
+	postgresEventBusFallbackPoll = 30 * time.Second
+)
+
+// PostgresEventBus stores messages in server_event_bus and uses
+// LISTEN/NOTIFY to wake other nodes immediately. Payloads stay in the table
+// because NOTIFY is limited to 8000 bytes.
+type PostgresEventBus struct {
+	*PollingEventBus
+
+	dsn    string
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewPostgresEventBus connects to PostgreSQL with dsn
+func NewPostgresEventBus(dsn, nodeID string) (*PostgresEventBus, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PostgresEventBus{
+		PollingEventBus: NewPollingEventBus(db, "postgres", nodeID, postgresEventBusFallbackPoll),
+		dsn:             dsn,
+		ctx:             ctx,
+		cancel:          cancel,
+	}, nil
+}
+
+// Name implements EventBus
+func (b *PostgresEventBus) Name() string {
+	return EventBusPostgres
+}
+
+// Start implements EventBus
+func (b *PostgresEventBus) Start() error {
+	if err := b.PollingEventBus.Start(); err != nil {
+		return err
+	}
+	go b.listen()
+	return nil
+}
+
+// listen holds a dedicated connection for LISTEN and reconnects with backoff
+func (b *PostgresEventBus) listen() {
+	backoff := time.Second
+	for b.ctx.Err() == nil {
+		err := b.listenOnce()
+		if b.ctx.Err() != nil {
+			return
+		}
+		logBusError(b.Name(), "listener disconnected", err)
+
+		select {
+		case <-time.After(backoff):
+		case <-b.ctx.Done():
+			return
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (b *PostgresEventBus) listenOnce() error {
+	conn, err := pgx.Connect(b.ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(b.ctx, "LISTEN "+postgresEventBusChannel); err != nil {
+		return err
+	}
+	// Catch up on anything stored while disconnected
+	b.Poll()
+
+	for {
+		notification, err := conn.WaitForNotification(b.ctx)
+		if err != nil {
+			return err
+		}
+		if notification.PID != conn.PgConn().PID() {
+			b.Poll()
+		}
+	}
+}
+
+// Publish implements EventBus
+func (b *PostgresEventBus) Publish(msg *BusMessage) error {
+	if err := b.PollingEventBus.Publish(msg); err != nil {
+		return err
+	}
+	_, err := b.DB.Exec("SELECT pg_notify($1, $2)", postgresEventBusChannel, msg.ID)
+	return err
+}
+
+// Close implements EventBus
+func (b *PostgresEventBus) Close() error {
+	b.cancel()
+	b.PollingEventBus.Close()
+	return b.DB.Close()
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis pub/sub channel carrying all bus messages
+const redisEventBusChannel = "weather:event_bus"
+
+// RedisEventBus exchanges messages over Redis/Valkey pub/sub
+type RedisEventBus struct {
+	busDispatcher
+
+	client *redis.Client
+	pubsub *redis.PubSub
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRedisEventBus creates a bus on an existing Redis client
+func NewRedisEventBus(client *redis.Client, nodeID string) *RedisEventBus {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RedisEventBus{
+		busDispatcher: newBusDispatcher(nodeID),
+		client:        client,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Name implements EventBus
+func (b *RedisEventBus) Name() string {
+	return EventBusRedis
+}
+
+// Start implements EventBus
+func (b *RedisEventBus) Start() error {
+	b.pubsub = b.client.Subscribe(b.ctx, redisEventBusChannel)
+
+	// Wait for the subscription to be confirmed so no message published
+	// after Start returns is missed
+	ctx, cancel := context.WithTimeout(b.ctx, 5*time.Second)
+	defer cancel()
+	if _, err := b.pubsub.Receive(ctx); err != nil {
+		b.pubsub.Close()
+		return err
+	}
+
+	go b.run()
+	return nil
+}
+
+func (b *RedisEventBus) run() {
+	// The channel reconnects automatically after connection loss
+	for message := range b.pubsub.Channel() {
+		var msg BusMessage
+		if err := json.Unmarshal([]byte(message.Payload), &msg); err != nil {
+			logBusError(b.Name(), "failed to decode message", err)
+			continue
+		}
+		b.deliver(&msg)
+	}
+}
+
+// Publish implements EventBus
+func (b *RedisEventBus) Publish(msg *BusMessage) error {
+	b.prepare(msg)
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, 2*time.Second)
+	defer cancel()
+	return b.client.Publish(ctx, redisEventBusChannel, data).Err()
+}
+
+// Close implements EventBus. The Redis client is owned by the cache manager
+// and stays open.
+func (b *RedisEventBus) Close() error {
+	b.cancel()
+	if b.pubsub != nil {
+		return b.pubsub.Close()
+	}
+	return nil
+}
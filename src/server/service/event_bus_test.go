@@ -0,0 +1,129 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+	"github.com/patrickmn/go-cache"
+	_ "modernc.org/sqlite"
+)
+
+func TestBusDispatcher_DropsDuplicatesAndOwnMessages(t *testing.T) {
+	d := newBusDispatcher("node-a")
+	delivered := 0
+	d.Subscribe(EventBusChannelHub, func(msg *BusMessage) { delivered++ })
+
+	msg := &BusMessage{ID: "01HZX", NodeID: "node-b", Channel: EventBusChannelHub}
+	d.deliver(msg)
+	d.deliver(msg)
+	if delivered != 1 {
+		t.Errorf("delivered %d times, want 1", delivered)
+	}
+
+	d.deliver(&BusMessage{ID: "01HZY", NodeID: "node-a", Channel: EventBusChannelHub})
+	if delivered != 1 {
+		t.Error("message from own node was delivered")
+	}
+
+	// A published message echoed back by the backend is ignored
+	own := &BusMessage{Channel: EventBusChannelHub}
+	d.prepare(own)
+	own.NodeID = "node-b"
+	d.deliver(own)
+	if delivered != 1 {
+		t.Error("echo of published message was delivered")
+	}
+}
+
+func TestSelectEventBusBackend(t *testing.T) {
+	tests := []struct {
+		backend string
+		redis   bool
+		dsn     string
+		want    string
+		wantErr bool
+	}{
+		{"auto", true, "host=db", EventBusRedis, false},
+		{"auto", false, "host=db", EventBusPostgres, false},
+		{"", false, "", EventBusDatabase, false},
+		{"redis", false, "", "", true},
+		{"postgres", true, "", "", true},
+		{"database", true, "host=db", EventBusDatabase, false},
+		{"kafka", false, "", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := SelectEventBusBackend(tt.backend, tt.redis, tt.dsn)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SelectEventBusBackend(%q) error = %v, wantErr %v", tt.backend, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("SelectEventBusBackend(%q) = %q, want %q", tt.backend, got, tt.want)
+		}
+	}
+}
+
+func TestPollingEventBus_Rebind(t *testing.T) {
+	bus := NewPollingEventBus(nil, "postgres", "node", 0)
+	if got := bus.rebind("WHERE id > ? AND node_id != ?"); got != "WHERE id > $1 AND node_id != $2" {
+		t.Errorf("rebind = %q", got)
+	}
+	bus = NewPollingEventBus(nil, "mysql", "node", 0)
+	if got := bus.rebind("id > ?"); got != "id > ?" {
+		t.Errorf("rebind changed a MySQL query: %q", got)
+	}
+}
+
+func TestCacheInvalidator_InvalidatesOtherNodes(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+	if err := database.ApplySchema(db, database.DialectSQLite, database.ServerSchema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	busA := NewPollingEventBus(db, "sqlite", "node-a", time.Hour)
+	busB := NewPollingEventBus(db, "sqlite", "node-b", time.Hour)
+	cacheA := cache.New(time.Minute, time.Minute)
+	cacheB := cache.New(time.Minute, time.Minute)
+
+	invA := NewCacheInvalidator(busA)
+	invB := NewCacheInvalidator(busB)
+	invA.Register("weather", cacheA)
+	invB.Register("weather", cacheB)
+
+	for _, bus := range []*PollingEventBus{busA, busB} {
+		if err := bus.Start(); err != nil {
+			t.Fatalf("Failed to start event bus: %v", err)
+		}
+		defer bus.Close()
+	}
+
+	for _, c := range []*cache.Cache{cacheA, cacheB} {
+		c.SetDefault("current_1_2", "sunny")
+		c.SetDefault("current_3_4", "rain")
+	}
+
+	invA.Invalidate("weather", "current_1_2")
+	busB.Poll()
+
+	for name, c := range map[string]*cache.Cache{"A": cacheA, "B": cacheB} {
+		if _, found := c.Get("current_1_2"); found {
+			t.Errorf("node %s still has invalidated key", name)
+		}
+		if _, found := c.Get("current_3_4"); !found {
+			t.Errorf("node %s lost a key that was not invalidated", name)
+		}
+	}
+
+	invB.InvalidateAll()
+	busA.Poll()
+	if cacheA.ItemCount() != 0 {
+		t.Errorf("node A has %d items after InvalidateAll on node B", cacheA.ItemCount())
+	}
+}
@@ -0,0 +1,583 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+// ProviderOpenMeteo names forecasts from Open-Meteo in forecast verification
+const ProviderOpenMeteo = "open-meteo"
+
+// Days with at least this much precipitation (mm) count as the event
+// precipitation probabilities are scored against
+const measurablePrecipitation = 0.1
+
+// Forecasts waiting to be recorded; more are dropped so a slow database
+// never holds up serving forecasts
+const forecastRecordQueue = 256
+
+// ForecastRecorder receives every forecast fetched from a provider, in
+// metric units, in the background
+type ForecastRecorder interface {
+	RecordForecast(provider string, latitude, longitude float64, forecast *Forecast, issued time.Time)
+}
+
+// forecastRecord is a fetched forecast waiting to be recorded
+type forecastRecord struct {
+	provider            string
+	latitude, longitude float64
+	forecast            *Forecast
+	issued              time.Time
+}
+
+// SetForecastRecorder starts the worker that hands fetched forecasts to the
+// recorder. Call it once, before the service is used.
+func (ws *WeatherService) SetForecastRecorder(recorder ForecastRecorder) {
+	records := make(chan forecastRecord, forecastRecordQueue)
+	ws.forecastRecords = records
+	go func() {
+		for r := range records {
+			recorder.RecordForecast(r.provider, r.latitude, r.longitude, r.forecast, r.issued)
+		}
+	}()
+}
+
+// queueForecastRecord queues a copy of the daily part of a metric forecast
+// for the recorder without waiting, dropping it when the queue is full
+func (ws *WeatherService) queueForecastRecord(provider string, latitude, longitude float64, forecast *Forecast, issued time.Time) {
+	if ws.forecastRecords == nil {
+		return
+	}
+	daily := &Forecast{Timezone: forecast.Timezone, Days: make([]ForecastDay, len(forecast.Days))}
+	for i, day := range forecast.Days {
+		day.Hourly = nil
+		daily.Days[i] = day
+	}
+
+	select {
+	case ws.forecastRecords <- forecastRecord{provider, latitude, longitude, daily, issued}:
+	default:
+		if n := ws.forecastRecordsDropped.Add(1); n == 1 || n%100 == 0 {
+			log.Printf("⚠️  Forecast verification is behind; %d forecasts not recorded", n)
+		}
+	}
+}
+
+// ForecastAlert is a threshold alert scored by forecast verification. A day
+// is an event when its value crosses the metric threshold.
+type ForecastAlert struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	threshold float64
+	below     bool
+	value     func(d *dayValues) *float64
+}
+
+// forecastAlerts are the threshold alerts scored for every provider and lead
+var forecastAlerts = []ForecastAlert{
+	{Name: "heat", Description: "High of 30 °C (86 °F) or more", threshold: 30,
+		value: func(d *dayValues) *float64 { return d.tempMax }},
+	{Name: "frost", Description: "Low of 0 °C (32 °F) or less", threshold: 0, below: true,
+		value: func(d *dayValues) *float64 { return d.tempMin }},
+	{Name: "heavy_rain", Description: "10 mm (0.39 in) of precipitation or more", threshold: 10,
+		value: func(d *dayValues) *float64 { return d.precipitation }},
+	{Name: "wind", Description: "Gusts of 60 km/h (37 mph) or more", threshold: 60,
+		value: func(d *dayValues) *float64 { return d.windGusts }},
+}
+
+// ForecastAlerts returns the threshold alerts forecast verification scores
+func ForecastAlerts() []ForecastAlert {
+	return forecastAlerts
+}
+
+// event reports whether the day crosses the threshold, nil when its value
+// is missing
+func (a *ForecastAlert) event(d *dayValues) *bool {
+	v := a.value(d)
+	if v == nil {
+		return nil
+	}
+	crossed := *v >= a.threshold
+	if a.below {
+		crossed = *v <= a.threshold
+	}
+	return &crossed
+}
+
+// ForecastComparison is a recorded daily forecast next to what was observed
+type ForecastComparison struct {
+	Provider                         string    `json:"provider"`
+	Day                              time.Time `json:"day"`
+	LeadDays                         int       `json:"leadDays"`
+	ForecastTempMax                  *float64  `json:"forecastTempMax"`
+	ForecastTempMin                  *float64  `json:"forecastTempMin"`
+	ForecastPrecipitation            *float64  `json:"forecastPrecipitation"`
+	ForecastPrecipitationProbability *int      `json:"forecastPrecipitationProbability"`
+	ObservedTempMax                  *float64  `json:"observedTempMax"`
+	ObservedTempMin                  *float64  `json:"observedTempMin"`
+	ObservedPrecipitation            *float64  `json:"observedPrecipitation"`
+}
+
+// AlertScore counts how a threshold alert was forecast. The hit rate is
+// the share of observed events that were forecast, the false alarm ratio
+// the share of forecast events that did not happen and the false alarm
+// rate the share of days without the event that were forecast to have it.
+type AlertScore struct {
+	Alert            string   `json:"alert"`
+	Hits             int      `json:"hits"`
+	Misses           int      `json:"misses"`
+	FalseAlarms      int      `json:"falseAlarms"`
+	CorrectNegatives int      `json:"correctNegatives"`
+	HitRate          *float64 `json:"hitRate"`
+	FalseAlarmRatio  *float64 `json:"falseAlarmRatio"`
+	FalseAlarmRate   *float64 `json:"falseAlarmRate"`
+}
+
+// ForecastLeadAccuracy is the accuracy of the forecasts a provider made
+// lead days ahead. Errors are mean absolute errors; biases are forecast
+// minus observed, so a positive bias means forecasts ran high. The hit rate
+// is the share of days whose wet or dry forecast was right. The Brier score
+// rates precipitation probabilities against days with measurable
+// precipitation (0 is perfect); the skill score compares it with always
+// forecasting the observed frequency (above 0 is better).
+type ForecastLeadAccuracy struct {
+	Provider             string       `json:"provider"`
+	LeadDays             int          `json:"leadDays"`
+	Days                 int          `json:"days"`
+	TempMaxError         *float64     `json:"tempMaxError"`
+	TempMaxBias          *float64     `json:"tempMaxBias"`
+	TempMinError         *float64     `json:"tempMinError"`
+	TempMinBias          *float64     `json:"tempMinBias"`
+	PrecipitationError   *float64     `json:"precipitationError"`
+	PrecipitationHitRate *float64     `json:"precipitationHitRate"`
+	BrierScore           *float64     `json:"brierScore"`
+	BrierSkillScore      *float64     `json:"brierSkillScore"`
+	Alerts               []AlertScore `json:"alerts"`
+}
+
+// ForecastAccuracy compares the recorded forecasts of a period with the
+// daily observations
+type ForecastAccuracy struct {
+	Leads []ForecastLeadAccuracy `json:"leads"`
+	Days  []ForecastComparison   `json:"days"`
+}
+
+// SiteVerification is the forecast accuracy at one site. The best provider
+// has the lowest next-day temperature error; it is empty until a next-day
+// forecast was verified.
+type SiteVerification struct {
+	Site         ObservationSite        `json:"site"`
+	Days         int                    `json:"days"`
+	BestProvider string                 `json:"bestProvider"`
+	Leads        []ForecastLeadAccuracy `json:"leads"`
+}
+
+// ForecastVerification scores the recorded forecasts of all sites, per
+// provider and lead time overall and per site
+type ForecastVerification struct {
+	From      time.Time              `json:"from"`
+	To        time.Time              `json:"to"`
+	Alerts    []ForecastAlert        `json:"alerts"`
+	Providers []ForecastLeadAccuracy `json:"providers"`
+	Sites     []SiteVerification     `json:"sites"`
+}
+
+// dayValues are the daily values verification compares, metric
+type dayValues struct {
+	tempMax, tempMin, precipitation, windGusts *float64
+}
+
+// forecastPair is a recorded forecast with the observation of its day
+type forecastPair struct {
+	siteID      int64
+	provider    string
+	day         int64
+	lead        int
+	probability *int
+	forecast    dayValues
+	observed    dayValues
+}
+
+// forecastIssue is one daily forecast to record, metric
+type forecastIssue struct {
+	TempMax                  *float64
+	TempMin                  *float64
+	Precipitation            *float64
+	PrecipitationProbability *int64
+	WindGustsMax             *float64
+	WeatherCode              *int64
+}
+
+// insertForecastIssue records a provider's forecast for a day unless one
+// was already recorded for the day at that lead, and returns the rows
+// written
+func insertForecastIssue(ctx context.Context, tx *sql.Tx, siteID int64, provider string, day time.Time, lead int, f forecastIssue, issued time.Time) (int64, error) {
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO weather_forecast_issues (site_id, provider, day, lead_days, temperature_max, temperature_min,
+			precipitation, precipitation_probability, wind_gusts_max, weather_code, issued_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(site_id, provider, day, lead_days) DO NOTHING`,
+		siteID, provider, day.Unix(), lead, f.TempMax, f.TempMin, f.Precipitation, f.PrecipitationProbability,
+		f.WindGustsMax, f.WeatherCode, issued.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return n, nil
+}
+
+// RecordForecast records the days of a served forecast for verification
+// when the location is a recorded site. Failures are logged; serving the
+// forecast does not depend on them.
+func (s *ObservationService) RecordForecast(provider string, latitude, longitude float64, forecast *Forecast, issued time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	site, err := s.FindSite(ctx, latitude, longitude)
+	if err != nil {
+		if !errors.Is(err, ErrNoObservations) {
+			log.Printf("⚠️  Forecast verification site lookup failed: %v", err)
+		}
+		return
+	}
+
+	loc := siteLocation(forecast.Timezone)
+	today := localMidnight(issued, loc)
+	err = database.WithTransaction(ctx, s.serverDB, func(tx *sql.Tx) error {
+		for _, d := range forecast.Days {
+			day, err := time.ParseInLocation("2006-01-02", d.Date, loc)
+			if err != nil {
+				continue
+			}
+			lead := int(math.Round(day.Sub(today).Hours() / 24))
+			if lead < 0 || lead >= observationForecastDays {
+				continue
+			}
+			tmax, tmin, precip, gusts := d.TempMax, d.TempMin, d.Precipitation, d.WindGustsMax
+			probability, code := int64(d.PrecipitationProbability), int64(d.WeatherCode)
+			if _, err := insertForecastIssue(ctx, tx, site.ID, provider, day, lead, forecastIssue{
+				TempMax:                  &tmax,
+				TempMin:                  &tmin,
+				Precipitation:            &precip,
+				PrecipitationProbability: &probability,
+				WindGustsMax:             &gusts,
+				WeatherCode:              &code,
+			}, issued); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("⚠️  Failed to record %s forecast for verification: %v", provider, err)
+	}
+}
+
+// forecastPairs returns the recorded forecasts for the days in [from, to)
+// that have a daily observation, of one site or of all sites when siteID
+// is 0
+func (s *ObservationService) forecastPairs(ctx context.Context, siteID int64, from, to time.Time) ([]forecastPair, error) {
+	query := `
+		SELECT f.site_id, f.provider, f.day, f.lead_days, f.precipitation_probability,
+			f.temperature_max, f.temperature_min, f.precipitation, f.wind_gusts_max,
+			o.temperature_max, o.temperature_min, o.precipitation, o.wind_gusts
+		FROM weather_forecast_issues f
+		JOIN weather_observations o ON o.site_id = f.site_id AND o.resolution = 'day' AND o.time = f.day
+		WHERE f.day >= ? AND f.day < ?`
+	args := []interface{}{from.Unix(), to.Unix()}
+	if siteID != 0 {
+		query += " AND f.site_id = ?"
+		args = append(args, siteID)
+	}
+	rows, err := s.serverDB.QueryContext(ctx, query+" ORDER BY f.site_id, f.day, f.provider, f.lead_days", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pairs []forecastPair
+	for rows.Next() {
+		var p forecastPair
+		var probability sql.NullInt64
+		if err := rows.Scan(&p.siteID, &p.provider, &p.day, &p.lead, &probability,
+			&p.forecast.tempMax, &p.forecast.tempMin, &p.forecast.precipitation, &p.forecast.windGusts,
+			&p.observed.tempMax, &p.observed.tempMin, &p.observed.precipitation, &p.observed.windGusts); err != nil {
+			return nil, err
+		}
+		p.probability = nullInt(probability)
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
+
+// alertCounts is the contingency table of one threshold alert
+type alertCounts struct {
+	hits, misses, falseAlarms, correctNegatives int
+}
+
+// leadScorer accumulates the forecasts of one provider and lead time
+type leadScorer struct {
+	days                  int
+	maxErr, maxBias       mean
+	minErr, minBias       mean
+	precipErr, precipHits mean
+	brier, wetDays        mean
+	alerts                []alertCounts
+}
+
+// difference adds the error and bias of a forecast value
+func difference(forecast, observed *float64, err, bias *mean) {
+	if forecast == nil || observed == nil {
+		return
+	}
+	diff := *forecast - *observed
+	err.add(sql.NullFloat64{Float64: math.Abs(diff), Valid: true})
+	bias.add(sql.NullFloat64{Float64: diff, Valid: true})
+}
+
+// indicator is 1 for true and 0 for false
+func indicator(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (sc *leadScorer) add(p *forecastPair) {
+	sc.days++
+	difference(p.forecast.tempMax, p.observed.tempMax, &sc.maxErr, &sc.maxBias)
+	difference(p.forecast.tempMin, p.observed.tempMin, &sc.minErr, &sc.minBias)
+
+	if observed := p.observed.precipitation; observed != nil {
+		if forecast := p.forecast.precipitation; forecast != nil {
+			sc.precipErr.add(sql.NullFloat64{Float64: math.Abs(*forecast - *observed), Valid: true})
+			hit := (*forecast >= wetDayPrecipitation) == (*observed >= wetDayPrecipitation)
+			sc.precipHits.add(sql.NullFloat64{Float64: indicator(hit), Valid: true})
+		}
+		if p.probability != nil {
+			wet := indicator(*observed >= measurablePrecipitation)
+			diff := float64(*p.probability)/100 - wet
+			sc.brier.add(sql.NullFloat64{Float64: diff * diff, Valid: true})
+			sc.wetDays.add(sql.NullFloat64{Float64: wet, Valid: true})
+		}
+	}
+
+	if sc.alerts == nil {
+		sc.alerts = make([]alertCounts, len(forecastAlerts))
+	}
+	for i := range forecastAlerts {
+		forecast, observed := forecastAlerts[i].event(&p.forecast), forecastAlerts[i].event(&p.observed)
+		if forecast == nil || observed == nil {
+			continue
+		}
+		counts := &sc.alerts[i]
+		switch {
+		case *forecast && *observed:
+			counts.hits++
+		case *observed:
+			counts.misses++
+		case *forecast:
+			counts.falseAlarms++
+		default:
+			counts.correctNegatives++
+		}
+	}
+}
+
+// ratio is n / total, nil when total is 0
+func ratio(n, total int) *float64 {
+	if total == 0 {
+		return nil
+	}
+	r := float64(n) / float64(total)
+	return &r
+}
+
+// result returns the scores with temperatures and precipitation in units
+func (sc *leadScorer) result(provider string, lead int, units string, w *WeatherService) ForecastLeadAccuracy {
+	tempDiff := func(v *float64) *float64 { return v }
+	precip := func(v *float64) *float64 { return v }
+	if units == "imperial" {
+		tempDiff = func(v *float64) *float64 { return convertPtr(v, func(d float64) float64 { return d * 9 / 5 }) }
+		precip = func(v *float64) *float64 { return convertPtr(v, w.mmToInches) }
+	}
+
+	accuracy := ForecastLeadAccuracy{
+		Provider:             provider,
+		LeadDays:             lead,
+		Days:                 sc.days,
+		TempMaxError:         tempDiff(sc.maxErr.value()),
+		TempMaxBias:          tempDiff(sc.maxBias.value()),
+		TempMinError:         tempDiff(sc.minErr.value()),
+		TempMinBias:          tempDiff(sc.minBias.value()),
+		PrecipitationError:   precip(sc.precipErr.value()),
+		PrecipitationHitRate: sc.precipHits.value(),
+		BrierScore:           sc.brier.value(),
+		Alerts:               make([]AlertScore, len(forecastAlerts)),
+	}
+	if accuracy.BrierScore != nil {
+		// Always forecasting the observed frequency b scores b(1-b)
+		b := *sc.wetDays.value()
+		if reference := b * (1 - b); reference > 0 {
+			skill := 1 - *accuracy.BrierScore/reference
+			accuracy.BrierSkillScore = &skill
+		}
+	}
+	for i, alert := range forecastAlerts {
+		var counts alertCounts
+		if sc.alerts != nil {
+			counts = sc.alerts[i]
+		}
+		accuracy.Alerts[i] = AlertScore{
+			Alert:            alert.Name,
+			Hits:             counts.hits,
+			Misses:           counts.misses,
+			FalseAlarms:      counts.falseAlarms,
+			CorrectNegatives: counts.correctNegatives,
+			HitRate:          ratio(counts.hits, counts.hits+counts.misses),
+			FalseAlarmRatio:  ratio(counts.falseAlarms, counts.hits+counts.falseAlarms),
+			FalseAlarmRate:   ratio(counts.falseAlarms, counts.falseAlarms+counts.correctNegatives),
+		}
+	}
+	return accuracy
+}
+
+// scoreForecasts scores pairs per provider and lead time, ordered by
+// provider and lead
+func (s *ObservationService) scoreForecasts(pairs []forecastPair, units string) []ForecastLeadAccuracy {
+	type key struct {
+		provider string
+		lead     int
+	}
+	scorers := make(map[key]*leadScorer)
+	var keys []key
+	for i := range pairs {
+		k := key{pairs[i].provider, pairs[i].lead}
+		sc := scorers[k]
+		if sc == nil {
+			sc = &leadScorer{}
+			scorers[k] = sc
+			keys = append(keys, k)
+		}
+		sc.add(&pairs[i])
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].provider != keys[j].provider {
+			return keys[i].provider < keys[j].provider
+		}
+		return keys[i].lead < keys[j].lead
+	})
+
+	leads := make([]ForecastLeadAccuracy, 0, len(keys))
+	for _, k := range keys {
+		leads = append(leads, scorers[k].result(k.provider, k.lead, units, s.weather))
+	}
+	return leads
+}
+
+// bestProvider returns the provider with the lowest mean of the next-day
+// maximum and minimum temperature errors
+func bestProvider(leads []ForecastLeadAccuracy) string {
+	best, bestErr := "", math.Inf(1)
+	for _, l := range leads {
+		if l.LeadDays != 1 || l.TempMaxError == nil || l.TempMinError == nil {
+			continue
+		}
+		if e := (*l.TempMaxError + *l.TempMinError) / 2; e < bestErr {
+			best, bestErr = l.Provider, e
+		}
+	}
+	return best
+}
+
+// ForecastAccuracy compares the forecasts recorded for the days of a site
+// in [from, to) with the daily observations of those days
+func (s *ObservationService) ForecastAccuracy(ctx context.Context, siteID int64, from, to time.Time, units string) (*ForecastAccuracy, error) {
+	pairs, err := s.forecastPairs(ctx, siteID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	temp := func(v *float64) *float64 { return v }
+	precip := func(v *float64) *float64 { return v }
+	if units == "imperial" {
+		w := s.weather
+		temp = func(v *float64) *float64 { return convertPtr(v, w.celsiusToFahrenheit) }
+		precip = func(v *float64) *float64 { return convertPtr(v, w.mmToInches) }
+	}
+
+	accuracy := &ForecastAccuracy{Leads: s.scoreForecasts(pairs, units), Days: make([]ForecastComparison, 0, len(pairs))}
+	for _, p := range pairs {
+		accuracy.Days = append(accuracy.Days, ForecastComparison{
+			Provider:                         p.provider,
+			Day:                              time.Unix(p.day, 0).UTC(),
+			LeadDays:                         p.lead,
+			ForecastTempMax:                  temp(p.forecast.tempMax),
+			ForecastTempMin:                  temp(p.forecast.tempMin),
+			ForecastPrecipitation:            precip(p.forecast.precipitation),
+			ForecastPrecipitationProbability: p.probability,
+			ObservedTempMax:                  temp(p.observed.tempMax),
+			ObservedTempMin:                  temp(p.observed.tempMin),
+			ObservedPrecipitation:            precip(p.observed.precipitation),
+		})
+	}
+	return accuracy, nil
+}
+
+// Verification scores the forecasts recorded for the days in [from, to)
+// of all sites. Sites are ordered by verified days, at most limit of them.
+func (s *ObservationService) Verification(ctx context.Context, from, to time.Time, limit int, units string) (*ForecastVerification, error) {
+	pairs, err := s.forecastPairs(ctx, 0, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sites, err := s.querySites(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	siteByID := make(map[int64]ObservationSite, len(sites))
+	for _, site := range sites {
+		siteByID[site.ID] = site
+	}
+
+	verification := &ForecastVerification{
+		From:      from.UTC(),
+		To:        to.UTC(),
+		Alerts:    forecastAlerts,
+		Providers: s.scoreForecasts(pairs, units),
+		Sites:     []SiteVerification{},
+	}
+
+	// Pairs are ordered by site
+	for start := 0; start < len(pairs); {
+		end := start
+		days := make(map[int64]bool)
+		for end < len(pairs) && pairs[end].siteID == pairs[start].siteID {
+			days[pairs[end].day] = true
+			end++
+		}
+		leads := s.scoreForecasts(pairs[start:end], units)
+		verification.Sites = append(verification.Sites, SiteVerification{
+			Site:         siteByID[pairs[start].siteID],
+			Days:         len(days),
+			BestProvider: bestProvider(leads),
+			Leads:        leads,
+		})
+		start = end
+	}
+	sort.SliceStable(verification.Sites, func(i, j int) bool {
+		return verification.Sites[i].Days > verification.Sites[j].Days
+	})
+	if limit > 0 && len(verification.Sites) > limit {
+		verification.Sites = verification.Sites[:limit]
+	}
+	return verification, nil
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// blockedRecorder holds every forecast it is given until release is closed
+type blockedRecorder struct {
+	received chan *Forecast
+	release  chan struct{}
+}
+
+func (r *blockedRecorder) RecordForecast(provider string, latitude, longitude float64, forecast *Forecast, issued time.Time) {
+	r.received <- forecast
+	<-r.release
+}
+
+func TestGetForecastWithBlockedRecorder(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data OpenMeteoForecastResponse
+		data.Timezone = "UTC"
+		d := &data.Daily
+		d.Time = []string{"2026-03-10"}
+		d.WeatherCode = []int{3}
+		d.Temperature2mMax, d.Temperature2mMin = []float64{20}, []float64{10}
+		d.ApparentTemperatureMax, d.ApparentTemperatureMin = []float64{19}, []float64{9}
+		d.PrecipitationSum, d.PrecipitationHours = []float64{2}, []float64{1}
+		d.PrecipitationProbabilityMax = []int{40}
+		d.WindSpeed10mMax, d.WindGusts10mMax = []float64{20}, []float64{40}
+		d.WindDirection10mDominant = []int{270}
+		d.ShortwaveRadiationSum = []float64{10}
+		json.NewEncoder(w).Encode(data)
+	}))
+	defer api.Close()
+
+	recorder := &blockedRecorder{received: make(chan *Forecast, 1), release: make(chan struct{})}
+	defer close(recorder.release)
+	ws := &WeatherService{client: api.Client(), cache: cache.New(time.Minute, time.Minute), openMeteoBaseURL: api.URL}
+	ws.SetForecastRecorder(recorder)
+
+	// The worker takes one forecast and blocks; the queue fills and the
+	// rest are dropped, all without holding up the requests
+	done := make(chan error)
+	go func() {
+		for i := 0; i < forecastRecordQueue+10; i++ {
+			if _, err := ws.GetForecast(float64(i)/100, 0, 1, "imperial"); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("GetForecast waited for the blocked recorder")
+	}
+
+	// The recorder gets the forecast in metric units
+	if got := <-recorder.received; got.Days[0].Date != "2026-03-10" || got.Days[0].TempMax != 20 {
+		t.Errorf("recorder got %+v", got.Days[0])
+	}
+	if dropped := ws.forecastRecordsDropped.Load(); dropped == 0 {
+		t.Error("no forecasts were dropped from the full queue")
+	}
+}
+
+func TestRecordForecast(t *testing.T) {
+	s := setupObservations(t)
+	ctx := context.Background()
+	if _, err := s.Record(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	forecast := &Forecast{Timezone: "UTC"}
+	for i := 0; i < 8; i++ {
+		forecast.Days = append(forecast.Days, ForecastDay{
+			Date:                     observationNow.AddDate(0, 0, i).Format("2006-01-02"),
+			TempMax:                  20,
+			TempMin:                  10,
+			PrecipitationProbability: 40,
+			WindGustsMax:             50,
+		})
+	}
+	s.RecordForecast("other", 52.5201, 13.4004, forecast, observationNow)
+	// Locations without a site are not recorded
+	s.RecordForecast("other", 35.6762, 139.6503, forecast, observationNow)
+
+	var rows, maxLead, probability int
+	var gusts float64
+	if err := s.serverDB.QueryRow(`SELECT COUNT(*), MAX(lead_days), MIN(precipitation_probability), MIN(wind_gusts_max)
+		FROM weather_forecast_issues WHERE provider = 'other'`).Scan(&rows, &maxLead, &probability, &gusts); err != nil {
+		t.Fatal(err)
+	}
+	// The eighth day is past the recorded lead times
+	if rows != 7 || maxLead != 6 || probability != 40 || gusts != 50 {
+		t.Errorf("recorded %d forecasts up to lead %d, probability %d, gusts %v", rows, maxLead, probability, gusts)
+	}
+}
+
+func TestVerification(t *testing.T) {
+	s := setupObservations(t)
+	ctx := context.Background()
+	day := func(i int) int64 { return time.Date(2026, 3, 1+i, 0, 0, 0, 0, time.UTC).Unix() }
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := s.serverDB.Exec(query, args...); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+	}
+	exec(`INSERT INTO weather_observation_sites (id, latitude, longitude) VALUES (1, 10, 10), (2, 20, 20)`)
+	observe := func(site int64, i int, tmax, tmin, precip, gusts float64) {
+		exec(`INSERT INTO weather_observations (site_id, resolution, time, temperature_max, temperature_min, precipitation, wind_gusts)
+			VALUES (?, 'day', ?, ?, ?, ?, ?)`, site, day(i), tmax, tmin, precip, gusts)
+	}
+	issue := func(site int64, provider string, i, lead int, tmax, tmin, precip float64, probability int, gusts float64) {
+		exec(`INSERT INTO weather_forecast_issues (site_id, provider, day, lead_days, temperature_max, temperature_min,
+			precipitation, precipitation_probability, wind_gusts_max, issued_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 0)`,
+			site, provider, day(i), lead, tmax, tmin, precip, probability, gusts)
+	}
+
+	// Heat on days 0 and 3, frost, heavy rain and strong gusts on day 1,
+	// day 2 dry but for a trace
+	observed := []struct{ tmax, tmin, precip, gusts float64 }{
+		{32, 5, 0, 20}, {25, -1, 12, 70}, {20, 8, 0.05, 10}, {31, 2, 3, 30},
+	}
+	for i, o := range observed {
+		observe(1, i, o.tmax, o.tmin, o.precip, o.gusts)
+		// A perfect provider, and one 2 °C high, 1 °C low, unsure of rain
+		// and forecasting strong gusts every day
+		probability := 0
+		if o.precip >= measurablePrecipitation {
+			probability = 100
+		}
+		issue(1, "good", i, 1, o.tmax, o.tmin, o.precip, probability, o.gusts)
+		issue(1, "poor", i, 1, o.tmax+2, o.tmin-1, o.precip, 50, 65)
+	}
+	observe(2, 0, 15, 5, 0, 10)
+	issue(2, "poor", 0, 0, 15, 5, 0, 0, 10)
+
+	v, err := s.Verification(ctx, time.Unix(day(0), 0), time.Unix(day(9), 0), 0, "metric")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Providers) != 3 || v.Providers[0].Provider != "good" || v.Providers[1].LeadDays != 0 || v.Providers[2].LeadDays != 1 {
+		t.Fatalf("providers = %+v", v.Providers)
+	}
+
+	good, poor := v.Providers[0], v.Providers[2]
+	if good.Days != 4 || *good.TempMaxError != 0 || *good.BrierScore != 0 || *good.BrierSkillScore != 1 {
+		t.Errorf("good = %+v", good)
+	}
+	if *poor.TempMaxError != 2 || *poor.TempMaxBias != 2 || *poor.TempMinBias != -1 ||
+		*poor.BrierScore != 0.25 || *poor.BrierSkillScore != 0 || *poor.PrecipitationHitRate != 1 {
+		t.Errorf("poor = %+v", poor)
+	}
+
+	heat := good.Alerts[0]
+	if heat.Alert != "heat" || heat.Hits != 2 || heat.CorrectNegatives != 2 || *heat.HitRate != 1 || *heat.FalseAlarmRatio != 0 {
+		t.Errorf("good heat alert = %+v", heat)
+	}
+	wind := poor.Alerts[3]
+	if wind.Alert != "wind" || wind.Hits != 1 || wind.FalseAlarms != 3 || *wind.HitRate != 1 ||
+		*wind.FalseAlarmRatio != 0.75 || *wind.FalseAlarmRate != 1 {
+		t.Errorf("poor wind alert = %+v", wind)
+	}
+	if frost := poor.Alerts[1]; frost.Hits != 1 || frost.Misses != 0 || frost.FalseAlarmRatio == nil || *frost.FalseAlarmRatio != 0 {
+		t.Errorf("poor frost alert = %+v", frost)
+	}
+
+	if len(v.Sites) != 2 || v.Sites[0].Site.ID != 1 || v.Sites[0].Days != 4 || v.Sites[0].BestProvider != "good" ||
+		v.Sites[1].BestProvider != "" {
+		t.Errorf("sites = %+v", v.Sites)
+	}
+	if limited, _ := s.Verification(ctx, time.Unix(day(0), 0), time.Unix(day(9), 0), 1, "metric"); len(limited.Sites) != 1 {
+		t.Errorf("site limit returned %d sites", len(limited.Sites))
+	}
+
+	imperial, err := s.Verification(ctx, time.Unix(day(0), 0), time.Unix(day(9), 0), 0, "imperial")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bias := *imperial.Providers[2].TempMaxBias; math.Abs(bias-3.6) > 1e-9 || *imperial.Providers[2].BrierScore != 0.25 {
+		t.Errorf("imperial poor = %+v", imperial.Providers[2])
+	}
+
+	accuracy, err := s.ForecastAccuracy(ctx, 1, time.Unix(day(0), 0), time.Unix(day(9), 0), "metric")
+	if err != nil || len(accuracy.Leads) != 2 || len(accuracy.Days) != 8 || *accuracy.Days[0].ForecastPrecipitationProbability != 0 {
+		t.Errorf("site accuracy = %+v, %v", accuracy, err)
+	}
+}
@@ -308,6 +308,33 @@ func (gs *GeoIPService) lookupCountry(parsedIP net.IP, ipStr string) (*GeoIPData
 	return geoData, nil
 }
 
+// LookupASN returns the autonomous system number and organization for an IP
+func (gs *GeoIPService) LookupASN(ip string) (uint, string, error) {
+	if !gs.IsEnabled() {
+		return 0, "", fmt.Errorf("GeoIP databases not loaded yet")
+	}
+
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return 0, "", fmt.Errorf("invalid IP address: %s", ip)
+	}
+	if parsedIP.IsLoopback() || parsedIP.IsPrivate() {
+		return 0, "", fmt.Errorf("cannot look up ASN of private/local IP: %s", ip)
+	}
+
+	asnReader, err := geoip2.Open(gs.asnPath)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open ASN database: %w", err)
+	}
+	defer asnReader.Close()
+
+	record, err := asnReader.ASN(parsedIP)
+	if err != nil {
+		return 0, "", fmt.Errorf("ASN lookup failed: %w", err)
+	}
+	return record.AutonomousSystemNumber, record.AutonomousSystemOrganization, nil
+}
+
 // IsEnabled returns whether GeoIP is enabled
 func (gs *GeoIPService) IsEnabled() bool {
 	gs.mu.RLock()
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/apimgr/weather/src/server/model"
+)
+
+// hubBusEvent is the bus payload for a hub event
+type hubBusEvent struct {
+	Type    string          `json:"type"`
+	UserID  *int            `json:"user_id,omitempty"`
+	AdminID *int            `json:"admin_id,omitempty"`
+	Key     string          `json:"key,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// HubClusterRelay connects the WebSocket hub to the cluster event bus, so
+// clients connected to any node receive events published on every node
+type HubClusterRelay struct {
+	Bus    EventBus
+	Hub    *WebSocketHub
+	NodeID string
+}
+
+// NewHubClusterRelay creates a relay between hub and bus
+func NewHubClusterRelay(bus EventBus, hub *WebSocketHub, nodeID string) *HubClusterRelay {
+	return &HubClusterRelay{
+		Bus:    bus,
+		Hub:    hub,
+		NodeID: nodeID,
+	}
+}
+
+// Attach subscribes to the bus and forwards local hub events (call before
+// the bus is started)
+func (r *HubClusterRelay) Attach() {
+	r.Bus.Subscribe(EventBusChannelHub, r.receive)
+	r.Hub.SetRelay(r, r.NodeID)
+}
+
+// Forward implements HubRelay
+func (r *HubClusterRelay) Forward(event *HubEvent) {
+	data, err := json.Marshal(event.Message.Data)
+	if err != nil {
+		log.Printf("Hub cluster relay: failed to encode %s event: %v", event.Message.Type, err)
+		return
+	}
+	payload, err := json.Marshal(hubBusEvent{
+		Type:    event.Message.Type,
+		UserID:  event.UserID,
+		AdminID: event.AdminID,
+		Key:     event.Key,
+		Data:    data,
+	})
+	if err != nil {
+		log.Printf("Hub cluster relay: failed to encode %s event: %v", event.Message.Type, err)
+		return
+	}
+
+	// The bus message shares the hub event ID so both layers dedup alike
+	err = r.Bus.Publish(&BusMessage{
+		ID:      event.Message.ID,
+		NodeID:  r.NodeID,
+		Channel: EventBusChannelHub,
+		Payload: payload,
+		Time:    event.Time,
+	})
+	if err != nil {
+		log.Printf("Hub cluster relay: failed to publish %s event: %v", event.Message.Type, err)
+	}
+}
+
+// receive delivers a hub event published on another node
+func (r *HubClusterRelay) receive(msg *BusMessage) {
+	var payload hubBusEvent
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		log.Printf("Hub cluster relay: failed to decode event %s: %v", msg.ID, err)
+		return
+	}
+
+	r.Hub.Receive(&HubEvent{
+		Message: &WebSocketMessage{
+			ID:   msg.ID,
+			Type: payload.Type,
+			Data: decodeHubData(payload.Type, payload.Data),
+		},
+		UserID:  payload.UserID,
+		AdminID: payload.AdminID,
+		Key:     payload.Key,
+		NodeID:  msg.NodeID,
+		Time:    msg.Time,
+	})
+}
+
+// decodeHubData restores the typed payload that local publishers use, so
+// relayed events look the same to subscribers as local ones
+func decodeHubData(eventType string, payload []byte) interface{} {
+	switch eventType {
+	case HubMessageNotification:
+		var notification models.Notification
+		if err := json.Unmarshal(payload, &notification); err == nil {
+			return &notification
+		}
+	case HubMessageEarthquake:
+		var eq Earthquake
+		if err := json.Unmarshal(payload, &eq); err == nil {
+			return eq
+		}
+	case HubMessageSevereWeatherAlert:
+		var alert Alert
+		if err := json.Unmarshal(payload, &alert); err == nil {
+			return alert
+		}
+	}
+	return json.RawMessage(payload)
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/model"
+	_ "modernc.org/sqlite"
+)
+
+// testClusterNode is one in-process cluster node sharing the test database
+type testClusterNode struct {
+	hub *WebSocketHub
+	bus *PollingEventBus
+}
+
+// setupTestCluster starts n hubs connected through a polling event bus on a
+// shared in-memory database. Buses are polled manually by the tests.
+func setupTestCluster(t *testing.T, n int) []*testClusterNode {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.ApplySchema(db, database.DialectSQLite, database.ServerSchema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	nodes := make([]*testClusterNode, n)
+	for i := range nodes {
+		nodeID := fmt.Sprintf("node-%d", i)
+		hub := NewWebSocketHub()
+		go hub.Run()
+
+		bus := NewPollingEventBus(db, "sqlite", nodeID, time.Hour)
+		NewHubClusterRelay(bus, hub, nodeID).Attach()
+		if err := bus.Start(); err != nil {
+			t.Fatalf("Failed to start event bus: %v", err)
+		}
+
+		t.Cleanup(func() {
+			bus.Close()
+			hub.Stop()
+		})
+		nodes[i] = &testClusterNode{hub: hub, bus: bus}
+	}
+	return nodes
+}
+
+func pollAll(nodes []*testClusterNode) {
+	for _, node := range nodes {
+		node.bus.Poll()
+	}
+}
+
+// drain counts messages received within the timeout
+func drain(sub *HubSubscription, timeout time.Duration) int {
+	received := 0
+	deadline := time.After(timeout)
+	for {
+		select {
+		case <-sub.C:
+			received++
+		case <-deadline:
+			return received
+		}
+	}
+}
+
+func TestHubClusterRelay_DeliversToUserOnOtherNode(t *testing.T) {
+	nodes := setupTestCluster(t, 3)
+
+	userID := 7
+	sub := nodes[2].hub.Subscribe(&userID, nil, HubMessageNotification)
+
+	notification := &models.Notification{ID: "relay-1", UserID: &userID, Title: "Hello"}
+	nodes[0].hub.BroadcastToUser(userID, notification)
+	pollAll(nodes)
+
+	select {
+	case msg := <-sub.C:
+		got, ok := msg.Data.(*models.Notification)
+		if !ok || got.ID != "relay-1" {
+			t.Errorf("Data = %v, want notification relay-1", msg.Data)
+		}
+		if msg.ID == "" {
+			t.Error("Relayed message lost its event ID")
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Node 2 did not receive relayed notification")
+	}
+
+	// Node 0 must not receive its own event back, and polling again must not
+	// redeliver
+	pollAll(nodes)
+	if events := nodes[0].hub.EventsSince("0"); len(events) != 1 {
+		t.Errorf("Node 0 buffered %d events, want 1", len(events))
+	}
+	if n := drain(sub, 50*time.Millisecond); n != 0 {
+		t.Errorf("Event delivered %d extra times", n)
+	}
+}
+
+func TestHubClusterRelay_BroadcastReachesEveryNode(t *testing.T) {
+	nodes := setupTestCluster(t, 3)
+
+	subs := make([]*HubSubscription, len(nodes))
+	for i, node := range nodes {
+		subs[i] = node.hub.Subscribe(nil, nil, HubMessageSystem)
+	}
+
+	nodes[1].hub.Publish(&WebSocketMessage{Type: HubMessageSystem, Data: "maintenance"})
+	pollAll(nodes)
+
+	for i, sub := range subs {
+		if n := drain(sub, 50*time.Millisecond); n != 1 {
+			t.Errorf("Node %d received %d messages, want 1", i, n)
+		}
+	}
+}
+
+func TestHubClusterRelay_DedupesFeedEventsAcrossNodes(t *testing.T) {
+	nodes := setupTestCluster(t, 2)
+
+	sub := nodes[1].hub.Subscribe(nil, nil, HubMessageEarthquake)
+
+	// Both nodes poll the same upstream feed and publish the same earthquake
+	for _, node := range nodes {
+		node.hub.PublishEvent(&HubEvent{
+			Message: &WebSocketMessage{Type: HubMessageEarthquake, Data: Earthquake{ID: "us9"}},
+			Key:     "earthquake:us9",
+		})
+	}
+	pollAll(nodes)
+
+	if n := drain(sub, 100*time.Millisecond); n != 1 {
+		t.Errorf("Node 1 received %d earthquake events, want 1", n)
+	}
+}
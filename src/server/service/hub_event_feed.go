@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/store"
+)
+
+// hubAlertRadiusMiles is how close an alert with a geometry must be to a
+// saved location to be published
+const hubAlertRadiusMiles = 50
+
+// HubEventFeed polls upstream hazard sources and publishes new events to the
+// WebSocket hub, where WebSocket clients and GraphQL subscriptions receive them
+type HubEventFeed struct {
+	Hub           *WebSocketHub
+	Earthquakes   *EarthquakeService
+	SevereWeather *SevereWeatherService
+	// Severe weather alerts are polled for the saved locations with alerts
+	// enabled, in whichever country they are
+	Store    store.Store
+	Interval time.Duration
+
+	seenQuakes map[string]time.Time
+	seenAlerts map[string]time.Time
+	primed     bool
+	mu         sync.Mutex
+	done       chan struct{}
+	stopOnce   sync.Once
+}
+
+// NewHubEventFeed creates a feed that polls every interval (default 1 minute)
+func NewHubEventFeed(hub *WebSocketHub, earthquakes *EarthquakeService, severeWeather *SevereWeatherService, st store.Store, interval time.Duration) *HubEventFeed {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &HubEventFeed{
+		Hub:           hub,
+		Earthquakes:   earthquakes,
+		SevereWeather: severeWeather,
+		Store:         st,
+		Interval:      interval,
+		seenQuakes:    make(map[string]time.Time),
+		seenAlerts:    make(map[string]time.Time),
+		done:          make(chan struct{}),
+	}
+}
+
+// Run polls until Stop is called (run in goroutine)
+func (f *HubEventFeed) Run() {
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	f.Poll()
+	for {
+		select {
+		case <-ticker.C:
+			f.Poll()
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// Stop stops the feed
+func (f *HubEventFeed) Stop() {
+	f.stopOnce.Do(func() { close(f.done) })
+}
+
+// Poll fetches the latest events once and publishes any not seen before.
+// The first poll only records what is already active so that subscribers
+// are not flooded with the existing backlog on startup.
+func (f *HubEventFeed) Poll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+
+	if f.Earthquakes != nil {
+		collection, err := f.Earthquakes.GetEarthquakes("all_hour")
+		if err != nil {
+			log.Printf("Hub event feed: earthquake poll failed: %v", err)
+		} else {
+			for _, eq := range collection.Earthquakes {
+				_, seen := f.seenQuakes[eq.ID]
+				f.seenQuakes[eq.ID] = now
+				if !seen && f.primed {
+					f.Hub.PublishEvent(&HubEvent{
+						Message: &WebSocketMessage{Type: HubMessageEarthquake, Data: eq},
+						Key:     HubMessageEarthquake + ":" + eq.ID,
+					})
+				}
+			}
+			pruneSeenEvents(f.seenQuakes, now)
+		}
+	}
+
+	if f.SevereWeather != nil && f.Store != nil {
+		f.pollSevereWeather(now)
+	}
+
+	f.primed = true
+}
+
+// pollSevereWeather publishes new alerts for the regions of the saved
+// locations with alerts enabled. Nothing is fetched while there are none
+func (f *HubEventFeed) pollSevereWeather(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), database.TimeoutComplexSelect)
+	locations, err := f.Store.ListAlertLocations(ctx)
+	cancel()
+	if err != nil {
+		log.Printf("Hub event feed: failed to list alert locations: %v", err)
+		return
+	}
+	if len(locations) == 0 {
+		return
+	}
+
+	alerts, err := f.SevereWeather.AlertsForLocations(locations, hubAlertRadiusMiles)
+	if err != nil {
+		log.Printf("Hub event feed: severe weather poll failed: %v", err)
+		if len(alerts) == 0 {
+			return
+		}
+	}
+	for _, alert := range alerts {
+		if alert.ID == "" {
+			continue
+		}
+		_, seen := f.seenAlerts[alert.ID]
+		f.seenAlerts[alert.ID] = now
+		if !seen && f.primed {
+			f.Hub.PublishEvent(&HubEvent{
+				Message: &WebSocketMessage{Type: HubMessageSevereWeatherAlert, Data: alert},
+				Key:     HubMessageSevereWeatherAlert + ":" + alert.ID,
+			})
+		}
+	}
+	pruneSeenEvents(f.seenAlerts, now)
+}
+
+// pruneSeenEvents forgets events that have dropped out of the upstream feed
+func pruneSeenEvents(seen map[string]time.Time, now time.Time) {
+	cutoff := now.Add(-time.Hour)
+	for id, seenAt := range seen {
+		if seenAt.Before(cutoff) {
+			delete(seen, id)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/apimgr/weather/src/server/store"
+)
+
+func TestHubEventFeedPollsAlertsForSavedLocations(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	user := &models.User{Username: "alice", Email: "alice@example.com"}
+	if err := st.CreateUser(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	// London: alerts come from the Met Office, not the NWS
+	london := &models.SavedLocation{UserID: int(user.ID), Name: "London", Latitude: 51.5074, Longitude: -0.1278, AlertsEnabled: true}
+	if err := st.CreateLocation(ctx, london); err != nil {
+		t.Fatal(err)
+	}
+
+	ukAlerts := []Alert{{ID: "uk-1", Event: "Wind warning", AreaDesc: "London & South East England"}}
+	severeWeather := NewSevereWeatherService()
+	severeWeather.alertSources = map[string]func() ([]Alert, error){
+		"GB": func() ([]Alert, error) { return ukAlerts, nil },
+		"US": func() ([]Alert, error) {
+			t.Error("The NWS was polled without a saved location in the US")
+			return nil, nil
+		},
+	}
+
+	hub := NewWebSocketHub()
+	go hub.Run()
+	defer hub.Stop()
+	sub := hub.Subscribe(nil, nil, HubMessageSevereWeatherAlert)
+	defer hub.Unsubscribe(sub)
+
+	feed := NewHubEventFeed(hub, nil, severeWeather, st, time.Minute)
+	// The first poll records the active alerts without publishing them
+	feed.Poll()
+	ukAlerts = append(ukAlerts, Alert{ID: "uk-2", Event: "Rain warning", AreaDesc: "Wales"})
+	feed.Poll()
+
+	select {
+	case msg := <-sub.C:
+		alert, ok := msg.Data.(Alert)
+		if !ok || alert.ID != "uk-2" {
+			t.Fatalf("published %+v, want alert uk-2", msg.Data)
+		}
+		// Subscribers near London receive it though it has no geometry
+		if !AlertNearLocation(alert, 51.45, -0.97, 50) || AlertNearLocation(alert, 40.71, -74.01, 50) {
+			t.Errorf("alert for country %q matched the wrong subscribers", alert.Country)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The new Met Office alert was not published")
+	}
+	select {
+	case msg := <-sub.C:
+		t.Errorf("unexpected event %+v", msg.Data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"database/sql"
+	"log"
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apimgr/weather/src/server/model"
+)
+
+// Pseudo-lists for blocks that do not come from a downloaded list
+const (
+	BlocklistListManual  = models.BlocklistSourceManual
+	BlocklistListCountry = "country"
+)
+
+// BlocklistMatch explains why an address was blocked
+type BlocklistMatch struct {
+	// List that matched: a downloaded list name, manual or country
+	List string `json:"list"`
+	// Matching range or country code
+	Entry string `json:"entry"`
+}
+
+// BlocklistListStats is one list's size and hits since the server started
+type BlocklistListStats struct {
+	Name      string `json:"name"`
+	Entries   int    `json:"entries"`
+	Hits      int64  `json:"hits"`
+	UpdatedAt string `json:"updated_at,omitempty"`
+	// Downloaded lists are only enforced while security.blocklist.enabled
+	Enforced bool `json:"enforced"`
+}
+
+// blocklistSnapshot is an immutable set of matchers swapped in on reload
+type blocklistSnapshot struct {
+	allow     *IPMatcher
+	deny      *IPMatcher
+	countries map[string]bool
+	entries   map[string]int
+}
+
+// IPBlocklistService checks client addresses against the downloaded IP
+// blocklists and the administrator's allow, deny and country entries. The
+// lists are held in memory and rebuilt by Reload.
+type IPBlocklistService struct {
+	db *sql.DB
+
+	snapshot atomic.Pointer[blocklistSnapshot]
+	geoip    atomic.Pointer[GeoIPService]
+	// Downloaded lists are enforced (security.blocklist.enabled)
+	sourcesEnabled atomic.Bool
+
+	hitsMu sync.Mutex
+	hits   map[string]*atomic.Int64
+}
+
+// NewIPBlocklistService creates the service and loads the lists
+func NewIPBlocklistService(db *sql.DB) *IPBlocklistService {
+	s := &IPBlocklistService{
+		db:   db,
+		hits: make(map[string]*atomic.Int64),
+	}
+	s.snapshot.Store(&blocklistSnapshot{
+		allow:     NewIPMatcher(),
+		deny:      NewIPMatcher(),
+		countries: map[string]bool{},
+		entries:   map[string]int{},
+	})
+	if err := s.Reload(); err != nil {
+		log.Printf("IP blocklist: %v", err)
+	}
+	return s
+}
+
+// SetGeoIP enables country entries
+func (s *IPBlocklistService) SetGeoIP(geoip *GeoIPService) {
+	s.geoip.Store(geoip)
+}
+
+// Reload rebuilds the matchers from the database. On error the previous
+// lists stay in effect.
+func (s *IPBlocklistService) Reload() error {
+	blocklists := &models.BlocklistModel{DB: s.db}
+	next := &blocklistSnapshot{
+		allow:     NewIPMatcher(),
+		deny:      NewIPMatcher(),
+		countries: map[string]bool{},
+		entries:   map[string]int{},
+	}
+
+	entries, err := blocklists.ListActive()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Type == models.BlocklistTypeCountry {
+			next.countries[entry.Value] = true
+			next.entries[BlocklistListCountry]++
+			continue
+		}
+		prefix, err := entry.Prefix()
+		if err != nil {
+			continue
+		}
+		if entry.Action == models.BlocklistActionAllow {
+			next.allow.Insert(prefix, BlocklistListManual)
+		} else {
+			next.deny.Insert(prefix, BlocklistListManual)
+			next.entries[BlocklistListManual]++
+		}
+	}
+
+	var setting string
+	err = s.db.QueryRow("SELECT value FROM server_config WHERE key = 'security.blocklist.enabled'").Scan(&setting)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	enabled := setting == "true"
+	if enabled {
+		err := blocklists.EachSourceRange(func(source, ipRange string) {
+			prefix, err := netip.ParsePrefix(ipRange)
+			if err != nil {
+				return
+			}
+			next.deny.Insert(prefix, source)
+			next.entries[source]++
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	s.sourcesEnabled.Store(enabled)
+	s.snapshot.Store(next)
+	return nil
+}
+
+// SourcesEnabled reports whether the downloaded lists are enforced
+func (s *IPBlocklistService) SourcesEnabled() bool {
+	return s.sourcesEnabled.Load()
+}
+
+// Check reports whether ip is blocked and by which list. Allow entries win
+// over everything; otherwise the most specific denied range wins, then
+// denied countries. Unparseable addresses are never blocked.
+func (s *IPBlocklistService) Check(ip string) (BlocklistMatch, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return BlocklistMatch{}, false
+	}
+	addr = addr.Unmap()
+	snapshot := s.snapshot.Load()
+
+	if _, ok := snapshot.allow.Lookup(addr); ok {
+		return BlocklistMatch{}, false
+	}
+	if match, ok := snapshot.deny.Lookup(addr); ok {
+		return s.hit(BlocklistMatch{List: match.List, Entry: match.Prefix.String()}), true
+	}
+
+	if len(snapshot.countries) > 0 && !addr.IsPrivate() && !addr.IsLoopback() {
+		if geoip := s.geoip.Load(); geoip != nil && geoip.IsEnabled() {
+			if data, err := geoip.LookupIP(addr.String()); err == nil && snapshot.countries[data.CountryCode] {
+				return s.hit(BlocklistMatch{List: BlocklistListCountry, Entry: data.CountryCode}), true
+			}
+		}
+	}
+	return BlocklistMatch{}, false
+}
+
+func (s *IPBlocklistService) hit(match BlocklistMatch) BlocklistMatch {
+	s.hitsMu.Lock()
+	counter, ok := s.hits[match.List]
+	if !ok {
+		counter = &atomic.Int64{}
+		s.hits[match.List] = counter
+	}
+	s.hitsMu.Unlock()
+	counter.Add(1)
+	return match
+}
+
+// Stats lists every known list with its size and hit count
+func (s *IPBlocklistService) Stats() ([]BlocklistListStats, error) {
+	snapshot := s.snapshot.Load()
+	enabled := s.sourcesEnabled.Load()
+	stats := map[string]*BlocklistListStats{
+		BlocklistListManual:  {Name: BlocklistListManual, Enforced: true},
+		BlocklistListCountry: {Name: BlocklistListCountry, Enforced: true},
+	}
+
+	sources, err := (&models.BlocklistModel{DB: s.db}).Sources()
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		stats[source.Name] = &BlocklistListStats{
+			Name:      source.Name,
+			Entries:   source.Entries,
+			UpdatedAt: source.UpdatedAt,
+			Enforced:  enabled,
+		}
+	}
+	stats[BlocklistListManual].Entries = snapshot.entries[BlocklistListManual]
+	stats[BlocklistListCountry].Entries = snapshot.entries[BlocklistListCountry]
+
+	s.hitsMu.Lock()
+	for name, counter := range s.hits {
+		if _, ok := stats[name]; !ok {
+			stats[name] = &BlocklistListStats{Name: name}
+		}
+		stats[name].Hits = counter.Load()
+	}
+	s.hitsMu.Unlock()
+
+	result := make([]BlocklistListStats, 0, len(stats))
+	for _, stat := range stats {
+		result = append(result, *stat)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// RunReloader reloads the lists every interval so expired entries stop
+// applying
+func (s *IPBlocklistService) RunReloader(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := s.Reload(); err != nil {
+			log.Printf("IP blocklist: reload failed: %v", err)
+		}
+	}
+}
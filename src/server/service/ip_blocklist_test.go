@@ -0,0 +1,150 @@
+package service
+
+import (
+	"database/sql"
+	"net/netip"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/model"
+)
+
+func TestIPMatcher_LongestPrefix(t *testing.T) {
+	m := NewIPMatcher()
+	m.Insert(netip.MustParsePrefix("10.0.0.0/8"), "wide")
+	m.Insert(netip.MustParsePrefix("10.1.0.0/16"), "narrow")
+	m.Insert(netip.MustParsePrefix("2001:db8::/32"), "v6")
+	m.Insert(netip.MustParsePrefix("::ffff:192.0.2.0/120"), "mapped")
+	// Duplicates keep the first list
+	m.Insert(netip.MustParsePrefix("10.0.0.0/8"), "again")
+
+	if m.Len() != 4 {
+		t.Fatalf("Len() = %d, want 4", m.Len())
+	}
+
+	tests := []struct {
+		addr string
+		list string
+	}{
+		{"10.2.3.4", "wide"},
+		{"10.1.3.4", "narrow"},
+		{"::ffff:10.1.3.4", "narrow"},
+		{"2001:db8:1::1", "v6"},
+		{"192.0.2.77", "mapped"},
+		{"11.0.0.1", ""},
+		{"2001:db9::1", ""},
+	}
+	for _, tt := range tests {
+		match, ok := m.Lookup(netip.MustParseAddr(tt.addr))
+		if ok != (tt.list != "") || match.List != tt.list {
+			t.Errorf("Lookup(%s) = %+v, %v; want list %q", tt.addr, match, ok, tt.list)
+		}
+	}
+}
+
+func TestIPBlocklistService(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(database.ServerSchema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+
+	_, err = db.Exec(`INSERT INTO server_ip_blocklist (source, ip_range) VALUES
+		('spamhaus_drop', '198.51.100.0/24'), ('spamhaus_edrop', '2001:db8::/32')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocklists := &models.BlocklistModel{DB: db}
+	expired := time.Now().Add(-time.Minute)
+	for _, entry := range []*models.BlocklistEntry{
+		{Type: "cidr", Value: "203.0.113.7/24", Action: "deny"},
+		{Type: "ip", Value: "198.51.100.10", Action: "allow"},
+		{Type: "ip", Value: "192.0.2.1", Action: "deny", ExpiresAt: &expired},
+	} {
+		if err := blocklists.Create(entry); err != nil {
+			t.Fatalf("Create(%s) failed: %v", entry.Value, err)
+		}
+	}
+
+	s := NewIPBlocklistService(db)
+
+	// Downloaded lists only apply once enabled
+	if _, blocked := s.Check("198.51.100.1"); blocked {
+		t.Fatal("downloaded list enforced while disabled")
+	}
+	if match, blocked := s.Check("203.0.113.50"); !blocked || match.List != BlocklistListManual || match.Entry != "203.0.113.0/24" {
+		t.Fatalf("manual deny: %+v, %v", match, blocked)
+	}
+
+	if _, err := db.Exec(`INSERT INTO server_config (key, value, type) VALUES ('security.blocklist.enabled', 'true', 'boolean')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		list string
+	}{
+		{"198.51.100.1", "spamhaus_drop"},
+		{"2001:db8::1", "spamhaus_edrop"},
+		// Allow entries win over downloaded lists
+		{"198.51.100.10", ""},
+		// Expired entries no longer apply
+		{"192.0.2.1", ""},
+		{"not-an-ip", ""},
+	}
+	for _, tt := range tests {
+		match, blocked := s.Check(tt.ip)
+		if blocked != (tt.list != "") || match.List != tt.list {
+			t.Errorf("Check(%s) = %+v, %v; want list %q", tt.ip, match, blocked, tt.list)
+		}
+	}
+
+	stats, err := s.Stats()
+	if err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	hits := map[string]int64{}
+	for _, stat := range stats {
+		hits[stat.Name] = stat.Hits
+	}
+	if hits["spamhaus_drop"] != 1 || hits["spamhaus_edrop"] != 1 || hits[BlocklistListManual] != 1 {
+		t.Fatalf("unexpected hit counts: %+v", stats)
+	}
+}
+
+func TestBlocklistEntry_Normalize(t *testing.T) {
+	tests := []struct {
+		entry models.BlocklistEntry
+		value string
+		ok    bool
+	}{
+		{models.BlocklistEntry{Type: "ip", Value: "::ffff:192.0.2.1"}, "192.0.2.1", true},
+		{models.BlocklistEntry{Type: "cidr", Value: "192.0.2.9/24"}, "192.0.2.0/24", true},
+		{models.BlocklistEntry{Type: "country", Value: "cn"}, "CN", true},
+		{models.BlocklistEntry{Type: "country", Value: "CN", Action: "allow"}, "", false},
+		{models.BlocklistEntry{Type: "country", Value: "China"}, "", false},
+		{models.BlocklistEntry{Type: "ip", Value: "300.1.1.1"}, "", false},
+		{models.BlocklistEntry{Type: "asn", Value: "AS13335"}, "", false},
+	}
+	for _, tt := range tests {
+		entry := tt.entry
+		err := entry.Normalize()
+		if (err == nil) != tt.ok {
+			t.Errorf("Normalize(%s %s) error = %v, want ok %v", tt.entry.Type, tt.entry.Value, err, tt.ok)
+			continue
+		}
+		if tt.ok && entry.Value != tt.value {
+			t.Errorf("Normalize(%s %s) value = %s, want %s", tt.entry.Type, tt.entry.Value, entry.Value, tt.value)
+		}
+	}
+}
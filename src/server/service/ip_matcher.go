@@ -0,0 +1,98 @@
+package service
+
+import "net/netip"
+
+// IPMatch is the most specific prefix containing an address
+type IPMatch struct {
+	Prefix netip.Prefix
+	// Name of the list the prefix came from
+	List string
+}
+
+// IPMatcher finds the most specific CIDR prefix containing an address. It
+// keeps one binary prefix tree per address family, so a lookup visits at
+// most 32 (IPv4) or 128 (IPv6) nodes regardless of how many prefixes are
+// stored. Build it, then share it read-only; it is not safe for concurrent
+// writes.
+type IPMatcher struct {
+	v4   *ipTrieNode
+	v6   *ipTrieNode
+	size int
+}
+
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	match    *IPMatch
+}
+
+// NewIPMatcher creates an empty matcher
+func NewIPMatcher() *IPMatcher {
+	return &IPMatcher{v4: &ipTrieNode{}, v6: &ipTrieNode{}}
+}
+
+// Insert adds a prefix. IPv4-mapped IPv6 prefixes are stored as IPv4. A
+// prefix inserted twice keeps the first list name.
+func (m *IPMatcher) Insert(prefix netip.Prefix, list string) {
+	prefix = prefix.Masked()
+	addr, bits := prefix.Addr(), prefix.Bits()
+	if addr.Is4In6() && bits >= 96 {
+		addr, bits = addr.Unmap(), bits-96
+		prefix = netip.PrefixFrom(addr, bits)
+	}
+
+	node := m.root(addr)
+	raw := addr.AsSlice()
+	for i := 0; i < bits; i++ {
+		bit := ipBit(raw, i)
+		if node.children[bit] == nil {
+			node.children[bit] = &ipTrieNode{}
+		}
+		node = node.children[bit]
+	}
+	if node.match == nil {
+		node.match = &IPMatch{Prefix: prefix, List: list}
+		m.size++
+	}
+}
+
+// Lookup returns the most specific prefix containing addr
+func (m *IPMatcher) Lookup(addr netip.Addr) (IPMatch, bool) {
+	addr = addr.Unmap()
+	if !addr.IsValid() {
+		return IPMatch{}, false
+	}
+
+	node := m.root(addr)
+	raw := addr.AsSlice()
+	var best *IPMatch
+	for i := 0; node != nil; i++ {
+		if node.match != nil {
+			best = node.match
+		}
+		if i == len(raw)*8 {
+			break
+		}
+		node = node.children[ipBit(raw, i)]
+	}
+	if best == nil {
+		return IPMatch{}, false
+	}
+	return *best, true
+}
+
+// Len returns the number of distinct prefixes
+func (m *IPMatcher) Len() int {
+	return m.size
+}
+
+func (m *IPMatcher) root(addr netip.Addr) *ipTrieNode {
+	if addr.Is4() {
+		return m.v4
+	}
+	return m.v6
+}
+
+// ipBit returns bit i of raw, counting from the most significant bit
+func ipBit(raw []byte, i int) int {
+	return int(raw[i/8]>>(7-uint(i%8))) & 1
+}
@@ -0,0 +1,385 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/apimgr/weather/src/config"
+)
+
+// LDAP security modes
+const (
+	LDAPSecurityNone     = "none"
+	LDAPSecurityStartTLS = "starttls"
+	LDAPSecurityLDAPS    = "ldaps"
+)
+
+const ldapTimeout = 10 * time.Second
+
+var (
+	// ErrLDAPInvalidCredentials is returned for unknown users and wrong
+	// passwords alike
+	ErrLDAPInvalidCredentials = errors.New("invalid credentials")
+	// ErrLDAPUserNotFound means the user no longer matches the user filter
+	ErrLDAPUserNotFound = errors.New("user not found in directory")
+)
+
+// LDAPEntry is a directory user and the groups they belong to
+type LDAPEntry struct {
+	DN          string   `json:"dn"`
+	Username    string   `json:"username"`
+	Email       string   `json:"email"`
+	DisplayName string   `json:"display_name"`
+	Groups      []string `json:"groups"`
+}
+
+// LDAPAccess is what a directory user may do on this server
+type LDAPAccess struct {
+	// Member of an allowed group (or no allowed groups configured)
+	Allowed bool
+	// Member of an admin group
+	Admin bool
+	// Role from the group mapping (user or admin)
+	Role string
+}
+
+// LDAPService authenticates users against an LDAP or Active Directory
+// server with bind+search
+type LDAPService struct {
+	cfg config.LDAPConfig
+}
+
+// NewLDAPService creates an LDAP service for the given settings
+func NewLDAPService(cfg config.LDAPConfig) *LDAPService {
+	return &LDAPService{cfg: cfg}
+}
+
+// Enabled reports whether LDAP login is configured
+func (s *LDAPService) Enabled() bool {
+	return s.cfg.Enabled && s.cfg.Server != "" && s.cfg.BaseDN != ""
+}
+
+// Server identifies the directory in stored mappings
+func (s *LDAPService) Server() string {
+	return s.cfg.Server
+}
+
+// MapsRoles reports whether user roles follow directory groups
+func (s *LDAPService) MapsRoles() bool {
+	return len(s.cfg.RoleMapping) > 0
+}
+
+func (s *LDAPService) tlsConfig() (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         s.cfg.Server,
+		InsecureSkipVerify: s.cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if s.cfg.CAFile != "" {
+		caPEM, err := os.ReadFile(s.cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LDAP CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", s.cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	return tlsCfg, nil
+}
+
+// dial opens a connection, upgrading to TLS as configured
+func (s *LDAPService) dial() (*ldap.Conn, error) {
+	if !s.Enabled() {
+		return nil, fmt.Errorf("LDAP authentication is not configured")
+	}
+
+	security := strings.ToLower(s.cfg.Security)
+	port := s.cfg.Port
+	if port == 0 {
+		port = 389
+		if security == LDAPSecurityLDAPS {
+			port = 636
+		}
+	}
+	address := net.JoinHostPort(s.cfg.Server, strconv.Itoa(port))
+	dialer := ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout})
+
+	var conn *ldap.Conn
+	switch security {
+	case LDAPSecurityLDAPS:
+		tlsCfg, err := s.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		conn, err = ldap.DialURL("ldaps://"+address, dialer, ldap.DialWithTLSConfig(tlsCfg))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+		}
+	case LDAPSecurityStartTLS:
+		tlsCfg, err := s.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		conn, err = ldap.DialURL("ldap://"+address, dialer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+		}
+		if err := conn.StartTLS(tlsCfg); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS failed: %w", err)
+		}
+	case "", LDAPSecurityNone:
+		var err error
+		conn, err = ldap.DialURL("ldap://"+address, dialer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown LDAP security mode %q", s.cfg.Security)
+	}
+
+	conn.SetTimeout(ldapTimeout)
+	return conn, nil
+}
+
+// bindService binds as the search account, or stays anonymous
+func (s *LDAPService) bindService(conn *ldap.Conn) error {
+	if s.cfg.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(s.cfg.BindDN, s.cfg.BindPassword); err != nil {
+		return fmt.Errorf("LDAP service bind failed: %w", err)
+	}
+	return nil
+}
+
+// Authenticate finds the user with the search account, then binds as the
+// user to check the password
+func (s *LDAPService) Authenticate(username, password string) (*LDAPEntry, error) {
+	username = strings.TrimSpace(username)
+	// An empty password would be an unauthenticated bind, which many
+	// servers accept
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := s.bindService(conn); err != nil {
+		return nil, err
+	}
+	entry, err := s.findUser(conn, username)
+	if errors.Is(err, ErrLDAPUserNotFound) {
+		return nil, ErrLDAPInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP user bind failed: %w", err)
+	}
+
+	// Read groups with the service account; users often cannot search
+	if err := s.bindService(conn); err != nil {
+		return nil, err
+	}
+	if err := s.loadGroups(conn, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Lookup re-reads a user without a password, for periodic sync. It returns
+// ErrLDAPUserNotFound when the user was removed or no longer matches the
+// user filter.
+func (s *LDAPService) Lookup(username, dn string) (*LDAPEntry, error) {
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := s.bindService(conn); err != nil {
+		return nil, err
+	}
+	return s.lookup(conn, username, dn)
+}
+
+func (s *LDAPService) lookup(conn *ldap.Conn, username, dn string) (*LDAPEntry, error) {
+	entry, err := s.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(entry.DN, dn) {
+		return nil, ErrLDAPUserNotFound
+	}
+	if err := s.loadGroups(conn, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (s *LDAPService) attribute(name, fallback string) string {
+	if name != "" {
+		return name
+	}
+	return fallback
+}
+
+func (s *LDAPService) findUser(conn *ldap.Conn, username string) (*LDAPEntry, error) {
+	filter := s.cfg.UserFilter
+	if filter == "" {
+		filter = "(uid={username})"
+	}
+	filter = strings.ReplaceAll(filter, "{username}", ldap.EscapeFilter(username))
+
+	usernameAttr := s.attribute(s.cfg.UsernameAttribute, "uid")
+	emailAttr := s.attribute(s.cfg.EmailAttribute, "mail")
+	nameAttr := s.attribute(s.cfg.DisplayNameAttribute, "cn")
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		s.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(ldapTimeout.Seconds()), false, filter,
+		[]string{usernameAttr, emailAttr, nameAttr, "memberOf"}, nil,
+	))
+	if err != nil {
+		// More than one match hits the size limit
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) || ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrLDAPUserNotFound
+		}
+		return nil, fmt.Errorf("LDAP user search failed: %w", err)
+	}
+	// Zero or ambiguous matches are treated alike
+	if len(result.Entries) != 1 {
+		return nil, ErrLDAPUserNotFound
+	}
+
+	e := result.Entries[0]
+	entry := &LDAPEntry{
+		DN:          e.DN,
+		Username:    e.GetAttributeValue(usernameAttr),
+		Email:       e.GetAttributeValue(emailAttr),
+		DisplayName: e.GetAttributeValue(nameAttr),
+		Groups:      e.GetAttributeValues("memberOf"),
+	}
+	if entry.Username == "" {
+		entry.Username = username
+	}
+	return entry, nil
+}
+
+// loadGroups adds groups found by the group filter to memberOf groups
+func (s *LDAPService) loadGroups(conn *ldap.Conn, entry *LDAPEntry) error {
+	filter := s.cfg.GroupFilter
+	if filter == "" {
+		filter = "(|(member={dn})(uniqueMember={dn}))"
+	}
+	filter = strings.ReplaceAll(filter, "{dn}", ldap.EscapeFilter(entry.DN))
+	base := s.cfg.GroupBaseDN
+	if base == "" {
+		base = s.cfg.BaseDN
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		base, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, int(ldapTimeout.Seconds()), false, filter, []string{"cn"}, nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil
+		}
+		return fmt.Errorf("LDAP group search failed: %w", err)
+	}
+
+	seen := make(map[string]bool, len(entry.Groups))
+	for _, g := range entry.Groups {
+		seen[strings.ToLower(g)] = true
+	}
+	for _, e := range result.Entries {
+		if !seen[strings.ToLower(e.DN)] {
+			seen[strings.ToLower(e.DN)] = true
+			entry.Groups = append(entry.Groups, e.DN)
+		}
+	}
+	return nil
+}
+
+// Access maps the user's groups to sign-in, admin access and a role
+func (s *LDAPService) Access(entry *LDAPEntry) LDAPAccess {
+	access := LDAPAccess{
+		Allowed: len(s.cfg.AllowedGroups) == 0,
+		Role:    s.cfg.DefaultRole,
+	}
+	if access.Role == "" {
+		access.Role = "user"
+	}
+
+	// As with OIDC, a mapping to admin wins over any other mapping
+	mapped := ""
+	for _, group := range entry.Groups {
+		if ldapGroupIn(group, s.cfg.AllowedGroups) {
+			access.Allowed = true
+		}
+		if ldapGroupIn(group, s.cfg.AdminGroups) {
+			access.Admin = true
+		}
+		for name, role := range s.cfg.RoleMapping {
+			if ldapGroupMatches(group, name) && (mapped == "" || role == "admin") {
+				mapped = role
+			}
+		}
+	}
+	if mapped != "" {
+		access.Role = mapped
+	}
+	// Admin groups always grant sign-in
+	if access.Admin {
+		access.Allowed = true
+	}
+	return access
+}
+
+func ldapGroupIn(group string, names []string) bool {
+	for _, name := range names {
+		if ldapGroupMatches(group, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ldapGroupMatches compares a group DN with a configured DN or CN
+func ldapGroupMatches(groupDN, name string) bool {
+	if strings.EqualFold(groupDN, name) {
+		return true
+	}
+	dn, err := ldap.ParseDN(groupDN)
+	if err != nil || len(dn.RDNs) == 0 {
+		return false
+	}
+	for _, attr := range dn.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") && strings.EqualFold(attr.Value, name) {
+			return true
+		}
+	}
+	return false
+}
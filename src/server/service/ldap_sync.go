@@ -0,0 +1,140 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/apimgr/weather/src/server/model"
+)
+
+// LDAPSyncResult summarises one directory sync
+type LDAPSyncResult struct {
+	Checked      int `json:"checked"`
+	Disabled     int `json:"disabled"`
+	RolesChanged int `json:"roles_changed"`
+}
+
+// SyncLDAPAccounts re-reads every account linked to the directory. Users and
+// admins that were removed, no longer match the user filter or left the
+// allowed (or admin) groups are disabled and signed out; user roles follow
+// the group mapping. Accounts are never re-enabled automatically.
+//
+// The sync stops at the first directory error so an outage cannot disable
+// everyone.
+func SyncLDAPAccounts(s *LDAPService, usersDB, serverDB *sql.DB) (*LDAPSyncResult, error) {
+	result := &LDAPSyncResult{}
+	if !s.Enabled() {
+		return result, nil
+	}
+
+	conn, err := s.dial()
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+	if err := s.bindService(conn); err != nil {
+		return result, err
+	}
+
+	users := &models.LDAPMappingModel{DB: usersDB}
+	userMappings, err := users.ListByServer(s.Server())
+	if err != nil {
+		return result, err
+	}
+	for _, mapping := range userMappings {
+		result.Checked++
+		entry, err := s.lookup(conn, mapping.UID, mapping.DN)
+		if err != nil && !errors.Is(err, ErrLDAPUserNotFound) {
+			return result, err
+		}
+		if entry == nil || !s.Access(entry).Allowed {
+			disabled, err := disableLDAPUser(usersDB, mapping.AccountID)
+			if err != nil {
+				return result, err
+			}
+			if disabled {
+				log.Printf("LDAP sync: disabled user %d (%s)", mapping.AccountID, mapping.DN)
+				result.Disabled++
+			}
+			continue
+		}
+
+		users.Touch(s.Server(), mapping.DN, entry.Username, entry.Groups)
+		if role := s.Access(entry).Role; s.MapsRoles() {
+			res, err := usersDB.Exec(`
+				UPDATE user_accounts SET role = ?, updated_at = CURRENT_TIMESTAMP
+				WHERE id = ? AND role != ?
+			`, role, mapping.AccountID, role)
+			if err != nil {
+				return result, fmt.Errorf("failed to update role: %w", err)
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				result.RolesChanged++
+			}
+		}
+	}
+
+	if serverDB == nil {
+		return result, nil
+	}
+	admins := &models.AdminLDAPMappingModel{DB: serverDB}
+	adminMappings, err := admins.ListByServer(s.Server())
+	if err != nil {
+		return result, err
+	}
+	for _, mapping := range adminMappings {
+		result.Checked++
+		entry, err := s.lookup(conn, mapping.UID, mapping.DN)
+		if err != nil && !errors.Is(err, ErrLDAPUserNotFound) {
+			return result, err
+		}
+		if entry == nil || !s.Access(entry).Admin {
+			disabled, err := disableLDAPAdmin(serverDB, mapping.AccountID)
+			if err != nil {
+				return result, err
+			}
+			if disabled {
+				log.Printf("LDAP sync: disabled admin %d (%s)", mapping.AccountID, mapping.DN)
+				result.Disabled++
+			}
+			continue
+		}
+		admins.Touch(s.Server(), mapping.DN, entry.Username, entry.Groups)
+	}
+
+	return result, nil
+}
+
+// disableLDAPUser deactivates a user and ends their sessions
+func disableLDAPUser(db *sql.DB, userID int64) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE user_accounts SET is_active = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND is_active = 1
+	`, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to disable user: %w", err)
+	}
+	if _, err := db.Exec(`DELETE FROM user_sessions WHERE user_id = ?`, userID); err != nil {
+		return false, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// disableLDAPAdmin deactivates an admin and ends their sessions
+func disableLDAPAdmin(db *sql.DB, adminID int64) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE server_admin_credentials SET is_active = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND is_active = 1
+	`, adminID)
+	if err != nil {
+		return false, fmt.Errorf("failed to disable admin: %w", err)
+	}
+	if _, err := db.Exec(`DELETE FROM server_admin_sessions WHERE admin_id = ?`, adminID); err != nil {
+		return false, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
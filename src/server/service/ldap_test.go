@@ -0,0 +1,518 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	_ "modernc.org/sqlite"
+
+	"github.com/apimgr/weather/src/config"
+	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/model"
+)
+
+const (
+	testLDAPBaseDN   = "dc=example,dc=org"
+	testLDAPBindDN   = "cn=svc,dc=example,dc=org"
+	testLDAPBindPass = "svc-secret"
+)
+
+// testLDAPEntry is a directory object; password is only set for users
+type testLDAPEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// testLDAPServer is a minimal in-process LDAP server: simple bind, search
+// with and/or/not/equality/present filters, StartTLS and unbind
+type testLDAPServer struct {
+	listener net.Listener
+	tlsCfg   *tls.Config
+	caFile   string
+
+	mu      sync.Mutex
+	entries []testLDAPEntry
+	// Binds seen on TLS-protected connections
+	tlsBinds int
+}
+
+func newTestLDAPServer(t *testing.T, ldaps bool) *testLDAPServer {
+	t.Helper()
+	s := &testLDAPServer{}
+	s.tlsCfg, s.caFile = testLDAPCertificate(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ldaps {
+		listener = tls.NewListener(listener, s.tlsCfg)
+	}
+	s.listener = listener
+	t.Cleanup(func() { listener.Close() })
+
+	s.entries = []testLDAPEntry{
+		{dn: testLDAPBindDN, password: testLDAPBindPass, attrs: map[string][]string{"cn": {"svc"}}},
+		{dn: "uid=jane,ou=people,dc=example,dc=org", password: "jane-pass", attrs: map[string][]string{
+			"objectClass": {"inetOrgPerson"}, "uid": {"jane"}, "mail": {"jane@example.org"}, "cn": {"Jane Doe"},
+			"memberOf": {"cn=weather-users,ou=groups,dc=example,dc=org"},
+		}},
+		{dn: "uid=olga,ou=people,dc=example,dc=org", password: "olga-pass", attrs: map[string][]string{
+			"objectClass": {"inetOrgPerson"}, "uid": {"olga"}, "mail": {"olga@example.org"}, "cn": {"Olga Ops"},
+		}},
+		{dn: "uid=bob,ou=people,dc=example,dc=org", password: "bob-pass", attrs: map[string][]string{
+			"objectClass": {"inetOrgPerson"}, "uid": {"bob"}, "mail": {"bob@example.org"}, "cn": {"Bob"},
+		}},
+		// Membership only via the group entry, found by the group filter
+		{dn: "cn=weather-admins,ou=groups,dc=example,dc=org", attrs: map[string][]string{
+			"objectClass": {"groupOfNames"}, "cn": {"weather-admins"},
+			"member": {"uid=olga,ou=people,dc=example,dc=org"},
+		}},
+		{dn: "cn=weather-users,ou=groups,dc=example,dc=org", attrs: map[string][]string{
+			"objectClass": {"groupOfNames"}, "cn": {"weather-users"},
+			"member": {"uid=jane,ou=people,dc=example,dc=org", "uid=olga,ou=people,dc=example,dc=org"},
+		}},
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// testLDAPCertificate creates a self-signed certificate for 127.0.0.1 and
+// writes it to a CA file for the client
+func testLDAPCertificate(t *testing.T) (*tls.Config, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldap.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, caFile
+}
+
+func (s *testLDAPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *testLDAPServer) remove(dn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, e := range s.entries {
+		if strings.EqualFold(e.dn, dn) {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	_, isTLS := conn.(*tls.Conn)
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		msgID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case 0: // bind
+			name, _ := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := int64(49)
+			s.mu.Lock()
+			if isTLS {
+				s.tlsBinds++
+			}
+			for _, e := range s.entries {
+				if strings.EqualFold(e.dn, name) && e.password != "" && e.password == password {
+					code = 0
+				}
+			}
+			s.mu.Unlock()
+			conn.Write(testLDAPResult(msgID, 1, code).Bytes())
+		case 2: // unbind
+			return
+		case 3: // search
+			for _, entry := range s.search(msgID, op) {
+				conn.Write(entry.Bytes())
+			}
+			conn.Write(testLDAPResult(msgID, 5, 0).Bytes())
+		case 23: // extended: StartTLS
+			conn.Write(testLDAPResult(msgID, 24, 0).Bytes())
+			tlsConn := tls.Server(conn, s.tlsCfg)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, isTLS = tlsConn, true
+		default:
+			conn.Write(testLDAPResult(msgID, 1, 53).Bytes())
+		}
+	}
+}
+
+func (s *testLDAPServer) search(msgID int64, op *ber.Packet) []*ber.Packet {
+	base, _ := op.Children[0].Value.(string)
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var results []*ber.Packet
+	for _, e := range s.entries {
+		inScope := strings.EqualFold(e.dn, base)
+		if scope != 0 {
+			inScope = inScope || strings.HasSuffix(strings.ToLower(e.dn), ","+strings.ToLower(base))
+		}
+		if !inScope || !testLDAPMatch(e, filter) {
+			continue
+		}
+
+		packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, ""))
+		result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, 4, nil, "")
+		result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+		attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+		for name, values := range e.attrs {
+			attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+			attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+			set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+			for _, v := range values {
+				set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+			}
+			attr.AppendChild(set)
+			attrs.AppendChild(attr)
+		}
+		result.AppendChild(attrs)
+		packet.AppendChild(result)
+		results = append(results, packet)
+	}
+	return results
+}
+
+func testLDAPMatch(e testLDAPEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case 0: // and
+		for _, child := range filter.Children {
+			if !testLDAPMatch(e, child) {
+				return false
+			}
+		}
+		return true
+	case 1: // or
+		for _, child := range filter.Children {
+			if testLDAPMatch(e, child) {
+				return true
+			}
+		}
+		return false
+	case 2: // not
+		return !testLDAPMatch(e, filter.Children[0])
+	case 3: // equality
+		name, _ := filter.Children[0].Value.(string)
+		value, _ := filter.Children[1].Value.(string)
+		for attr, values := range e.attrs {
+			if strings.EqualFold(attr, name) {
+				for _, v := range values {
+					if strings.EqualFold(v, value) {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	case 7: // present
+		name := filter.Data.String()
+		for attr := range e.attrs {
+			if strings.EqualFold(attr, name) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func testLDAPResult(msgID int64, app ber.Tag, code int64) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, msgID, ""))
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, app, nil, "")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	packet.AppendChild(result)
+	return packet
+}
+
+func (s *testLDAPServer) config(security string) config.LDAPConfig {
+	return config.LDAPConfig{
+		Enabled:       true,
+		Server:        "127.0.0.1",
+		Port:          s.port(),
+		Security:      security,
+		CAFile:        s.caFile,
+		BindDN:        testLDAPBindDN,
+		BindPassword:  testLDAPBindPass,
+		BaseDN:        testLDAPBaseDN,
+		UserFilter:    "(&(objectClass=inetOrgPerson)(uid={username}))",
+		AllowedGroups: []string{"weather-users", "cn=weather-admins,ou=groups,dc=example,dc=org"},
+		AdminGroups:   []string{"weather-admins"},
+	}
+}
+
+func TestLDAP_Authenticate(t *testing.T) {
+	s := newTestLDAPServer(t, false)
+	ldapService := NewLDAPService(s.config(LDAPSecurityNone))
+
+	entry, err := ldapService.Authenticate("jane", "jane-pass")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if entry.DN != "uid=jane,ou=people,dc=example,dc=org" || entry.Username != "jane" ||
+		entry.Email != "jane@example.org" || entry.DisplayName != "Jane Doe" {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	tests := []struct {
+		username, password string
+	}{
+		{"jane", "wrong"},
+		{"nobody", "jane-pass"},
+		// Empty passwords would be an unauthenticated bind
+		{"jane", ""},
+		// Filter metacharacters are escaped, not matched
+		{"*", "jane-pass"},
+		{"jane)(uid=*", "jane-pass"},
+	}
+	for _, tt := range tests {
+		if _, err := ldapService.Authenticate(tt.username, tt.password); !errors.Is(err, ErrLDAPInvalidCredentials) {
+			t.Errorf("Authenticate(%q, %q) = %v, want invalid credentials", tt.username, tt.password, err)
+		}
+	}
+}
+
+func TestLDAP_GroupAccess(t *testing.T) {
+	s := newTestLDAPServer(t, false)
+	cfg := s.config(LDAPSecurityNone)
+	cfg.RoleMapping = map[string]string{"weather-admins": "admin"}
+	ldapService := NewLDAPService(cfg)
+
+	tests := []struct {
+		username, password string
+		want               LDAPAccess
+	}{
+		{"jane", "jane-pass", LDAPAccess{Allowed: true, Role: "user"}},
+		// Admin membership comes from the group search, not memberOf
+		{"olga", "olga-pass", LDAPAccess{Allowed: true, Admin: true, Role: "admin"}},
+		{"bob", "bob-pass", LDAPAccess{Allowed: false, Role: "user"}},
+	}
+	for _, tt := range tests {
+		entry, err := ldapService.Authenticate(tt.username, tt.password)
+		if err != nil {
+			t.Fatalf("Authenticate(%s) failed: %v", tt.username, err)
+		}
+		if got := ldapService.Access(entry); got != tt.want {
+			t.Errorf("Access(%s) = %+v, want %+v (groups %v)", tt.username, got, tt.want, entry.Groups)
+		}
+	}
+}
+
+func TestLDAP_TLS(t *testing.T) {
+	for _, security := range []string{LDAPSecurityStartTLS, LDAPSecurityLDAPS} {
+		t.Run(security, func(t *testing.T) {
+			s := newTestLDAPServer(t, security == LDAPSecurityLDAPS)
+			cfg := s.config(security)
+
+			if _, err := NewLDAPService(cfg).Authenticate("jane", "jane-pass"); err != nil {
+				t.Fatalf("Authenticate failed: %v", err)
+			}
+			s.mu.Lock()
+			tlsBinds := s.tlsBinds
+			s.mu.Unlock()
+			if tlsBinds == 0 {
+				t.Error("Expected binds to happen over TLS")
+			}
+
+			// Without the CA the server certificate is not trusted
+			cfg.CAFile = ""
+			if _, err := NewLDAPService(cfg).Authenticate("jane", "jane-pass"); err == nil || errors.Is(err, ErrLDAPInvalidCredentials) {
+				t.Errorf("Expected an untrusted certificate to fail the connection, got %v", err)
+			}
+		})
+	}
+}
+
+func setupLDAPSyncDB(t *testing.T) (*sql.DB, *sql.DB) {
+	t.Helper()
+	usersDB, err := sql.Open("sqlite", "file:"+t.Name()+"_users?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverDB, err := sql.Open("sqlite", "file:"+t.Name()+"_server?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		usersDB.Close()
+		serverDB.Close()
+	})
+	if _, err := usersDB.Exec(database.UsersSchema); err != nil {
+		t.Fatalf("Failed to create users schema: %v", err)
+	}
+	if _, err := serverDB.Exec(database.ServerSchema); err != nil {
+		t.Fatalf("Failed to create server schema: %v", err)
+	}
+	return usersDB, serverDB
+}
+
+func TestSyncLDAPAccounts(t *testing.T) {
+	s := newTestLDAPServer(t, false)
+	cfg := s.config(LDAPSecurityNone)
+	cfg.RoleMapping = map[string]string{"weather-admins": "admin"}
+	ldapService := NewLDAPService(cfg)
+	usersDB, serverDB := setupLDAPSyncDB(t)
+
+	users := &models.LDAPMappingModel{DB: usersDB}
+	for i, uid := range []string{"jane", "olga", "bob"} {
+		id := int64(i + 1)
+		if _, err := usersDB.Exec(`INSERT INTO user_accounts (id, username, email, password_hash, role) VALUES (?, ?, ?, 'x', 'user')`,
+			id, uid, uid+"@example.org"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := usersDB.Exec(`INSERT INTO user_sessions (id, user_id, expires_at) VALUES (?, ?, ?)`,
+			"session-"+uid, id, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.Link(id, "127.0.0.1", "uid="+uid+",ou=people,dc=example,dc=org", uid, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := serverDB.Exec(`INSERT INTO server_admin_credentials (id, username, email, password_hash) VALUES (1, 'olga', 'olga@example.org', 'x')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&models.AdminLDAPMappingModel{DB: serverDB}).Link(1, "127.0.0.1", "uid=olga,ou=people,dc=example,dc=org", "olga", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Jane leaves the directory; bob was never in an allowed group
+	s.remove("uid=jane,ou=people,dc=example,dc=org")
+
+	result, err := SyncLDAPAccounts(ldapService, usersDB, serverDB)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if result.Checked != 4 || result.Disabled != 2 || result.RolesChanged != 1 {
+		t.Errorf("Unexpected sync result %+v", result)
+	}
+
+	for _, tt := range []struct {
+		uid    string
+		active bool
+		role   string
+	}{
+		{"jane", false, "user"},
+		{"olga", true, "admin"},
+		{"bob", false, "user"},
+	} {
+		var active bool
+		var role string
+		var sessions int
+		usersDB.QueryRow(`SELECT is_active, role FROM user_accounts WHERE username = ?`, tt.uid).Scan(&active, &role)
+		usersDB.QueryRow(`SELECT COUNT(*) FROM user_sessions WHERE id = ?`, "session-"+tt.uid).Scan(&sessions)
+		if active != tt.active || role != tt.role {
+			t.Errorf("%s: active=%v role=%s, want active=%v role=%s", tt.uid, active, role, tt.active, tt.role)
+		}
+		if !tt.active && sessions != 0 {
+			t.Errorf("%s: expected sessions to be deleted", tt.uid)
+		}
+	}
+
+	// Olga leaves the admin group: admin access goes, the user account stays
+	s.mu.Lock()
+	for i, e := range s.entries {
+		if strings.HasPrefix(e.dn, "cn=weather-admins") {
+			s.entries[i].attrs["member"] = nil
+		}
+	}
+	s.mu.Unlock()
+	if _, err := SyncLDAPAccounts(ldapService, usersDB, serverDB); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	var adminActive bool
+	serverDB.QueryRow(`SELECT is_active FROM server_admin_credentials WHERE id = 1`).Scan(&adminActive)
+	if adminActive {
+		t.Error("Expected admin removed from the admin group to be disabled")
+	}
+
+	// A directory outage must not disable anyone
+	s.listener.Close()
+	if _, err := usersDB.Exec(`UPDATE user_accounts SET is_active = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SyncLDAPAccounts(ldapService, usersDB, serverDB); err == nil {
+		t.Error("Expected sync to fail while the directory is unreachable")
+	}
+	var disabled int
+	usersDB.QueryRow(`SELECT COUNT(*) FROM user_accounts WHERE is_active = 0`).Scan(&disabled)
+	if disabled != 0 {
+		t.Errorf("Expected no accounts disabled during an outage, got %d", disabled)
+	}
+}
+
+func TestLDAPGroupMatches(t *testing.T) {
+	group := "CN=Weather Admins,OU=Groups,DC=corp,DC=example"
+	for _, name := range []string{"weather admins", "cn=weather admins,ou=groups,dc=corp,dc=example"} {
+		if !ldapGroupMatches(group, name) {
+			t.Errorf("Expected %q to match %q", name, group)
+		}
+	}
+	if ldapGroupMatches(group, "Groups") {
+		t.Error("Only the group's own CN should match")
+	}
+}
@@ -431,3 +431,127 @@ func ExtractLogEntry(c *gin.Context, startTime time.Time, bytesWritten int) *Log
 
 	return entry
 }
+
+// FormatAudit formats an audit record. CEF and syslog use the same layout
+// as the access log formats; every other format produces the JSON record.
+func (f *LogFormatter) FormatAudit(event *AuditEvent) string {
+	switch f.format {
+	case LogFormatCEF:
+		return f.formatAuditCEF(event)
+	case LogFormatSyslog:
+		return f.formatAuditSyslog(event)
+	default:
+		jsonBytes, _ := json.Marshal(event)
+		return string(jsonBytes)
+	}
+}
+
+// formatAuditCEF formats an audit record as Common Event Format
+func (f *LogFormatter) formatAuditCEF(event *AuditEvent) string {
+	extensions := []string{
+		fmt.Sprintf("rt=%d", event.Time.UnixMilli()),
+		fmt.Sprintf("externalId=%s", escapeCEF(event.ID)),
+		fmt.Sprintf("cat=%s", escapeCEF(event.Category)),
+		fmt.Sprintf("outcome=%s", escapeCEF(event.Result)),
+		"cs1Label=ActorType",
+		fmt.Sprintf("cs1=%s", escapeCEF(event.Actor.Type)),
+		"cn1Label=Seq",
+		fmt.Sprintf("cn1=%d", event.Seq),
+	}
+
+	if event.Actor.ID != "" {
+		extensions = append(extensions, fmt.Sprintf("suser=%s", escapeCEF(event.Actor.ID)))
+	}
+
+	if event.Actor.IP != "" {
+		extensions = append(extensions, fmt.Sprintf("src=%s", escapeCEF(event.Actor.IP)))
+	}
+
+	if event.Actor.UserAgent != "" {
+		extensions = append(extensions, fmt.Sprintf("requestClientApplication=%s", escapeCEF(event.Actor.UserAgent)))
+	}
+
+	if event.Hash != "" {
+		extensions = append(extensions, "cs2Label=Hash", fmt.Sprintf("cs2=%s", event.Hash))
+	}
+
+	if event.RequestID != "" {
+		extensions = append(extensions, "cs3Label=RequestID", fmt.Sprintf("cs3=%s", escapeCEF(event.RequestID)))
+	}
+
+	if len(event.Details) > 0 {
+		details, _ := json.Marshal(event.Details)
+		extensions = append(extensions, fmt.Sprintf("msg=%s", escapeCEF(string(details))))
+	} else if event.Reason != "" {
+		extensions = append(extensions, fmt.Sprintf("msg=%s", escapeCEF(event.Reason)))
+	}
+
+	// The header escapes only | and \
+	header := strings.NewReplacer("\\", "\\\\", "|", "\\|")
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		f.deviceVendor,
+		f.deviceProduct,
+		f.deviceVersion,
+		header.Replace(event.Event),
+		header.Replace(event.Event),
+		auditSeverityLevel(event.Severity),
+		strings.Join(extensions, " "),
+	)
+}
+
+// formatAuditSyslog formats an audit record as RFC 5424 Syslog
+func (f *LogFormatter) formatAuditSyslog(event *AuditEvent) string {
+	// log audit
+	facility := 13
+	severity := 6
+	switch event.Severity {
+	case "critical":
+		severity = 2
+	case "error":
+		severity = 3
+	case "warn":
+		severity = 4
+	}
+	priority := facility*8 + severity
+
+	msgID := event.Event
+	if msgID == "" {
+		msgID = "-"
+	}
+
+	structuredData := fmt.Sprintf("[audit@48577 id=\"%s\" seq=\"%s\" category=\"%s\" result=\"%s\" actor=\"%s\" ip=\"%s\" hash=\"%s\"]",
+		escapeSDParam(event.ID),
+		formatAuditSeq(event.Seq),
+		escapeSDParam(event.Category),
+		escapeSDParam(event.Result),
+		escapeSDParam(event.Actor.Type+":"+event.Actor.ID),
+		escapeSDParam(event.Actor.IP),
+		event.Hash,
+	)
+
+	msg := event.Reason
+	if len(event.Details) > 0 {
+		details, _ := json.Marshal(event.Details)
+		msg = string(details)
+	}
+	if msg == "" {
+		msg = event.Event
+	}
+
+	return fmt.Sprintf("<%d>1 %s - weather - %s %s %s",
+		priority,
+		event.Time.UTC().Format(time.RFC3339Nano),
+		msgID,
+		structuredData,
+		msg,
+	)
+}
+
+// escapeSDParam escapes an RFC 5424 structured data parameter value
+func escapeSDParam(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	s = strings.ReplaceAll(s, "]", "\\]")
+	return s
+}
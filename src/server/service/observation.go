@@ -0,0 +1,734 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	// Day boundaries of sites follow their time zone, also on hosts
+	// without a zoneinfo database
+	_ "time/tzdata"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+const (
+	// Observations are recorded for a site this many hours back on every
+	// run, so missed runs fill in
+	observationBackfillHours = 24
+	// Daily forecasts recorded per run and per served forecast, today
+	// included
+	observationForecastDays = 7
+	// Sites per upstream request
+	observationBatchSize = 50
+	// An unsaved site is recorded while it was popular within this period
+	popularSiteDays = 7
+	// Lookups since the last run a location needs to count as popular
+	popularMinLookups = 2
+)
+
+// ObservationPolicy is how many popular sites are recorded and how long
+// observations are kept. Zero values use the defaults.
+type ObservationPolicy struct {
+	PopularLocations    int
+	HourlyDays          int
+	DailyDays           int
+	ForecastHistoryDays int
+}
+
+// ObservationService records hourly observations of saved and popular
+// locations, downsamples them to daily rows and answers range, aggregate
+// and forecast accuracy queries
+type ObservationService struct {
+	serverDB *sql.DB
+	usersDB  *sql.DB
+	weather  *WeatherService
+
+	mu     sync.RWMutex
+	policy ObservationPolicy
+
+	now func() time.Time
+}
+
+// ObservationSite is a location the archive records, rounded to 0.01°
+type ObservationSite struct {
+	ID             int64      `json:"id"`
+	Latitude       float64    `json:"latitude"`
+	Longitude      float64    `json:"longitude"`
+	Timezone       string     `json:"timezone"`
+	Saved          bool       `json:"saved"`
+	LastObservedAt *time.Time `json:"lastObservedAt,omitempty"`
+}
+
+// ObservationRun summarises one recording run
+type ObservationRun struct {
+	Sites        int   `json:"sites"`
+	Failed       int   `json:"failed"`
+	Observations int64 `json:"observations"`
+	Forecasts    int64 `json:"forecasts"`
+}
+
+// NewObservationService creates the archive over the server database, with
+// saved locations read from the users database
+func NewObservationService(serverDB, usersDB *sql.DB, weather *WeatherService) *ObservationService {
+	return &ObservationService{
+		serverDB: serverDB,
+		usersDB:  usersDB,
+		weather:  weather,
+		policy:   ObservationPolicy{PopularLocations: 25},
+		now:      time.Now,
+	}
+}
+
+// SetPolicy replaces the popular site count and retention periods
+func (s *ObservationService) SetPolicy(policy ObservationPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policy = policy
+}
+
+// Policy returns the policy with defaults filled in
+func (s *ObservationService) Policy() ObservationPolicy {
+	s.mu.RLock()
+	policy := s.policy
+	s.mu.RUnlock()
+
+	if policy.HourlyDays == 0 {
+		policy.HourlyDays = 30
+	}
+	// Hourly rows are downsampled once their local day is over
+	if policy.HourlyDays < 2 {
+		policy.HourlyDays = 2
+	}
+	if policy.DailyDays == 0 {
+		policy.DailyDays = -1
+	}
+	if policy.ForecastHistoryDays == 0 {
+		policy.ForecastHistoryDays = 90
+	}
+	return policy
+}
+
+// observationCoord rounds a coordinate to a site
+func observationCoord(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// siteLocation returns the time zone of a site, UTC when unknown
+func siteLocation(timezone string) *time.Location {
+	if loc, err := time.LoadLocation(timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// localMidnight returns the start of the local day of t
+func localMidnight(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
+
+// Record syncs the sites with the saved and popular locations and records
+// the recent hours and the daily forecast of every active site
+func (s *ObservationService) Record(ctx context.Context) (*ObservationRun, error) {
+	now := s.now()
+	policy := s.Policy()
+
+	if err := s.syncSites(ctx, now, policy); err != nil {
+		return nil, err
+	}
+	sites, err := s.activeSites(ctx, now, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &ObservationRun{Sites: len(sites)}
+	var lastErr error
+	for start := 0; start < len(sites); start += observationBatchSize {
+		end := start + observationBatchSize
+		if end > len(sites) {
+			end = len(sites)
+		}
+		batch := sites[start:end]
+
+		points := make([]WeatherPoint, len(batch))
+		for i, site := range batch {
+			points[i] = WeatherPoint{Latitude: site.Latitude, Longitude: site.Longitude}
+		}
+		responses, err := s.weather.fetchObservations(points, observationBackfillHours, observationForecastDays)
+		if err != nil {
+			log.Printf("Observation batch of %d sites failed: %v", len(batch), err)
+			run.Failed += len(batch)
+			lastErr = err
+			continue
+		}
+
+		for i, site := range batch {
+			observations, forecasts, err := s.store(ctx, site, &responses[i], now)
+			if err != nil {
+				log.Printf("Storing observations of site %d failed: %v", site.ID, err)
+				run.Failed++
+				lastErr = err
+				continue
+			}
+			run.Observations += observations
+			run.Forecasts += forecasts
+		}
+	}
+
+	if run.Sites > 0 && run.Failed == run.Sites {
+		return run, fmt.Errorf("recording observations failed: %w", lastErr)
+	}
+	return run, nil
+}
+
+// syncSites flags the sites of saved locations and adds the locations
+// looked up most since the last run
+func (s *ObservationService) syncSites(ctx context.Context, now time.Time, policy ObservationPolicy) error {
+	saved := make(map[WeatherPoint]bool)
+	for _, table := range []string{"user_saved_locations", "org_saved_locations"} {
+		rows, err := s.usersDB.QueryContext(ctx, "SELECT latitude, longitude FROM "+table)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", table, err)
+		}
+		for rows.Next() {
+			var lat, lon float64
+			if err := rows.Scan(&lat, &lon); err != nil {
+				rows.Close()
+				return err
+			}
+			saved[WeatherPoint{Latitude: observationCoord(lat), Longitude: observationCoord(lon)}] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	var popular []WeatherPoint
+	if policy.PopularLocations > 0 {
+		popular = s.weather.PopularLocations(policy.PopularLocations)
+	}
+
+	return database.WithTransaction(ctx, s.serverDB, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "UPDATE weather_observation_sites SET saved = 0 WHERE saved = 1"); err != nil {
+			return err
+		}
+		for point := range saved {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO weather_observation_sites (latitude, longitude, saved) VALUES (?, ?, 1)
+				ON CONFLICT(latitude, longitude) DO UPDATE SET saved = 1`,
+				point.Latitude, point.Longitude); err != nil {
+				return err
+			}
+		}
+		for _, point := range popular {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO weather_observation_sites (latitude, longitude, last_requested_at) VALUES (?, ?, ?)
+				ON CONFLICT(latitude, longitude) DO UPDATE SET last_requested_at = excluded.last_requested_at`,
+				point.Latitude, point.Longitude, now.Unix()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// activeSites returns the saved sites and the sites popular within
+// popularSiteDays
+func (s *ObservationService) activeSites(ctx context.Context, now time.Time, policy ObservationPolicy) ([]ObservationSite, error) {
+	cutoff := now.AddDate(0, 0, -popularSiteDays).Unix()
+	if policy.PopularLocations <= 0 {
+		cutoff = math.MaxInt64
+	}
+	return s.querySites(ctx, "WHERE saved = 1 OR last_requested_at >= ? ORDER BY id", cutoff)
+}
+
+// querySites returns the sites matching the where clause
+func (s *ObservationService) querySites(ctx context.Context, where string, args ...interface{}) ([]ObservationSite, error) {
+	rows, err := s.serverDB.QueryContext(ctx, `
+		SELECT id, latitude, longitude, timezone, saved, last_observed_at
+		FROM weather_observation_sites `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sites []ObservationSite
+	for rows.Next() {
+		var site ObservationSite
+		var observed sql.NullInt64
+		if err := rows.Scan(&site.ID, &site.Latitude, &site.Longitude, &site.Timezone, &site.Saved, &observed); err != nil {
+			return nil, err
+		}
+		if observed.Valid {
+			t := time.Unix(observed.Int64, 0).UTC()
+			site.LastObservedAt = &t
+		}
+		sites = append(sites, site)
+	}
+	return sites, rows.Err()
+}
+
+// store writes the past hours and the daily forecast of one site
+func (s *ObservationService) store(ctx context.Context, site ObservationSite, data *openMeteoObservationResponse, now time.Time) (int64, int64, error) {
+	timezone := data.Timezone
+	if timezone == "" {
+		timezone = site.Timezone
+	}
+	loc := siteLocation(timezone)
+	today := localMidnight(now, loc)
+
+	var observations, forecasts int64
+	err := database.WithTransaction(ctx, s.serverDB, func(tx *sql.Tx) error {
+		var latest int64
+		h := &data.Hourly
+		for i, ts := range h.Time {
+			if ts > now.Unix() || i >= len(h.Temperature2m) || h.Temperature2m[i] == nil {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO weather_observations (site_id, resolution, time, temperature, feels_like, humidity,
+					pressure, precipitation, wind_speed, wind_gusts, wind_direction, cloud_cover, weather_code)
+				VALUES (?, 'hour', ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT(site_id, resolution, time) DO UPDATE SET
+					temperature = excluded.temperature, feels_like = excluded.feels_like,
+					humidity = excluded.humidity, pressure = excluded.pressure,
+					precipitation = excluded.precipitation, wind_speed = excluded.wind_speed,
+					wind_gusts = excluded.wind_gusts, wind_direction = excluded.wind_direction,
+					cloud_cover = excluded.cloud_cover, weather_code = excluded.weather_code`,
+				site.ID, ts, h.Temperature2m[i], at(h.ApparentTemperature, i), at(h.RelativeHumidity2m, i),
+				at(h.PressureMsl, i), at(h.Precipitation, i), at(h.WindSpeed10m, i), at(h.WindGusts10m, i),
+				intAt(h.WindDirection10m, i), at(h.CloudCover, i), intAt(h.WeatherCode, i)); err != nil {
+				return err
+			}
+			observations++
+			if ts > latest {
+				latest = ts
+			}
+		}
+
+		d := &data.Daily
+		for i, ts := range d.Time {
+			day := localMidnight(time.Unix(ts, 0), loc)
+			lead := int(math.Round(day.Sub(today).Hours() / 24))
+			if lead < 0 {
+				continue
+			}
+			n, err := insertForecastIssue(ctx, tx, site.ID, ProviderOpenMeteo, day, lead, forecastIssue{
+				TempMax:                  at(d.Temperature2mMax, i),
+				TempMin:                  at(d.Temperature2mMin, i),
+				Precipitation:            at(d.PrecipitationSum, i),
+				PrecipitationProbability: intAt(d.PrecipitationProbabilityMax, i),
+				WindGustsMax:             at(d.WindGusts10mMax, i),
+				WeatherCode:              intAt(d.WeatherCode, i),
+			}, now)
+			if err != nil {
+				return err
+			}
+			forecasts += n
+		}
+
+		if latest > 0 {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE weather_observation_sites SET timezone = ?, last_observed_at = ?
+				WHERE id = ? AND (last_observed_at IS NULL OR last_observed_at < ?)`,
+				timezone, latest, site.ID, latest)
+			return err
+		}
+		_, err := tx.ExecContext(ctx, "UPDATE weather_observation_sites SET timezone = ? WHERE id = ?", timezone, site.ID)
+		return err
+	})
+	return observations, forecasts, err
+}
+
+// at returns values[i], nil when missing
+func at(values []*float64, i int) *float64 {
+	if i < len(values) {
+		return values[i]
+	}
+	return nil
+}
+
+// intAt returns values[i] rounded, nil when missing
+func intAt(values []*float64, i int) *int64 {
+	v := at(values, i)
+	if v == nil {
+		return nil
+	}
+	n := int64(math.Round(*v))
+	return &n
+}
+
+// hourRow is an hourly observation read for downsampling
+type hourRow struct {
+	time                                            int64
+	temperature, feelsLike, humidity, pressure      sql.NullFloat64
+	precipitation, windSpeed, windGusts, cloudCover sql.NullFloat64
+	windDirection, weatherCode                      sql.NullInt64
+}
+
+// Downsample writes a daily row for every complete local day with hourly
+// observations that has none yet, and rewrites the latest daily row in
+// case hours were filled in since. It returns the days written.
+func (s *ObservationService) Downsample(ctx context.Context) (int64, error) {
+	sites, err := s.querySites(ctx, "WHERE EXISTS (SELECT 1 FROM weather_observations o WHERE o.site_id = weather_observation_sites.id AND o.resolution = 'hour') ORDER BY id")
+	if err != nil {
+		return 0, err
+	}
+
+	now := s.now()
+	var written int64
+	for _, site := range sites {
+		loc := siteLocation(site.Timezone)
+		today := localMidnight(now, loc)
+
+		var lastDay sql.NullInt64
+		if err := s.serverDB.QueryRowContext(ctx,
+			"SELECT MAX(time) FROM weather_observations WHERE site_id = ? AND resolution = 'day'",
+			site.ID).Scan(&lastDay); err != nil {
+			return written, err
+		}
+
+		hours, err := s.hourRows(ctx, site.ID, lastDay.Int64, today.Unix())
+		if err != nil {
+			return written, err
+		}
+
+		days := make(map[int64][]hourRow)
+		var order []int64
+		for _, h := range hours {
+			day := localMidnight(time.Unix(h.time, 0), loc).Unix()
+			if _, ok := days[day]; !ok {
+				order = append(order, day)
+			}
+			days[day] = append(days[day], h)
+		}
+
+		err = database.WithTransaction(ctx, s.serverDB, func(tx *sql.Tx) error {
+			for _, day := range order {
+				if err := writeDailyRow(ctx, tx, site.ID, day, days[day]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return written, fmt.Errorf("downsample site %d: %w", site.ID, err)
+		}
+		written += int64(len(order))
+	}
+	return written, nil
+}
+
+// hourRows returns the hourly observations of a site in [from, to)
+func (s *ObservationService) hourRows(ctx context.Context, siteID, from, to int64) ([]hourRow, error) {
+	rows, err := s.serverDB.QueryContext(ctx, `
+		SELECT time, temperature, feels_like, humidity, pressure, precipitation,
+			wind_speed, wind_gusts, cloud_cover, wind_direction, weather_code
+		FROM weather_observations
+		WHERE site_id = ? AND resolution = 'hour' AND time >= ? AND time < ?
+		ORDER BY time`, siteID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hours []hourRow
+	for rows.Next() {
+		var h hourRow
+		if err := rows.Scan(&h.time, &h.temperature, &h.feelsLike, &h.humidity, &h.pressure, &h.precipitation,
+			&h.windSpeed, &h.windGusts, &h.cloudCover, &h.windDirection, &h.weatherCode); err != nil {
+			return nil, err
+		}
+		hours = append(hours, h)
+	}
+	return hours, rows.Err()
+}
+
+// writeDailyRow aggregates the hours of one local day: means, the
+// temperature range, the precipitation total, the strongest gust, the
+// vector mean wind direction and the most severe weather code
+func writeDailyRow(ctx context.Context, tx *sql.Tx, siteID, day int64, hours []hourRow) error {
+	var temp, feels, humidity, pressure, wind, cloud mean
+	var tmin, tmax, gusts, precipitation *float64
+	var code *int64
+	var sinSum, cosSum float64
+	var directions int
+
+	for _, h := range hours {
+		temp.add(h.temperature)
+		feels.add(h.feelsLike)
+		humidity.add(h.humidity)
+		pressure.add(h.pressure)
+		wind.add(h.windSpeed)
+		cloud.add(h.cloudCover)
+		if h.temperature.Valid {
+			tmin = minOf(tmin, h.temperature.Float64)
+			tmax = maxOf(tmax, h.temperature.Float64)
+		}
+		if h.windGusts.Valid {
+			gusts = maxOf(gusts, h.windGusts.Float64)
+		}
+		if h.precipitation.Valid {
+			total := h.precipitation.Float64
+			if precipitation != nil {
+				total += *precipitation
+			}
+			precipitation = &total
+		}
+		if h.windDirection.Valid {
+			rad := float64(h.windDirection.Int64) * math.Pi / 180
+			sinSum += math.Sin(rad)
+			cosSum += math.Cos(rad)
+			directions++
+		}
+		if h.weatherCode.Valid && (code == nil || h.weatherCode.Int64 > *code) {
+			c := h.weatherCode.Int64
+			code = &c
+		}
+	}
+
+	var direction *int64
+	if directions > 0 {
+		deg := int64(math.Round(math.Mod(math.Atan2(sinSum, cosSum)*180/math.Pi+360, 360))) % 360
+		direction = &deg
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO weather_observations (site_id, resolution, time, temperature, temperature_min, temperature_max,
+			feels_like, humidity, pressure, precipitation, wind_speed, wind_gusts, wind_direction, cloud_cover,
+			weather_code, samples)
+		VALUES (?, 'day', ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(site_id, resolution, time) DO UPDATE SET
+			temperature = excluded.temperature, temperature_min = excluded.temperature_min,
+			temperature_max = excluded.temperature_max, feels_like = excluded.feels_like,
+			humidity = excluded.humidity, pressure = excluded.pressure,
+			precipitation = excluded.precipitation, wind_speed = excluded.wind_speed,
+			wind_gusts = excluded.wind_gusts, wind_direction = excluded.wind_direction,
+			cloud_cover = excluded.cloud_cover, weather_code = excluded.weather_code,
+			samples = excluded.samples`,
+		siteID, day, temp.value(), tmin, tmax, feels.value(), humidity.value(), pressure.value(),
+		precipitation, wind.value(), gusts, direction, cloud.value(), code, len(hours))
+	return err
+}
+
+// mean averages the valid values added to it
+type mean struct {
+	sum float64
+	n   int
+}
+
+func (m *mean) add(v sql.NullFloat64) {
+	if v.Valid {
+		m.sum += v.Float64
+		m.n++
+	}
+}
+
+// value returns the mean, nil without values
+func (m *mean) value() *float64 {
+	if m.n == 0 {
+		return nil
+	}
+	v := m.sum / float64(m.n)
+	return &v
+}
+
+func minOf(current *float64, v float64) *float64 {
+	if current == nil || v < *current {
+		return &v
+	}
+	return current
+}
+
+func maxOf(current *float64, v float64) *float64 {
+	if current == nil || v > *current {
+		return &v
+	}
+	return current
+}
+
+// Prune deletes hourly and daily observations and recorded forecasts past
+// their retention, and sites no longer recorded that have nothing left
+func (s *ObservationService) Prune(ctx context.Context) (map[string]int64, error) {
+	now := s.now()
+	policy := s.Policy()
+	removed := make(map[string]int64)
+
+	deletes := []struct {
+		name  string
+		days  int
+		query string
+	}{
+		{"hourly", policy.HourlyDays, "DELETE FROM weather_observations WHERE resolution = 'hour' AND time < ?"},
+		{"daily", policy.DailyDays, "DELETE FROM weather_observations WHERE resolution = 'day' AND time < ?"},
+		{"forecasts", policy.ForecastHistoryDays, "DELETE FROM weather_forecast_issues WHERE day < ?"},
+	}
+	for _, d := range deletes {
+		if d.days < 0 {
+			continue
+		}
+		result, err := s.serverDB.ExecContext(ctx, d.query, now.AddDate(0, 0, -d.days).Unix())
+		if err != nil {
+			return removed, fmt.Errorf("prune %s observations: %w", d.name, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			removed[d.name] = n
+		}
+	}
+
+	err := database.WithTransaction(ctx, s.serverDB, func(tx *sql.Tx) error {
+		stale := `saved = 0 AND (last_requested_at IS NULL OR last_requested_at < ?)
+			AND NOT EXISTS (SELECT 1 FROM weather_observations o WHERE o.site_id = weather_observation_sites.id)`
+		cutoff := now.AddDate(0, 0, -popularSiteDays).Unix()
+		if _, err := tx.ExecContext(ctx, `DELETE FROM weather_forecast_issues WHERE site_id IN
+			(SELECT id FROM weather_observation_sites WHERE `+stale+`)`, cutoff); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, "DELETE FROM weather_observation_sites WHERE "+stale, cutoff)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			removed["sites"] = n
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("prune observation sites: %w", err)
+	}
+	return removed, nil
+}
+
+// openMeteoObservationResponse is one location of an observation request
+// made with timeformat=unixtime; values are null where the model has none
+type openMeteoObservationResponse struct {
+	Timezone string `json:"timezone"`
+	Hourly   struct {
+		Time                []int64    `json:"time"`
+		Temperature2m       []*float64 `json:"temperature_2m"`
+		ApparentTemperature []*float64 `json:"apparent_temperature"`
+		RelativeHumidity2m  []*float64 `json:"relative_humidity_2m"`
+		PressureMsl         []*float64 `json:"pressure_msl"`
+		Precipitation       []*float64 `json:"precipitation"`
+		WindSpeed10m        []*float64 `json:"wind_speed_10m"`
+		WindGusts10m        []*float64 `json:"wind_gusts_10m"`
+		WindDirection10m    []*float64 `json:"wind_direction_10m"`
+		CloudCover          []*float64 `json:"cloud_cover"`
+		WeatherCode         []*float64 `json:"weather_code"`
+	} `json:"hourly"`
+	Daily struct {
+		Time                        []int64    `json:"time"`
+		Temperature2mMax            []*float64 `json:"temperature_2m_max"`
+		Temperature2mMin            []*float64 `json:"temperature_2m_min"`
+		PrecipitationSum            []*float64 `json:"precipitation_sum"`
+		PrecipitationProbabilityMax []*float64 `json:"precipitation_probability_max"`
+		WindGusts10mMax             []*float64 `json:"wind_gusts_10m_max"`
+		WeatherCode                 []*float64 `json:"weather_code"`
+	} `json:"daily"`
+}
+
+// fetchObservations requests the past hours and the daily forecast of
+// several locations at once, in metric units. Results are in the order of
+// points.
+func (ws *WeatherService) fetchObservations(points []WeatherPoint, pastHours, forecastDays int) ([]openMeteoObservationResponse, error) {
+	lats := make([]string, len(points))
+	lons := make([]string, len(points))
+	for i, point := range points {
+		lats[i] = strconv.FormatFloat(point.Latitude, 'f', 2, 64)
+		lons[i] = strconv.FormatFloat(point.Longitude, 'f', 2, 64)
+	}
+
+	params := url.Values{}
+	params.Set("latitude", strings.Join(lats, ","))
+	params.Set("longitude", strings.Join(lons, ","))
+	params.Set("hourly", "temperature_2m,apparent_temperature,relative_humidity_2m,pressure_msl,precipitation,wind_speed_10m,wind_gusts_10m,wind_direction_10m,cloud_cover,weather_code")
+	params.Set("daily", "temperature_2m_max,temperature_2m_min,precipitation_sum,precipitation_probability_max,wind_gusts_10m_max,weather_code")
+	params.Set("past_hours", strconv.Itoa(pastHours))
+	params.Set("forecast_hours", "1")
+	params.Set("forecast_days", strconv.Itoa(forecastDays))
+	params.Set("timezone", "auto")
+	params.Set("timeformat", "unixtime")
+
+	resp, err := ws.client.Get(fmt.Sprintf("%s/forecast?%s", ws.openMeteoBaseURL, params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch observations: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("observations request returned %s", resp.Status)
+	}
+
+	// A single location is answered with an object, several with an array
+	var data []openMeteoObservationResponse
+	if len(points) == 1 {
+		data = make([]openMeteoObservationResponse, 1)
+		err = json.Unmarshal(body, &data[0])
+	} else {
+		err = json.Unmarshal(body, &data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse observations: %w", err)
+	}
+	if len(data) != len(points) {
+		return nil, fmt.Errorf("observations returned %d results for %d locations", len(data), len(points))
+	}
+	return data, nil
+}
+
+// countLookup counts a current weather lookup towards PopularLocations
+func (ws *WeatherService) countLookup(latitude, longitude float64) {
+	point := WeatherPoint{Latitude: observationCoord(latitude), Longitude: observationCoord(longitude)}
+	ws.lookupsMu.Lock()
+	defer ws.lookupsMu.Unlock()
+	if ws.lookups == nil {
+		ws.lookups = make(map[WeatherPoint]int)
+	}
+	ws.lookups[point]++
+}
+
+// PopularLocations returns up to limit locations, rounded to 0.01°, with
+// the most current weather lookups since the last call, and starts
+// counting again
+func (ws *WeatherService) PopularLocations(limit int) []WeatherPoint {
+	ws.lookupsMu.Lock()
+	lookups := ws.lookups
+	ws.lookups = nil
+	ws.lookupsMu.Unlock()
+
+	points := make([]WeatherPoint, 0, len(lookups))
+	for point, n := range lookups {
+		if n >= popularMinLookups {
+			points = append(points, point)
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		a, b := lookups[points[i]], lookups[points[j]]
+		if a != b {
+			return a > b
+		}
+		if points[i].Latitude != points[j].Latitude {
+			return points[i].Latitude < points[j].Latitude
+		}
+		return points[i].Longitude < points[j].Longitude
+	})
+	if len(points) > limit {
+		points = points[:limit]
+	}
+	return points
+}
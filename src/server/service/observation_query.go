@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+)
+
+// Observation resolutions
+const (
+	ResolutionHour = "hour"
+	ResolutionDay  = "day"
+)
+
+// Days with at least this much precipitation (mm) count as wet
+const wetDayPrecipitation = 1.0
+
+// ErrNoObservations is returned for locations the archive does not record
+var ErrNoObservations = errors.New("no observations recorded for this location")
+
+// Observation is one hourly or daily observation. Daily observations hold
+// means, with the temperature range, the precipitation total and the
+// strongest gust of the day.
+type Observation struct {
+	Time           time.Time `json:"time"`
+	Temperature    *float64  `json:"temperature"`
+	TemperatureMin *float64  `json:"temperatureMin,omitempty"`
+	TemperatureMax *float64  `json:"temperatureMax,omitempty"`
+	FeelsLike      *float64  `json:"feelsLike"`
+	Humidity       *float64  `json:"humidity"`
+	Pressure       *float64  `json:"pressure"`
+	Precipitation  *float64  `json:"precipitation"`
+	WindSpeed      *float64  `json:"windSpeed"`
+	WindGusts      *float64  `json:"windGusts"`
+	WindDirection  *int      `json:"windDirection"`
+	CloudCover     *float64  `json:"cloudCover"`
+	WeatherCode    *int      `json:"weatherCode"`
+	Samples        int       `json:"samples"`
+}
+
+// ObservationSummary aggregates the daily observations of a period.
+// Degree days are computed from the daily mean of the minimum and maximum
+// temperature against DegreeDayBase.
+type ObservationSummary struct {
+	From               time.Time `json:"from"`
+	To                 time.Time `json:"to"`
+	Days               int       `json:"days"`
+	TemperatureMin     *float64  `json:"temperatureMin"`
+	TemperatureMax     *float64  `json:"temperatureMax"`
+	TemperatureAvg     *float64  `json:"temperatureAvg"`
+	PrecipitationTotal float64   `json:"precipitationTotal"`
+	WetDays            int       `json:"wetDays"`
+	DegreeDayBase      float64   `json:"degreeDayBase"`
+	HeatingDegreeDays  float64   `json:"heatingDegreeDays"`
+	CoolingDegreeDays  float64   `json:"coolingDegreeDays"`
+}
+
+// FindSite returns the site recording the coordinates
+func (s *ObservationService) FindSite(ctx context.Context, latitude, longitude float64) (*ObservationSite, error) {
+	sites, err := s.querySites(ctx, "WHERE latitude = ? AND longitude = ?",
+		observationCoord(latitude), observationCoord(longitude))
+	if err != nil {
+		return nil, err
+	}
+	if len(sites) == 0 {
+		return nil, ErrNoObservations
+	}
+	return &sites[0], nil
+}
+
+// Series returns the observations of a site in [from, to), oldest first,
+// converted to units
+func (s *ObservationService) Series(ctx context.Context, siteID int64, resolution string, from, to time.Time, units string) ([]Observation, error) {
+	rows, err := s.serverDB.QueryContext(ctx, `
+		SELECT time, temperature, temperature_min, temperature_max, feels_like, humidity, pressure,
+			precipitation, wind_speed, wind_gusts, wind_direction, cloud_cover, weather_code, samples
+		FROM weather_observations
+		WHERE site_id = ? AND resolution = ? AND time >= ? AND time < ?
+		ORDER BY time`, siteID, resolution, from.Unix(), to.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []Observation{}
+	for rows.Next() {
+		var o Observation
+		var ts int64
+		var direction, code sql.NullInt64
+		if err := rows.Scan(&ts, &o.Temperature, &o.TemperatureMin, &o.TemperatureMax, &o.FeelsLike, &o.Humidity,
+			&o.Pressure, &o.Precipitation, &o.WindSpeed, &o.WindGusts, &direction, &o.CloudCover, &code,
+			&o.Samples); err != nil {
+			return nil, err
+		}
+		o.Time = time.Unix(ts, 0).UTC()
+		o.WindDirection = nullInt(direction)
+		o.WeatherCode = nullInt(code)
+		series = append(series, s.convertObservation(o, units))
+	}
+	return series, rows.Err()
+}
+
+// Summary aggregates the daily observations of a site in [from, to).
+// base is the degree day base temperature in units.
+func (s *ObservationService) Summary(ctx context.Context, siteID int64, from, to time.Time, base float64, units string) (*ObservationSummary, error) {
+	days, err := s.Series(ctx, siteID, ResolutionDay, from, to, "metric")
+	if err != nil {
+		return nil, err
+	}
+
+	baseC := base
+	if units == "imperial" {
+		baseC = (base - 32) * 5 / 9
+	}
+
+	summary := &ObservationSummary{From: from.UTC(), To: to.UTC(), DegreeDayBase: base}
+	var temps mean
+	for _, day := range days {
+		summary.Days++
+		if day.TemperatureMin != nil {
+			summary.TemperatureMin = minOf(summary.TemperatureMin, *day.TemperatureMin)
+		}
+		if day.TemperatureMax != nil {
+			summary.TemperatureMax = maxOf(summary.TemperatureMax, *day.TemperatureMax)
+		}
+		if day.Temperature != nil {
+			temps.add(sql.NullFloat64{Float64: *day.Temperature, Valid: true})
+		}
+		if day.Precipitation != nil {
+			summary.PrecipitationTotal += *day.Precipitation
+			if *day.Precipitation >= wetDayPrecipitation {
+				summary.WetDays++
+			}
+		}
+		if day.TemperatureMin != nil && day.TemperatureMax != nil {
+			dayMean := (*day.TemperatureMin + *day.TemperatureMax) / 2
+			summary.HeatingDegreeDays += math.Max(0, baseC-dayMean)
+			summary.CoolingDegreeDays += math.Max(0, dayMean-baseC)
+		}
+	}
+	summary.TemperatureAvg = temps.value()
+
+	if units == "imperial" {
+		w := s.weather
+		summary.TemperatureMin = convertPtr(summary.TemperatureMin, w.celsiusToFahrenheit)
+		summary.TemperatureMax = convertPtr(summary.TemperatureMax, w.celsiusToFahrenheit)
+		summary.TemperatureAvg = convertPtr(summary.TemperatureAvg, w.celsiusToFahrenheit)
+		summary.PrecipitationTotal = w.mmToInches(summary.PrecipitationTotal)
+		summary.HeatingDegreeDays *= 9.0 / 5
+		summary.CoolingDegreeDays *= 9.0 / 5
+	}
+	summary.HeatingDegreeDays = math.Round(summary.HeatingDegreeDays*10) / 10
+	summary.CoolingDegreeDays = math.Round(summary.CoolingDegreeDays*10) / 10
+	return summary, nil
+}
+
+// convertObservation converts a metric observation to units
+func (s *ObservationService) convertObservation(o Observation, units string) Observation {
+	if units != "imperial" {
+		return o
+	}
+	w := s.weather
+	o.Temperature = convertPtr(o.Temperature, w.celsiusToFahrenheit)
+	o.TemperatureMin = convertPtr(o.TemperatureMin, w.celsiusToFahrenheit)
+	o.TemperatureMax = convertPtr(o.TemperatureMax, w.celsiusToFahrenheit)
+	o.FeelsLike = convertPtr(o.FeelsLike, w.celsiusToFahrenheit)
+	o.Pressure = convertPtr(o.Pressure, w.hpaToInhg)
+	o.Precipitation = convertPtr(o.Precipitation, w.mmToInches)
+	o.WindSpeed = convertPtr(o.WindSpeed, w.kmhToMph)
+	o.WindGusts = convertPtr(o.WindGusts, w.kmhToMph)
+	return o
+}
+
+// convertPtr applies convert to a value that may be missing
+func convertPtr(v *float64, convert func(float64) float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	c := convert(*v)
+	return &c
+}
+
+// nullInt returns the value, nil when NULL
+func nullInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	n := int(v.Int64)
+	return &n
+}
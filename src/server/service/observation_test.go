@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+// observationNow is the clock of the observation tests
+var observationNow = time.Date(2026, 3, 10, 12, 30, 0, 0, time.UTC)
+
+// fakeObservationAPI answers observation requests like Open-Meteo for the
+// 24 hours before observationNow and the next hour, in UTC. The temperature
+// is the hour of the day, every hour has 0.5 mm of precipitation and the
+// wind turns between 350° and 10°. Every forecast day has a high of 20 °C,
+// a low of 10 °C and 2 mm of precipitation.
+func fakeObservationAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("timeformat") != "unixtime" || q.Get("past_hours") != "24" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+
+		var location openMeteoObservationResponse
+		location.Timezone = "UTC"
+		h := &location.Hourly
+		start := observationNow.Truncate(time.Hour).Add(-24 * time.Hour)
+		for ts := start; !ts.After(observationNow.Add(time.Hour)); ts = ts.Add(time.Hour) {
+			temp, precip, dir := float64(ts.Hour()), 0.5, 350.0
+			if ts.Hour()%2 == 0 {
+				dir = 10
+			}
+			h.Time = append(h.Time, ts.Unix())
+			h.Temperature2m = append(h.Temperature2m, &temp)
+			h.Precipitation = append(h.Precipitation, &precip)
+			h.WindDirection10m = append(h.WindDirection10m, &dir)
+		}
+		d := &location.Daily
+		days, _ := strconv.Atoi(q.Get("forecast_days"))
+		for i := 0; i < days; i++ {
+			tmax, tmin, precip := 20.0, 10.0, 2.0
+			d.Time = append(d.Time, time.Date(2026, 3, 10+i, 0, 0, 0, 0, time.UTC).Unix())
+			d.Temperature2mMax = append(d.Temperature2mMax, &tmax)
+			d.Temperature2mMin = append(d.Temperature2mMin, &tmin)
+			d.PrecipitationSum = append(d.PrecipitationSum, &precip)
+		}
+
+		points := len(strings.Split(q.Get("latitude"), ","))
+		if points == 1 {
+			json.NewEncoder(w).Encode(location)
+			return
+		}
+		all := make([]openMeteoObservationResponse, points)
+		for i := range all {
+			all[i] = location
+		}
+		json.NewEncoder(w).Encode(all)
+	}))
+}
+
+func setupObservations(t *testing.T) *ObservationService {
+	t.Helper()
+	dir := t.TempDir()
+	open := func(name string) *sql.DB {
+		db, err := sql.Open("sqlite", filepath.Join(dir, name+".db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := database.MigrateDatabase(db, database.DialectSQLite, name, nil); err != nil {
+			t.Fatalf("Failed to migrate %s database: %v", name, err)
+		}
+		return db
+	}
+	usersDB, serverDB := open(database.MigrationsUsers), open(database.MigrationsServer)
+
+	for _, stmt := range []string{
+		`INSERT INTO user_accounts (id, username, email, password_hash) VALUES (1, 'jane', 'jane@example.org', 'x')`,
+		`INSERT INTO user_saved_locations (user_id, name, latitude, longitude) VALUES (1, 'Home', 52.5201, 13.4004), (1, 'Also home', 52.5199, 13.3996)`,
+	} {
+		if _, err := usersDB.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	api := fakeObservationAPI(t)
+	t.Cleanup(api.Close)
+	ws := &WeatherService{client: api.Client(), openMeteoBaseURL: api.URL}
+
+	s := NewObservationService(serverDB, usersDB, ws)
+	s.now = func() time.Time { return observationNow }
+	return s
+}
+
+func TestPopularLocations(t *testing.T) {
+	ws := &WeatherService{}
+	for i := 0; i < 3; i++ {
+		ws.countLookup(40.7128, -74.0060)
+	}
+	ws.countLookup(48.8566, 2.3522)
+	ws.countLookup(48.8566, 2.3522)
+	ws.countLookup(35.6762, 139.6503)
+
+	popular := ws.PopularLocations(5)
+	want := []WeatherPoint{{40.71, -74.01}, {48.86, 2.35}}
+	if len(popular) != len(want) || popular[0] != want[0] || popular[1] != want[1] {
+		t.Fatalf("PopularLocations = %v, want %v", popular, want)
+	}
+	if again := ws.PopularLocations(5); len(again) != 0 {
+		t.Errorf("counts were not reset: %v", again)
+	}
+}
+
+func TestRecordObservations(t *testing.T) {
+	s := setupObservations(t)
+	ctx := context.Background()
+	s.weather.countLookup(40.7128, -74.0060)
+	s.weather.countLookup(40.7128, -74.0060)
+
+	run, err := s.Record(ctx)
+	if err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	// Both saved locations round to one site, plus the popular one; 25
+	// past hours each and 7 forecast days
+	if run.Sites != 2 || run.Failed != 0 || run.Observations != 50 || run.Forecasts != 14 {
+		t.Errorf("run = %+v", run)
+	}
+
+	saved, err := s.FindSite(ctx, 52.52, 13.40)
+	if err != nil || !saved.Saved || saved.LastObservedAt == nil || !saved.LastObservedAt.Equal(time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("saved site = %+v, %v", saved, err)
+	}
+	if popular, err := s.FindSite(ctx, 40.71, -74.01); err != nil || popular.Saved {
+		t.Errorf("popular site = %+v, %v", popular, err)
+	}
+	if _, err := s.FindSite(ctx, 35.68, 139.65); err != ErrNoObservations {
+		t.Errorf("unrecorded site: err = %v", err)
+	}
+
+	// Runs overlap; forecasts keep the first issue of the day
+	again, err := s.Record(ctx)
+	if err != nil || again.Observations != 50 || again.Forecasts != 0 {
+		t.Errorf("second run = %+v, %v", again, err)
+	}
+	var hours int
+	s.serverDB.QueryRow("SELECT COUNT(*) FROM weather_observations WHERE site_id = ?", saved.ID).Scan(&hours)
+	if hours != 25 {
+		t.Errorf("hourly rows = %d, want 25", hours)
+	}
+
+	// The popular site stops being recorded a week after its last lookup
+	s.now = func() time.Time { return observationNow.AddDate(0, 0, 8) }
+	sites, err := s.activeSites(ctx, s.now(), s.Policy())
+	if err != nil || len(sites) != 1 || sites[0].ID != saved.ID {
+		t.Errorf("active sites after a week = %+v, %v", sites, err)
+	}
+}
+
+func TestDownsampleAndQueries(t *testing.T) {
+	s := setupObservations(t)
+	ctx := context.Background()
+	if _, err := s.Record(ctx); err != nil {
+		t.Fatal(err)
+	}
+	site, err := s.FindSite(ctx, 52.52, 13.40)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := s.Downsample(ctx)
+	if err != nil || written != 1 {
+		t.Fatalf("Downsample = %d, %v; want only the completed 9 March", written, err)
+	}
+
+	day := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+	days, err := s.Series(ctx, site.ID, ResolutionDay, day, day.AddDate(0, 0, 2), "metric")
+	if err != nil || len(days) != 1 {
+		t.Fatalf("daily series = %+v, %v", days, err)
+	}
+	d := days[0]
+	if !d.Time.Equal(day) || d.Samples != 12 || *d.TemperatureMin != 12 || *d.TemperatureMax != 23 ||
+		*d.Temperature != 17.5 || *d.Precipitation != 6 || *d.WindDirection != 0 {
+		t.Errorf("9 March = %+v", d)
+	}
+
+	hours, err := s.Series(ctx, site.ID, ResolutionHour, observationNow.Add(-3*time.Hour), observationNow, "imperial")
+	if err != nil || len(hours) != 3 {
+		t.Fatalf("hourly series = %+v, %v", hours, err)
+	}
+	if *hours[0].Temperature != 50 || math.Abs(*hours[0].Precipitation-0.0197) > 0.001 {
+		t.Errorf("10:00 in imperial = %v °F, %v in", *hours[0].Temperature, *hours[0].Precipitation)
+	}
+
+	summary, err := s.Summary(ctx, site.ID, day, day.AddDate(0, 0, 1), 18, "metric")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Days != 1 || summary.WetDays != 1 || summary.PrecipitationTotal != 6 ||
+		summary.HeatingDegreeDays != 0.5 || summary.CoolingDegreeDays != 0 {
+		t.Errorf("summary = %+v", summary)
+	}
+	imperial, _ := s.Summary(ctx, site.ID, day, day.AddDate(0, 0, 1), 65, "imperial")
+	// 65 °F is 18.3 °C, 0.83 °C above the day's mean
+	if *imperial.TemperatureMax != 73.4 || imperial.HeatingDegreeDays != 1.5 {
+		t.Errorf("imperial summary = %+v", imperial)
+	}
+
+	if _, err := s.serverDB.Exec(`INSERT INTO weather_forecast_issues
+		(site_id, provider, day, lead_days, temperature_max, temperature_min, precipitation, issued_at)
+		VALUES (?, 'open-meteo', ?, 1, 25, 10, 0, 0)`, site.ID, day.Unix()); err != nil {
+		t.Fatal(err)
+	}
+	accuracy, err := s.ForecastAccuracy(ctx, site.ID, day, observationNow, "metric")
+	if err != nil || len(accuracy.Leads) != 1 || len(accuracy.Days) != 1 {
+		t.Fatalf("accuracy = %+v, %v", accuracy, err)
+	}
+	lead := accuracy.Leads[0]
+	if lead.LeadDays != 1 || *lead.TempMaxError != 2 || *lead.TempMaxBias != 2 || *lead.TempMinBias != -2 ||
+		*lead.PrecipitationError != 6 || *lead.PrecipitationHitRate != 0 {
+		t.Errorf("lead 1 = %+v", lead)
+	}
+}
+
+func TestPruneObservations(t *testing.T) {
+	s := setupObservations(t)
+	ctx := context.Background()
+	if _, err := s.Record(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Downsample(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.serverDB.Exec(`INSERT INTO weather_observation_sites (latitude, longitude, last_requested_at) VALUES (1, 1, ?)`,
+		observationNow.AddDate(0, 0, -30).Unix()); err != nil {
+		t.Fatal(err)
+	}
+
+	s.now = func() time.Time { return observationNow.AddDate(0, 0, 31) }
+	removed, err := s.Prune(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed["hourly"] != 25 || removed["daily"] != 0 || removed["forecasts"] != 0 || removed["sites"] != 1 {
+		t.Errorf("removed = %v", removed)
+	}
+
+	s.SetPolicy(ObservationPolicy{DailyDays: 10, ForecastHistoryDays: 10})
+	removed, err = s.Prune(ctx)
+	if err != nil || removed["daily"] != 1 || removed["forecasts"] != 7 {
+		t.Errorf("removed with short retention = %v, %v", removed, err)
+	}
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+
+	"github.com/apimgr/weather/src/config"
+)
+
+// Login purposes; admin SSO is kept apart from user login
+const (
+	OIDCPurposeUser  = "user"
+	OIDCPurposeAdmin = "admin"
+)
+
+// Discovery documents are refreshed after this long. Signing keys are cached
+// by the provider's key set and refetched when an unknown key ID appears.
+const oidcDiscoveryTTL = time.Hour
+
+// OIDCAuthRequest is the state of one login between the redirect to the
+// identity provider and the callback
+type OIDCAuthRequest struct {
+	Provider    string `json:"provider"`
+	Purpose     string `json:"purpose"`
+	State       string `json:"state"`
+	Nonce       string `json:"nonce"`
+	Verifier    string `json:"verifier"`
+	RedirectURL string `json:"redirect_url"`
+	// Local path to return to after login
+	ReturnTo string `json:"return_to,omitempty"`
+}
+
+// OIDCIdentity is the verified identity returned by a provider
+type OIDCIdentity struct {
+	Provider      string
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+	// Role mapped from the configured role claim (user or admin)
+	Role   string
+	Claims map[string]interface{}
+}
+
+// OIDCService runs the authorization code flow with PKCE against the
+// configured OpenID Connect providers
+type OIDCService struct {
+	client *http.Client
+
+	mu        sync.Mutex
+	providers map[string]*oidcProvider
+}
+
+// oidcProvider is a discovered provider and its ID token verifier
+type oidcProvider struct {
+	key        string
+	provider   *oidc.Provider
+	verifier   *oidc.IDTokenVerifier
+	discovered time.Time
+}
+
+// NewOIDCService creates a new OIDC service
+func NewOIDCService() *OIDCService {
+	return &OIDCService{
+		client:    &http.Client{Timeout: 15 * time.Second},
+		providers: make(map[string]*oidcProvider),
+	}
+}
+
+// SetHTTPClient replaces the client used for discovery, JWKS and token requests
+func (s *OIDCService) SetHTTPClient(client *http.Client) {
+	s.client = client
+}
+
+// discover returns the cached provider, running discovery when the cache is
+// empty, stale or the provider settings changed
+func (s *OIDCService) discover(ctx context.Context, cfg *config.OIDCProviderConfig) (*oidcProvider, error) {
+	key := cfg.IssuerURL + "\x00" + cfg.ClientID
+
+	s.mu.Lock()
+	cached := s.providers[cfg.Name]
+	s.mu.Unlock()
+	if cached != nil && cached.key == key && time.Since(cached.discovered) < oidcDiscoveryTTL {
+		return cached, nil
+	}
+
+	provider, err := oidc.NewProvider(oidc.ClientContext(ctx, s.client), cfg.IssuerURL)
+	if err != nil {
+		if cached != nil && cached.key == key {
+			// Keep using the last good discovery document
+			return cached, nil
+		}
+		return nil, fmt.Errorf("OIDC discovery failed for %s: %w", cfg.Name, err)
+	}
+
+	entry := &oidcProvider{
+		key:        key,
+		provider:   provider,
+		verifier:   provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		discovered: time.Now(),
+	}
+	s.mu.Lock()
+	s.providers[cfg.Name] = entry
+	s.mu.Unlock()
+	return entry, nil
+}
+
+func oauth2Config(p *oidcProvider, cfg *config.OIDCProviderConfig, redirectURL string) *oauth2.Config {
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"email", "profile"}
+	}
+	hasOpenID := false
+	for _, scope := range scopes {
+		if scope == oidc.ScopeOpenID {
+			hasOpenID = true
+		}
+	}
+	if !hasOpenID {
+		scopes = append([]string{oidc.ScopeOpenID}, scopes...)
+	}
+
+	return &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		Endpoint:     p.provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	}
+}
+
+// Begin starts a login and returns the provider's authorization URL along
+// with the request state to keep until the callback
+func (s *OIDCService) Begin(ctx context.Context, cfg *config.OIDCProviderConfig, redirectURL, purpose, returnTo string) (string, *OIDCAuthRequest, error) {
+	p, err := s.discover(ctx, cfg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	state, err := randomOIDCValue()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := randomOIDCValue()
+	if err != nil {
+		return "", nil, err
+	}
+
+	req := &OIDCAuthRequest{
+		Provider:    cfg.Name,
+		Purpose:     purpose,
+		State:       state,
+		Nonce:       nonce,
+		Verifier:    oauth2.GenerateVerifier(),
+		RedirectURL: redirectURL,
+		ReturnTo:    returnTo,
+	}
+	authURL := oauth2Config(p, cfg, redirectURL).AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.S256ChallengeOption(req.Verifier),
+	)
+	return authURL, req, nil
+}
+
+// Complete exchanges the authorization code and verifies the ID token
+// against the stored state, nonce and PKCE verifier
+func (s *OIDCService) Complete(ctx context.Context, cfg *config.OIDCProviderConfig, req *OIDCAuthRequest, state, code string) (*OIDCIdentity, error) {
+	if req == nil || req.Provider != cfg.Name {
+		return nil, fmt.Errorf("login request not found or expired")
+	}
+	if state == "" || state != req.State {
+		return nil, fmt.Errorf("state mismatch")
+	}
+	if code == "" {
+		return nil, fmt.Errorf("missing authorization code")
+	}
+
+	p, err := s.discover(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = oidc.ClientContext(ctx, s.client)
+	token, err := oauth2Config(p, cfg, req.RedirectURL).Exchange(ctx, code, oauth2.VerifierOption(req.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("provider returned no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if idToken.Nonce != req.Nonce {
+		return nil, fmt.Errorf("nonce mismatch")
+	}
+
+	claims := make(map[string]interface{})
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode claims: %w", err)
+	}
+
+	// Providers may leave profile claims out of the ID token
+	if _, hasEmail := claims["email"]; !hasEmail && p.provider.UserInfoEndpoint() != "" {
+		if info, err := p.provider.UserInfo(ctx, oauth2.StaticTokenSource(token)); err == nil && info.Subject == idToken.Subject {
+			extra := make(map[string]interface{})
+			if info.Claims(&extra) == nil {
+				for k, v := range extra {
+					if _, exists := claims[k]; !exists {
+						claims[k] = v
+					}
+				}
+			}
+		}
+	}
+
+	return newOIDCIdentity(cfg, idToken.Issuer, idToken.Subject, claims), nil
+}
+
+func newOIDCIdentity(cfg *config.OIDCProviderConfig, issuer, subject string, claims map[string]interface{}) *OIDCIdentity {
+	identity := &OIDCIdentity{
+		Provider: cfg.Name,
+		Issuer:   issuer,
+		Subject:  subject,
+		Claims:   claims,
+		Role:     MapOIDCRole(cfg, claims),
+	}
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = v
+	case string:
+		// Some providers send "true" as a string
+		identity.EmailVerified = v == "true"
+	}
+
+	usernameClaim := cfg.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	identity.Username, _ = lookupOIDCClaim(claims, usernameClaim).(string)
+	return identity
+}
+
+// MapOIDCRole maps the provider's role claim to a local role. The first
+// claim value found in role_mapping wins, preferring admin.
+func MapOIDCRole(cfg *config.OIDCProviderConfig, claims map[string]interface{}) string {
+	role := cfg.DefaultRole
+	if role == "" {
+		role = "user"
+	}
+	if cfg.RoleClaim == "" || len(cfg.RoleMapping) == 0 {
+		return role
+	}
+
+	var values []string
+	switch v := lookupOIDCClaim(claims, cfg.RoleClaim).(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	mapped := ""
+	for _, value := range values {
+		if r, ok := cfg.RoleMapping[value]; ok {
+			if r == "admin" {
+				return r
+			}
+			if mapped == "" {
+				mapped = r
+			}
+		}
+	}
+	if mapped != "" {
+		return mapped
+	}
+	return role
+}
+
+// lookupOIDCClaim resolves a dotted claim path such as realm_access.roles
+func lookupOIDCClaim(claims map[string]interface{}, path string) interface{} {
+	if v, ok := claims[path]; ok {
+		return v
+	}
+	var current interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	return current
+}
+
+func randomOIDCValue() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+
+	"github.com/apimgr/weather/src/config"
+)
+
+// testOIDCProvider is a minimal stand-in identity provider: discovery, JWKS,
+// and a token endpoint that checks the PKCE verifier
+type testOIDCProvider struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	key     *rsa.PrivateKey
+	keyID   string
+	pending map[string]testOIDCGrant
+	// Claims added to every ID token
+	claims map[string]interface{}
+	// Overrides the nonce in issued tokens when set
+	nonceOverride string
+	jwksFetches   int
+}
+
+type testOIDCGrant struct {
+	challenge string
+	nonce     string
+}
+
+func newTestOIDCProvider(t *testing.T) *testOIDCProvider {
+	t.Helper()
+	p := &testOIDCProvider{pending: make(map[string]testOIDCGrant)}
+	p.rotateKey(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.server.URL,
+			"authorization_endpoint":                p.server.URL + "/authorize",
+			"token_endpoint":                        p.server.URL + "/token",
+			"jwks_uri":                              p.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.jwksFetches++
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &p.key.PublicKey, KeyID: p.keyID, Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", p.handleToken)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *testOIDCProvider) rotateKey(t *testing.T) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.key = key
+	p.keyID = base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()[:8])
+}
+
+// authorize simulates the user approving the login at the provider
+func (p *testOIDCProvider) authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("Authorization URL lacks PKCE: %s", authURL)
+	}
+	if q.Get("nonce") == "" || q.Get("state") == "" {
+		t.Fatalf("Authorization URL lacks nonce or state: %s", authURL)
+	}
+
+	code = "code-" + q.Get("state")[:8]
+	p.mu.Lock()
+	p.pending[code] = testOIDCGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	p.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (p *testOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	grant, ok := p.pending[r.PostForm.Get("code")]
+	delete(p.pending, r.PostForm.Get("code"))
+	key, keyID := p.key, p.keyID
+	nonce := grant.nonce
+	if p.nonceOverride != "" {
+		nonce = p.nonceOverride
+	}
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   p.server.URL,
+		"sub":   "subject-123",
+		"aud":   "weather-client",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": nonce,
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	payload, _ := json.Marshal(claims)
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", keyID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	idToken, _ := signed.CompactSerialize()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (p *testOIDCProvider) config() *config.OIDCProviderConfig {
+	return &config.OIDCProviderConfig{
+		Name:         "test",
+		IssuerURL:    p.server.URL,
+		ClientID:     "weather-client",
+		ClientSecret: "weather-secret",
+		RoleClaim:    "realm_access.roles",
+		RoleMapping:  map[string]string{"weather-admin": "admin"},
+	}
+}
+
+// login runs a full authorization code flow against the stand-in provider
+func (p *testOIDCProvider) login(t *testing.T, s *OIDCService, cfg *config.OIDCProviderConfig) (*OIDCIdentity, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, req, err := s.Begin(ctx, cfg, "http://weather.test/auth/oidc/test/callback", OIDCPurposeUser, "")
+	if err != nil {
+		t.Fatalf("Begin failed: %v", err)
+	}
+	code, state := p.authorize(t, authURL)
+	return s.Complete(ctx, cfg, req, state, code)
+}
+
+func TestOIDC_AuthorizationCodeFlow(t *testing.T) {
+	p := newTestOIDCProvider(t)
+	p.claims = map[string]interface{}{
+		"email":              "jane@example.com",
+		"email_verified":     true,
+		"preferred_username": "jane",
+		"realm_access":       map[string]interface{}{"roles": []string{"offline", "weather-admin"}},
+	}
+	s := NewOIDCService()
+
+	identity, err := p.login(t, s, p.config())
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if identity.Subject != "subject-123" || identity.Issuer != p.server.URL {
+		t.Errorf("Unexpected identity %+v", identity)
+	}
+	if identity.Email != "jane@example.com" || !identity.EmailVerified || identity.Username != "jane" {
+		t.Errorf("Unexpected profile claims %+v", identity)
+	}
+	if identity.Role != "admin" {
+		t.Errorf("Expected role admin from role mapping, got %q", identity.Role)
+	}
+}
+
+func TestOIDC_RejectsStateMismatch(t *testing.T) {
+	p := newTestOIDCProvider(t)
+	s := NewOIDCService()
+	cfg := p.config()
+	ctx := context.Background()
+
+	authURL, req, err := s.Begin(ctx, cfg, "http://weather.test/callback", OIDCPurposeUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := p.authorize(t, authURL)
+	if _, err := s.Complete(ctx, cfg, req, "forged-state", code); err == nil {
+		t.Error("Expected state mismatch to be rejected")
+	}
+	if _, err := s.Complete(ctx, cfg, nil, req.State, code); err == nil {
+		t.Error("Expected missing login request to be rejected")
+	}
+}
+
+func TestOIDC_RejectsNonceMismatch(t *testing.T) {
+	p := newTestOIDCProvider(t)
+	p.nonceOverride = "replayed-nonce"
+	s := NewOIDCService()
+
+	if _, err := p.login(t, s, p.config()); err == nil {
+		t.Error("Expected ID token with a foreign nonce to be rejected")
+	}
+}
+
+func TestOIDC_RejectsWrongVerifier(t *testing.T) {
+	p := newTestOIDCProvider(t)
+	s := NewOIDCService()
+	cfg := p.config()
+	ctx := context.Background()
+
+	authURL, req, err := s.Begin(ctx, cfg, "http://weather.test/callback", OIDCPurposeUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := p.authorize(t, authURL)
+	req.Verifier = "intercepted-code-without-the-verifier-0123456789"
+	if _, err := s.Complete(ctx, cfg, req, state, code); err == nil {
+		t.Error("Expected token exchange with the wrong PKCE verifier to fail")
+	}
+}
+
+func TestOIDC_RejectsTokenForOtherClient(t *testing.T) {
+	p := newTestOIDCProvider(t)
+	s := NewOIDCService()
+	cfg := p.config()
+	ctx := context.Background()
+
+	authURL, req, err := s.Begin(ctx, cfg, "http://weather.test/callback", OIDCPurposeUser, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := p.authorize(t, authURL)
+
+	// Same issuer, different client: the token's audience no longer matches
+	other := *cfg
+	other.ClientID = "someone-else"
+	if _, err := s.Complete(ctx, &other, req, state, code); err == nil {
+		t.Error("Expected ID token issued to another client to be rejected")
+	}
+}
+
+func TestOIDC_RefetchesKeysAfterRotation(t *testing.T) {
+	p := newTestOIDCProvider(t)
+	s := NewOIDCService()
+	cfg := p.config()
+
+	if _, err := p.login(t, s, cfg); err != nil {
+		t.Fatalf("First login failed: %v", err)
+	}
+	if _, err := p.login(t, s, cfg); err != nil {
+		t.Fatalf("Second login failed: %v", err)
+	}
+	p.mu.Lock()
+	fetches := p.jwksFetches
+	p.mu.Unlock()
+	if fetches != 1 {
+		t.Errorf("Expected JWKS to be cached, fetched %d times", fetches)
+	}
+
+	p.rotateKey(t)
+	if _, err := p.login(t, s, cfg); err != nil {
+		t.Fatalf("Login after key rotation failed: %v", err)
+	}
+}
+
+func TestMapOIDCRole(t *testing.T) {
+	cfg := &config.OIDCProviderConfig{
+		RoleClaim:   "groups",
+		RoleMapping: map[string]string{"staff": "user", "ops": "admin"},
+		DefaultRole: "user",
+	}
+
+	tests := []struct {
+		claims map[string]interface{}
+		want   string
+	}{
+		{map[string]interface{}{"groups": []interface{}{"staff", "ops"}}, "admin"},
+		{map[string]interface{}{"groups": "staff"}, "user"},
+		{map[string]interface{}{"groups": []interface{}{"other"}}, "user"},
+		{map[string]interface{}{}, "user"},
+	}
+	for _, tt := range tests {
+		if got := MapOIDCRole(cfg, tt.claims); got != tt.want {
+			t.Errorf("MapOIDCRole(%v) = %q, want %q", tt.claims, got, tt.want)
+		}
+	}
+}
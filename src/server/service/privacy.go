@@ -0,0 +1,464 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetentionClass is a kind of personal data with its own retention period
+type RetentionClass struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Days kept when server.privacy.retention does not set it; negative
+	// keeps the data for as long as the account exists or until it expires
+	DefaultDays int `json:"default_days"`
+	// False for classes with a fixed lifetime
+	Configurable bool `json:"configurable"`
+	// What the retention period is counted from
+	Basis string `json:"basis"`
+	// What deleting an account does to the data
+	OnErasure string `json:"on_erasure"`
+}
+
+// Retention class names, the keys of server.privacy.retention
+const (
+	RetentionAccounts             = "accounts"
+	RetentionSessions             = "sessions"
+	RetentionAuditLog             = "audit_log"
+	RetentionAuditArchives        = "audit_archives"
+	RetentionActivity             = "activity"
+	RetentionDevices              = "devices"
+	RetentionNotifications        = "notifications"
+	RetentionNotificationDelivery = "notification_delivery"
+	RetentionTokenUsage           = "token_usage"
+	RetentionContactSubmissions   = "contact_submissions"
+	RetentionDataExports          = "data_exports"
+)
+
+// RetentionClasses lists every class of personal data the server keeps
+var RetentionClasses = []RetentionClass{
+	{RetentionAccounts, "User accounts, profiles, preferences, saved locations and API tokens", -1, false, "until the account is deleted", "deleted"},
+	{RetentionSessions, "Web sessions with IP address and user agent", -1, false, "until the session expires", "deleted"},
+	{RetentionAuditLog, "Audit log in the server database", 90, true, "event time", "anonymized"},
+	{RetentionAuditArchives, "Rotated hash-chained audit log files", 365, true, "file rotation", "kept with pseudonymous user IDs until they age out"},
+	{RetentionActivity, "User activity log (logins, security events)", 365, true, "event time", "deleted"},
+	{RetentionDevices, "Devices users logged in from", 365, true, "last seen", "deleted"},
+	{RetentionNotifications, "In-app user and admin notifications", 30, true, "creation", "deleted"},
+	{RetentionNotificationDelivery, "Delivered notification queue entries and delivery history", 30, true, "delivery", "deleted"},
+	{RetentionTokenUsage, "Hourly API token usage", 90, true, "usage hour", "deleted"},
+	{RetentionContactSubmissions, "Contact form submissions", 365, true, "submission", "deleted when sent from the account email"},
+	{RetentionDataExports, "Personal data export archives", 7, true, "export creation", "deleted"},
+}
+
+// LookupRetentionClass returns the class called name
+func LookupRetentionClass(name string) (RetentionClass, bool) {
+	for _, class := range RetentionClasses {
+		if class.Name == name {
+			return class, true
+		}
+	}
+	return RetentionClass{}, false
+}
+
+// RetentionPolicy is the configured days per retention class; 0 or missing
+// uses the class default, negative keeps the data forever
+type RetentionPolicy map[string]int
+
+// retentionTarget is a table of one retention class and the column its
+// retention period is counted from
+type retentionTarget struct {
+	server bool
+	table  string
+	column string
+	// Extra condition rows must meet to be purged
+	where string
+	// The column holds unix seconds, or UTC hours as "2006-01-02T15"
+	unix, hour bool
+}
+
+// retentionTargets are the tables of each class. EnforceRetention purges
+// those of configurable classes by age; the report counts all of them
+var retentionTargets = map[string][]retentionTarget{
+	RetentionAccounts: {{table: "user_accounts", column: "created_at"}},
+	RetentionSessions: {{table: "user_sessions", column: "created_at"}},
+	RetentionAuditLog: {{server: true, table: "server_audit_log", column: "timestamp"}},
+	RetentionActivity: {{table: "user_activity_log", column: "created_at"}},
+	RetentionDevices:  {{table: "user_devices", column: "last_seen_at"}},
+	RetentionNotifications: {
+		{table: "user_notifications", column: "created_at"},
+		{server: true, table: "server_admin_notifications", column: "created_at"},
+	},
+	RetentionNotificationDelivery: {
+		{server: true, table: "notification_queue", column: "delivered_at", where: "state = 'delivered'"},
+		{server: true, table: "notification_history", column: "created_at"},
+	},
+	RetentionTokenUsage: {
+		{table: "user_token_usage", column: "hour", hour: true},
+		{table: "org_token_usage", column: "hour", hour: true},
+		{server: true, table: "server_admin_token_usage", column: "hour", hour: true},
+	},
+	RetentionContactSubmissions: {{server: true, table: "contact_submissions", column: "created_at", unix: true}},
+	RetentionDataExports:        {{table: "user_data_exports", column: "created_at"}},
+}
+
+// RetentionReportEntry is what the server keeps of one retention class
+type RetentionReportEntry struct {
+	RetentionClass
+	// Effective retention in days; -1 when not limited by age
+	Days int `json:"days"`
+	// Human readable retention, e.g. "90 days" or "until the session expires"
+	Period  string `json:"period"`
+	Records int64  `json:"records"`
+	// Oldest record kept, empty when there are none
+	Oldest string `json:"oldest,omitempty"`
+}
+
+// PrivacyService applies the retention policy, builds personal data
+// exports and erases accounts across the users and server databases
+type PrivacyService struct {
+	usersDB   *sql.DB
+	serverDB  *sql.DB
+	exportDir string
+
+	mu                sync.RWMutex
+	policy            RetentionPolicy
+	deletionLinkHours int
+	audit             *AuditLogger
+	mailer            AccountMailer
+
+	// Running exports, waited for by tests
+	jobs sync.WaitGroup
+
+	// Overridable for tests
+	now func() time.Time
+}
+
+// NewPrivacyService creates the service. Export archives are written to
+// exportDir, and emails go out through the SMTP settings in serverDB.
+func NewPrivacyService(usersDB, serverDB *sql.DB, exportDir string) *PrivacyService {
+	return &PrivacyService{
+		usersDB:   usersDB,
+		serverDB:  serverDB,
+		exportDir: exportDir,
+		mailer:    NewSMTPService(serverDB),
+		now:       time.Now,
+	}
+}
+
+// SetPolicy sets the retention days per class and how long account
+// deletion links are valid. Unknown or fixed classes are an error, and
+// the rest of the policy still applies.
+func (s *PrivacyService) SetPolicy(policy RetentionPolicy, deletionLinkHours int) error {
+	var unknown []string
+	for name := range policy {
+		if class, ok := LookupRetentionClass(name); !ok || !class.Configurable {
+			unknown = append(unknown, name)
+		}
+	}
+	s.mu.Lock()
+	s.policy = policy
+	s.deletionLinkHours = deletionLinkHours
+	s.mu.Unlock()
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown or fixed retention classes: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// SetAudit writes exports and account deletions to the audit log, and
+// lets retention prune rotated audit log files
+func (s *PrivacyService) SetAudit(audit *AuditLogger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = audit
+}
+
+// SetMailer replaces the SMTP mailer
+func (s *PrivacyService) SetMailer(mailer AccountMailer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mailer = mailer
+}
+
+// RetentionDays returns the effective retention of a class in days, or -1
+// when it is not limited by age
+func (s *PrivacyService) RetentionDays(name string) int {
+	class, ok := LookupRetentionClass(name)
+	if !ok {
+		return -1
+	}
+	if !class.Configurable {
+		return class.DefaultDays
+	}
+	s.mu.RLock()
+	days := s.policy[name]
+	s.mu.RUnlock()
+	if days < 0 {
+		return -1
+	}
+	if days > 0 {
+		return days
+	}
+	if name == RetentionAuditLog {
+		// The audit.retention_days setting predates server.privacy
+		if value, err := strconv.Atoi(s.setting("audit.retention_days", "")); err == nil && value > 0 {
+			return value
+		}
+	}
+	return class.DefaultDays
+}
+
+func (s *PrivacyService) setting(key, defaultValue string) string {
+	if s.serverDB == nil {
+		return defaultValue
+	}
+	var value string
+	if err := s.serverDB.QueryRow("SELECT value FROM server_config WHERE key = ?", key).Scan(&value); err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func (s *PrivacyService) db(server bool) *sql.DB {
+	if server {
+		return s.serverDB
+	}
+	return s.usersDB
+}
+
+// EnforceRetention deletes everything older than its class's retention
+// period and returns how many records or files were removed per class
+func (s *PrivacyService) EnforceRetention(ctx context.Context) (map[string]int64, error) {
+	removed := make(map[string]int64)
+	var errs []error
+	for _, class := range RetentionClasses {
+		if !class.Configurable {
+			continue
+		}
+		days := s.RetentionDays(class.Name)
+		if days < 0 {
+			continue
+		}
+		cutoff := s.now().AddDate(0, 0, -days)
+
+		var n int64
+		var err error
+		switch class.Name {
+		case RetentionAuditArchives:
+			n, err = s.pruneAuditArchives(cutoff)
+		case RetentionDataExports:
+			n, err = s.pruneExports(ctx, cutoff)
+		default:
+			for _, target := range retentionTargets[class.Name] {
+				deleted, targetErr := s.purgeTarget(ctx, target, cutoff)
+				n += deleted
+				if targetErr != nil {
+					err = errors.Join(err, targetErr)
+				}
+			}
+		}
+		if n > 0 {
+			removed[class.Name] = n
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", class.Name, err))
+		}
+	}
+	if err := s.failStaleExports(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", RetentionDataExports, err))
+	}
+	return removed, errors.Join(errs...)
+}
+
+// purgeTarget deletes the rows of target older than cutoff
+func (s *PrivacyService) purgeTarget(ctx context.Context, target retentionTarget, cutoff time.Time) (int64, error) {
+	db := s.db(target.server)
+	if db == nil {
+		return 0, nil
+	}
+	var arg interface{} = cutoff.UTC()
+	switch {
+	case target.unix:
+		arg = cutoff.Unix()
+	case target.hour:
+		arg = cutoff.UTC().Format("2006-01-02T15")
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s < ?", target.table, target.column)
+	if target.where != "" {
+		query += " AND " + target.where
+	}
+	result, err := db.ExecContext(ctx, query, arg)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", target.table, err)
+	}
+	return result.RowsAffected()
+}
+
+// auditArchives returns the rotated audit log files and their mtimes
+func (s *PrivacyService) auditArchives() (map[string]time.Time, error) {
+	s.mu.RLock()
+	audit := s.audit
+	s.mu.RUnlock()
+	if audit == nil {
+		return nil, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(audit.LogDir(), AuditLogFileName+".*"))
+	if err != nil {
+		return nil, err
+	}
+	archives := make(map[string]time.Time, len(matches))
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			archives[path] = info.ModTime()
+		}
+	}
+	return archives, nil
+}
+
+// pruneAuditArchives removes rotated audit log files last written before
+// cutoff. The chain of the remaining files still verifies from their first
+// record on.
+func (s *PrivacyService) pruneAuditArchives(cutoff time.Time) (int64, error) {
+	archives, err := s.auditArchives()
+	if err != nil {
+		return 0, err
+	}
+	var removed int64
+	for path, modTime := range archives {
+		if modTime.Before(cutoff) {
+			if err := os.Remove(path); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// RetentionReport lists every class of personal data with its retention
+// period, how many records are kept and the oldest of them
+func (s *PrivacyService) RetentionReport(ctx context.Context) ([]RetentionReportEntry, error) {
+	report := make([]RetentionReportEntry, 0, len(RetentionClasses))
+	for _, class := range RetentionClasses {
+		entry := RetentionReportEntry{RetentionClass: class, Days: s.RetentionDays(class.Name)}
+		switch {
+		case entry.Days > 0:
+			entry.Period = fmt.Sprintf("%d days", entry.Days)
+		case class.Configurable:
+			entry.Period = "forever"
+		default:
+			entry.Period = class.Basis
+		}
+
+		if class.Name == RetentionAuditArchives {
+			archives, err := s.auditArchives()
+			if err != nil {
+				return nil, err
+			}
+			var oldest time.Time
+			for _, modTime := range archives {
+				if oldest.IsZero() || modTime.Before(oldest) {
+					oldest = modTime
+				}
+			}
+			entry.Records = int64(len(archives))
+			if !oldest.IsZero() {
+				entry.Oldest = oldest.UTC().Format(time.RFC3339)
+			}
+		}
+		for _, target := range retentionTargets[class.Name] {
+			records, oldest, err := s.countTarget(ctx, target)
+			if err != nil {
+				return nil, err
+			}
+			entry.Records += records
+			if oldest != "" && (entry.Oldest == "" || oldest < entry.Oldest) {
+				entry.Oldest = oldest
+			}
+		}
+		report = append(report, entry)
+	}
+	return report, nil
+}
+
+// countTarget returns the rows of target and the oldest one as RFC 3339
+func (s *PrivacyService) countTarget(ctx context.Context, target retentionTarget) (int64, string, error) {
+	db := s.db(target.server)
+	if db == nil {
+		return 0, "", nil
+	}
+	query := fmt.Sprintf("SELECT COUNT(*), MIN(%s) FROM %s", target.column, target.table)
+	if target.where != "" {
+		query += " WHERE " + target.where
+	}
+	var records int64
+	var oldest sql.NullString
+	if err := db.QueryRowContext(ctx, query).Scan(&records, &oldest); err != nil {
+		return 0, "", fmt.Errorf("%s: %w", target.table, err)
+	}
+	if !oldest.Valid {
+		return records, "", nil
+	}
+	return records, normalizeRetentionTime(oldest.String, target), nil
+}
+
+// normalizeRetentionTime formats a stored timestamp as RFC 3339 UTC so
+// the oldest records of different tables compare as strings
+func normalizeRetentionTime(value string, target retentionTarget) string {
+	if target.unix {
+		if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return time.Unix(secs, 0).UTC().Format(time.RFC3339)
+		}
+	}
+	layouts := []string{"2006-01-02T15", "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999Z07:00",
+		"2006-01-02 15:04:05.999999999 -0700 MST", time.RFC3339Nano, "2006-01-02 15:04:05"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+	return value
+}
+
+func (s *PrivacyService) sendMail(to, template string, vars map[string]string) error {
+	s.mu.RLock()
+	mailer := s.mailer
+	s.mu.RUnlock()
+	if mailer == nil {
+		return errors.New("email is not configured")
+	}
+	return mailer.SendTemplate(to, template, vars)
+}
+
+func (s *PrivacyService) auditLog(event EventType, actor Actor, userID int64, details map[string]interface{}) {
+	s.mu.RLock()
+	audit := s.audit
+	s.mu.RUnlock()
+	if audit == nil {
+		return
+	}
+
+	err := audit.Log(AuditEvent{
+		Event:    string(event),
+		Category: "privacy",
+		Severity: "info",
+		Actor:    actor,
+		Target:   &Target{Type: "user", ID: strconv.FormatInt(userID, 10)},
+		Details:  details,
+		Result:   "success",
+	})
+	if err != nil {
+		log.Printf("Privacy: audit log failed: %v", err)
+	}
+}
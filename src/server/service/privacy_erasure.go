@@ -0,0 +1,373 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/oklog/ulid/v2"
+)
+
+var (
+	// ErrAccountNotFound is returned when erasing an account that does not
+	// exist
+	ErrAccountNotFound = errors.New("account not found")
+	// ErrPasswordIncorrect is returned when a deletion request does not
+	// carry the account password
+	ErrPasswordIncorrect = errors.New("password is incorrect")
+	// ErrDeletionLinkInvalid is returned for unknown, expired or another
+	// account's deletion links
+	ErrDeletionLinkInvalid = errors.New("account deletion link is invalid or has expired")
+	// ErrDeletionMailFailed is returned when the confirmation email could
+	// not be sent
+	ErrDeletionMailFailed = errors.New("failed to send the confirmation email")
+)
+
+// erasedUserTables hold rows owned by a user through user_id. Most also
+// cascade, but SQLite only enforces foreign keys on connections that
+// enabled them
+var erasedUserTables = []string{
+	"user_sessions", "user_tokens", "user_saved_locations", "user_notifications",
+	"user_notification_preferences", "recovery_keys", "user_preferences",
+	"user_passkeys", "user_passkey_handles", "user_oidc_mappings", "user_ldap_mappings",
+	"user_email_verifications", "user_password_resets", "user_activity_log",
+	"user_login_state", "user_devices", "org_members", "user_data_exports",
+	"user_account_deletions",
+}
+
+// erasedOrgTables hold rows owned by an organization through org_id
+var erasedOrgTables = []string{
+	"org_saved_locations", "org_alert_subscriptions", "org_notification_channels",
+	"org_weather_alert_history", "org_tokens", "org_invites", "org_members",
+}
+
+// ErasureReceipt records what deleting an account removed. It holds no
+// personal data, so it can be kept and shown to the user.
+type ErasureReceipt struct {
+	ID       string    `json:"id"`
+	ErasedAt time.Time `json:"erased_at"`
+	// Rows deleted per table
+	Deleted map[string]int64 `json:"deleted"`
+	// Rows kept with the user's identity removed, per table
+	Anonymized map[string]int64 `json:"anonymized"`
+	// Organizations deleted because the user was their only member
+	Organizations []int64 `json:"organizations_deleted,omitempty"`
+}
+
+// RequestAccountDeletion checks the user's password and emails
+// account_deletion_confirm with a link that deletes the account. The link
+// expires after server.privacy.deletion_link_hours.
+func (s *PrivacyService) RequestAccountDeletion(user *models.User, password string, ctx LoginContext) (time.Time, error) {
+	var hash string
+	if err := s.usersDB.QueryRow("SELECT password_hash FROM user_accounts WHERE id = ?", user.ID).Scan(&hash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, ErrAccountNotFound
+		}
+		return time.Time{}, err
+	}
+	if ok, _ := models.VerifyPassword(password, hash); !ok {
+		return time.Time{}, ErrPasswordIncorrect
+	}
+	if _, err := s.orgsToErase(context.Background(), user.ID); err != nil {
+		return time.Time{}, err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Time{}, err
+	}
+	token := hex.EncodeToString(buf)
+	s.mu.RLock()
+	hours := s.deletionLinkHours
+	s.mu.RUnlock()
+	if hours <= 0 {
+		hours = 24
+	}
+	expires := s.now().UTC().Add(time.Duration(hours) * time.Hour)
+
+	err := database.WithTransaction(context.Background(), s.usersDB, func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM user_account_deletions WHERE user_id = ?", user.ID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`INSERT INTO user_account_deletions (user_id, token_hash, requested_at, expires_at, ip_address)
+			VALUES (?, ?, ?, ?, ?)`, user.ID, hashDeletionToken(token), s.now().UTC(), expires, ctx.IP)
+		return err
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to store deletion request: %w", err)
+	}
+
+	appURL := strings.TrimRight(ctx.AppURL, "/")
+	vars := map[string]string{
+		"recipient_username": user.Username,
+		"confirm_url":        appURL + "/users/settings/privacy?delete_token=" + token,
+		"expires":            expires.Format("2006-01-02 15:04 MST"),
+		"ip":                 ctx.IP,
+	}
+	if appURL != "" {
+		vars["app_url"] = appURL
+	}
+	if err := s.sendMail(user.Email, "account_deletion_confirm", vars); err != nil {
+		s.usersDB.Exec("DELETE FROM user_account_deletions WHERE user_id = ?", user.ID)
+		return time.Time{}, fmt.Errorf("%w: %v", ErrDeletionMailFailed, err)
+	}
+	return expires, nil
+}
+
+// PendingDeletion returns when the user's unconfirmed deletion link
+// expires, or nil when there is none
+func (s *PrivacyService) PendingDeletion(userID int64) (*time.Time, error) {
+	var expires time.Time
+	err := s.usersDB.QueryRow("SELECT expires_at FROM user_account_deletions WHERE user_id = ?", userID).Scan(&expires)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && !expires.After(s.now()) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &expires, nil
+}
+
+// CancelAccountDeletion invalidates the user's deletion link
+func (s *PrivacyService) CancelAccountDeletion(userID int64) error {
+	_, err := s.usersDB.Exec("DELETE FROM user_account_deletions WHERE user_id = ?", userID)
+	return err
+}
+
+// ConfirmAccountDeletion erases the account of userID when token is its
+// unexpired deletion link
+func (s *PrivacyService) ConfirmAccountDeletion(userID int64, token string, ctx LoginContext) (*ErasureReceipt, error) {
+	var owner int64
+	var expires time.Time
+	err := s.usersDB.QueryRow("SELECT user_id, expires_at FROM user_account_deletions WHERE token_hash = ?",
+		hashDeletionToken(token)).Scan(&owner, &expires)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && (owner != userID || !expires.After(s.now())) {
+		return nil, ErrDeletionLinkInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.EraseUser(context.Background(), userID, Actor{
+		Type:      "user",
+		ID:        strconv.FormatInt(userID, 10),
+		IP:        ctx.IP,
+		UserAgent: ctx.UserAgent,
+	})
+}
+
+func hashDeletionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// orgsToErase returns the organizations the user is the only member of.
+// It fails with models.ErrLastOrgOwner when the user is the last owner of
+// an organization with other members, which must get a new owner first.
+func (s *PrivacyService) orgsToErase(ctx context.Context, userID int64) ([]int64, error) {
+	rows, err := s.usersDB.QueryContext(ctx, `
+		SELECT m.org_id, m.role,
+			(SELECT COUNT(*) FROM org_members WHERE org_id = m.org_id),
+			(SELECT COUNT(*) FROM org_members WHERE org_id = m.org_id AND role = ?)
+		FROM org_members m WHERE m.user_id = ?`, models.OrgRoleOwner, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read organization memberships: %w", err)
+	}
+	defer rows.Close()
+	var orgs []int64
+	for rows.Next() {
+		var orgID int64
+		var role string
+		var members, owners int
+		if err := rows.Scan(&orgID, &role, &members, &owners); err != nil {
+			return nil, err
+		}
+		switch {
+		case members == 1:
+			orgs = append(orgs, orgID)
+		case role == models.OrgRoleOwner && owners == 1:
+			return nil, fmt.Errorf("%w: organization %d has other members", models.ErrLastOrgOwner, orgID)
+		}
+	}
+	return orgs, rows.Err()
+}
+
+// EraseUser deletes an account and everything it owns from both
+// databases, anonymizes its audit log entries and deletes its exports.
+// Records in the hash-chained audit log files cannot be edited; they only
+// hold the numeric user ID and age out with the audit_archives retention.
+func (s *PrivacyService) EraseUser(ctx context.Context, userID int64, actor Actor) (*ErasureReceipt, error) {
+	var username, email string
+	var notificationEmail sql.NullString
+	err := s.usersDB.QueryRowContext(ctx, "SELECT username, email, notification_email FROM user_accounts WHERE id = ?", userID).
+		Scan(&username, &email, &notificationEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	orgs, err := s.orgsToErase(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := &ErasureReceipt{
+		ID:            ulid.Make().String(),
+		ErasedAt:      s.now().UTC(),
+		Deleted:       make(map[string]int64),
+		Anonymized:    make(map[string]int64),
+		Organizations: orgs,
+	}
+	id := strconv.FormatInt(userID, 10)
+	emails := []string{strings.ToLower(email)}
+	if notificationEmail.Valid && notificationEmail.String != "" {
+		emails = append(emails, strings.ToLower(notificationEmail.String))
+	}
+
+	// Server database first: if the account deletion below fails, running
+	// the erasure again repeats these harmlessly
+	if s.serverDB != nil {
+		err := database.WithTransaction(ctx, s.serverDB, func(tx *sql.Tx) error {
+			type step struct {
+				table     string
+				anonymize bool
+				query     string
+				args      []interface{}
+			}
+			steps := []step{
+				{"server_audit_log", true, `UPDATE server_audit_log SET actor_id = 'erased', ip_address = NULL, user_agent = NULL, details = NULL
+					WHERE actor_type = 'user' AND actor_id = ?`, []interface{}{id}},
+				{"server_audit_log", true, `UPDATE server_audit_log SET resource_id = 'erased'
+					WHERE resource_type = 'user' AND resource_id = ?`, []interface{}{id}},
+				{"notification_queue", false, "DELETE FROM notification_queue WHERE user_id = ?", []interface{}{userID}},
+				{"notification_history", false, "DELETE FROM notification_history WHERE user_id = ?", []interface{}{userID}},
+			}
+			for _, address := range emails {
+				steps = append(steps, step{"contact_submissions", false, "DELETE FROM contact_submissions WHERE LOWER(email) = ?", []interface{}{address}})
+			}
+			for _, step := range steps {
+				result, err := tx.ExecContext(ctx, step.query, step.args...)
+				if err != nil {
+					return fmt.Errorf("failed to erase %s: %w", step.table, err)
+				}
+				n, _ := result.RowsAffected()
+				if step.anonymize {
+					receipt.Anonymized[step.table] += n
+				} else {
+					receipt.Deleted[step.table] += n
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.deleteExports(ctx, "user_id = ?", userID); err != nil {
+		return nil, fmt.Errorf("failed to delete data exports: %w", err)
+	}
+
+	err = database.WithTransaction(ctx, s.usersDB, func(tx *sql.Tx) error {
+		del := func(table, query string, args ...interface{}) error {
+			result, err := tx.ExecContext(ctx, query, args...)
+			if err != nil {
+				return fmt.Errorf("failed to erase %s: %w", table, err)
+			}
+			n, _ := result.RowsAffected()
+			receipt.Deleted[table] += n
+			return nil
+		}
+
+		for _, orgID := range orgs {
+			if err := del("org_token_usage", "DELETE FROM org_token_usage WHERE token_id IN (SELECT id FROM org_tokens WHERE org_id = ?)", orgID); err != nil {
+				return err
+			}
+			for _, table := range erasedOrgTables {
+				if err := del(table, "DELETE FROM "+table+" WHERE org_id = ?", orgID); err != nil {
+					return err
+				}
+			}
+			if err := del("org_accounts", "DELETE FROM org_accounts WHERE id = ?", orgID); err != nil {
+				return err
+			}
+		}
+
+		if err := del("user_weather_alerts", "DELETE FROM user_weather_alerts WHERE location_id IN (SELECT id FROM user_saved_locations WHERE user_id = ?)", userID); err != nil {
+			return err
+		}
+		if err := del("user_token_usage", "DELETE FROM user_token_usage WHERE token_id IN (SELECT id FROM user_tokens WHERE user_id = ?)", userID); err != nil {
+			return err
+		}
+		for _, table := range erasedUserTables {
+			if err := del(table, "DELETE FROM "+table+" WHERE user_id = ?", userID); err != nil {
+				return err
+			}
+		}
+		for _, address := range emails {
+			// Invites sent to the user's address
+			if err := del("org_invites", "DELETE FROM org_invites WHERE invite_id IN (SELECT id FROM user_invites WHERE LOWER(email) = ?)", address); err != nil {
+				return err
+			}
+			if err := del("user_invites", "DELETE FROM user_invites WHERE LOWER(email) = ?", address); err != nil {
+				return err
+			}
+		}
+
+		// Keep what the user created for others, without the link to them
+		for _, column := range []struct{ table, column string }{
+			{"user_invites", "invited_by"},
+			{"user_invites", "used_by"},
+			{"org_invites", "invited_by"},
+			{"org_accounts", "created_by"},
+		} {
+			result, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET %s = NULL WHERE %s = ?", column.table, column.column, column.column), userID)
+			if err != nil {
+				return fmt.Errorf("failed to anonymize %s: %w", column.table, err)
+			}
+			n, _ := result.RowsAffected()
+			receipt.Anonymized[column.table] += n
+		}
+
+		return del("user_accounts", "DELETE FROM user_accounts WHERE id = ?", userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for table, n := range receipt.Deleted {
+		if n == 0 {
+			delete(receipt.Deleted, table)
+		}
+	}
+	for table, n := range receipt.Anonymized {
+		if n == 0 {
+			delete(receipt.Anonymized, table)
+		}
+	}
+
+	s.auditLog(EventUserAccountDelete, actor, userID, map[string]interface{}{
+		"receipt_id":            receipt.ID,
+		"deleted":               receipt.Deleted,
+		"anonymized":            receipt.Anonymized,
+		"organizations_deleted": len(receipt.Organizations),
+	})
+
+	vars := map[string]string{
+		"recipient_username": username,
+		"receipt_id":         receipt.ID,
+	}
+	if err := s.sendMail(email, "account_deleted", vars); err != nil {
+		log.Printf("Failed to send account_deleted for receipt %s: %v", receipt.ID, err)
+	}
+	return receipt, nil
+}
@@ -0,0 +1,464 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/oklog/ulid/v2"
+)
+
+// Data export states
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// An export still running after this long was interrupted by a restart
+const staleExportAge = time.Hour
+
+// ErrExportNotFound is returned for exports that do not exist, belong to
+// another user or are not ready
+var ErrExportNotFound = errors.New("data export not found")
+
+// DataExport is one "download my data" job
+type DataExport struct {
+	ID          string     `json:"id"`
+	UserID      int64      `json:"-"`
+	Status      string     `json:"status"`
+	FileSize    int64      `json:"file_size"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// When the archive is deleted; empty when it is kept forever
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// exportOmitColumns are secrets that never leave the server, even to the
+// user they belong to
+var exportOmitColumns = map[string]bool{
+	"password_hash":      true,
+	"two_factor_secret":  true,
+	"recovery_keys_hash": true,
+	"token_hash":         true,
+	"key_hash":           true,
+	"public_key":         true,
+	"data":               true,
+	"token":              true,
+}
+
+// RequestExport starts building an archive of everything the server knows
+// about user and emails data_export_ready when it is done. An export
+// already in progress is returned instead of starting another; a new export
+// replaces the user's previous archive.
+func (s *PrivacyService) RequestExport(user *models.User, ctx LoginContext) (*DataExport, error) {
+	if latest, err := s.LatestExport(user.ID); err == nil && (latest.Status == ExportPending || latest.Status == ExportRunning) {
+		return latest, nil
+	} else if err != nil && !errors.Is(err, ErrExportNotFound) {
+		return nil, err
+	}
+
+	if err := s.deleteExports(context.Background(), "user_id = ?", user.ID); err != nil {
+		return nil, err
+	}
+	export := &DataExport{
+		ID:        strings.ToLower(ulid.Make().String()),
+		UserID:    user.ID,
+		Status:    ExportPending,
+		CreatedAt: s.now().UTC(),
+	}
+	if _, err := s.usersDB.Exec(`INSERT INTO user_data_exports (id, user_id, status, created_at) VALUES (?, ?, ?, ?)`,
+		export.ID, export.UserID, export.Status, export.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to create data export: %w", err)
+	}
+	s.setExpiry(export)
+
+	s.auditLog(EventUserDataExport, Actor{Type: "user", ID: strconv.FormatInt(user.ID, 10), IP: ctx.IP, UserAgent: ctx.UserAgent},
+		user.ID, map[string]interface{}{"export_id": export.ID})
+
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		s.runExport(export, user, ctx)
+	}()
+	return export, nil
+}
+
+// runExport writes the archive and records the outcome
+func (s *PrivacyService) runExport(export *DataExport, user *models.User, ctx LoginContext) {
+	s.usersDB.Exec("UPDATE user_data_exports SET status = ? WHERE id = ?", ExportRunning, export.ID)
+
+	size, err := s.writeExport(context.Background(), export)
+	completed := s.now().UTC()
+	if err != nil {
+		log.Printf("Data export %s for user %d failed: %v", export.ID, user.ID, err)
+		s.usersDB.Exec("UPDATE user_data_exports SET status = ?, error = ?, completed_at = ? WHERE id = ?",
+			ExportFailed, err.Error(), completed, export.ID)
+		return
+	}
+	if _, err := s.usersDB.Exec("UPDATE user_data_exports SET status = ?, file_size = ?, completed_at = ? WHERE id = ?",
+		ExportReady, size, completed, export.ID); err != nil {
+		log.Printf("Data export %s for user %d: %v", export.ID, user.ID, err)
+		return
+	}
+
+	if user.Email == "" {
+		return
+	}
+	vars := map[string]string{
+		"recipient_username": user.Username,
+		"file_size":          fmt.Sprintf("%.1f KiB", float64(size)/1024),
+		"expires":            "never",
+	}
+	if export.ExpiresAt != nil {
+		vars["expires"] = export.ExpiresAt.Format("2006-01-02 15:04 MST")
+	}
+	if ctx.AppURL != "" {
+		vars["app_url"] = strings.TrimRight(ctx.AppURL, "/")
+	}
+	if err := s.sendMail(user.Email, "data_export_ready", vars); err != nil {
+		log.Printf("Failed to send data_export_ready to user %d: %v", user.ID, err)
+	}
+}
+
+// ExportPath returns the archive file of an export
+func (s *PrivacyService) ExportPath(id string) string {
+	return filepath.Join(s.exportDir, id+".zip")
+}
+
+// LatestExport returns the user's most recent export
+func (s *PrivacyService) LatestExport(userID int64) (*DataExport, error) {
+	row := s.usersDB.QueryRow(`SELECT id, user_id, status, file_size, error, created_at, completed_at
+		FROM user_data_exports WHERE user_id = ? ORDER BY created_at DESC LIMIT 1`, userID)
+	return s.scanExport(row)
+}
+
+// ReadyExport returns the user's export with id when its archive can be
+// downloaded
+func (s *PrivacyService) ReadyExport(userID int64, id string) (*DataExport, error) {
+	row := s.usersDB.QueryRow(`SELECT id, user_id, status, file_size, error, created_at, completed_at
+		FROM user_data_exports WHERE id = ? AND user_id = ?`, id, userID)
+	export, err := s.scanExport(row)
+	if err != nil {
+		return nil, err
+	}
+	if export.Status != ExportReady {
+		return nil, ErrExportNotFound
+	}
+	if _, err := os.Stat(s.ExportPath(export.ID)); err != nil {
+		return nil, ErrExportNotFound
+	}
+	return export, nil
+}
+
+func (s *PrivacyService) scanExport(row *sql.Row) (*DataExport, error) {
+	var export DataExport
+	var exportErr sql.NullString
+	var completed sql.NullTime
+	if err := row.Scan(&export.ID, &export.UserID, &export.Status, &export.FileSize, &exportErr, &export.CreatedAt, &completed); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+	export.Error = exportErr.String
+	if completed.Valid {
+		export.CompletedAt = &completed.Time
+	}
+	s.setExpiry(&export)
+	return &export, nil
+}
+
+// setExpiry sets when the data_exports retention deletes the export
+func (s *PrivacyService) setExpiry(export *DataExport) {
+	if days := s.RetentionDays(RetentionDataExports); days >= 0 {
+		expires := export.CreatedAt.AddDate(0, 0, days)
+		export.ExpiresAt = &expires
+	}
+}
+
+// deleteExports deletes the export rows matching where and their archives
+func (s *PrivacyService) deleteExports(ctx context.Context, where string, args ...interface{}) error {
+	rows, err := s.usersDB.QueryContext(ctx, "SELECT id FROM user_data_exports WHERE "+where, args...)
+	if err != nil {
+		return fmt.Errorf("failed to list data exports: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := os.Remove(s.ExportPath(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if _, err := s.usersDB.ExecContext(ctx, "DELETE FROM user_data_exports WHERE id = ?", id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneExports deletes exports created before cutoff, and archives left
+// behind without a row
+func (s *PrivacyService) pruneExports(ctx context.Context, cutoff time.Time) (int64, error) {
+	var before int64
+	s.usersDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_data_exports WHERE created_at < ?", cutoff.UTC()).Scan(&before)
+	if err := s.deleteExports(ctx, "created_at < ?", cutoff.UTC()); err != nil {
+		return 0, err
+	}
+
+	entries, err := os.ReadDir(s.exportDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return before, nil
+		}
+		return before, err
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".zip")
+		if !ok {
+			continue
+		}
+		var exists int
+		if err := s.usersDB.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_data_exports WHERE id = ?", id).Scan(&exists); err != nil {
+			return before, err
+		}
+		if exists == 0 {
+			os.Remove(filepath.Join(s.exportDir, entry.Name()))
+		}
+	}
+	return before, nil
+}
+
+// failStaleExports marks exports interrupted by a restart as failed
+func (s *PrivacyService) failStaleExports(ctx context.Context) error {
+	_, err := s.usersDB.ExecContext(ctx, `UPDATE user_data_exports SET status = ?, error = 'interrupted', completed_at = ?
+		WHERE status IN (?, ?) AND created_at < ?`,
+		ExportFailed, s.now().UTC(), ExportPending, ExportRunning, s.now().Add(-staleExportAge).UTC())
+	return err
+}
+
+// exportSection is one JSON file in the archive
+type exportSection struct {
+	name    string
+	collect func(ctx context.Context, userID int64) (map[string]interface{}, error)
+}
+
+// writeExport writes the archive of export and returns its size
+func (s *PrivacyService) writeExport(ctx context.Context, export *DataExport) (int64, error) {
+	if err := os.MkdirAll(s.exportDir, 0700); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(s.exportDir, "."+export.ID+"-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	sections := []exportSection{
+		{"profile.json", s.exportProfile},
+		{"locations.json", s.exportLocations},
+		{"notifications.json", s.exportNotifications},
+		{"tokens.json", s.exportTokens},
+		{"activity.json", s.exportActivity},
+		{"organizations.json", s.exportOrganizations},
+	}
+	zw := zip.NewWriter(tmp)
+	for _, section := range sections {
+		data, err := section.collect(ctx, export.UserID)
+		if err != nil {
+			tmp.Close()
+			return 0, fmt.Errorf("%s: %w", section.name, err)
+		}
+		w, err := zw.Create(section.name)
+		if err == nil {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(data)
+		}
+		if err != nil {
+			tmp.Close()
+			return 0, err
+		}
+	}
+	if w, err := zw.Create("README.txt"); err == nil {
+		fmt.Fprintf(w, exportReadme, export.UserID, s.now().UTC().Format(time.RFC3339))
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), s.ExportPath(export.ID)); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+const exportReadme = `Personal data export
+
+Account ID: %d
+Created:    %s
+
+profile.json        account, profile, preferences and linked identities
+locations.json      saved locations and the weather alerts sent for them
+notifications.json  in-app notifications and notification deliveries
+tokens.json         API tokens (names, scopes and usage; never the token)
+activity.json       activity log, sessions and devices
+organizations.json  organization memberships
+
+Passwords, 2FA secrets, recovery keys and token values are stored only as
+hashes and are not included.
+`
+
+func (s *PrivacyService) exportProfile(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	return s.collectRows(ctx, map[string]rowQuery{
+		"account":                  {query: "SELECT * FROM user_accounts WHERE id = ?", one: true},
+		"preferences":              {query: "SELECT * FROM user_preferences WHERE user_id = ?", one: true},
+		"notification_preferences": {query: "SELECT * FROM user_notification_preferences WHERE user_id = ?", one: true},
+		"passkeys":                 {query: "SELECT id, name, aaguid, transport, created_at, last_used_at FROM user_passkeys WHERE user_id = ?"},
+		"oidc_identities":          {query: "SELECT * FROM user_oidc_mappings WHERE user_id = ?"},
+		"ldap_identities":          {query: "SELECT * FROM user_ldap_mappings WHERE user_id = ?"},
+	}, userID)
+}
+
+func (s *PrivacyService) exportLocations(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	return s.collectRows(ctx, map[string]rowQuery{
+		"locations": {query: "SELECT * FROM user_saved_locations WHERE user_id = ? ORDER BY id"},
+		"weather_alerts": {query: `SELECT a.* FROM user_weather_alerts a
+			JOIN user_saved_locations l ON a.location_id = l.id WHERE l.user_id = ? ORDER BY a.id`},
+	}, userID)
+}
+
+func (s *PrivacyService) exportNotifications(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	return s.collectRows(ctx, map[string]rowQuery{
+		"notifications": {query: "SELECT * FROM user_notifications WHERE user_id = ? ORDER BY created_at"},
+		"delivery_queue": {server: true, query: `SELECT id, channel_type, state, subject, body, created_at, delivered_at, failed_at
+			FROM notification_queue WHERE user_id = ? ORDER BY id`},
+		"delivery_history": {server: true, query: `SELECT id, channel_type, status, subject, body, delivered_at, created_at
+			FROM notification_history WHERE user_id = ? ORDER BY id`},
+	}, userID)
+}
+
+func (s *PrivacyService) exportTokens(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	return s.collectRows(ctx, map[string]rowQuery{
+		"tokens": {query: "SELECT * FROM user_tokens WHERE user_id = ? ORDER BY id"},
+		"usage": {query: `SELECT u.token_id, u.hour, u.route, u.requests, u.errors FROM user_token_usage u
+			JOIN user_tokens t ON u.token_id = t.id WHERE t.user_id = ? ORDER BY u.hour, u.token_id, u.route`},
+	}, userID)
+}
+
+func (s *PrivacyService) exportActivity(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	return s.collectRows(ctx, map[string]rowQuery{
+		"activity":    {query: "SELECT * FROM user_activity_log WHERE user_id = ? ORDER BY created_at"},
+		"sessions":    {query: "SELECT created_at, expires_at, ip_address, user_agent FROM user_sessions WHERE user_id = ? ORDER BY created_at"},
+		"devices":     {query: "SELECT * FROM user_devices WHERE user_id = ? ORDER BY first_seen_at"},
+		"login_state": {query: "SELECT * FROM user_login_state WHERE user_id = ?", one: true},
+	}, userID)
+}
+
+func (s *PrivacyService) exportOrganizations(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	return s.collectRows(ctx, map[string]rowQuery{
+		"memberships": {query: `SELECT o.id AS org_id, o.slug, o.name, m.role, m.on_call, m.joined_at
+			FROM org_members m JOIN org_accounts o ON m.org_id = o.id WHERE m.user_id = ? ORDER BY o.id`},
+	}, userID)
+}
+
+// rowQuery selects the rows of one key in an export section
+type rowQuery struct {
+	server bool
+	query  string
+	// A single object instead of a list
+	one bool
+}
+
+// collectRows runs each query with userID and returns the rows by key
+func (s *PrivacyService) collectRows(ctx context.Context, queries map[string]rowQuery, userID int64) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(queries))
+	for key, q := range queries {
+		db := s.db(q.server)
+		if db == nil {
+			continue
+		}
+		rows, err := queryRowMaps(ctx, db, q.query, userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		switch {
+		case !q.one:
+			result[key] = rows
+		case len(rows) > 0:
+			result[key] = rows[0]
+		default:
+			result[key] = nil
+		}
+	}
+	return result, nil
+}
+
+// queryRowMaps returns rows as column name to value maps, without the
+// columns in exportOmitColumns
+func queryRowMaps(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if exportOmitColumns[column] {
+				continue
+			}
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,369 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/model"
+)
+
+func setupPrivacy(t *testing.T) (*PrivacyService, *fakeAccountMailer, *models.User) {
+	t.Helper()
+	dir := t.TempDir()
+	open := func(name string) *sql.DB {
+		db, err := sql.Open("sqlite", filepath.Join(dir, name+".db")+"?_pragma=busy_timeout(5000)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := database.MigrateDatabase(db, database.DialectSQLite, name, nil); err != nil {
+			t.Fatalf("Failed to migrate %s database: %v", name, err)
+		}
+		return db
+	}
+	usersDB, serverDB := open(database.MigrationsUsers), open(database.MigrationsServer)
+
+	hash, err := models.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO user_accounts (id, username, email, password_hash, two_factor_secret) VALUES (1, 'jane', 'jane@example.org', '` + hash + `', 'TOTPSECRET')`,
+		`INSERT INTO user_accounts (id, username, email, password_hash) VALUES (2, 'john', 'john@example.org', 'x')`,
+		`INSERT INTO user_saved_locations (id, user_id, name, latitude, longitude) VALUES (10, 1, 'Home', 52.52, 13.40), (20, 2, 'Office', 40.71, -74.0)`,
+		`INSERT INTO user_weather_alerts (location_id, alert_type, severity, title, message) VALUES (10, 'storm', 'warning', 'Storm', 'Storm ahead'), (20, 'heat', 'info', 'Heat', 'Hot')`,
+		`INSERT INTO user_tokens (id, user_id, token_hash, token_prefix, name) VALUES (5, 1, 'secrethash', 'usr_abcd', 'cli'), (6, 2, 'otherhash', 'usr_efgh', 'cli')`,
+		`INSERT INTO user_token_usage (token_id, hour, route, requests) VALUES (5, '2026-03-01T10', '/api/v1/weather', 3), (6, '2026-03-01T10', '/api/v1/weather', 1)`,
+		`INSERT INTO user_activity_log (user_id, activity_type, ip_address) VALUES (1, 'login', '203.0.113.10'), (2, 'login', '203.0.113.20')`,
+		`INSERT INTO user_sessions (id, user_id, data, expires_at) VALUES ('sess-jane', 1, 'secret', '2099-01-01 00:00:00')`,
+	} {
+		if _, err := usersDB.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	for _, stmt := range []string{
+		`INSERT INTO server_audit_log (ulid, actor_type, actor_id, action, ip_address, user_agent, details) VALUES ('a1', 'user', '1', 'user.login', '203.0.113.10', 'Firefox', 'jane logged in'), ('a2', 'user', '2', 'user.login', '203.0.113.20', 'Chrome', 'john logged in')`,
+		`INSERT INTO server_audit_log (ulid, actor_type, actor_id, action, resource_type, resource_id) VALUES ('a3', 'admin', 'root', 'user.update', 'user', '1')`,
+		`INSERT INTO notification_history (user_id, channel_type, status, subject) VALUES (1, 'email', 'delivered', 'Storm ahead'), (2, 'email', 'delivered', 'Heat')`,
+		`INSERT INTO contact_submissions (name, email, subject, message) VALUES ('Jane', 'Jane@Example.org', 'Hi', 'Hello'), ('John', 'john@example.org', 'Hi', 'Hello')`,
+	} {
+		if _, err := serverDB.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+
+	mailer := &fakeAccountMailer{sent: make(chan sentMail, 10)}
+	s := NewPrivacyService(usersDB, serverDB, filepath.Join(dir, "exports"))
+	s.SetMailer(mailer)
+	return s, mailer, &models.User{ID: 1, Username: "jane", Email: "jane@example.org"}
+}
+
+func countRows(t *testing.T, db *sql.DB, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestRetentionDays(t *testing.T) {
+	s, _, _ := setupPrivacy(t)
+
+	if days := s.RetentionDays(RetentionActivity); days != 365 {
+		t.Errorf("activity default = %d, want 365", days)
+	}
+	if days := s.RetentionDays(RetentionSessions); days != -1 {
+		t.Errorf("sessions = %d, want -1", days)
+	}
+	if _, err := s.serverDB.Exec(`INSERT INTO server_config (key, value) VALUES ('audit.retention_days', '30')`); err != nil {
+		t.Fatal(err)
+	}
+	if days := s.RetentionDays(RetentionAuditLog); days != 30 {
+		t.Errorf("audit_log with audit.retention_days = %d, want 30", days)
+	}
+
+	err := s.SetPolicy(RetentionPolicy{RetentionAuditLog: 400, RetentionActivity: -1, RetentionSessions: 5, "bogus": 1}, 0)
+	if err == nil || !strings.Contains(err.Error(), "bogus") || !strings.Contains(err.Error(), "sessions") {
+		t.Errorf("SetPolicy error = %v, want unknown bogus and sessions", err)
+	}
+	if days := s.RetentionDays(RetentionAuditLog); days != 400 {
+		t.Errorf("configured audit_log = %d, want 400", days)
+	}
+	if days := s.RetentionDays(RetentionActivity); days != -1 {
+		t.Errorf("activity kept forever = %d, want -1", days)
+	}
+	if days := s.RetentionDays(RetentionSessions); days != -1 {
+		t.Errorf("fixed sessions class = %d, want -1", days)
+	}
+}
+
+func TestEnforceRetention(t *testing.T) {
+	s, _, _ := setupPrivacy(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	old := now.AddDate(0, 0, -100)
+
+	if _, err := s.usersDB.Exec(`INSERT INTO user_activity_log (user_id, activity_type, created_at) VALUES (1, 'old', ?)`, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.usersDB.Exec(`INSERT INTO user_token_usage (token_id, hour, route, requests) VALUES (5, ?, '/old', 1)`, old.Format("2006-01-02T15")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.serverDB.Exec(`INSERT INTO server_audit_log (ulid, action, timestamp) VALUES ('old', 'old', ?)`, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.serverDB.Exec(`INSERT INTO contact_submissions (name, email, subject, message, created_at) VALUES ('Old', 'old@example.org', 'Hi', 'Hi', ?)`, old.Unix()); err != nil {
+		t.Fatal(err)
+	}
+	s.SetPolicy(RetentionPolicy{RetentionActivity: 90, RetentionContactSubmissions: -1}, 0)
+
+	removed, err := s.EnforceRetention(context.Background())
+	if err != nil {
+		t.Fatalf("EnforceRetention: %v", err)
+	}
+	want := map[string]int64{RetentionActivity: 1, RetentionAuditLog: 1, RetentionTokenUsage: 1}
+	for class, n := range want {
+		if removed[class] != n {
+			t.Errorf("removed[%s] = %d, want %d (all: %v)", class, removed[class], n, removed)
+		}
+	}
+	if _, ok := removed[RetentionContactSubmissions]; ok {
+		t.Error("contact submissions kept forever were removed")
+	}
+	if n := countRows(t, s.usersDB, "SELECT COUNT(*) FROM user_activity_log"); n != 2 {
+		t.Errorf("activity rows = %d, want the 2 recent ones", n)
+	}
+	if n := countRows(t, s.serverDB, "SELECT COUNT(*) FROM contact_submissions"); n != 3 {
+		t.Errorf("contact submissions = %d, want 3", n)
+	}
+}
+
+func TestRetentionReport(t *testing.T) {
+	s, _, _ := setupPrivacy(t)
+	if _, err := s.serverDB.Exec(`UPDATE contact_submissions SET created_at = 1767225600`); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.RetentionReport(context.Background())
+	if err != nil {
+		t.Fatalf("RetentionReport: %v", err)
+	}
+	if len(report) != len(RetentionClasses) {
+		t.Fatalf("report has %d classes, want %d", len(report), len(RetentionClasses))
+	}
+	byName := make(map[string]RetentionReportEntry)
+	for _, entry := range report {
+		byName[entry.Name] = entry
+	}
+	if e := byName[RetentionAccounts]; e.Records != 2 || e.Period != "until the account is deleted" {
+		t.Errorf("accounts = %+v", e)
+	}
+	if e := byName[RetentionAuditLog]; e.Records != 3 || e.Days != 90 || e.Period != "90 days" {
+		t.Errorf("audit_log = %+v", e)
+	}
+	if e := byName[RetentionContactSubmissions]; e.Records != 2 || e.Oldest != "2026-01-01T00:00:00Z" {
+		t.Errorf("contact_submissions = %+v", e)
+	}
+	if e := byName[RetentionNotificationDelivery]; e.Records != 2 {
+		t.Errorf("notification_delivery = %+v", e)
+	}
+}
+
+func TestDataExport(t *testing.T) {
+	s, mailer, user := setupPrivacy(t)
+
+	export, err := s.RequestExport(user, LoginContext{AppURL: "https://wthr.top/"})
+	if err != nil {
+		t.Fatalf("RequestExport: %v", err)
+	}
+	s.jobs.Wait()
+
+	mail := mailer.next(t)
+	if mail.template != "data_export_ready" || mail.to != user.Email || mail.vars["app_url"] != "https://wthr.top" {
+		t.Errorf("mail = %+v", mail)
+	}
+	ready, err := s.ReadyExport(user.ID, export.ID)
+	if err != nil {
+		t.Fatalf("ReadyExport: %v", err)
+	}
+	if ready.ExpiresAt == nil || ready.FileSize == 0 {
+		t.Errorf("export = %+v", ready)
+	}
+	if _, err := s.ReadyExport(2, export.ID); !errors.Is(err, ErrExportNotFound) {
+		t.Errorf("another user's export: err = %v", err)
+	}
+
+	zr, err := zip.OpenReader(s.ExportPath(export.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	for _, name := range []string{"profile.json", "locations.json", "notifications.json", "tokens.json", "activity.json", "organizations.json", "README.txt"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("archive lacks %s", name)
+		}
+	}
+	all := strings.Join([]string{files["profile.json"], files["tokens.json"], files["activity.json"]}, "")
+	for _, secret := range []string{"password_hash", "TOTPSECRET", "secrethash", "sess-jane"} {
+		if strings.Contains(all, secret) {
+			t.Errorf("archive contains %s", secret)
+		}
+	}
+
+	var locations struct {
+		Locations []map[string]interface{} `json:"locations"`
+		Alerts    []map[string]interface{} `json:"weather_alerts"`
+	}
+	if err := json.Unmarshal([]byte(files["locations.json"]), &locations); err != nil {
+		t.Fatal(err)
+	}
+	if len(locations.Locations) != 1 || locations.Locations[0]["name"] != "Home" || len(locations.Alerts) != 1 {
+		t.Errorf("locations.json = %s", files["locations.json"])
+	}
+	if !strings.Contains(files["notifications.json"], "Storm ahead") || strings.Contains(files["notifications.json"], "Heat") {
+		t.Errorf("notifications.json = %s", files["notifications.json"])
+	}
+
+	// A new export replaces the previous archive
+	second, err := s.RequestExport(user, LoginContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.jobs.Wait()
+	mailer.next(t)
+	if _, err := s.ReadyExport(user.ID, export.ID); !errors.Is(err, ErrExportNotFound) {
+		t.Errorf("previous export still available: %v", err)
+	}
+	if latest, err := s.LatestExport(user.ID); err != nil || latest.ID != second.ID {
+		t.Errorf("LatestExport = %+v, %v", latest, err)
+	}
+}
+
+func TestAccountDeletion(t *testing.T) {
+	s, mailer, user := setupPrivacy(t)
+	ctx := LoginContext{IP: "203.0.113.10", AppURL: "https://wthr.top"}
+
+	if _, err := s.RequestAccountDeletion(user, "wrong", ctx); !errors.Is(err, ErrPasswordIncorrect) {
+		t.Fatalf("wrong password: err = %v", err)
+	}
+	mailer.none(t)
+
+	if _, err := s.RequestAccountDeletion(user, "correct horse battery", ctx); err != nil {
+		t.Fatalf("RequestAccountDeletion: %v", err)
+	}
+	mail := mailer.next(t)
+	if mail.template != "account_deletion_confirm" || mail.to != user.Email {
+		t.Fatalf("mail = %+v", mail)
+	}
+	link, err := url.Parse(mail.vars["confirm_url"])
+	if err != nil || link.Path != "/users/settings/privacy" {
+		t.Fatalf("confirm_url = %q", mail.vars["confirm_url"])
+	}
+	token := link.Query().Get("delete_token")
+	if pending, _ := s.PendingDeletion(user.ID); pending == nil {
+		t.Error("no pending deletion after request")
+	}
+
+	if _, err := s.ConfirmAccountDeletion(2, token, ctx); !errors.Is(err, ErrDeletionLinkInvalid) {
+		t.Errorf("another user's link: err = %v", err)
+	}
+	if _, err := s.ConfirmAccountDeletion(user.ID, "bogus", ctx); !errors.Is(err, ErrDeletionLinkInvalid) {
+		t.Errorf("bogus link: err = %v", err)
+	}
+
+	receipt, err := s.ConfirmAccountDeletion(user.ID, token, ctx)
+	if err != nil {
+		t.Fatalf("ConfirmAccountDeletion: %v", err)
+	}
+	if receipt.ID == "" || receipt.Deleted["user_accounts"] != 1 || receipt.Anonymized["server_audit_log"] != 2 {
+		t.Errorf("receipt = %+v", receipt)
+	}
+	if mail := mailer.next(t); mail.template != "account_deleted" || mail.vars["receipt_id"] != receipt.ID {
+		t.Errorf("mail = %+v", mail)
+	}
+
+	for _, check := range []struct {
+		db    *sql.DB
+		query string
+		want  int
+	}{
+		{s.usersDB, "SELECT COUNT(*) FROM user_accounts", 1},
+		{s.usersDB, "SELECT COUNT(*) FROM user_saved_locations", 1},
+		{s.usersDB, "SELECT COUNT(*) FROM user_weather_alerts", 1},
+		{s.usersDB, "SELECT COUNT(*) FROM user_token_usage", 1},
+		{s.usersDB, "SELECT COUNT(*) FROM user_activity_log", 1},
+		{s.usersDB, "SELECT COUNT(*) FROM user_sessions", 0},
+		{s.usersDB, "SELECT COUNT(*) FROM user_account_deletions", 0},
+		{s.serverDB, "SELECT COUNT(*) FROM notification_history", 1},
+		{s.serverDB, "SELECT COUNT(*) FROM contact_submissions", 1},
+		{s.serverDB, "SELECT COUNT(*) FROM server_audit_log", 3},
+		{s.serverDB, "SELECT COUNT(*) FROM server_audit_log WHERE actor_id = '1' OR resource_id = '1' OR ip_address = '203.0.113.10'", 0},
+		{s.serverDB, "SELECT COUNT(*) FROM server_audit_log WHERE actor_id = '2' AND ip_address = '203.0.113.20'", 1},
+	} {
+		if n := countRows(t, check.db, check.query); n != check.want {
+			t.Errorf("%s = %d, want %d", check.query, n, check.want)
+		}
+	}
+}
+
+func TestEraseUserOrganizations(t *testing.T) {
+	s, _, _ := setupPrivacy(t)
+	for _, stmt := range []string{
+		`INSERT INTO org_accounts (id, slug, name, created_by) VALUES (1, 'solo', 'Solo', 1), (2, 'shared', 'Shared', 1)`,
+		`INSERT INTO org_members (org_id, user_id, role) VALUES (1, 1, 'owner'), (2, 1, 'owner'), (2, 2, 'viewer')`,
+		`INSERT INTO org_saved_locations (org_id, name, latitude, longitude) VALUES (1, 'HQ', 1, 1)`,
+	} {
+		if _, err := s.usersDB.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	admin := Actor{Type: "admin", ID: "root"}
+
+	if _, err := s.EraseUser(context.Background(), 1, admin); !errors.Is(err, models.ErrLastOrgOwner) {
+		t.Fatalf("last owner of a shared org: err = %v", err)
+	}
+	if n := countRows(t, s.usersDB, "SELECT COUNT(*) FROM user_accounts WHERE id = 1"); n != 1 {
+		t.Fatal("account erased despite the error")
+	}
+
+	if _, err := s.usersDB.Exec(`UPDATE org_members SET role = 'owner' WHERE org_id = 2 AND user_id = 2`); err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := s.EraseUser(context.Background(), 1, admin)
+	if err != nil {
+		t.Fatalf("EraseUser: %v", err)
+	}
+	if len(receipt.Organizations) != 1 || receipt.Organizations[0] != 1 {
+		t.Errorf("organizations deleted = %v, want [1]", receipt.Organizations)
+	}
+	if n := countRows(t, s.usersDB, "SELECT COUNT(*) FROM org_saved_locations"); n != 0 {
+		t.Errorf("org locations of the deleted org = %d", n)
+	}
+	if n := countRows(t, s.usersDB, "SELECT COUNT(*) FROM org_accounts WHERE id = 2 AND created_by IS NULL"); n != 1 {
+		t.Error("shared org was not kept without its creator")
+	}
+	if _, err := s.EraseUser(context.Background(), 1, admin); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("erasing again: err = %v", err)
+	}
+}
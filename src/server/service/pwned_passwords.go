@@ -0,0 +1,318 @@
+package service
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PwnedPasswordManifestFile describes the imported dataset
+const PwnedPasswordManifestFile = "manifest.json"
+
+// ErrPasswordBreached is returned when a new password appears in the
+// breached password dataset
+var ErrPasswordBreached = errors.New("This password has appeared in a data breach. Please choose a different password")
+
+// PwnedPasswordService checks passwords against a local copy of the Have I
+// Been Pwned password hashes. The dataset is stored by the first five hex
+// characters of the SHA-1 hash, the same k-anonymity ranges the HIBP range
+// API serves, so a check reads one small file and nothing leaves the server.
+type PwnedPasswordService struct {
+	dir      string
+	mu       sync.RWMutex
+	manifest *PwnedPasswordManifest
+}
+
+// PwnedPasswordManifest records where and when the dataset was imported
+type PwnedPasswordManifest struct {
+	ImportedAt time.Time `json:"imported_at"`
+	Source     string    `json:"source"`
+	Hashes     int64     `json:"hashes"`
+	Ranges     int       `json:"ranges"`
+}
+
+// NewPwnedPasswordService opens the dataset in dir. The service works
+// without a dataset; every check then reports the password as not found.
+func NewPwnedPasswordService(dir string) *PwnedPasswordService {
+	s := &PwnedPasswordService{dir: dir}
+	s.manifest, _ = readPwnedManifest(dir)
+	return s
+}
+
+// Dir returns the dataset directory
+func (s *PwnedPasswordService) Dir() string {
+	return s.dir
+}
+
+// Manifest returns the imported dataset's manifest, or nil when no dataset
+// has been imported
+func (s *PwnedPasswordService) Manifest() *PwnedPasswordManifest {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.manifest
+}
+
+// Available reports whether a dataset has been imported
+func (s *PwnedPasswordService) Available() bool {
+	return s.Manifest() != nil
+}
+
+// Count returns how many times the password appears in the dataset, 0 when
+// it does not or no dataset is installed
+func (s *PwnedPasswordService) Count(password string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.manifest == nil {
+		return 0, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return lookupPwnedRange(pwnedRangePath(s.dir, hash[:5]), hash[5:])
+}
+
+// Import replaces the dataset. source is either a directory of range files
+// named by prefix ("21BD1" or "21BD1.txt", lines "SUFFIX:COUNT"), as written
+// by the HIBP PwnedPasswordsDownloader, or a single file of "SHA1:COUNT"
+// lines. The current dataset keeps serving checks until the import is done.
+func (s *PwnedPasswordService) Import(source string) (*PwnedPasswordManifest, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+
+	staging := s.dir + ".import"
+	if err := os.RemoveAll(staging); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return nil, err
+	}
+
+	manifest := &PwnedPasswordManifest{Source: source}
+	if info.IsDir() {
+		err = importPwnedRanges(source, staging, manifest)
+	} else {
+		err = importPwnedHashFile(source, staging, manifest)
+	}
+	if err == nil && manifest.Hashes == 0 {
+		err = fmt.Errorf("no password hashes found in %s", source)
+	}
+	if err != nil {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+
+	manifest.ImportedAt = time.Now().UTC()
+	data, _ := json.MarshalIndent(manifest, "", "  ")
+	if err := os.WriteFile(filepath.Join(staging, PwnedPasswordManifestFile), data, 0644); err != nil {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.dir + ".old"
+	os.RemoveAll(previous)
+	if err := os.Rename(s.dir, previous); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+	if err := os.Rename(staging, s.dir); err != nil {
+		return nil, err
+	}
+	os.RemoveAll(previous)
+	s.manifest = manifest
+	return manifest, nil
+}
+
+func readPwnedManifest(dir string) (*PwnedPasswordManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, PwnedPasswordManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	var manifest PwnedPasswordManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// Ranges are spread over 4096 directories by their first three characters
+func pwnedRangePath(dir, prefix string) string {
+	return filepath.Join(dir, prefix[:3], prefix)
+}
+
+func lookupPwnedRange(path, suffix string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) > 35 && line[35] == ':' && line[:35] == suffix {
+			count, _ := strconv.Atoi(line[36:])
+			return max(count, 1), nil
+		}
+	}
+	return 0, scanner.Err()
+}
+
+func isHex(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789ABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePwnedLine splits "HASH:COUNT" (or a bare hash) and checks the hash
+// has the expected length
+func parsePwnedLine(line string, hashLen int) (string, int, bool) {
+	hash, countText, _ := strings.Cut(strings.TrimSpace(line), ":")
+	hash = strings.ToUpper(hash)
+	if len(hash) != hashLen || !isHex(hash) {
+		return "", 0, false
+	}
+	count := 1
+	if countText != "" {
+		n, err := strconv.Atoi(countText)
+		if err != nil || n < 1 {
+			return "", 0, false
+		}
+		count = n
+	}
+	return hash, count, true
+}
+
+type pwnedRangeWriter struct {
+	dir    string
+	prefix string
+	file   *os.File
+	w      *bufio.Writer
+	seen   map[string]bool
+}
+
+func (rw *pwnedRangeWriter) write(prefix, suffix string, count int) error {
+	if prefix != rw.prefix {
+		if err := rw.close(); err != nil {
+			return err
+		}
+		path := pwnedRangePath(rw.dir, prefix)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		rw.prefix, rw.file, rw.w = prefix, file, bufio.NewWriter(file)
+		rw.seen[prefix] = true
+	}
+	_, err := fmt.Fprintf(rw.w, "%s:%d\n", suffix, count)
+	return err
+}
+
+func (rw *pwnedRangeWriter) close() error {
+	if rw.file == nil {
+		return nil
+	}
+	err := rw.w.Flush()
+	if cerr := rw.file.Close(); err == nil {
+		err = cerr
+	}
+	rw.prefix, rw.file, rw.w = "", nil, nil
+	return err
+}
+
+func importPwnedHashFile(source, dest string, manifest *PwnedPasswordManifest) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rw := &pwnedRangeWriter{dir: dest, seen: make(map[string]bool)}
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		hash, count, ok := parsePwnedLine(scanner.Text(), 40)
+		if !ok {
+			rw.close()
+			return fmt.Errorf("%s:%d: expected SHA1:COUNT", source, lineNo)
+		}
+		if err := rw.write(hash[:5], hash[5:], count); err != nil {
+			rw.close()
+			return err
+		}
+		manifest.Hashes++
+	}
+	if err := rw.close(); err != nil {
+		return err
+	}
+	manifest.Ranges = len(rw.seen)
+	return scanner.Err()
+}
+
+func importPwnedRanges(source, dest string, manifest *PwnedPasswordManifest) error {
+	rw := &pwnedRangeWriter{dir: dest, seen: make(map[string]bool)}
+	err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		prefix := strings.ToUpper(strings.TrimSuffix(d.Name(), ".txt"))
+		if len(prefix) != 5 || !isHex(prefix) {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		lineNo := 0
+		for scanner.Scan() {
+			lineNo++
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			suffix, count, ok := parsePwnedLine(scanner.Text(), 35)
+			if !ok {
+				return fmt.Errorf("%s:%d: expected SUFFIX:COUNT", path, lineNo)
+			}
+			if err := rw.write(prefix, suffix, count); err != nil {
+				return err
+			}
+			manifest.Hashes++
+		}
+		return scanner.Err()
+	})
+	if cerr := rw.close(); err == nil {
+		err = cerr
+	}
+	manifest.Ranges = len(rw.seen)
+	return err
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func pwnedHash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestPwnedPasswordsWithoutDataset(t *testing.T) {
+	pwned := NewPwnedPasswordService(filepath.Join(t.TempDir(), "pwned"))
+	if pwned.Available() {
+		t.Fatal("Expected no dataset")
+	}
+	count, err := pwned.Count("password")
+	if err != nil || count != 0 {
+		t.Fatalf("Count without dataset = %d, %v; want 0", count, err)
+	}
+}
+
+func TestPwnedPasswordsImport(t *testing.T) {
+	breached := map[string]int{"password": 9545824, "123456": 37359195, "letmein": 1}
+	source := t.TempDir()
+
+	hashFile := filepath.Join(source, "hashes.txt")
+	var lines []string
+	for password, count := range breached {
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToLower(pwnedHash(password)), count))
+	}
+	if err := os.WriteFile(hashFile, []byte(strings.Join(lines, "\r\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rangeDir := filepath.Join(source, "ranges")
+	if err := os.MkdirAll(rangeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for password, count := range breached {
+		hash := pwnedHash(password)
+		line := fmt.Sprintf("%s:%d\n", hash[5:], count)
+		if err := os.WriteFile(filepath.Join(rangeDir, hash[:5]+".txt"), []byte(line), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(rangeDir, "README.md"), []byte("not a range"), 0644)
+
+	for name, path := range map[string]string{"hash file": hashFile, "range directory": rangeDir} {
+		t.Run(name, func(t *testing.T) {
+			pwned := NewPwnedPasswordService(filepath.Join(t.TempDir(), "pwned"))
+			manifest, err := pwned.Import(path)
+			if err != nil {
+				t.Fatalf("Import: %v", err)
+			}
+			if manifest.Hashes != int64(len(breached)) || manifest.Ranges != len(breached) {
+				t.Errorf("Manifest = %+v, want %d hashes in %d ranges", manifest, len(breached), len(breached))
+			}
+
+			for password, want := range breached {
+				if got, err := pwned.Count(password); err != nil || got != want {
+					t.Errorf("Count(%q) = %d, %v; want %d", password, got, err, want)
+				}
+			}
+			if got, err := pwned.Count("correct horse battery staple 42"); err != nil || got != 0 {
+				t.Errorf("Count(unbreached) = %d, %v; want 0", got, err)
+			}
+
+			// The manifest survives a restart
+			if reopened := NewPwnedPasswordService(pwned.Dir()); !reopened.Available() {
+				t.Error("Expected the imported dataset to be found on reopen")
+			}
+		})
+	}
+}
+
+func TestPwnedPasswordsImportRejectsBadInput(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "bad.txt")
+	if err := os.WriteFile(source, []byte("not-a-hash:12\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pwned := NewPwnedPasswordService(filepath.Join(t.TempDir(), "pwned"))
+	if _, err := pwned.Import(source); err == nil {
+		t.Fatal("Expected an invalid line to fail the import")
+	}
+	if pwned.Available() {
+		t.Error("A failed import must not install a dataset")
+	}
+}
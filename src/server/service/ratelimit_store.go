@@ -0,0 +1,211 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+// Rate limit store backends (server.yml rate_limit.store)
+const (
+	RateLimitStoreAuto     = "auto"
+	RateLimitStoreMemory   = "memory"
+	RateLimitStoreRedis    = "redis"
+	RateLimitStoreDatabase = "database"
+)
+
+// RateLimitResult is the outcome of counting a request against a limit
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Allowed: time until the current window ends.
+	// Rejected: time until a request of the same cost would be allowed.
+	Reset time.Duration
+}
+
+// RateLimitStore counts requests in a sliding window. The window is
+// approximated from two fixed windows: the previous window's count is
+// weighted by how much of it still overlaps the sliding window.
+type RateLimitStore interface {
+	// Name returns the backend name
+	Name() string
+	// Take counts cost requests against key when the sliding window has
+	// room for them. Rejected requests are not counted.
+	Take(key string, cost, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// RateLimitStoreOptions selects and configures the rate limit store
+type RateLimitStoreOptions struct {
+	// auto, memory, redis or database
+	Backend string
+	// Redis/Valkey connection; used when enabled
+	Cache *CacheManager
+	// Database and its dialect for the database backend
+	DB      *sql.DB
+	Dialect database.Dialect
+}
+
+// NewRateLimitStore creates the configured rate limit store
+func NewRateLimitStore(opts RateLimitStoreOptions) (RateLimitStore, error) {
+	redisAvailable := opts.Cache != nil && opts.Cache.IsEnabled()
+	backend, err := SelectRateLimitStoreBackend(opts.Backend, redisAvailable)
+	if err != nil {
+		return nil, err
+	}
+
+	switch backend {
+	case RateLimitStoreRedis:
+		return NewRedisRateLimitStore(opts.Cache.Client()), nil
+	case RateLimitStoreDatabase:
+		if opts.DB == nil {
+			return nil, fmt.Errorf("rate limit database store requires a database")
+		}
+		return NewDatabaseRateLimitStore(opts.DB, opts.Dialect)
+	default:
+		return NewMemoryRateLimitStore(), nil
+	}
+}
+
+// SelectRateLimitStoreBackend resolves "auto" to a concrete backend: Redis
+// when a cache connection is available, otherwise in-process memory
+func SelectRateLimitStoreBackend(backend string, redisAvailable bool) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(backend)) {
+	case "", RateLimitStoreAuto:
+		if redisAvailable {
+			return RateLimitStoreRedis, nil
+		}
+		return RateLimitStoreMemory, nil
+	case RateLimitStoreRedis:
+		if !redisAvailable {
+			return "", fmt.Errorf("rate limit store redis requires the cache (CACHE_ENABLED) to be connected")
+		}
+		return RateLimitStoreRedis, nil
+	case RateLimitStoreDatabase:
+		return RateLimitStoreDatabase, nil
+	case RateLimitStoreMemory:
+		return RateLimitStoreMemory, nil
+	default:
+		return "", fmt.Errorf("unknown rate limit store %q (valid: auto, memory, redis, database)", backend)
+	}
+}
+
+// slidingWindow locates now within fixed windows of the given length. It
+// returns the start of the current window and the weight of the previous
+// window's count.
+func slidingWindow(now time.Time, window time.Duration) (time.Time, float64) {
+	start := now.Truncate(window)
+	elapsed := now.Sub(start)
+	return start, 1 - float64(elapsed)/float64(window)
+}
+
+// evaluateSlidingWindow decides whether cost more requests fit, given the
+// previous and current window counts before this request
+func evaluateSlidingWindow(prev, curr, cost, limit int, weight float64, window time.Duration) RateLimitResult {
+	estimate := float64(prev)*weight + float64(curr)
+	untilEnd := time.Duration(weight * float64(window))
+	result := RateLimitResult{Limit: limit}
+
+	if estimate+float64(cost) <= float64(limit) {
+		result.Allowed = true
+		result.Remaining = int(math.Floor(float64(limit) - estimate - float64(cost)))
+		result.Reset = untilEnd
+		return result
+	}
+
+	result.Remaining = int(math.Max(0, math.Floor(float64(limit)-estimate)))
+	room := float64(limit - curr - cost)
+	switch {
+	case room >= 0 && prev > 0:
+		// Wait until enough of the previous window has slid out
+		needed := 1 - room/float64(prev)
+		result.Reset = time.Duration((needed - (1 - weight)) * float64(window))
+	default:
+		// The current window alone is full: wait for the next one, where
+		// this window's count starts to slide out
+		next := 1.0
+		if curr > 0 {
+			next = math.Min(1, math.Max(0, 1-float64(limit-cost)/float64(curr)))
+		}
+		result.Reset = untilEnd + time.Duration(next*float64(window))
+	}
+	// Whole seconds, ignoring floating point noise
+	seconds := math.Ceil(result.Reset.Round(time.Millisecond).Seconds())
+	result.Reset = time.Duration(math.Max(1, seconds)) * time.Second
+	return result
+}
+
+// How often the memory store drops windows that ended
+const memoryRateLimitSweep = time.Minute
+
+// MemoryRateLimitStore keeps counters in this process only
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	windows   map[string]*memoryRateLimitWindow
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryRateLimitWindow struct {
+	start  time.Time
+	length time.Duration
+	prev   int
+	curr   int
+}
+
+// NewMemoryRateLimitStore creates an in-process store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		windows: make(map[string]*memoryRateLimitWindow),
+		now:     time.Now,
+	}
+}
+
+// Name implements RateLimitStore
+func (s *MemoryRateLimitStore) Name() string {
+	return RateLimitStoreMemory
+}
+
+// Take implements RateLimitStore
+func (s *MemoryRateLimitStore) Take(key string, cost, limit int, window time.Duration) (RateLimitResult, error) {
+	now := s.now()
+	start, weight := slidingWindow(now, window)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > memoryRateLimitSweep {
+		for k, w := range s.windows {
+			if now.Sub(w.start) > 2*w.length {
+				delete(s.windows, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	w, ok := s.windows[key]
+	if !ok || w.length != window {
+		w = &memoryRateLimitWindow{start: start, length: window}
+		s.windows[key] = w
+	}
+	switch {
+	case w.start.Equal(start):
+	case w.start.Add(window).Equal(start):
+		w.prev, w.curr = w.curr, 0
+		w.start = start
+	default:
+		w.prev, w.curr = 0, 0
+		w.start = start
+	}
+
+	result := evaluateSlidingWindow(w.prev, w.curr, cost, limit, weight, window)
+	if result.Allowed {
+		w.curr += cost
+	}
+	return result, nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+)
+
+// rateLimitUpsert counts requests in the window of a key
+const rateLimitUpsert = `
+	INSERT INTO server_rate_limits (identifier, endpoint, count, window_start)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(identifier, endpoint, window_start) DO UPDATE SET
+		count = server_rate_limits.count + excluded.count`
+
+// rateLimitCountQuery reads the count of one window of a key
+const rateLimitCountQuery = `
+	SELECT count FROM server_rate_limits
+	WHERE identifier = ? AND endpoint = ? AND window_start = ?`
+
+// DatabaseRateLimitStore keeps counters in the server_rate_limits table, one
+// row per key and fixed window. Nodes sharing the database share counters.
+type DatabaseRateLimitStore struct {
+	DB      *sql.DB
+	Dialect database.Dialect
+}
+
+// NewDatabaseRateLimitStore checks the table the server migrations create.
+// db is a connection of the database package in dialect; queries are SQLite
+// flavoured and translated by the connection on PostgreSQL and MySQL (see
+// database.NewDialectDriver)
+func NewDatabaseRateLimitStore(db *sql.DB, dialect database.Dialect) (*DatabaseRateLimitStore, error) {
+	s := &DatabaseRateLimitStore{DB: db, Dialect: dialect}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM server_rate_limits WHERE 1 = 0").Scan(&n); err != nil {
+		return nil, fmt.Errorf("rate limit table is not available: %w", err)
+	}
+	return s, nil
+}
+
+// Name implements RateLimitStore
+func (s *DatabaseRateLimitStore) Name() string {
+	return RateLimitStoreDatabase
+}
+
+// Take implements RateLimitStore. The request is counted first so the row
+// lock serializes concurrent requests for the same key, and rolled back when
+// it does not fit.
+func (s *DatabaseRateLimitStore) Take(key string, cost, limit int, window time.Duration) (RateLimitResult, error) {
+	start, weight := slidingWindow(time.Now(), window)
+	endpoint := window.String()
+	currStart, prevStart := s.windowValue(start), s.windowValue(start.Add(-window))
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(rateLimitUpsert, key, endpoint, cost, currStart); err != nil {
+		return RateLimitResult{}, err
+	}
+
+	var curr, prev int
+	if err := tx.QueryRow(rateLimitCountQuery, key, endpoint, currStart).Scan(&curr); err != nil {
+		return RateLimitResult{}, err
+	}
+	if err := tx.QueryRow(rateLimitCountQuery, key, endpoint, prevStart).Scan(&prev); err != nil && err != sql.ErrNoRows {
+		return RateLimitResult{}, err
+	}
+
+	result := evaluateSlidingWindow(prev, curr-cost, cost, limit, weight, window)
+	if !result.Allowed {
+		return result, nil
+	}
+	return result, tx.Commit()
+}
+
+// windowValue formats a window start for the window_start column. SQLite
+// gets the text form datetime() produces so cleanup queries can compare it.
+func (s *DatabaseRateLimitStore) windowValue(start time.Time) interface{} {
+	if s.Dialect == database.DialectSQLite {
+		return start.UTC().Format("2006-01-02 15:04:05")
+	}
+	return start.UTC()
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Prefix of rate limit counter keys
+const redisRateLimitPrefix = "weather:ratelimit:"
+
+// redisRateLimitScript counts a request in the current window when the
+// weighted previous window plus the current window leaves room for it. It
+// returns {allowed, previous count, current count before this request}.
+var redisRateLimitScript = redis.NewScript(`
+local prev = tonumber(redis.call("GET", KEYS[1]) or "0")
+local curr = tonumber(redis.call("GET", KEYS[2]) or "0")
+local cost = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local weight = tonumber(ARGV[3])
+if prev * weight + curr + cost > limit then
+	return {0, prev, curr}
+end
+redis.call("INCRBY", KEYS[2], cost)
+redis.call("PEXPIRE", KEYS[2], ARGV[4])
+return {1, prev, curr}
+`)
+
+// RedisRateLimitStore keeps counters in Redis/Valkey so every node shares
+// them
+type RedisRateLimitStore struct {
+	client *redis.Client
+}
+
+// NewRedisRateLimitStore creates a store on an existing Redis client
+func NewRedisRateLimitStore(client *redis.Client) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client}
+}
+
+// Name implements RateLimitStore
+func (s *RedisRateLimitStore) Name() string {
+	return RateLimitStoreRedis
+}
+
+// Take implements RateLimitStore
+func (s *RedisRateLimitStore) Take(key string, cost, limit int, window time.Duration) (RateLimitResult, error) {
+	start, weight := slidingWindow(time.Now(), window)
+	keys := []string{
+		fmt.Sprintf("%s%s:%d", redisRateLimitPrefix, key, start.Add(-window).UnixMilli()),
+		fmt.Sprintf("%s%s:%d", redisRateLimitPrefix, key, start.UnixMilli()),
+	}
+	// Keep the current window until it has fully slid out of the next one
+	ttl := (2 * window).Milliseconds()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	values, err := redisRateLimitScript.Run(ctx, s.client, keys,
+		cost, limit, strconv.FormatFloat(weight, 'f', -1, 64), ttl).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	if len(values) != 3 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit script result %v", values)
+	}
+
+	result := evaluateSlidingWindow(int(values[1]), int(values[2]), cost, limit, weight, window)
+	// The script's decision is authoritative; the two only differ by
+	// floating point rounding at the exact limit
+	result.Allowed = values[0] == 1
+	return result, nil
+}
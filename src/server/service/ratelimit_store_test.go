@@ -0,0 +1,186 @@
+package service
+
+import (
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+
+	"modernc.org/sqlite"
+)
+
+func TestSelectRateLimitStoreBackend(t *testing.T) {
+	tests := []struct {
+		backend string
+		redis   bool
+		want    string
+		wantErr bool
+	}{
+		{"auto", true, RateLimitStoreRedis, false},
+		{"", false, RateLimitStoreMemory, false},
+		{"redis", false, "", true},
+		{"database", true, RateLimitStoreDatabase, false},
+		{"Memory", true, RateLimitStoreMemory, false},
+		{"memcached", false, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := SelectRateLimitStoreBackend(tt.backend, tt.redis)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SelectRateLimitStoreBackend(%q) error = %v, wantErr %v", tt.backend, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("SelectRateLimitStoreBackend(%q) = %q, want %q", tt.backend, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateSlidingWindow(t *testing.T) {
+	// Halfway through the window, 10 of the previous window's 20 requests
+	// still count
+	result := evaluateSlidingWindow(20, 5, 1, 20, 0.5, time.Minute)
+	if !result.Allowed || result.Remaining != 4 || result.Reset != 30*time.Second {
+		t.Errorf("allowed result = %+v", result)
+	}
+
+	// 10 + 9 leaves room for one request, not a cost of 5
+	result = evaluateSlidingWindow(20, 9, 5, 20, 0.5, time.Minute)
+	if result.Allowed || result.Remaining != 1 {
+		t.Errorf("rejected result = %+v", result)
+	}
+	// Allowed once 4 more of the previous requests slide out: 12s
+	if result.Reset != 12*time.Second {
+		t.Errorf("reset = %v, want 12s", result.Reset)
+	}
+
+	// A full current window waits for the next one
+	result = evaluateSlidingWindow(0, 20, 1, 20, 0.5, time.Minute)
+	if result.Allowed || result.Reset < 30*time.Second {
+		t.Errorf("full window result = %+v", result)
+	}
+}
+
+func TestMemoryRateLimitStore_SlidingWindow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	for i := 0; i < 10; i++ {
+		if result, _ := store.Take("ip:192.0.2.1", 1, 10, time.Minute); !result.Allowed {
+			t.Fatalf("request %d rejected", i+1)
+		}
+	}
+	if result, _ := store.Take("ip:192.0.2.1", 1, 10, time.Minute); result.Allowed {
+		t.Fatal("request over the limit allowed")
+	}
+	if result, _ := store.Take("ip:192.0.2.2", 1, 10, time.Minute); !result.Allowed {
+		t.Fatal("other key rejected")
+	}
+
+	// A quarter into the next window, 7.5 of the previous 10 still count
+	now = now.Add(75 * time.Second)
+	if result, _ := store.Take("ip:192.0.2.1", 2, 10, time.Minute); !result.Allowed {
+		t.Fatal("request within the sliding window rejected")
+	}
+	if result, _ := store.Take("ip:192.0.2.1", 1, 10, time.Minute); result.Allowed {
+		t.Fatal("request over the sliding window allowed")
+	}
+
+	// Two windows later nothing counts
+	now = now.Add(2 * time.Minute)
+	if result, _ := store.Take("ip:192.0.2.1", 10, 10, time.Minute); !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("result after idle windows = %+v", result)
+	}
+}
+
+// SQLite wrapped in the PostgreSQL translation of the database package, so
+// the PostgreSQL path of the store runs without a server: placeholders
+// become $n and window starts are bound as times
+var registerTranslatedSQLite sync.Once
+
+func TestDatabaseRateLimitStore(t *testing.T) {
+	db, err := sql.Open("sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	testDatabaseRateLimitStore(t, db, database.DialectSQLite)
+}
+
+func TestDatabaseRateLimitStore_Postgres(t *testing.T) {
+	registerTranslatedSQLite.Do(func() {
+		sql.Register("ratelimit-postgres-sqlite", database.NewDialectDriver(database.DialectPostgres, &sqlite.Driver{}))
+	})
+	db, err := sql.Open("ratelimit-postgres-sqlite", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	store := testDatabaseRateLimitStore(t, db, database.DialectPostgres)
+
+	// window_start is TIMESTAMPTZ on PostgreSQL
+	if _, ok := store.windowValue(time.Now()).(time.Time); !ok {
+		t.Error("PostgreSQL window starts are not bound as times")
+	}
+}
+
+func TestDatabaseRateLimitStore_MySQLQueries(t *testing.T) {
+	for _, query := range []string{rateLimitUpsert, rateLimitCountQuery} {
+		if _, err := database.DialectMySQL.Translate(query); err != nil {
+			t.Errorf("MySQL cannot run %s: %v", query, err)
+		}
+	}
+	upsert, _ := database.DialectMySQL.Translate(rateLimitUpsert)
+	if !strings.Contains(upsert, "ON DUPLICATE KEY UPDATE") || strings.Contains(upsert, "ON CONFLICT") {
+		t.Errorf("MySQL upsert = %s", upsert)
+	}
+}
+
+func testDatabaseRateLimitStore(t *testing.T, db *sql.DB, dialect database.Dialect) *DatabaseRateLimitStore {
+	t.Helper()
+	if _, err := NewDatabaseRateLimitStore(db, dialect); err == nil {
+		t.Error("Expected a database without the server schema to be refused")
+	}
+	if err := database.ApplySchema(db, dialect, database.ServerSchema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	store, err := NewDatabaseRateLimitStore(db, dialect)
+	if err != nil {
+		t.Fatalf("NewDatabaseRateLimitStore failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		result, err := store.Take("login:192.0.2.1", 1, 3, time.Hour)
+		if err != nil {
+			t.Fatalf("Take failed: %v", err)
+		}
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("request %d: %+v", i+1, result)
+		}
+	}
+	result, err := store.Take("login:192.0.2.1", 1, 3, time.Hour)
+	if err != nil {
+		t.Fatalf("Take failed: %v", err)
+	}
+	if result.Allowed || result.Reset <= 0 {
+		t.Fatalf("request over the limit: %+v", result)
+	}
+
+	// The rejected request was rolled back
+	var count int
+	if err := db.QueryRow("SELECT SUM(count) FROM server_rate_limits WHERE identifier = ?", "login:192.0.2.1").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("stored count = %d, want 3", count)
+	}
+	return store
+}
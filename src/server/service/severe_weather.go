@@ -3,12 +3,16 @@ package service
 import (
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/apimgr/weather/src/server/model"
 )
 
 // SevereWeatherService handles all types of severe weather tracking
@@ -17,6 +21,9 @@ type SevereWeatherService struct {
 	cacheMutex sync.RWMutex
 	cacheTime  time.Time
 	cacheTTL   time.Duration
+	// National alert services by the country countryFromCoordinates
+	// returns
+	alertSources map[string]func() ([]Alert, error)
 }
 
 // SevereWeatherData represents all severe weather information
@@ -56,15 +63,32 @@ type Alert struct {
 	Parameters    map[string]interface{} `json:"parameters"`
 	Geometry      interface{}            `json:"geometry,omitempty"`
 	DistanceMiles float64                `json:"distanceMiles,omitempty"`
+	// Country code of the national service that issued the alert
+	Country       string                 `json:"country,omitempty"`
 }
 
 // NewSevereWeatherService creates a new severe weather service
 func NewSevereWeatherService() *SevereWeatherService {
 	// Cache for 5 minutes
-	return &SevereWeatherService{
+	s := &SevereWeatherService{
 		cache:    make(map[string]*SevereWeatherData),
 		cacheTTL: 5 * time.Minute,
 	}
+	s.alertSources = map[string]func() ([]Alert, error){
+		// National Weather Service
+		"US": s.fetchNWSAlerts,
+		// Environment Canada
+		"CA": s.fetchEnvironmentCanadaAlerts,
+		// Met Office
+		"GB": s.fetchMetOfficeAlerts,
+		// Bureau of Meteorology
+		"AU": s.fetchAustraliaAlerts,
+		// JMA (Japan Meteorological Agency)
+		"JP": s.fetchJapanAlerts,
+		// CONAGUA (National Water Commission)
+		"MX": s.fetchMexicoAlerts,
+	}
+	return s
 }
 
 // GetSevereWeather fetches all severe weather data with default 50-mile filter
@@ -96,52 +120,11 @@ func (s *SevereWeatherService) GetSevereWeatherWithDistance(latitude, longitude,
 	// Fetch alerts based on location
 	alerts := []Alert{}
 
-	// Determine country based on coordinates
-	countryCode := s.getCountryFromCoordinates(latitude, longitude)
-
-	switch countryCode {
-	case "US":
-		// US: National Weather Service
-		nwsAlerts, err := s.fetchNWSAlerts()
-		if err == nil {
-			alerts = append(alerts, nwsAlerts...)
-		}
-	case "CA":
-		// Canada: Environment Canada alerts
-		caAlerts, err := s.fetchEnvironmentCanadaAlerts()
-		if err == nil {
-			alerts = append(alerts, caAlerts...)
-		}
-	case "GB", "UK":
-		// UK: Met Office alerts
-		ukAlerts, err := s.fetchMetOfficeAlerts()
-		if err == nil {
-			alerts = append(alerts, ukAlerts...)
-		}
-	case "AU":
-		// Australia: Bureau of Meteorology
-		auAlerts, err := s.fetchAustraliaAlerts()
-		if err == nil {
-			alerts = append(alerts, auAlerts...)
-		}
-	case "JP":
-		// Japan: JMA (Japan Meteorological Agency)
-		jpAlerts, err := s.fetchJapanAlerts()
-		if err == nil {
-			alerts = append(alerts, jpAlerts...)
-		}
-	case "MX":
-		// Mexico: CONAGUA (National Water Commission)
-		mxAlerts, err := s.fetchMexicoAlerts()
-		if err == nil {
-			alerts = append(alerts, mxAlerts...)
-		}
-	default:
-		// For other countries, fetch from US NWS (might have some global coverage)
-		nwsAlerts, err := s.fetchNWSAlerts()
-		if err == nil {
-			alerts = append(alerts, nwsAlerts...)
-		}
+	// Determine country based on coordinates; other countries get the US
+	// NWS (might have some global coverage)
+	countryCode := countryFromCoordinates(latitude, longitude)
+	if regional, err := s.fetchAlerts(countryCode); err == nil {
+		alerts = append(alerts, regional...)
 	}
 
 	// Filter by location if coordinates provided
@@ -199,6 +182,60 @@ func (s *SevereWeatherService) GetSevereWeatherWithDistance(latitude, longitude,
 	return data, nil
 }
 
+// AlertsForLocations returns the current alerts for a set of locations, such
+// as the saved locations of users with alerts enabled. The national service
+// covering the locations of each country is fetched once, and its alerts
+// are kept when AlertNearLocation matches one of the locations. Alerts
+// fetched before a service failed are returned with the error
+func (s *SevereWeatherService) AlertsForLocations(locations []*models.SavedLocation, maxMiles float64) ([]Alert, error) {
+	byCountry := make(map[string][]*models.SavedLocation)
+	for _, location := range locations {
+		country := countryFromCoordinates(location.Latitude, location.Longitude)
+		byCountry[country] = append(byCountry[country], location)
+	}
+	countries := make([]string, 0, len(byCountry))
+	for country := range byCountry {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+
+	alerts := []Alert{}
+	var errs []error
+	for _, country := range countries {
+		regional, err := s.fetchAlerts(country)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s alerts: %w", country, err))
+			continue
+		}
+		for _, alert := range regional {
+			for _, location := range byCountry[country] {
+				if AlertNearLocation(alert, location.Latitude, location.Longitude, maxMiles) {
+					alerts = append(alerts, alert)
+					break
+				}
+			}
+		}
+	}
+	return alerts, errors.Join(errs...)
+}
+
+// fetchAlerts fetches the alerts of a country's national service, falling
+// back to the US NWS, and records the country on each
+func (s *SevereWeatherService) fetchAlerts(country string) ([]Alert, error) {
+	fetch, ok := s.alertSources[country]
+	if !ok {
+		country, fetch = "US", s.alertSources["US"]
+	}
+	alerts, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	for i := range alerts {
+		alerts[i].Country = country
+	}
+	return alerts, nil
+}
+
 // fetchNOAAStorms fetches storm data from NOAA API
 func (s *SevereWeatherService) fetchNOAAStorms(url string) ([]Storm, error) {
 	client := &http.Client{Timeout: 10 * time.Second}
@@ -385,6 +422,17 @@ func (s *SevereWeatherService) filterAlertsByDistance(alerts []Alert, lat, lon,
 	return filtered
 }
 
+// AlertNearLocation checks if an alert applies to a location: its geometry
+// is within maxMiles of it or, for services that name areas instead of
+// giving a geometry, it was issued for the location's country. NWS alerts
+// without a geometry are zone-based and match no location
+func AlertNearLocation(alert Alert, lat, lon, maxMiles float64) bool {
+	if alert.Geometry == nil {
+		return alert.Country != "" && alert.Country != "US" && alert.Country == countryFromCoordinates(lat, lon)
+	}
+	return isAlertNearLocation(alert.Geometry, lat, lon, maxMiles)
+}
+
 // isAlertNearLocation checks if alert geometry is within maxMiles of location
 func isAlertNearLocation(geometry interface{}, lat, lon, maxMiles float64) bool {
 	// Parse geometry (can be Point, Polygon, or MultiPolygon)
@@ -574,8 +622,8 @@ func (s *SevereWeatherService) GetAlertIcon(event string) string {
 	}
 }
 
-// getCountryFromCoordinates determines country code from coordinates (simplified)
-func (s *SevereWeatherService) getCountryFromCoordinates(lat, lon float64) string {
+// countryFromCoordinates determines country code from coordinates (simplified)
+func countryFromCoordinates(lat, lon float64) string {
 	// If no coordinates, default to US
 	if lat == 0 && lon == 0 {
 		return "US"
@@ -11,7 +11,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/apimgr/weather/src/config"
 	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/email"
 	"github.com/apimgr/weather/src/utils"
 )
 
@@ -272,6 +274,51 @@ func (s *SMTPService) TestConnection(config *SMTPConfig) error {
 
 // SendEmail sends an email
 func (s *SMTPService) SendEmail(to, subject, body string) error {
+	return s.send(to, subject, body, "text/html; charset=UTF-8")
+}
+
+// SendTemplate renders a plain text email template (custom
+// {config_dir}/template/email/{name}.txt first, then the built-in one) and
+// sends it. app_name, app_url, fqdn, admin_email and recipient_email are
+// filled in unless vars sets them.
+func (s *SMTPService) SendTemplate(to, name string, vars map[string]string) error {
+	tmpl, err := email.LoadTemplate(name)
+	if err != nil {
+		return err
+	}
+
+	if vars == nil {
+		vars = make(map[string]string)
+	}
+	cfg := config.GetGlobalConfig()
+	defaults := map[string]string{
+		"app_name":        "Weather Service",
+		"recipient_email": to,
+		"timestamp":       time.Now().Format("2006-01-02 15:04:05 MST"),
+		"year":            fmt.Sprintf("%d", time.Now().Year()),
+	}
+	if cfg != nil {
+		if cfg.Server.Branding.Title != "" {
+			defaults["app_name"] = cfg.Server.Branding.Title
+		}
+		defaults["fqdn"] = cfg.Server.FQDN
+		defaults["app_url"] = "https://" + cfg.Server.FQDN
+		defaults["admin_email"] = config.DefaultEmailAddress("admin", cfg)
+	}
+	for key, value := range defaults {
+		if _, ok := vars[key]; !ok {
+			vars[key] = value
+		}
+	}
+
+	subject, body, err := tmpl.Render(vars)
+	if err != nil {
+		return err
+	}
+	return s.send(to, subject, body, "text/plain; charset=UTF-8")
+}
+
+func (s *SMTPService) send(to, subject, body, contentType string) error {
 	if s.config == nil {
 		if err := s.LoadConfig(); err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
@@ -293,7 +340,7 @@ func (s *SMTPService) SendEmail(to, subject, body string) error {
 	headers["To"] = to
 	headers["Subject"] = subject
 	headers["MIME-Version"] = "1.0"
-	headers["Content-Type"] = "text/html; charset=UTF-8"
+	headers["Content-Type"] = contentType
 	headers["Date"] = time.Now().Format(time.RFC1123Z)
 
 	message := ""
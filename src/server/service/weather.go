@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/patrickmn/go-cache"
@@ -27,6 +28,13 @@ type WeatherService struct {
 	zipcodeService   *ZipcodeService
 	geoipService     *GeoIPService
 	mu               sync.RWMutex
+	// Current weather lookups per site since PopularLocations last ran
+	lookups   map[WeatherPoint]int
+	lookupsMu sync.Mutex
+	// Forecasts fetched from Open-Meteo waiting to be recorded for
+	// verification; nil without a recorder
+	forecastRecords        chan forecastRecord
+	forecastRecordsDropped atomic.Uint64
 }
 
 // GeocodeResult represents raw geocoding API response
@@ -299,6 +307,11 @@ func NewWeatherService(locationEnhancer *LocationEnhancer, geoipService *GeoIPSe
 	}
 }
 
+// LocalCache returns the in-process response cache (for cluster-wide invalidation)
+func (ws *WeatherService) LocalCache() *cache.Cache {
+	return ws.cache
+}
+
 // GetCoordinates retrieves coordinates for a location with geocoding
 func (ws *WeatherService) GetCoordinates(location string, country string) (*Coordinates, error) {
 	// Validate location input
@@ -398,6 +411,8 @@ func (ws *WeatherService) GetCoordinates(location string, country string) (*Coor
 
 // GetCurrentWeather retrieves current weather data
 func (ws *WeatherService) GetCurrentWeather(latitude, longitude float64, units string) (*CurrentWeather, error) {
+	ws.countLookup(latitude, longitude)
+
 	cacheKey := fmt.Sprintf("current_%.4f_%.4f_%s", latitude, longitude, units)
 	if cached, found := ws.cache.Get(cacheKey); found {
 		return cached.(*CurrentWeather), nil
@@ -427,6 +442,92 @@ func (ws *WeatherService) GetCurrentWeather(latitude, longitude float64, units s
 		return nil, fmt.Errorf("failed to parse weather data: %w", err)
 	}
 
+	weather := ws.currentWeatherFromResponse(&data, units)
+
+	ws.cache.Set(cacheKey, weather, cache.DefaultExpiration)
+	return weather, nil
+}
+
+// WeatherPoint is a coordinate pair used for batched weather lookups
+type WeatherPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// GetCurrentWeatherBatch retrieves current weather for several coordinates
+// with a single upstream request. Results are returned in the order of points;
+// cached points are served from cache and not re-requested.
+func (ws *WeatherService) GetCurrentWeatherBatch(points []WeatherPoint, units string) ([]*CurrentWeather, error) {
+	results := make([]*CurrentWeather, len(points))
+	var missing []int
+	for i, point := range points {
+		cacheKey := fmt.Sprintf("current_%.4f_%.4f_%s", point.Latitude, point.Longitude, units)
+		if cached, found := ws.cache.Get(cacheKey); found {
+			results[i] = cached.(*CurrentWeather)
+			continue
+		}
+		missing = append(missing, i)
+	}
+	if len(missing) == 0 {
+		return results, nil
+	}
+	if len(missing) == 1 {
+		point := points[missing[0]]
+		weather, err := ws.GetCurrentWeather(point.Latitude, point.Longitude, units)
+		if err != nil {
+			return nil, err
+		}
+		results[missing[0]] = weather
+		return results, nil
+	}
+
+	lats := make([]string, len(missing))
+	lons := make([]string, len(missing))
+	for i, idx := range missing {
+		lats[i] = fmt.Sprintf("%.4f", points[idx].Latitude)
+		lons[i] = fmt.Sprintf("%.4f", points[idx].Longitude)
+	}
+
+	params := url.Values{}
+	params.Set("latitude", strings.Join(lats, ","))
+	params.Set("longitude", strings.Join(lons, ","))
+	params.Set("current", "temperature_2m,relative_humidity_2m,apparent_temperature,is_day,precipitation,weather_code,cloud_cover,pressure_msl,wind_speed_10m,wind_direction_10m,wind_gusts_10m")
+	params.Set("timezone", "auto")
+
+	apiURL := fmt.Sprintf("%s/forecast?%s", ws.openMeteoBaseURL, params.Encode())
+
+	resp, err := ws.client.Get(apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch weather data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Open-Meteo answers multi-coordinate requests with an array in request order
+	var data []OpenMeteoCurrentResponse
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse weather data: %w", err)
+	}
+	if len(data) != len(missing) {
+		return nil, fmt.Errorf("weather batch returned %d results for %d locations", len(data), len(missing))
+	}
+
+	for i, idx := range missing {
+		weather := ws.currentWeatherFromResponse(&data[i], units)
+		cacheKey := fmt.Sprintf("current_%.4f_%.4f_%s", points[idx].Latitude, points[idx].Longitude, units)
+		ws.cache.Set(cacheKey, weather, cache.DefaultExpiration)
+		results[idx] = weather
+	}
+
+	return results, nil
+}
+
+// currentWeatherFromResponse maps an Open-Meteo current block and converts units
+func (ws *WeatherService) currentWeatherFromResponse(data *OpenMeteoCurrentResponse, units string) *CurrentWeather {
 	weather := &CurrentWeather{
 		Temperature:   data.Current.Temperature2m,
 		FeelsLike:     data.Current.ApparentTemperature,
@@ -443,10 +544,7 @@ func (ws *WeatherService) GetCurrentWeather(latitude, longitude float64, units s
 	}
 
 	// Convert units if needed
-	weather = ws.convertWeatherUnits(weather, units)
-
-	ws.cache.Set(cacheKey, weather, cache.DefaultExpiration)
-	return weather, nil
+	return ws.convertWeatherUnits(weather, units)
 }
 
 // GetForecast retrieves weather forecast
@@ -541,6 +639,9 @@ func (ws *WeatherService) GetForecast(latitude, longitude float64, days int, uni
 		}
 	}
 
+	// Record the forecast as issued so it can be verified later
+	ws.queueForecastRecord(ProviderOpenMeteo, latitude, longitude, forecast, time.Now())
+
 	// Convert units if needed
 	forecast = ws.convertForecastUnits(forecast, units)
 
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/model"
 )
 
 // WeatherNotificationService handles weather-based notifications
@@ -91,6 +92,8 @@ func (wns *WeatherNotificationService) CheckWeatherAlerts() error {
 		}
 	}
 
+	alertsFound += wns.checkOrgWeatherAlerts()
+
 	if alertsFound > 0 {
 		fmt.Printf("✅ Sent %d weather alerts\n", alertsFound)
 	}
@@ -220,38 +223,7 @@ func (wns *WeatherNotificationService) sendWeatherAlert(userID int, alert Weathe
 			continue
 		}
 
-		// Prepare template variables
-		variables := map[string]interface{}{
-			"Location":    alert.LocationName,
-			"AlertType":   alert.AlertType,
-			"Severity":    alert.Severity,
-			"Message":     alert.Message,
-			"IssuedAt":    alert.IssuedAt.Format("Jan 2, 2006 at 3:04 PM"),
-			"Coordinates": fmt.Sprintf("%.4f, %.4f", alert.Coordinates.Latitude, alert.Coordinates.Longitude),
-		}
-
-		if alert.ExpiresAt != nil {
-			variables["ExpiresAt"] = alert.ExpiresAt.Format("Jan 2, 2006 at 3:04 PM")
-		}
-
-		// Render template
-		subject, body, err := wns.templateEngine.RenderTemplate(channelType, "weather_alert", variables)
-		if err != nil {
-			// Fallback to default template
-			subject = fmt.Sprintf("⚠️ Weather Alert: %s", alert.AlertType)
-			body = alert.Message
-		}
-
-		// Priority based on severity
-		// normal
-		priority := 2
-		if alert.Severity == "high" {
-			// high
-			priority = 3
-		} else if alert.Severity == "critical" {
-			// critical
-			priority = 4
-		}
+		subject, body, priority, variables := wns.alertMessage(channelType, alert)
 
 		// Enqueue notification
 		_, err = wns.deliverySystem.Enqueue(&userID, channelType, subject, body, priority, variables)
@@ -270,6 +242,143 @@ func (wns *WeatherNotificationService) sendWeatherAlert(userID int, alert Weathe
 	return nil
 }
 
+// alertMessage renders an alert for a channel and returns its subject,
+// body, queue priority and template variables
+func (wns *WeatherNotificationService) alertMessage(channelType string, alert WeatherAlert) (string, string, int, map[string]interface{}) {
+	// Prepare template variables
+	variables := map[string]interface{}{
+		"Location":    alert.LocationName,
+		"AlertType":   alert.AlertType,
+		"Severity":    alert.Severity,
+		"Message":     alert.Message,
+		"IssuedAt":    alert.IssuedAt.Format("Jan 2, 2006 at 3:04 PM"),
+		"Coordinates": fmt.Sprintf("%.4f, %.4f", alert.Coordinates.Latitude, alert.Coordinates.Longitude),
+	}
+
+	if alert.ExpiresAt != nil {
+		variables["ExpiresAt"] = alert.ExpiresAt.Format("Jan 2, 2006 at 3:04 PM")
+	}
+
+	// Render template
+	subject, body, err := wns.templateEngine.RenderTemplate(channelType, "weather_alert", variables)
+	if err != nil {
+		// Fallback to default template
+		subject = fmt.Sprintf("⚠️ Weather Alert: %s", alert.AlertType)
+		body = alert.Message
+	}
+
+	// Priority based on severity
+	// normal
+	priority := 2
+	if alert.Severity == "high" {
+		// high
+		priority = 3
+	} else if alert.Severity == "critical" {
+		// critical
+		priority = 4
+	}
+
+	return subject, body, priority, variables
+}
+
+// checkOrgWeatherAlerts checks organization locations and routes alerts
+// through each organization's channels. It returns how many alerts were
+// sent.
+func (wns *WeatherNotificationService) checkOrgWeatherAlerts() int {
+	alertsModel := &models.OrgAlertModel{DB: database.GetUsersDB()}
+	locations, err := alertsModel.AlertLocations()
+	if err != nil {
+		fmt.Printf("Failed to query organization locations: %v\n", err)
+		return 0
+	}
+
+	sent := 0
+	for _, location := range locations {
+		weatherData, err := wns.weatherService.GetCurrentWeather(location.Latitude, location.Longitude, "imperial")
+		if err != nil {
+			continue
+		}
+
+		for _, alert := range wns.detectSevereWeather(weatherData, location.Name, location.Latitude, location.Longitude) {
+			alert.LocationID = int(location.ID)
+
+			subscribed, err := alertsModel.Subscribed(location.OrgID, location.ID, alert.AlertType, alert.Severity)
+			if err != nil || !subscribed {
+				continue
+			}
+			// Same 6 hour window as user alerts
+			if alertsModel.HasRecentAlert(location.OrgID, location.ID, alert.AlertType, 6*time.Hour) {
+				continue
+			}
+
+			if wns.sendOrgWeatherAlert(location.OrgID, alert) > 0 {
+				sent++
+				if err := alertsModel.RecordAlertSent(location.OrgID, location.ID, alert.AlertType); err != nil {
+					fmt.Printf("Failed to record organization alert: %v\n", err)
+				}
+			}
+		}
+	}
+	return sent
+}
+
+// sendOrgWeatherAlert delivers an alert through an organization's enabled
+// channels and returns how many notifications were queued. On-call routes
+// go to each on-call member's own contact for the channel.
+func (wns *WeatherNotificationService) sendOrgWeatherAlert(orgID int64, alert WeatherAlert) int {
+	orgs := &models.OrgModel{DB: database.GetUsersDB()}
+	org, err := orgs.Get(orgID)
+	if err != nil {
+		return 0
+	}
+	channels, err := (&models.OrgAlertModel{DB: database.GetUsersDB()}).EnabledChannels(orgID)
+	if err != nil {
+		fmt.Printf("Failed to get channels for organization %d: %v\n", orgID, err)
+		return 0
+	}
+
+	queued := 0
+	for _, channel := range channels {
+		subject, body, priority, variables := wns.alertMessage(channel.ChannelType, alert)
+		variables["Organization"] = org.Name
+
+		if channel.Route == models.OrgRouteAddress {
+			variables["recipient"] = channel.Address()
+			if _, err := wns.deliverySystem.Enqueue(nil, channel.ChannelType, subject, body, priority, variables); err != nil {
+				fmt.Printf("Failed to enqueue notification for channel %s: %v\n", channel.ChannelType, err)
+				continue
+			}
+			queued++
+			continue
+		}
+
+		var members []*models.OrgMember
+		if channel.Route == models.OrgRouteMembers {
+			members, err = orgs.ListMembers(orgID)
+		} else {
+			members, err = orgs.OnCallMembers(orgID)
+		}
+		if err != nil {
+			fmt.Printf("Failed to get members for organization %d: %v\n", orgID, err)
+			continue
+		}
+		for _, member := range members {
+			userID := int(member.UserID)
+			if _, err := wns.deliverySystem.Enqueue(&userID, channel.ChannelType, subject, body, priority, variables); err != nil {
+				fmt.Printf("Failed to enqueue notification for channel %s: %v\n", channel.ChannelType, err)
+				continue
+			}
+			queued++
+		}
+	}
+
+	if queued > 0 {
+		fmt.Printf("📢 Weather alert sent to organization %s via %d notifications: %s - %s\n",
+			org.Slug, queued, alert.LocationName, alert.AlertType)
+	}
+	return queued
+}
+
 // hasRecentAlert checks if we've sent this alert type recently
 func (wns *WeatherNotificationService) hasRecentAlert(userID, locationID int, alertType string) bool {
 	var count int
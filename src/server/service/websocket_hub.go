@@ -9,15 +9,63 @@ import (
 
 	"github.com/apimgr/weather/src/server/model"
 	"github.com/gorilla/websocket"
+	"github.com/oklog/ulid/v2"
+)
+
+// Hub message types
+const (
+	HubMessageNotification       = "notification"
+	HubMessageEarthquake         = "earthquake"
+	HubMessageSevereWeatherAlert = "severe_weather_alert"
+	HubMessageSystem             = "system"
+)
+
+const (
+	// Events kept for Last-Event-ID replay (SSE) per node
+	hubReplayBufferSize = 1000
+	// How long event IDs and dedup keys are remembered
+	hubSeenTTL = 10 * time.Minute
 )
 
 // WebSocketMessage represents a message sent over WebSocket
 type WebSocketMessage struct {
-	// "notification", "ping", "pong"
+	// Event ID (ULID), assigned when the message is published through the hub
+	ID string `json:"id,omitempty"`
+	// "notification", "earthquake", "severe_weather_alert", "system", "ping", "pong"
 	Type string      `json:"type"`
 	Data interface{} `json:"data"`
 }
 
+// HubEvent is a hub message with its routing. Events are buffered for replay
+// and relayed between cluster nodes.
+type HubEvent struct {
+	Message *WebSocketMessage
+	// Recipient; both nil broadcasts to everyone
+	UserID  *int
+	AdminID *int
+	// Optional natural key (e.g. "earthquake:us1234") so the same upstream
+	// event published by several nodes is only delivered once
+	Key string
+	// Node the event was published on
+	NodeID string
+	Time   time.Time
+}
+
+// HubRelay forwards locally published events to other cluster nodes
+type HubRelay interface {
+	Forward(event *HubEvent)
+}
+
+// HubSubscription receives hub messages in-process (GraphQL subscriptions)
+type HubSubscription struct {
+	// Owner of the subscription; both nil for anonymous subscribers
+	UserID  *int
+	AdminID *int
+	// Message types to deliver; empty delivers every type
+	Types map[string]bool
+	C     chan *WebSocketMessage
+}
+
 // WebSocketClient represents a connected WebSocket client
 type WebSocketClient struct {
 	// "user-{userID}" or "admin-{adminID}"
@@ -41,7 +89,22 @@ type WebSocketHub struct {
 	unregister chan *WebSocketClient
 
 	// Broadcast channels
-	broadcast chan *WebSocketMessage
+	broadcast chan *HubEvent
+
+	// In-process subscribers
+	subscribers    map[*HubSubscription]struct{}
+	subscribersMux sync.RWMutex
+
+	// Replay buffer (ring) and dedup of event IDs/keys
+	replay      []*HubEvent
+	replayStart int
+	replayCount int
+	seen        map[string]time.Time
+	eventsMux   sync.Mutex
+
+	// Cluster relay
+	relay  HubRelay
+	nodeID string
 
 	// Shutdown
 	done chan struct{}
@@ -50,11 +113,14 @@ type WebSocketHub struct {
 // NewWebSocketHub creates a new WebSocket hub
 func NewWebSocketHub() *WebSocketHub {
 	return &WebSocketHub{
-		clients:    make(map[string]*WebSocketClient),
-		register:   make(chan *WebSocketClient, 10),
-		unregister: make(chan *WebSocketClient, 10),
-		broadcast:  make(chan *WebSocketMessage, 100),
-		done:       make(chan struct{}),
+		clients:     make(map[string]*WebSocketClient),
+		register:    make(chan *WebSocketClient, 10),
+		unregister:  make(chan *WebSocketClient, 10),
+		broadcast:   make(chan *HubEvent, 100),
+		subscribers: make(map[*HubSubscription]struct{}),
+		replay:      make([]*HubEvent, hubReplayBufferSize),
+		seen:        make(map[string]time.Time),
+		done:        make(chan struct{}),
 	}
 }
 
@@ -85,8 +151,8 @@ func (h *WebSocketHub) Run() {
 			}
 			h.clientsMux.Unlock()
 
-		case message := <-h.broadcast:
-			h.broadcastToAll(message)
+		case event := <-h.broadcast:
+			h.broadcastToAll(event)
 
 		case <-pingTicker.C:
 			h.pingClients()
@@ -113,6 +179,14 @@ func (h *WebSocketHub) Stop() {
 		}
 	}
 	h.clientsMux.Unlock()
+
+	// Close all subscriber channels so consumers finish
+	h.subscribersMux.Lock()
+	for sub := range h.subscribers {
+		close(sub.C)
+	}
+	h.subscribers = make(map[*HubSubscription]struct{})
+	h.subscribersMux.Unlock()
 }
 
 // RegisterClient registers a new WebSocket client
@@ -125,37 +199,219 @@ func (h *WebSocketHub) UnregisterClient(client *WebSocketClient) {
 	h.unregister <- client
 }
 
-// BroadcastToUser broadcasts a notification to a specific user
-func (h *WebSocketHub) BroadcastToUser(userID int, notification *models.Notification) {
-	clientID := ClientIDForUser(userID)
+// Subscribe registers an in-process subscriber for the given message types.
+// Notifications are only delivered to subscribers owned by the recipient.
+func (h *WebSocketHub) Subscribe(userID, adminID *int, types ...string) *HubSubscription {
+	sub := &HubSubscription{
+		UserID:  userID,
+		AdminID: adminID,
+		Types:   make(map[string]bool, len(types)),
+		C:       make(chan *WebSocketMessage, 32),
+	}
+	for _, t := range types {
+		sub.Types[t] = true
+	}
 
-	h.clientsMux.RLock()
-	client, ok := h.clients[clientID]
-	h.clientsMux.RUnlock()
+	h.subscribersMux.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.subscribersMux.Unlock()
 
-	if ok {
-		message := &WebSocketMessage{
-			Type: "notification",
-			Data: notification,
+	return sub
+}
+
+// Unsubscribe removes an in-process subscriber and closes its channel
+func (h *WebSocketHub) Unsubscribe(sub *HubSubscription) {
+	h.subscribersMux.Lock()
+	defer h.subscribersMux.Unlock()
+
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.C)
+	}
+}
+
+// Matches reports whether the subscription should receive an event
+func (sub *HubSubscription) Matches(event *HubEvent) bool {
+	if len(sub.Types) > 0 && !sub.Types[event.Message.Type] {
+		return false
+	}
+	if event.UserID != nil {
+		return sub.UserID != nil && *sub.UserID == *event.UserID
+	}
+	if event.AdminID != nil {
+		return sub.AdminID != nil && *sub.AdminID == *event.AdminID
+	}
+	return true
+}
+
+// SetRelay forwards locally published events to other cluster nodes
+func (h *WebSocketHub) SetRelay(relay HubRelay, nodeID string) {
+	h.eventsMux.Lock()
+	defer h.eventsMux.Unlock()
+	h.relay = relay
+	h.nodeID = nodeID
+}
+
+// Publish broadcasts a message to all connected clients and subscribers
+func (h *WebSocketHub) Publish(message *WebSocketMessage) {
+	h.PublishEvent(&HubEvent{Message: message})
+}
+
+// PublishEvent delivers a locally produced event and relays it to the cluster
+func (h *WebSocketHub) PublishEvent(event *HubEvent) {
+	relay, ok := h.accept(event, true)
+	if !ok {
+		return
+	}
+	if relay != nil {
+		relay.Forward(event)
+	}
+	h.route(event)
+}
+
+// Receive delivers an event relayed from another cluster node
+func (h *WebSocketHub) Receive(event *HubEvent) {
+	if _, ok := h.accept(event, false); !ok {
+		return
+	}
+	h.route(event)
+}
+
+// accept assigns the event ID, drops duplicates and records the event for
+// replay. It returns the relay to forward local events to.
+func (h *WebSocketHub) accept(event *HubEvent, local bool) (HubRelay, bool) {
+	h.eventsMux.Lock()
+	defer h.eventsMux.Unlock()
+
+	now := time.Now()
+	if event.Time.IsZero() {
+		event.Time = now
+	}
+	if event.Message.ID == "" {
+		event.Message.ID = ulid.Make().String()
+	}
+	if local && event.NodeID == "" {
+		event.NodeID = h.nodeID
+	}
+
+	if _, dup := h.seen[event.Message.ID]; dup {
+		return nil, false
+	}
+	if event.Key != "" {
+		if _, dup := h.seen["key:"+event.Key]; dup {
+			return nil, false
 		}
-		h.sendToClient(client, message)
+		h.seen["key:"+event.Key] = now
 	}
+	h.seen[event.Message.ID] = now
+	if len(h.seen) > 4*hubReplayBufferSize {
+		for id, seenAt := range h.seen {
+			if now.Sub(seenAt) > hubSeenTTL {
+				delete(h.seen, id)
+			}
+		}
+	}
+
+	// Append to the ring buffer, overwriting the oldest event when full
+	idx := (h.replayStart + h.replayCount) % len(h.replay)
+	h.replay[idx] = event
+	if h.replayCount < len(h.replay) {
+		h.replayCount++
+	} else {
+		h.replayStart = (h.replayStart + 1) % len(h.replay)
+	}
+
+	if local {
+		return h.relay, true
+	}
+	return nil, true
 }
 
-// BroadcastToAdmin broadcasts a notification to a specific admin
-func (h *WebSocketHub) BroadcastToAdmin(adminID int, notification *models.Notification) {
-	clientID := ClientIDForAdmin(adminID)
+// EventsSince returns buffered events published after lastID (ULIDs sort by
+// time, so IDs from other nodes compare correctly). An empty lastID returns
+// nothing; an ID older than the buffer returns the whole buffer.
+func (h *WebSocketHub) EventsSince(lastID string) []*HubEvent {
+	if lastID == "" {
+		return nil
+	}
+
+	h.eventsMux.Lock()
+	defer h.eventsMux.Unlock()
+
+	var events []*HubEvent
+	for i := 0; i < h.replayCount; i++ {
+		event := h.replay[(h.replayStart+i)%len(h.replay)]
+		if event.Message.ID > lastID {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// route delivers an event to its recipient or broadcasts it
+func (h *WebSocketHub) route(event *HubEvent) {
+	var clientID string
+	switch {
+	case event.UserID != nil:
+		clientID = ClientIDForUser(*event.UserID)
+	case event.AdminID != nil:
+		clientID = ClientIDForAdmin(*event.AdminID)
+	default:
+		select {
+		case h.broadcast <- event:
+		case <-h.done:
+		}
+		return
+	}
 
 	h.clientsMux.RLock()
 	client, ok := h.clients[clientID]
 	h.clientsMux.RUnlock()
 
 	if ok {
-		message := &WebSocketMessage{
-			Type: "notification",
+		h.sendToClient(client, event.Message)
+	}
+
+	h.notifySubscribers(event)
+}
+
+// BroadcastToUser broadcasts a notification to a specific user
+func (h *WebSocketHub) BroadcastToUser(userID int, notification *models.Notification) {
+	h.PublishEvent(&HubEvent{
+		Message: &WebSocketMessage{
+			Type: HubMessageNotification,
 			Data: notification,
+		},
+		UserID: &userID,
+	})
+}
+
+// BroadcastToAdmin broadcasts a notification to a specific admin
+func (h *WebSocketHub) BroadcastToAdmin(adminID int, notification *models.Notification) {
+	h.PublishEvent(&HubEvent{
+		Message: &WebSocketMessage{
+			Type: HubMessageNotification,
+			Data: notification,
+		},
+		AdminID: &adminID,
+	})
+}
+
+// notifySubscribers delivers an event to matching in-process subscribers.
+// Slow subscribers miss messages rather than blocking the hub.
+func (h *WebSocketHub) notifySubscribers(event *HubEvent) {
+	h.subscribersMux.RLock()
+	defer h.subscribersMux.RUnlock()
+
+	for sub := range h.subscribers {
+		if !sub.Matches(event) {
+			continue
+		}
+		select {
+		case sub.C <- event.Message:
+		default:
+			log.Printf("WebSocket hub subscriber buffer full, dropping %s message", event.Message.Type)
 		}
-		h.sendToClient(client, message)
 	}
 }
 
@@ -185,8 +441,8 @@ func (h *WebSocketHub) BroadcastToAllAdmins(message *WebSocketMessage) {
 	}
 }
 
-// broadcastToAll broadcasts a message to all connected clients
-func (h *WebSocketHub) broadcastToAll(message *WebSocketMessage) {
+// broadcastToAll broadcasts an event to all connected clients
+func (h *WebSocketHub) broadcastToAll(event *HubEvent) {
 	h.clientsMux.RLock()
 	clients := make([]*WebSocketClient, 0, len(h.clients))
 	for _, client := range h.clients {
@@ -195,8 +451,10 @@ func (h *WebSocketHub) broadcastToAll(message *WebSocketMessage) {
 	h.clientsMux.RUnlock()
 
 	for _, client := range clients {
-		h.sendToClient(client, message)
+		h.sendToClient(client, event.Message)
 	}
+
+	h.notifySubscribers(event)
 }
 
 // sendToClient sends a message to a specific client
@@ -440,3 +440,137 @@ func TestWebSocketMessage_Serialization(t *testing.T) {
 		t.Error("Data should not be nil after unmarshaling")
 	}
 }
+
+func TestWebSocketHub_SubscribeNotificationsForOwnerOnly(t *testing.T) {
+	hub := NewWebSocketHub()
+	go hub.Run()
+	defer hub.Stop()
+
+	ownerID := 1
+	otherID := 2
+	owner := hub.Subscribe(&ownerID, nil, HubMessageNotification)
+	other := hub.Subscribe(&otherID, nil, HubMessageNotification)
+	anonymous := hub.Subscribe(nil, nil)
+
+	notification := &models.Notification{
+		ID:      "test-sub-1",
+		UserID:  &ownerID,
+		Type:    models.NotificationTypeInfo,
+		Display: models.NotificationDisplayToast,
+		Title:   "Test",
+		Message: "Test message",
+	}
+	hub.BroadcastToUser(ownerID, notification)
+
+	select {
+	case msg := <-owner.C:
+		if msg.Type != HubMessageNotification {
+			t.Errorf("Type = %v, want %v", msg.Type, HubMessageNotification)
+		}
+		if got, ok := msg.Data.(*models.Notification); !ok || got.ID != "test-sub-1" {
+			t.Errorf("Data = %v, want notification test-sub-1", msg.Data)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Owner subscription did not receive notification")
+	}
+
+	select {
+	case msg := <-other.C:
+		t.Errorf("Other user received notification: %v", msg)
+	case msg := <-anonymous.C:
+		t.Errorf("Anonymous subscriber received notification: %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebSocketHub_PublishFiltersByType(t *testing.T) {
+	hub := NewWebSocketHub()
+	go hub.Run()
+	defer hub.Stop()
+
+	quakes := hub.Subscribe(nil, nil, HubMessageEarthquake)
+	alerts := hub.Subscribe(nil, nil, HubMessageSevereWeatherAlert)
+
+	hub.Publish(&WebSocketMessage{Type: HubMessageEarthquake, Data: Earthquake{ID: "us1234"}})
+
+	select {
+	case msg := <-quakes.C:
+		if eq, ok := msg.Data.(Earthquake); !ok || eq.ID != "us1234" {
+			t.Errorf("Data = %v, want earthquake us1234", msg.Data)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Earthquake subscription did not receive event")
+	}
+
+	select {
+	case msg := <-alerts.C:
+		t.Errorf("Alert subscription received %s message", msg.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWebSocketHub_UnsubscribeClosesChannel(t *testing.T) {
+	hub := NewWebSocketHub()
+	go hub.Run()
+	defer hub.Stop()
+
+	sub := hub.Subscribe(nil, nil)
+	hub.Unsubscribe(sub)
+	// Second call must not panic
+	hub.Unsubscribe(sub)
+
+	if _, ok := <-sub.C; ok {
+		t.Error("Subscription channel should be closed after Unsubscribe")
+	}
+}
+
+func TestWebSocketHub_EventsSinceReplaysNewerEvents(t *testing.T) {
+	hub := NewWebSocketHub()
+	go hub.Run()
+	defer hub.Stop()
+
+	first := &WebSocketMessage{Type: HubMessageSystem, Data: "first"}
+	hub.Publish(first)
+	time.Sleep(2 * time.Millisecond)
+	hub.Publish(&WebSocketMessage{Type: HubMessageSystem, Data: "second"})
+
+	if first.ID == "" {
+		t.Fatal("Publish should assign an event ID")
+	}
+	if events := hub.EventsSince(""); len(events) != 0 {
+		t.Errorf("EventsSince(\"\") returned %d events, want 0", len(events))
+	}
+
+	events := hub.EventsSince(first.ID)
+	if len(events) != 1 {
+		t.Fatalf("EventsSince returned %d events, want 1", len(events))
+	}
+	if events[0].Message.Data != "second" {
+		t.Errorf("Replayed data = %v, want second", events[0].Message.Data)
+	}
+}
+
+func TestWebSocketHub_DropsDuplicateKeys(t *testing.T) {
+	hub := NewWebSocketHub()
+	go hub.Run()
+	defer hub.Stop()
+
+	sub := hub.Subscribe(nil, nil, HubMessageEarthquake)
+	for i := 0; i < 2; i++ {
+		hub.PublishEvent(&HubEvent{
+			Message: &WebSocketMessage{Type: HubMessageEarthquake, Data: Earthquake{ID: "us1"}},
+			Key:     "earthquake:us1",
+		})
+	}
+
+	select {
+	case <-sub.C:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Subscription did not receive first event")
+	}
+	select {
+	case msg := <-sub.C:
+		t.Errorf("Duplicate event delivered: %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,126 @@
+// Passkey (WebAuthn) helpers shared by the login, registration, recovery
+// and admin login pages
+(function () {
+    'use strict';
+
+    function bufferToBase64url(buffer) {
+        const bytes = new Uint8Array(buffer);
+        let binary = '';
+        for (const byte of bytes) binary += String.fromCharCode(byte);
+        return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/g, '');
+    }
+
+    function base64urlToBuffer(base64url) {
+        const padded = (base64url + '==='.slice((base64url.length + 3) % 4)).replace(/-/g, '+').replace(/_/g, '/');
+        const binary = atob(padded);
+        const bytes = new Uint8Array(binary.length);
+        for (let i = 0; i < binary.length; i++) bytes[i] = binary.charCodeAt(i);
+        return bytes.buffer;
+    }
+
+    function mapCredentials(list) {
+        return Array.isArray(list)
+            ? list.map((credential) => ({ ...credential, id: base64urlToBuffer(credential.id) }))
+            : list;
+    }
+
+    function requestOptions(options) {
+        const publicKey = options.publicKey || options;
+        publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+        publicKey.allowCredentials = mapCredentials(publicKey.allowCredentials);
+        return publicKey;
+    }
+
+    function creationOptions(options) {
+        const publicKey = options.publicKey || options;
+        publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+        publicKey.user.id = base64urlToBuffer(publicKey.user.id);
+        publicKey.excludeCredentials = mapCredentials(publicKey.excludeCredentials);
+        return publicKey;
+    }
+
+    function serializeAssertion(assertion) {
+        return {
+            id: assertion.id,
+            rawId: bufferToBase64url(assertion.rawId),
+            type: assertion.type,
+            response: {
+                authenticatorData: bufferToBase64url(assertion.response.authenticatorData),
+                clientDataJSON: bufferToBase64url(assertion.response.clientDataJSON),
+                signature: bufferToBase64url(assertion.response.signature),
+                userHandle: assertion.response.userHandle ? bufferToBase64url(assertion.response.userHandle) : null,
+            },
+        };
+    }
+
+    function serializeAttestation(credential) {
+        return {
+            id: credential.id,
+            rawId: bufferToBase64url(credential.rawId),
+            type: credential.type,
+            response: {
+                attestationObject: bufferToBase64url(credential.response.attestationObject),
+                clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+                transports: credential.response.getTransports ? credential.response.getTransports() : [],
+            },
+            authenticatorAttachment: credential.authenticatorAttachment || undefined,
+        };
+    }
+
+    async function postJSON(url, body) {
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body || {}),
+        });
+        const payload = await response.json();
+        if (!response.ok || !payload.ok) {
+            throw new Error(payload.error || 'Request failed');
+        }
+        return payload;
+    }
+
+    function supported() {
+        return !!(window.PublicKeyCredential && navigator.credentials && navigator.credentials.get);
+    }
+
+    async function conditionalSupported() {
+        return supported() && typeof PublicKeyCredential.isConditionalMediationAvailable === 'function'
+            && await PublicKeyCredential.isConditionalMediationAvailable();
+    }
+
+    // signIn runs a discoverable login; with conditional set the browser
+    // offers passkeys in the autofill of an autocomplete="username webauthn"
+    // field instead of showing a dialog. Abort a pending conditional
+    // request with signal before starting a modal one; target "admin"
+    // accepts admin passkeys only.
+    async function signIn({ conditional, signal, target } = {}) {
+        const challenge = await postJSON('/api/v1/auth/passkey/challenge', target ? { target } : {});
+        const request = { publicKey: requestOptions(challenge.options) };
+        if (conditional) request.mediation = 'conditional';
+        if (signal) request.signal = signal;
+        const assertion = await navigator.credentials.get(request);
+        if (!assertion) throw new Error('Passkey sign-in was cancelled');
+        return postJSON('/api/v1/auth/passkey/verify', serializeAssertion(assertion));
+    }
+
+    // signUp creates a passkey-only account
+    async function signUp(username, email, name) {
+        const start = await postJSON('/api/v1/auth/passkey/register', { username, email, name });
+        const credential = await navigator.credentials.create({ publicKey: creationOptions(start.options) });
+        if (!credential) throw new Error('Passkey registration was cancelled');
+        return postJSON('/api/v1/auth/passkey/register', serializeAttestation(credential));
+    }
+
+    window.WeatherPasskey = {
+        supported,
+        conditionalSupported,
+        signIn,
+        signUp,
+        postJSON,
+        requestOptions,
+        creationOptions,
+        serializeAssertion,
+        serializeAttestation,
+    };
+})();
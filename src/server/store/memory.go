@@ -0,0 +1,1186 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apimgr/weather/src/server/model"
+)
+
+// Memory is an in-memory Store for tests. It keeps the behaviour the SQL
+// store relies on the schema for: unique usernames and emails, generated
+// IDs and cascading user deletes
+type Memory struct {
+	mu            sync.Mutex
+	nextID        int64
+	users         map[int64]*models.User
+	admins        map[int64]*models.Admin
+	adminTokens   map[int64]string
+	adminSessions map[string]*models.AdminSession
+	sessions      map[string]*models.Session
+	tokens        map[int64]*models.Token
+	preferences   map[int64]*models.UserPreferences
+	locations     map[int64]*models.SavedLocation
+	notifications map[string]*models.Notification
+	verifications map[int64]*models.UserEmailVerification
+	resets        map[int64]*models.UserPasswordReset
+	settings      map[string]*models.Setting
+	auditLog      []*AuditEntry
+	channels      map[string]*NotificationChannel
+	queue         []queuedNotification
+	deliveries    []*NotificationDelivery
+}
+
+// queuedNotification is what the Memory store keeps of a queued delivery
+type queuedNotification struct {
+	channelType string
+	state       string
+}
+
+// NewMemory returns an empty in-memory Store
+func NewMemory() *Memory {
+	return &Memory{
+		users:         make(map[int64]*models.User),
+		admins:        make(map[int64]*models.Admin),
+		adminTokens:   make(map[int64]string),
+		adminSessions: make(map[string]*models.AdminSession),
+		sessions:      make(map[string]*models.Session),
+		tokens:        make(map[int64]*models.Token),
+		preferences:   make(map[int64]*models.UserPreferences),
+		locations:     make(map[int64]*models.SavedLocation),
+		notifications: make(map[string]*models.Notification),
+		verifications: make(map[int64]*models.UserEmailVerification),
+		resets:        make(map[int64]*models.UserPasswordReset),
+		settings:      make(map[string]*models.Setting),
+		channels:      make(map[string]*NotificationChannel),
+	}
+}
+
+// SetSetting adds or replaces a setting, standing in for the defaults the
+// server seeds into server_config
+func (m *Memory) SetSetting(key, value, settingType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	category, _, _ := strings.Cut(key, ".")
+	m.settings[key] = &models.Setting{Key: key, Value: value, Type: settingType, Category: category, UpdatedAt: time.Now()}
+}
+
+// AddAuditEntry appends an audit log entry, standing in for the audit
+// logger, and sets its ID
+func (m *Memory) AddAuditEntry(entry *AuditEntry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.ID = m.id()
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	copied := *entry
+	m.auditLog = append(m.auditLog, &copied)
+}
+
+// SetNotificationChannel adds or replaces a notification channel, standing
+// in for the channels the channel manager initializes
+func (m *Memory) SetNotificationChannel(channel *NotificationChannel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *channel
+	m.channels[channel.Type] = &copied
+}
+
+// AddQueuedNotification records a delivery queue entry of a channel in state,
+// standing in for the delivery system
+func (m *Memory) AddQueuedNotification(channelType, state string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.queue = append(m.queue, queuedNotification{channelType: channelType, state: state})
+}
+
+// AddNotificationDelivery appends a delivery history entry, standing in for
+// the delivery system, and sets its ID
+func (m *Memory) AddNotificationDelivery(delivery *NotificationDelivery) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery.ID = m.id()
+	if delivery.SentAt.IsZero() {
+		delivery.SentAt = time.Now()
+	}
+	copied := *delivery
+	m.deliveries = append(m.deliveries, &copied)
+}
+
+func (m *Memory) id() int64 {
+	m.nextID++
+	return m.nextID
+}
+
+// User operations
+
+// GetUserByID returns a user account
+func (m *Memory) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if user, ok := m.users[id]; ok {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, ErrNotFound
+}
+
+// GetUserByEmail returns the user account with an email address
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if strings.EqualFold(user.Email, email) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// userConflict reports a username or email another user already has
+func (m *Memory) userConflict(user *models.User) error {
+	for _, other := range m.users {
+		if other.ID == user.ID {
+			continue
+		}
+		if other.Username == user.Username {
+			return fmt.Errorf("username %q already exists", user.Username)
+		}
+		if strings.EqualFold(other.Email, user.Email) {
+			return fmt.Errorf("email %q already exists", user.Email)
+		}
+	}
+	return nil
+}
+
+// CreateUser stores a user account and sets its ID and timestamps
+func (m *Memory) CreateUser(ctx context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.userConflict(user); err != nil {
+		return err
+	}
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	if user.Visibility == "" {
+		user.Visibility = "public"
+	}
+	if user.Language == "" {
+		user.Language = "en"
+	}
+	user.ID = m.id()
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	copied := *user
+	m.users[user.ID] = &copied
+	m.preferences[user.ID] = &models.UserPreferences{UserID: user.ID, Theme: "auto", Language: user.Language,
+		Timezone: "UTC", TemperatureUnit: "celsius", PressureUnit: "hPa", WindSpeedUnit: "kmh", PrecipitationUnit: "mm",
+		NotificationsEnabled: true, EmailNotifications: true, CreatedAt: user.CreatedAt, UpdatedAt: user.CreatedAt}
+	return nil
+}
+
+// UpdateUser replaces a stored user account
+func (m *Memory) UpdateUser(ctx context.Context, user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := m.userConflict(user); err != nil {
+		return err
+	}
+	user.CreatedAt = stored.CreatedAt
+	user.UpdatedAt = time.Now()
+	copied := *user
+	m.users[user.ID] = &copied
+	return nil
+}
+
+// DeleteUser deletes a user account with its sessions, tokens, locations,
+// notifications, preferences and pending verifications and password resets
+func (m *Memory) DeleteUser(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.users, id)
+	for key, session := range m.sessions {
+		if int64(session.UserID) == id {
+			delete(m.sessions, key)
+		}
+	}
+	for key, token := range m.tokens {
+		if token.OwnerType == models.OwnerTypeUser && token.OwnerID == id {
+			delete(m.tokens, key)
+		}
+	}
+	for key, location := range m.locations {
+		if int64(location.UserID) == id {
+			delete(m.locations, key)
+		}
+	}
+	for key, notification := range m.notifications {
+		if notification.UserID != nil && int64(*notification.UserID) == id {
+			delete(m.notifications, key)
+		}
+	}
+	for key, verification := range m.verifications {
+		if verification.UserID == id {
+			delete(m.verifications, key)
+		}
+	}
+	for key, reset := range m.resets {
+		if reset.UserID == id {
+			delete(m.resets, key)
+		}
+	}
+	delete(m.preferences, id)
+	return nil
+}
+
+// ListUsers returns a page of user accounts, newest first
+func (m *Memory) ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var users []*models.User
+	for _, user := range m.users {
+		copied := *user
+		users = append(users, &copied)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID > users[j].ID })
+	return page(users, limit, offset), nil
+}
+
+// CountUsers counts user accounts with a role, or all when role is empty
+func (m *Memory) CountUsers(ctx context.Context, role string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, user := range m.users {
+		if role == "" || user.Role == role {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func page[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return nil
+	}
+	items = items[offset:]
+	if limit >= 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
+
+// Admin operations
+
+// GetAdminByID returns a server administrator
+func (m *Memory) GetAdminByID(ctx context.Context, id int64) (*models.Admin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if admin, ok := m.admins[id]; ok {
+		copied := *admin
+		return &copied, nil
+	}
+	return nil, ErrNotFound
+}
+
+// GetAdminByEmail returns the server administrator with an email address
+func (m *Memory) GetAdminByEmail(ctx context.Context, email string) (*models.Admin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, admin := range m.admins {
+		if strings.EqualFold(admin.Email, email) {
+			copied := *admin
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetAdminByUsername returns the server administrator with a username
+func (m *Memory) GetAdminByUsername(ctx context.Context, username string) (*models.Admin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, admin := range m.admins {
+		if admin.Username == username {
+			copied := *admin
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *Memory) adminConflict(admin *models.Admin) error {
+	for _, other := range m.admins {
+		if other.ID != admin.ID && (other.Username == admin.Username || strings.EqualFold(other.Email, admin.Email)) {
+			return fmt.Errorf("admin %q already exists", admin.Username)
+		}
+	}
+	return nil
+}
+
+// CreateAdmin stores a server administrator and sets its ID and timestamps
+func (m *Memory) CreateAdmin(ctx context.Context, admin *models.Admin) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.adminConflict(admin); err != nil {
+		return err
+	}
+	admin.ID = m.id()
+	admin.CreatedAt = time.Now()
+	admin.UpdatedAt = admin.CreatedAt
+	copied := *admin
+	m.admins[admin.ID] = &copied
+	return nil
+}
+
+// UpdateAdmin replaces a stored server administrator
+func (m *Memory) UpdateAdmin(ctx context.Context, admin *models.Admin) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.admins[admin.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := m.adminConflict(admin); err != nil {
+		return err
+	}
+	admin.CreatedAt = stored.CreatedAt
+	admin.UpdatedAt = time.Now()
+	copied := *admin
+	m.admins[admin.ID] = &copied
+	return nil
+}
+
+// DeleteAdmin deletes a server administrator with its tokens and sessions
+func (m *Memory) DeleteAdmin(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.admins[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.admins, id)
+	delete(m.adminTokens, id)
+	for key, token := range m.tokens {
+		if token.OwnerType == models.OwnerTypeAdmin && token.OwnerID == id {
+			delete(m.tokens, key)
+		}
+	}
+	for key, session := range m.adminSessions {
+		if session.AdminID == id {
+			delete(m.adminSessions, key)
+		}
+	}
+	return nil
+}
+
+// ListAdmins returns every server administrator by username
+func (m *Memory) ListAdmins(ctx context.Context) ([]*models.Admin, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var admins []*models.Admin
+	for _, admin := range m.admins {
+		copied := *admin
+		admins = append(admins, &copied)
+	}
+	sort.Slice(admins, func(i, j int) bool { return admins[i].Username < admins[j].Username })
+	return admins, nil
+}
+
+// SetAdminAPIToken stores the hash and display prefix of an
+// administrator's API token
+func (m *Memory) SetAdminAPIToken(ctx context.Context, id int64, tokenHash, tokenPrefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	admin, ok := m.admins[id]
+	if !ok {
+		return ErrNotFound
+	}
+	m.adminTokens[id] = tokenHash
+	admin.APITokenPrefix = tokenPrefix
+	admin.UpdatedAt = time.Now()
+	return nil
+}
+
+// CreateAdminSession stores an admin panel session, generating its
+// session ID when empty
+func (m *Memory) CreateAdminSession(ctx context.Context, session *models.AdminSession) error {
+	if session.SessionID == "" {
+		id, err := models.GenerateSessionID()
+		if err != nil {
+			return fmt.Errorf("failed to generate session ID: %w", err)
+		}
+		session.SessionID = id
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.admins[session.AdminID]; !ok {
+		return fmt.Errorf("admin %d does not exist", session.AdminID)
+	}
+	if _, ok := m.adminSessions[session.SessionID]; ok {
+		return fmt.Errorf("admin session already exists")
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	session.LastUsedAt = session.CreatedAt
+	copied := *session
+	m.adminSessions[session.SessionID] = &copied
+	return nil
+}
+
+// Session operations
+
+// GetSession returns a user session, expired or not
+func (m *Memory) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if session, ok := m.sessions[id]; ok {
+		copied := *session
+		return &copied, nil
+	}
+	return nil, ErrNotFound
+}
+
+// CreateSession stores a user session, generating its ID when empty
+func (m *Memory) CreateSession(ctx context.Context, session *models.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[int64(session.UserID)]; !ok {
+		return fmt.Errorf("user %d does not exist", session.UserID)
+	}
+	if session.ID == "" {
+		id, err := models.GenerateSessionID()
+		if err != nil {
+			return fmt.Errorf("failed to generate session ID: %w", err)
+		}
+		session.ID = id
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	copied := *session
+	m.sessions[session.ID] = &copied
+	return nil
+}
+
+// DeleteSession deletes a user session
+func (m *Memory) DeleteSession(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.sessions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.sessions, id)
+	return nil
+}
+
+// DeleteUserSessions deletes every session of a user
+func (m *Memory) DeleteUserSessions(ctx context.Context, userID int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var removed int64
+	for key, session := range m.sessions {
+		if int64(session.UserID) == userID {
+			delete(m.sessions, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// DeleteExpiredSessions removes expired user sessions
+func (m *Memory) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var removed int64
+	for key, session := range m.sessions {
+		if session.ExpiresAt.Before(now) {
+			delete(m.sessions, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Token operations
+
+func validOwnerType(ownerType string) error {
+	switch ownerType {
+	case models.OwnerTypeUser, models.OwnerTypeAdmin, models.OwnerTypeOrg:
+		return nil
+	default:
+		return fmt.Errorf("invalid owner type: %s", ownerType)
+	}
+}
+
+// GetTokenByHash returns the token with a SHA-256 hash, expired or not
+func (m *Memory) GetTokenByHash(ctx context.Context, ownerType, tokenHash string) (*models.Token, error) {
+	if err := validOwnerType(ownerType); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, token := range m.tokens {
+		if token.OwnerType == ownerType && token.TokenHash == tokenHash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListTokens returns an owner's tokens, newest first
+func (m *Memory) ListTokens(ctx context.Context, ownerType string, ownerID int64) ([]*models.Token, error) {
+	if err := validOwnerType(ownerType); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tokens []*models.Token
+	for _, token := range m.tokens {
+		if token.OwnerType == ownerType && token.OwnerID == ownerID {
+			copied := *token
+			tokens = append(tokens, &copied)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID > tokens[j].ID })
+	return tokens, nil
+}
+
+// ListTokensByType returns the tokens of every owner of a type, newest
+// first
+func (m *Memory) ListTokensByType(ctx context.Context, ownerType string) ([]*models.Token, error) {
+	if err := validOwnerType(ownerType); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tokens []*models.Token
+	for _, token := range m.tokens {
+		if token.OwnerType == ownerType {
+			copied := *token
+			tokens = append(tokens, &copied)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID > tokens[j].ID })
+	return tokens, nil
+}
+
+// CreateToken stores a token and sets its ID. The plaintext is not kept
+func (m *Memory) CreateToken(ctx context.Context, token *models.Token) error {
+	if err := validOwnerType(token.OwnerType); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, other := range m.tokens {
+		if other.OwnerType == token.OwnerType && other.TokenHash == token.TokenHash {
+			return fmt.Errorf("token hash already exists")
+		}
+	}
+	token.ID = m.id()
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	copied := *token
+	copied.Token = ""
+	m.tokens[token.ID] = &copied
+	return nil
+}
+
+// DeleteToken revokes one of an owner's tokens
+func (m *Memory) DeleteToken(ctx context.Context, ownerType string, ownerID, id int64) error {
+	if err := validOwnerType(ownerType); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	token, ok := m.tokens[id]
+	if !ok || token.OwnerType != ownerType || token.OwnerID != ownerID {
+		return ErrNotFound
+	}
+	delete(m.tokens, id)
+	return nil
+}
+
+// DeleteExpiredTokens removes expired tokens of every owner type
+func (m *Memory) DeleteExpiredTokens(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var removed int64
+	for key, token := range m.tokens {
+		if token.ExpiresAt != nil && token.ExpiresAt.Before(now) {
+			delete(m.tokens, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// User preference operations
+
+// GetUserPreferences returns a user's preferences
+func (m *Memory) GetUserPreferences(ctx context.Context, userID int64) (*models.UserPreferences, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if prefs, ok := m.preferences[userID]; ok {
+		copied := *prefs
+		return &copied, nil
+	}
+	return nil, ErrNotFound
+}
+
+// SaveUserPreferences inserts or replaces a user's preferences
+func (m *Memory) SaveUserPreferences(ctx context.Context, prefs *models.UserPreferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[prefs.UserID]; !ok {
+		return fmt.Errorf("user %d does not exist", prefs.UserID)
+	}
+	now := time.Now()
+	if stored, ok := m.preferences[prefs.UserID]; ok {
+		prefs.CreatedAt = stored.CreatedAt
+	} else if prefs.CreatedAt.IsZero() {
+		prefs.CreatedAt = now
+	}
+	prefs.UpdatedAt = now
+	copied := *prefs
+	m.preferences[prefs.UserID] = &copied
+	return nil
+}
+
+// Location operations
+
+// GetLocation returns a saved location
+func (m *Memory) GetLocation(ctx context.Context, id int64) (*models.SavedLocation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if location, ok := m.locations[id]; ok {
+		copied := *location
+		return &copied, nil
+	}
+	return nil, ErrNotFound
+}
+
+// ListUserLocations returns a user's saved locations, newest first
+func (m *Memory) ListUserLocations(ctx context.Context, userID int64) ([]*models.SavedLocation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var locations []*models.SavedLocation
+	for _, location := range m.locations {
+		if int64(location.UserID) == userID {
+			copied := *location
+			locations = append(locations, &copied)
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].ID > locations[j].ID })
+	return locations, nil
+}
+
+// ListAlertLocations returns the saved locations with weather alerts
+// enabled whose owner still exists
+func (m *Memory) ListAlertLocations(ctx context.Context) ([]*models.SavedLocation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var locations []*models.SavedLocation
+	for _, location := range m.locations {
+		if _, ok := m.users[int64(location.UserID)]; ok && location.AlertsEnabled {
+			copied := *location
+			locations = append(locations, &copied)
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].ID < locations[j].ID })
+	return locations, nil
+}
+
+// CountUserLocations counts a user's saved locations
+func (m *Memory) CountUserLocations(ctx context.Context, userID int64) (int, error) {
+	locations, err := m.ListUserLocations(ctx, userID)
+	return len(locations), err
+}
+
+// CreateLocation stores a saved location and sets its ID and timestamps
+func (m *Memory) CreateLocation(ctx context.Context, location *models.SavedLocation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[int64(location.UserID)]; !ok {
+		return fmt.Errorf("user %d does not exist", location.UserID)
+	}
+	location.ID = int(m.id())
+	location.CreatedAt = time.Now()
+	location.UpdatedAt = location.CreatedAt
+	copied := *location
+	m.locations[int64(location.ID)] = &copied
+	return nil
+}
+
+// UpdateLocation writes a saved location's name, coordinates, timezone and
+// alert setting
+func (m *Memory) UpdateLocation(ctx context.Context, location *models.SavedLocation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.locations[int64(location.ID)]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Name = location.Name
+	stored.Latitude = location.Latitude
+	stored.Longitude = location.Longitude
+	stored.Timezone = location.Timezone
+	stored.AlertsEnabled = location.AlertsEnabled
+	stored.UpdatedAt = time.Now()
+	location.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+// DeleteLocation deletes a saved location
+func (m *Memory) DeleteLocation(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.locations[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.locations, id)
+	return nil
+}
+
+// Notification operations
+
+// GetNotification returns a user notification
+func (m *Memory) GetNotification(ctx context.Context, id string) (*models.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if notification, ok := m.notifications[id]; ok {
+		copied := *notification
+		return &copied, nil
+	}
+	return nil, ErrNotFound
+}
+
+// ListUserNotifications returns a page of a user's notifications, newest
+// first
+func (m *Memory) ListUserNotifications(ctx context.Context, userID int64, unreadOnly bool, limit, offset int) ([]*models.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	notifications := m.userNotifications(userID, unreadOnly)
+	sort.Slice(notifications, func(i, j int) bool {
+		a, b := notifications[i], notifications[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	return page(notifications, limit, offset), nil
+}
+
+// CountUserNotifications counts a user's notifications
+func (m *Memory) CountUserNotifications(ctx context.Context, userID int64, unreadOnly bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.userNotifications(userID, unreadOnly)), nil
+}
+
+func (m *Memory) userNotifications(userID int64, unreadOnly bool) []*models.Notification {
+	var notifications []*models.Notification
+	for _, notification := range m.notifications {
+		if notification.UserID != nil && int64(*notification.UserID) == userID && !(unreadOnly && notification.Read) {
+			copied := *notification
+			notifications = append(notifications, &copied)
+		}
+	}
+	return notifications
+}
+
+// CreateNotification stores a user notification with the same defaults as
+// the SQL store
+func (m *Memory) CreateNotification(ctx context.Context, notification *models.Notification) error {
+	if notification.UserID == nil {
+		return fmt.Errorf("notification has no user")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[int64(*notification.UserID)]; !ok {
+		return fmt.Errorf("user %d does not exist", *notification.UserID)
+	}
+	prepareNotification(notification)
+	copied := *notification
+	copied.IsRead = copied.Read
+	m.notifications[notification.ID] = &copied
+	return nil
+}
+
+// MarkNotificationRead marks a user notification read
+func (m *Memory) MarkNotificationRead(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	notification, ok := m.notifications[id]
+	if !ok {
+		return ErrNotFound
+	}
+	notification.Read, notification.IsRead = true, true
+	return nil
+}
+
+// MarkAllNotificationsRead marks every unread notification of a user read
+func (m *Memory) MarkAllNotificationsRead(ctx context.Context, userID int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var marked int64
+	for _, notification := range m.notifications {
+		if notification.UserID != nil && int64(*notification.UserID) == userID && !notification.Read {
+			notification.Read, notification.IsRead = true, true
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+// DeleteNotification deletes a user notification
+func (m *Memory) DeleteNotification(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.notifications[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.notifications, id)
+	return nil
+}
+
+// DeleteExpiredNotifications removes expired user notifications
+func (m *Memory) DeleteExpiredNotifications(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	var removed int64
+	for key, notification := range m.notifications {
+		if notification.ExpiresAt != nil && !notification.ExpiresAt.After(now) {
+			delete(m.notifications, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// Email verification and password reset operations
+
+// GetEmailVerification returns an email verification by token
+func (m *Memory) GetEmailVerification(ctx context.Context, token string) (*models.UserEmailVerification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, verification := range m.verifications {
+		if verification.Token == token {
+			copied := *verification
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// CreateEmailVerification stores an email verification and sets its ID and
+// creation time
+func (m *Memory) CreateEmailVerification(ctx context.Context, verification *models.UserEmailVerification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[verification.UserID]; !ok {
+		return fmt.Errorf("user %d does not exist", verification.UserID)
+	}
+	for _, existing := range m.verifications {
+		if existing.Token == verification.Token {
+			return fmt.Errorf("verification token already exists")
+		}
+	}
+	verification.ID = m.id()
+	verification.CreatedAt = time.Now()
+	copied := *verification
+	m.verifications[verification.ID] = &copied
+	return nil
+}
+
+// DeleteEmailVerification deletes an email verification
+func (m *Memory) DeleteEmailVerification(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.verifications[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.verifications, id)
+	return nil
+}
+
+// GetPasswordReset returns a password reset by token
+func (m *Memory) GetPasswordReset(ctx context.Context, token string) (*models.UserPasswordReset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, reset := range m.resets {
+		if reset.Token == token {
+			copied := *reset
+			return &copied, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// CreatePasswordReset stores a password reset and sets its ID and creation
+// time
+func (m *Memory) CreatePasswordReset(ctx context.Context, reset *models.UserPasswordReset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[reset.UserID]; !ok {
+		return fmt.Errorf("user %d does not exist", reset.UserID)
+	}
+	for _, existing := range m.resets {
+		if existing.Token == reset.Token {
+			return fmt.Errorf("reset token already exists")
+		}
+	}
+	reset.ID = m.id()
+	reset.CreatedAt = time.Now()
+	copied := *reset
+	m.resets[reset.ID] = &copied
+	return nil
+}
+
+// DeletePasswordReset deletes a password reset
+func (m *Memory) DeletePasswordReset(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.resets[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.resets, id)
+	return nil
+}
+
+// Settings operations
+
+// GetSetting returns a setting
+func (m *Memory) GetSetting(ctx context.Context, key string) (*models.Setting, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if setting, ok := m.settings[key]; ok {
+		copied := *setting
+		return &copied, nil
+	}
+	return nil, ErrNotFound
+}
+
+// ListSettings returns every setting by key
+func (m *Memory) ListSettings(ctx context.Context) ([]*models.Setting, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var settings []*models.Setting
+	for _, setting := range m.settings {
+		copied := *setting
+		settings = append(settings, &copied)
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings, nil
+}
+
+// UpdateSetting changes the value of an existing setting
+func (m *Memory) UpdateSetting(ctx context.Context, key, value string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	setting, ok := m.settings[key]
+	if !ok {
+		return ErrNotFound
+	}
+	setting.Value = value
+	setting.UpdatedAt = time.Now()
+	return nil
+}
+
+// UpsertSetting stores a setting, adding it with its type and description
+// when missing. An existing setting only has its value changed
+func (m *Memory) UpsertSetting(ctx context.Context, setting *models.Setting) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if setting.Type == "" {
+		setting.Type = "string"
+	}
+	setting.UpdatedAt = time.Now()
+	if stored, ok := m.settings[setting.Key]; ok {
+		stored.Value = setting.Value
+		stored.UpdatedAt = setting.UpdatedAt
+		return nil
+	}
+	copied := *setting
+	copied.Category, _, _ = strings.Cut(setting.Key, ".")
+	m.settings[setting.Key] = &copied
+	return nil
+}
+
+// DeleteSettings removes every setting
+func (m *Memory) DeleteSettings(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := int64(len(m.settings))
+	m.settings = make(map[string]*models.Setting)
+	return removed, nil
+}
+
+// Audit log operations
+
+// ListAuditLog returns the newest audit log entries
+func (m *Memory) ListAuditLog(ctx context.Context, limit int) ([]*AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []*AuditEntry
+	for _, entry := range m.auditLog {
+		copied := *entry
+		entries = append(entries, &copied)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Timestamp.Equal(entries[j].Timestamp) {
+			return entries[i].Timestamp.After(entries[j].Timestamp)
+		}
+		return entries[i].ID > entries[j].ID
+	})
+	if limit >= 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// DeleteAuditLogBefore removes audit log entries older than cutoff
+func (m *Memory) DeleteAuditLogBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.auditLog[:0]
+	for _, entry := range m.auditLog {
+		if !entry.Timestamp.Before(cutoff) {
+			kept = append(kept, entry)
+		}
+	}
+	removed := int64(len(m.auditLog) - len(kept))
+	m.auditLog = kept
+	return removed, nil
+}
+
+// Notification channel and delivery queue operations
+
+// ListNotificationChannels returns the notification channels by name
+func (m *Memory) ListNotificationChannels(ctx context.Context) ([]*NotificationChannel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var channels []*NotificationChannel
+	for _, channel := range m.channels {
+		copied := *channel
+		channels = append(channels, &copied)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	return channels, nil
+}
+
+// GetNotificationChannel returns a notification channel by type
+func (m *Memory) GetNotificationChannel(ctx context.Context, channelType string) (*NotificationChannel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	channel, ok := m.channels[channelType]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *channel
+	return &copied, nil
+}
+
+// UpdateNotificationChannel enables or disables a channel and replaces its
+// configuration
+func (m *Memory) UpdateNotificationChannel(ctx context.Context, channelType string, enabled bool, config string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	channel, ok := m.channels[channelType]
+	if !ok {
+		return ErrNotFound
+	}
+	channel.Enabled, channel.Config, channel.UpdatedAt = enabled, config, time.Now()
+	return nil
+}
+
+// NotificationQueueStats counts the delivery queue by state and by channel
+func (m *Memory) NotificationQueueStats(ctx context.Context) (*NotificationQueueStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := &NotificationQueueStats{Total: len(m.queue), ByChannel: make(map[string]int)}
+	for _, entry := range m.queue {
+		stats.ByChannel[entry.channelType]++
+		switch entry.state {
+		case "created", "queued":
+			stats.Pending++
+		case "sending":
+			stats.Sending++
+		case "delivered":
+			stats.Delivered++
+		case "failed":
+			stats.Failed++
+		case "dead_letter":
+			stats.DeadLetters++
+		}
+	}
+	return stats, nil
+}
+
+// ListNotificationHistory returns the latest deliveries, optionally only
+// those of a channel or with a status
+func (m *Memory) ListNotificationHistory(ctx context.Context, channelType, status string, limit int) ([]*NotificationDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var history []*NotificationDelivery
+	for _, delivery := range m.deliveries {
+		if (channelType != "" && delivery.ChannelType != channelType) || (status != "" && delivery.Status != status) {
+			continue
+		}
+		copied := *delivery
+		history = append(history, &copied)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if !history[i].SentAt.Equal(history[j].SentAt) {
+			return history[i].SentAt.After(history[j].SentAt)
+		}
+		return history[i].ID > history[j].ID
+	})
+	if limit >= 0 && len(history) > limit {
+		history = history[:limit]
+	}
+	return history, nil
+}
+
+// Stats counts the stored users, locations, user tokens, sessions and
+// notifications
+func (m *Memory) Stats(ctx context.Context) (*Stats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := &Stats{
+		Users:         len(m.users),
+		Locations:     len(m.locations),
+		Sessions:      len(m.sessions),
+		Notifications: len(m.notifications),
+	}
+	for _, token := range m.tokens {
+		if token.OwnerType == models.OwnerTypeUser {
+			stats.Tokens++
+		}
+	}
+	return stats, nil
+}
+
+// Ping always succeeds
+func (m *Memory) Ping(ctx context.Context) error {
+	return nil
+}
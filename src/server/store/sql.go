@@ -0,0 +1,1216 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/oklog/ulid/v2"
+)
+
+// SQL is the Store backed by the server and users databases. Queries are
+// written in SQLite syntax; on PostgreSQL the connections opened by
+// database.OpenDualDB translate them, so both dialects share these queries
+// AI.md PART 10: every query runs with a timeout
+type SQL struct {
+	server  *sql.DB
+	users   *sql.DB
+	dialect database.Dialect
+}
+
+// New returns the Store for an open dual database
+func New(ddb *database.DualDB) *SQL {
+	return &SQL{server: ddb.Server, users: ddb.Users, dialect: ddb.Dialect}
+}
+
+// NewSQLite returns the Store for SQLite server.db and users.db connections
+func NewSQLite(server, users *sql.DB) *SQL {
+	return &SQL{server: server, users: users, dialect: database.DialectSQLite}
+}
+
+// NewPostgres returns the Store for PostgreSQL server and users connections
+// opened with database.OpenDualDB
+func NewPostgres(server, users *sql.DB) *SQL {
+	return &SQL{server: server, users: users, dialect: database.DialectPostgres}
+}
+
+// Dialect returns the SQL dialect of the databases
+func (s *SQL) Dialect() database.Dialect {
+	return s.dialect
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryRow scans a single row, mapping sql.ErrNoRows to ErrNotFound
+func queryRow(ctx context.Context, db *sql.DB, scan func(scanner) error, query string, args ...interface{}) error {
+	err := database.QueryRowContext(ctx, db, database.TimeoutSimpleSelect, func(row *sql.Row) error {
+		return scan(row)
+	}, query, args...)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// exec runs a write and returns the rows it affected
+func exec(ctx context.Context, db database.Querier, query string, args ...interface{}) (int64, error) {
+	result, err := database.ExecContext(ctx, db, database.TimeoutWrite, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// execOne runs a write that must match a row
+func execOne(ctx context.Context, db database.Querier, query string, args ...interface{}) error {
+	affected, err := exec(ctx, db, query, args...)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func count(ctx context.Context, db *sql.DB, query string, args ...interface{}) (int, error) {
+	var n int
+	err := queryRow(ctx, db, func(row scanner) error { return row.Scan(&n) }, query, args...)
+	return n, err
+}
+
+// nullString stores empty strings as NULL so optional UNIQUE columns such
+// as phone do not collide
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// User operations
+
+const userColumns = `id, username, display_name, notification_email, email, phone, password_hash,
+	email_verified, is_active, is_banned, ban_reason, role, visibility,
+	two_factor_enabled, two_factor_secret, avatar_type, avatar_url, bio,
+	location, website, timezone, language, created_at, updated_at,
+	last_login_at, last_login_ip`
+
+func scanUser(row scanner) (*models.User, error) {
+	var u models.User
+	var displayName, notificationEmail, phone, banReason, role, visibility sql.NullString
+	var twoFactorSecret, avatarType, avatarURL, bio, location, website, timezone, language, lastLoginIP sql.NullString
+	var lastLoginAt sql.NullTime
+	err := row.Scan(&u.ID, &u.Username, &displayName, &notificationEmail, &u.Email, &phone, &u.PasswordHash,
+		&u.EmailVerified, &u.IsActive, &u.IsBanned, &banReason, &role, &visibility,
+		&u.TwoFactorEnabled, &twoFactorSecret, &avatarType, &avatarURL, &bio,
+		&location, &website, &timezone, &language, &u.CreatedAt, &u.UpdatedAt,
+		&lastLoginAt, &lastLoginIP)
+	if err != nil {
+		return nil, err
+	}
+	u.DisplayName = displayName.String
+	u.NotificationEmail = notificationEmail.String
+	u.Phone = phone.String
+	u.BanReason = banReason.String
+	u.Role = role.String
+	u.Visibility = visibility.String
+	u.TwoFactorSecret = twoFactorSecret.String
+	u.AvatarType = avatarType.String
+	u.AvatarURL = avatarURL.String
+	u.Bio = bio.String
+	u.Location = location.String
+	u.Website = website.String
+	u.Timezone = timezone.String
+	u.Language = language.String
+	u.LastLoginIP = lastLoginIP.String
+	if lastLoginAt.Valid {
+		u.LastLoginAt = &lastLoginAt.Time
+	}
+	return &u, nil
+}
+
+func (s *SQL) getUser(ctx context.Context, where string, arg interface{}) (*models.User, error) {
+	var user *models.User
+	err := queryRow(ctx, s.users, func(row scanner) (err error) {
+		user, err = scanUser(row)
+		return err
+	}, "SELECT "+userColumns+" FROM user_accounts WHERE "+where, arg)
+	return user, err
+}
+
+// GetUserByID returns a user account
+func (s *SQL) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	return s.getUser(ctx, "id = ?", id)
+}
+
+// GetUserByEmail returns the user account with an email address
+func (s *SQL) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return s.getUser(ctx, "LOWER(email) = LOWER(?)", email)
+}
+
+// CreateUser inserts a user account with default preferences and sets its
+// ID and timestamps. PasswordHash must already be hashed
+func (s *SQL) CreateUser(ctx context.Context, user *models.User) error {
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	if user.Visibility == "" {
+		user.Visibility = "public"
+	}
+	if user.Language == "" {
+		user.Language = "en"
+	}
+	now := time.Now()
+	return database.WithTransaction(ctx, s.users, func(tx *sql.Tx) error {
+		result, err := database.ExecContext(ctx, tx, database.TimeoutWrite, `
+			INSERT INTO user_accounts (username, display_name, notification_email, email, phone, password_hash,
+				email_verified, is_active, is_banned, ban_reason, role, visibility, two_factor_enabled,
+				avatar_type, avatar_url, bio, location, website, timezone, language, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, user.Username, nullString(user.DisplayName), nullString(user.NotificationEmail), user.Email,
+			nullString(user.Phone), user.PasswordHash, user.EmailVerified, user.IsActive, user.IsBanned,
+			nullString(user.BanReason), user.Role, user.Visibility, user.TwoFactorEnabled,
+			nullString(user.AvatarType), nullString(user.AvatarURL), nullString(user.Bio), nullString(user.Location),
+			nullString(user.Website), nullString(user.Timezone), user.Language, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get user ID: %w", err)
+		}
+		_, err = database.ExecContext(ctx, tx, database.TimeoutWrite, `
+			INSERT INTO user_preferences (user_id, theme, language, timezone, temperature_unit, pressure_unit, wind_speed_unit, precipitation_unit, notifications_enabled, email_notifications, created_at, updated_at)
+			VALUES (?, 'auto', ?, 'UTC', 'celsius', 'hPa', 'kmh', 'mm', 1, 1, ?, ?)
+		`, id, user.Language, now, now)
+		if err != nil {
+			return fmt.Errorf("failed to create user preferences: %w", err)
+		}
+		user.ID = id
+		user.CreatedAt, user.UpdatedAt = now, now
+		return nil
+	})
+}
+
+// UpdateUser writes every stored field of a user loaded with GetUserByID
+func (s *SQL) UpdateUser(ctx context.Context, user *models.User) error {
+	user.UpdatedAt = time.Now()
+	return execOne(ctx, s.users, `
+		UPDATE user_accounts
+		SET username = ?, display_name = ?, notification_email = ?, email = ?, phone = ?, password_hash = ?,
+			email_verified = ?, is_active = ?, is_banned = ?, ban_reason = ?, role = ?, visibility = ?,
+			two_factor_enabled = ?, two_factor_secret = ?, avatar_type = ?, avatar_url = ?, bio = ?,
+			location = ?, website = ?, timezone = ?, language = ?, updated_at = ?
+		WHERE id = ?
+	`, user.Username, nullString(user.DisplayName), nullString(user.NotificationEmail), user.Email,
+		nullString(user.Phone), user.PasswordHash, user.EmailVerified, user.IsActive, user.IsBanned,
+		nullString(user.BanReason), user.Role, user.Visibility, user.TwoFactorEnabled,
+		nullString(user.TwoFactorSecret), nullString(user.AvatarType), nullString(user.AvatarURL),
+		nullString(user.Bio), nullString(user.Location), nullString(user.Website), nullString(user.Timezone),
+		user.Language, user.UpdatedAt, user.ID)
+}
+
+// userOwnedTables are deleted with a user account. They also cascade, but
+// SQLite only enforces foreign keys on connections that enabled them
+var userOwnedTables = []string{"user_sessions", "user_tokens", "user_saved_locations", "user_notifications", "user_preferences",
+	"user_email_verifications", "user_password_resets"}
+
+// DeleteUser deletes a user account with its sessions, tokens, saved
+// locations, notifications, preferences and pending verifications and
+// password resets
+func (s *SQL) DeleteUser(ctx context.Context, id int64) error {
+	return database.WithTransaction(ctx, s.users, func(tx *sql.Tx) error {
+		for _, table := range userOwnedTables {
+			if _, err := exec(ctx, tx, "DELETE FROM "+table+" WHERE user_id = ?", id); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", table, err)
+			}
+		}
+		return execOne(ctx, tx, "DELETE FROM user_accounts WHERE id = ?", id)
+	})
+}
+
+// ListUsers returns a page of user accounts, newest first
+func (s *SQL) ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	var users []*models.User
+	err := database.QueryContext(ctx, s.users, database.TimeoutComplexSelect, func(rows *sql.Rows) error {
+		user, err := scanUser(rows)
+		if err == nil {
+			users = append(users, user)
+		}
+		return err
+	}, "SELECT "+userColumns+" FROM user_accounts ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?", limit, offset)
+	return users, err
+}
+
+// CountUsers counts user accounts with a role, or all when role is empty
+func (s *SQL) CountUsers(ctx context.Context, role string) (int, error) {
+	if role == "" {
+		return count(ctx, s.users, "SELECT COUNT(*) FROM user_accounts")
+	}
+	return count(ctx, s.users, "SELECT COUNT(*) FROM user_accounts WHERE role = ?", role)
+}
+
+// Admin operations
+
+const adminColumns = `id, username, email, password_hash, api_token_prefix, is_super_admin, is_active,
+	created_at, updated_at, last_login_at`
+
+func scanAdmin(row scanner) (*models.Admin, error) {
+	var a models.Admin
+	var tokenPrefix sql.NullString
+	var lastLoginAt sql.NullTime
+	err := row.Scan(&a.ID, &a.Username, &a.Email, &a.PasswordHash, &tokenPrefix, &a.IsSuperAdmin, &a.IsActive,
+		&a.CreatedAt, &a.UpdatedAt, &lastLoginAt)
+	if err != nil {
+		return nil, err
+	}
+	a.APITokenPrefix = tokenPrefix.String
+	if lastLoginAt.Valid {
+		a.LastLoginAt = &lastLoginAt.Time
+	}
+	return &a, nil
+}
+
+func (s *SQL) getAdmin(ctx context.Context, where string, arg interface{}) (*models.Admin, error) {
+	var admin *models.Admin
+	err := queryRow(ctx, s.server, func(row scanner) (err error) {
+		admin, err = scanAdmin(row)
+		return err
+	}, "SELECT "+adminColumns+" FROM server_admin_credentials WHERE "+where, arg)
+	return admin, err
+}
+
+// GetAdminByID returns a server administrator
+func (s *SQL) GetAdminByID(ctx context.Context, id int64) (*models.Admin, error) {
+	return s.getAdmin(ctx, "id = ?", id)
+}
+
+// GetAdminByEmail returns the server administrator with an email address
+func (s *SQL) GetAdminByEmail(ctx context.Context, email string) (*models.Admin, error) {
+	return s.getAdmin(ctx, "LOWER(email) = LOWER(?)", email)
+}
+
+// GetAdminByUsername returns the server administrator with a username
+func (s *SQL) GetAdminByUsername(ctx context.Context, username string) (*models.Admin, error) {
+	return s.getAdmin(ctx, "username = ?", username)
+}
+
+// CreateAdmin inserts a server administrator and sets its ID and
+// timestamps. PasswordHash must already be hashed
+func (s *SQL) CreateAdmin(ctx context.Context, admin *models.Admin) error {
+	now := time.Now()
+	result, err := database.ExecContext(ctx, s.server, database.TimeoutWrite, `
+		INSERT INTO server_admin_credentials (username, email, password_hash, is_super_admin, is_active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, admin.Username, admin.Email, admin.PasswordHash, admin.IsSuperAdmin, admin.IsActive, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to create admin: %w", err)
+	}
+	if admin.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get admin ID: %w", err)
+	}
+	admin.CreatedAt, admin.UpdatedAt = now, now
+	return nil
+}
+
+// UpdateAdmin writes the account fields of a server administrator
+func (s *SQL) UpdateAdmin(ctx context.Context, admin *models.Admin) error {
+	admin.UpdatedAt = time.Now()
+	return execOne(ctx, s.server, `
+		UPDATE server_admin_credentials
+		SET username = ?, email = ?, password_hash = ?, is_super_admin = ?, is_active = ?, updated_at = ?
+		WHERE id = ?
+	`, admin.Username, admin.Email, admin.PasswordHash, admin.IsSuperAdmin, admin.IsActive, admin.UpdatedAt, admin.ID)
+}
+
+// DeleteAdmin deletes a server administrator
+func (s *SQL) DeleteAdmin(ctx context.Context, id int64) error {
+	return execOne(ctx, s.server, "DELETE FROM server_admin_credentials WHERE id = ?", id)
+}
+
+// ListAdmins returns every server administrator by username
+func (s *SQL) ListAdmins(ctx context.Context) ([]*models.Admin, error) {
+	var admins []*models.Admin
+	err := database.QueryContext(ctx, s.server, database.TimeoutSimpleSelect, func(rows *sql.Rows) error {
+		admin, err := scanAdmin(rows)
+		if err == nil {
+			admins = append(admins, admin)
+		}
+		return err
+	}, "SELECT "+adminColumns+" FROM server_admin_credentials ORDER BY username")
+	return admins, err
+}
+
+// SetAdminAPIToken stores the hash and display prefix of an
+// administrator's API token
+func (s *SQL) SetAdminAPIToken(ctx context.Context, id int64, tokenHash, tokenPrefix string) error {
+	return execOne(ctx, s.server, `
+		UPDATE server_admin_credentials
+		SET api_token_hash = ?, api_token_prefix = ?, updated_at = ?
+		WHERE id = ?
+	`, tokenHash, tokenPrefix, time.Now(), id)
+}
+
+// CreateAdminSession inserts an admin panel session, generating its
+// session ID when empty
+func (s *SQL) CreateAdminSession(ctx context.Context, session *models.AdminSession) error {
+	if session.SessionID == "" {
+		id, err := models.GenerateSessionID()
+		if err != nil {
+			return fmt.Errorf("failed to generate session ID: %w", err)
+		}
+		session.SessionID = id
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	session.LastUsedAt = session.CreatedAt
+	_, err := exec(ctx, s.server, `
+		INSERT INTO server_admin_sessions (id, admin_id, ip_address, user_agent, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, session.SessionID, session.AdminID, nullString(session.IPAddress), nullString(session.UserAgent),
+		session.CreatedAt, session.ExpiresAt)
+	return err
+}
+
+// Session operations
+
+// GetSession returns a user session, expired or not; callers check
+// ExpiresAt
+func (s *SQL) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	session := &models.Session{}
+	var data sql.NullString
+	err := queryRow(ctx, s.users, func(row scanner) error {
+		return row.Scan(&session.ID, &session.UserID, &data, &session.ExpiresAt, &session.CreatedAt)
+	}, "SELECT id, user_id, data, expires_at, created_at FROM user_sessions WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	if data.String != "" {
+		if err := json.Unmarshal([]byte(data.String), &session.Data); err != nil {
+			return nil, fmt.Errorf("failed to decode session data: %w", err)
+		}
+	}
+	return session, nil
+}
+
+// CreateSession inserts a user session, generating its ID when empty
+func (s *SQL) CreateSession(ctx context.Context, session *models.Session) error {
+	if session.ID == "" {
+		id, err := models.GenerateSessionID()
+		if err != nil {
+			return fmt.Errorf("failed to generate session ID: %w", err)
+		}
+		session.ID = id
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	var data interface{}
+	if len(session.Data) > 0 {
+		encoded, err := json.Marshal(session.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encode session data: %w", err)
+		}
+		data = string(encoded)
+	}
+	_, err := exec(ctx, s.users, `
+		INSERT INTO user_sessions (id, user_id, data, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, session.ID, session.UserID, data, session.ExpiresAt, session.CreatedAt)
+	return err
+}
+
+// DeleteSession deletes a user session
+func (s *SQL) DeleteSession(ctx context.Context, id string) error {
+	return execOne(ctx, s.users, "DELETE FROM user_sessions WHERE id = ?", id)
+}
+
+// DeleteUserSessions signs a user out everywhere
+func (s *SQL) DeleteUserSessions(ctx context.Context, userID int64) (int64, error) {
+	return exec(ctx, s.users, "DELETE FROM user_sessions WHERE user_id = ?", userID)
+}
+
+// DeleteExpiredSessions removes expired user sessions
+func (s *SQL) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	return exec(ctx, s.users, "DELETE FROM user_sessions WHERE expires_at < ?", time.Now())
+}
+
+// Token operations
+
+// tokenTable returns the database, table and owner column holding the
+// tokens of an owner type
+func (s *SQL) tokenTable(ownerType string) (*sql.DB, string, string, error) {
+	switch ownerType {
+	case models.OwnerTypeUser:
+		return s.users, "user_tokens", "user_id", nil
+	case models.OwnerTypeAdmin:
+		return s.server, "server_admin_tokens", "admin_id", nil
+	case models.OwnerTypeOrg:
+		return s.users, "org_tokens", "org_id", nil
+	default:
+		return nil, "", "", fmt.Errorf("invalid owner type: %s", ownerType)
+	}
+}
+
+const tokenColumns = `id, %s, name, token_hash, token_prefix, scopes, expires_at, last_used_at, created_at,
+	allowed_ips, location_id, rate_limit, daily_quota`
+
+func scanToken(row scanner, ownerType string) (*models.Token, error) {
+	t := &models.Token{OwnerType: ownerType}
+	var name, scopes, allowedIPs sql.NullString
+	var expiresAt, lastUsedAt sql.NullTime
+	var locationID sql.NullInt64
+	err := row.Scan(&t.ID, &t.OwnerID, &name, &t.TokenHash, &t.TokenPrefix, &scopes, &expiresAt, &lastUsedAt,
+		&t.CreatedAt, &allowedIPs, &locationID, &t.RateLimit, &t.DailyQuota)
+	if err != nil {
+		return nil, err
+	}
+	t.Name = name.String
+	t.Scope = scopes.String
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+	if allowedIPs.String != "" {
+		t.AllowedIPs = strings.Split(allowedIPs.String, ",")
+	}
+	if locationID.Valid {
+		t.LocationID = &locationID.Int64
+	}
+	return t, nil
+}
+
+// GetTokenByHash returns the token with a SHA-256 hash, expired or not;
+// callers check ExpiresAt
+func (s *SQL) GetTokenByHash(ctx context.Context, ownerType, tokenHash string) (*models.Token, error) {
+	db, table, ownerColumn, err := s.tokenTable(ownerType)
+	if err != nil {
+		return nil, err
+	}
+	var token *models.Token
+	err = queryRow(ctx, db, func(row scanner) (err error) {
+		token, err = scanToken(row, ownerType)
+		return err
+	}, "SELECT "+fmt.Sprintf(tokenColumns, ownerColumn)+" FROM "+table+" WHERE token_hash = ?", tokenHash)
+	return token, err
+}
+
+// ListTokens returns an owner's tokens, newest first
+func (s *SQL) ListTokens(ctx context.Context, ownerType string, ownerID int64) ([]*models.Token, error) {
+	db, table, ownerColumn, err := s.tokenTable(ownerType)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []*models.Token
+	err = database.QueryContext(ctx, db, database.TimeoutSimpleSelect, func(rows *sql.Rows) error {
+		token, err := scanToken(rows, ownerType)
+		if err == nil {
+			tokens = append(tokens, token)
+		}
+		return err
+	}, "SELECT "+fmt.Sprintf(tokenColumns, ownerColumn)+" FROM "+table+" WHERE "+ownerColumn+" = ? ORDER BY created_at DESC, id DESC", ownerID)
+	return tokens, err
+}
+
+// ListTokensByType returns the tokens of every owner of a type, newest
+// first
+func (s *SQL) ListTokensByType(ctx context.Context, ownerType string) ([]*models.Token, error) {
+	db, table, ownerColumn, err := s.tokenTable(ownerType)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []*models.Token
+	err = database.QueryContext(ctx, db, database.TimeoutSimpleSelect, func(rows *sql.Rows) error {
+		token, err := scanToken(rows, ownerType)
+		if err == nil {
+			tokens = append(tokens, token)
+		}
+		return err
+	}, "SELECT "+fmt.Sprintf(tokenColumns, ownerColumn)+" FROM "+table+" ORDER BY created_at DESC, id DESC")
+	return tokens, err
+}
+
+// CreateToken stores a token built by the caller (TokenHash and
+// TokenPrefix set, never the plaintext) and sets its ID
+func (s *SQL) CreateToken(ctx context.Context, token *models.Token) error {
+	db, table, ownerColumn, err := s.tokenTable(token.OwnerType)
+	if err != nil {
+		return err
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	result, err := database.ExecContext(ctx, db, database.TimeoutWrite, `
+		INSERT INTO `+table+` (`+ownerColumn+`, name, token_hash, token_prefix, scopes, expires_at, created_at,
+			allowed_ips, location_id, rate_limit, daily_quota)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, token.OwnerID, token.Name, token.TokenHash, token.TokenPrefix, token.Scope, token.ExpiresAt, token.CreatedAt,
+		strings.Join(token.AllowedIPs, ","), token.LocationID, token.RateLimit, token.DailyQuota)
+	if err != nil {
+		return fmt.Errorf("failed to insert token: %w", err)
+	}
+	if token.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("failed to get token id: %w", err)
+	}
+	return nil
+}
+
+// DeleteToken revokes one of an owner's tokens
+func (s *SQL) DeleteToken(ctx context.Context, ownerType string, ownerID, id int64) error {
+	db, table, ownerColumn, err := s.tokenTable(ownerType)
+	if err != nil {
+		return err
+	}
+	return execOne(ctx, db, "DELETE FROM "+table+" WHERE id = ? AND "+ownerColumn+" = ?", id, ownerID)
+}
+
+// DeleteExpiredTokens removes expired user, admin and organization tokens
+func (s *SQL) DeleteExpiredTokens(ctx context.Context) (int64, error) {
+	var removed int64
+	for _, ownerType := range []string{models.OwnerTypeUser, models.OwnerTypeAdmin, models.OwnerTypeOrg} {
+		db, table, _, _ := s.tokenTable(ownerType)
+		n, err := exec(ctx, db, "DELETE FROM "+table+" WHERE expires_at IS NOT NULL AND expires_at < ?", time.Now())
+		if err != nil {
+			return removed, fmt.Errorf("failed to delete expired %s tokens: %w", ownerType, err)
+		}
+		removed += n
+	}
+	return removed, nil
+}
+
+// User preference operations
+
+// GetUserPreferences returns a user's preferences
+func (s *SQL) GetUserPreferences(ctx context.Context, userID int64) (*models.UserPreferences, error) {
+	p := &models.UserPreferences{}
+	var theme, language, timezone, temperatureUnit, pressureUnit, windSpeedUnit, precipitationUnit sql.NullString
+	err := queryRow(ctx, s.users, func(row scanner) error {
+		return row.Scan(&p.UserID, &theme, &language, &timezone, &temperatureUnit, &pressureUnit, &windSpeedUnit,
+			&precipitationUnit, &p.NotificationsEnabled, &p.EmailNotifications, &p.CreatedAt, &p.UpdatedAt)
+	}, `
+		SELECT user_id, theme, language, timezone, temperature_unit, pressure_unit, wind_speed_unit,
+			precipitation_unit, notifications_enabled, email_notifications, created_at, updated_at
+		FROM user_preferences WHERE user_id = ?
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	p.Theme, p.Language, p.Timezone = theme.String, language.String, timezone.String
+	p.TemperatureUnit, p.PressureUnit = temperatureUnit.String, pressureUnit.String
+	p.WindSpeedUnit, p.PrecipitationUnit = windSpeedUnit.String, precipitationUnit.String
+	return p, nil
+}
+
+// SaveUserPreferences inserts or replaces a user's preferences
+func (s *SQL) SaveUserPreferences(ctx context.Context, p *models.UserPreferences) error {
+	now := time.Now()
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = now
+	}
+	p.UpdatedAt = now
+	_, err := exec(ctx, s.users, `
+		INSERT INTO user_preferences (user_id, theme, language, timezone, temperature_unit, pressure_unit,
+			wind_speed_unit, precipitation_unit, notifications_enabled, email_notifications, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			theme = excluded.theme, language = excluded.language, timezone = excluded.timezone,
+			temperature_unit = excluded.temperature_unit, pressure_unit = excluded.pressure_unit,
+			wind_speed_unit = excluded.wind_speed_unit, precipitation_unit = excluded.precipitation_unit,
+			notifications_enabled = excluded.notifications_enabled,
+			email_notifications = excluded.email_notifications, updated_at = excluded.updated_at
+	`, p.UserID, p.Theme, p.Language, p.Timezone, p.TemperatureUnit, p.PressureUnit, p.WindSpeedUnit,
+		p.PrecipitationUnit, p.NotificationsEnabled, p.EmailNotifications, p.CreatedAt, p.UpdatedAt)
+	return err
+}
+
+// Location operations
+
+const locationColumns = "id, user_id, name, latitude, longitude, timezone, alerts_enabled, created_at, updated_at"
+
+func scanLocation(row scanner) (*models.SavedLocation, error) {
+	l := &models.SavedLocation{}
+	var timezone sql.NullString
+	err := row.Scan(&l.ID, &l.UserID, &l.Name, &l.Latitude, &l.Longitude, &timezone, &l.AlertsEnabled,
+		&l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	l.Timezone = timezone.String
+	return l, nil
+}
+
+// GetLocation returns a saved location
+func (s *SQL) GetLocation(ctx context.Context, id int64) (*models.SavedLocation, error) {
+	var location *models.SavedLocation
+	err := queryRow(ctx, s.users, func(row scanner) (err error) {
+		location, err = scanLocation(row)
+		return err
+	}, "SELECT "+locationColumns+" FROM user_saved_locations WHERE id = ?", id)
+	return location, err
+}
+
+// ListUserLocations returns a user's saved locations, newest first
+func (s *SQL) ListUserLocations(ctx context.Context, userID int64) ([]*models.SavedLocation, error) {
+	var locations []*models.SavedLocation
+	err := database.QueryContext(ctx, s.users, database.TimeoutSimpleSelect, func(rows *sql.Rows) error {
+		location, err := scanLocation(rows)
+		if err == nil {
+			locations = append(locations, location)
+		}
+		return err
+	}, "SELECT "+locationColumns+" FROM user_saved_locations WHERE user_id = ? ORDER BY created_at DESC, id DESC", userID)
+	return locations, err
+}
+
+// ListAlertLocations returns the saved locations with weather alerts
+// enabled whose owner still exists
+func (s *SQL) ListAlertLocations(ctx context.Context) ([]*models.SavedLocation, error) {
+	var locations []*models.SavedLocation
+	err := database.QueryContext(ctx, s.users, database.TimeoutComplexSelect, func(rows *sql.Rows) error {
+		location, err := scanLocation(rows)
+		if err == nil {
+			locations = append(locations, location)
+		}
+		return err
+	}, `
+		SELECT l.id, l.user_id, l.name, l.latitude, l.longitude, l.timezone, l.alerts_enabled, l.created_at, l.updated_at
+		FROM user_saved_locations l
+		JOIN user_accounts u ON l.user_id = u.id
+		WHERE l.alerts_enabled = ?
+		ORDER BY l.id
+	`, true)
+	return locations, err
+}
+
+// CountUserLocations counts a user's saved locations
+func (s *SQL) CountUserLocations(ctx context.Context, userID int64) (int, error) {
+	return count(ctx, s.users, "SELECT COUNT(*) FROM user_saved_locations WHERE user_id = ?", userID)
+}
+
+// CreateLocation inserts a saved location and sets its ID and timestamps
+func (s *SQL) CreateLocation(ctx context.Context, location *models.SavedLocation) error {
+	now := time.Now()
+	result, err := database.ExecContext(ctx, s.users, database.TimeoutWrite, `
+		INSERT INTO user_saved_locations (user_id, name, latitude, longitude, timezone, alerts_enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, location.UserID, location.Name, location.Latitude, location.Longitude, location.Timezone,
+		location.AlertsEnabled, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to create location: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	location.ID = int(id)
+	location.CreatedAt, location.UpdatedAt = now, now
+	return nil
+}
+
+// UpdateLocation writes a saved location's name, coordinates, timezone and
+// alert setting
+func (s *SQL) UpdateLocation(ctx context.Context, location *models.SavedLocation) error {
+	location.UpdatedAt = time.Now()
+	return execOne(ctx, s.users, `
+		UPDATE user_saved_locations
+		SET name = ?, latitude = ?, longitude = ?, timezone = ?, alerts_enabled = ?, updated_at = ?
+		WHERE id = ?
+	`, location.Name, location.Latitude, location.Longitude, location.Timezone, location.AlertsEnabled,
+		location.UpdatedAt, location.ID)
+}
+
+// DeleteLocation deletes a saved location
+func (s *SQL) DeleteLocation(ctx context.Context, id int64) error {
+	return execOne(ctx, s.users, "DELETE FROM user_saved_locations WHERE id = ?", id)
+}
+
+// Notification operations
+
+const notificationColumns = "id, user_id, type, display, title, message, action_json, read, dismissed, created_at, expires_at"
+
+func scanNotification(row scanner) (*models.Notification, error) {
+	n := &models.Notification{}
+	var userID int
+	var actionJSON sql.NullString
+	var expiresAt sql.NullTime
+	err := row.Scan(&n.ID, &userID, &n.Type, &n.Display, &n.Title, &n.Message, &actionJSON, &n.Read,
+		&n.Dismissed, &n.CreatedAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	n.UserID = &userID
+	n.IsRead = n.Read
+	n.UpdatedAt = n.CreatedAt
+	if actionJSON.String != "" {
+		var action models.NotificationAction
+		if err := json.Unmarshal([]byte(actionJSON.String), &action); err == nil {
+			n.Action = &action
+		}
+	}
+	if expiresAt.Valid {
+		n.ExpiresAt = &expiresAt.Time
+	}
+	return n, nil
+}
+
+// GetNotification returns a user notification
+func (s *SQL) GetNotification(ctx context.Context, id string) (*models.Notification, error) {
+	var notification *models.Notification
+	err := queryRow(ctx, s.users, func(row scanner) (err error) {
+		notification, err = scanNotification(row)
+		return err
+	}, "SELECT "+notificationColumns+" FROM user_notifications WHERE id = ?", id)
+	return notification, err
+}
+
+// ListUserNotifications returns a page of a user's notifications, newest
+// first
+func (s *SQL) ListUserNotifications(ctx context.Context, userID int64, unreadOnly bool, limit, offset int) ([]*models.Notification, error) {
+	where, args := notificationFilter(userID, unreadOnly)
+	var notifications []*models.Notification
+	err := database.QueryContext(ctx, s.users, database.TimeoutSimpleSelect, func(rows *sql.Rows) error {
+		notification, err := scanNotification(rows)
+		if err == nil {
+			notifications = append(notifications, notification)
+		}
+		return err
+	}, "SELECT "+notificationColumns+" FROM user_notifications WHERE "+where+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...)
+	return notifications, err
+}
+
+// CountUserNotifications counts a user's notifications
+func (s *SQL) CountUserNotifications(ctx context.Context, userID int64, unreadOnly bool) (int, error) {
+	where, args := notificationFilter(userID, unreadOnly)
+	return count(ctx, s.users, "SELECT COUNT(*) FROM user_notifications WHERE "+where, args...)
+}
+
+func notificationFilter(userID int64, unreadOnly bool) (string, []interface{}) {
+	if unreadOnly {
+		return "user_id = ? AND read = ?", []interface{}{userID, false}
+	}
+	return "user_id = ?", []interface{}{userID}
+}
+
+// CreateNotification inserts a user notification, filling in the ID,
+// display, creation time and 30 day expiry when unset
+// TEMPLATE.md Part 25: Notifications expire after 30 days
+func (s *SQL) CreateNotification(ctx context.Context, notification *models.Notification) error {
+	if notification.UserID == nil {
+		return fmt.Errorf("notification has no user")
+	}
+	prepareNotification(notification)
+	var actionJSON interface{}
+	if notification.Action != nil {
+		encoded, err := json.Marshal(notification.Action)
+		if err != nil {
+			return fmt.Errorf("failed to encode action: %w", err)
+		}
+		actionJSON = string(encoded)
+	}
+	_, err := exec(ctx, s.users, `
+		INSERT INTO user_notifications (id, user_id, type, display, title, message, action_json, read, dismissed, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, notification.ID, *notification.UserID, notification.Type, notification.Display, notification.Title,
+		notification.Message, actionJSON, notification.Read, notification.Dismissed, notification.CreatedAt,
+		notification.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create user notification: %w", err)
+	}
+	return nil
+}
+
+// prepareNotification fills in the defaults CreateNotification applies
+func prepareNotification(n *models.Notification) {
+	if n.ID == "" {
+		n.ID = ulid.Make().String()
+	}
+	if n.Display == "" {
+		n.Display = models.NotificationDisplayToast
+	}
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+	n.UpdatedAt = n.CreatedAt
+	if n.ExpiresAt == nil {
+		expiresAt := n.CreatedAt.AddDate(0, 0, 30)
+		n.ExpiresAt = &expiresAt
+	}
+}
+
+// MarkNotificationRead marks a user notification read
+func (s *SQL) MarkNotificationRead(ctx context.Context, id string) error {
+	return execOne(ctx, s.users, "UPDATE user_notifications SET read = ? WHERE id = ?", true, id)
+}
+
+// MarkAllNotificationsRead marks every unread notification of a user read
+func (s *SQL) MarkAllNotificationsRead(ctx context.Context, userID int64) (int64, error) {
+	return exec(ctx, s.users, "UPDATE user_notifications SET read = ? WHERE user_id = ? AND read = ?", true, userID, false)
+}
+
+// DeleteNotification deletes a user notification
+func (s *SQL) DeleteNotification(ctx context.Context, id string) error {
+	return execOne(ctx, s.users, "DELETE FROM user_notifications WHERE id = ?", id)
+}
+
+// DeleteExpiredNotifications removes expired user notifications
+func (s *SQL) DeleteExpiredNotifications(ctx context.Context) (int64, error) {
+	return exec(ctx, s.users, "DELETE FROM user_notifications WHERE expires_at <= ?", time.Now())
+}
+
+// Email verification and password reset operations
+
+// GetEmailVerification returns an email verification by token, expired or
+// not; callers check ExpiresAt
+func (s *SQL) GetEmailVerification(ctx context.Context, token string) (*models.UserEmailVerification, error) {
+	v := &models.UserEmailVerification{}
+	var usedAt sql.NullTime
+	err := queryRow(ctx, s.users, func(row scanner) error {
+		return row.Scan(&v.ID, &v.UserID, &v.Email, &v.Token, &v.CreatedAt, &v.ExpiresAt, &usedAt)
+	}, "SELECT id, user_id, email, token, created_at, expires_at, used_at FROM user_email_verifications WHERE token = ?", token)
+	if err != nil {
+		return nil, err
+	}
+	if usedAt.Valid {
+		v.UsedAt = &usedAt.Time
+	}
+	return v, nil
+}
+
+// CreateEmailVerification inserts an email verification and sets its ID
+// and creation time
+func (s *SQL) CreateEmailVerification(ctx context.Context, verification *models.UserEmailVerification) error {
+	verification.CreatedAt = time.Now()
+	result, err := database.ExecContext(ctx, s.users, database.TimeoutWrite, `
+		INSERT INTO user_email_verifications (user_id, email, token, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, verification.UserID, verification.Email, verification.Token, verification.CreatedAt, verification.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create email verification: %w", err)
+	}
+	verification.ID, err = result.LastInsertId()
+	return err
+}
+
+// DeleteEmailVerification deletes an email verification
+func (s *SQL) DeleteEmailVerification(ctx context.Context, id int64) error {
+	return execOne(ctx, s.users, "DELETE FROM user_email_verifications WHERE id = ?", id)
+}
+
+// GetPasswordReset returns a password reset by token, expired or not;
+// callers check ExpiresAt
+func (s *SQL) GetPasswordReset(ctx context.Context, token string) (*models.UserPasswordReset, error) {
+	r := &models.UserPasswordReset{}
+	var ipAddress sql.NullString
+	var usedAt sql.NullTime
+	err := queryRow(ctx, s.users, func(row scanner) error {
+		return row.Scan(&r.ID, &r.UserID, &r.Token, &ipAddress, &r.CreatedAt, &r.ExpiresAt, &usedAt)
+	}, "SELECT id, user_id, token, ip_address, created_at, expires_at, used_at FROM user_password_resets WHERE token = ?", token)
+	if err != nil {
+		return nil, err
+	}
+	r.IPAddress = ipAddress.String
+	if usedAt.Valid {
+		r.UsedAt = &usedAt.Time
+	}
+	return r, nil
+}
+
+// CreatePasswordReset inserts a password reset and sets its ID and
+// creation time
+func (s *SQL) CreatePasswordReset(ctx context.Context, reset *models.UserPasswordReset) error {
+	reset.CreatedAt = time.Now()
+	result, err := database.ExecContext(ctx, s.users, database.TimeoutWrite, `
+		INSERT INTO user_password_resets (user_id, token, ip_address, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, reset.UserID, reset.Token, nullString(reset.IPAddress), reset.CreatedAt, reset.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset: %w", err)
+	}
+	reset.ID, err = result.LastInsertId()
+	return err
+}
+
+// DeletePasswordReset deletes a password reset
+func (s *SQL) DeletePasswordReset(ctx context.Context, id int64) error {
+	return execOne(ctx, s.users, "DELETE FROM user_password_resets WHERE id = ?", id)
+}
+
+// Settings operations
+
+func scanSetting(row scanner) (*models.Setting, error) {
+	setting := &models.Setting{}
+	var value, settingType, description sql.NullString
+	var updatedAt sql.NullTime
+	if err := row.Scan(&setting.Key, &value, &settingType, &description, &updatedAt); err != nil {
+		return nil, err
+	}
+	setting.Value = value.String
+	setting.Type = settingType.String
+	setting.Description = description.String
+	setting.Category, _, _ = strings.Cut(setting.Key, ".")
+	setting.UpdatedAt = updatedAt.Time
+	return setting, nil
+}
+
+// GetSetting returns a server_config setting
+func (s *SQL) GetSetting(ctx context.Context, key string) (*models.Setting, error) {
+	var setting *models.Setting
+	err := queryRow(ctx, s.server, func(row scanner) (err error) {
+		setting, err = scanSetting(row)
+		return err
+	}, "SELECT key, value, type, description, updated_at FROM server_config WHERE key = ?", key)
+	return setting, err
+}
+
+// ListSettings returns every server_config setting by key
+func (s *SQL) ListSettings(ctx context.Context) ([]*models.Setting, error) {
+	var settings []*models.Setting
+	err := database.QueryContext(ctx, s.server, database.TimeoutSimpleSelect, func(rows *sql.Rows) error {
+		setting, err := scanSetting(rows)
+		if err == nil {
+			settings = append(settings, setting)
+		}
+		return err
+	}, "SELECT key, value, type, description, updated_at FROM server_config ORDER BY key")
+	return settings, err
+}
+
+// UpdateSetting changes the value of an existing setting
+func (s *SQL) UpdateSetting(ctx context.Context, key, value string) error {
+	return execOne(ctx, s.server, "UPDATE server_config SET value = ?, updated_at = ? WHERE key = ?", value, time.Now(), key)
+}
+
+// UpsertSetting stores a setting, adding it with its type and description
+// when missing. An existing setting only has its value changed
+func (s *SQL) UpsertSetting(ctx context.Context, setting *models.Setting) error {
+	if setting.Type == "" {
+		setting.Type = "string"
+	}
+	setting.UpdatedAt = time.Now()
+	_, err := exec(ctx, s.server, `
+		INSERT INTO server_config (key, value, type, description, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, setting.Key, setting.Value, setting.Type, nullString(setting.Description), setting.UpdatedAt)
+	return err
+}
+
+// DeleteSettings removes every server_config setting, before the defaults
+// are seeded again
+func (s *SQL) DeleteSettings(ctx context.Context) (int64, error) {
+	return exec(ctx, s.server, "DELETE FROM server_config")
+}
+
+// Audit log operations
+
+// ListAuditLog returns the newest server audit log entries
+func (s *SQL) ListAuditLog(ctx context.Context, limit int) ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+	err := database.QueryContext(ctx, s.server, database.TimeoutSimpleSelect, func(rows *sql.Rows) error {
+		e := &AuditEntry{}
+		var timestamp sql.NullTime
+		var actorType, actorID, resourceType, resourceID, details, ipAddress, userAgent, status, errMsg sql.NullString
+		if err := rows.Scan(&e.ID, &timestamp, &actorType, &actorID, &e.Action, &resourceType, &resourceID,
+			&details, &ipAddress, &userAgent, &status, &errMsg); err != nil {
+			return err
+		}
+		e.Timestamp = timestamp.Time
+		e.ActorType, e.ActorID = actorType.String, actorID.String
+		e.ResourceType, e.ResourceID = resourceType.String, resourceID.String
+		e.Details, e.IPAddress, e.UserAgent = details.String, ipAddress.String, userAgent.String
+		e.Status, e.Error = status.String, errMsg.String
+		entries = append(entries, e)
+		return nil
+	}, `
+		SELECT id, timestamp, actor_type, actor_id, action, resource_type, resource_id,
+			details, ip_address, user_agent, status, error
+		FROM server_audit_log
+		ORDER BY timestamp DESC, id DESC
+		LIMIT ?
+	`, limit)
+	return entries, err
+}
+
+// DeleteAuditLogBefore removes audit log entries older than cutoff
+func (s *SQL) DeleteAuditLogBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	return exec(ctx, s.server, "DELETE FROM server_audit_log WHERE timestamp < ?", cutoff)
+}
+
+const notificationChannelColumns = `channel_type, channel_name, enabled, state, config, last_test_at,
+	last_success_at, last_error, failure_count, created_at, updated_at`
+
+func scanNotificationChannel(row scanner) (*NotificationChannel, error) {
+	ch := &NotificationChannel{}
+	var enabled sql.NullBool
+	var state, config, lastError sql.NullString
+	var lastTestAt, lastSuccessAt, createdAt, updatedAt sql.NullTime
+	var failureCount sql.NullInt64
+	if err := row.Scan(&ch.Type, &ch.Name, &enabled, &state, &config, &lastTestAt, &lastSuccessAt,
+		&lastError, &failureCount, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	ch.Enabled, ch.State, ch.Config = enabled.Bool, state.String, config.String
+	ch.LastError, ch.FailureCount = lastError.String, int(failureCount.Int64)
+	ch.CreatedAt, ch.UpdatedAt = createdAt.Time, updatedAt.Time
+	if lastTestAt.Valid {
+		ch.LastTestAt = &lastTestAt.Time
+	}
+	if lastSuccessAt.Valid {
+		ch.LastSuccessAt = &lastSuccessAt.Time
+	}
+	return ch, nil
+}
+
+// ListNotificationChannels returns the server notification channels by name
+func (s *SQL) ListNotificationChannels(ctx context.Context) ([]*NotificationChannel, error) {
+	var channels []*NotificationChannel
+	err := database.QueryContext(ctx, s.server, database.TimeoutSimpleSelect, func(rows *sql.Rows) error {
+		ch, err := scanNotificationChannel(rows)
+		if err != nil {
+			return err
+		}
+		channels = append(channels, ch)
+		return nil
+	}, "SELECT "+notificationChannelColumns+" FROM server_notification_channels ORDER BY channel_name ASC")
+	return channels, err
+}
+
+// GetNotificationChannel returns a server notification channel by type
+func (s *SQL) GetNotificationChannel(ctx context.Context, channelType string) (*NotificationChannel, error) {
+	var ch *NotificationChannel
+	err := queryRow(ctx, s.server, func(row scanner) (err error) {
+		ch, err = scanNotificationChannel(row)
+		return err
+	}, "SELECT "+notificationChannelColumns+" FROM server_notification_channels WHERE channel_type = ?", channelType)
+	return ch, err
+}
+
+// UpdateNotificationChannel enables or disables a channel and replaces its
+// JSON configuration
+func (s *SQL) UpdateNotificationChannel(ctx context.Context, channelType string, enabled bool, config string) error {
+	return execOne(ctx, s.server, `
+		UPDATE server_notification_channels
+		SET enabled = ?, config = ?, updated_at = ?
+		WHERE channel_type = ?
+	`, enabled, config, time.Now(), channelType)
+}
+
+// NotificationQueueStats counts the delivery queue by state and by channel
+func (s *SQL) NotificationQueueStats(ctx context.Context) (*NotificationQueueStats, error) {
+	stats := &NotificationQueueStats{ByChannel: make(map[string]int)}
+	err := database.QueryContext(ctx, s.server, database.TimeoutComplexSelect, func(rows *sql.Rows) error {
+		var channelType, state string
+		var n int
+		if err := rows.Scan(&channelType, &state, &n); err != nil {
+			return err
+		}
+		stats.Total += n
+		stats.ByChannel[channelType] += n
+		switch state {
+		case "created", "queued":
+			stats.Pending += n
+		case "sending":
+			stats.Sending += n
+		case "delivered":
+			stats.Delivered += n
+		case "failed":
+			stats.Failed += n
+		case "dead_letter":
+			stats.DeadLetters += n
+		}
+		return nil
+	}, "SELECT channel_type, state, COUNT(*) FROM notification_queue GROUP BY channel_type, state")
+	return stats, err
+}
+
+// ListNotificationHistory returns the latest deliveries, optionally only
+// those of a channel or with a status
+func (s *SQL) ListNotificationHistory(ctx context.Context, channelType, status string, limit int) ([]*NotificationDelivery, error) {
+	query := `
+		SELECT id, queue_id, user_id, channel_type, status, subject, created_at, delivered_at, error_message
+		FROM notification_history
+		WHERE 1=1`
+	var args []interface{}
+	if channelType != "" {
+		query += " AND channel_type = ?"
+		args = append(args, channelType)
+	}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	var history []*NotificationDelivery
+	err := database.QueryContext(ctx, s.server, database.TimeoutSimpleSelect, func(rows *sql.Rows) error {
+		d := &NotificationDelivery{}
+		var queueID, userID sql.NullInt64
+		var subject, errMsg sql.NullString
+		var sentAt, deliveredAt sql.NullTime
+		if err := rows.Scan(&d.ID, &queueID, &userID, &d.ChannelType, &d.Status, &subject, &sentAt,
+			&deliveredAt, &errMsg); err != nil {
+			return err
+		}
+		if queueID.Valid {
+			d.QueueID = &queueID.Int64
+		}
+		if userID.Valid {
+			d.UserID = &userID.Int64
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		d.Subject, d.SentAt, d.ErrorMessage = subject.String, sentAt.Time, errMsg.String
+		history = append(history, d)
+		return nil
+	}, query, args...)
+	return history, err
+}
+
+// Stats counts the users database rows shown on the admin dashboards
+func (s *SQL) Stats(ctx context.Context) (*Stats, error) {
+	stats := &Stats{}
+	for _, c := range []struct {
+		table string
+		n     *int
+	}{
+		{"user_accounts", &stats.Users},
+		{"user_saved_locations", &stats.Locations},
+		{"user_tokens", &stats.Tokens},
+		{"user_sessions", &stats.Sessions},
+		{"user_notifications", &stats.Notifications},
+	} {
+		n, err := count(ctx, s.users, "SELECT COUNT(*) FROM "+c.table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", c.table, err)
+		}
+		*c.n = n
+	}
+	return stats, nil
+}
+
+// Ping checks both database connections
+func (s *SQL) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, database.TimeoutPing)
+	defer cancel()
+	if err := s.server.PingContext(ctx); err != nil {
+		return fmt.Errorf("server database: %w", err)
+	}
+	if err := s.users.PingContext(ctx); err != nil {
+		return fmt.Errorf("users database: %w", err)
+	}
+	return nil
+}
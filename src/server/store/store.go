@@ -1,65 +1,182 @@
+// Package store is the data access layer for the server and users
+// databases. Handlers and scheduler tasks take a Store so their logic can be
+// tested against the in-memory Memory store instead of a database file
 package store
 
 import (
 	"context"
-	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/apimgr/weather/src/server/model"
 )
 
-// Store defines the interface for data access operations
+// ErrNotFound is returned when a lookup, update or delete matches no row
+var ErrNotFound = errors.New("not found")
+
+// MaxLocationsPerUser is how many locations a user can save (IDEA.md)
+const MaxLocationsPerUser = 10
+
+// Store defines the data access operations handlers and tasks use
 // Per AI.md specification: separate data access layer from business logic
 type Store interface {
-	// User operations
-	GetUserByID(ctx context.Context, id int64) (interface{}, error)
-	GetUserByEmail(ctx context.Context, email string) (interface{}, error)
-	CreateUser(ctx context.Context, user interface{}) error
-	UpdateUser(ctx context.Context, user interface{}) error
+	// User operations (users database)
+	GetUserByID(ctx context.Context, id int64) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	CreateUser(ctx context.Context, user *models.User) error
+	UpdateUser(ctx context.Context, user *models.User) error
 	DeleteUser(ctx context.Context, id int64) error
-	ListUsers(ctx context.Context, limit, offset int) ([]interface{}, error)
+	ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error)
+	CountUsers(ctx context.Context, role string) (int, error)
 
-	// Admin operations
-	GetAdminByID(ctx context.Context, id int64) (interface{}, error)
-	GetAdminByEmail(ctx context.Context, email string) (interface{}, error)
-	CreateAdmin(ctx context.Context, admin interface{}) error
-	UpdateAdmin(ctx context.Context, admin interface{}) error
+	// Admin operations (server database)
+	GetAdminByID(ctx context.Context, id int64) (*models.Admin, error)
+	GetAdminByEmail(ctx context.Context, email string) (*models.Admin, error)
+	GetAdminByUsername(ctx context.Context, username string) (*models.Admin, error)
+	CreateAdmin(ctx context.Context, admin *models.Admin) error
+	UpdateAdmin(ctx context.Context, admin *models.Admin) error
 	DeleteAdmin(ctx context.Context, id int64) error
-	ListAdmins(ctx context.Context) ([]interface{}, error)
-
-	// Session operations
-	GetSession(ctx context.Context, token string) (interface{}, error)
-	CreateSession(ctx context.Context, session interface{}) error
-	UpdateSession(ctx context.Context, session interface{}) error
-	DeleteSession(ctx context.Context, token string) error
-	DeleteExpiredSessions(ctx context.Context) error
-
-	// Token operations
-	GetToken(ctx context.Context, token string) (interface{}, error)
-	CreateToken(ctx context.Context, token interface{}) error
-	DeleteToken(ctx context.Context, token string) error
-	DeleteExpiredTokens(ctx context.Context) error
-
-	// Location operations
-	GetLocation(ctx context.Context, id int64) (interface{}, error)
-	ListUserLocations(ctx context.Context, userID int64) ([]interface{}, error)
-	CreateLocation(ctx context.Context, location interface{}) error
-	UpdateLocation(ctx context.Context, location interface{}) error
+	ListAdmins(ctx context.Context) ([]*models.Admin, error)
+	SetAdminAPIToken(ctx context.Context, id int64, tokenHash, tokenPrefix string) error
+	CreateAdminSession(ctx context.Context, session *models.AdminSession) error
+
+	// User web session operations
+	GetSession(ctx context.Context, id string) (*models.Session, error)
+	CreateSession(ctx context.Context, session *models.Session) error
+	DeleteSession(ctx context.Context, id string) error
+	DeleteUserSessions(ctx context.Context, userID int64) (int64, error)
+	DeleteExpiredSessions(ctx context.Context) (int64, error)
+
+	// API token operations; the owner type picks the user or admin table
+	GetTokenByHash(ctx context.Context, ownerType, tokenHash string) (*models.Token, error)
+	ListTokens(ctx context.Context, ownerType string, ownerID int64) ([]*models.Token, error)
+	ListTokensByType(ctx context.Context, ownerType string) ([]*models.Token, error)
+	CreateToken(ctx context.Context, token *models.Token) error
+	DeleteToken(ctx context.Context, ownerType string, ownerID, id int64) error
+	DeleteExpiredTokens(ctx context.Context) (int64, error)
+
+	// User preference operations
+	GetUserPreferences(ctx context.Context, userID int64) (*models.UserPreferences, error)
+	SaveUserPreferences(ctx context.Context, prefs *models.UserPreferences) error
+
+	// Saved location operations
+	GetLocation(ctx context.Context, id int64) (*models.SavedLocation, error)
+	ListUserLocations(ctx context.Context, userID int64) ([]*models.SavedLocation, error)
+	ListAlertLocations(ctx context.Context) ([]*models.SavedLocation, error)
+	CountUserLocations(ctx context.Context, userID int64) (int, error)
+	CreateLocation(ctx context.Context, location *models.SavedLocation) error
+	UpdateLocation(ctx context.Context, location *models.SavedLocation) error
 	DeleteLocation(ctx context.Context, id int64) error
 
-	// Notification operations
-	GetNotification(ctx context.Context, id int64) (interface{}, error)
-	ListUserNotifications(ctx context.Context, userID int64, limit int) ([]interface{}, error)
-	CreateNotification(ctx context.Context, notification interface{}) error
-	DeleteNotification(ctx context.Context, id int64) error
-	DeleteOldNotifications(ctx context.Context, maxAge int) error
+	// User WebUI notification operations
+	GetNotification(ctx context.Context, id string) (*models.Notification, error)
+	ListUserNotifications(ctx context.Context, userID int64, unreadOnly bool, limit, offset int) ([]*models.Notification, error)
+	CountUserNotifications(ctx context.Context, userID int64, unreadOnly bool) (int, error)
+	CreateNotification(ctx context.Context, notification *models.Notification) error
+	MarkNotificationRead(ctx context.Context, id string) error
+	MarkAllNotificationsRead(ctx context.Context, userID int64) (int64, error)
+	DeleteNotification(ctx context.Context, id string) error
+	DeleteExpiredNotifications(ctx context.Context) (int64, error)
+
+	// Email verification and password reset token operations
+	GetEmailVerification(ctx context.Context, token string) (*models.UserEmailVerification, error)
+	CreateEmailVerification(ctx context.Context, verification *models.UserEmailVerification) error
+	DeleteEmailVerification(ctx context.Context, id int64) error
+	GetPasswordReset(ctx context.Context, token string) (*models.UserPasswordReset, error)
+	CreatePasswordReset(ctx context.Context, reset *models.UserPasswordReset) error
+	DeletePasswordReset(ctx context.Context, id int64) error
+
+	// Server settings (server_config) operations
+	GetSetting(ctx context.Context, key string) (*models.Setting, error)
+	ListSettings(ctx context.Context) ([]*models.Setting, error)
+	UpdateSetting(ctx context.Context, key, value string) error
+	UpsertSetting(ctx context.Context, setting *models.Setting) error
+	DeleteSettings(ctx context.Context) (int64, error)
 
-	// Settings operations
-	GetSettings(ctx context.Context) (interface{}, error)
-	UpdateSettings(ctx context.Context, settings interface{}) error
+	// Server audit log operations
+	ListAuditLog(ctx context.Context, limit int) ([]*AuditEntry, error)
+	DeleteAuditLogBefore(ctx context.Context, cutoff time.Time) (int64, error)
 
-	// Transaction support
-	Begin(ctx context.Context) (*sql.Tx, error)
-	Commit(tx *sql.Tx) error
-	Rollback(tx *sql.Tx) error
+	// Server notification channel and delivery queue operations
+	ListNotificationChannels(ctx context.Context) ([]*NotificationChannel, error)
+	GetNotificationChannel(ctx context.Context, channelType string) (*NotificationChannel, error)
+	UpdateNotificationChannel(ctx context.Context, channelType string, enabled bool, config string) error
+	NotificationQueueStats(ctx context.Context) (*NotificationQueueStats, error)
+	ListNotificationHistory(ctx context.Context, channelType, status string, limit int) ([]*NotificationDelivery, error)
+
+	// Row counts for the admin dashboards
+	Stats(ctx context.Context) (*Stats, error)
 
 	// Health check
 	Ping(ctx context.Context) error
 }
+
+// Stats counts the rows behind the admin dashboard totals
+type Stats struct {
+	Users         int `json:"users"`
+	Locations     int `json:"locations"`
+	Tokens        int `json:"tokens"`
+	Sessions      int `json:"sessions"`
+	Notifications int `json:"notifications"`
+}
+
+// AuditEntry is a row of the server audit log
+type AuditEntry struct {
+	ID           int64     `json:"id"`
+	Timestamp    time.Time `json:"timestamp"`
+	ActorType    string    `json:"actor_type,omitempty"`
+	ActorID      string    `json:"actor_id,omitempty"`
+	Action       string    `json:"action"`
+	ResourceType string    `json:"resource_type,omitempty"`
+	ResourceID   string    `json:"resource_id,omitempty"`
+	Details      string    `json:"details,omitempty"`
+	IPAddress    string    `json:"ip_address,omitempty"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	Status       string    `json:"status,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// NotificationChannel is the configuration and health of a server
+// notification channel
+type NotificationChannel struct {
+	Type          string     `json:"channel_type"`
+	Name          string     `json:"channel_name"`
+	Enabled       bool       `json:"enabled"`
+	State         string     `json:"state"`
+	Config        string     `json:"config,omitempty"`
+	LastTestAt    *time.Time `json:"last_test_at"`
+	LastSuccessAt *time.Time `json:"last_success_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	FailureCount  int        `json:"failure_count"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// NotificationQueueStats counts the notification delivery queue
+type NotificationQueueStats struct {
+	Total       int            `json:"total"`
+	Pending     int            `json:"pending"`
+	Sending     int            `json:"sending"`
+	Delivered   int            `json:"delivered"`
+	Failed      int            `json:"failed"`
+	DeadLetters int            `json:"dead_letters"`
+	ByChannel   map[string]int `json:"by_channel"`
+}
+
+// NotificationDelivery is a row of the notification delivery history
+type NotificationDelivery struct {
+	ID           int64      `json:"id"`
+	QueueID      *int64     `json:"queue_id,omitempty"`
+	UserID       *int64     `json:"user_id,omitempty"`
+	ChannelType  string     `json:"channel_type"`
+	Status       string     `json:"status"`
+	Subject      string     `json:"subject"`
+	SentAt       time.Time  `json:"sent_at"`
+	DeliveredAt  *time.Time `json:"delivered_at,omitempty"`
+	ErrorMessage string     `json:"error_message,omitempty"`
+}
+
+var (
+	_ Store = (*SQL)(nil)
+	_ Store = (*Memory)(nil)
+)
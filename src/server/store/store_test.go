@@ -0,0 +1,418 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/apimgr/weather/src/database"
+	"github.com/apimgr/weather/src/server/model"
+	"github.com/oklog/ulid/v2"
+)
+
+// openSQLStore returns a SQL store over freshly migrated server and users
+// databases. Set WEATHER_TEST_DATABASE_URL to a postgres:// or mysql:// URL
+// to run against that server; unset, the databases are in-memory SQLite
+func openSQLStore(t *testing.T) *SQL {
+	t.Helper()
+	url := os.Getenv("WEATHER_TEST_DATABASE_URL")
+	if url == "" {
+		url = "sqlite:"
+	}
+	open := func(name string) (*sql.DB, database.Dialect) {
+		db, dialect, cleanup, err := database.OpenScratchDB(url, fmt.Sprintf("%s_%s_%d", t.Name(), name, os.Getpid()))
+		if err != nil {
+			t.Fatalf("Failed to open test database: %v", err)
+		}
+		t.Cleanup(cleanup)
+		if err := database.MigrateDatabase(db, dialect, name, nil); err != nil {
+			t.Fatalf("Failed to migrate %s database: %v", name, err)
+		}
+		return db, dialect
+	}
+	server, dialect := open(database.MigrationsServer)
+	users, _ := open(database.MigrationsUsers)
+	return &SQL{server: server, users: users, dialect: dialect}
+}
+
+func TestSQLStore(t *testing.T) {
+	s := openSQLStore(t)
+	// server_config is seeded by the setup wizard; add a row to update
+	if _, err := s.server.Exec(`INSERT INTO server_config (key, value, type, description) VALUES ('server.title', 'Weather', 'string', 'Site title')`); err != nil {
+		t.Fatal(err)
+	}
+	// The audit logger, channel manager and delivery system write these
+	old := time.Now().AddDate(0, 0, -40)
+	for _, q := range []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT INTO server_audit_log (ulid, timestamp, actor_type, actor_id, action) VALUES (?, ?, 'admin', '1', 'admin.login')`,
+			[]interface{}{ulid.Make().String(), old}},
+		{`INSERT INTO server_audit_log (ulid, timestamp, actor_type, actor_id, action, status) VALUES (?, ?, 'admin', '1', 'settings.update', 'success')`,
+			[]interface{}{ulid.Make().String(), time.Now()}},
+		{`INSERT INTO server_notification_channels (channel_type, channel_name, enabled, state) VALUES ('email', 'Email', 0, 'disabled')`, nil},
+		{`INSERT INTO notification_queue (channel_type, state, body) VALUES ('email', 'queued', 'a'), ('email', 'delivered', 'b'), ('sms', 'dead_letter', 'c')`, nil},
+		{`INSERT INTO notification_history (channel_type, status, subject, created_at) VALUES ('email', 'delivered', 'Storm', ?), ('sms', 'failed', 'Wind', ?)`,
+			[]interface{}{old, time.Now()}},
+	} {
+		if _, err := s.server.Exec(q.query, q.args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testStore(t, s)
+}
+
+func TestMemoryStore(t *testing.T) {
+	m := NewMemory()
+	m.SetSetting("server.title", "Weather", "string")
+	old := time.Now().AddDate(0, 0, -40)
+	m.AddAuditEntry(&AuditEntry{Timestamp: old, ActorType: "admin", ActorID: "1", Action: "admin.login"})
+	m.AddAuditEntry(&AuditEntry{ActorType: "admin", ActorID: "1", Action: "settings.update", Status: "success"})
+	m.SetNotificationChannel(&NotificationChannel{Type: "email", Name: "Email", State: "disabled"})
+	m.AddQueuedNotification("email", "queued")
+	m.AddQueuedNotification("email", "delivered")
+	m.AddQueuedNotification("sms", "dead_letter")
+	m.AddNotificationDelivery(&NotificationDelivery{ChannelType: "email", Status: "delivered", Subject: "Storm", SentAt: old})
+	m.AddNotificationDelivery(&NotificationDelivery{ChannelType: "sms", Status: "failed", Subject: "Wind"})
+	testStore(t, m)
+}
+
+// testStore checks the behaviour every Store implementation shares
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	if err := s.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &models.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash", IsActive: true}
+	if err := s.CreateUser(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	if alice.ID == 0 || alice.Role != "user" || alice.CreatedAt.IsZero() {
+		t.Fatalf("created user = %+v", alice)
+	}
+	bob := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "hash", Role: "admin"}
+	if err := s.CreateUser(ctx, bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateUser(ctx, &models.User{Username: "alice", Email: "other@example.com", PasswordHash: "hash"}); err == nil {
+		t.Error("Expected duplicate username to be rejected")
+	}
+
+	got, err := s.GetUserByEmail(ctx, "ALICE@example.com")
+	if err != nil || got.ID != alice.ID || !got.IsActive {
+		t.Fatalf("GetUserByEmail = %+v, %v", got, err)
+	}
+	got.DisplayName = "Alice"
+	got.Role = "admin"
+	if err := s.UpdateUser(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = s.GetUserByID(ctx, alice.ID); got.DisplayName != "Alice" || got.Role != "admin" {
+		t.Errorf("updated user = %+v", got)
+	}
+	if n, _ := s.CountUsers(ctx, "admin"); n != 2 {
+		t.Errorf("CountUsers(admin) = %d, want 2", n)
+	}
+	users, err := s.ListUsers(ctx, 1, 1)
+	if err != nil || len(users) != 1 || users[0].ID != alice.ID {
+		t.Errorf("ListUsers(1, 1) = %v, %v", users, err)
+	}
+	if _, err := s.GetUserByID(ctx, 9999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUserByID(missing) = %v, want ErrNotFound", err)
+	}
+	if err := s.UpdateUser(ctx, &models.User{ID: 9999, Username: "x", Email: "x@example.com"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateUser(missing) = %v, want ErrNotFound", err)
+	}
+
+	// Admins
+	admin := &models.Admin{Username: "root", Email: "root@example.com", PasswordHash: "hash", IsSuperAdmin: true, IsActive: true}
+	if err := s.CreateAdmin(ctx, admin); err != nil {
+		t.Fatal(err)
+	}
+	admin.IsActive = false
+	if err := s.UpdateAdmin(ctx, admin); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetAdminByEmail(ctx, "root@example.com"); err != nil || got.IsActive || !got.IsSuperAdmin {
+		t.Errorf("GetAdminByEmail = %+v, %v", got, err)
+	}
+	if admins, _ := s.ListAdmins(ctx); len(admins) != 1 {
+		t.Errorf("ListAdmins = %v", admins)
+	}
+	if got, err := s.GetAdminByUsername(ctx, "root"); err != nil || got.ID != admin.ID {
+		t.Errorf("GetAdminByUsername = %+v, %v", got, err)
+	}
+	if _, err := s.GetAdminByUsername(ctx, "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAdminByUsername(missing) = %v, want ErrNotFound", err)
+	}
+	if err := s.SetAdminAPIToken(ctx, admin.ID, "adminhash", "adm_"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetAdminAPIToken(ctx, 9999, "adminhash", "adm_"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetAdminAPIToken(missing) = %v, want ErrNotFound", err)
+	}
+	adminSession := &models.AdminSession{AdminID: admin.ID, IPAddress: "192.0.2.1", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.CreateAdminSession(ctx, adminSession); err != nil || adminSession.SessionID == "" {
+		t.Errorf("CreateAdminSession = %+v, %v", adminSession, err)
+	}
+
+	// Sessions
+	live := &models.Session{UserID: int(alice.ID), ExpiresAt: time.Now().Add(time.Hour), Data: map[string]interface{}{"theme": "dark"}}
+	expired := &models.Session{UserID: int(bob.ID), ExpiresAt: time.Now().Add(-time.Hour)}
+	for _, session := range []*models.Session{live, expired} {
+		if err := s.CreateSession(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if live.ID == "" {
+		t.Fatal("CreateSession did not generate an ID")
+	}
+	if got, err := s.GetSession(ctx, live.ID); err != nil || got.UserID != int(alice.ID) || got.Data["theme"] != "dark" {
+		t.Errorf("GetSession = %+v, %v", got, err)
+	}
+	if n, err := s.DeleteExpiredSessions(ctx); err != nil || n != 1 {
+		t.Errorf("DeleteExpiredSessions = %d, %v", n, err)
+	}
+	if _, err := s.GetSession(ctx, expired.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired session still stored: %v", err)
+	}
+
+	// Tokens
+	past := time.Now().Add(-time.Minute)
+	userToken := &models.Token{OwnerType: models.OwnerTypeUser, OwnerID: alice.ID, Name: "cli", TokenHash: "h1", TokenPrefix: "usr_abcd", Scope: "read", AllowedIPs: []string{"192.0.2.0/24"}}
+	oldToken := &models.Token{OwnerType: models.OwnerTypeUser, OwnerID: alice.ID, Name: "old", TokenHash: "h2", TokenPrefix: "usr_efgh", Scope: "read", ExpiresAt: &past}
+	adminToken := &models.Token{OwnerType: models.OwnerTypeAdmin, OwnerID: admin.ID, Name: "ops", TokenHash: "h3", TokenPrefix: "adm_ijkl", Scope: "global"}
+	for _, token := range []*models.Token{userToken, oldToken, adminToken} {
+		if err := s.CreateToken(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := s.GetTokenByHash(ctx, models.OwnerTypeUser, "h1"); err != nil || got.ID != userToken.ID || len(got.AllowedIPs) != 1 {
+		t.Errorf("GetTokenByHash = %+v, %v", got, err)
+	}
+	if _, err := s.GetTokenByHash(ctx, models.OwnerTypeUser, "h3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("admin token found as a user token: %v", err)
+	}
+	if n, err := s.DeleteExpiredTokens(ctx); err != nil || n != 1 {
+		t.Errorf("DeleteExpiredTokens = %d, %v", n, err)
+	}
+	if err := s.DeleteToken(ctx, models.OwnerTypeUser, bob.ID, userToken.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteToken by another user = %v, want ErrNotFound", err)
+	}
+	if tokens, _ := s.ListTokens(ctx, models.OwnerTypeUser, alice.ID); len(tokens) != 1 || tokens[0].Name != "cli" {
+		t.Errorf("ListTokens = %v", tokens)
+	}
+	if tokens, err := s.ListTokensByType(ctx, models.OwnerTypeAdmin); err != nil || len(tokens) != 1 || tokens[0].OwnerID != admin.ID {
+		t.Errorf("ListTokensByType(admin) = %v, %v", tokens, err)
+	}
+
+	// Preferences
+	prefs, err := s.GetUserPreferences(ctx, alice.ID)
+	if err != nil || prefs.Theme != "auto" || prefs.TemperatureUnit != "celsius" || !prefs.NotificationsEnabled {
+		t.Fatalf("default preferences = %+v, %v", prefs, err)
+	}
+	if _, err := s.GetUserPreferences(ctx, 9999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUserPreferences(missing) = %v, want ErrNotFound", err)
+	}
+	prefs.Theme = "light"
+	prefs.NotificationsEnabled = false
+	if err := s.SaveUserPreferences(ctx, prefs); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetUserPreferences(ctx, alice.ID); err != nil || got.Theme != "light" || got.NotificationsEnabled || got.TemperatureUnit != "celsius" {
+		t.Errorf("GetUserPreferences = %+v, %v", got, err)
+	}
+
+	// Locations
+	home := &models.SavedLocation{UserID: int(alice.ID), Name: "Home", Latitude: 40.71, Longitude: -74.0, Timezone: "America/New_York", AlertsEnabled: true}
+	if err := s.CreateLocation(ctx, home); err != nil {
+		t.Fatal(err)
+	}
+	home.Name = "Apartment"
+	home.AlertsEnabled = false
+	if err := s.UpdateLocation(ctx, home); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetLocation(ctx, int64(home.ID)); err != nil || got.Name != "Apartment" || got.AlertsEnabled || got.Timezone != "America/New_York" {
+		t.Errorf("GetLocation = %+v, %v", got, err)
+	}
+	if n, _ := s.CountUserLocations(ctx, alice.ID); n != 1 {
+		t.Errorf("CountUserLocations = %d", n)
+	}
+	office := &models.SavedLocation{UserID: int(bob.ID), Name: "Office", Latitude: 51.5, Longitude: -0.1, AlertsEnabled: true}
+	if err := s.CreateLocation(ctx, office); err != nil {
+		t.Fatal(err)
+	}
+	if alerts, err := s.ListAlertLocations(ctx); err != nil || len(alerts) != 1 || alerts[0].ID != office.ID {
+		t.Errorf("ListAlertLocations = %v, %v", alerts, err)
+	}
+	if err := s.DeleteLocation(ctx, int64(office.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Notifications
+	uid := int(alice.ID)
+	notification := &models.Notification{UserID: &uid, Type: models.NotificationTypeInfo, Title: "Hi", Message: "Welcome",
+		Action: &models.NotificationAction{Label: "Open", URL: "/dashboard"}}
+	if err := s.CreateNotification(ctx, notification); err != nil {
+		t.Fatal(err)
+	}
+	if notification.ID == "" || notification.ExpiresAt == nil || notification.Display != models.NotificationDisplayToast {
+		t.Fatalf("notification defaults = %+v", notification)
+	}
+	stale := time.Now().Add(-time.Minute)
+	if err := s.CreateNotification(ctx, &models.Notification{UserID: &uid, Type: models.NotificationTypeInfo, Title: "Old", Message: "Old", ExpiresAt: &stale}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.DeleteExpiredNotifications(ctx); err != nil || n != 1 {
+		t.Errorf("DeleteExpiredNotifications = %d, %v", n, err)
+	}
+	list, err := s.ListUserNotifications(ctx, alice.ID, false, 10, 0)
+	if err != nil || len(list) != 1 || list[0].Action == nil || list[0].Action.URL != "/dashboard" {
+		t.Errorf("ListUserNotifications = %v, %v", list, err)
+	}
+	second := &models.Notification{UserID: &uid, Type: models.NotificationTypeWarning, Title: "Wind", Message: "Gusts",
+		CreatedAt: notification.CreatedAt.Add(time.Second)}
+	if err := s.CreateNotification(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MarkNotificationRead(ctx, notification.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.CountUserNotifications(ctx, alice.ID, true); err != nil || n != 1 {
+		t.Errorf("CountUserNotifications(unread) = %d, %v", n, err)
+	}
+	if list, _ := s.ListUserNotifications(ctx, alice.ID, false, 1, 1); len(list) != 1 || list[0].ID != notification.ID || !list[0].Read {
+		t.Errorf("second page of notifications = %v", list)
+	}
+	if n, err := s.MarkAllNotificationsRead(ctx, alice.ID); err != nil || n != 1 {
+		t.Errorf("MarkAllNotificationsRead = %d, %v", n, err)
+	}
+	if list, _ := s.ListUserNotifications(ctx, alice.ID, true, 10, 0); len(list) != 0 {
+		t.Errorf("unread after MarkAllNotificationsRead = %v", list)
+	}
+	if err := s.MarkNotificationRead(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("MarkNotificationRead(missing) = %v, want ErrNotFound", err)
+	}
+	if err := s.DeleteNotification(ctx, second.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Email verification and password reset tokens
+	verification := &models.UserEmailVerification{UserID: alice.ID, Email: alice.Email, Token: "verify", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.CreateEmailVerification(ctx, verification); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetEmailVerification(ctx, "verify"); err != nil || got.ID != verification.ID || got.Email != alice.Email {
+		t.Errorf("GetEmailVerification = %+v, %v", got, err)
+	}
+	reset := &models.UserPasswordReset{UserID: alice.ID, Token: "reset", IPAddress: "192.0.2.1", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.CreatePasswordReset(ctx, reset); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.GetPasswordReset(ctx, "reset"); err != nil || got.ID != reset.ID || got.IPAddress != "192.0.2.1" {
+		t.Errorf("GetPasswordReset = %+v, %v", got, err)
+	}
+	if err := s.CreatePasswordReset(ctx, &models.UserPasswordReset{UserID: bob.ID, Token: "reset", ExpiresAt: time.Now()}); err == nil {
+		t.Error("Expected duplicate reset token to be rejected")
+	}
+	if err := s.DeleteEmailVerification(ctx, verification.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetEmailVerification(ctx, "verify"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted verification = %v, want ErrNotFound", err)
+	}
+
+	// Settings
+	if err := s.UpdateSetting(ctx, "server.title", "Forecasts"); err != nil {
+		t.Fatal(err)
+	}
+	if setting, err := s.GetSetting(ctx, "server.title"); err != nil || setting.Value != "Forecasts" || setting.Category != "server" {
+		t.Errorf("GetSetting = %+v, %v", setting, err)
+	}
+	if err := s.UpdateSetting(ctx, "server.missing", "x"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateSetting(missing) = %v, want ErrNotFound", err)
+	}
+	if err := s.UpsertSetting(ctx, &models.Setting{Key: "setup.completed", Value: "true", Type: "bool"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpsertSetting(ctx, &models.Setting{Key: "server.title", Value: "Weather"}); err != nil {
+		t.Fatal(err)
+	}
+	if setting, err := s.GetSetting(ctx, "setup.completed"); err != nil || setting.Value != "true" || setting.Type != "bool" {
+		t.Errorf("GetSetting(setup.completed) = %+v, %v", setting, err)
+	}
+	if setting, err := s.GetSetting(ctx, "server.title"); err != nil || setting.Value != "Weather" {
+		t.Errorf("GetSetting after UpsertSetting = %+v, %v", setting, err)
+	}
+	if n, err := s.DeleteSettings(ctx); err != nil || n != 2 {
+		t.Errorf("DeleteSettings = %d, %v", n, err)
+	}
+	if settings, _ := s.ListSettings(ctx); len(settings) != 0 {
+		t.Errorf("settings after DeleteSettings = %v", settings)
+	}
+
+	// Audit log
+	entries, err := s.ListAuditLog(ctx, 10)
+	if err != nil || len(entries) != 2 || entries[0].Action != "settings.update" || entries[0].Status != "success" {
+		t.Errorf("ListAuditLog = %v, %v", entries, err)
+	}
+	if n, err := s.DeleteAuditLogBefore(ctx, time.Now().AddDate(0, 0, -30)); err != nil || n != 1 {
+		t.Errorf("DeleteAuditLogBefore = %d, %v", n, err)
+	}
+	if entries, _ := s.ListAuditLog(ctx, 10); len(entries) != 1 {
+		t.Errorf("audit log after DeleteAuditLogBefore = %v", entries)
+	}
+
+	// Notification channels and delivery queue
+	if err := s.UpdateNotificationChannel(ctx, "email", true, `{"host":"mail"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateNotificationChannel(ctx, "pager", true, "{}"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateNotificationChannel(missing) = %v, want ErrNotFound", err)
+	}
+	if ch, err := s.GetNotificationChannel(ctx, "email"); err != nil || !ch.Enabled || ch.Config != `{"host":"mail"}` || ch.State != "disabled" {
+		t.Errorf("GetNotificationChannel = %+v, %v", ch, err)
+	}
+	if channels, err := s.ListNotificationChannels(ctx); err != nil || len(channels) != 1 || channels[0].Name != "Email" {
+		t.Errorf("ListNotificationChannels = %v, %v", channels, err)
+	}
+	queue, err := s.NotificationQueueStats(ctx)
+	if err != nil || queue.Total != 3 || queue.Pending != 1 || queue.Delivered != 1 || queue.DeadLetters != 1 || queue.ByChannel["email"] != 2 {
+		t.Errorf("NotificationQueueStats = %+v, %v", queue, err)
+	}
+	if history, err := s.ListNotificationHistory(ctx, "", "", 10); err != nil || len(history) != 2 || history[0].Subject != "Wind" {
+		t.Errorf("ListNotificationHistory = %v, %v", history, err)
+	}
+	if history, _ := s.ListNotificationHistory(ctx, "email", "delivered", 10); len(history) != 1 || history[0].Subject != "Storm" {
+		t.Errorf("ListNotificationHistory(email, delivered) = %v", history)
+	}
+
+	stats, err := s.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *stats != (Stats{Users: 2, Locations: 1, Tokens: 1, Sessions: 1, Notifications: 1}) {
+		t.Errorf("Stats = %+v", stats)
+	}
+
+	// Deleting a user removes what belongs to it
+	if err := s.DeleteUser(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ = s.Stats(ctx); *stats != (Stats{Users: 1}) {
+		t.Errorf("Stats after DeleteUser = %+v", stats)
+	}
+	if _, err := s.GetPasswordReset(ctx, "reset"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("password reset of a deleted user = %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetUserPreferences(ctx, alice.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("preferences of a deleted user = %v, want ErrNotFound", err)
+	}
+}
@@ -253,8 +253,9 @@ func (l *Logger) Warn(format string, v ...interface{}) {
 func (l *Logger) RotateLogs() error {
 	timestamp := time.Now().Format("2006-01-02")
 
-	// AI.md PART 11: Include all log files in rotation
-	logFiles := []string{"access.log", "error.log", "audit.log", "security.log", "debug.log"}
+	// AI.md PART 11: Include all log files in rotation. audit.log is
+	// rotated by the audit logger so its hash chain is never cut mid-write.
+	logFiles := []string{"access.log", "error.log", "security.log", "debug.log"}
 
 	for _, logFile := range logFiles {
 		currentPath := filepath.Join(l.logDir, logFile)
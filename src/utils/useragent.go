@@ -0,0 +1,68 @@
+package utils
+
+import "strings"
+
+// UserAgentInfo is the coarse device description used for login alerts and
+// device recognition. Versions are left out so browser updates do not look
+// like a new device.
+type UserAgentInfo struct {
+	Browser string
+	OS      string
+	Mobile  bool
+}
+
+// String returns "Browser on OS", e.g. "Firefox on Windows"
+func (u UserAgentInfo) String() string {
+	return u.Browser + " on " + u.OS
+}
+
+// ParseUserAgent extracts the browser family, OS family and mobile flag from
+// a User-Agent header
+func ParseUserAgent(ua string) UserAgentInfo {
+	info := UserAgentInfo{Browser: "Unknown browser", OS: "Unknown OS"}
+
+	// Order matters: Edge and Opera include "Chrome", Chrome includes "Safari"
+	switch {
+	case strings.Contains(ua, "Edg/") || strings.Contains(ua, "Edge/") || strings.Contains(ua, "EdgA/") || strings.Contains(ua, "EdgiOS/"):
+		info.Browser = "Edge"
+	case strings.Contains(ua, "OPR/") || strings.Contains(ua, "Opera"):
+		info.Browser = "Opera"
+	case strings.Contains(ua, "SamsungBrowser/"):
+		info.Browser = "Samsung Internet"
+	case strings.Contains(ua, "Firefox/") || strings.Contains(ua, "FxiOS/"):
+		info.Browser = "Firefox"
+	case strings.Contains(ua, "Chrome/") || strings.Contains(ua, "CriOS/") || strings.Contains(ua, "Chromium/"):
+		info.Browser = "Chrome"
+	case strings.Contains(ua, "Safari/") && strings.Contains(ua, "Version/"):
+		info.Browser = "Safari"
+	case strings.HasPrefix(ua, "curl/"):
+		info.Browser = "curl"
+	case strings.HasPrefix(ua, "weather-cli"):
+		info.Browser = "weather-cli"
+	case ua != "" && !strings.HasPrefix(ua, "Mozilla/"):
+		// API clients: keep the product name without its version
+		if name, _, _ := strings.Cut(ua, "/"); name != "" {
+			info.Browser = strings.Fields(name)[0]
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod"):
+		info.OS = "iOS"
+	case strings.Contains(ua, "Android"):
+		info.OS = "Android"
+	case strings.Contains(ua, "CrOS"):
+		info.OS = "ChromeOS"
+	case strings.Contains(ua, "Windows"):
+		info.OS = "Windows"
+	case strings.Contains(ua, "Mac OS X") || strings.Contains(ua, "Macintosh"):
+		info.OS = "macOS"
+	case strings.Contains(ua, "Linux"):
+		info.OS = "Linux"
+	case strings.Contains(ua, "FreeBSD") || strings.Contains(ua, "OpenBSD"):
+		info.OS = "BSD"
+	}
+
+	info.Mobile = strings.Contains(ua, "Mobile") || info.OS == "iOS" || info.OS == "Android"
+	return info
+}
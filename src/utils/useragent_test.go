@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"testing"
+)
+
+// TestParseUserAgent tests browser and OS family detection for device names
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name   string
+		ua     string
+		want   string
+		mobile bool
+	}{
+		{"chrome_windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36", "Chrome on Windows", false},
+		{"edge_windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0", "Edge on Windows", false},
+		{"safari_iphone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1", "Safari on iOS", true},
+		{"firefox_linux", "Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0", "Firefox on Linux", false},
+		{"chrome_android", "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36", "Chrome on Android", true},
+		{"safari_mac", "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15", "Safari on macOS", false},
+		{"empty", "", "Unknown browser on Unknown OS", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseUserAgent(tt.ua)
+			if got.String() != tt.want {
+				t.Errorf("ParseUserAgent() = %q, want %q", got.String(), tt.want)
+			}
+			if got.Mobile != tt.mobile {
+				t.Errorf("Mobile = %v, want %v", got.Mobile, tt.mobile)
+			}
+		})
+	}
+}
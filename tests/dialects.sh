@@ -0,0 +1,100 @@
+#!/usr/bin/env bash
+# Runs the database and model tests against every supported SQL dialect.
+#
+# SQLite always runs. PostgreSQL and MySQL/MariaDB run against the server in
+# WEATHER_TEST_POSTGRES_URL / WEATHER_TEST_MYSQL_URL when set, otherwise
+# against a throwaway local server when initdb/pg_ctl or mariadbd/mysqld are
+# installed (no containers needed). Dialects with neither are skipped.
+
+set -euo pipefail
+
+cd "$(dirname "$0")/.."
+
+GREEN='\033[0;32m'
+YELLOW='\033[1;33m'
+RED='\033[0;31m'
+NC='\033[0m'
+
+PACKAGES=(./src/database/ ./src/server/model/ ./src/server/store/)
+WORK_DIR="${TMPDIR:-/tmp}/weather-dialects-$$"
+mkdir -p "$WORK_DIR"
+PG_DIR=""
+MYSQL_PID=""
+
+cleanup() {
+    if [ -n "$PG_DIR" ]; then
+        pg_ctl -D "$PG_DIR" -m immediate stop >/dev/null 2>&1 || true
+    fi
+    if [ -n "$MYSQL_PID" ]; then
+        kill "$MYSQL_PID" 2>/dev/null || true
+        wait "$MYSQL_PID" 2>/dev/null || true
+    fi
+    rm -rf "$WORK_DIR"
+}
+trap cleanup EXIT
+
+start_postgres() {
+    command -v initdb >/dev/null && command -v pg_ctl >/dev/null || return 1
+    PG_DIR="$WORK_DIR/pg"
+    initdb -D "$PG_DIR" -U weather --auth=trust >/dev/null
+    pg_ctl -D "$PG_DIR" -o "-p 55432 -k $WORK_DIR -c listen_addresses=127.0.0.1" -w start >/dev/null
+    createdb -h 127.0.0.1 -p 55432 -U weather weather
+    PG_URL="postgres://weather@127.0.0.1:55432/weather"
+}
+
+start_mysql() {
+    local server
+    server="$(command -v mariadbd || command -v mysqld || true)"
+    [ -n "$server" ] || return 1
+    local dir="$WORK_DIR/mysql"
+    mkdir -p "$dir"
+    if command -v mariadb-install-db >/dev/null; then
+        mariadb-install-db --datadir="$dir" --auth-root-authentication-method=normal >/dev/null
+    else
+        "$server" --initialize-insecure --datadir="$dir" >/dev/null 2>&1
+    fi
+    "$server" --datadir="$dir" --port=53306 --bind-address=127.0.0.1 \
+        --socket="$WORK_DIR/mysql.sock" >"$WORK_DIR/mysql.log" 2>&1 &
+    MYSQL_PID=$!
+    for _ in $(seq 1 30); do
+        if (echo > /dev/tcp/127.0.0.1/53306) 2>/dev/null; then
+            MYSQL_URL="mysql://root@127.0.0.1:53306/mysql"
+            return 0
+        fi
+        sleep 1
+    done
+    return 1
+}
+
+run() {
+    local name="$1" url="$2"
+    echo -e "${GREEN}▶ ${name}${NC}"
+    if ! WEATHER_TEST_DATABASE_URL="$url" go test -count=1 "${PACKAGES[@]}"; then
+        FAILED+=("$name")
+    fi
+}
+
+FAILED=()
+run sqlite ""
+
+PG_URL="${WEATHER_TEST_POSTGRES_URL:-}"
+[ -n "$PG_URL" ] || start_postgres || true
+if [ -n "$PG_URL" ]; then
+    run postgres "$PG_URL"
+else
+    echo -e "${YELLOW}⏭  postgres skipped: set WEATHER_TEST_POSTGRES_URL or install initdb/pg_ctl${NC}"
+fi
+
+MYSQL_URL="${WEATHER_TEST_MYSQL_URL:-}"
+[ -n "$MYSQL_URL" ] || start_mysql || true
+if [ -n "$MYSQL_URL" ]; then
+    run mysql "$MYSQL_URL"
+else
+    echo -e "${YELLOW}⏭  mysql skipped: set WEATHER_TEST_MYSQL_URL or install mariadbd/mysqld${NC}"
+fi
+
+if [ ${#FAILED[@]} -gt 0 ]; then
+    echo -e "${RED}❌ Failed: ${FAILED[*]}${NC}"
+    exit 1
+fi
+echo -e "${GREEN}✅ All available dialects passed${NC}"
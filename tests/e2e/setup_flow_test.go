@@ -12,6 +12,7 @@ import (
 	_ "modernc.org/sqlite"
 	"github.com/apimgr/weather/src/database"
 	"github.com/apimgr/weather/src/server/handler"
+	"github.com/apimgr/weather/src/server/store"
 )
 
 // initTestDualDB creates in-memory dual databases for testing
@@ -70,7 +71,7 @@ func TestCompleteSetupFlow(t *testing.T) {
 
 	// Create router
 	r := gin.New()
-	setupHandler := &handler.SetupHandler{DB: dualDB.Server}
+	setupHandler := &handler.SetupHandler{DB: dualDB.Server, Store: store.New(dualDB)}
 
 	// Setup route for the admin account step
 	r.POST("/admin/server/setup", setupHandler.CreateAdmin)
@@ -134,7 +135,7 @@ func TestAdminSetupValidation(t *testing.T) {
 	defer cleanup()
 
 	r := gin.New()
-	setupHandler := &handler.SetupHandler{DB: dualDB.Server}
+	setupHandler := &handler.SetupHandler{DB: dualDB.Server, Store: store.New(dualDB)}
 	r.POST("/admin/server/setup", setupHandler.CreateAdmin)
 
 	tests := []struct {
@@ -12,6 +12,7 @@ import (
 	_ "modernc.org/sqlite"
 	"github.com/apimgr/weather/src/database"
 	"github.com/apimgr/weather/src/server/handler"
+	"github.com/apimgr/weather/src/server/store"
 )
 
 // initTestDualDB creates in-memory dual databases for testing
@@ -73,7 +74,7 @@ func TestAuthHandler_Register(t *testing.T) {
 	r, dualDB, cleanup := setupTestRouter(t)
 	defer cleanup()
 
-	authHandler := &handler.AuthHandler{DB: dualDB.Users}
+	authHandler := &handler.AuthHandler{DB: dualDB.Users, Store: store.New(dualDB)}
 
 	r.POST("/register", authHandler.HandleRegister)
 
@@ -148,7 +149,7 @@ func TestAuthHandler_Login(t *testing.T) {
 	r, dualDB, cleanup := setupTestRouter(t)
 	defer cleanup()
 
-	authHandler := &handler.AuthHandler{DB: dualDB.Users}
+	authHandler := &handler.AuthHandler{DB: dualDB.Users, Store: store.New(dualDB)}
 
 	// Setup routes
 	r.POST("/register", authHandler.HandleRegister)